@@ -0,0 +1,164 @@
+package coap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// ACLRule allows or denies requests of principal to path. Empty Principal or "*" matches all peers,
+// Principal in CIDR notation matches peer address, otherwise it matches common name of peer certificate
+// of DTLS or TLS connection. Path ending by "*" is prefix, otherwise it must be equal to path of request.
+// Empty Methods matches all methods.
+type ACLRule struct {
+	Principal string
+	Path      string
+	Methods   []COAPCode
+	Allow     bool
+}
+
+type aclRule struct {
+	ACLRule
+	network *net.IPNet
+	path    string
+	prefix  bool
+}
+
+func newACLRule(rule ACLRule) aclRule {
+	r := aclRule{ACLRule: rule, path: strings.TrimPrefix(rule.Path, "/")}
+	if strings.HasSuffix(r.path, "*") {
+		r.path = strings.TrimSuffix(r.path, "*")
+		r.prefix = true
+	}
+	if _, network, err := net.ParseCIDR(rule.Principal); err == nil {
+		r.network = network
+	}
+	return r
+}
+
+func (r *aclRule) matchPrincipal(addr net.Addr, commonName string) bool {
+	switch {
+	case r.Principal == "" || r.Principal == "*":
+		return true
+	case r.network != nil:
+		var ip net.IP
+		switch a := addr.(type) {
+		case *net.UDPAddr:
+			ip = a.IP
+		case *net.TCPAddr:
+			ip = a.IP
+		}
+		return ip != nil && r.network.Contains(ip)
+	}
+	return commonName != "" && r.Principal == commonName
+}
+
+func (r *aclRule) matchPath(path string) bool {
+	if r.prefix {
+		return strings.HasPrefix(path, r.path)
+	}
+	return path == r.path
+}
+
+func (r *aclRule) matchMethod(code COAPCode) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if m == code {
+			return true
+		}
+	}
+	return false
+}
+
+// NewACLMiddleware checks requests by acl, the first matching rule decides. Requests which are denied
+// or don't match any rule get 4.03 Forbidden.
+func NewACLMiddleware(acl []ACLRule) MiddlewareFunc {
+	rules := make([]aclRule, 0, len(acl))
+	for _, rule := range acl {
+		rules = append(rules, newACLRule(rule))
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			addr := r.Client.RemoteAddr()
+			commonName := peerCommonName(r)
+			path := r.Msg.PathString()
+			for i := range rules {
+				rule := &rules[i]
+				if rule.matchPrincipal(addr, commonName) && rule.matchPath(path) && rule.matchMethod(r.Msg.Code()) {
+					if rule.Allow {
+						next.ServeCOAP(w, r)
+						return
+					}
+					break
+				}
+			}
+			w.SetCode(Forbidden)
+			w.Write(nil)
+		})
+	}
+}
+
+// peerCommonName returns common name of certificate of peer connected by DTLS or TLS.
+func peerCommonName(r *Request) string {
+	session := r.Client.networkSession()
+	if b, ok := session.(*blockWiseSession); ok {
+		session = b.networkSession
+	}
+	var cert *x509.Certificate
+	switch s := session.(type) {
+	case *sessionDTLS:
+		if c, ok := s.connection.Connection().(interface{ RemoteCertificate() *x509.Certificate }); ok {
+			cert = c.RemoteCertificate()
+		}
+	case *sessionTCP:
+		if c, ok := s.connection.Connection().(*tls.Conn); ok {
+			if certs := c.ConnectionState().PeerCertificates; len(certs) > 0 {
+				cert = certs[0]
+			}
+		}
+	}
+	if cert == nil {
+		return ""
+	}
+	return cert.Subject.CommonName
+}
+
+type jsonACLRule struct {
+	Principal string   `json:"principal"`
+	Path      string   `json:"path"`
+	Methods   []string `json:"methods,omitempty"`
+	Allow     bool     `json:"allow"`
+}
+
+// LoadACLFromJSON reads rules of NewACLMiddleware from JSON array, eg.
+// [{"principal": "10.0.0.0/8", "path": "/sensors/*", "methods": ["GET"], "allow": true}].
+func LoadACLFromJSON(r io.Reader) ([]ACLRule, error) {
+	var rules []jsonACLRule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, err
+	}
+	acl := make([]ACLRule, 0, len(rules))
+	for i, rule := range rules {
+		methods := make([]COAPCode, 0, len(rule.Methods))
+		for _, m := range rule.Methods {
+			code, ok := parseJSONName(&codeNames, m)
+			if !ok || code < uint8(GET) || code > uint8(IPATCH) {
+				return nil, fmt.Errorf("rule %v: unknown method %q", i, m)
+			}
+			methods = append(methods, COAPCode(code))
+		}
+		acl = append(acl, ACLRule{
+			Principal: rule.Principal,
+			Path:      rule.Path,
+			Methods:   methods,
+			Allow:     rule.Allow,
+		})
+	}
+	return acl, nil
+}
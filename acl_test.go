@@ -0,0 +1,87 @@
+package coap
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestACLMiddleware(t *testing.T) {
+	acl := []ACLRule{
+		{Principal: "127.0.0.0/8", Path: "/public/*", Methods: []COAPCode{GET}, Allow: true},
+		{Principal: "127.0.0.0/8", Path: "/admin", Allow: false},
+		{Principal: "10.0.0.0/8", Path: "/*", Allow: true},
+	}
+	handler := NewACLMiddleware(acl)(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("ok"))
+	}))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, handler.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Get("/public/temp")
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(resp.Payload()))
+
+	forbidden := func(err error) {
+		code, ok := ResponseCode(err)
+		require.True(t, ok, "unexpected error %v", err)
+		require.Equal(t, Forbidden, code)
+	}
+	// method doesn't match the first rule, no other rule matches
+	_, err = co.Delete("/public/temp")
+	forbidden(err)
+	// denied by the second rule
+	_, err = co.Get("/admin")
+	forbidden(err)
+	// the third rule is for other peers, default deny
+	_, err = co.Get("/other")
+	forbidden(err)
+}
+
+func TestACLRuleMatch(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 5684}
+	cn := newACLRule(ACLRule{Principal: "device1"})
+	require.True(t, cn.matchPrincipal(peer, "device1"))
+	require.False(t, cn.matchPrincipal(peer, "device2"))
+	require.False(t, cn.matchPrincipal(peer, ""))
+	cidr := newACLRule(ACLRule{Principal: "192.168.0.0/16"})
+	require.True(t, cidr.matchPrincipal(peer, ""))
+	require.False(t, cidr.matchPrincipal(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)}, "192.168.0.0/16"))
+	any := newACLRule(ACLRule{Principal: "*"})
+	require.True(t, any.matchPrincipal(peer, ""))
+
+	prefix := newACLRule(ACLRule{Path: "/sensors/*"})
+	require.True(t, prefix.matchPath("sensors/temp"))
+	require.False(t, prefix.matchPath("sensors"))
+	exact := newACLRule(ACLRule{Path: "/sensors"})
+	require.True(t, exact.matchPath("sensors"))
+	require.False(t, exact.matchPath("sensors/temp"))
+}
+
+func TestLoadACLFromJSON(t *testing.T) {
+	acl, err := LoadACLFromJSON(strings.NewReader(`[
+		{"principal": "10.0.0.0/8", "path": "/sensors/*", "methods": ["GET", "PUT"], "allow": true},
+		{"principal": "*", "path": "/admin"}
+	]`))
+	require.NoError(t, err)
+	require.Equal(t, []ACLRule{
+		{Principal: "10.0.0.0/8", Path: "/sensors/*", Methods: []COAPCode{GET, PUT}, Allow: true},
+		{Principal: "*", Path: "/admin", Methods: []COAPCode{}},
+	}, acl)
+
+	_, err = LoadACLFromJSON(strings.NewReader(`[{"path": "/a", "methods": ["Content"]}]`))
+	require.Error(t, err)
+	_, err = LoadACLFromJSON(strings.NewReader(`{`))
+	require.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package coap
+
+import (
+	"context"
+)
+
+func tcpSessionOf(s networkSession) (*sessionTCP, bool) {
+	if b, ok := s.(*blockWiseSession); ok {
+		s = b.networkSession
+	}
+	t, ok := s.(*sessionTCP)
+	return t, ok
+}
+
+func (s *sessionTCP) setReleased(alternativeAddresses []string) {
+	s.releaseLock.Lock()
+	defer s.releaseLock.Unlock()
+	s.released = true
+	s.alternativeAddresses = alternativeAddresses
+}
+
+// Released reports whether peer asked by Release signal (RFC 8323 section 5.5) to stop using connection.
+func (co *ClientConn) Released() bool {
+	s, ok := tcpSessionOf(co.networkSession())
+	if !ok {
+		return false
+	}
+	s.releaseLock.Lock()
+	defer s.releaseLock.Unlock()
+	return s.released
+}
+
+// AlternativeAddresses returns addresses advertised by Release signal of peer, in order of preference.
+func (co *ClientConn) AlternativeAddresses() []string {
+	s, ok := tcpSessionOf(co.networkSession())
+	if !ok {
+		return nil
+	}
+	s.releaseLock.Lock()
+	defer s.releaseLock.Unlock()
+	return append([]string(nil), s.alternativeAddresses...)
+}
+
+// SendRelease sends Release signal asking peer of TCP connection to stop using it and to connect
+// to alternative addresses instead, eg. "host:port".
+func (co *ClientConn) SendRelease(alternativeAddresses ...string) error {
+	return co.SendReleaseWithContext(context.Background(), alternativeAddresses...)
+}
+
+// SendReleaseWithContext sends Release signal with context.
+func (co *ClientConn) SendReleaseWithContext(ctx context.Context, alternativeAddresses ...string) error {
+	if !co.networkSession().IsTCP() {
+		return ErrNotSupported
+	}
+	msg := co.NewMessage(MessageParams{Code: Release})
+	for _, a := range alternativeAddresses {
+		msg.AddOption(AlternativeAddress, a)
+	}
+	return co.WriteMsgWithContext(ctx, msg)
+}
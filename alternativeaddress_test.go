@@ -0,0 +1,73 @@
+package coap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseAlternativeAddresses(t *testing.T) {
+	s, addr, fin, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		assert.NoError(t, r.Client.SendRelease("127.0.0.1:5699", "[::1]:5699"))
+		w.SetCode(Content)
+		w.Write(nil)
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("tcp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+	assert.False(t, co.Released())
+	_, err = co.Get("/a")
+	require.NoError(t, err)
+	require.Eventually(t, co.Released, time.Second, time.Millisecond*10)
+	assert.Equal(t, []string{"127.0.0.1:5699", "[::1]:5699"}, co.AlternativeAddresses())
+}
+
+func TestPersistentTCPClientAlternativeAddress(t *testing.T) {
+	sb, addrB, finB, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetCode(Content)
+		w.Write([]byte("B"))
+	})
+	require.NoError(t, err)
+	defer func() {
+		sb.Shutdown()
+		<-finB
+	}()
+	clients := make(chan *ClientConn, 1)
+	sa, addrA, finA, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetCode(Content)
+		w.Write([]byte("A"))
+		select {
+		case clients <- r.Client:
+		default:
+		}
+	})
+	require.NoError(t, err)
+
+	c := &PersistentTCPClient{}
+	defer c.Close()
+	resp, err := c.Get(addrA, "/a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("A"), resp.Payload())
+
+	// primary server advertises alternative and goes away
+	primary := <-clients
+	require.NoError(t, primary.SendRelease(addrB))
+	primary.Close()
+	sa.Shutdown()
+	<-finA
+
+	require.Eventually(t, func() bool {
+		resp, err := c.Get(addrA, "/a")
+		return err == nil && string(resp.Payload()) == "B"
+	}, time.Second*5, time.Millisecond*50)
+	resp, err = c.Get(addrA, "/a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("B"), resp.Payload())
+}
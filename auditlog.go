@@ -0,0 +1,157 @@
+package coap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// AuditEntry records single request changing state of resource.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	Peer        string    `json:"peer"`
+	Method      COAPCode  `json:"method"`
+	Path        string    `json:"path"`
+	PayloadHash string    `json:"payloadHash"` // hex encoded SHA-256 of request payload
+	Code        COAPCode  `json:"code"`        // code of response, Empty when handler didn't respond
+	Handler     string    `json:"handler"`
+}
+
+// AuditStore persists audit entries.
+type AuditStore interface {
+	Append(entry AuditEntry) error
+}
+
+// InMemoryAuditStore keeps the last entries in memory.
+type InMemoryAuditStore struct {
+	lock       sync.Mutex
+	maxEntries int
+	entries    []AuditEntry
+}
+
+// NewInMemoryAuditStore creates store keeping up to maxEntries, the oldest entries are dropped.
+func NewInMemoryAuditStore(maxEntries int) *InMemoryAuditStore {
+	return &InMemoryAuditStore{maxEntries: maxEntries}
+}
+
+// Append stores entry.
+func (s *InMemoryAuditStore) Append(entry AuditEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.maxEntries > 0 && len(s.entries) >= s.maxEntries {
+		s.entries = append(s.entries[:0], s.entries[len(s.entries)-s.maxEntries+1:]...)
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Entries returns stored entries from the oldest one.
+func (s *InMemoryAuditStore) Entries() []AuditEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]AuditEntry(nil), s.entries...)
+}
+
+// FileAuditStore appends entries to file as newline delimited JSON.
+type FileAuditStore struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditStore opens file at path for appending, file is created when it doesn't exist.
+func NewFileAuditStore(path string) (*FileAuditStore, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditStore{file: f}, nil
+}
+
+// Append writes entry as a single line.
+func (s *FileAuditStore) Append(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes file.
+func (s *FileAuditStore) Close() error {
+	return s.file.Close()
+}
+
+// handlerName identifies h by name of its function or by its type.
+func handlerName(h Handler) string {
+	if f, ok := h.(HandlerFunc); ok {
+		if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+			return fn.Name()
+		}
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+type auditResponseWriter struct {
+	ResponseWriter
+	code COAPCode
+}
+
+func (w *auditResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *auditResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *auditResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *auditResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	w.code = msg.Code()
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+func (w *auditResponseWriter) WriteError(err error) {
+	writeError(w, err)
+}
+
+// NewAuditLogMiddleware appends entry to store for every PUT, POST and DELETE request after
+// handler returns, whether it succeeded or not. Errors of store don't affect the response.
+func NewAuditLogMiddleware(store AuditStore) MiddlewareFunc {
+	return func(next Handler) Handler {
+		name := handlerName(next)
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			method := r.Msg.Code()
+			if method != PUT && method != POST && method != DELETE {
+				next.ServeCOAP(w, r)
+				return
+			}
+			aw := &auditResponseWriter{ResponseWriter: w}
+			next.ServeCOAP(aw, r)
+			hash := sha256.Sum256(r.Msg.Payload())
+			store.Append(AuditEntry{
+				Time:        time.Now(),
+				Peer:        r.Client.RemoteAddr().String(),
+				Method:      method,
+				Path:        r.Msg.PathString(),
+				PayloadHash: hex.EncodeToString(hash[:]),
+				Code:        aw.code,
+				Handler:     name,
+			})
+		})
+	}
+}
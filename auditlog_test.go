@@ -0,0 +1,108 @@
+package coap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func auditTestHandler(w ResponseWriter, r *Request) {
+	if r.Msg.PathString() == "denied" {
+		w.SetCode(Forbidden)
+		w.Write(nil)
+		return
+	}
+	w.SetCode(Changed)
+	w.Write(nil)
+}
+
+func TestAuditLogMiddleware(t *testing.T) {
+	store := NewInMemoryAuditStore(10)
+	handler := NewAuditLogMiddleware(store)(HandlerFunc(auditTestHandler))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, handler.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err := co.Put(fmt.Sprintf("/a/%v", i), TextPlain, bytes.NewReader([]byte(fmt.Sprintf("v%v", i))))
+		require.NoError(t, err)
+	}
+	_, err = co.Get("/a/0")
+	require.NoError(t, err)
+
+	entries := store.Entries()
+	require.Len(t, entries, 5)
+	for i, e := range entries {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("v%v", i)))
+		assert.Equal(t, PUT, e.Method)
+		assert.Equal(t, fmt.Sprintf("a/%v", i), e.Path)
+		assert.Equal(t, hex.EncodeToString(hash[:]), e.PayloadHash)
+		assert.Equal(t, Changed, e.Code)
+		assert.Equal(t, co.LocalAddr().String(), e.Peer)
+		assert.Contains(t, e.Handler, "auditTestHandler")
+	}
+
+	// failed writes are logged too
+	_, err = co.Delete("/denied")
+	require.Error(t, err)
+	entries = store.Entries()
+	require.Len(t, entries, 6)
+	assert.Equal(t, DELETE, entries[5].Method)
+	assert.Equal(t, Forbidden, entries[5].Code)
+}
+
+func TestInMemoryAuditStoreLimit(t *testing.T) {
+	store := NewInMemoryAuditStore(2)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Append(AuditEntry{Path: fmt.Sprint(i)}))
+	}
+	entries := store.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "1", entries[0].Path)
+	assert.Equal(t, "2", entries[1].Path)
+}
+
+func TestFileAuditStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	for i := 0; i < 2; i++ {
+		store, err := NewFileAuditStore(path)
+		require.NoError(t, err)
+		require.NoError(t, store.Append(AuditEntry{Method: POST, Path: fmt.Sprint(i), Code: Created}))
+		require.NoError(t, store.Close())
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, "0", entries[0].Path)
+	assert.Equal(t, POST, entries[1].Method)
+	assert.Equal(t, Created, entries[1].Code)
+}
@@ -0,0 +1,46 @@
+package coap
+
+import (
+	"strings"
+)
+
+// AutoDiscoveryPath is path where NewAutoDiscoveryHandler is registered.
+const AutoDiscoveryPath = "/.well-known/coap-rd"
+
+// autoDiscoveryResourceType is resource type of resource directory (RFC 9176).
+const autoDiscoveryResourceType = "core.rd"
+
+// matchResourceType reports whether rt query value matches resource type, value may end by * (RFC 6690 4.1).
+func matchResourceType(value, rt string) bool {
+	if strings.HasSuffix(value, "*") {
+		return strings.HasPrefix(rt, value[:len(value)-1])
+	}
+	return value == rt
+}
+
+// NewAutoDiscoveryHandler creates handler which answers GET by CoAP URI of resource directory rdAddr
+// as text/plain, so devices can find it by unicast or multicast GET of AutoDiscoveryPath, eg.
+// to ff02::fd:5683. Address without scheme gets coap://. Request with rt query other than core.rd
+// gets 4.04 Not Found.
+func NewAutoDiscoveryHandler(rdAddr string) Handler {
+	uri := rdAddr
+	if !strings.Contains(uri, "://") {
+		uri = "coap://" + uri
+	}
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Msg.Code() != GET {
+			w.SetCode(MethodNotAllowed)
+			w.Write(nil)
+			return
+		}
+		for _, q := range r.Msg.Query() {
+			if strings.HasPrefix(q, "rt=") && !matchResourceType(q[len("rt="):], autoDiscoveryResourceType) {
+				w.SetCode(NotFound)
+				w.Write(nil)
+				return
+			}
+		}
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(uri))
+	})
+}
@@ -0,0 +1,47 @@
+package coap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoDiscoveryHandler(t *testing.T) {
+	mux := NewServeMux()
+	require.NoError(t, mux.Handle(AutoDiscoveryPath, NewAutoDiscoveryHandler("[2001:db8::1]:5683")))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, mux.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	get := func(query string) Message {
+		req, err := co.NewGetRequest(AutoDiscoveryPath)
+		require.NoError(t, err)
+		if query != "" {
+			req.SetOption(URIQuery, query)
+		}
+		resp, err := co.Exchange(req)
+		require.NoError(t, err)
+		return resp
+	}
+	for _, query := range []string{"", "rt=core.rd", "rt=core.*"} {
+		resp := get(query)
+		assert.Equal(t, Content, resp.Code(), query)
+		assert.Equal(t, TextPlain, resp.Option(ContentFormat))
+		assert.Equal(t, "coap://[2001:db8::1]:5683", string(resp.Payload()))
+	}
+
+	assert.Equal(t, NotFound, get("rt=other").Code())
+
+	_, err = co.Post(AutoDiscoveryPath, TextPlain, bytes.NewReader(nil))
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, MethodNotAllowed, code)
+}
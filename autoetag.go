@@ -0,0 +1,114 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"sync"
+)
+
+// autoETagSize is size of ETag computed by default hasher.
+const autoETagSize = 8
+
+// SHA256ETag is default hasher of AutoETagHandler, it returns SHA-256 of payload truncated to 8 bytes.
+func SHA256ETag(payload []byte) []byte {
+	sum := sha256.Sum256(payload)
+	return sum[:autoETagSize]
+}
+
+type autoETagResponseWriter struct {
+	ResponseWriter
+	hasher func(payload []byte) []byte
+
+	lock     sync.Mutex
+	handled  bool
+	captured Message
+}
+
+func (w *autoETagResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *autoETagResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *autoETagResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *autoETagResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	w.lock.Lock()
+	if !w.handled {
+		// response is sent when handler returns
+		w.captured = msg
+		w.lock.Unlock()
+		return nil
+	}
+	w.lock.Unlock()
+	// later notifications of observation
+	w.setETag(msg)
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+func (w *autoETagResponseWriter) setETag(msg Message) []byte {
+	if msg.Code() != Content {
+		return nil
+	}
+	etag := w.hasher(msg.Payload())
+	msg.SetOption(ETag, etag)
+	return etag
+}
+
+func (w *autoETagResponseWriter) finish(ctx context.Context) error {
+	w.lock.Lock()
+	w.handled = true
+	msg := w.captured
+	w.lock.Unlock()
+	if msg == nil {
+		return nil
+	}
+	req := w.getReq().Msg
+	etag := w.setETag(msg)
+	if preconditionFailed(req, etag, etag != nil) {
+		resp := w.NewResponse(PreconditionFailed)
+		return w.ResponseWriter.WriteMsgWithContext(ctx, resp)
+	}
+	if etag != nil {
+		for _, v := range req.Options(ETag) {
+			if e, ok := v.([]byte); ok && bytes.Equal(e, etag) {
+				// conditional GET: representation is still valid
+				resp := w.NewResponse(Valid)
+				resp.SetOption(ETag, etag)
+				for _, o := range []OptionID{Observe, MaxAge} {
+					if v := msg.Option(o); v != nil {
+						resp.SetOption(o, v)
+					}
+				}
+				return w.ResponseWriter.WriteMsgWithContext(ctx, resp)
+			}
+		}
+	}
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+// AutoETagHandler wraps GET handler and sets ETag of 2.05 Content responses to hash of their payload,
+// hasher defaults to SHA256ETag. Request with ETag of current representation gets 2.03 Valid without
+// payload. If-Match which doesn't match or If-None-Match for existing resource get 4.12 Precondition Failed,
+// If-None-Match for not existing resource passes through.
+func AutoETagHandler(inner Handler, hasher func(payload []byte) []byte) Handler {
+	if hasher == nil {
+		hasher = SHA256ETag
+	}
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Msg.Code() != GET && r.Msg.Code() != FETCH {
+			inner.ServeCOAP(w, r)
+			return
+		}
+		aw := &autoETagResponseWriter{ResponseWriter: w, hasher: hasher}
+		inner.ServeCOAP(aw, r)
+		aw.finish(r.Ctx)
+	})
+}
@@ -0,0 +1,72 @@
+package coap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoETagHandler(t *testing.T) {
+	var lock sync.Mutex
+	value := []byte("first")
+	resource := HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Msg.PathString() != "a" {
+			w.SetCode(NotFound)
+			w.Write(nil)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		w.SetContentFormat(TextPlain)
+		w.Write(value)
+	})
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, AutoETagHandler(resource, nil).ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	get := func(path string, options ...func(Message)) Message {
+		req, err := co.NewGetRequest(path)
+		require.NoError(t, err)
+		for _, o := range options {
+			o(req)
+		}
+		resp, err := co.Exchange(req)
+		require.NoError(t, err)
+		return resp
+	}
+	withOption := func(id OptionID, v interface{}) func(Message) {
+		return func(m Message) { m.SetOption(id, v) }
+	}
+
+	resp := get("/a")
+	require.Equal(t, Content, resp.Code())
+	etag1 := resp.Option(ETag).([]byte)
+	require.Equal(t, SHA256ETag([]byte("first")), etag1)
+
+	resp = get("/a", withOption(ETag, etag1))
+	require.Equal(t, Valid, resp.Code())
+	require.Empty(t, resp.Payload())
+	require.Equal(t, etag1, resp.Option(ETag))
+
+	lock.Lock()
+	value = []byte("second")
+	lock.Unlock()
+
+	resp = get("/a", withOption(ETag, etag1))
+	require.Equal(t, Content, resp.Code())
+	require.Equal(t, []byte("second"), resp.Payload())
+	etag2 := resp.Option(ETag).([]byte)
+	require.NotEqual(t, etag1, etag2)
+
+	require.Equal(t, Content, get("/a", withOption(IfMatch, etag2)).Code())
+	require.Equal(t, PreconditionFailed, get("/a", withOption(IfMatch, etag1)).Code())
+	require.Equal(t, PreconditionFailed, get("/a", withOption(IfNoneMatch, []byte{})).Code())
+	require.Equal(t, NotFound, get("/missing", withOption(IfNoneMatch, []byte{})).Code())
+}
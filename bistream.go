@@ -0,0 +1,403 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Stream messages are delivered to the server by POST requests, which are transferred by Block1 when
+// they exceed message size, and to the client by notifications of observation opened by OpenStream.
+// Requests of stream carry query stream=<token of observation>, notifications are ordered by Observe.
+// The first notification of stream opens it and notification with code 2.02 Deleted ends it.
+const biStreamQuery = "stream="
+
+// BiStream is bidirectional stream of messages.
+type BiStream interface {
+	// Send sends payload as single message of stream.
+	Send(payload []byte) error
+	// Recv returns next message of stream, io.EOF after the peer ended the stream.
+	Recv() ([]byte, error)
+	// Close ends the stream.
+	Close() error
+}
+
+// BiStreamHandler serves stream opened by client, the stream ends when handler returns.
+// Context is cancelled when client closes the stream.
+type BiStreamHandler func(ctx context.Context, stream BiStream)
+
+// biStreamQueue holds received messages until they are read.
+type biStreamQueue struct {
+	lock   sync.Mutex
+	items  [][]byte
+	err    error // set when no more messages arrive
+	notify chan struct{}
+}
+
+func newBiStreamQueue() *biStreamQueue {
+	return &biStreamQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *biStreamQueue) push(p []byte) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.err != nil {
+		return
+	}
+	q.items = append(q.items, p)
+	q.signal()
+}
+
+func (q *biStreamQueue) close(err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.err == nil {
+		q.err = err
+		q.signal()
+	}
+}
+
+func (q *biStreamQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *biStreamQueue) pop(ctx context.Context) ([]byte, error) {
+	for {
+		q.lock.Lock()
+		if len(q.items) > 0 {
+			p := q.items[0]
+			q.items = q.items[1:]
+			q.lock.Unlock()
+			return p, nil
+		}
+		err := q.err
+		q.lock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func biStreamID(r *Request) (string, bool) {
+	for _, q := range r.Msg.Query() {
+		if strings.HasPrefix(q, biStreamQuery) {
+			return r.Client.RemoteAddr().String() + " " + q[len(biStreamQuery):], true
+		}
+	}
+	return "", false
+}
+
+// BiStreamServer serves streams opened by BiStreamClient by handler.
+type BiStreamServer struct {
+	handler BiStreamHandler
+
+	lock    sync.Mutex
+	streams map[string]*serverBiStream
+}
+
+// NewBiStreamServer creates server of streams, it's registered at path of streams, eg. by ServeMux.Handle.
+func NewBiStreamServer(handler BiStreamHandler) *BiStreamServer {
+	return &BiStreamServer{
+		handler: handler,
+		streams: make(map[string]*serverBiStream),
+	}
+}
+
+type serverBiStream struct {
+	conn   *ClientConn
+	token  []byte
+	recv   *biStreamQueue
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock sync.Mutex
+	seq  uint32
+	done bool
+}
+
+// ServeCOAP opens stream by observe registration, passes POST requests to stream and closes stream
+// by observe deregistration.
+func (s *BiStreamServer) ServeCOAP(w ResponseWriter, r *Request) {
+	id, ok := biStreamID(r)
+	if !ok {
+		w.SetCode(BadRequest)
+		w.Write(nil)
+		return
+	}
+	switch r.Msg.Code() {
+	case GET:
+		if obs, ok := r.Msg.Option(Observe).(uint32); ok && obs == 0 {
+			s.open(w, r, id)
+			return
+		}
+		s.lock.Lock()
+		st := s.streams[id]
+		s.lock.Unlock()
+		if st != nil {
+			st.closeByClient()
+		}
+		w.SetCode(Content)
+		w.Write(nil)
+	case POST:
+		s.lock.Lock()
+		st := s.streams[id]
+		s.lock.Unlock()
+		if st == nil {
+			w.SetCode(NotFound)
+			w.Write(nil)
+			return
+		}
+		st.recv.push(r.Msg.Payload())
+		w.SetCode(Changed)
+		w.Write(nil)
+	default:
+		w.SetCode(MethodNotAllowed)
+		w.Write(nil)
+	}
+}
+
+func (s *BiStreamServer) open(w ResponseWriter, r *Request, id string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	st := &serverBiStream{
+		conn:   r.Client,
+		token:  r.Msg.Token(),
+		recv:   newBiStreamQueue(),
+		ctx:    ctx,
+		cancel: cancel,
+		seq:    1,
+	}
+	s.lock.Lock()
+	if prev, ok := s.streams[id]; ok {
+		prev.Close()
+	}
+	s.streams[id] = st
+	s.lock.Unlock()
+
+	resp := w.NewResponse(Content)
+	resp.SetOption(Observe, st.seq)
+	if err := w.WriteMsg(resp); err != nil {
+		s.finish(id, st)
+		return
+	}
+	go func() {
+		defer s.finish(id, st)
+		s.handler(ctx, st)
+	}()
+}
+
+func (s *BiStreamServer) finish(id string, st *serverBiStream) {
+	s.lock.Lock()
+	if s.streams[id] == st {
+		delete(s.streams, id)
+	}
+	s.lock.Unlock()
+	st.end(true)
+}
+
+func (st *serverBiStream) notification(code COAPCode, payload []byte) Message {
+	st.seq++
+	msg := st.conn.NewMessage(MessageParams{
+		Type:      NonConfirmable,
+		Code:      code,
+		MessageID: GenerateMessageID(),
+		Token:     st.token,
+	})
+	msg.SetOption(Observe, st.seq)
+	if len(payload) > 0 {
+		msg.SetOption(ContentFormat, AppOctets)
+		msg.SetPayload(payload)
+	}
+	return msg
+}
+
+func (st *serverBiStream) Send(payload []byte) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if st.done {
+		return ErrConnectionClosed
+	}
+	return st.conn.WriteMsgWithContext(st.ctx, st.notification(Content, payload))
+}
+
+func (st *serverBiStream) Recv() ([]byte, error) {
+	return st.recv.pop(st.ctx)
+}
+
+// Close sends end of stream to client.
+func (st *serverBiStream) Close() error {
+	st.end(true)
+	return nil
+}
+
+// closeByClient ends stream closed by client, it cancels context of handler.
+func (st *serverBiStream) closeByClient() {
+	st.end(false)
+}
+
+func (st *serverBiStream) end(notify bool) {
+	st.lock.Lock()
+	if st.done {
+		st.lock.Unlock()
+		return
+	}
+	st.done = true
+	if notify {
+		st.conn.WriteMsg(st.notification(Deleted, nil))
+	}
+	st.lock.Unlock()
+	st.recv.close(io.EOF)
+	st.cancel()
+}
+
+// BiStreamClient opens streams served by BiStreamServer.
+type BiStreamClient struct {
+	conn *ClientConn
+}
+
+// NewBiStreamClient creates client of streams over conn, eg. CoAP over TCP connection.
+func NewBiStreamClient(conn *ClientConn) *BiStreamClient {
+	return &BiStreamClient{conn: conn}
+}
+
+type clientBiStream struct {
+	conn   *ClientConn
+	path   string
+	query  string
+	token  []byte
+	recv   *biStreamQueue
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	opened     chan struct{}
+	openedOnce sync.Once
+
+	lock    sync.Mutex
+	next    uint32 // Observe of next message
+	pending map[uint32]Message
+}
+
+// OpenStream opens stream served at path, the stream is closed when ctx is done.
+func (c *BiStreamClient) OpenStream(ctx context.Context, path string) (BiStream, error) {
+	req, err := c.conn.NewGetRequest(path)
+	if err != nil {
+		return nil, err
+	}
+	sctx, cancel := context.WithCancel(ctx)
+	st := &clientBiStream{
+		conn:    c.conn,
+		path:    path,
+		query:   biStreamQuery + hex.EncodeToString(req.Token()),
+		token:   req.Token(),
+		recv:    newBiStreamQueue(),
+		ctx:     sctx,
+		cancel:  cancel,
+		opened:  make(chan struct{}),
+		next:    2,
+		pending: make(map[uint32]Message),
+	}
+	req.SetOption(Observe, 0)
+	req.AddOption(URIQuery, st.query)
+	tokens := c.conn.networkSession().TokenHandler()
+	if err := tokens.Add(req.Token(), st.handle); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := c.conn.WriteMsgWithContext(ctx, req); err != nil {
+		tokens.Remove(req.Token())
+		cancel()
+		return nil, err
+	}
+	select {
+	case <-st.opened:
+	case <-ctx.Done():
+		tokens.Remove(req.Token())
+		cancel()
+		return nil, ctx.Err()
+	}
+	go func() {
+		<-sctx.Done()
+		st.recv.close(io.EOF)
+		tokens.Remove(st.token)
+	}()
+	return st, nil
+}
+
+// handle orders notifications of stream by Observe, as they may be handled concurrently.
+func (st *clientBiStream) handle(w ResponseWriter, r *Request) {
+	seq, ok := r.Msg.Option(Observe).(uint32)
+	if !ok {
+		return
+	}
+	if seq == 1 {
+		if r.Msg.Code() == Content {
+			st.openedOnce.Do(func() { close(st.opened) })
+		}
+		return
+	}
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if seq < st.next {
+		return
+	}
+	st.pending[seq] = r.Msg
+	for {
+		msg, ok := st.pending[st.next]
+		if !ok {
+			return
+		}
+		delete(st.pending, st.next)
+		st.next++
+		if msg.Code() != Content {
+			st.recv.close(io.EOF)
+			return
+		}
+		st.recv.push(msg.Payload())
+	}
+}
+
+func (st *clientBiStream) Send(payload []byte) error {
+	req, err := st.conn.NewPostRequest(st.path, AppOctets, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.AddOption(URIQuery, st.query)
+	resp, err := st.conn.ExchangeWithContext(st.ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Code() != Changed {
+		return ErrUnexpectedReponseCode
+	}
+	return nil
+}
+
+func (st *clientBiStream) Recv() ([]byte, error) {
+	return st.recv.pop(context.Background())
+}
+
+// Close deregisters observation of stream, so the server handler's context is cancelled.
+func (st *clientBiStream) Close() error {
+	if st.ctx.Err() != nil {
+		return nil
+	}
+	defer st.cancel()
+	req, err := st.conn.NewGetRequest(st.path)
+	if err != nil {
+		return err
+	}
+	req.SetOption(Observe, 1)
+	req.AddOption(URIQuery, st.query)
+	_, err = st.conn.ExchangeWithContext(st.ctx, req)
+	return err
+}
@@ -0,0 +1,95 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBiStreamEcho(t *testing.T) {
+	handlerDone := make(chan error, 1)
+	streams := NewBiStreamServer(func(ctx context.Context, stream BiStream) {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				handlerDone <- err
+				return
+			}
+			if err := stream.Send(append([]byte("echo "), msg...)); err != nil {
+				handlerDone <- err
+				return
+			}
+		}
+	})
+	s, addr, fin, err := RunLocalServerTCPWithHandler(":0", true, BlockWiseSzx1024, streams.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("tcp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	stream, err := NewBiStreamClient(co).OpenStream(ctx, "/echo")
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, stream.Send([]byte(fmt.Sprint(i))))
+	}
+	for i := 0; i < 5; i++ {
+		msg, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("echo %v", i), string(msg))
+	}
+
+	require.NoError(t, stream.Close())
+	select {
+	case err := <-handlerDone:
+		assert.Equal(t, io.EOF, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "handler didn't return after client closed stream")
+	}
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestBiStreamServerEnds(t *testing.T) {
+	streams := NewBiStreamServer(func(ctx context.Context, stream BiStream) {
+		for i := 0; i < 3; i++ {
+			stream.Send([]byte(fmt.Sprint(i)))
+		}
+	})
+	s, addr, fin, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, streams.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("tcp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	stream, err := NewBiStreamClient(co).OpenStream(context.Background(), "/numbers")
+	require.NoError(t, err)
+	defer stream.Close()
+	var got []string
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, string(msg))
+	}
+	assert.Equal(t, []string{"0", "1", "2"}, got)
+
+	// stream is unknown to server after it ended
+	assert.Error(t, stream.Send([]byte("late")))
+}
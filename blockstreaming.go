@@ -0,0 +1,219 @@
+package coap
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// StreamingHandler handles PUT or POST request transferred by Block1, body yields the payload
+// as blocks arrive. Response written by w is sent when the transfer ends, or immediately
+// to the current block when it's written before, which aborts the transfer.
+type StreamingHandler func(w ResponseWriter, r *Request, body io.Reader)
+
+// blockReader passes payload of blocks to StreamingHandler, Read blocks until the next block
+// arrives or the transfer ends. Only one block is held at a time.
+type blockReader struct {
+	blocks chan []byte
+	doneCh chan struct{} // closed when the transfer ends
+	err    error         // set before doneCh is closed
+	rest   []byte
+}
+
+func newBlockReader() *blockReader {
+	return &blockReader{
+		blocks: make(chan []byte),
+		doneCh: make(chan struct{}),
+	}
+}
+
+func (r *blockReader) Read(p []byte) (int, error) {
+	if len(r.rest) == 0 {
+		select {
+		case b := <-r.blocks:
+			r.rest = b
+		case <-r.doneCh:
+			return 0, r.err
+		}
+	}
+	n := copy(p, r.rest)
+	r.rest = r.rest[n:]
+	return n, nil
+}
+
+// push waits until the handler takes block, it returns false when the handler responded or returned.
+func (r *blockReader) push(block []byte, respondedCh, stoppedCh <-chan struct{}) bool {
+	select {
+	case r.blocks <- block:
+		return true
+	case <-respondedCh:
+		return false
+	case <-stoppedCh:
+		return false
+	}
+}
+
+// finish ends the transfer, err is io.EOF for complete payload.
+func (r *blockReader) finish(err error) {
+	r.err = err
+	close(r.doneCh)
+}
+
+// streamingResponseWriter captures response of StreamingHandler, it's sent by handleBlockStreamingMsg
+// as response to the right block.
+type streamingResponseWriter struct {
+	*responseWriter
+
+	lock        sync.Mutex
+	resp        Message
+	respondedCh chan struct{}
+}
+
+func (w *streamingResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *streamingResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.req.Msg.Code(), w.code, w.contentFormat, p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *streamingResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *streamingResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	switch msg.Code() {
+	case GET, POST, PUT, DELETE:
+		return ErrInvalidReponseCode
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.resp != nil {
+		return ErrInvalidRequest
+	}
+	w.resp = msg
+	close(w.respondedCh)
+	return nil
+}
+
+func (w *streamingResponseWriter) response() Message {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.resp
+}
+
+// respond sends captured response as response to block request r.
+func (w *streamingResponseWriter) respond(ctx context.Context, r *Request) {
+	msg := w.response()
+	if msg == nil {
+		return
+	}
+	rw := responseWriterFromRequest(r)
+	resp := rw.NewResponse(msg.Code())
+	for _, o := range msg.AllOptions() {
+		resp.AddOption(o.ID, o.Value)
+	}
+	resp.SetPayload(msg.Payload())
+	rw.WriteMsgWithContext(ctx, resp)
+}
+
+// handleBlockStreamingMsg passes PUT and POST requests transferred by Block1 to BlockStreamingHandler.
+func (srv *Server) handleBlockStreamingMsg(w ResponseWriter, r *Request, next HandlerFunc) {
+	if srv.BlockStreamingHandler == nil || r.Msg.Token() == nil {
+		next(w, r)
+		return
+	}
+	b, ok := r.Client.networkSession().(*blockWiseSession)
+	if !ok || (r.Msg.Code() != PUT && r.Msg.Code() != POST) {
+		next(w, r)
+		return
+	}
+	block, ok := r.Msg.Option(Block1).(uint32)
+	if !ok {
+		next(w, r)
+		return
+	}
+	if _, num, more, err := UnmarshalBlockOption(block); err != nil || num != 0 || !more {
+		// whole payload in one block is handled as usual
+		next(w, r)
+		return
+	}
+
+	body := newBlockReader()
+	sw := &streamingResponseWriter{
+		responseWriter: &responseWriter{req: r},
+		respondedCh:    make(chan struct{}),
+	}
+	stoppedCh := make(chan struct{})
+	go func() {
+		defer close(stoppedCh)
+		srv.BlockStreamingHandler(sw, r, body)
+	}()
+	last, err := srv.receiveBlocks(b, r, body, sw.respondedCh, stoppedCh)
+	if err != nil {
+		body.finish(io.ErrUnexpectedEOF)
+	} else {
+		body.finish(io.EOF)
+	}
+	<-stoppedCh
+	if last != nil {
+		sw.respond(r.Ctx, last)
+	}
+}
+
+// receiveBlocks pushes blocks of r to body and acknowledges them by 2.31 Continue. It returns request
+// of the last block, with error when the transfer didn't complete.
+func (srv *Server) receiveBlocks(b *blockWiseSession, r *Request, body *blockReader, respondedCh, stoppedCh <-chan struct{}) (*Request, error) {
+	cur := r.Msg
+	offset := 0
+	for {
+		req := &Request{Client: r.Client, Msg: cur, Ctx: r.Ctx, Sequence: r.Client.Sequence()}
+		szx, num, more, err := UnmarshalBlockOption(cur.Option(Block1).(uint32))
+		if err != nil || !b.blockWiseIsValid(szx) {
+			return nil, ErrInvalidBlockWiseSzx
+		}
+		if !sameRequestTag(r.Msg, cur) {
+			return nil, ErrInvalidRequestTag
+		}
+		if calcStartOffset(num, szx) != offset {
+			b.sendErrorMsg(r.Ctx, RequestEntityIncomplete, determineCoapType(true, cur), cur.Token(), cur.MessageID(), ErrRequestEntityIncomplete)
+			return nil, ErrRequestEntityIncomplete
+		}
+		if len(cur.Payload()) > 0 && !body.push(cur.Payload(), respondedCh, stoppedCh) {
+			return req, ErrRequestEntityIncomplete
+		}
+		offset += len(cur.Payload())
+		if !more {
+			return req, nil
+		}
+		select {
+		case <-respondedCh:
+			return req, ErrRequestEntityIncomplete
+		case <-stoppedCh:
+			return req, ErrRequestEntityIncomplete
+		default:
+		}
+
+		cont := b.networkSession.NewMessage(MessageParams{
+			Code:      Continue,
+			Type:      determineCoapType(true, cur),
+			MessageID: cur.MessageID(),
+			Token:     cur.Token(),
+		})
+		block, err := MarshalBlockOption(szx, num, more)
+		if err != nil {
+			return nil, err
+		}
+		cont.SetOption(Block1, block)
+		next, err := exchangeDrivedByPeer(r.Ctx, b.networkSession, cont, Block1)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := next.Option(Block1).(uint32); !ok {
+			return nil, ErrInvalidRequest
+		}
+		cur = next
+	}
+}
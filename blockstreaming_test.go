@@ -0,0 +1,108 @@
+package coap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockStreamingHandler(t *testing.T) {
+	payload := make([]byte, 1024*1024)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	type result struct {
+		received  int
+		sum       []byte
+		maxRead   int
+		maxGrowth uint64
+	}
+	results := make(chan result, 1)
+	s := &Server{
+		Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+			w.SetCode(InternalServerError)
+			w.Write(nil)
+		}),
+		BlockStreamingHandler: func(w ResponseWriter, r *Request, body io.Reader) {
+			// the client holds the whole request meanwhile
+			var stats runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			baseline := stats.HeapAlloc
+
+			var maxRead, received int
+			var maxGrowth uint64
+			h := sha256.New()
+			buf := make([]byte, 4096)
+			for {
+				n, err := body.Read(buf)
+				if n > maxRead {
+					maxRead = n
+				}
+				h.Write(buf[:n])
+				received += n
+				if received%(128*1024) == 0 {
+					runtime.GC()
+					runtime.ReadMemStats(&stats)
+					if stats.HeapAlloc > baseline && stats.HeapAlloc-baseline > maxGrowth {
+						maxGrowth = stats.HeapAlloc - baseline
+					}
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					w.SetCode(RequestEntityIncomplete)
+					w.Write(nil)
+					return
+				}
+			}
+			results <- result{received: received, sum: h.Sum(nil), maxRead: maxRead, maxGrowth: maxGrowth}
+			w.SetCode(Changed)
+			w.Write(nil)
+		},
+	}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Post("/firmware", AppOctets, bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, Changed, resp.Code())
+
+	res := <-results
+	require.Equal(t, len(payload), res.received)
+	sum := sha256.Sum256(payload)
+	require.Equal(t, sum[:], res.sum)
+	require.True(t, res.maxRead <= 1024, "read %v bytes at once", res.maxRead)
+	require.True(t, res.maxGrowth < 256*1024, "heap grew by %v bytes", res.maxGrowth)
+}
+
+func TestBlockStreamingHandlerEarlyResponse(t *testing.T) {
+	s := &Server{
+		BlockStreamingHandler: func(w ResponseWriter, r *Request, body io.Reader) {
+			// reject the transfer after the first block
+			body.Read(make([]byte, 16))
+			w.SetCode(RequestEntityTooLarge)
+			w.Write(nil)
+		},
+	}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	_, err = co.Post("/firmware", AppOctets, bytes.NewReader(make([]byte, 16*1024)))
+	code, ok := ResponseCode(err)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, RequestEntityTooLarge, code)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"sync/atomic"
 )
@@ -232,6 +233,9 @@ func (s *blockWiseSender) processResp(ctx context.Context, b *blockWiseSession,
 	}
 
 	if resp.Code() != s.expectedCode {
+		if err := responseError(resp); err != nil {
+			return resp, err
+		}
 		return resp, ErrUnexpectedReponseCode
 	}
 
@@ -291,6 +295,12 @@ func (b *blockWiseSession) sendPayload(ctx context.Context, startedByClient bool
 	if err != nil {
 		return nil, err
 	}
+	if s.currentMore {
+		// payload doesn't fit to single block
+		i, transport := sessionInstrumentation(b)
+		i.BlockWiseTransferStarted(transport)
+		defer i.BlockWiseTransferEnded(transport)
+	}
 	for {
 		bwResp, err := s.exchange(ctx, b, req)
 		if err != nil {
@@ -581,6 +591,9 @@ func (r *blockWiseReceiver) processResp(b *blockWiseSession, req Message, resp M
 		if !b.blockWiseIsValid(szx) {
 			return nil, ErrInvalidBlockWiseSzx
 		}
+		if r.startedByClient && r.blockType == Block1 && !sameRequestTag(r.origin, resp) {
+			return nil, ErrInvalidRequestTag
+		}
 		startOffset := calcStartOffset(num, szx)
 		if r.payload.Len() < startOffset {
 			return nil, ErrRequestEntityIncomplete
@@ -658,6 +671,7 @@ func (r *blockWiseReceiver) sendError(ctx context.Context, b *blockWiseSession,
 		MessageID = r.origin.MessageID()
 		typ = Acknowledgement
 		if resp != nil {
+			MessageID = resp.MessageID()
 			token = resp.Token()
 		} else {
 			token = r.origin.Token()
@@ -681,6 +695,9 @@ func (b *blockWiseSession) receivePayload(ctx context.Context, startedByClient b
 		r.sendError(ctx, b, BadRequest, resp, err)
 		return nil, err
 	}
+	i, transport := sessionInstrumentation(b)
+	i.BlockWiseTransferStarted(transport)
+	defer i.BlockWiseTransferEnded(transport)
 
 	for {
 		bwResp, err := r.exchange(ctx, b, req)
@@ -698,7 +715,7 @@ func (b *blockWiseSession) receivePayload(ctx context.Context, startedByClient b
 			case ErrRequestEntityIncomplete:
 				errCode = RequestEntityIncomplete
 			}
-			r.sendError(ctx, b, errCode, resp, err)
+			r.sendError(ctx, b, errCode, bwResp, err)
 			return nil, err
 		}
 
@@ -778,6 +795,34 @@ func (w *blockWiseResponseWriter) SetContentFormat(contentFormat MediaType) {
 	w.responseWriter.SetContentFormat(contentFormat)
 }
 
+func (w *blockWiseResponseWriter) WriteError(err error) {
+	writeError(w, err)
+}
+
+// WriteReader sends payload read from r by blocks as the client requests them.
+func (w *blockWiseResponseWriter) WriteReader(r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return w.WriteReaderWithContext(context.Background(), r, contentFormat, szx)
+}
+
+// WriteReaderWithContext sends payload read from r by blocks with context as the client requests them.
+func (w *blockWiseResponseWriter) WriteReaderWithContext(ctx context.Context, r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	req := w.responseWriter.getReq()
+	if respBlock2, ok := req.Msg.Option(Block2).(uint32); ok {
+		peerSzx, _, _, err := UnmarshalBlockOption(respBlock2)
+		if err != nil {
+			return err
+		}
+		//BERT is supported only via TCP
+		if peerSzx == BlockWiseSzxBERT && !req.Client.networkSession().IsTCP() {
+			return ErrInvalidBlockWiseSzx
+		}
+	}
+	if b, ok := req.Client.networkSession().(*blockWiseSession); ok {
+		return b.sendReader(ctx, w, r, contentFormat, szx)
+	}
+	return writeReaderWhole(ctx, w, r, contentFormat)
+}
+
 func (w *blockWiseResponseWriter) getCode() *COAPCode {
 	return w.responseWriter.getCode()
 }
@@ -853,6 +898,19 @@ func (w *blockWiseNoticeWriter) SetContentFormat(contentFormat MediaType) {
 	w.responseWriter.SetContentFormat(contentFormat)
 }
 
+func (w *blockWiseNoticeWriter) WriteError(err error) {
+	writeError(w, err)
+}
+
+func (w *blockWiseNoticeWriter) WriteReader(r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return w.WriteReaderWithContext(context.Background(), r, contentFormat, szx)
+}
+
+// WriteReaderWithContext reads whole r, notifications are sent by blocks from memory.
+func (w *blockWiseNoticeWriter) WriteReaderWithContext(ctx context.Context, r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return writeReaderWhole(ctx, w, r, contentFormat)
+}
+
 func (w *blockWiseNoticeWriter) getCode() *COAPCode {
 	return w.responseWriter.getCode()
 }
@@ -0,0 +1,66 @@
+package coap
+
+import (
+	"sync"
+	"time"
+)
+
+// PinningStore chooses server instance for pinning session, every request of the session gets the same one.
+type PinningStore interface {
+	Instance(sessionID []byte) Handler
+}
+
+type pinnedInstance struct {
+	handler Handler
+	expires time.Time
+}
+
+// RoundRobinPinningStore assigns new sessions to instances in turn. Session is forgotten when it has
+// no request for DefaultExchangeLifetime.
+type RoundRobinPinningStore struct {
+	instances []Handler
+
+	lock     sync.Mutex
+	next     int
+	sessions map[string]*pinnedInstance
+}
+
+// NewRoundRobinPinningStore creates store over instances.
+func NewRoundRobinPinningStore(instances ...Handler) *RoundRobinPinningStore {
+	return &RoundRobinPinningStore{
+		instances: instances,
+		sessions:  make(map[string]*pinnedInstance),
+	}
+}
+
+// Instance returns instance of session, new session gets the next instance.
+func (s *RoundRobinPinningStore) Instance(sessionID []byte) Handler {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, p := range s.sessions {
+		if now.After(p.expires) {
+			delete(s.sessions, id)
+		}
+	}
+	p, ok := s.sessions[string(sessionID)]
+	if !ok {
+		p = &pinnedInstance{handler: s.instances[s.next%len(s.instances)]}
+		s.next++
+		s.sessions[string(sessionID)] = p
+	}
+	p.expires = now.Add(DefaultExchangeLifetime)
+	return p.handler
+}
+
+// BlockWisePinningHandler passes requests with PinningSessionID option to instance chosen by store,
+// so all blocks of transfer reach the same instance. Other requests are served by inner.
+func BlockWisePinningHandler(inner Handler, store PinningStore) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if id, ok := r.Msg.Option(PinningSessionID).([]byte); ok {
+			store.Instance(id).ServeCOAP(w, r)
+			return
+		}
+		inner.ServeCOAP(w, r)
+	})
+}
@@ -0,0 +1,100 @@
+package coap
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockAssembler is server instance which reassembles Block1 transfers in own memory.
+type blockAssembler struct {
+	lock      sync.Mutex
+	blocks    int
+	transfers map[string]*bytes.Buffer
+	received  []string
+}
+
+func (a *blockAssembler) ServeCOAP(w ResponseWriter, r *Request) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.blocks++
+	v, ok := r.Msg.Option(Block1).(uint32)
+	if !ok {
+		w.SetCode(BadRequest)
+		w.Write(nil)
+		return
+	}
+	_, num, more, _ := UnmarshalBlockOption(v)
+	buf := a.transfers[string(r.Msg.Token())]
+	if buf == nil {
+		if num != 0 {
+			// instance has no state of transfer
+			w.SetCode(RequestEntityIncomplete)
+			w.Write(nil)
+			return
+		}
+		buf = new(bytes.Buffer)
+		a.transfers[string(r.Msg.Token())] = buf
+	}
+	buf.Write(r.Msg.Payload())
+	code := Continue
+	if !more {
+		code = Changed
+		a.received = append(a.received, buf.String())
+		delete(a.transfers, string(r.Msg.Token()))
+	}
+	resp := w.NewResponse(code)
+	resp.SetOption(Block1, v)
+	w.WriteMsg(resp)
+}
+
+func (a *blockAssembler) stats() (int, []string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.blocks, a.received
+}
+
+func TestBlockWisePinningHandler(t *testing.T) {
+	a := &blockAssembler{transfers: make(map[string]*bytes.Buffer)}
+	b := &blockAssembler{transfers: make(map[string]*bytes.Buffer)}
+	store := NewRoundRobinPinningStore(a, b)
+	// without pinning blocks are spread over instances
+	var next int32
+	handler := BlockWisePinningHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		[]Handler{a, b}[atomic.AddInt32(&next, 1)%2].ServeCOAP(w, r)
+	}), store)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, handler.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	payload := bytes.Repeat([]byte("0123456789"), 30)
+	szx := BlockWiseSzx64
+	for i, id := range []string{"session-1", "session-2"} {
+		co, err := (&Client{BlockWiseTransferSzx: &szx, BlockWisePinning: []byte(id)}).Dial(addr)
+		require.NoError(t, err)
+		_, err = co.Post("/upload", TextPlain, bytes.NewReader(payload[:len(payload)-i]))
+		require.NoError(t, err)
+		co.Close()
+	}
+	blocks, received := a.stats()
+	assert.Equal(t, 5, blocks)
+	assert.Equal(t, []string{string(payload)}, received)
+	blocks, received = b.stats()
+	assert.Equal(t, 5, blocks)
+	assert.Equal(t, []string{string(payload[:len(payload)-1])}, received)
+
+	co, err := (&Client{BlockWiseTransferSzx: &szx}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+	_, err = co.Post("/upload", TextPlain, bytes.NewReader(payload))
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, RequestEntityIncomplete, code)
+}
@@ -0,0 +1,238 @@
+package coap
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyTransfer is Block2 transfer of upstream resource for downstream client, it holds the last upstream block.
+type proxyTransfer struct {
+	lock    sync.Mutex
+	token   []byte // token of upstream transfer, the upstream server matches next blocks by it
+	expires time.Time
+
+	num   uint
+	szx   BlockWiseSzx
+	more  bool
+	block Message // nil until the first block is received
+}
+
+// BlockWiseTranslatingProxy forwards GET requests of downstream clients to upstream and translates Block2
+// transfers when the downstream client uses smaller blocks than UpstreamSzx. Upstream blocks are requested
+// as the downstream client asks for their content, only the last one is buffered for every transfer.
+// Other requests are forwarded as whole messages.
+type BlockWiseTranslatingProxy struct {
+	upstream    *ClientConn
+	UpstreamSzx BlockWiseSzx // block size requested from upstream
+
+	lock      sync.Mutex
+	transfers map[string]*proxyTransfer
+}
+
+// NewBlockWiseTranslatingProxy creates proxy to upstream which requests blocks of upstreamSzx.
+func NewBlockWiseTranslatingProxy(upstream *ClientConn, upstreamSzx BlockWiseSzx) *BlockWiseTranslatingProxy {
+	return &BlockWiseTranslatingProxy{
+		upstream:    upstream,
+		UpstreamSzx: upstreamSzx,
+		transfers:   make(map[string]*proxyTransfer),
+	}
+}
+
+func proxyTransferKey(r *Request) string {
+	key := r.Client.RemoteAddr().String() + " " + r.Msg.PathString()
+	if q := r.Msg.Query(); len(q) > 0 {
+		key += "?" + strings.Join(q, "&")
+	}
+	return key
+}
+
+// transfer returns transfer for r, new one when r asks for the first block. Expired transfers are removed.
+func (p *BlockWiseTranslatingProxy) transfer(r *Request, num uint) (*proxyTransfer, error) {
+	key := proxyTransferKey(r)
+	now := time.Now()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for k, t := range p.transfers {
+		if now.After(t.expires) {
+			delete(p.transfers, k)
+		}
+	}
+	t, ok := p.transfers[key]
+	if !ok || num == 0 {
+		token, err := GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		t = &proxyTransfer{token: token}
+		p.transfers[key] = t
+	}
+	t.expires = now.Add(DefaultExchangeLifetime)
+	return t, nil
+}
+
+func (p *BlockWiseTranslatingProxy) finish(r *Request, t *proxyTransfer) {
+	key := proxyTransferKey(r)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.transfers[key] == t {
+		delete(p.transfers, key)
+	}
+}
+
+// fetch requests upstream block of transfer t containing offset, unless it's held already.
+func (p *BlockWiseTranslatingProxy) fetch(ctx context.Context, r *Request, t *proxyTransfer, offset int) error {
+	// upstream server starts new transfer by the first block, so it may be fetched before the wanted one
+	for i := 0; i < 2; i++ {
+		szx := p.UpstreamSzx
+		if t.block != nil {
+			// upstream may have answered by smaller blocks
+			szx = t.szx
+		}
+		num := uint(offset / szxToBytes[szx])
+		if t.block != nil && (t.num == num || !t.more) {
+			return nil
+		}
+		resp, err := p.exchangeBlock(ctx, r, t.token, szx, num)
+		if err != nil {
+			return err
+		}
+		t.num, t.szx, t.more = 0, szx, false
+		if v, ok := resp.Option(Block2).(uint32); ok {
+			if t.szx, t.num, t.more, err = UnmarshalBlockOption(v); err != nil {
+				return err
+			}
+		}
+		t.block = resp
+	}
+	return nil
+}
+
+// exchangeBlock requests single upstream block.
+func (p *BlockWiseTranslatingProxy) exchangeBlock(ctx context.Context, r *Request, token []byte, szx BlockWiseSzx, num uint) (Message, error) {
+	req := p.upstream.NewMessage(MessageParams{
+		Type:      Confirmable,
+		Code:      GET,
+		MessageID: GenerateMessageID(),
+		Token:     token,
+	})
+	copyForwardedOptions(req, r.Msg)
+	block, err := MarshalBlockOption(szx, num, false)
+	if err != nil {
+		return nil, err
+	}
+	req.SetOption(Block2, block)
+
+	session := p.upstream.networkSession()
+	if b, ok := session.(*blockWiseSession); ok {
+		// blocks are driven by downstream client, blockwise would receive whole payload
+		session = b.networkSession
+	}
+	return session.ExchangeWithContext(ctx, req)
+}
+
+// ServeCOAP forwards request of downstream client to upstream.
+func (p *BlockWiseTranslatingProxy) ServeCOAP(w ResponseWriter, r *Request) {
+	szx := r.Client.networkSession().blockWiseSzx()
+	var num uint
+	if v, ok := r.Msg.Option(Block2).(uint32); ok {
+		var err error
+		if szx, num, _, err = UnmarshalBlockOption(v); err != nil {
+			w.SetCode(BadOption)
+			w.Write(nil)
+			return
+		}
+	}
+	if r.Msg.Code() != GET || r.Msg.Option(Observe) != nil || szx >= p.UpstreamSzx || szx == BlockWiseSzxBERT {
+		p.forward(w, r)
+		return
+	}
+
+	t, err := p.transfer(r, num)
+	if err != nil {
+		w.SetCode(InternalServerError)
+		w.Write(nil)
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	offset := calcStartOffset(num, szx)
+	if err := p.fetch(r.Ctx, r, t, offset); err != nil {
+		p.finish(r, t)
+		w.SetCode(BadGateway)
+		w.Write(nil)
+		return
+	}
+	if t.block.Code() != Content {
+		p.finish(r, t)
+		relay(w, t.block)
+		return
+	}
+
+	payload := t.block.Payload()
+	start := offset - calcStartOffset(t.num, t.szx)
+	if start < 0 || start > len(payload) || (start == len(payload) && start > 0) {
+		// the upstream block doesn't contain requested one, eg. upstream resource is shorter
+		p.finish(r, t)
+		w.SetCode(BadOption)
+		w.Write(nil)
+		return
+	}
+	end := start + szxToBytes[szx]
+	if end > len(payload) {
+		end = len(payload)
+	}
+	more := end < len(payload) || t.more
+
+	resp := w.NewResponse(t.block.Code())
+	copyForwardedOptions(resp, t.block)
+	block, err := MarshalBlockOption(szx, num, more)
+	if err != nil {
+		w.SetCode(InternalServerError)
+		w.Write(nil)
+		return
+	}
+	resp.SetOption(Block2, block)
+	if size := t.block.Option(Size2); size != nil {
+		resp.SetOption(Size2, size)
+	}
+	resp.SetPayload(payload[start:end])
+	if !more {
+		p.finish(r, t)
+	}
+
+	session := r.Client.networkSession()
+	if b, ok := session.(*blockWiseSession); ok {
+		// response is a single block already
+		session = b.networkSession
+	}
+	session.WriteMsgWithContext(r.Ctx, resp)
+}
+
+// forward exchanges request as whole message with upstream and relays response.
+func (p *BlockWiseTranslatingProxy) forward(w ResponseWriter, r *Request) {
+	token, err := GenerateToken()
+	if err != nil {
+		w.SetCode(InternalServerError)
+		w.Write(nil)
+		return
+	}
+	req := p.upstream.NewMessage(MessageParams{
+		Type:      Confirmable,
+		Code:      r.Msg.Code(),
+		MessageID: GenerateMessageID(),
+		Token:     token,
+	})
+	copyForwardedOptions(req, r.Msg)
+	if len(r.Msg.Payload()) > 0 {
+		req.SetPayload(r.Msg.Payload())
+	}
+	resp, err := p.upstream.ExchangeWithContext(r.Ctx, req)
+	if err != nil {
+		w.SetCode(BadGateway)
+		w.Write(nil)
+		return
+	}
+	relay(w, resp)
+}
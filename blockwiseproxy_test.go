@@ -0,0 +1,181 @@
+package coap
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runBlockUpstream serves payload by Block2 blocks of szx, it counts received block requests.
+func runBlockUpstream(t *testing.T, payload []byte, szx BlockWiseSzx) (addr string, requests *int32, stop func()) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	requests = new(int32)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			req, err := ParseDgramMessage(b[:n])
+			if err != nil {
+				continue
+			}
+			atomic.AddInt32(requests, 1)
+			var num uint
+			if v, ok := req.Option(Block2).(uint32); ok {
+				_, num, _, _ = UnmarshalBlockOption(v)
+			}
+			start := calcStartOffset(num, szx)
+			end := start + szxToBytes[szx]
+			if end > len(payload) {
+				end = len(payload)
+			}
+			resp := NewDgramMessage(MessageParams{
+				Type:      Acknowledgement,
+				Code:      Content,
+				MessageID: req.MessageID(),
+				Token:     req.Token(),
+				Payload:   payload[start:end],
+			})
+			resp.SetOption(ContentFormat, AppOctets)
+			block, _ := MarshalBlockOption(szx, num, end < len(payload))
+			resp.SetOption(Block2, block)
+			var buf bytes.Buffer
+			resp.MarshalBinary(&buf)
+			conn.WriteToUDP(buf.Bytes(), from)
+		}
+	}()
+	return conn.LocalAddr().String(), requests, func() {
+		conn.Close()
+		<-done
+	}
+}
+
+func TestBlockWiseTranslatingProxy(t *testing.T) {
+	payload := make([]byte, 2*1024+100)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	upstreamAddr, upstreamRequests, stopUpstream := runBlockUpstream(t, payload, BlockWiseSzx1024)
+	defer stopUpstream()
+
+	upstream, err := (&Client{}).Dial(upstreamAddr)
+	require.NoError(t, err)
+	defer upstream.Close()
+	proxy := NewBlockWiseTranslatingProxy(upstream, BlockWiseSzx1024)
+
+	var downstreamRequests int32
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		atomic.AddInt32(&downstreamRequests, 1)
+		proxy.ServeCOAP(w, r)
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	szx := BlockWiseSzx64
+	co, err := (&Client{BlockWiseTransferSzx: &szx}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+	req, err := co.NewGetRequest("/big")
+	require.NoError(t, err)
+	block, err := MarshalBlockOption(BlockWiseSzx64, 0, false)
+	require.NoError(t, err)
+	req.SetOption(Block2, block)
+
+	resp, err := co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code())
+	assert.Equal(t, payload, resp.Payload())
+	// 1024/64 = 16 downstream blocks for every upstream block
+	assert.Equal(t, int32(16+16+2), atomic.LoadInt32(&downstreamRequests))
+	assert.Equal(t, int32(3), atomic.LoadInt32(upstreamRequests))
+	proxy.lock.Lock()
+	assert.Empty(t, proxy.transfers)
+	proxy.lock.Unlock()
+}
+
+func TestBlockWiseTranslatingProxyForward(t *testing.T) {
+	us, upstreamAddr, ufin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(r.Msg.Code().String() + " " + r.Msg.PathString()))
+	})
+	require.NoError(t, err)
+	defer func() {
+		us.Shutdown()
+		<-ufin
+	}()
+	upstream, err := (&Client{}).Dial(upstreamAddr)
+	require.NoError(t, err)
+	defer upstream.Close()
+
+	proxy := NewBlockWiseTranslatingProxy(upstream, BlockWiseSzx1024)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx1024, proxy.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Post("/a/b", TextPlain, bytes.NewReader([]byte("x")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("POST a/b"), resp.Payload())
+
+	// block size of downstream isn't smaller, so response is whole
+	resp, err = co.Get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("GET a"), resp.Payload())
+}
+
+func TestBlockWiseTranslatingProxyServerUpstream(t *testing.T) {
+	payload := make([]byte, 3000)
+	for i := range payload {
+		payload[i] = byte(i % 253)
+	}
+	us, upstreamAddr, ufin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(AppOctets)
+		w.Write(payload)
+	})
+	require.NoError(t, err)
+	defer func() {
+		us.Shutdown()
+		<-ufin
+	}()
+	upstream, err := (&Client{}).Dial(upstreamAddr)
+	require.NoError(t, err)
+	defer upstream.Close()
+
+	proxy := NewBlockWiseTranslatingProxy(upstream, BlockWiseSzx1024)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx1024, proxy.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	szx := BlockWiseSzx256
+	co, err := (&Client{BlockWiseTransferSzx: &szx}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+	req, err := co.NewGetRequest("/big")
+	require.NoError(t, err)
+	block, err := MarshalBlockOption(szx, 0, false)
+	require.NoError(t, err)
+	req.SetOption(Block2, block)
+
+	resp, err := co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, payload, resp.Payload())
+}
@@ -0,0 +1,103 @@
+package coap
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+// readBlock reads up to size bytes from r, more reports whether r has data after the block.
+func readBlock(r *bufio.Reader, size int) (block []byte, more bool, err error) {
+	block = make([]byte, size)
+	n, err := io.ReadFull(r, block)
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		return block[:n], false, nil
+	default:
+		return nil, false, err
+	}
+	if _, err := r.Peek(1); err != nil {
+		if err == io.EOF {
+			return block, false, nil
+		}
+		return nil, false, err
+	}
+	return block, true, nil
+}
+
+// writeReaderWhole reads whole r and writes it as one response.
+func writeReaderWhole(ctx context.Context, w ResponseWriter, r io.Reader, contentFormat MediaType) error {
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	w.SetContentFormat(contentFormat)
+	_, err = w.WriteWithContext(ctx, p)
+	return err
+}
+
+// sendReader sends r by Block2 blocks of szx as the client requests them. Only the current block
+// is held in memory, skipped blocks are discarded, blocks which were read already can't be sent again.
+func (b *blockWiseSession) sendReader(ctx context.Context, w ResponseWriter, r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	req := w.getReq().Msg
+	var num uint
+	if v, ok := req.Option(Block2).(uint32); ok {
+		var err error
+		if szx, num, _, err = UnmarshalBlockOption(v); err != nil {
+			return err
+		}
+	}
+	messageID, typ := req.MessageID(), determineCoapType(true, req)
+	br := bufio.NewReader(r)
+	var offset int
+	for {
+		size, blockSzx := b.blockWiseMaxPayloadSize(szx)
+		start := calcStartOffset(num, blockSzx)
+		if start < offset {
+			b.sendErrorMsg(ctx, BadOption, typ, req.Token(), messageID, ErrBlockNotAvailable)
+			return ErrBlockNotAvailable
+		}
+		if start > offset {
+			n, err := io.CopyN(ioutil.Discard, br, int64(start-offset))
+			offset += int(n)
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+		block, more, err := readBlock(br, size)
+		if err != nil {
+			return err
+		}
+		offset += len(block)
+
+		_, resp := prepareReponse(w, req.Code(), w.getCode(), &contentFormat, block)
+		resp.SetMessageID(messageID)
+		resp.SetType(typ)
+		if num == 0 && !more && req.Option(Block2) == nil {
+			// whole payload fits into one block
+			return b.networkSession.WriteMsgWithContext(ctx, resp)
+		}
+		opt, err := MarshalBlockOption(blockSzx, num, more)
+		if err != nil {
+			return err
+		}
+		resp.SetOption(Block2, opt)
+		next, err := exchangeDrivedByPeer(ctx, b.networkSession, resp, Block2)
+		if err != nil || !more {
+			return err
+		}
+		v, ok := next.Option(Block2).(uint32)
+		if !ok {
+			return ErrInvalidOptionBlock2
+		}
+		if szx, num, _, err = UnmarshalBlockOption(v); err != nil {
+			return err
+		}
+		if !b.blockWiseIsValid(szx) {
+			return ErrInvalidBlockWiseSzx
+		}
+		messageID, typ = next.MessageID(), determineCoapType(true, next)
+	}
+}
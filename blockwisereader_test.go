@@ -0,0 +1,101 @@
+package coap
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader counts bytes read from r.
+type countingReader struct {
+	r    io.Reader
+	read int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func TestResponseWriterWriteReader(t *testing.T) {
+	payload := make([]byte, 1024*1024)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	reader := &countingReader{r: bytes.NewReader(payload)}
+	done := make(chan error, 1)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		done <- w.WriteReader(reader, AppOctets, BlockWiseSzx1024)
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	// blocks are requested by test
+	blockWise := false
+	co, err := (&Client{BlockWiseTransfer: &blockWise}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	req, err := co.NewGetRequest("/big")
+	require.NoError(t, err)
+	var received []byte
+	for num := uint(0); ; num++ {
+		block, err := MarshalBlockOption(BlockWiseSzx1024, num, false)
+		require.NoError(t, err)
+		req.SetOption(Block2, block)
+		req.SetMessageID(GenerateMessageID())
+		resp, err := co.Exchange(req)
+		require.NoError(t, err)
+		require.Equal(t, Content, resp.Code())
+		assert.Equal(t, AppOctets, resp.Option(ContentFormat))
+		szx, respNum, more, err := UnmarshalBlockOption(resp.Option(Block2).(uint32))
+		require.NoError(t, err)
+		require.Equal(t, BlockWiseSzx1024, szx)
+		require.Equal(t, num, respNum)
+		received = append(received, resp.Payload()...)
+		// reader is ahead at most by the read buffer
+		read := atomic.LoadInt64(&reader.read)
+		require.True(t, read <= int64(len(received)+4096), "read %v received %v", read, len(received))
+		if !more {
+			require.Equal(t, uint(1023), num)
+			break
+		}
+	}
+	assert.Equal(t, payload, received)
+	require.NoError(t, <-done)
+}
+
+func TestResponseWriterWriteReaderBlockWiseClient(t *testing.T) {
+	payload := make([]byte, 5000)
+	for i := range payload {
+		payload[i] = byte(i % 253)
+	}
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.WriteReader(bytes.NewReader(payload[:len(r.Msg.PathString())*1000]), AppOctets, BlockWiseSzx256)
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Get("/abcde")
+	require.NoError(t, err)
+	assert.Equal(t, payload, resp.Payload())
+
+	// small payload is sent without blockwise
+	resp, err = co.Get("/")
+	require.NoError(t, err)
+	assert.Empty(t, resp.Payload())
+	assert.Nil(t, resp.Option(Block2))
+}
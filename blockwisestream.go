@@ -0,0 +1,263 @@
+package coap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+)
+
+// withoutBlockWise returns session below blockwise session, so blocks are exchanged as they are.
+func withoutBlockWise(session networkSession) networkSession {
+	if b, ok := session.(*blockWiseSession); ok {
+		return b.networkSession
+	}
+	return session
+}
+
+// blockWiseStreamSzx validates szx of stream of session.
+func blockWiseStreamSzx(session networkSession, szx BlockWiseSzx) error {
+	if szx >= BlockWiseSzxCount || !session.blockWiseIsValid(szx) {
+		return ErrInvalidBlockWiseSzx
+	}
+	return nil
+}
+
+// BlockWiseBodyReader reads payload of response transferred by Block2 (RFC 7959). The next block
+// is requested when the current one is read, so the payload is never held in memory whole.
+type BlockWiseBodyReader struct {
+	ctx     context.Context
+	session networkSession
+	req     Message
+	resp    Message
+
+	szx      BlockWiseSzx
+	block    []byte
+	blockLen int
+	offset   int // offset of the current block
+	more     bool
+	closed   bool
+}
+
+// GetReader retrieves the resource identified by the request path by blocks of szx, the payload
+// is read from the returned reader.
+func (co *ClientConn) GetReader(path string, szx BlockWiseSzx) (*BlockWiseBodyReader, error) {
+	return co.GetReaderWithContext(context.Background(), path, szx)
+}
+
+// GetReaderWithContext retrieves with context the resource identified by the request path by blocks
+// of szx. Blocks are requested with ctx.
+func (co *ClientConn) GetReaderWithContext(ctx context.Context, path string, szx BlockWiseSzx) (*BlockWiseBodyReader, error) {
+	req, err := co.NewGetRequest(path)
+	if err != nil {
+		return nil, err
+	}
+	return co.ExchangeReaderWithContext(ctx, req, szx)
+}
+
+// ExchangeReaderWithContext sends GET or FETCH request req and returns reader of payload of response
+// transferred by blocks of szx. Server may choose smaller blocks. Response with error code is
+// returned as CoAPError.
+func (co *ClientConn) ExchangeReaderWithContext(ctx context.Context, req Message, szx BlockWiseSzx) (*BlockWiseBodyReader, error) {
+	if co.multicast {
+		return nil, ErrNotSupported
+	}
+	if req.Code() != GET && req.Code() != FETCH {
+		return nil, ErrInvalidRequest
+	}
+	session := withoutBlockWise(co.networkSession())
+	if err := blockWiseStreamSzx(session, szx); err != nil {
+		return nil, err
+	}
+	r := &BlockWiseBodyReader{ctx: ctx, session: session, req: req, szx: szx}
+	if err := r.fetch(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// fetch requests block at offset.
+func (r *BlockWiseBodyReader) fetch() error {
+	num := uint(r.offset / szxToBytes[r.szx])
+	opt, err := MarshalBlockOption(r.szx, num, false)
+	if err != nil {
+		return err
+	}
+	r.req.SetOption(Block2, opt)
+	r.req.SetMessageID(GenerateMessageID())
+	resp, err := r.session.ExchangeWithContext(r.ctx, r.req)
+	if err != nil {
+		return err
+	}
+	if err := responseError(resp); err != nil {
+		return err
+	}
+	v, ok := resp.Option(Block2).(uint32)
+	if !ok {
+		if r.resp != nil {
+			return ErrInvalidOptionBlock2
+		}
+		// whole payload fits into one block
+		r.resp, r.block, r.blockLen = resp, resp.Payload(), len(resp.Payload())
+		return nil
+	}
+	szx, respNum, more, err := UnmarshalBlockOption(v)
+	if err != nil {
+		return err
+	}
+	if szx > r.szx || calcStartOffset(respNum, szx) != r.offset {
+		return ErrInvalidOptionBlock2
+	}
+	if r.resp != nil && !bytes.Equal(etagOf(r.resp), etagOf(resp)) {
+		return ErrBlockWiseRepresentationChanged
+	}
+	if r.resp == nil {
+		r.resp = resp
+	}
+	r.szx, r.block, r.blockLen, r.more = szx, resp.Payload(), len(resp.Payload()), more
+	if more && (r.blockLen == 0 || r.blockLen%szxToBytes[szx] != 0) {
+		return ErrBlockInvalidSize
+	}
+	return nil
+}
+
+func etagOf(msg Message) []byte {
+	v, _ := msg.Option(ETag).([]byte)
+	return v
+}
+
+// Response returns response of the first block, its payload is read by Read.
+func (r *BlockWiseBodyReader) Response() Message {
+	return r.resp
+}
+
+// Read reads payload, it requests next block when the current one was read.
+func (r *BlockWiseBodyReader) Read(p []byte) (int, error) {
+	for len(r.block) == 0 {
+		if !r.more || r.closed {
+			return 0, io.EOF
+		}
+		r.offset += r.blockLen
+		if err := r.fetch(); err != nil {
+			r.more = false
+			return 0, err
+		}
+	}
+	n := copy(p, r.block)
+	r.block = r.block[n:]
+	return n, nil
+}
+
+// Close stops requesting of blocks.
+func (r *BlockWiseBodyReader) Close() error {
+	r.closed = true
+	r.block = nil
+	return nil
+}
+
+// PostReader updates the resource identified by the request path by payload read from body and
+// sent by Block1 blocks of szx.
+func (co *ClientConn) PostReader(path string, contentFormat MediaType, body io.Reader, szx BlockWiseSzx) (Message, error) {
+	return co.PostReaderWithContext(context.Background(), path, contentFormat, body, szx)
+}
+
+// PostReaderWithContext updates with context the resource identified by the request path by payload
+// read from body and sent by Block1 blocks of szx.
+func (co *ClientConn) PostReaderWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader, szx BlockWiseSzx) (Message, error) {
+	req, err := co.NewPostRequest(path, contentFormat, bytes.NewReader(nil))
+	if err != nil {
+		return nil, err
+	}
+	return co.SendReaderWithContext(ctx, req, body, szx)
+}
+
+// PutReader creates the resource identified by the request path by payload read from body and
+// sent by Block1 blocks of szx.
+func (co *ClientConn) PutReader(path string, contentFormat MediaType, body io.Reader, szx BlockWiseSzx) (Message, error) {
+	return co.PutReaderWithContext(context.Background(), path, contentFormat, body, szx)
+}
+
+// PutReaderWithContext creates with context the resource identified by the request path by payload
+// read from body and sent by Block1 blocks of szx.
+func (co *ClientConn) PutReaderWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader, szx BlockWiseSzx) (Message, error) {
+	req, err := co.NewPutRequest(path, contentFormat, bytes.NewReader(nil))
+	if err != nil {
+		return nil, err
+	}
+	return co.SendReaderWithContext(ctx, req, body, szx)
+}
+
+// SendReaderWithContext sends request req with payload read from body by Block1 blocks of szx
+// (RFC 7959 section 2.5). Only the current block is held in memory. When server answers 2.31
+// Continue with smaller block size, the rest is sent by blocks of that size. It returns the
+// final response, the response with error code is returned also as CoAPError.
+func (co *ClientConn) SendReaderWithContext(ctx context.Context, req Message, body io.Reader, szx BlockWiseSzx) (Message, error) {
+	if co.multicast {
+		return nil, ErrNotSupported
+	}
+	session := withoutBlockWise(co.networkSession())
+	if err := blockWiseStreamSzx(session, szx); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(body)
+	var offset int
+	for {
+		block, more, err := readBlock(br, szxToBytes[szx])
+		if err != nil {
+			return nil, err
+		}
+		num := uint(offset / szxToBytes[szx])
+		opt, err := MarshalBlockOption(szx, num, more)
+		if err != nil {
+			return nil, err
+		}
+		msg := session.NewMessage(MessageParams{
+			Type:      req.Type(),
+			Code:      req.Code(),
+			MessageID: GenerateMessageID(),
+			Token:     req.Token(),
+			Payload:   block,
+		})
+		for _, o := range req.AllOptions() {
+			msg.AddOption(o.ID, o.Value)
+		}
+		msg.SetOption(Block1, opt)
+		resp, err := session.ExchangeWithContext(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		if !more || resp.Code() != Continue {
+			// the last block or server ended the transfer
+			return resp, responseError(resp)
+		}
+		offset += len(block)
+		v, ok := resp.Option(Block1).(uint32)
+		if !ok {
+			continue
+		}
+		respSzx, respNum, _, err := UnmarshalBlockOption(v)
+		if err != nil {
+			return nil, err
+		}
+		if respNum != num {
+			return nil, ErrInvalidOptionBlock1
+		}
+		if respSzx < szx && respSzx != BlockWiseSzxBERT {
+			// server negotiates smaller blocks
+			szx = respSzx
+		}
+	}
+}
+
+// WriteStream sends payload produced by write as response of w, the payload is sent by Block2 blocks
+// of szx as the client requests them (see ResponseWriter.WriteReader). write runs in own goroutine
+// and its writes block until the client requests the block, writes fail when the transfer ends.
+func WriteStream(ctx context.Context, w ResponseWriter, contentFormat MediaType, szx BlockWiseSzx, write func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw))
+	}()
+	err := w.WriteReaderWithContext(ctx, pr, contentFormat, szx)
+	pr.CloseWithError(io.ErrClosedPipe)
+	return err
+}
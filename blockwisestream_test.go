@@ -0,0 +1,112 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStreamPayload(n int) []byte {
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	return payload
+}
+
+func TestClientConnGetReader(t *testing.T) {
+	payload := testStreamPayload(100*1024 + 7)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx256, func(w ResponseWriter, r *Request) {
+		if r.Msg.PathString() != "big" {
+			w.SetCode(NotFound)
+			w.Write(nil)
+			return
+		}
+		WriteStream(r.Ctx, w, AppOctets, BlockWiseSzx1024, func(w io.Writer) error {
+			// body is produced incrementally
+			for p := payload; len(p) > 0; p = p[100:] {
+				if len(p) < 100 {
+					_, err := w.Write(p)
+					return err
+				}
+				if _, err := w.Write(p[:100]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	// server negotiates blocks of 256 bytes
+	r, err := co.GetReader("/big", BlockWiseSzx1024)
+	require.NoError(t, err)
+	assert.Equal(t, Content, r.Response().Code())
+	assert.Equal(t, AppOctets, r.Response().Option(ContentFormat))
+	body, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, payload, body)
+	require.NoError(t, r.Close())
+
+	r, err = co.GetReader("/big", BlockWiseSzx64)
+	require.NoError(t, err)
+	first := make([]byte, 10)
+	_, err = io.ReadFull(r, first)
+	require.NoError(t, err)
+	assert.Equal(t, payload[:10], first)
+	require.NoError(t, r.Close())
+	n, err := r.Read(first)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = co.GetReader("/missing", BlockWiseSzx1024)
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, NotFound, code)
+
+	_, err = co.GetReader("/big", BlockWiseSzxBERT)
+	assert.Equal(t, ErrInvalidBlockWiseSzx, err)
+}
+
+func TestClientConnSendReader(t *testing.T) {
+	payload := testStreamPayload(20*1024 + 3)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx256, func(w ResponseWriter, r *Request) {
+		if !bytes.Equal(payload, r.Msg.Payload()) {
+			w.SetCode(BadRequest)
+			w.Write(nil)
+			return
+		}
+		w.SetCode(Changed)
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("stored"))
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.PutReader("/fw", AppOctets, bytes.NewReader(payload), BlockWiseSzx1024)
+	require.NoError(t, err)
+	assert.Equal(t, Changed, resp.Code())
+	assert.Equal(t, []byte("stored"), resp.Payload())
+
+	resp, err = co.PostReaderWithContext(context.Background(), "/fw", AppOctets, bytes.NewReader(payload[1:]), BlockWiseSzx128)
+	require.Error(t, err)
+	assert.Equal(t, BadRequest, resp.Code())
+}
@@ -0,0 +1,181 @@
+package coap
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+)
+
+// hopByHopOptions are options of downstream or upstream exchange which are not forwarded by bridge.
+var hopByHopOptions = map[OptionID]bool{
+	URIHost: true,
+	URIPort: true,
+	Observe: true,
+	Block1:  true,
+	Block2:  true,
+	Size1:   true,
+	Size2:   true,
+}
+
+func copyForwardedOptions(dst, src Message, skip ...OptionID) {
+	for _, o := range src.AllOptions() {
+		if hopByHopOptions[o.ID] {
+			continue
+		}
+		skipped := false
+		for _, id := range skip {
+			if o.ID == id {
+				skipped = true
+			}
+		}
+		if !skipped {
+			dst.AddOption(o.ID, o.Value)
+		}
+	}
+}
+
+// CoapBridge serves DTLS clients and forwards their requests to upstream connection, eg. CoAP over TCP
+// cloud service, and relays responses back. Observation of downstream client is mapped to observation
+// of upstream and notifications are relayed to the client which registered it.
+type CoapBridge struct {
+	upstream *ClientConn
+	srv      *Server
+
+	lock         sync.Mutex
+	observations map[string]*Observation
+}
+
+// NewCoapBridge creates bridge which serves downstream DTLS listener by upstream connection.
+func NewCoapBridge(downstream *coapNet.DTLSListener, upstream *ClientConn) *CoapBridge {
+	b := &CoapBridge{
+		upstream:     upstream,
+		observations: make(map[string]*Observation),
+	}
+	b.srv = &Server{
+		Listener:             downstream,
+		Handler:              b,
+		NotifySessionEndFunc: b.sessionEnded,
+	}
+	return b
+}
+
+// Serve serves downstream clients until Shutdown is called.
+func (b *CoapBridge) Serve() error {
+	return b.srv.ActivateAndServe()
+}
+
+// Shutdown stops serving of downstream clients and cancels upstream observations.
+func (b *CoapBridge) Shutdown() error {
+	b.lock.Lock()
+	obs := b.observations
+	b.observations = make(map[string]*Observation)
+	b.lock.Unlock()
+	for _, o := range obs {
+		o.Cancel()
+	}
+	return b.srv.Shutdown()
+}
+
+func bridgeObservationKey(addr net.Addr, token []byte) string {
+	return addr.String() + "/" + hex.EncodeToString(token)
+}
+
+func (b *CoapBridge) sessionEnded(c *ClientConn, err error) {
+	prefix := c.RemoteAddr().String() + "/"
+	b.lock.Lock()
+	var obs []*Observation
+	for k, o := range b.observations {
+		if strings.HasPrefix(k, prefix) {
+			obs = append(obs, o)
+			delete(b.observations, k)
+		}
+	}
+	b.lock.Unlock()
+	for _, o := range obs {
+		o.Cancel()
+	}
+}
+
+func (b *CoapBridge) cancelObservation(key string) {
+	b.lock.Lock()
+	o, ok := b.observations[key]
+	delete(b.observations, key)
+	b.lock.Unlock()
+	if ok {
+		o.Cancel()
+	}
+}
+
+// relay writes upstream response to downstream client.
+func relay(w ResponseWriter, upstreamResp Message) error {
+	resp := w.NewResponse(upstreamResp.Code())
+	copyForwardedOptions(resp, upstreamResp)
+	if obs := upstreamResp.Option(Observe); obs != nil {
+		resp.SetOption(Observe, obs)
+	}
+	if len(upstreamResp.Payload()) > 0 {
+		resp.SetPayload(upstreamResp.Payload())
+	}
+	return w.WriteMsg(resp)
+}
+
+func (b *CoapBridge) observe(w ResponseWriter, r *Request) {
+	key := bridgeObservationKey(r.Client.RemoteAddr(), r.Msg.Token())
+	b.cancelObservation(key)
+	o, err := b.upstream.ObserveWithContext(context.Background(), r.Msg.PathString(), func(req *Request) {
+		if err := relay(w, req.Msg); err != nil {
+			b.cancelObservation(key)
+		}
+	}, func(m Message) {
+		copyForwardedOptions(m, r.Msg, URIPath)
+	})
+	if err != nil {
+		w.SetCode(BadGateway)
+		w.Write(nil)
+		return
+	}
+	b.lock.Lock()
+	b.observations[key] = o
+	b.lock.Unlock()
+}
+
+// ServeCOAP forwards request of downstream client to upstream.
+func (b *CoapBridge) ServeCOAP(w ResponseWriter, r *Request) {
+	if r.Msg.Code() == GET {
+		if obs, ok := r.Msg.Option(Observe).(uint32); ok {
+			if obs == 0 {
+				b.observe(w, r)
+				return
+			}
+			b.cancelObservation(bridgeObservationKey(r.Client.RemoteAddr(), r.Msg.Token()))
+		}
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		w.SetCode(InternalServerError)
+		w.Write(nil)
+		return
+	}
+	req := b.upstream.NewMessage(MessageParams{
+		Type:      Confirmable,
+		Code:      r.Msg.Code(),
+		MessageID: GenerateMessageID(),
+		Token:     token,
+	})
+	copyForwardedOptions(req, r.Msg)
+	if len(r.Msg.Payload()) > 0 {
+		req.SetPayload(r.Msg.Payload())
+	}
+	resp, err := b.upstream.ExchangeWithContext(r.Ctx, req)
+	if err != nil {
+		w.SetCode(BadGateway)
+		w.Write(nil)
+		return
+	}
+	relay(w, resp)
+}
@@ -0,0 +1,106 @@
+package coap
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+	"github.com/pion/dtls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBridgeDTLSConfig() *dtls.Config {
+	return &dtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("go-coap bridge"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+}
+
+func runBridge(t *testing.T, upstreamHandler HandlerFunc) (*ClientConn, func()) {
+	s, upstreamAddr, upstreamFin, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, upstreamHandler)
+	require.NoError(t, err)
+	upstream, err := Dial("tcp", upstreamAddr)
+	require.NoError(t, err)
+
+	l, err := coapNet.NewDTLSListener("udp", "127.0.0.1:0", testBridgeDTLSConfig(), time.Millisecond*100)
+	require.NoError(t, err)
+	b := NewCoapBridge(l, upstream)
+	fin := make(chan error, 1)
+	go func() {
+		fin <- b.Serve()
+	}()
+
+	c := Client{Net: "udp-dtls", DTLSConfig: testBridgeDTLSConfig()}
+	co, err := c.Dial(l.Addr().String())
+	require.NoError(t, err)
+	return co, func() {
+		co.Close()
+		b.Shutdown()
+		<-fin
+		l.Close()
+		upstream.Close()
+		s.Shutdown()
+		<-upstreamFin
+	}
+}
+
+func TestCoapBridgeForwardsRequest(t *testing.T) {
+	co, fin := runBridge(t, func(w ResponseWriter, r *Request) {
+		assert.Equal(t, "q=1", r.Msg.QueryString())
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("upstream " + r.Msg.PathString()))
+	})
+	defer fin()
+
+	req, err := co.NewGetRequest("/a/b")
+	require.NoError(t, err)
+	req.SetQueryString("q=1")
+	resp, err := co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code())
+	assert.Equal(t, TextPlain, resp.Option(ContentFormat))
+	assert.Equal(t, "upstream a/b", string(resp.Payload()))
+}
+
+func TestCoapBridgeObserve(t *testing.T) {
+	co, fin := runBridge(t, func(w ResponseWriter, r *Request) {
+		if r.Msg.Option(Observe) == nil {
+			w.SetCode(BadRequest)
+			w.Write(nil)
+			return
+		}
+		go func() {
+			for i := 1; i <= 3; i++ {
+				resp := w.NewResponse(Content)
+				resp.SetOption(Observe, uint32(i+1))
+				resp.SetOption(ContentFormat, TextPlain)
+				resp.SetPayload([]byte(fmt.Sprintf("notification %v", i)))
+				if err := w.WriteMsg(resp); err != nil {
+					return
+				}
+				time.Sleep(time.Millisecond * 50)
+			}
+		}()
+	})
+	defer fin()
+
+	notifications := make(chan string, 10)
+	o, err := co.Observe("/obs", func(req *Request) {
+		notifications <- string(req.Msg.Payload())
+	})
+	require.NoError(t, err)
+	defer o.Cancel()
+	for i := 1; i <= 3; i++ {
+		select {
+		case n := <-notifications:
+			assert.Equal(t, fmt.Sprintf("notification %v", i), n)
+		case <-time.After(time.Second * 3):
+			t.Fatalf("notification %v was not received", i)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package coap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+)
+
+// isNoCacheKey reports whether the option is not part of cache key (RFC 7252 5.4.2).
+func isNoCacheKey(id OptionID) bool {
+	return id&0x1e == 0x1c
+}
+
+func isURIOption(id OptionID) bool {
+	switch id {
+	case URIHost, URIPort, URIPath, URIQuery:
+		return true
+	}
+	return false
+}
+
+// CacheKey returns key of proxy cache for request msg (RFC 7252 5.6 and 5.7.1). The key covers
+// the method and all options which are not NoCacheKey, eg. the URI, Proxy-Uri and Block2.
+// Options are ordered by number, values of repeated URI options keep their order and values
+// of other repeated options are sorted.
+func CacheKey(msg Message) ([]byte, error) {
+	type keyOption struct {
+		id    OptionID
+		value []byte
+	}
+	var opts []keyOption
+	for _, o := range msg.AllOptions() {
+		if isNoCacheKey(o.ID) {
+			continue
+		}
+		var value bytes.Buffer
+		if err := o.writeData(&value); err != nil {
+			return nil, err
+		}
+		opts = append(opts, keyOption{id: o.ID, value: value.Bytes()})
+	}
+	sort.SliceStable(opts, func(i, j int) bool {
+		if opts[i].id != opts[j].id {
+			return opts[i].id < opts[j].id
+		}
+		if isURIOption(opts[i].id) {
+			return false
+		}
+		return bytes.Compare(opts[i].value, opts[j].value) < 0
+	})
+
+	h := sha256.New()
+	h.Write([]byte{byte(msg.Code())})
+	var hdr [6]byte
+	for _, o := range opts {
+		binary.BigEndian.PutUint16(hdr[:2], uint16(o.id))
+		binary.BigEndian.PutUint32(hdr[2:], uint32(len(o.value)))
+		h.Write(hdr[:])
+		h.Write(o.value)
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,80 @@
+package coap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newCacheKeyRequest(query ...string) Message {
+	m := NewDgramMessage(MessageParams{
+		Type:      Confirmable,
+		Code:      GET,
+		MessageID: 1,
+		Token:     []byte{1},
+	})
+	m.SetPathString("/a/b")
+	m.SetOption(URIHost, "example.com")
+	for _, q := range query {
+		m.AddOption(URIQuery, q)
+	}
+	m.SetOption(Accept, TextPlain)
+	return m
+}
+
+func cacheKey(t *testing.T, m Message) []byte {
+	k, err := CacheKey(m)
+	require.NoError(t, err)
+	return k
+}
+
+func TestCacheKeyIgnoresNoCacheKeyOption(t *testing.T) {
+	a := newCacheKeyRequest("q=1")
+	b := newCacheKeyRequest("q=1")
+	b.SetOption(Size1, 10)
+	b.SetMessageID(2)
+	b.SetToken([]byte{2})
+	require.Equal(t, cacheKey(t, a), cacheKey(t, b))
+}
+
+func TestCacheKeyURIQuery(t *testing.T) {
+	require.NotEqual(t, cacheKey(t, newCacheKeyRequest("q=1")), cacheKey(t, newCacheKeyRequest("q=2")))
+	require.NotEqual(t, cacheKey(t, newCacheKeyRequest("q=1")), cacheKey(t, newCacheKeyRequest("q=1", "r=1")))
+}
+
+func TestCacheKeyOptions(t *testing.T) {
+	a := newCacheKeyRequest()
+	b := newCacheKeyRequest()
+	b.SetOption(Accept, AppJSON)
+	require.NotEqual(t, cacheKey(t, a), cacheKey(t, b))
+
+	// path segments are ordered
+	c := newCacheKeyRequest()
+	c.SetPathString("/b/a")
+	require.NotEqual(t, cacheKey(t, a), cacheKey(t, c))
+
+	// values of other repeated options are not
+	d := newCacheKeyRequest()
+	d.AddOption(ETag, []byte{1})
+	d.AddOption(ETag, []byte{2})
+	e := newCacheKeyRequest()
+	e.AddOption(ETag, []byte{2})
+	e.AddOption(ETag, []byte{1})
+	require.Equal(t, cacheKey(t, d), cacheKey(t, e))
+}
+
+func TestCacheKeyProxyURI(t *testing.T) {
+	a := newCacheKeyRequest()
+	a.SetOption(ProxyURI, "coap://a.example/x")
+	b := newCacheKeyRequest()
+	b.SetOption(ProxyURI, "coap://b.example/y")
+	require.NotEqual(t, cacheKey(t, a), cacheKey(t, b))
+}
+
+func TestCacheKeyBlock2(t *testing.T) {
+	a := newCacheKeyRequest()
+	a.SetOption(Block2, uint32(0<<4|BlockWiseSzx1024))
+	b := newCacheKeyRequest()
+	b.SetOption(Block2, uint32(3<<4|BlockWiseSzx1024))
+	require.NotEqual(t, cacheKey(t, a), cacheKey(t, b))
+}
@@ -0,0 +1,151 @@
+package coap
+
+import (
+	"context"
+	"sync"
+)
+
+// CancelCause tells why context of request was cancelled.
+type CancelCause int
+
+const (
+	// NotCancelled context of request is not cancelled.
+	NotCancelled CancelCause = iota
+	// CancelledByClient client reset the request or closed the connection.
+	CancelledByClient
+	// TimedOut handler timeout or deadline of context is over.
+	TimedOut
+	// ServerShuttingDown server was shut down.
+	ServerShuttingDown
+)
+
+var cancelCauseNames = map[CancelCause]string{
+	NotCancelled:       "not cancelled",
+	CancelledByClient:  "cancelled by client",
+	TimedOut:           "timed out",
+	ServerShuttingDown: "server shutting down",
+}
+
+func (c CancelCause) String() string {
+	return cancelCauseNames[c]
+}
+
+type cancelCauseKey struct{}
+
+// requestCancel cancels context of request served by server and remembers why.
+type requestCancel struct {
+	srv    *Server
+	cancel context.CancelFunc
+
+	lock  sync.Mutex
+	cause CancelCause
+}
+
+// setCause sets cause unless context was cancelled already.
+func (c *requestCancel) setCause(cause CancelCause) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cause == NotCancelled {
+		c.cause = cause
+	}
+}
+
+func (c *requestCancel) cancelWithCause(cause CancelCause) {
+	c.setCause(cause)
+	c.cancel()
+}
+
+func (c *requestCancel) getCause() CancelCause {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.cause
+}
+
+// HandlerCancelCause returns why ctx of request passed to handler was cancelled, eg. so handler
+// logs timeouts but silently drops requests cancelled by client.
+func HandlerCancelCause(ctx context.Context) CancelCause {
+	if ctx == nil || ctx.Err() == nil {
+		return NotCancelled
+	}
+	if c := requestCancelOf(ctx); c != nil {
+		if cause := c.getCause(); cause != NotCancelled {
+			return cause
+		}
+		if c.srv.shutDown() {
+			return ServerShuttingDown
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return TimedOut
+	}
+	return CancelledByClient
+}
+
+func requestCancelOf(ctx context.Context) *requestCancel {
+	c, _ := ctx.Value(cancelCauseKey{}).(*requestCancel)
+	return c
+}
+
+type requestCancelKey struct {
+	session   networkSession
+	messageID uint16
+}
+
+// requestCancels tracks datagram requests in flight, so Reset of client cancels them.
+type requestCancels struct {
+	lock     sync.Mutex
+	requests map[requestCancelKey]*requestCancel
+}
+
+func (srv *Server) shutDown() bool {
+	srv.doneLock.Lock()
+	defer srv.doneLock.Unlock()
+	return srv.doneChan == nil
+}
+
+// withRequestCancel replaces context of r by cancellable one, the returned func releases it.
+func (srv *Server) withRequestCancel(r *Request) func() {
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c := &requestCancel{srv: srv, cancel: cancel}
+	r.Ctx = context.WithValue(ctx, cancelCauseKey{}, c)
+	session := r.Client.networkSession()
+	if session.IsTCP() || r.Msg.Code() == Empty || r.Msg.Code() >= Created {
+		return cancel
+	}
+	key := requestCancelKey{session: session, messageID: r.Msg.MessageID()}
+	srv.cancels.lock.Lock()
+	if srv.cancels.requests == nil {
+		srv.cancels.requests = make(map[requestCancelKey]*requestCancel)
+	}
+	srv.cancels.requests[key] = c
+	srv.cancels.lock.Unlock()
+	return func() {
+		srv.cancels.lock.Lock()
+		if srv.cancels.requests[key] == c {
+			delete(srv.cancels.requests, key)
+		}
+		srv.cancels.lock.Unlock()
+		cancel()
+	}
+}
+
+// handleResetMsg cancels request in flight reset by client.
+func (srv *Server) handleResetMsg(w ResponseWriter, r *Request, next HandlerFunc) {
+	if r.Msg.Type() != Reset || r.Client.networkSession().IsTCP() {
+		next(w, r)
+		return
+	}
+	key := requestCancelKey{session: r.Client.networkSession(), messageID: r.Msg.MessageID()}
+	srv.cancels.lock.Lock()
+	c := srv.cancels.requests[key]
+	srv.cancels.lock.Unlock()
+	if c == nil {
+		next(w, r)
+		return
+	}
+	c.cancelWithCause(CancelledByClient)
+}
@@ -0,0 +1,92 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerCancelCause(t *testing.T) {
+	started := make(chan struct{}, 1)
+	causes := make(chan CancelCause, 1)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		assert.Equal(t, NotCancelled, HandlerCancelCause(r.Ctx))
+		started <- struct{}{}
+		select {
+		case <-r.Ctx.Done():
+			causes <- HandlerCancelCause(r.Ctx)
+		case <-time.After(time.Second * 2):
+			causes <- NotCancelled
+		}
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	conn, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	send := func(typ COAPType, code COAPCode) {
+		var buf bytes.Buffer
+		require.NoError(t, NewDgramMessage(MessageParams{Type: typ, Code: code, MessageID: 7}).MarshalBinary(&buf))
+		_, err := conn.Write(buf.Bytes())
+		require.NoError(t, err)
+	}
+	send(Confirmable, GET)
+	<-started
+	// reset of client cancels the request
+	send(Reset, Empty)
+	assert.Equal(t, CancelledByClient, <-causes)
+}
+
+func TestHandlerCancelCauseTimeout(t *testing.T) {
+	causes := make(chan CancelCause, 1)
+	s := &Server{HandlerTimeout: time.Millisecond * 50, Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-r.Ctx.Done()
+		causes <- HandlerCancelCause(r.Ctx)
+	})}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+	_, err = co.Get("/slow")
+	assert.Error(t, err)
+	assert.Equal(t, TimedOut, <-causes)
+}
+
+func TestHandlerCancelCauseShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	causes := make(chan CancelCause, 1)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		started <- struct{}{}
+		<-r.Ctx.Done()
+		causes <- HandlerCancelCause(r.Ctx)
+	})
+	require.NoError(t, err)
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+	go co.GetWithContext(context.Background(), "/a")
+	<-started
+	s.Shutdown()
+	assert.Equal(t, ServerShuttingDown, <-causes)
+	<-fin
+}
+
+func TestHandlerCancelCauseContext(t *testing.T) {
+	assert.Equal(t, NotCancelled, HandlerCancelCause(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	assert.Equal(t, TimedOut, HandlerCancelCause(ctx))
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, CancelledByClient, HandlerCancelCause(ctx))
+}
@@ -0,0 +1,153 @@
+package coap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+var errCCMAuthentication = errors.New("ccm: message authentication failed")
+
+// ccm is AES-CCM AEAD (RFC 3610), crypto/cipher doesn't provide it.
+type ccm struct {
+	block     cipher.Block
+	tagSize   int
+	nonceSize int
+}
+
+// newAESCCM creates AES-CCM with tags of tagSize bytes and nonces of nonceSize bytes,
+// eg. AES-CCM-16-64-128 of OSCORE has 8 bytes tag and 13 bytes nonce.
+func newAESCCM(key []byte, tagSize, nonceSize int) (cipher.AEAD, error) {
+	if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 || nonceSize < 7 || nonceSize > 13 {
+		return nil, errors.New("ccm: invalid tag or nonce size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ccm{block: block, tagSize: tagSize, nonceSize: nonceSize}, nil
+}
+
+func (c *ccm) NonceSize() int { return c.nonceSize }
+
+func (c *ccm) Overhead() int { return c.tagSize }
+
+// lenSize is size of message length field L.
+func (c *ccm) lenSize() int { return 15 - c.nonceSize }
+
+func (c *ccm) maxLen() uint64 {
+	if c.lenSize() >= 8 {
+		return ^uint64(0)
+	}
+	return 1<<(8*uint(c.lenSize())) - 1
+}
+
+// counterBlock returns block A_i of CTR mode.
+func (c *ccm) counterBlock(nonce []byte, i int) []byte {
+	a := make([]byte, aes.BlockSize)
+	a[0] = byte(c.lenSize() - 1)
+	copy(a[1:], nonce)
+	for j := aes.BlockSize - 1; j > c.nonceSize && i > 0; j-- {
+		a[j] = byte(i)
+		i >>= 8
+	}
+	return a
+}
+
+// mac computes CBC-MAC of plaintext and additional data.
+func (c *ccm) mac(nonce, plaintext, data []byte) []byte {
+	b := make([]byte, aes.BlockSize)
+	b[0] = byte((c.tagSize-2)/2<<3 | (c.lenSize() - 1))
+	if len(data) > 0 {
+		b[0] |= 1 << 6
+	}
+	copy(b[1:], nonce)
+	n := uint64(len(plaintext))
+	for j := aes.BlockSize - 1; j > c.nonceSize; j-- {
+		b[j] = byte(n)
+		n >>= 8
+	}
+	x := make([]byte, aes.BlockSize)
+	c.block.Encrypt(x, b)
+
+	macBlocks := func(p []byte) {
+		for len(p) > 0 {
+			n := xorBytes(x, x, p)
+			c.block.Encrypt(x, x)
+			p = p[n:]
+		}
+	}
+	if len(data) > 0 {
+		var aad []byte
+		if len(data) < 0xff00 {
+			aad = []byte{byte(len(data) >> 8), byte(len(data))}
+		} else {
+			aad = []byte{0xff, 0xfe, byte(len(data) >> 24), byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}
+		}
+		aad = append(aad, data...)
+		macBlocks(padBlock(aad))
+	}
+	macBlocks(padBlock(plaintext))
+	return x[:c.tagSize]
+}
+
+// xorBytes sets dst to a xor b of the shorter length and returns the length.
+func xorBytes(dst, a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		dst[i] = a[i] ^ b[i]
+	}
+	return n
+}
+
+func padBlock(p []byte) []byte {
+	if r := len(p) % aes.BlockSize; r != 0 {
+		p = append(append([]byte(nil), p...), make([]byte, aes.BlockSize-r)...)
+	}
+	return p
+}
+
+// ctr encrypts p by counter blocks from A_1.
+func (c *ccm) ctr(nonce, dst, p []byte) {
+	s := make([]byte, aes.BlockSize)
+	for i := 0; len(p) > 0; i++ {
+		c.block.Encrypt(s, c.counterBlock(nonce, i+1))
+		n := xorBytes(dst, p, s)
+		dst, p = dst[n:], p[n:]
+	}
+}
+
+func (c *ccm) tagMask(nonce, tag []byte) []byte {
+	s := make([]byte, aes.BlockSize)
+	c.block.Encrypt(s, c.counterBlock(nonce, 0))
+	res := make([]byte, c.tagSize)
+	xorBytes(res, tag, s)
+	return res
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, data []byte) []byte {
+	if len(nonce) != c.nonceSize || uint64(len(plaintext)) > c.maxLen() {
+		panic("ccm: invalid nonce or plaintext length")
+	}
+	tag := c.tagMask(nonce, c.mac(nonce, plaintext, data))
+	out := make([]byte, len(plaintext), len(plaintext)+c.tagSize)
+	c.ctr(nonce, out, plaintext)
+	return append(dst, append(out, tag...)...)
+}
+
+func (c *ccm) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize || len(ciphertext) < c.tagSize || uint64(len(ciphertext)-c.tagSize) > c.maxLen() {
+		return nil, errCCMAuthentication
+	}
+	ct, tag := ciphertext[:len(ciphertext)-c.tagSize], ciphertext[len(ciphertext)-c.tagSize:]
+	plaintext := make([]byte, len(ct))
+	c.ctr(nonce, plaintext, ct)
+	if subtle.ConstantTimeCompare(c.tagMask(nonce, c.mac(nonce, plaintext, data)), tag) != 1 {
+		return nil, errCCMAuthentication
+	}
+	return append(dst, plaintext...), nil
+}
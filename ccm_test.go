@@ -0,0 +1,43 @@
+package coap
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// RFC 3610 section 8, packet vector #1
+func TestAESCCM(t *testing.T) {
+	key := mustDecodeHex(t, "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf")
+	nonce := mustDecodeHex(t, "00000003020100a0a1a2a3a4a5")
+	aad := mustDecodeHex(t, "0001020304050607")
+	plaintext := mustDecodeHex(t, "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e")
+	expected := mustDecodeHex(t, "588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0")
+
+	c, err := newAESCCM(key, 8, len(nonce))
+	require.NoError(t, err)
+	ciphertext := c.Seal(nil, nonce, plaintext, aad)
+	assert.Equal(t, expected, ciphertext)
+
+	p, err := c.Open(nil, nonce, ciphertext, aad)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, p)
+
+	ciphertext[0] ^= 1
+	_, err = c.Open(nil, nonce, ciphertext, aad)
+	assert.Error(t, err)
+	ciphertext[0] ^= 1
+	_, err = c.Open(nil, nonce, ciphertext, aad[1:])
+	assert.Error(t, err)
+
+	_, err = newAESCCM(key, 3, len(nonce))
+	assert.Error(t, err)
+}
@@ -26,7 +26,7 @@ type ClientConn struct {
 
 // A Client defines parameters for a COAP client.
 type Client struct {
-	Net            string        // if "tcp" or "tcp-tls" (COAP over TLS) a TCP query will be initiated, otherwise an UDP one (default is "" for UDP) or "udp-mcast" for multicast
+	Net            string        // if "tcp" or "tcp-tls" (COAP over TLS) a TCP query will be initiated, "ws" or "ws-tls" a WebSocket one (RFC 8323 section 4), otherwise an UDP one (default is "" for UDP) or "udp-mcast" for multicast
 	MaxMessageSize uint32        // Max message size that could be received from peer. If not set it defaults to 1152 B.
 	TLSConfig      *tls.Config   // TLS connection configuration
 	DTLSConfig     *dtls.Config  // TLS connection configuration
@@ -44,6 +44,39 @@ type Client struct {
 	DisableTCPSignalMessages        bool // Disable tcp signal messages
 	DisablePeerTCPSignalMessageCSMs bool // Disable processes Capabilities and Settings Messages from client - iotivity sends max message size without blockwise.
 	MulticastHopLimit               int  //sets the hop limit field value for future outgoing multicast packets. default is 2.
+	OutboundPriorityLevels          int  //count of priority levels of outbound queue, see MessagePriority. default is 0 - queue is disabled.
+
+	Resolver coapNet.Resolver // resolves address of UDP, DTLS and multicast server, eg. CachingResolver. default resolves by net.ResolveUDPAddr.
+
+	// MessageIDGenerator generates message IDs of requests created by client instead of GenerateMessageID.
+	// ID used for the peer within EXCHANGE_LIFETIME is generated again up to 3 times, then the request fails
+	// by ErrMessageIDInUse.
+	MessageIDGenerator func(peer net.Addr) uint16
+
+	// RetryPolicy is consulted when Get, Put or Delete fails by error or error response, the request
+	// is sent again with new message ID when it allows. default is no retry.
+	RetryPolicy RetryPolicy
+	// RetryNonIdempotent enables retry of Post at caller's risk.
+	RetryNonIdempotent bool
+	// BlockWisePinning is sent in PinningSessionID option of every request and so every block of
+	// its transfer, load balancer passes them to the same server instance, see BlockWisePinningHandler.
+	BlockWisePinning []byte
+	// Middlewares are applied to exchanges of connection, see ClientConn.Use.
+	Middlewares []ClientMiddlewareFunc
+	// TransmissionParams sets retransmission of confirmable requests over UDP and DTLS, see Server.TransmissionParams.
+	TransmissionParams *TransmissionParams
+	// Instrumentation receives events of connection, see Server.Instrumentation.
+	Instrumentation Instrumentation
+	// Dialer dials UDP socket of DTLS connection, eg. coapNet.NewChaosDialer to test over unreliable
+	// network. default dials by net.Dialer.
+	Dialer coapNet.Dialer
+}
+
+func (c *Client) resolveUDPAddr(network, address string) (*net.UDPAddr, error) {
+	if c.Resolver != nil {
+		return c.Resolver.ResolveUDPAddr(network, address)
+	}
+	return net.ResolveUDPAddr(network, address)
 }
 
 func (c *Client) readTimeout() time.Duration {
@@ -117,11 +150,33 @@ func (c *Client) DialWithContext(ctx context.Context, address string) (clientCon
 			return nil, err
 		}
 		BlockWiseTransferSzx = BlockWiseSzxBERT
+	case "ws", "ws-tls":
+		// address is host:port of server with endpoint at coapNet.WSPath or ws:// or wss:// URL of endpoint
+		network = c.Net
+		var config *tls.Config
+		if c.Net == "ws-tls" {
+			config = c.TLSConfig
+			if config == nil {
+				config = &tls.Config{}
+			}
+		}
+		conn, err = coapNet.DialWS(ctx, dialer, address, config)
+		if err != nil {
+			return nil, err
+		}
+		BlockWiseTransferSzx = BlockWiseSzxBERT
 	case "udp", "udp4", "udp6", "":
 		network = c.Net
 		if network == "" {
 			network = "udp"
 		}
+		if c.Resolver != nil {
+			addr, err := c.Resolver.ResolveUDPAddr(network, address)
+			if err != nil {
+				return nil, fmt.Errorf("cannot resolve udp address: %v", err)
+			}
+			address = addr.String()
+		}
 		if conn, err = dialer.DialContext(ctx, network, address); err != nil {
 			return nil, err
 		}
@@ -130,11 +185,20 @@ func (c *Client) DialWithContext(ctx context.Context, address string) (clientCon
 	case "udp-dtls", "udp4-dtls", "udp6-dtls":
 		network = c.Net
 		Net := strings.TrimSuffix(c.Net, "-dtls")
-		addr, err := net.ResolveUDPAddr(Net, address)
+		addr, err := c.resolveUDPAddr(Net, address)
 		if err != nil {
 			return nil, fmt.Errorf("cannot resolve udp address: %v", err)
 		}
-		if conn, err = dtls.Dial(Net, addr, c.DTLSConfig); err != nil {
+		if c.Dialer != nil {
+			raw, err := c.Dialer.DialContext(ctx, Net, addr.String())
+			if err != nil {
+				return nil, err
+			}
+			if conn, err = dtls.Client(raw, c.DTLSConfig); err != nil {
+				raw.Close()
+				return nil, err
+			}
+		} else if conn, err = dtls.Dial(Net, addr, c.DTLSConfig); err != nil {
 			return nil, err
 		}
 		conn = coapNet.NewConnDTLS(conn)
@@ -142,7 +206,7 @@ func (c *Client) DialWithContext(ctx context.Context, address string) (clientCon
 	case "udp-mcast", "udp4-mcast", "udp6-mcast":
 		var err error
 		network = strings.TrimSuffix(c.Net, "-mcast")
-		multicastAddress, err := net.ResolveUDPAddr(network, address)
+		multicastAddress, err := c.resolveUDPAddr(network, address)
 		if err != nil {
 			return nil, fmt.Errorf("cannot resolve multicast address: %v", err)
 		}
@@ -188,6 +252,9 @@ func (c *Client) DialWithContext(ctx context.Context, address string) (clientCon
 			BlockWiseTransferSzx:            &BlockWiseTransferSzx,
 			DisableTCPSignalMessages:        c.DisableTCPSignalMessages,
 			DisablePeerTCPSignalMessageCSMs: c.DisablePeerTCPSignalMessageCSMs,
+			OutboundPriorityLevels:          c.OutboundPriorityLevels,
+			TransmissionParams:              c.TransmissionParams,
+			Instrumentation:                 c.Instrumentation,
 			NotifyStartedFunc: func() {
 				close(started)
 			},
@@ -205,9 +272,9 @@ func (c *Client) DialWithContext(ctx context.Context, address string) (clientCon
 			newSessionUDPFunc: func(connection *coapNet.ConnUDP, srv *Server, sessionUDPData *coapNet.ConnUDPContext) (networkSession, error) {
 				if sessionUDPData.RemoteAddr().String() == clientConn.commander.networkSession.RemoteAddr().String() {
 					if s, ok := clientConn.commander.networkSession.(*blockWiseSession); ok {
-						s.networkSession.(*sessionUDP).sessionUDPData = sessionUDPData
+						s.networkSession.(*sessionUDP).setUDPData(sessionUDPData)
 					} else {
-						clientConn.commander.networkSession.(*sessionUDP).sessionUDPData = sessionUDPData
+						clientConn.commander.networkSession.(*sessionUDP).setUDPData(sessionUDPData)
 					}
 					return clientConn.commander.networkSession, nil
 				}
@@ -224,11 +291,16 @@ func (c *Client) DialWithContext(ctx context.Context, address string) (clientCon
 		},
 		shutdownSync: make(chan error, 1),
 		multicast:    multicast,
-		commander:    &ClientCommander{},
+		commander: &ClientCommander{
+			retryPolicy:        c.RetryPolicy,
+			retryNonIdempotent: c.RetryNonIdempotent,
+			pinningSessionID:   c.BlockWisePinning,
+			middlewares:        append([]ClientMiddlewareFunc(nil), c.Middlewares...),
+		},
 	}
 
 	switch clientConn.srv.Conn.(type) {
-	case *net.TCPConn, *tls.Conn:
+	case *net.TCPConn, *tls.Conn, *coapNet.WSConn:
 		session, err := newSessionTCP(coapNet.NewConn(clientConn.srv.Conn, clientConn.srv.heartBeat()), clientConn.srv)
 		if err != nil {
 			clientConn.srv.Conn.Close()
@@ -267,6 +339,9 @@ func (c *Client) DialWithContext(ctx context.Context, address string) (clientCon
 		clientConn.srv.Conn.Close()
 		return nil, fmt.Errorf("unknown connection type %T", clientConn.srv.Conn)
 	}
+	if c.MessageIDGenerator != nil {
+		clientConn.commander.messageIDs = newMessageIDAllocator(c.MessageIDGenerator, clientConn.commander.RemoteAddr())
+	}
 
 	go func() {
 		err := clientConn.srv.ActivateAndServe()
@@ -3,8 +3,11 @@ package coap
 import (
 	"bytes"
 	"log"
+	"net"
 	"testing"
 	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
 )
 
 func periodicTransmitter(w ResponseWriter, r *Request) {
@@ -259,3 +262,57 @@ func TestServingUDPObserve(t *testing.T) {
 	}
 	<-sync
 }
+
+func TestClientDialWithCachingResolver(t *testing.T) {
+	var addrs []string
+	for _, name := range []string{"first", "second"} {
+		payload := name
+		s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+			w.SetContentFormat(TextPlain)
+			w.Write([]byte(payload))
+		})
+		if err != nil {
+			t.Fatalf("unable to run test server: %v", err)
+		}
+		defer func() {
+			s.Shutdown()
+			<-fin
+		}()
+		addrs = append(addrs, addr)
+	}
+
+	// DNS record of the device changes after the first lookup
+	lookups := 0
+	resolver := coapNet.NewCachingResolver(time.Second)
+	resolver.Lookup = func(network, address string) (*net.UDPAddr, error) {
+		addr := addrs[len(addrs)-1]
+		if lookups < len(addrs) {
+			addr = addrs[lookups]
+		}
+		lookups++
+		return net.ResolveUDPAddr(network, addr)
+	}
+	client := Client{Resolver: resolver}
+	get := func() string {
+		co, err := client.Dial("device.example:5683")
+		if err != nil {
+			t.Fatalf("unable to dialing: %v", err)
+		}
+		defer co.Close()
+		resp, err := co.Get("/a")
+		if err != nil {
+			t.Fatalf("unable to get: %v", err)
+		}
+		return string(resp.Payload())
+	}
+
+	for i := 0; i < 3; i++ {
+		if p := get(); p != "first" {
+			t.Fatalf("expected cached address of first server, got response from %v", p)
+		}
+	}
+	time.Sleep(time.Millisecond * 1500)
+	if p := get(); p != "second" {
+		t.Fatalf("expected refreshed address of second server, got response from %v", p)
+	}
+}
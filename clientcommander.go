@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -13,6 +14,14 @@ import (
 // For compare use ClientCommander.Equal
 type ClientCommander struct {
 	networkSession networkSession
+	messageIDs     *messageIDAllocator // set when Client.MessageIDGenerator is used
+
+	retryPolicy        RetryPolicy
+	retryNonIdempotent bool
+	pinningSessionID   []byte
+
+	middlewaresLock sync.RWMutex
+	middlewares     []ClientMiddlewareFunc
 }
 
 // NewMessage creates message for request
@@ -20,15 +29,26 @@ func (cc *ClientCommander) NewMessage(p MessageParams) Message {
 	return cc.networkSession.NewMessage(p)
 }
 
+func (cc *ClientCommander) generateMessageID() (uint16, error) {
+	if cc.messageIDs == nil {
+		return GenerateMessageID(), nil
+	}
+	return cc.messageIDs.next()
+}
+
 func (cc *ClientCommander) newGetDeleteRequest(path string, code COAPCode) (Message, error) {
 	token, err := GenerateToken()
 	if err != nil {
 		return nil, err
 	}
+	messageID, err := cc.generateMessageID()
+	if err != nil {
+		return nil, err
+	}
 	req := cc.NewMessage(MessageParams{
 		Type:      Confirmable,
 		Code:      code,
-		MessageID: GenerateMessageID(),
+		MessageID: messageID,
 		Token:     token,
 	})
 	req.SetPathString(path)
@@ -40,10 +60,14 @@ func (cc *ClientCommander) newPostPutRequest(path string, contentFormat MediaTyp
 	if err != nil {
 		return nil, err
 	}
+	messageID, err := cc.generateMessageID()
+	if err != nil {
+		return nil, err
+	}
 	req := cc.networkSession.NewMessage(MessageParams{
 		Type:      Confirmable,
 		Code:      code,
-		MessageID: GenerateMessageID(),
+		MessageID: messageID,
 		Token:     token,
 	})
 	req.SetPathString(path)
@@ -102,7 +126,15 @@ func (cc *ClientCommander) Exchange(m Message) (Message, error) {
 // ExchangeContext does not retry a failed query, nor will it fall back to TCP in
 // case of truncation.
 func (cc *ClientCommander) ExchangeWithContext(ctx context.Context, m Message) (Message, error) {
-	return cc.networkSession.ExchangeWithContext(ctx, m)
+	cc.pin(m)
+	return cc.exchange(ctx, m)
+}
+
+// pin sets PinningSessionID option of request, blockwise copies it to every block.
+func (cc *ClientCommander) pin(req Message) {
+	if len(cc.pinningSessionID) > 0 && req.Option(PinningSessionID) == nil {
+		req.SetOption(PinningSessionID, cc.pinningSessionID)
+	}
 }
 
 // WriteMsg sends  direct a message through the connection
@@ -127,6 +159,16 @@ func (cc *ClientCommander) PingWithContext(ctx context.Context) error {
 	return cc.networkSession.PingWithContext(ctx)
 }
 
+// exchangeChecked performs exchange and returns CoAPError when response has error code.
+func (cc *ClientCommander) exchangeChecked(ctx context.Context, req Message) (Message, error) {
+	cc.pin(req)
+	resp, err := cc.exchange(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, responseError(resp)
+}
+
 // Get retrieves the resource identified by the request path
 func (cc *ClientCommander) Get(path string) (Message, error) {
 	return cc.GetWithContext(context.Background(), path)
@@ -138,7 +180,7 @@ func (cc *ClientCommander) GetWithContext(ctx context.Context, path string) (Mes
 	if err != nil {
 		return nil, err
 	}
-	return cc.networkSession.ExchangeWithContext(ctx, req)
+	return cc.exchangeWithRetry(ctx, req)
 }
 
 // Post updates the resource identified by the request path
@@ -152,7 +194,7 @@ func (cc *ClientCommander) PostWithContext(ctx context.Context, path string, con
 	if err != nil {
 		return nil, err
 	}
-	return cc.networkSession.ExchangeWithContext(ctx, req)
+	return cc.exchangeWithRetry(ctx, req)
 }
 
 // Put creates the resource identified by the request path
@@ -166,7 +208,7 @@ func (cc *ClientCommander) PutWithContext(ctx context.Context, path string, cont
 	if err != nil {
 		return nil, err
 	}
-	return cc.networkSession.ExchangeWithContext(ctx, req)
+	return cc.exchangeWithRetry(ctx, req)
 }
 
 // Delete deletes the resource identified by the request path
@@ -180,7 +222,7 @@ func (cc *ClientCommander) DeleteWithContext(ctx context.Context, path string) (
 	if err != nil {
 		return nil, err
 	}
-	return cc.networkSession.ExchangeWithContext(ctx, req)
+	return cc.exchangeWithRetry(ctx, req)
 }
 
 //Observation represents subscription to resource on the server
@@ -197,10 +239,14 @@ func (o *Observation) Cancel() error {
 
 // CancelContext remove observation from server. For recreate observation use Observe.
 func (o *Observation) CancelWithContext(ctx context.Context) error {
+	messageID, err := o.client.generateMessageID()
+	if err != nil {
+		return err
+	}
 	req := o.client.NewMessage(MessageParams{
 		Type:      NonConfirmable,
 		Code:      GET,
-		MessageID: GenerateMessageID(),
+		MessageID: messageID,
 		Token:     o.token,
 	})
 	req.SetPathString(o.path)
@@ -0,0 +1,35 @@
+package coap
+
+import "context"
+
+// ExchangeFunc sends request req and returns its response.
+type ExchangeFunc func(ctx context.Context, req Message) (Message, error)
+
+// ClientMiddlewareFunc wraps exchanges of ClientConn, eg. to log them, add token of authorization
+// or measure latency. It may change req and response or return without calling next, eg. with
+// error or response created by ClientConn.NewMessage.
+type ClientMiddlewareFunc func(next ExchangeFunc) ExchangeFunc
+
+// Use adds middleware applied to exchanges of connection, middleware added first is the outermost one.
+// Every attempt of retry passes the middlewares, messages sent by WriteMsg don't.
+func (co *ClientConn) Use(mw ClientMiddlewareFunc) {
+	co.commander.use(mw)
+}
+
+func (cc *ClientCommander) use(mw ClientMiddlewareFunc) {
+	cc.middlewaresLock.Lock()
+	defer cc.middlewaresLock.Unlock()
+	cc.middlewares = append(cc.middlewares, mw)
+}
+
+// exchange performs exchange by network session through the middlewares.
+func (cc *ClientCommander) exchange(ctx context.Context, req Message) (Message, error) {
+	cc.middlewaresLock.RLock()
+	mws := cc.middlewares
+	cc.middlewaresLock.RUnlock()
+	exchange := ExchangeFunc(cc.networkSession.ExchangeWithContext)
+	for i := len(mws) - 1; i >= 0; i-- {
+		exchange = mws[i](exchange)
+	}
+	return exchange(ctx, req)
+}
@@ -0,0 +1,70 @@
+package coap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientMiddlewares(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/a", func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(r.Msg.QueryString()))
+	})
+	addr, shutdown := runLocalUDPServer(t, &Server{Handler: mux})
+	defer shutdown()
+
+	var latency time.Duration
+	var codes []COAPCode
+	measure := func(next ExchangeFunc) ExchangeFunc {
+		return func(ctx context.Context, req Message) (Message, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			latency = time.Since(start)
+			if resp != nil {
+				codes = append(codes, resp.Code())
+			}
+			return resp, err
+		}
+	}
+	auth := func(next ExchangeFunc) ExchangeFunc {
+		return func(ctx context.Context, req Message) (Message, error) {
+			req.AddOption(URIQuery, "token=secret")
+			return next(ctx, req)
+		}
+	}
+	c := Client{Net: "udp", Middlewares: []ClientMiddlewareFunc{measure, auth}}
+	co, err := c.Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, "token=secret", string(resp.Payload()))
+	assert.NotZero(t, latency)
+	assert.Equal(t, []COAPCode{Content}, codes)
+
+	errLimited := errors.New("rate limited")
+	co.Use(func(next ExchangeFunc) ExchangeFunc {
+		return func(ctx context.Context, req Message) (Message, error) {
+			if req.PathString() == "b" {
+				return nil, errLimited
+			}
+			return next(ctx, req)
+		}
+	})
+	_, err = co.Get("/b")
+	assert.Equal(t, errLimited, err)
+
+	req, err := co.NewGetRequest("/a")
+	require.NoError(t, err)
+	resp, err = co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, "token=secret", string(resp.Payload()))
+	assert.Equal(t, []COAPCode{Content, Content}, codes)
+}
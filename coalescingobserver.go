@@ -0,0 +1,98 @@
+package coap
+
+import (
+	"sync"
+	"time"
+)
+
+// CoalescingObserver coalesces non-confirmable observe notifications of high-rate resources.
+// The first notification opens a window, notifications which arrive before the window
+// elapses are combined with the pending one by merge, and when the window elapses
+// the merged notification is sent.
+type CoalescingObserver struct {
+	window time.Duration
+	merge  func(prev, next Message) Message
+	send   func(Message) error
+
+	// ErrorFunc is called when sending of coalesced notification fails.
+	ErrorFunc func(err error)
+
+	lock      sync.Mutex
+	pending   Message
+	timer     *time.Timer
+	windowSeq uint64 // sequence number of coalescing window
+}
+
+// KeepLatest is merge function of CoalescingObserver which keeps the latest notification.
+func KeepLatest(prev, next Message) Message {
+	return next
+}
+
+// NewCoalescingObserver creates coalescing observer which sends notifications via send, eg. ClientConn.WriteMsg.
+// When merge is nil, KeepLatest is used.
+func NewCoalescingObserver(window time.Duration, merge func(prev, next Message) Message, send func(Message) error) *CoalescingObserver {
+	if merge == nil {
+		merge = KeepLatest
+	}
+	return &CoalescingObserver{
+		window: window,
+		merge:  merge,
+		send:   send,
+	}
+}
+
+// Notify queues notification. Confirmable notification is sent immediately after pending one.
+func (o *CoalescingObserver) Notify(m Message) error {
+	if m.IsConfirmable() {
+		if err := o.Flush(); err != nil {
+			return err
+		}
+		return o.send(m)
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.pending != nil {
+		o.pending = o.merge(o.pending, m)
+		return nil
+	}
+	o.pending = m
+	o.windowSeq++
+	w := o.windowSeq
+	o.timer = time.AfterFunc(o.window, func() { o.flushByTimer(w) })
+	return nil
+}
+
+func (o *CoalescingObserver) takePending(w uint64) Message {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if w != 0 && w != o.windowSeq {
+		// timer of already flushed window
+		return nil
+	}
+	m := o.pending
+	o.pending = nil
+	if o.timer != nil {
+		o.timer.Stop()
+		o.timer = nil
+	}
+	return m
+}
+
+func (o *CoalescingObserver) flushByTimer(w uint64) {
+	if err := o.flush(w); err != nil && o.ErrorFunc != nil {
+		o.ErrorFunc(err)
+	}
+}
+
+func (o *CoalescingObserver) flush(w uint64) error {
+	m := o.takePending(w)
+	if m == nil {
+		return nil
+	}
+	return o.send(m)
+}
+
+// Flush sends pending notification immediately.
+func (o *CoalescingObserver) Flush() error {
+	return o.flush(0)
+}
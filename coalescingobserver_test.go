@@ -0,0 +1,64 @@
+package coap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type notificationRecorder struct {
+	lock sync.Mutex
+	sent []Message
+}
+
+func (r *notificationRecorder) send(m Message) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.sent = append(r.sent, m)
+	return nil
+}
+
+func (r *notificationRecorder) payloads() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var p []string
+	for _, m := range r.sent {
+		p = append(p, string(m.Payload()))
+	}
+	return p
+}
+
+func newNotification(payload string) Message {
+	return NewDgramMessage(MessageParams{
+		Type:      NonConfirmable,
+		Code:      Content,
+		MessageID: GenerateMessageID(),
+		Payload:   []byte(payload),
+	})
+}
+
+func TestCoalescingObserverMergesWithinWindow(t *testing.T) {
+	r := &notificationRecorder{}
+	o := NewCoalescingObserver(time.Millisecond*50, KeepLatest, r.send)
+	for i := 0; i < 10; i++ {
+		o.Notify(newNotification(string('0' + rune(i))))
+	}
+	time.Sleep(time.Millisecond * 150)
+	p := r.payloads()
+	if len(p) != 1 || p[0] != "9" {
+		t.Fatalf("expected just last notification, got %v", p)
+	}
+}
+
+func TestCoalescingObserverSendsSeparately(t *testing.T) {
+	r := &notificationRecorder{}
+	o := NewCoalescingObserver(time.Millisecond*50, nil, r.send)
+	for _, p := range []string{"a", "b", "c"} {
+		o.Notify(newNotification(p))
+		time.Sleep(time.Millisecond * 200)
+	}
+	p := r.payloads()
+	if len(p) != 3 || p[0] != "a" || p[1] != "b" || p[2] != "c" {
+		t.Fatalf("expected every notification, got %v", p)
+	}
+}
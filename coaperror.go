@@ -0,0 +1,69 @@
+package coap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CoAPError is returned by client methods (Get, Post, Put, Delete) when the server
+// responds with error code 4.xx or 5.xx. The response is returned as well.
+type CoAPError struct {
+	Code    COAPCode
+	Message string // diagnostic payload when it's text, otherwise name of code
+	Payload []byte
+}
+
+func (e *CoAPError) Error() string {
+	return fmt.Sprintf("coap error %v.%02d %v", e.Code>>5, e.Code&0x1f, e.Message)
+}
+
+// Is makes CoAPError compatible with checks of ErrUnexpectedReponseCode.
+func (e *CoAPError) Is(target error) bool {
+	return target == ErrUnexpectedReponseCode
+}
+
+func isErrorCode(code COAPCode) bool {
+	return code>>5 == 4 || code>>5 == 5
+}
+
+// newCoAPError creates error from response with error code.
+func newCoAPError(resp Message) *CoAPError {
+	msg := resp.Code().String()
+	if cf, ok := resp.Option(ContentFormat).(MediaType); len(resp.Payload()) > 0 && (!ok || cf == TextPlain) {
+		msg = string(resp.Payload())
+	}
+	return &CoAPError{
+		Code:    resp.Code(),
+		Message: msg,
+		Payload: resp.Payload(),
+	}
+}
+
+// responseError returns CoAPError when resp has error code.
+func responseError(resp Message) error {
+	if resp == nil || !isErrorCode(resp.Code()) {
+		return nil
+	}
+	return newCoAPError(resp)
+}
+
+// ResponseCode returns response code carried by err.
+func ResponseCode(err error) (COAPCode, bool) {
+	var e *CoAPError
+	if errors.As(err, &e) {
+		return e.Code, true
+	}
+	return 0, false
+}
+
+// IsClientError reports whether err carries 4.xx response code.
+func IsClientError(err error) bool {
+	code, ok := ResponseCode(err)
+	return ok && code>>5 == 4
+}
+
+// IsServerError reports whether err carries 5.xx response code.
+func IsServerError(err error) bool {
+	code, ok := ResponseCode(err)
+	return ok && code>>5 == 5
+}
@@ -0,0 +1,55 @@
+package coap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCoAPErrorNotFound(t *testing.T) {
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		switch r.Msg.PathString() {
+		case "fail":
+			w.SetCode(InternalServerError)
+			w.SetContentFormat(TextPlain)
+			w.Write([]byte("database is down"))
+		default:
+			w.SetCode(NotFound)
+			w.Write(nil)
+		}
+	})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("unable to dialing: %v", err)
+	}
+	defer co.Close()
+
+	resp, err := co.Get("/missing")
+	if resp == nil || resp.Code() != NotFound {
+		t.Fatalf("expected NotFound response, got %v", resp)
+	}
+	if !IsClientError(err) || IsServerError(err) {
+		t.Fatalf("expected client error, got %v", err)
+	}
+	if code, ok := ResponseCode(err); !ok || code != NotFound {
+		t.Fatalf("expected code 4.04, got %v", code)
+	}
+	var coapErr *CoAPError
+	if !errors.As(err, &coapErr) || coapErr.Code != NotFound {
+		t.Fatalf("expected CoAPError, got %T", err)
+	}
+	if !errors.Is(err, ErrUnexpectedReponseCode) {
+		t.Fatalf("CoAPError is not ErrUnexpectedReponseCode")
+	}
+
+	_, err = co.Get("/fail")
+	if !IsServerError(err) || err.(*CoAPError).Message != "database is down" {
+		t.Fatalf("expected server error with diagnostic message, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package coap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// codePhrases are descriptions of codes defined by RFC 7252, RFC 7959, RFC 8132, RFC 8323 and RFC 8516.
+var codePhrases = map[COAPCode]string{
+	Empty:                   "Empty",
+	GET:                     "GET",
+	POST:                    "POST",
+	PUT:                     "PUT",
+	DELETE:                  "DELETE",
+	FETCH:                   "FETCH",
+	PATCH:                   "PATCH",
+	IPATCH:                  "iPATCH",
+	Created:                 "Created",
+	Deleted:                 "Deleted",
+	Valid:                   "Valid",
+	Changed:                 "Changed",
+	Content:                 "Content",
+	Continue:                "Continue",
+	BadRequest:              "Bad Request",
+	Unauthorized:            "Unauthorized",
+	BadOption:               "Bad Option",
+	Forbidden:               "Forbidden",
+	NotFound:                "Not Found",
+	MethodNotAllowed:        "Method Not Allowed",
+	NotAcceptable:           "Not Acceptable",
+	RequestEntityIncomplete: "Request Entity Incomplete",
+	Conflict:                "Conflict",
+	PreconditionFailed:      "Precondition Failed",
+	RequestEntityTooLarge:   "Request Entity Too Large",
+	UnsupportedMediaType:    "Unsupported Content-Format",
+	UnprocessableEntity:     "Unprocessable Entity",
+	TooManyRequests:         "Too Many Requests",
+	InternalServerError:     "Internal Server Error",
+	NotImplemented:          "Not Implemented",
+	BadGateway:              "Bad Gateway",
+	ServiceUnavailable:      "Service Unavailable",
+	GatewayTimeout:          "Gateway Timeout",
+	ProxyingNotSupported:    "Proxying Not Supported",
+	CSM:                     "CSM",
+	Ping:                    "Ping",
+	Pong:                    "Pong",
+	Release:                 "Release",
+	Abort:                   "Abort",
+}
+
+// dotted returns code in "c.dd" notation.
+func (c COAPCode) dotted() string {
+	return fmt.Sprintf("%d.%02d", c>>5, c&0x1f)
+}
+
+// CodeDescription returns code in "c.dd" notation followed by its phrase, eg. "4.04 Not Found".
+// Only the notation is returned for unassigned code.
+func CodeDescription(c COAPCode) string {
+	if phrase, ok := codePhrases[c]; ok {
+		return c.dotted() + " " + phrase
+	}
+	return c.dotted()
+}
+
+// CodeFromString parses code in "c.dd" notation, the phrase of CodeDescription may follow it.
+func CodeFromString(s string) (COAPCode, error) {
+	notation := s
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		notation = s[:i]
+	}
+	dot := strings.IndexByte(notation, '.')
+	if dot < 0 || len(notation)-dot-1 != 2 {
+		return 0, fmt.Errorf("invalid code: %q", s)
+	}
+	class, err := strconv.ParseUint(notation[:dot], 10, 3)
+	if err != nil {
+		return 0, fmt.Errorf("invalid code class: %q", s)
+	}
+	detail, err := strconv.ParseUint(notation[dot+1:], 10, 5)
+	if err != nil {
+		return 0, fmt.Errorf("invalid code detail: %q", s)
+	}
+	return COAPCode(class<<5 | detail), nil
+}
+
+// MarshalText encodes code in "c.dd" notation.
+func (c COAPCode) MarshalText() ([]byte, error) {
+	return []byte(c.dotted()), nil
+}
+
+// UnmarshalText decodes code by CodeFromString.
+func (c *COAPCode) UnmarshalText(text []byte) error {
+	code, err := CodeFromString(string(text))
+	if err != nil {
+		return err
+	}
+	*c = code
+	return nil
+}
@@ -0,0 +1,69 @@
+package coap
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeDescription(t *testing.T) {
+	tests := map[COAPCode]string{
+		Content:                 "2.05 Content",
+		Continue:                "2.31 Continue",
+		NotFound:                "4.04 Not Found",
+		RequestEntityIncomplete: "4.08 Request Entity Incomplete",
+		Conflict:                "4.09 Conflict",
+		UnprocessableEntity:     "4.22 Unprocessable Entity",
+		TooManyRequests:         "4.29 Too Many Requests",
+		InternalServerError:     "5.00 Internal Server Error",
+		GET:                     "0.01 GET",
+		Ping:                    "7.02 Ping",
+		COAPCode(138):           "4.10",
+	}
+	for code, exp := range tests {
+		assert.Equal(t, exp, CodeDescription(code))
+	}
+}
+
+func TestCodeFromString(t *testing.T) {
+	standard := []COAPCode{
+		Empty, GET, POST, PUT, DELETE, FETCH, PATCH, IPATCH,
+		Created, Deleted, Valid, Changed, Content, Continue,
+		BadRequest, Unauthorized, BadOption, Forbidden, NotFound, MethodNotAllowed, NotAcceptable,
+		RequestEntityIncomplete, Conflict, PreconditionFailed, RequestEntityTooLarge, UnsupportedMediaType,
+		UnprocessableEntity, TooManyRequests,
+		InternalServerError, NotImplemented, BadGateway, ServiceUnavailable, GatewayTimeout, ProxyingNotSupported,
+		CSM, Ping, Pong, Release, Abort,
+	}
+	for _, c := range standard {
+		_, ok := codePhrases[c]
+		assert.True(t, ok, "no description of %v", c)
+		code, err := CodeFromString(CodeDescription(c))
+		require.NoError(t, err)
+		assert.Equal(t, c, code)
+	}
+	assert.Len(t, codePhrases, len(standard))
+
+	code, err := CodeFromString("2.05")
+	require.NoError(t, err)
+	assert.Equal(t, Content, code)
+
+	for _, s := range []string{"", "205", "2.5", "8.00", "2.32", "x.05", "2.0x"} {
+		_, err := CodeFromString(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCodeText(t *testing.T) {
+	data, err := json.Marshal(map[string]COAPCode{"code": Changed})
+	require.NoError(t, err)
+	assert.Equal(t, `{"code":"2.04"}`, string(data))
+
+	var v map[string]COAPCode
+	require.NoError(t, json.Unmarshal(data, &v))
+	assert.Equal(t, Changed, v["code"])
+
+	assert.Error(t, json.Unmarshal([]byte(`{"code":"2"}`), &v))
+}
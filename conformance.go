@@ -0,0 +1,242 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// ConformanceClient is client of device under test, it is implemented by ClientConn.
+type ConformanceClient interface {
+	Exchanger
+	NewMessage(p MessageParams) Message
+}
+
+// ConformanceResult is result of one conformance test.
+type ConformanceResult struct {
+	ID          string
+	Description string
+	Passed      bool
+	Reason      string // why the test failed
+
+	// Request and Response of the failed or last exchange of the test, Response is nil when device didn't respond.
+	Request  Message
+	Response Message
+}
+
+type conformanceTest struct {
+	id          string
+	description string
+	run         func(r *ConformanceRunner, ctx context.Context, res *ConformanceResult) error
+}
+
+var conformanceTests = []conformanceTest{
+	{"ack-con", "Confirmable request is acknowledged (RFC 7252 4.2)", (*ConformanceRunner).testAckCon},
+	{"unknown-critical-option", "Request with unrecognized critical option is rejected by 4.02 Bad Option (RFC 7252 5.4.1)", (*ConformanceRunner).testUnknownCriticalOption},
+	{"method-get", "GET method is supported (RFC 7252 5.8.1)", methodTest(GET)},
+	{"method-post", "POST method is supported (RFC 7252 5.8.2)", methodTest(POST)},
+	{"method-put", "PUT method is supported (RFC 7252 5.8.3)", methodTest(PUT)},
+	{"method-delete", "DELETE method is supported (RFC 7252 5.8.4)", methodTest(DELETE)},
+	{"well-known-core", "/.well-known/core returns link-format (RFC 7252 7.2)", (*ConformanceRunner).testWellKnownCore},
+	{"message-id", "Retransmitted request gets the same message ID and new request gets its own (RFC 7252 4.4, 4.5)", (*ConformanceRunner).testMessageID},
+}
+
+// unknownCriticalOption is odd, so critical, option from experimental range.
+const unknownCriticalOption OptionID = 65001
+
+// ConformanceRunner runs RFC 7252 conformance tests against a remote device over UDP.
+// Every test is independent, so failure of one doesn't influence others.
+type ConformanceRunner struct {
+	client ConformanceClient
+
+	ResourcePath string        // resource used by method tests, defaults to /test
+	Timeout      time.Duration // timeout of one exchange, defaults to 5s
+}
+
+// NewConformanceRunner creates runner which tests device connected by client.
+func NewConformanceRunner(client ConformanceClient) *ConformanceRunner {
+	return &ConformanceRunner{client: client}
+}
+
+func (r *ConformanceRunner) resourcePath() string {
+	if r.ResourcePath != "" {
+		return r.ResourcePath
+	}
+	return "/test"
+}
+
+func (r *ConformanceRunner) timeout() time.Duration {
+	if r.Timeout != 0 {
+		return r.Timeout
+	}
+	return time.Second * 5
+}
+
+// RunAll runs all conformance tests and returns their results.
+func (r *ConformanceRunner) RunAll(ctx context.Context) []ConformanceResult {
+	results := make([]ConformanceResult, 0, len(conformanceTests))
+	for _, t := range conformanceTests {
+		res := ConformanceResult{ID: t.id, Description: t.description}
+		if err := ctx.Err(); err != nil {
+			res.Reason = err.Error()
+		} else if err := t.run(r, ctx, &res); err != nil {
+			res.Reason = err.Error()
+		} else {
+			res.Passed = true
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func (r *ConformanceRunner) newRequest(code COAPCode, path string) (Message, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	req := r.client.NewMessage(MessageParams{
+		Type:      Confirmable,
+		Code:      code,
+		MessageID: GenerateMessageID(),
+		Token:     token,
+	})
+	req.SetPathString(path)
+	return req, nil
+}
+
+func (r *ConformanceRunner) exchange(ctx context.Context, res *ConformanceResult, req Message) (Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout())
+	defer cancel()
+	res.Request = req
+	res.Response = nil
+	resp, err := r.client.ExchangeWithContext(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("no response: %v", err)
+	}
+	res.Response = resp
+	return resp, nil
+}
+
+// checkAck verifies that resp is piggybacked acknowledgement of req or separate response.
+func checkAck(req, resp Message) error {
+	switch resp.Type() {
+	case Acknowledgement:
+		if resp.MessageID() != req.MessageID() {
+			return fmt.Errorf("acknowledgement has message ID %v, expected %v", resp.MessageID(), req.MessageID())
+		}
+	case Confirmable, NonConfirmable:
+		// separate response, the empty acknowledgement was consumed by client
+	default:
+		return fmt.Errorf("unexpected response type %v", resp.Type())
+	}
+	if !bytes.Equal(resp.Token(), req.Token()) {
+		return fmt.Errorf("response has token %x, expected %x", resp.Token(), req.Token())
+	}
+	return nil
+}
+
+func (r *ConformanceRunner) testAckCon(ctx context.Context, res *ConformanceResult) error {
+	req, err := r.newRequest(GET, "/.well-known/core")
+	if err != nil {
+		return err
+	}
+	resp, err := r.exchange(ctx, res, req)
+	if err != nil {
+		return err
+	}
+	return checkAck(req, resp)
+}
+
+func (r *ConformanceRunner) testUnknownCriticalOption(ctx context.Context, res *ConformanceResult) error {
+	req, err := r.newRequest(GET, r.resourcePath())
+	if err != nil {
+		return err
+	}
+	req.AddOption(unknownCriticalOption, []byte{1})
+	resp, err := r.exchange(ctx, res, req)
+	if err != nil {
+		return err
+	}
+	if resp.Code() != BadOption {
+		return fmt.Errorf("expected %v, got %v", BadOption, resp.Code())
+	}
+	return checkAck(req, resp)
+}
+
+func methodTest(code COAPCode) func(r *ConformanceRunner, ctx context.Context, res *ConformanceResult) error {
+	return func(r *ConformanceRunner, ctx context.Context, res *ConformanceResult) error {
+		req, err := r.newRequest(code, r.resourcePath())
+		if err != nil {
+			return err
+		}
+		if code == POST || code == PUT {
+			req.SetOption(ContentFormat, TextPlain)
+			req.SetPayload([]byte("conformance"))
+		}
+		resp, err := r.exchange(ctx, res, req)
+		if err != nil {
+			return err
+		}
+		if resp.Code()>>5 != 2 {
+			return fmt.Errorf("expected success response, got %v", resp.Code())
+		}
+		return checkAck(req, resp)
+	}
+}
+
+func (r *ConformanceRunner) testWellKnownCore(ctx context.Context, res *ConformanceResult) error {
+	req, err := r.newRequest(GET, "/.well-known/core")
+	if err != nil {
+		return err
+	}
+	resp, err := r.exchange(ctx, res, req)
+	if err != nil {
+		return err
+	}
+	if resp.Code() != Content {
+		return fmt.Errorf("expected %v, got %v", Content, resp.Code())
+	}
+	if cf := resp.Option(ContentFormat); cf != AppLinkFormat {
+		return fmt.Errorf("expected content format %v, got %v", AppLinkFormat, cf)
+	}
+	return nil
+}
+
+func (r *ConformanceRunner) testMessageID(ctx context.Context, res *ConformanceResult) error {
+	req, err := r.newRequest(GET, r.resourcePath())
+	if err != nil {
+		return err
+	}
+	first, err := r.exchange(ctx, res, req)
+	if err != nil {
+		return err
+	}
+	if err := checkAck(req, first); err != nil {
+		return err
+	}
+	// retransmission must be answered by the same acknowledgement
+	retransmitted, err := r.exchange(ctx, res, req)
+	if err != nil {
+		return err
+	}
+	if err := checkAck(req, retransmitted); err != nil {
+		return err
+	}
+	if first.Code() != retransmitted.Code() || !bytes.Equal(first.Payload(), retransmitted.Payload()) {
+		return fmt.Errorf("retransmitted request got different response")
+	}
+
+	next, err := r.newRequest(GET, r.resourcePath())
+	if err != nil {
+		return err
+	}
+	if next.MessageID() == req.MessageID() {
+		next.SetMessageID(req.MessageID() + 1)
+	}
+	resp, err := r.exchange(ctx, res, next)
+	if err != nil {
+		return err
+	}
+	return checkAck(next, resp)
+}
@@ -0,0 +1,106 @@
+package coap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockDevice simulates device under test, respond returns nil when the device doesn't respond.
+type mockDevice struct {
+	respond func(req Message) Message
+}
+
+func (d *mockDevice) NewMessage(p MessageParams) Message {
+	return NewDgramMessage(p)
+}
+
+func (d *mockDevice) ExchangeWithContext(ctx context.Context, req Message) (Message, error) {
+	if resp := d.respond(req); resp != nil {
+		return resp, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func conformingDevice(req Message) Message {
+	resp := NewDgramMessage(MessageParams{
+		Type:      Acknowledgement,
+		Code:      Content,
+		MessageID: req.MessageID(),
+		Token:     req.Token(),
+	})
+	switch {
+	case req.Option(unknownCriticalOption) != nil:
+		resp.SetCode(BadOption)
+	case req.PathString() == ".well-known/core":
+		resp.SetOption(ContentFormat, AppLinkFormat)
+		resp.SetPayload([]byte("</test>"))
+	case req.Code() == POST:
+		resp.SetCode(Created)
+	case req.Code() == PUT:
+		resp.SetCode(Changed)
+	case req.Code() == DELETE:
+		resp.SetCode(Deleted)
+	default:
+		resp.SetOption(ContentFormat, TextPlain)
+		resp.SetPayload([]byte("test"))
+	}
+	return resp
+}
+
+func TestConformanceRunnerConformingDevice(t *testing.T) {
+	r := NewConformanceRunner(&mockDevice{respond: conformingDevice})
+	results := r.RunAll(context.Background())
+	require.Len(t, results, len(conformanceTests))
+	for _, res := range results {
+		assert.True(t, res.Passed, "%v: %v", res.ID, res.Reason)
+		assert.NotNil(t, res.Request, res.ID)
+		assert.NotNil(t, res.Response, res.ID)
+	}
+}
+
+func TestConformanceRunnerNoAck(t *testing.T) {
+	r := NewConformanceRunner(&mockDevice{respond: func(req Message) Message { return nil }})
+	r.Timeout = time.Millisecond * 10
+	results := r.RunAll(context.Background())
+	require.Len(t, results, len(conformanceTests))
+	for _, res := range results {
+		assert.False(t, res.Passed, res.ID)
+		assert.Contains(t, res.Reason, "no response", res.ID)
+		assert.NotNil(t, res.Request, res.ID)
+		assert.Nil(t, res.Response, res.ID)
+	}
+}
+
+func TestConformanceRunnerIgnoredCriticalOption(t *testing.T) {
+	r := NewConformanceRunner(&mockDevice{respond: func(req Message) Message {
+		req.RemoveOption(unknownCriticalOption)
+		return conformingDevice(req)
+	}})
+	for _, res := range r.RunAll(context.Background()) {
+		if res.ID == "unknown-critical-option" {
+			assert.False(t, res.Passed)
+			assert.Equal(t, Content, res.Response.Code())
+		} else {
+			assert.True(t, res.Passed, "%v: %v", res.ID, res.Reason)
+		}
+	}
+}
+
+func TestConformanceRunnerWrongMessageID(t *testing.T) {
+	r := NewConformanceRunner(&mockDevice{respond: func(req Message) Message {
+		resp := conformingDevice(req)
+		resp.SetMessageID(req.MessageID() + 1)
+		return resp
+	}})
+	for _, res := range r.RunAll(context.Background()) {
+		if res.ID == "message-id" || res.ID == "ack-con" {
+			assert.False(t, res.Passed, res.ID)
+			assert.Contains(t, res.Reason, "message ID", res.ID)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package coap
+
+import (
+	"context"
+	"net"
+)
+
+// labelledConn is net.Conn with labels attached by WithConnectionLabel.
+type labelledConn struct {
+	net.Conn
+	labels map[string]string
+}
+
+// WithConnectionLabel returns conn with label key=value attached, eg. tenant identified by
+// CN of client certificate. It's intended for Server.OnAccept, labels of connection are
+// available to handlers by LabelFromRequest.
+func WithConnectionLabel(conn net.Conn, key, value string) net.Conn {
+	labels := map[string]string{key: value}
+	if c, ok := conn.(*labelledConn); ok {
+		for k, v := range c.labels {
+			if k != key {
+				labels[k] = v
+			}
+		}
+		conn = c.Conn
+	}
+	return &labelledConn{Conn: conn, labels: labels}
+}
+
+// LabelFromConn returns value of label key attached to conn by WithConnectionLabel.
+func LabelFromConn(conn net.Conn, key string) (string, bool) {
+	c, ok := conn.(*labelledConn)
+	if !ok {
+		return "", false
+	}
+	v, ok := c.labels[key]
+	return v, ok
+}
+
+type acceptedConnKey struct{}
+
+func withAcceptedConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, acceptedConnKey{}, conn)
+}
+
+// ConnFromRequest returns connection accepted by TCP, TLS or DTLS listener which received request.
+func ConnFromRequest(r *Request) (net.Conn, bool) {
+	if r == nil || r.Ctx == nil {
+		return nil, false
+	}
+	conn, ok := r.Ctx.Value(acceptedConnKey{}).(net.Conn)
+	return conn, ok
+}
+
+// LabelFromRequest returns value of label key of connection which received request.
+func LabelFromRequest(r *Request, key string) (string, bool) {
+	conn, ok := ConnFromRequest(r)
+	if !ok {
+		return "", false
+	}
+	return LabelFromConn(conn, key)
+}
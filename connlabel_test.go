@@ -0,0 +1,99 @@
+package coap
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionLabel(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	_, ok := LabelFromConn(c1, "tenant")
+	assert.False(t, ok)
+
+	conn := WithConnectionLabel(c1, "tenant", "acme")
+	conn = WithConnectionLabel(conn, "region", "eu")
+	v, ok := LabelFromConn(conn, "tenant")
+	assert.True(t, ok)
+	assert.Equal(t, "acme", v)
+	v, ok = LabelFromConn(conn, "region")
+	assert.True(t, ok)
+	assert.Equal(t, "eu", v)
+	_, ok = LabelFromConn(conn, "other")
+	assert.False(t, ok)
+
+	conn = WithConnectionLabel(conn, "tenant", "globex")
+	v, _ = LabelFromConn(conn, "tenant")
+	assert.Equal(t, "globex", v)
+	assert.Equal(t, c1, conn.(*labelledConn).Conn)
+}
+
+func TestServeMuxHandleForLabel(t *testing.T) {
+	respond := func(payload string) HandlerFunc {
+		return func(w ResponseWriter, r *Request) {
+			w.SetContentFormat(TextPlain)
+			w.Write([]byte(payload))
+		}
+	}
+	mux := NewServeMux()
+	mux.Handle("/a", respond("shared"))
+	require.NoError(t, mux.HandleForLabel("tenant", "acme", "/a", respond("acme")))
+	require.NoError(t, mux.HandleForLabel("tenant", "globex", "/a", respond("globex")))
+	mux.HandleFunc("/b", func(w ResponseWriter, r *Request) {
+		tenant, _ := LabelFromRequest(r, "tenant")
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(tenant))
+	})
+
+	l, err := coapNet.NewTCPListener("tcp", "127.0.0.1:0", time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	var lock sync.Mutex
+	tenants := []string{"acme", "globex"}
+	srv := &Server{
+		Listener: l,
+		Handler:  mux,
+		OnAccept: func(conn net.Conn) net.Conn {
+			lock.Lock()
+			defer lock.Unlock()
+			if len(tenants) == 0 {
+				return conn
+			}
+			tenant := tenants[0]
+			tenants = tenants[1:]
+			return WithConnectionLabel(conn, "tenant", tenant)
+		},
+	}
+	fin := make(chan error, 1)
+	go func() {
+		fin <- srv.ActivateAndServe()
+	}()
+	defer func() {
+		srv.Shutdown()
+		<-fin
+	}()
+
+	for _, tenant := range []string{"acme", "globex", ""} {
+		co, err := Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		expected := tenant
+		if expected == "" {
+			expected = "shared"
+		}
+		resp, err := co.Get("/a")
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(resp.Payload()))
+		resp, err = co.Get("/b")
+		require.NoError(t, err)
+		assert.Equal(t, tenant, string(resp.Payload()))
+		co.Close()
+	}
+}
@@ -0,0 +1,113 @@
+package coap
+
+import (
+	"context"
+)
+
+// Transcoder converts payload between JSON and CBOR.
+type Transcoder interface {
+	JSONtoCBOR(data []byte) ([]byte, error)
+	CBORtoJSON(data []byte) ([]byte, error)
+}
+
+// otherFormat returns format transcoded to and from f, false when f is neither JSON nor CBOR.
+func otherFormat(f MediaType) (MediaType, bool) {
+	switch f {
+	case AppJSON:
+		return AppCBOR, true
+	case AppCBOR:
+		return AppJSON, true
+	}
+	return 0, false
+}
+
+func transcodeTo(t Transcoder, to MediaType, data []byte) ([]byte, error) {
+	if to == AppCBOR {
+		return t.JSONtoCBOR(data)
+	}
+	return t.CBORtoJSON(data)
+}
+
+type contentNegotiationResponseWriter struct {
+	ResponseWriter
+	transcoder    Transcoder
+	handlerFormat MediaType
+	clientFormat  MediaType
+}
+
+func (w *contentNegotiationResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *contentNegotiationResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *contentNegotiationResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *contentNegotiationResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	if f, ok := msg.Option(ContentFormat).(MediaType); ok && f == w.handlerFormat && len(msg.Payload()) > 0 {
+		payload, err := transcodeTo(w.transcoder, w.clientFormat, msg.Payload())
+		if err != nil {
+			return w.ResponseWriter.WriteMsgWithContext(ctx, w.NewResponse(InternalServerError))
+		}
+		msg.SetPayload(payload)
+		msg.SetOption(ContentFormat, w.clientFormat)
+	}
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+// ContentNegotiationMiddleware lets handler which uses handlerFormat (AppJSON or AppCBOR) serve clients
+// using the other one. Request payload in the other format is transcoded before handler gets it, and
+// Accept of the other format is replaced by handlerFormat. Response in handlerFormat is transcoded when
+// the client accepts the other format, or sent payload in it without Accept. Request which can't be
+// transcoded gets 4.00 Bad Request.
+func ContentNegotiationMiddleware(transcoder Transcoder, handlerFormat MediaType) MiddlewareFunc {
+	other, ok := otherFormat(handlerFormat)
+	return func(next Handler) Handler {
+		if !ok {
+			return next
+		}
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			reqFormat, hasFormat := r.Msg.Option(ContentFormat).(MediaType)
+			accept, hasAccept := r.Msg.Option(Accept).(MediaType)
+			transcodeReq := hasFormat && reqFormat == other
+			transcodeResp := (hasAccept && accept == other) || (!hasAccept && transcodeReq)
+			if !transcodeReq && !transcodeResp {
+				next.ServeCOAP(w, r)
+				return
+			}
+
+			msg := copyMessage(r.Client, r.Msg)
+			if transcodeReq {
+				if len(msg.Payload()) > 0 {
+					payload, err := transcodeTo(transcoder, handlerFormat, msg.Payload())
+					if err != nil {
+						w.SetCode(BadRequest)
+						w.Write(nil)
+						return
+					}
+					msg.SetPayload(payload)
+				}
+				msg.SetOption(ContentFormat, handlerFormat)
+			}
+			if hasAccept && accept == other {
+				msg.SetOption(Accept, handlerFormat)
+			}
+			req := &Request{Msg: msg, Client: r.Client, Ctx: r.Ctx, Sequence: r.Sequence}
+			if transcodeResp {
+				w = &contentNegotiationResponseWriter{
+					ResponseWriter: w,
+					transcoder:     transcoder,
+					handlerFormat:  handlerFormat,
+					clientFormat:   other,
+				}
+			}
+			next.ServeCOAP(w, req)
+		})
+	}
+}
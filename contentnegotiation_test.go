@@ -0,0 +1,85 @@
+package coap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tableTranscoder transcodes known documents.
+type tableTranscoder map[string][]byte
+
+func (t tableTranscoder) JSONtoCBOR(data []byte) ([]byte, error) {
+	if cbor, ok := t[string(data)]; ok {
+		return cbor, nil
+	}
+	return nil, errors.New("invalid JSON")
+}
+
+func (t tableTranscoder) CBORtoJSON(data []byte) ([]byte, error) {
+	for json, cbor := range t {
+		if bytes.Equal(cbor, data) {
+			return []byte(json), nil
+		}
+	}
+	return nil, errors.New("invalid CBOR")
+}
+
+func TestContentNegotiationMiddleware(t *testing.T) {
+	tc := tableTranscoder{
+		`{"set":25}`:  {0xa1, 0x63, 's', 'e', 't', 0x18, 25},
+		`{"temp":21}`: {0xa1, 0x64, 't', 'e', 'm', 'p', 21},
+	}
+	received := make(chan Message, 1)
+	handler := ContentNegotiationMiddleware(tc, AppCBOR)(HandlerFunc(func(w ResponseWriter, r *Request) {
+		received <- r.Msg
+		resp, err := tc.JSONtoCBOR([]byte(`{"temp":21}`))
+		require.NoError(t, err)
+		w.SetContentFormat(AppCBOR)
+		w.Write(resp)
+	}))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, handler.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Post("/sensor", AppJSON, bytes.NewReader([]byte(`{"set":25}`)))
+	require.NoError(t, err)
+	req := <-received
+	assert.Equal(t, AppCBOR, req.Option(ContentFormat))
+	js, err := tc.CBORtoJSON(req.Payload())
+	require.NoError(t, err)
+	assert.Equal(t, `{"set":25}`, string(js))
+	assert.Equal(t, AppJSON, resp.Option(ContentFormat))
+	assert.Equal(t, `{"temp":21}`, string(resp.Payload()))
+
+	// Accept decides format of response
+	get, err := co.NewGetRequest("/sensor")
+	require.NoError(t, err)
+	get.SetOption(Accept, AppJSON)
+	resp, err = co.Exchange(get)
+	require.NoError(t, err)
+	assert.Equal(t, AppCBOR, (<-received).Option(Accept))
+	assert.Equal(t, `{"temp":21}`, string(resp.Payload()))
+
+	// CBOR client is served as is
+	cbor, err := tc.JSONtoCBOR([]byte(`{"set":25}`))
+	require.NoError(t, err)
+	resp, err = co.Post("/sensor", AppCBOR, bytes.NewReader(cbor))
+	require.NoError(t, err)
+	assert.Equal(t, cbor, (<-received).Payload())
+	assert.Equal(t, AppCBOR, resp.Option(ContentFormat))
+
+	_, err = co.Post("/sensor", AppJSON, bytes.NewReader([]byte(`{"set":`)))
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, BadRequest, code)
+}
@@ -0,0 +1,51 @@
+package coap
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// PayloadCRCOf returns CRC-32C of payload, the value of PayloadCRC option.
+func PayloadCRCOf(payload []byte) uint32 {
+	return crc32.Checksum(payload, castagnoliTable)
+}
+
+// SetPayloadCRC sets PayloadCRC option of msg by its payload, so corruption of payload on lossy link
+// which isn't caught by UDP checksum is detected by ValidateCRC. It must be called after the payload is set,
+// payload exceeding block size must not be covered, as blocks carry parts of it.
+func SetPayloadCRC(msg Message) {
+	msg.SetOption(PayloadCRC, PayloadCRCOf(msg.Payload()))
+}
+
+// ValidateCRC checks payload of msg against its PayloadCRC option, message without the option is valid.
+func ValidateCRC(msg Message) error {
+	v := msg.Option(PayloadCRC)
+	if v == nil {
+		return nil
+	}
+	crc, ok := optionUint(v)
+	if !ok {
+		return fmt.Errorf("%w: invalid option value %v", ErrPayloadCRCMismatch, v)
+	}
+	if actual := PayloadCRCOf(msg.Payload()); actual != crc {
+		return fmt.Errorf("%w: expected %08x, payload has %08x", ErrPayloadCRCMismatch, crc, actual)
+	}
+	return nil
+}
+
+// rejectCorruptedPayload answers request whose payload doesn't match CRC by 4.00 Bad Request.
+func (srv *Server) rejectCorruptedPayload(w ResponseWriter, r *Request) bool {
+	if !srv.CRCValidation || r.Msg.Code() == Empty || r.Msg.Code() >= Created {
+		return false
+	}
+	err := ValidateCRC(r.Msg)
+	if err == nil {
+		return false
+	}
+	w.SetCode(BadRequest)
+	w.SetContentFormat(TextPlain)
+	w.Write([]byte(err.Error()))
+	return true
+}
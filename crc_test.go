@@ -0,0 +1,63 @@
+package coap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCRC(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: PUT, MessageID: 1, Payload: []byte("temperature=21.5")})
+	assert.NoError(t, ValidateCRC(msg))
+	SetPayloadCRC(msg)
+	require.NoError(t, ValidateCRC(msg))
+
+	var buf bytes.Buffer
+	require.NoError(t, msg.MarshalBinary(&buf))
+	data := buf.Bytes()
+	parsed, err := ParseDgramMessage(data)
+	require.NoError(t, err)
+	require.NoError(t, ValidateCRC(parsed))
+
+	// bit flip in the last byte of payload
+	data[len(data)-1] ^= 0x01
+	corrupted, err := ParseDgramMessage(data)
+	require.NoError(t, err)
+	err = ValidateCRC(corrupted)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrPayloadCRCMismatch))
+}
+
+func TestServerCRCValidation(t *testing.T) {
+	s := &Server{
+		CRCValidation: true,
+		Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+			w.SetCode(Changed)
+			w.Write(nil)
+		}),
+	}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	req, err := co.NewPutRequest("/a", TextPlain, bytes.NewReader([]byte("on")))
+	require.NoError(t, err)
+	SetPayloadCRC(req)
+	resp, err := co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, Changed, resp.Code())
+
+	req, err = co.NewPutRequest("/a", TextPlain, bytes.NewReader([]byte("on")))
+	require.NoError(t, err)
+	SetPayloadCRC(req)
+	req.SetPayload([]byte("of"))
+	resp, err = co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, BadRequest, resp.Code())
+	assert.Contains(t, string(resp.Payload()), ErrPayloadCRCMismatch.Error())
+}
@@ -0,0 +1,92 @@
+package coap
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// SecureDeduplicationCache detects duplicate messages (retransmissions) for EXCHANGE_LIFETIME.
+//
+// Threat model: cache keyed by plain (message ID, peer address) can be abused by an attacker
+// who spoofs the victim's address and sends a message with the victim's next message ID,
+// so the legitimate message is dropped as a duplicate. SecureDeduplicationCache keys entries
+// by HMAC-SHA256 of (message ID || peer address || session ID) with a server-side secret.
+// The session ID should identify the security context of the peer (eg. DTLS session),
+// so a spoofed datagram which doesn't belong to the victim's session can never collide
+// with the victim's entries, and the attacker can't precompute or probe the keys without the secret.
+// Spoofing within the same session is prevented by DTLS itself.
+type SecureDeduplicationCache struct {
+	secret []byte
+	ttl    time.Duration
+
+	lock      sync.Mutex
+	entries   map[[sha256.Size]byte]time.Time
+	lastSweep time.Time
+}
+
+// NewSecureDeduplicationCache creates cache with entries living for ttl (DefaultExchangeLifetime when 0).
+// When secret is nil, random secret is generated.
+func NewSecureDeduplicationCache(secret []byte, ttl time.Duration) (*SecureDeduplicationCache, error) {
+	if secret == nil {
+		secret = make([]byte, sha256.Size)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	if ttl == 0 {
+		ttl = DefaultExchangeLifetime
+	}
+	return &SecureDeduplicationCache{
+		secret:    secret,
+		ttl:       ttl,
+		entries:   make(map[[sha256.Size]byte]time.Time),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+func (c *SecureDeduplicationCache) key(messageID uint16, peer string, sessionID []byte) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, c.secret)
+	var buf [4]byte
+	binary.BigEndian.PutUint16(buf[:2], messageID)
+	mac.Write(buf[:2])
+	// length prefixes keep fields unambiguous
+	binary.BigEndian.PutUint32(buf[:], uint32(len(peer)))
+	mac.Write(buf[:])
+	mac.Write([]byte(peer))
+	mac.Write(sessionID)
+	var k [sha256.Size]byte
+	copy(k[:], mac.Sum(nil))
+	return k
+}
+
+// IsDuplicate reports whether message was already seen within ttl, otherwise it records the message.
+func (c *SecureDeduplicationCache) IsDuplicate(messageID uint16, peer string, sessionID []byte) bool {
+	k := c.key(messageID, peer, sessionID)
+	now := time.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if now.Sub(c.lastSweep) > c.ttl {
+		for key, expires := range c.entries {
+			if now.After(expires) {
+				delete(c.entries, key)
+			}
+		}
+		c.lastSweep = now
+	}
+	if expires, ok := c.entries[k]; ok && now.Before(expires) {
+		return true
+	}
+	c.entries[k] = now.Add(c.ttl)
+	return false
+}
+
+// Len returns count of entries in cache including expired ones which were not swept yet.
+func (c *SecureDeduplicationCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,48 @@
+package coap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSecureDeduplicationCacheSessions(t *testing.T) {
+	c, err := NewSecureDeduplicationCache(nil, time.Minute)
+	if err != nil {
+		t.Fatalf("cannot create cache: %v", err)
+	}
+	peer := "127.0.0.1:5684"
+	sessionA := []byte("session-a")
+	sessionB := []byte("session-b")
+
+	if c.IsDuplicate(42, peer, sessionA) {
+		t.Fatalf("first message of session A is not duplicate")
+	}
+	// same message ID and address from other DTLS session must not suppress message of session A
+	if c.IsDuplicate(42, peer, sessionB) {
+		t.Fatalf("message of session B was reported as duplicate of session A")
+	}
+	if !c.IsDuplicate(42, peer, sessionA) {
+		t.Fatalf("retransmission of session A was not detected")
+	}
+	if !c.IsDuplicate(42, peer, sessionB) {
+		t.Fatalf("retransmission of session B was not detected")
+	}
+	if c.IsDuplicate(43, peer, sessionA) {
+		t.Fatalf("other message ID was reported as duplicate")
+	}
+}
+
+func TestSecureDeduplicationCacheExpiration(t *testing.T) {
+	c, err := NewSecureDeduplicationCache([]byte("secret"), time.Millisecond*20)
+	if err != nil {
+		t.Fatalf("cannot create cache: %v", err)
+	}
+	c.IsDuplicate(1, "peer", nil)
+	time.Sleep(time.Millisecond * 50)
+	if c.IsDuplicate(1, "peer", nil) {
+		t.Fatalf("expired entry was reported as duplicate")
+	}
+	if c.Len() != 1 {
+		t.Fatalf("expired entries were not swept: %v", c.Len())
+	}
+}
@@ -0,0 +1,93 @@
+package coap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// AllCoAPNodesIPv4 is IPv4 multicast address of All CoAP Nodes (RFC 7252 section 12.8).
+const AllCoAPNodesIPv4 = "224.0.1.187:5683"
+
+// AllCoAPNodesIPv6 is link-local IPv6 multicast address of All CoAP Nodes (RFC 7252 section 12.8).
+const AllCoAPNodesIPv6 = "[ff02::fd]:5683"
+
+// WellKnownCorePath is path of resource discovery (RFC 6690 section 4).
+const WellKnownCorePath = "/.well-known/core"
+
+// DefaultDiscoveryWindow is time of collecting responses when window of discovery is not set.
+const DefaultDiscoveryWindow = 2 * time.Second
+
+// DiscoverDevices sends NON GET of WellKnownCorePath to the multicast group and collects responses
+// for window. See DiscoverDevicesMsgWithContext.
+func (mconn *MulticastClientConn) DiscoverDevices(window time.Duration, onDevice func(addr net.Addr, resp *Request)) error {
+	return mconn.DiscoverDevicesWithContext(context.Background(), window, onDevice)
+}
+
+// DiscoverDevicesWithContext sends with context NON GET of WellKnownCorePath to the multicast group
+// and collects responses for window. See DiscoverDevicesMsgWithContext.
+func (mconn *MulticastClientConn) DiscoverDevicesWithContext(ctx context.Context, window time.Duration, onDevice func(addr net.Addr, resp *Request)) error {
+	req, err := mconn.NewGetRequest(WellKnownCorePath)
+	if err != nil {
+		return err
+	}
+	return mconn.DiscoverDevicesMsgWithContext(ctx, req, window, onDevice)
+}
+
+// DiscoverDevicesMsg sends GET request req, eg. with rt query, to the multicast group and collects
+// responses for window. See DiscoverDevicesMsgWithContext.
+func (mconn *MulticastClientConn) DiscoverDevicesMsg(req Message, window time.Duration, onDevice func(addr net.Addr, resp *Request)) error {
+	return mconn.DiscoverDevicesMsgWithContext(context.Background(), req, window, onDevice)
+}
+
+// DiscoverDevicesMsgWithContext sends GET request req as NON to the multicast group and collects
+// responses for window (DefaultDiscoveryWindow when 0). onDevice is called once for every responder
+// with its address, further responses of the same address are dropped. resp.Client is unicast
+// connection to the responder, follow up requests can be sent by it.
+//
+// It blocks until window elapses, it returns error of ctx when it's done earlier.
+func (mconn *MulticastClientConn) DiscoverDevicesMsgWithContext(ctx context.Context, req Message, window time.Duration, onDevice func(addr net.Addr, resp *Request)) error {
+	if req.Code() != GET || req.PathString() == "" {
+		return ErrInvalidRequest
+	}
+	if window == 0 {
+		window = DefaultDiscoveryWindow
+	}
+	req.SetType(NonConfirmable)
+
+	var lock sync.Mutex
+	responders := make(map[string]bool)
+	err := mconn.client.multicastHandler.Add(req.Token(), func(w ResponseWriter, r *Request) {
+		switch r.Msg.Code() {
+		case GET, POST, PUT, DELETE:
+			//dont serve commands by multicast handler (filter own request)
+			return
+		}
+		addr := r.Client.RemoteAddr()
+		lock.Lock()
+		seen := responders[addr.String()]
+		responders[addr.String()] = true
+		lock.Unlock()
+		if seen {
+			return
+		}
+		onDevice(addr, &Request{Msg: r.Msg, Client: r.Client, Ctx: ctx, Sequence: r.Client.Sequence()})
+	})
+	if err != nil {
+		return err
+	}
+	defer mconn.client.multicastHandler.Remove(req.Token())
+
+	if err := mconn.WriteMsgWithContext(ctx, req); err != nil {
+		return err
+	}
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
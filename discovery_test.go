@@ -0,0 +1,101 @@
+package coap
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMulticastDiscoverDevices(t *testing.T) {
+	addrMcast := "225.0.1.187:11112"
+	var lock sync.Mutex
+	var conns []*ClientConn
+	responder := Client{
+		Net: "udp4",
+		Handler: func(w ResponseWriter, r *Request) {
+			w.SetContentFormat(TextPlain)
+			w.Write([]byte("a"))
+		},
+	}
+	s, _, fin, err := RunLocalServerUDPWithHandler("udp4-mcast", addrMcast, false, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		assert.Equal(t, NonConfirmable, r.Msg.Type())
+		assert.Equal(t, "rt=sensor", r.Msg.QueryString())
+		// request may arrive by several interfaces, device responds from one address
+		lock.Lock()
+		if len(conns) == 0 {
+			conn, err := responder.Dial(r.Client.RemoteAddr().String())
+			if !assert.NoError(t, err) {
+				lock.Unlock()
+				return
+			}
+			conns = append(conns, conn)
+		}
+		conn := conns[0]
+		lock.Unlock()
+		// duplicate responses are delivered once
+		for i := 0; i < 2; i++ {
+			resp := conn.NewMessage(MessageParams{
+				Type:      NonConfirmable,
+				Code:      Content,
+				MessageID: r.Msg.MessageID() + uint16(i),
+				Token:     r.Msg.Token(),
+				Payload:   []byte("</a>;rt=sensor"),
+			})
+			resp.SetOption(ContentFormat, AppLinkFormat)
+			assert.NoError(t, conn.WriteMsg(resp))
+		}
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		lock.Lock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		lock.Unlock()
+		<-fin
+	}()
+
+	c := MulticastClient{Net: "udp4"}
+	co, err := c.Dial(addrMcast)
+	require.NoError(t, err)
+	defer co.Close()
+
+	req, err := co.NewGetRequest(WellKnownCorePath)
+	require.NoError(t, err)
+	req.SetQueryString("rt=sensor")
+	var devices []*Request
+	var addrs []net.Addr
+	err = co.DiscoverDevicesMsg(req, time.Millisecond*500, func(addr net.Addr, resp *Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		addrs = append(addrs, addr)
+		devices = append(devices, resp)
+	})
+	require.NoError(t, err)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, devices, 1)
+	assert.Equal(t, addrs[0].String(), devices[0].Client.RemoteAddr().String())
+	assert.Equal(t, []byte("</a>;rt=sensor"), devices[0].Msg.Payload())
+
+	// unicast follow up
+	resp, err := devices[0].Client.Get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a"), resp.Payload())
+}
+
+func TestMulticastDiscoverDevicesInvalidRequest(t *testing.T) {
+	c := MulticastClient{Net: "udp4"}
+	co, err := c.Dial("225.0.1.187:11113")
+	require.NoError(t, err)
+	defer co.Close()
+	req := co.NewMessage(MessageParams{Type: NonConfirmable, Code: POST, MessageID: 1, Token: []byte{1}})
+	req.SetPathString(WellKnownCorePath)
+	assert.Equal(t, ErrInvalidRequest, co.DiscoverDevicesMsg(req, time.Millisecond, func(net.Addr, *Request) {}))
+}
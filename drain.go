@@ -0,0 +1,150 @@
+package coap
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// drainState tracks sessions and requests in flight, so server can drain them.
+type drainState struct {
+	draining int32
+
+	lock     sync.Mutex
+	conns    map[networkSession]struct{} // TCP and DTLS sessions, UDP ones are in sessionUDPMap
+	inFlight map[networkSession]int
+}
+
+func (d *drainState) addConn(s networkSession) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.conns == nil {
+		d.conns = make(map[networkSession]struct{})
+	}
+	d.conns[s] = struct{}{}
+}
+
+func (d *drainState) removeConn(s networkSession) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.conns, s)
+}
+
+func (d *drainState) begin(s networkSession) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.inFlight == nil {
+		d.inFlight = make(map[networkSession]int)
+	}
+	d.inFlight[s]++
+}
+
+func (d *drainState) end(s networkSession) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.inFlight[s]--; d.inFlight[s] <= 0 {
+		delete(d.inFlight, s)
+	}
+}
+
+func (d *drainState) busy() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.inFlight) > 0
+}
+
+// sessions returns all sessions of server, idle are ones without request in flight.
+func (srv *Server) sessions() (all []networkSession, idle []networkSession) {
+	srv.sessionUDPMapLock.Lock()
+	for _, s := range srv.sessionUDPMap {
+		all = append(all, s)
+	}
+	srv.sessionUDPMapLock.Unlock()
+	srv.drain.lock.Lock()
+	defer srv.drain.lock.Unlock()
+	for s := range srv.drain.conns {
+		all = append(all, s)
+	}
+	for _, s := range all {
+		if srv.drain.inFlight[s] == 0 {
+			idle = append(idle, s)
+		}
+	}
+	return all, idle
+}
+
+// release asks peer of session to stop using it, by Reset for datagram sessions or by Release signal for TCP ones.
+func (srv *Server) release(s networkSession) {
+	msg := s.NewMessage(MessageParams{Type: Reset, Code: Empty, MessageID: GenerateMessageID()})
+	if s.IsTCP() {
+		msg = s.NewMessage(MessageParams{Code: Release})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), srv.writeTimeout())
+	defer cancel()
+	s.WriteMsgWithContext(ctx, msg)
+	s.Close()
+}
+
+// Draining returns true after BeginDrain was called.
+func (srv *Server) Draining() bool {
+	return atomic.LoadInt32(&srv.drain.draining) == 1
+}
+
+// BeginDrain prepares server for shutdown behind load balancer. Responses get ServerDraining option,
+// idle sessions are reset and closed, and it waits up to maxWait for handlers in flight. Then remaining
+// sessions are closed and ErrDrainTimeout is returned when handlers didn't finish. Server keeps serving
+// new requests until Shutdown is called.
+func (srv *Server) BeginDrain(maxWait time.Duration) error {
+	atomic.StoreInt32(&srv.drain.draining, 1)
+	_, idle := srv.sessions()
+	for _, s := range idle {
+		srv.release(s)
+	}
+
+	var err error
+	deadline := time.Now().Add(maxWait)
+	for srv.drain.busy() {
+		if time.Now().After(deadline) {
+			err = ErrDrainTimeout
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	all, _ := srv.sessions()
+	for _, s := range all {
+		s.Close()
+	}
+	return err
+}
+
+// drainingResponseWriter sets ServerDraining option of responses written while server drains.
+type drainingResponseWriter struct {
+	ResponseWriter
+	srv *Server
+}
+
+func (w *drainingResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *drainingResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *drainingResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *drainingResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	if w.srv.Draining() {
+		msg.SetOption(ServerDraining, 1)
+	}
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+func (w *drainingResponseWriter) WriteError(err error) {
+	writeError(w, err)
+}
@@ -0,0 +1,99 @@
+package coap
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerBeginDrain(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	s := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Msg.PathString() == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+		w.SetCode(Content)
+		w.Write(nil)
+	})}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	slow, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer slow.Close()
+	idle, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	defer idle.Close()
+	var buf bytes.Buffer
+	require.NoError(t, NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1}).MarshalBinary(&buf))
+	_, err = idle.Write(buf.Bytes())
+	require.NoError(t, err)
+	b := make([]byte, 1500)
+	_, err = idle.Read(b)
+	require.NoError(t, err)
+
+	slowResp := make(chan Message, 1)
+	go func() {
+		resp, err := slow.Get("/slow")
+		assert.NoError(t, err)
+		slowResp <- resp
+	}()
+	<-started
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- s.BeginDrain(time.Second * 2)
+	}()
+	// idle session is reset
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := idle.Read(b)
+	require.NoError(t, err)
+	rst, err := ParseDgramMessage(b[:n])
+	require.NoError(t, err)
+	assert.Equal(t, Reset, rst.Type())
+	assert.True(t, s.Draining())
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+	resp, err := co.Get("/fast")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), resp.Option(ServerDraining))
+
+	close(release)
+	require.NoError(t, <-drained)
+	resp = <-slowResp
+	require.NotNil(t, resp)
+	assert.Equal(t, uint32(1), resp.Option(ServerDraining))
+}
+
+func TestServerBeginDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{}, 1)
+	s := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		started <- struct{}{}
+		<-release
+	})}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+	go co.Get("/stuck")
+	<-started
+
+	start := time.Now()
+	assert.Equal(t, ErrDrainTimeout, s.BeginDrain(time.Millisecond*100))
+	assert.True(t, time.Since(start) < time.Second)
+	s.sessionUDPMapLock.Lock()
+	assert.Empty(t, s.sessionUDPMap)
+	s.sessionUDPMapLock.Unlock()
+}
@@ -0,0 +1,164 @@
+package coap
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// DefaultEchoTTL is default lifetime of Echo challenges and of client address validation.
+const DefaultEchoTTL = 5 * time.Minute
+
+// DefaultEchoMaxChallenges is count of pending challenges kept by MemoryEchoTokenStore by default.
+const DefaultEchoMaxChallenges = 10000
+
+// echoChallengeSize is size of generated Echo value.
+const echoChallengeSize = 8
+
+// EchoTokenStore keeps Echo challenges (RFC 9175) bound to client addresses.
+type EchoTokenStore interface {
+	// Challenge generates new Echo value for client address.
+	Challenge(addr string) ([]byte, error)
+	// Verify reports whether echo is valid challenge of client address. Verified
+	// challenge is consumed and client address becomes validated.
+	Verify(addr string, echo []byte) bool
+	// Validated reports whether client address was validated recently.
+	Validated(addr string) bool
+}
+
+type echoEntry struct {
+	addr    string
+	value   []byte
+	expires time.Time
+}
+
+// MemoryEchoTokenStore is EchoTokenStore which keeps challenges in memory.
+// Up to MaxChallenges pending challenges are kept, the oldest one is evicted then
+// and its client has to repeat request to get new challenge.
+type MemoryEchoTokenStore struct {
+	// MaxChallenges bounds count of pending challenges, eg. when source addresses are spoofed.
+	// It must be set before the store is used, default is DefaultEchoMaxChallenges.
+	MaxChallenges int
+
+	ttl time.Duration
+
+	lock       sync.Mutex
+	challenges map[string]*list.Element // of *echoEntry
+	order      *list.List               // the newest challenge is at front
+	validated  map[string]time.Time
+}
+
+// NewMemoryEchoTokenStore creates in memory Echo token store, challenges and validations
+// expire after ttl (DefaultEchoTTL when 0).
+func NewMemoryEchoTokenStore(ttl time.Duration) *MemoryEchoTokenStore {
+	if ttl == 0 {
+		ttl = DefaultEchoTTL
+	}
+	return &MemoryEchoTokenStore{
+		ttl:        ttl,
+		challenges: make(map[string]*list.Element),
+		order:      list.New(),
+		validated:  make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryEchoTokenStore) maxChallenges() int {
+	if s.MaxChallenges > 0 {
+		return s.MaxChallenges
+	}
+	return DefaultEchoMaxChallenges
+}
+
+func (s *MemoryEchoTokenStore) removeChallenge(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.challenges, el.Value.(*echoEntry).addr)
+}
+
+func (s *MemoryEchoTokenStore) sweep(now time.Time) {
+	// challenges share ttl, so the oldest ones expire first
+	for el := s.order.Back(); el != nil && now.After(el.Value.(*echoEntry).expires); el = s.order.Back() {
+		s.removeChallenge(el)
+	}
+	for addr, expires := range s.validated {
+		if now.After(expires) {
+			delete(s.validated, addr)
+		}
+	}
+}
+
+// Challenge generates new Echo value for client address, previous challenge is replaced.
+func (s *MemoryEchoTokenStore) Challenge(addr string) ([]byte, error) {
+	v := make([]byte, echoChallengeSize)
+	if _, err := rand.Read(v); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sweep(now)
+	if el, ok := s.challenges[addr]; ok {
+		s.removeChallenge(el)
+	}
+	for s.order.Len() >= s.maxChallenges() {
+		s.removeChallenge(s.order.Back())
+	}
+	s.challenges[addr] = s.order.PushFront(&echoEntry{addr: addr, value: v, expires: now.Add(s.ttl)})
+	return v, nil
+}
+
+// Verify checks echo of client address.
+func (s *MemoryEchoTokenStore) Verify(addr string, echo []byte) bool {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	el, ok := s.challenges[addr]
+	if !ok {
+		return false
+	}
+	e := el.Value.(*echoEntry)
+	if now.After(e.expires) || !bytes.Equal(e.value, echo) {
+		return false
+	}
+	s.removeChallenge(el)
+	s.validated[addr] = now.Add(s.ttl)
+	return true
+}
+
+// Validated reports whether client address was validated within ttl.
+func (s *MemoryEchoTokenStore) Validated(addr string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	expires, ok := s.validated[addr]
+	return ok && time.Now().Before(expires)
+}
+
+// EchoMiddleware verifies freshness of requests and address of clients by Echo option (RFC 9175).
+// Request of client which address is not validated gets 4.01 Unauthorized with Echo challenge
+// bound to the client address. Client repeats request with the Echo value and when it matches,
+// the address is validated and the request is processed.
+func EchoMiddleware(tokenStore EchoTokenStore) MiddlewareFunc {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			addr := r.Client.RemoteAddr().String()
+			if echo, ok := r.Msg.Option(Echo).([]byte); ok && tokenStore.Verify(addr, echo) {
+				next.ServeCOAP(w, r)
+				return
+			}
+			if tokenStore.Validated(addr) {
+				next.ServeCOAP(w, r)
+				return
+			}
+			challenge, err := tokenStore.Challenge(addr)
+			if err != nil {
+				w.SetCode(InternalServerError)
+				w.Write(nil)
+				return
+			}
+			resp := w.NewResponse(Unauthorized)
+			resp.SetOption(Echo, challenge)
+			w.WriteMsg(resp)
+		})
+	}
+}
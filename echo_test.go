@@ -0,0 +1,92 @@
+package coap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEchoMiddleware(t *testing.T) {
+	h := EchoMiddleware(NewMemoryEchoTokenStore(time.Minute))(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetCode(Content)
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("hello"))
+	}))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, h.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	get := func(co *ClientConn, echo []byte) Message {
+		req, err := co.NewGetRequest("/a")
+		require.NoError(t, err)
+		if echo != nil {
+			req.SetOption(Echo, echo)
+		}
+		resp, err := co.Exchange(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+	resp := get(co, nil)
+	require.Equal(t, Unauthorized, resp.Code())
+	echo, ok := resp.Option(Echo).([]byte)
+	require.True(t, ok)
+	require.NotEmpty(t, echo)
+
+	// replay of the challenge from different address
+	other, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer other.Close()
+	resp = get(other, echo)
+	require.Equal(t, Unauthorized, resp.Code())
+
+	resp = get(co, echo)
+	require.Equal(t, Content, resp.Code())
+	require.Equal(t, []byte("hello"), resp.Payload())
+
+	// address is validated
+	resp = get(co, nil)
+	require.Equal(t, Content, resp.Code())
+}
+
+func TestMemoryEchoTokenStoreExpires(t *testing.T) {
+	s := NewMemoryEchoTokenStore(time.Millisecond * 10)
+	echo, err := s.Challenge("a")
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 20)
+	require.False(t, s.Verify("a", echo))
+
+	echo, err = s.Challenge("a")
+	require.NoError(t, err)
+	require.True(t, s.Verify("a", echo))
+	require.False(t, s.Verify("a", echo))
+	require.True(t, s.Validated("a"))
+	time.Sleep(time.Millisecond * 20)
+	require.False(t, s.Validated("a"))
+}
+
+func TestMemoryEchoTokenStoreMaxChallenges(t *testing.T) {
+	s := NewMemoryEchoTokenStore(time.Minute)
+	s.MaxChallenges = 2
+	a, err := s.Challenge("a")
+	require.NoError(t, err)
+	b, err := s.Challenge("b")
+	require.NoError(t, err)
+	_, err = s.Challenge("b")
+	require.NoError(t, err)
+	require.Len(t, s.challenges, 2)
+	c, err := s.Challenge("c")
+	require.NoError(t, err)
+	require.Len(t, s.challenges, 2)
+
+	require.False(t, s.Verify("a", a), "the oldest challenge must be evicted")
+	require.False(t, s.Verify("b", b), "replaced challenge must not be valid")
+	require.True(t, s.Verify("c", c))
+}
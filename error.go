@@ -92,6 +92,9 @@ const ErrInvalidBlockWiseSzx = Error("invalid block-wise transfer szx")
 // ErrRequestEntityIncomplete payload comes in bad order
 const ErrRequestEntityIncomplete = Error("payload comes in bad order")
 
+// ErrInvalidRequestTag block of block-wise transfer has different Request-Tag than the first block
+const ErrInvalidRequestTag = Error("block has invalid Request-Tag")
+
 // ErrInvalidRequest invalid requests
 const ErrInvalidRequest = Error("invalid request")
 
@@ -109,3 +112,84 @@ const ErrMessageNotInterested = Error("message not to be sent due to disinterest
 
 // ErrMaxMessageSizeLimitExceeded message size bigger thab maximum message size limit
 const ErrMaxMessageSizeLimitExceeded = Error("maximum message size limit exceeded")
+
+// ErrNoRecordedInteraction request has no recorded interaction for playback
+const ErrNoRecordedInteraction = Error("no recorded interaction for request")
+
+// ErrMessageIDInUse generated message ID is used for the peer within exchange lifetime
+const ErrMessageIDInUse = Error("message ID is in use")
+
+// ErrNotFound requested resource doesn't exist, DefaultErrorMapper maps it to 4.04 Not Found
+const ErrNotFound = Error("not found")
+
+// ErrPermission request isn't permitted, DefaultErrorMapper maps it to 4.03 Forbidden
+const ErrPermission = Error("permission denied")
+
+// ErrInvalidCompressedPath compressed path has unknown version or prefix code
+const ErrInvalidCompressedPath = Error("invalid compressed path")
+
+// ErrBlockNotAvailable requested block precedes data already read from stream
+const ErrBlockNotAvailable = Error("block is not available")
+
+// ErrInvalidMultipart payload is not valid application/multipart-core
+const ErrInvalidMultipart = Error("invalid multipart-core payload")
+
+// ErrDrainTimeout handlers didn't finish before drain of server timed out
+const ErrDrainTimeout = Error("handlers didn't finish in time of drain")
+
+// ErrMinimalAgreement message doesn't match agreement of minimal encoding
+const ErrMinimalAgreement = Error("message doesn't match minimal encoding agreement")
+
+// ErrPluginAlreadyRegistered plugin of the same name is registered already
+const ErrPluginAlreadyRegistered = Error("plugin is already registered")
+
+// ErrPluginNotRegistered plugin of the name is not registered
+const ErrPluginNotRegistered = Error("plugin is not registered")
+
+// ErrSessionNotFound server has no session of the address
+const ErrSessionNotFound = Error("session not found")
+
+// ErrTooManyRedirects server redirected request more times than allowed
+const ErrTooManyRedirects = Error("too many redirects")
+
+// ErrSchemeNotAllowed redirect points to scheme which client doesn't upgrade to
+const ErrSchemeNotAllowed = Error("scheme of redirect is not allowed")
+
+// ErrOptionsNotOrdered options of message are not in ascending order of option number
+const ErrOptionsNotOrdered = Error("options are not in ascending order")
+
+// ErrPayloadCRCMismatch payload of message doesn't match its PayloadCRC option
+const ErrPayloadCRCMismatch = Error("payload doesn't match CRC")
+
+// ErrOSCOREInvalidContext IDs of OSCORE security context are too long
+const ErrOSCOREInvalidContext = Error("invalid OSCORE security context")
+
+// ErrOSCOREContextNotFound no OSCORE security context matches kid of message
+const ErrOSCOREContextNotFound = Error("security context not found")
+
+// ErrOSCOREInvalidOption message has invalid value of OSCORE option
+const ErrOSCOREInvalidOption = Error("invalid OSCORE option")
+
+// ErrOSCOREUnprotected message is not protected by OSCORE
+const ErrOSCOREUnprotected = Error("message is not protected by OSCORE")
+
+// ErrOSCOREDecryptionFailed message protected by OSCORE cannot be decrypted
+const ErrOSCOREDecryptionFailed = Error("decryption failed")
+
+// ErrOSCOREReplay message protected by OSCORE was received already
+const ErrOSCOREReplay = Error("replay detected")
+
+// ErrOSCORESequenceExhausted sender sequence number of OSCORE security context is exhausted
+const ErrOSCORESequenceExhausted = Error("OSCORE sender sequence number exhausted")
+
+// ErrBlockWiseRepresentationChanged ETag of resource changed during block-wise transfer
+const ErrBlockWiseRepresentationChanged = Error("representation changed during block-wise transfer")
+
+// ErrInvalidProxyURI Proxy-Uri or Proxy-Scheme with Uri-Host option of request is not valid
+const ErrInvalidProxyURI = Error("invalid proxy URI")
+
+// ErrProxySchemeNotSupported scheme of proxy request is not supported by proxy
+const ErrProxySchemeNotSupported = Error("scheme is not supported by proxy")
+
+// ErrShortBuffer buffer is too short for message
+const ErrShortBuffer = Error("buffer is too short for message")
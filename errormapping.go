@@ -0,0 +1,60 @@
+package coap
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorMapper chooses response code for error written by ResponseWriter.WriteError.
+type ErrorMapper func(err error) COAPCode
+
+// DefaultErrorMapper maps ErrNotFound to 4.04 Not Found, ErrPermission to 4.03 Forbidden and
+// context.DeadlineExceeded to 5.03 Service Unavailable. CoAPError gets its code, other errors
+// get 5.00 Internal Server Error.
+func DefaultErrorMapper(err error) COAPCode {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return NotFound
+	case errors.Is(err, ErrPermission):
+		return Forbidden
+	case errors.Is(err, context.DeadlineExceeded):
+		return ServiceUnavailable
+	}
+	if code, ok := ResponseCode(err); ok {
+		return code
+	}
+	return InternalServerError
+}
+
+// writeError sends response with code carried by err, InternalServerError for other errors.
+func writeError(w ResponseWriter, err error) {
+	code, ok := ResponseCode(err)
+	if !ok {
+		code = InternalServerError
+	}
+	w.SetCode(code)
+	w.Write(nil)
+}
+
+type errorMappingResponseWriter struct {
+	ResponseWriter
+	mapper ErrorMapper
+}
+
+func (w *errorMappingResponseWriter) WriteError(err error) {
+	w.SetCode(w.mapper(err))
+	w.Write(nil)
+}
+
+// NewErrorMappingMiddleware sends errors written by handler via ResponseWriter.WriteError with code
+// chosen by mapper. Nil mapper means DefaultErrorMapper.
+func NewErrorMappingMiddleware(mapper ErrorMapper) MiddlewareFunc {
+	if mapper == nil {
+		mapper = DefaultErrorMapper
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			next.ServeCOAP(&errorMappingResponseWriter{ResponseWriter: w, mapper: mapper}, r)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorMappingMiddleware(t *testing.T) {
+	errs := map[string]error{
+		"/missing":  ErrNotFound,
+		"/denied":   fmt.Errorf("open door: %w", ErrPermission),
+		"/slow":     context.DeadlineExceeded,
+		"/conflict": &CoAPError{Code: Conflict},
+		"/other":    fmt.Errorf("other"),
+	}
+	handler := NewErrorMappingMiddleware(nil)(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteError(errs["/"+r.Msg.PathString()])
+	}))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, handler.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	for path, want := range map[string]COAPCode{
+		"/missing":  NotFound,
+		"/denied":   Forbidden,
+		"/slow":     ServiceUnavailable,
+		"/conflict": Conflict,
+		"/other":    InternalServerError,
+	} {
+		_, err := co.Get(path)
+		code, ok := ResponseCode(err)
+		require.True(t, ok, path)
+		assert.Equal(t, want, code, path)
+	}
+}
+
+func TestResponseWriterWriteError(t *testing.T) {
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.WriteError(ErrNotFound)
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	// without middleware plain errors are internal server errors
+	_, err = co.Get("/a")
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, InternalServerError, code)
+}
@@ -0,0 +1,152 @@
+package coap
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+type handlerTimeoutKey struct{}
+
+// handlerTimeout cancels context of request and answers it by 5.03 Service Unavailable when handler
+// doesn't respond in time.
+type handlerTimeout struct {
+	w      ResponseWriter
+	cancel context.CancelFunc
+	cause  *requestCancel // of request served by server, nil otherwise
+	start  time.Time
+
+	lock     sync.Mutex
+	timer    *time.Timer
+	written  bool
+	timedOut bool
+}
+
+func (t *handlerTimeout) fire() {
+	if t.cause != nil {
+		t.cause.setCause(TimedOut)
+	}
+	t.cancel()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.written {
+		return
+	}
+	t.timedOut = true
+	t.w.WriteMsgWithContext(context.Background(), t.w.NewResponse(ServiceUnavailable))
+}
+
+// reset replaces timeout, it's counted from start of handler.
+func (t *handlerTimeout) reset(timeout time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.timer.Stop() {
+		// timeout is over already
+		return
+	}
+	t.timer = time.AfterFunc(time.Until(t.start.Add(timeout)), t.fire)
+}
+
+func (t *handlerTimeout) stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.timer.Stop()
+	t.cancel()
+}
+
+// write reports whether response may be written, it fails after timeout.
+func (t *handlerTimeout) write() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.timedOut {
+		return ErrTimeout
+	}
+	t.written = true
+	return nil
+}
+
+type timeoutResponseWriter struct {
+	ResponseWriter
+	timeout *handlerTimeout
+}
+
+func (w *timeoutResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *timeoutResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *timeoutResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *timeoutResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	if err := w.timeout.write(); err != nil {
+		return err
+	}
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+func (w *timeoutResponseWriter) WriteError(err error) {
+	writeError(w, err)
+}
+
+func (w *timeoutResponseWriter) WriteReader(r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return w.WriteReaderWithContext(context.Background(), r, contentFormat, szx)
+}
+
+func (w *timeoutResponseWriter) WriteReaderWithContext(ctx context.Context, r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	if err := w.timeout.write(); err != nil {
+		return err
+	}
+	return w.ResponseWriter.WriteReaderWithContext(ctx, r, contentFormat, szx)
+}
+
+// serveWithTimeout serves r by h, context of request is cancelled after timeout and request
+// without response gets 5.03 Service Unavailable. Later responses of handler fail by ErrTimeout.
+func serveWithTimeout(h Handler, w ResponseWriter, r *Request, timeout time.Duration) {
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	t := &handlerTimeout{w: w, cancel: cancel, cause: requestCancelOf(ctx), start: time.Now()}
+	t.lock.Lock()
+	t.timer = time.AfterFunc(timeout, t.fire)
+	t.lock.Unlock()
+	defer t.stop()
+	h.ServeCOAP(&timeoutResponseWriter{ResponseWriter: w, timeout: t}, &Request{
+		Msg:      r.Msg,
+		Client:   r.Client,
+		Ctx:      context.WithValue(ctx, handlerTimeoutKey{}, t),
+		Sequence: r.Sequence,
+	})
+}
+
+type timeoutHandler struct {
+	h       Handler
+	timeout time.Duration
+}
+
+func (t *timeoutHandler) ServeCOAP(w ResponseWriter, r *Request) {
+	if r.Ctx != nil {
+		if ht, ok := r.Ctx.Value(handlerTimeoutKey{}).(*handlerTimeout); ok {
+			ht.reset(t.timeout)
+			t.h.ServeCOAP(w, r)
+			return
+		}
+	}
+	serveWithTimeout(t.h, w, r, t.timeout)
+}
+
+// TimeoutHandler serves requests by h with timeout. It replaces Server.HandlerTimeout, so it may
+// be longer or shorter. Context of request is cancelled when timeout is over and request gets
+// 5.03 Service Unavailable unless h has responded.
+func TimeoutHandler(h Handler, timeout time.Duration) Handler {
+	return &timeoutHandler{h: h, timeout: timeout}
+}
@@ -0,0 +1,57 @@
+package coap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeMuxHandleWithTimeout(t *testing.T) {
+	cancelled := make(chan bool, 3)
+	writeErrs := make(chan error, 3)
+	sleep := func(w ResponseWriter, r *Request) {
+		select {
+		case <-r.Ctx.Done():
+			cancelled <- true
+		case <-time.After(time.Millisecond * 300):
+			cancelled <- false
+		}
+		w.SetContentFormat(TextPlain)
+		_, err := w.Write([]byte("done"))
+		writeErrs <- err
+	}
+	mux := NewServeMux()
+	require.NoError(t, mux.HandleWithTimeout("/short", HandlerFunc(sleep), time.Millisecond*50))
+	require.NoError(t, mux.HandleWithTimeout("/long", HandlerFunc(sleep), time.Second))
+	mux.HandleFunc("/default", sleep)
+	addr, fin := runLocalUDPServer(t, &Server{Handler: mux, HandlerTimeout: time.Millisecond * 150})
+	defer fin()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	start := time.Now()
+	_, err = co.Get("/short")
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, ServiceUnavailable, code)
+	assert.True(t, time.Since(start) < time.Millisecond*150)
+	assert.True(t, <-cancelled)
+	assert.Equal(t, ErrTimeout, <-writeErrs)
+
+	// handler timeout is longer than server one
+	resp, err := co.Get("/long")
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(resp.Payload()))
+	assert.False(t, <-cancelled)
+	assert.NoError(t, <-writeErrs)
+
+	_, err = co.Get("/default")
+	code, ok = ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, ServiceUnavailable, code)
+	assert.True(t, <-cancelled)
+	assert.Equal(t, ErrTimeout, <-writeErrs)
+}
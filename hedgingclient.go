@@ -0,0 +1,179 @@
+package coap
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// HedgingClient sends a request to the first connection and when no response
+// arrives within HedgeDelay it sends the same request to the next connection.
+// The first successful response wins and the other requests are cancelled,
+// responses with error code (4.xx, 5.xx) are treated as failures of the replica.
+//
+// Only safe methods (GET, FETCH) are hedged by default, other requests are sent
+// just via the first connection.
+type HedgingClient struct {
+	Conns      []*ClientConn // replicas, first one is preferred
+	HedgeDelay time.Duration // delay before the request is sent to the next replica
+
+	// HedgeNonIdempotent enables hedging of non-idempotent methods (POST, PUT, ...) at caller's risk.
+	HedgeNonIdempotent bool
+}
+
+// NewHedgingClient creates hedging client over connections to replicas.
+func NewHedgingClient(conns []*ClientConn, hedgeDelay time.Duration) *HedgingClient {
+	return &HedgingClient{
+		Conns:      conns,
+		HedgeDelay: hedgeDelay,
+	}
+}
+
+func (c *HedgingClient) canHedge(code COAPCode) bool {
+	switch code {
+	case GET, FETCH:
+		return true
+	}
+	return c.HedgeNonIdempotent
+}
+
+// copyMessage creates copy of m for connection co, so every replica gets own message.
+func copyMessage(co *ClientConn, m Message) Message {
+	msg := co.NewMessage(MessageParams{
+		Type:      m.Type(),
+		Code:      m.Code(),
+		MessageID: m.MessageID(),
+		Token:     m.Token(),
+		Payload:   m.Payload(),
+	})
+	for _, o := range m.AllOptions() {
+		msg.AddOption(o.ID, o.Value)
+	}
+	return msg
+}
+
+type hedgingResult struct {
+	msg Message
+	err error
+}
+
+// Exchange same as ExchangeWithContext without context.
+func (c *HedgingClient) Exchange(m Message) (Message, error) {
+	return c.ExchangeWithContext(context.Background(), m)
+}
+
+// ExchangeWithContext performs a hedged synchronous query.
+func (c *HedgingClient) ExchangeWithContext(ctx context.Context, m Message) (Message, error) {
+	if len(c.Conns) == 0 {
+		return nil, ErrInvalidRequest
+	}
+	if len(c.Conns) == 1 || !c.canHedge(m.Code()) {
+		return c.Conns[0].ExchangeWithContext(ctx, m)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgingResult, len(c.Conns))
+	send := func(co *ClientConn) {
+		go func() {
+			resp, err := co.ExchangeWithContext(ctx, copyMessage(co, m))
+			results <- hedgingResult{msg: resp, err: err}
+		}()
+	}
+
+	timer := time.NewTimer(c.HedgeDelay)
+	defer timer.Stop()
+
+	send(c.Conns[0])
+	sent := 1
+	var last hedgingResult
+	for pending := 1; pending > 0; {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil && !isErrorCode(r.msg.Code()) {
+				return r.msg, nil
+			}
+			last = r
+			// replica failed - don't wait for delay
+			if sent < len(c.Conns) {
+				send(c.Conns[sent])
+				sent++
+				pending++
+			}
+		case <-timer.C:
+			if sent < len(c.Conns) {
+				send(c.Conns[sent])
+				sent++
+				pending++
+				timer.Reset(c.HedgeDelay)
+			}
+		}
+	}
+	// all replicas failed - return last error or error response
+	return last.msg, last.err
+}
+
+// Get retrieves the resource identified by the request path.
+func (c *HedgingClient) Get(path string) (Message, error) {
+	return c.GetWithContext(context.Background(), path)
+}
+
+// GetWithContext retrieves with context the resource identified by the request path.
+func (c *HedgingClient) GetWithContext(ctx context.Context, path string) (Message, error) {
+	return c.do(ctx, func(co *ClientConn) (Message, error) {
+		return co.NewGetRequest(path)
+	})
+}
+
+func (c *HedgingClient) do(ctx context.Context, newReq func(co *ClientConn) (Message, error)) (Message, error) {
+	if len(c.Conns) == 0 {
+		return nil, ErrInvalidRequest
+	}
+	req, err := newReq(c.Conns[0])
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.ExchangeWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, responseError(resp)
+}
+
+// Post updates the resource identified by the request path. It is hedged only with HedgeNonIdempotent.
+func (c *HedgingClient) Post(path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.PostWithContext(context.Background(), path, contentFormat, body)
+}
+
+// PostWithContext updates with context the resource identified by the request path.
+func (c *HedgingClient) PostWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.do(ctx, func(co *ClientConn) (Message, error) {
+		return co.NewPostRequest(path, contentFormat, body)
+	})
+}
+
+// Put creates the resource identified by the request path. It is hedged only with HedgeNonIdempotent.
+func (c *HedgingClient) Put(path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.PutWithContext(context.Background(), path, contentFormat, body)
+}
+
+// PutWithContext creates with context the resource identified by the request path.
+func (c *HedgingClient) PutWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.do(ctx, func(co *ClientConn) (Message, error) {
+		return co.NewPutRequest(path, contentFormat, body)
+	})
+}
+
+// Delete deletes the resource identified by the request path. It is hedged only with HedgeNonIdempotent.
+func (c *HedgingClient) Delete(path string) (Message, error) {
+	return c.DeleteWithContext(context.Background(), path)
+}
+
+// DeleteWithContext deletes with context the resource identified by the request path.
+func (c *HedgingClient) DeleteWithContext(ctx context.Context, path string) (Message, error) {
+	return c.do(ctx, func(co *ClientConn) (Message, error) {
+		return co.NewDeleteRequest(path)
+	})
+}
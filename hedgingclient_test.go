@@ -0,0 +1,134 @@
+package coap
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func runHedgingServer(t *testing.T, delay time.Duration, payload string) (*ClientConn, func()) {
+	return runHedgingServerWithCode(t, delay, Content, payload)
+}
+
+func runHedgingServerWithCode(t *testing.T, delay time.Duration, code COAPCode, payload string) (*ClientConn, func()) {
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		time.Sleep(delay)
+		w.SetCode(code)
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(payload))
+	})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	co, err := Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("unable to dialing: %v", err)
+	}
+	return co, func() {
+		co.Close()
+		s.Shutdown()
+		<-fin
+	}
+}
+
+func TestHedgingClientGet(t *testing.T) {
+	slow, closeSlow := runHedgingServer(t, time.Millisecond*200, "slow")
+	defer closeSlow()
+	fast, closeFast := runHedgingServer(t, 0, "fast")
+	defer closeFast()
+
+	c := NewHedgingClient([]*ClientConn{slow, fast}, time.Millisecond*50)
+	start := time.Now()
+	resp, err := c.Get("/a")
+	if err != nil {
+		t.Fatalf("unable to get: %v", err)
+	}
+	elapsed := time.Since(start)
+	if string(resp.Payload()) != "fast" {
+		t.Fatalf("unexpected payload: %s", resp.Payload())
+	}
+	if elapsed >= time.Millisecond*150 {
+		t.Fatalf("response arrived too late: %v", elapsed)
+	}
+}
+
+func TestHedgingClientSkipsErrorResponse(t *testing.T) {
+	unavailable, closeUnavailable := runHedgingServerWithCode(t, 0, ServiceUnavailable, "unavailable")
+	defer closeUnavailable()
+	slow, closeSlow := runHedgingServer(t, time.Millisecond*100, "slow")
+	defer closeSlow()
+
+	c := NewHedgingClient([]*ClientConn{unavailable, slow}, time.Millisecond*50)
+	resp, err := c.Get("/a")
+	if err != nil {
+		t.Fatalf("unable to get: %v", err)
+	}
+	if resp.Code() != Content || string(resp.Payload()) != "slow" {
+		t.Fatalf("unexpected response: %v %s", resp.Code(), resp.Payload())
+	}
+}
+
+func TestHedgingClientAllReplicasFail(t *testing.T) {
+	unavailable, closeUnavailable := runHedgingServerWithCode(t, 0, ServiceUnavailable, "unavailable")
+	defer closeUnavailable()
+	notFound, closeNotFound := runHedgingServerWithCode(t, time.Millisecond*20, NotFound, "not found")
+	defer closeNotFound()
+
+	c := NewHedgingClient([]*ClientConn{unavailable, notFound}, time.Millisecond*50)
+	req, err := unavailable.NewGetRequest("/a")
+	if err != nil {
+		t.Fatalf("unable to create request: %v", err)
+	}
+	resp, err := c.Exchange(req)
+	if err != nil {
+		t.Fatalf("unable to exchange: %v", err)
+	}
+	if resp.Code() != NotFound {
+		t.Fatalf("unexpected code: %v", resp.Code())
+	}
+}
+
+func TestHedgingClientPostIsNotHedged(t *testing.T) {
+	slow, closeSlow := runHedgingServer(t, time.Millisecond*200, "slow")
+	defer closeSlow()
+	fast, closeFast := runHedgingServer(t, 0, "fast")
+	defer closeFast()
+
+	c := NewHedgingClient([]*ClientConn{slow, fast}, time.Millisecond*50)
+	req := slow.NewMessage(MessageParams{
+		Type:      Confirmable,
+		Code:      POST,
+		MessageID: GenerateMessageID(),
+		Token:     []byte("post"),
+	})
+	resp, err := c.Exchange(req)
+	if err != nil {
+		t.Fatalf("unable to post: %v", err)
+	}
+	if string(resp.Payload()) != "slow" {
+		t.Fatalf("unexpected payload: %s", resp.Payload())
+	}
+}
+
+func TestHedgingClientMethods(t *testing.T) {
+	slow, closeSlow := runHedgingServer(t, time.Millisecond*200, "slow")
+	defer closeSlow()
+	fast, closeFast := runHedgingServer(t, 0, "fast")
+	defer closeFast()
+
+	c := NewHedgingClient([]*ClientConn{slow, fast}, time.Millisecond*50)
+	c.HedgeNonIdempotent = true
+	for name, call := range map[string]func() (Message, error){
+		"post":   func() (Message, error) { return c.Post("/a", TextPlain, strings.NewReader("body")) },
+		"put":    func() (Message, error) { return c.Put("/a", TextPlain, strings.NewReader("body")) },
+		"delete": func() (Message, error) { return c.Delete("/a") },
+	} {
+		resp, err := call()
+		if err != nil {
+			t.Fatalf("unable to %v: %v", name, err)
+		}
+		if string(resp.Payload()) != "fast" {
+			t.Fatalf("unexpected payload of %v: %s", name, resp.Payload())
+		}
+	}
+}
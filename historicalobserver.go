@@ -0,0 +1,157 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// NotificationConn is connection which notifications are sent to, it is implemented by ClientConn.
+type NotificationConn interface {
+	NewMessage(p MessageParams) Message
+	WriteMsgWithContext(ctx context.Context, m Message) error
+}
+
+type historicalNotification struct {
+	at      time.Time
+	seq     uint32
+	code    COAPCode
+	opts    options
+	payload []byte
+}
+
+type historicalSubscriber struct {
+	conn  NotificationConn
+	token []byte
+}
+
+// HistoricalObserver keeps recent notifications of resource, so new subscriber receives them
+// before live notifications. At most maxHistory notifications not older than maxAge are kept.
+type HistoricalObserver struct {
+	maxHistory int
+	maxAge     time.Duration
+
+	// ErrorFunc is called when sending of live notification to subscriber fails,
+	// subscriber is removed.
+	ErrorFunc func(err error)
+
+	lock        sync.Mutex
+	seq         uint32
+	history     []historicalNotification
+	subscribers []historicalSubscriber
+}
+
+// NewHistoricalObserver creates observer which keeps maxHistory notifications, maxAge 0 means unlimited age.
+func NewHistoricalObserver(maxHistory int, maxAge time.Duration) *HistoricalObserver {
+	return &HistoricalObserver{
+		maxHistory: maxHistory,
+		maxAge:     maxAge,
+	}
+}
+
+func (o *HistoricalObserver) expire(now time.Time) {
+	i := 0
+	if len(o.history) > o.maxHistory {
+		i = len(o.history) - o.maxHistory
+	}
+	for o.maxAge > 0 && i < len(o.history) && now.Sub(o.history[i].at) > o.maxAge {
+		i++
+	}
+	o.history = o.history[i:]
+}
+
+func (o *HistoricalObserver) notification(conn NotificationConn, token []byte, n historicalNotification) Message {
+	m := conn.NewMessage(MessageParams{
+		Type:      NonConfirmable,
+		Code:      n.code,
+		MessageID: GenerateMessageID(),
+		Token:     token,
+	})
+	for _, opt := range n.opts {
+		m.AddOption(opt.ID, opt.Value)
+	}
+	m.SetOption(Observe, n.seq)
+	if len(n.payload) > 0 {
+		m.SetPayload(n.payload)
+	}
+	return m
+}
+
+func (o *HistoricalObserver) flush(ctx context.Context, conn NotificationConn, token []byte) error {
+	o.expire(time.Now())
+	for _, n := range o.history {
+		if err := conn.WriteMsgWithContext(ctx, o.notification(conn, token, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlushHistory sends kept notifications to conn as non-confirmable messages with token and original sequence numbers.
+func (o *HistoricalObserver) FlushHistory(ctx context.Context, conn NotificationConn, token []byte) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.flush(ctx, conn, token)
+}
+
+// Subscribe sends history to conn and registers it for live notifications.
+func (o *HistoricalObserver) Subscribe(ctx context.Context, conn NotificationConn, token []byte) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if err := o.flush(ctx, conn, token); err != nil {
+		return err
+	}
+	o.subscribers = append(o.subscribers, historicalSubscriber{conn: conn, token: token})
+	return nil
+}
+
+// Unsubscribe removes subscription of conn with token.
+func (o *HistoricalObserver) Unsubscribe(conn NotificationConn, token []byte) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.unsubscribe(conn, token)
+}
+
+func (o *HistoricalObserver) unsubscribe(conn NotificationConn, token []byte) {
+	for i, s := range o.subscribers {
+		if s.conn == conn && bytes.Equal(s.token, token) {
+			o.subscribers = append(o.subscribers[:i], o.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Notify stores notification m to history and sends it to subscribers. Sequence number is taken
+// from Observe option of m, when it's not set the next one is assigned.
+func (o *HistoricalObserver) Notify(ctx context.Context, m Message) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if seq, ok := m.Option(Observe).(uint32); ok {
+		o.seq = seq
+	} else {
+		o.seq++
+	}
+	n := historicalNotification{
+		at:      time.Now(),
+		seq:     o.seq,
+		code:    m.Code(),
+		payload: m.Payload(),
+	}
+	for _, opt := range m.AllOptions() {
+		if opt.ID != Observe {
+			n.opts = append(n.opts, opt)
+		}
+	}
+	o.history = append(o.history, n)
+	o.expire(n.at)
+
+	for _, s := range append([]historicalSubscriber(nil), o.subscribers...) {
+		if err := s.conn.WriteMsgWithContext(ctx, o.notification(s.conn, s.token, n)); err != nil {
+			o.unsubscribe(s.conn, s.token)
+			if o.ErrorFunc != nil {
+				o.ErrorFunc(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type notificationConn struct {
+	lock sync.Mutex
+	sent []Message
+}
+
+func (c *notificationConn) NewMessage(p MessageParams) Message {
+	return NewDgramMessage(p)
+}
+
+func (c *notificationConn) WriteMsgWithContext(ctx context.Context, m Message) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.sent = append(c.sent, m)
+	return nil
+}
+
+func (c *notificationConn) notifications() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var n []string
+	for _, m := range c.sent {
+		n = append(n, fmt.Sprintf("%v:%s:%x", m.Option(Observe), m.Payload(), m.Token()))
+	}
+	return n
+}
+
+func TestHistoricalObserverReplaysHistory(t *testing.T) {
+	o := NewHistoricalObserver(10, time.Minute)
+	for i := 1; i <= 5; i++ {
+		o.Notify(context.Background(), newNotification(fmt.Sprintf("n%v", i)))
+	}
+
+	c := &notificationConn{}
+	if err := o.Subscribe(context.Background(), c, []byte{0xab}); err != nil {
+		t.Fatalf("unable to subscribe: %v", err)
+	}
+	o.Notify(context.Background(), newNotification("n6"))
+
+	expected := []string{"1:n1:ab", "2:n2:ab", "3:n3:ab", "4:n4:ab", "5:n5:ab", "6:n6:ab"}
+	if n := c.notifications(); !reflect.DeepEqual(expected, n) {
+		t.Fatalf("expected %v, got %v", expected, n)
+	}
+	for _, m := range c.sent {
+		if m.Type() != NonConfirmable {
+			t.Fatalf("expected non-confirmable notification, got %v", m.Type())
+		}
+	}
+
+	o.Unsubscribe(c, []byte{0xab})
+	o.Notify(context.Background(), newNotification("n7"))
+	if n := c.notifications(); len(n) != 6 {
+		t.Fatalf("notification was sent after unsubscribe: %v", n)
+	}
+}
+
+func TestHistoricalObserverLimits(t *testing.T) {
+	o := NewHistoricalObserver(3, time.Millisecond*100)
+	for i := 1; i <= 5; i++ {
+		o.Notify(context.Background(), newNotification(fmt.Sprintf("n%v", i)))
+	}
+	c := &notificationConn{}
+	if err := o.FlushHistory(context.Background(), c, nil); err != nil {
+		t.Fatalf("unable to flush history: %v", err)
+	}
+	expected := []string{"3:n3:", "4:n4:", "5:n5:"}
+	if n := c.notifications(); !reflect.DeepEqual(expected, n) {
+		t.Fatalf("expected %v, got %v", expected, n)
+	}
+
+	time.Sleep(time.Millisecond * 150)
+	c = &notificationConn{}
+	if err := o.FlushHistory(context.Background(), c, nil); err != nil {
+		t.Fatalf("unable to flush history: %v", err)
+	}
+	if n := c.notifications(); len(n) != 0 {
+		t.Fatalf("expired notifications were sent: %v", n)
+	}
+}
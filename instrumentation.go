@@ -0,0 +1,197 @@
+package coap
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Transports reported to Instrumentation, TransportTCP includes TCP over TLS.
+const (
+	TransportUDP  = "udp"
+	TransportTCP  = "tcp"
+	TransportDTLS = "dtls"
+)
+
+// Instrumentation receives events of server, eg. to export them as Prometheus counters and gauges.
+// Methods are called concurrently by serving goroutines, so they must be safe for concurrent use
+// and they must not block. Embed NopInstrumentation to implement only some of them.
+type Instrumentation interface {
+	// SessionStarted and SessionEnded track active sessions of transport.
+	SessionStarted(transport string)
+	SessionEnded(transport string)
+	// RequestReceived is called for request passed to Handler.
+	RequestReceived(transport string, method COAPCode)
+	// ResponseSent is called for response written by Handler to request of method.
+	ResponseSent(transport string, method, code COAPCode)
+	// Retransmitted is called for retransmission of confirmable message, see TransmissionParams.
+	Retransmitted(transport string)
+	// DuplicateDropped is called for request retransmitted by peer which is dropped because
+	// the original request is still served.
+	DuplicateDropped(transport string)
+	// BlockWiseTransferStarted and BlockWiseTransferEnded track block-wise transfers in flight.
+	BlockWiseTransferStarted(transport string)
+	BlockWiseTransferEnded(transport string)
+	// ObserveRegistered and ObserveDeregistered track active observations of ObserveRegistry.
+	ObserveRegistered()
+	ObserveDeregistered()
+}
+
+// NopInstrumentation ignores all events.
+type NopInstrumentation struct{}
+
+func (NopInstrumentation) SessionStarted(transport string)                      {}
+func (NopInstrumentation) SessionEnded(transport string)                        {}
+func (NopInstrumentation) RequestReceived(transport string, method COAPCode)    {}
+func (NopInstrumentation) ResponseSent(transport string, method, code COAPCode) {}
+func (NopInstrumentation) Retransmitted(transport string)                       {}
+func (NopInstrumentation) DuplicateDropped(transport string)                    {}
+func (NopInstrumentation) BlockWiseTransferStarted(transport string)            {}
+func (NopInstrumentation) BlockWiseTransferEnded(transport string)              {}
+func (NopInstrumentation) ObserveRegistered()                                   {}
+func (NopInstrumentation) ObserveDeregistered()                                 {}
+
+func (srv *Server) instrumentation() Instrumentation {
+	if srv == nil || srv.Instrumentation == nil {
+		return NopInstrumentation{}
+	}
+	return srv.Instrumentation
+}
+
+// sessionBaseOf returns base and transport of session, base is nil for unknown session.
+func sessionBaseOf(s networkSession) (*sessionBase, string) {
+	if b, ok := s.(*blockWiseSession); ok {
+		s = b.networkSession
+	}
+	switch v := s.(type) {
+	case *sessionUDP:
+		return &v.sessionBase, TransportUDP
+	case *sessionTCP:
+		return &v.sessionBase, TransportTCP
+	case *sessionDTLS:
+		return &v.sessionBase, TransportDTLS
+	}
+	return nil, TransportUDP
+}
+
+// sessionInstrumentation returns instrumentation of server of session and transport of session.
+func sessionInstrumentation(s networkSession) (Instrumentation, string) {
+	base, transport := sessionBaseOf(s)
+	if base == nil {
+		return NopInstrumentation{}, transport
+	}
+	return base.srv.instrumentation(), transport
+}
+
+// sessionStarted reports start of session once.
+func sessionStarted(s networkSession) {
+	base, transport := sessionBaseOf(s)
+	if base != nil && atomic.CompareAndSwapInt32(&base.instrumented, 0, 1) {
+		base.srv.instrumentation().SessionStarted(transport)
+	}
+}
+
+// sessionEnded reports end of session once, only when its start was reported.
+func sessionEnded(s networkSession) {
+	base, transport := sessionBaseOf(s)
+	if base != nil && atomic.CompareAndSwapInt32(&base.instrumented, 1, 2) {
+		base.srv.instrumentation().SessionEnded(transport)
+	}
+}
+
+func isRequestCode(code COAPCode) bool {
+	return code != Empty && code>>5 == 0
+}
+
+// inflightRequest identifies request of datagram session by its message ID.
+type inflightRequest struct {
+	session   networkSession
+	messageID uint16
+}
+
+// inflightRequests tracks requests of UDP and DTLS sessions which are served, so retransmission
+// of request received meanwhile is dropped instead of being served twice.
+type inflightRequests struct {
+	lock     sync.Mutex
+	requests map[inflightRequest]struct{}
+}
+
+// begin returns false when request with the message ID is already served.
+func (f *inflightRequests) begin(session networkSession, messageID uint16) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.requests == nil {
+		f.requests = make(map[inflightRequest]struct{})
+	}
+	k := inflightRequest{session: session, messageID: messageID}
+	if _, ok := f.requests[k]; ok {
+		return false
+	}
+	f.requests[k] = struct{}{}
+	return true
+}
+
+func (f *inflightRequests) end(session networkSession, messageID uint16) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.requests, inflightRequest{session: session, messageID: messageID})
+}
+
+// beginRequest returns false when r is retransmission of request which is still served, it's
+// reported to Instrumentation then. The returned func ends serving of r.
+func (srv *Server) beginRequest(r *Request) (func(), bool) {
+	session := r.Client.networkSession()
+	if session.IsTCP() || !isRequestCode(r.Msg.Code()) {
+		return func() {}, true
+	}
+	messageID := r.Msg.MessageID()
+	if !srv.inflight.begin(session, messageID) {
+		i, transport := sessionInstrumentation(session)
+		i.DuplicateDropped(transport)
+		return nil, false
+	}
+	return func() { srv.inflight.end(session, messageID) }, true
+}
+
+// instrumentedResponseWriter reports responses written by Handler.
+type instrumentedResponseWriter struct {
+	ResponseWriter
+	instrumentation Instrumentation
+	transport       string
+}
+
+func (w *instrumentedResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *instrumentedResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *instrumentedResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *instrumentedResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	err := w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+	if err == nil {
+		w.instrumentation.ResponseSent(w.transport, w.getReq().Msg.Code(), msg.Code())
+	}
+	return err
+}
+
+func (w *instrumentedResponseWriter) WriteError(err error) {
+	writeError(w, err)
+}
+
+// instrumentRequest reports request passed to Handler and wraps w to report its responses.
+func (srv *Server) instrumentRequest(w ResponseWriter, r *Request) ResponseWriter {
+	if srv.Instrumentation == nil || !isRequestCode(r.Msg.Code()) {
+		return w
+	}
+	_, transport := sessionBaseOf(r.Client.networkSession())
+	srv.Instrumentation.RequestReceived(transport, r.Msg.Code())
+	return &instrumentedResponseWriter{ResponseWriter: w, instrumentation: srv.Instrumentation, transport: transport}
+}
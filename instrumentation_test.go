@@ -0,0 +1,171 @@
+package coap
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testInstrumentation counts events by their name and labels.
+type testInstrumentation struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+func (i *testInstrumentation) inc(event string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.counts == nil {
+		i.counts = make(map[string]int)
+	}
+	i.counts[event]++
+}
+
+func (i *testInstrumentation) count(event string) int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.counts[event]
+}
+
+func (i *testInstrumentation) SessionStarted(transport string) { i.inc("session_started " + transport) }
+func (i *testInstrumentation) SessionEnded(transport string)   { i.inc("session_ended " + transport) }
+func (i *testInstrumentation) RequestReceived(transport string, method COAPCode) {
+	i.inc(fmt.Sprintf("request %v %v", transport, method))
+}
+func (i *testInstrumentation) ResponseSent(transport string, method, code COAPCode) {
+	i.inc(fmt.Sprintf("response %v %v %v", transport, method, code))
+}
+func (i *testInstrumentation) Retransmitted(transport string)    { i.inc("retransmitted " + transport) }
+func (i *testInstrumentation) DuplicateDropped(transport string) { i.inc("duplicate " + transport) }
+func (i *testInstrumentation) BlockWiseTransferStarted(transport string) {
+	i.inc("blockwise_started " + transport)
+}
+func (i *testInstrumentation) BlockWiseTransferEnded(transport string) {
+	i.inc("blockwise_ended " + transport)
+}
+func (i *testInstrumentation) ObserveRegistered()   { i.inc("observe_registered") }
+func (i *testInstrumentation) ObserveDeregistered() { i.inc("observe_deregistered") }
+
+func TestInstrumentation(t *testing.T) {
+	var instr testInstrumentation
+	mux := NewServeMux()
+	mux.HandleFunc("/a", func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("a"))
+	})
+	mux.HandleFunc("/big", func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write(bytes.Repeat([]byte("x"), 3000))
+	})
+	mux.HandleFunc("/obs", func(w ResponseWriter, r *Request) {
+		resp := w.NewResponse(Content)
+		resp.SetOption(Observe, uint32(2))
+		resp.SetOption(ContentFormat, TextPlain)
+		resp.SetPayload([]byte("obs"))
+		w.WriteMsg(resp)
+	})
+	ended := make(chan struct{})
+	srv := &Server{Handler: mux, Instrumentation: &instr, NotifySessionEndFunc: func(w *ClientConn, err error) {
+		close(ended)
+	}}
+	addr, shutdown := runLocalUDPServer(t, srv)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	_, err = co.Get("/a")
+	require.NoError(t, err)
+	resp, err := co.Get("/big")
+	require.NoError(t, err)
+	assert.Len(t, resp.Payload(), 3000)
+
+	notified := make(chan struct{}, 1)
+	o, err := co.Observe("/obs", func(req *Request) {
+		select {
+		case notified <- struct{}{}:
+		default:
+		}
+	})
+	require.NoError(t, err)
+	<-notified
+	assert.Equal(t, 1, instr.count("observe_registered"))
+	require.NoError(t, o.Cancel())
+	co.Close()
+
+	assert.Equal(t, 1, instr.count("session_started udp"))
+	assert.True(t, instr.count("request udp GET") >= 4, "%v", instr.counts)
+	assert.True(t, instr.count("response udp GET Content") >= 3, "%v", instr.counts)
+	assert.Equal(t, 1, instr.count("blockwise_started udp"))
+	assert.Equal(t, 1, instr.count("blockwise_ended udp"))
+	assert.Equal(t, 1, instr.count("observe_deregistered"))
+
+	shutdown()
+	<-ended
+	assert.Equal(t, 1, instr.count("session_ended udp"))
+}
+
+func TestInstrumentationDuplicateDropped(t *testing.T) {
+	var instr testInstrumentation
+	served := make(chan struct{}, 2)
+	release := make(chan struct{})
+	srv := &Server{Instrumentation: &instr, Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		served <- struct{}{}
+		<-release
+		w.SetCode(Content)
+		w.Write(nil)
+	})}
+	addr, shutdown := runLocalUDPServer(t, srv)
+	defer shutdown()
+	serverAddr, err := net.ResolveUDPAddr("udp", addr)
+	require.NoError(t, err)
+	serverAddr.IP = net.IPv4(127, 0, 0, 1)
+
+	p := newTestUDPPeer(t)
+	defer p.conn.Close()
+	req := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1, Token: []byte("t")})
+	req.SetPathString("/a")
+	p.write(t, serverAddr, req)
+	<-served
+	// retransmission while the request is served
+	p.write(t, serverAddr, req)
+	require.Eventually(t, func() bool { return instr.count("duplicate udp") == 1 }, time.Second, 10*time.Millisecond)
+	close(release)
+	resp, _ := p.read(t, time.Second)
+	require.NotNil(t, resp)
+	assert.Equal(t, Content, resp.Code())
+	msg, _ := p.read(t, 100*time.Millisecond)
+	assert.Nil(t, msg)
+	assert.Len(t, served, 0)
+}
+
+func TestInstrumentationRetransmitted(t *testing.T) {
+	var instr testInstrumentation
+	p := newTestUDPPeer(t)
+	defer p.conn.Close()
+	params := TransmissionParams{AckTimeout: 20 * time.Millisecond, AckRandomFactor: 1, MaxRetransmit: 4}
+	c := Client{Net: "udp", TransmissionParams: &params, Instrumentation: &instr}
+	co, err := c.Dial(p.conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer co.Close()
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			msg, addr := p.read(t, time.Second)
+			if msg == nil {
+				return
+			}
+			if i == 2 {
+				p.ack(t, addr, msg, Content)
+			}
+		}
+	}()
+	_, err = co.Get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, instr.count("retransmitted udp"))
+}
@@ -0,0 +1,373 @@
+// Package linkformat parses and serializes CoRE Link Format (RFC 6690) documents, eg. payloads of
+// /.well-known/core, and filters their links by query of resource discovery.
+package linkformat
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLink is returned when document is not valid link-format.
+var ErrInvalidLink = errors.New("invalid link-format")
+
+// Param is target attribute of link not expressed by typed field of Link.
+type Param struct {
+	Name     string
+	Value    string
+	HasValue bool // false for flag attribute, eg. "ct" of "</a>;ct"
+}
+
+// Link is link of link-format document with its target attributes.
+type Link struct {
+	Target                string   // URI-reference, eg. "/sensors/temp"
+	Anchor                string   // anchor attribute
+	Relations             []string // rel attribute
+	ResourceTypes         []string // rt attribute
+	InterfaceDescriptions []string // if attribute
+	ContentFormats        []uint16 // ct attribute
+	Size                  int      // sz attribute, 0 when not set
+	Title                 string   // title attribute
+	Observable            bool     // obs attribute
+	Params                []Param  // other attributes in order of document
+}
+
+// Param returns value of attribute name, flag attribute has empty value. ok is false when the
+// link doesn't have the attribute.
+func (l Link) Param(name string) (value string, ok bool) {
+	switch name {
+	case "anchor":
+		return l.Anchor, l.Anchor != ""
+	case "rel":
+		return strings.Join(l.Relations, " "), len(l.Relations) > 0
+	case "rt":
+		return strings.Join(l.ResourceTypes, " "), len(l.ResourceTypes) > 0
+	case "if":
+		return strings.Join(l.InterfaceDescriptions, " "), len(l.InterfaceDescriptions) > 0
+	case "ct":
+		ct := make([]string, 0, len(l.ContentFormats))
+		for _, v := range l.ContentFormats {
+			ct = append(ct, strconv.Itoa(int(v)))
+		}
+		return strings.Join(ct, " "), len(ct) > 0
+	case "sz":
+		return strconv.Itoa(l.Size), l.Size > 0
+	case "title":
+		return l.Title, l.Title != ""
+	case "obs":
+		return "", l.Observable
+	}
+	for _, p := range l.Params {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// setParam sets attribute of link, it's stored typed when link has field of it.
+func (l *Link) setParam(p Param) error {
+	switch p.Name {
+	case "anchor":
+		l.Anchor = p.Value
+	case "rel":
+		l.Relations = strings.Fields(p.Value)
+	case "rt":
+		l.ResourceTypes = strings.Fields(p.Value)
+	case "if":
+		l.InterfaceDescriptions = strings.Fields(p.Value)
+	case "ct":
+		for _, s := range strings.Fields(p.Value) {
+			v, err := strconv.ParseUint(s, 10, 16)
+			if err != nil {
+				return ErrInvalidLink
+			}
+			l.ContentFormats = append(l.ContentFormats, uint16(v))
+		}
+	case "sz":
+		v, err := strconv.Atoi(p.Value)
+		if err != nil || v < 0 {
+			return ErrInvalidLink
+		}
+		l.Size = v
+	case "title":
+		l.Title = p.Value
+	case "obs":
+		l.Observable = true
+	default:
+		l.Params = append(l.Params, p)
+	}
+	return nil
+}
+
+// parser reads link-format document.
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\r' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+// until reads up to any of stop characters.
+func (p *parser) until(stop string) string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(stop, rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *parser) quoted() (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.pos == len(p.s) {
+				return "", ErrInvalidLink
+			}
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", ErrInvalidLink
+}
+
+func (p *parser) link() (Link, error) {
+	var l Link
+	p.skipSpaces()
+	if p.peek() != '<' {
+		return l, ErrInvalidLink
+	}
+	p.pos++
+	l.Target = p.until(">")
+	if p.peek() != '>' {
+		return l, ErrInvalidLink
+	}
+	p.pos++
+	for {
+		p.skipSpaces()
+		if p.peek() != ';' {
+			return l, nil
+		}
+		p.pos++
+		p.skipSpaces()
+		param := Param{Name: strings.ToLower(strings.TrimSpace(p.until("=;,")))}
+		if param.Name == "" {
+			return l, ErrInvalidLink
+		}
+		if p.peek() == '=' {
+			p.pos++
+			p.skipSpaces()
+			param.HasValue = true
+			if p.peek() == '"' {
+				v, err := p.quoted()
+				if err != nil {
+					return l, err
+				}
+				param.Value = v
+			} else {
+				param.Value = strings.TrimSpace(p.until(";,"))
+			}
+		}
+		if err := l.setParam(param); err != nil {
+			return l, err
+		}
+	}
+}
+
+// Parse parses link-format document.
+func Parse(document string) ([]Link, error) {
+	p := parser{s: document}
+	var links []Link
+	p.skipSpaces()
+	if p.pos == len(p.s) {
+		return nil, nil
+	}
+	for {
+		l, err := p.link()
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+		p.skipSpaces()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case 0:
+			return links, nil
+		default:
+			return nil, ErrInvalidLink
+		}
+	}
+}
+
+// isPtoken reports whether v can be written without quotes.
+func isPtoken(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, c := range v {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'()*+-./:<=>?@[]^_`{|}~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func writeQuoted(b *strings.Builder, v string) {
+	b.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		if v[i] == '"' || v[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(v[i])
+	}
+	b.WriteByte('"')
+}
+
+func writeParam(b *strings.Builder, name, value string, quote bool) {
+	b.WriteByte(';')
+	b.WriteString(name)
+	b.WriteByte('=')
+	if quote || !isPtoken(value) {
+		writeQuoted(b, value)
+		return
+	}
+	b.WriteString(value)
+}
+
+// String serializes link, eg. `</sensors/temp>;rt="temperature-c";if="sensor";ct=0;obs`.
+func (l Link) String() string {
+	var b strings.Builder
+	b.WriteByte('<')
+	b.WriteString(l.Target)
+	b.WriteByte('>')
+	if l.Anchor != "" {
+		writeParam(&b, "anchor", l.Anchor, true)
+	}
+	if len(l.Relations) > 0 {
+		writeParam(&b, "rel", strings.Join(l.Relations, " "), true)
+	}
+	if len(l.ResourceTypes) > 0 {
+		writeParam(&b, "rt", strings.Join(l.ResourceTypes, " "), true)
+	}
+	if len(l.InterfaceDescriptions) > 0 {
+		writeParam(&b, "if", strings.Join(l.InterfaceDescriptions, " "), true)
+	}
+	if ct, ok := l.Param("ct"); ok {
+		writeParam(&b, "ct", ct, false)
+	}
+	if l.Size > 0 {
+		writeParam(&b, "sz", strconv.Itoa(l.Size), false)
+	}
+	if l.Title != "" {
+		writeParam(&b, "title", l.Title, true)
+	}
+	if l.Observable {
+		b.WriteString(";obs")
+	}
+	for _, p := range l.Params {
+		if !p.HasValue {
+			b.WriteByte(';')
+			b.WriteString(p.Name)
+			continue
+		}
+		writeParam(&b, p.Name, p.Value, false)
+	}
+	return b.String()
+}
+
+// Format serializes links to link-format document.
+func Format(links []Link) string {
+	values := make([]string, 0, len(links))
+	for _, l := range links {
+		values = append(values, l.String())
+	}
+	return strings.Join(values, ",")
+}
+
+// matchValue matches value of query, which may end by "*" matching any suffix.
+func matchValue(pattern, value string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == value
+}
+
+// Match reports whether link matches query filter name=value of resource discovery (RFC 6690
+// section 4.1), eg. "rt=temperature*". Name "href" matches target of link, values of attributes
+// rel, rt, if and ct match when any of their space separated values match.
+func (l Link) Match(name, value string) bool {
+	if name == "href" {
+		return matchValue(value, l.Target)
+	}
+	v, ok := l.Param(name)
+	if !ok {
+		return false
+	}
+	switch name {
+	case "rel", "rt", "if", "ct":
+		for _, s := range strings.Fields(v) {
+			if matchValue(value, s) {
+				return true
+			}
+		}
+		return false
+	}
+	return matchValue(value, v)
+}
+
+// Filter returns links matching query of resource discovery, eg. "rt=temperature-c" or "href=/sensors*".
+// Query without "=" matches links having the attribute, empty query matches all links.
+func Filter(links []Link, query string) []Link {
+	if query == "" {
+		return links
+	}
+	name, value := query, ""
+	hasValue := false
+	if i := strings.IndexByte(query, '='); i >= 0 {
+		name, value, hasValue = query[:i], query[i+1:], true
+	}
+	var res []Link
+	for _, l := range links {
+		if !hasValue {
+			if _, ok := l.Param(name); ok || (name == "href" && l.Target != "") {
+				res = append(res, l)
+			}
+			continue
+		}
+		if l.Match(name, value) {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// SortByTarget sorts links by target, eg. to serve stable document.
+func SortByTarget(links []Link) {
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Target < links[j].Target
+	})
+}
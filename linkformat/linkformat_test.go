@@ -0,0 +1,70 @@
+package linkformat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	links, err := Parse(`</sensors/temp>;rt="temperature-c sensor";if="sensor";ct="0 50";obs,` +
+		` </sensors/light>;rt=light-lux;title="Light, \"lux\"";sz=1024;foo=bar;flag,</t>;anchor="/sensors/temp";rel=describedby`)
+	require.NoError(t, err)
+	require.Len(t, links, 3)
+	assert.Equal(t, Link{
+		Target:                "/sensors/temp",
+		ResourceTypes:         []string{"temperature-c", "sensor"},
+		InterfaceDescriptions: []string{"sensor"},
+		ContentFormats:        []uint16{0, 50},
+		Observable:            true,
+	}, links[0])
+	assert.Equal(t, Link{
+		Target:        "/sensors/light",
+		ResourceTypes: []string{"light-lux"},
+		Title:         `Light, "lux"`,
+		Size:          1024,
+		Params:        []Param{{Name: "foo", Value: "bar", HasValue: true}, {Name: "flag"}},
+	}, links[1])
+	assert.Equal(t, "/sensors/temp", links[2].Anchor)
+	assert.Equal(t, []string{"describedby"}, links[2].Relations)
+
+	links, err = Parse("")
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	for _, invalid := range []string{"/a", "</a", `</a>;rt="x`, "</a>;ct=x", "</a> </b>", "</a>;=1"} {
+		_, err := Parse(invalid)
+		assert.Equal(t, ErrInvalidLink, err, invalid)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	links := []Link{
+		{Target: "/sensors/temp", ResourceTypes: []string{"temperature-c"}, InterfaceDescriptions: []string{"sensor"}, ContentFormats: []uint16{0}, Observable: true},
+		{Target: "/sensors/light", Title: `Light "lux"`, ContentFormats: []uint16{0, 50}, Size: 10, Params: []Param{{Name: "foo", Value: "a b", HasValue: true}, {Name: "flag"}}},
+	}
+	doc := Format(links)
+	assert.Equal(t, `</sensors/temp>;rt="temperature-c";if="sensor";ct=0;obs,`+
+		`</sensors/light>;ct="0 50";sz=10;title="Light \"lux\"";foo="a b";flag`, doc)
+	parsed, err := Parse(doc)
+	require.NoError(t, err)
+	assert.Equal(t, links, parsed)
+}
+
+func TestFilter(t *testing.T) {
+	links := []Link{
+		{Target: "/sensors/temp", ResourceTypes: []string{"temperature-c", "sensor"}, ContentFormats: []uint16{0, 50}},
+		{Target: "/sensors/light", ResourceTypes: []string{"light-lux"}, Title: "Light"},
+		{Target: "/actuators/led", Observable: true},
+	}
+	assert.Equal(t, links, Filter(links, ""))
+	assert.Equal(t, links[:1], Filter(links, "rt=sensor"))
+	assert.Equal(t, links[:1], Filter(links, "rt=temp*"))
+	assert.Equal(t, links[:2], Filter(links, "href=/sensors*"))
+	assert.Equal(t, links[1:2], Filter(links, "href=/sensors/light"))
+	assert.Equal(t, links[:1], Filter(links, "ct=50"))
+	assert.Equal(t, links[1:2], Filter(links, "title=Light"))
+	assert.Equal(t, links[2:], Filter(links, "obs"))
+	assert.Empty(t, Filter(links, "rt=unknown"))
+}
@@ -0,0 +1,331 @@
+// Package lowpan compresses IPv6 and UDP headers of CoAP datagrams by LOWPAN_IPHC and
+// LOWPAN_NHC (RFC 6282), so frames of 6LoWPAN firmware can be produced and checked in tests.
+package lowpan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// HeaderSize is size of IPv6 header followed by UDP header, which is compressed.
+const HeaderSize = ipv6HeaderSize + udpHeaderSize
+
+const (
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+	udpNextHeader  = 17
+
+	iphcDispatch = 0x60 // 011xxxxx
+	iphcMask     = 0xe0
+	nhcUDP       = 0xf0 // 11110CPP
+	nhcUDPMask   = 0xf8
+)
+
+var (
+	errShortFrame   = errors.New("lowpan: frame is too short")
+	errNotIPHC      = errors.New("lowpan: frame is not LOWPAN_IPHC")
+	errNotUDP       = errors.New("lowpan: next header is not UDP")
+	errUnsupported  = errors.New("lowpan: stateful address compression is not supported")
+	errInvalidIPHdr = errors.New("lowpan: invalid IPv6 and UDP header")
+)
+
+// Compressor compresses CoAP over UDP over IPv6 datagrams to 6LoWPAN frames. It uses
+// stateless compression only, the zero value is ready to use.
+type Compressor struct{}
+
+// Compress compresses ipHdr, which is IPv6 header followed by UDP header (HeaderSize bytes),
+// and coapMsg to frame starting by LOWPAN_IPHC. Payload Length and UDP Length of ipHdr must
+// match coapMsg, they are elided and Decompress restores them from size of the frame.
+// RFC 6282 defines no compression of CoAP itself, so coapMsg is carried inline.
+func (Compressor) Compress(ipHdr []byte, coapMsg []byte) ([]byte, error) {
+	if len(ipHdr) != HeaderSize || ipHdr[0]>>4 != 6 {
+		return nil, errInvalidIPHdr
+	}
+	if ipHdr[6] != udpNextHeader {
+		return nil, errNotUDP
+	}
+	udp := ipHdr[ipv6HeaderSize:]
+	length := udpHeaderSize + len(coapMsg)
+	if int(binary.BigEndian.Uint16(ipHdr[4:6])) != length || int(binary.BigEndian.Uint16(udp[4:6])) != length {
+		return nil, fmt.Errorf("lowpan: header lengths don't match CoAP message of %v bytes", len(coapMsg))
+	}
+
+	frame := make([]byte, 2, HeaderSize+len(coapMsg))
+	var iphc0, iphc1 byte = iphcDispatch, 0
+	// next header is always compressed by NHC
+	iphc0 |= 0x04
+
+	// traffic class is DSCP:ECN in IPv6 header, ECN:DSCP inline
+	tc := ipHdr[0]<<4 | ipHdr[1]>>4
+	ecn, dscp := tc&0x03, tc>>2
+	flowLabel := uint32(ipHdr[1]&0x0f)<<16 | uint32(ipHdr[2])<<8 | uint32(ipHdr[3])
+	switch {
+	case tc == 0 && flowLabel == 0:
+		iphc0 |= 0x18
+	case dscp == 0:
+		iphc0 |= 0x08
+		frame = append(frame, ecn<<6|byte(flowLabel>>16), byte(flowLabel>>8), byte(flowLabel))
+	case flowLabel == 0:
+		iphc0 |= 0x10
+		frame = append(frame, ecn<<6|dscp)
+	default:
+		frame = append(frame, ecn<<6|dscp, byte(flowLabel>>16), byte(flowLabel>>8), byte(flowLabel))
+	}
+
+	switch hopLimit := ipHdr[7]; hopLimit {
+	case 1:
+		iphc0 |= 0x01
+	case 64:
+		iphc0 |= 0x02
+	case 255:
+		iphc0 |= 0x03
+	default:
+		frame = append(frame, hopLimit)
+	}
+
+	src, dst := ipHdr[8:24], ipHdr[24:40]
+	mode, inline := compressUnicast(src)
+	iphc1 |= mode << 4
+	frame = append(frame, inline...)
+	if dst[0] == 0xff {
+		iphc1 |= 0x08
+		mode, inline = compressMulticast(dst)
+	} else {
+		mode, inline = compressUnicast(dst)
+	}
+	iphc1 |= mode
+	frame = append(frame, inline...)
+	frame[0], frame[1] = iphc0, iphc1
+
+	frame = append(frame, compressUDP(udp)...)
+	return append(frame, coapMsg...), nil
+}
+
+// Decompress restores IPv6 header followed by UDP header and CoAP message from frame created by Compress.
+func (Compressor) Decompress(frame []byte) (ipHdr []byte, coapMsg []byte, err error) {
+	if len(frame) < 2 {
+		return nil, nil, errShortFrame
+	}
+	iphc0, iphc1 := frame[0], frame[1]
+	if iphc0&iphcMask != iphcDispatch {
+		return nil, nil, errNotIPHC
+	}
+	if iphc1&0x80 != 0 || iphc1&0x40 != 0 || iphc1&0x04 != 0 {
+		return nil, nil, errUnsupported
+	}
+	r := reader{b: frame[2:]}
+	ipHdr = make([]byte, HeaderSize)
+	ipHdr[0] = 6 << 4
+
+	var ecn, dscp byte
+	var flowLabel uint32
+	switch iphc0 >> 3 & 0x03 {
+	case 0:
+		b := r.next(4)
+		ecn, dscp = b[0]>>6, b[0]&0x3f
+		flowLabel = uint32(b[1]&0x0f)<<16 | uint32(b[2])<<8 | uint32(b[3])
+	case 1:
+		b := r.next(3)
+		ecn = b[0] >> 6
+		flowLabel = uint32(b[0]&0x0f)<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 2:
+		b := r.next(1)
+		ecn, dscp = b[0]>>6, b[0]&0x3f
+	}
+	tc := dscp<<2 | ecn
+	ipHdr[0] |= tc >> 4
+	ipHdr[1] = tc<<4 | byte(flowLabel>>16)
+	ipHdr[2], ipHdr[3] = byte(flowLabel>>8), byte(flowLabel)
+
+	nextHeader := byte(0)
+	if iphc0&0x04 == 0 {
+		nextHeader = r.next(1)[0]
+	}
+	ipHdr[6] = udpNextHeader
+	switch iphc0 & 0x03 {
+	case 0:
+		ipHdr[7] = r.next(1)[0]
+	case 1:
+		ipHdr[7] = 1
+	case 2:
+		ipHdr[7] = 64
+	case 3:
+		ipHdr[7] = 255
+	}
+
+	decompressUnicast(&r, iphc1>>4&0x03, ipHdr[8:24])
+	if iphc1&0x08 != 0 {
+		decompressMulticast(&r, iphc1&0x03, ipHdr[24:40])
+	} else {
+		decompressUnicast(&r, iphc1&0x03, ipHdr[24:40])
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if iphc0&0x04 == 0 && nextHeader != udpNextHeader {
+		return nil, nil, errNotUDP
+	}
+
+	udp := ipHdr[ipv6HeaderSize:]
+	if iphc0&0x04 == 0 {
+		copy(udp, r.next(udpHeaderSize))
+	} else if err := decompressUDP(&r, udp); err != nil {
+		return nil, nil, err
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	coapMsg = append([]byte(nil), r.b...)
+	length := uint16(udpHeaderSize + len(coapMsg))
+	binary.BigEndian.PutUint16(ipHdr[4:6], length)
+	binary.BigEndian.PutUint16(udp[4:6], length)
+	return ipHdr, coapMsg, nil
+}
+
+// compressUnicast returns SAM/DAM mode and inline part of stateless unicast address.
+func compressUnicast(addr []byte) (byte, []byte) {
+	if !isLinkLocal(addr) {
+		return 0, addr
+	}
+	if addr[8] == 0 && addr[9] == 0 && addr[10] == 0 && addr[11] == 0xff && addr[12] == 0xfe && addr[13] == 0 {
+		return 2, addr[14:]
+	}
+	return 1, addr[8:]
+}
+
+func decompressUnicast(r *reader, mode byte, addr []byte) {
+	switch mode {
+	case 0:
+		copy(addr, r.next(16))
+		return
+	case 1:
+		copy(addr[8:], r.next(8))
+	case 2:
+		copy(addr[8:], []byte{0, 0, 0, 0xff, 0xfe, 0})
+		copy(addr[14:], r.next(2))
+	case 3:
+		// derived from link-layer address, which is not known here
+		r.fail(errUnsupported)
+		return
+	}
+	addr[0], addr[1] = 0xfe, 0x80
+}
+
+func isLinkLocal(addr []byte) bool {
+	for i := 2; i < 8; i++ {
+		if addr[i] != 0 {
+			return false
+		}
+	}
+	return addr[0] == 0xfe && addr[1] == 0x80
+}
+
+// compressMulticast returns DAM mode and inline part of multicast address.
+func compressMulticast(addr []byte) (byte, []byte) {
+	zeroUntil := func(end int) bool {
+		for i := 2; i < end; i++ {
+			if addr[i] != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case addr[1] == 0x02 && zeroUntil(15):
+		return 3, addr[15:]
+	case zeroUntil(13):
+		return 2, append([]byte{addr[1]}, addr[13:]...)
+	case zeroUntil(11):
+		return 1, append([]byte{addr[1]}, addr[11:]...)
+	}
+	return 0, addr
+}
+
+func decompressMulticast(r *reader, mode byte, addr []byte) {
+	addr[0] = 0xff
+	switch mode {
+	case 0:
+		copy(addr, r.next(16))
+	case 1:
+		b := r.next(6)
+		addr[1] = b[0]
+		copy(addr[11:], b[1:])
+	case 2:
+		b := r.next(4)
+		addr[1] = b[0]
+		copy(addr[13:], b[1:])
+	case 3:
+		addr[1] = 0x02
+		addr[15] = r.next(1)[0]
+	}
+}
+
+// compressUDP returns LOWPAN_NHC UDP header, the checksum is always carried inline.
+func compressUDP(udp []byte) []byte {
+	src, dst := binary.BigEndian.Uint16(udp[0:2]), binary.BigEndian.Uint16(udp[2:4])
+	checksum := udp[6:8]
+	switch {
+	case src&0xfff0 == 0xf0b0 && dst&0xfff0 == 0xf0b0:
+		return append([]byte{nhcUDP | 0x03, byte(src&0x0f)<<4 | byte(dst&0x0f)}, checksum...)
+	case dst&0xff00 == 0xf000:
+		return append([]byte{nhcUDP | 0x01, udp[0], udp[1], udp[3]}, checksum...)
+	case src&0xff00 == 0xf000:
+		return append([]byte{nhcUDP | 0x02, udp[1], udp[2], udp[3]}, checksum...)
+	}
+	return append([]byte{nhcUDP, udp[0], udp[1], udp[2], udp[3]}, checksum...)
+}
+
+func decompressUDP(r *reader, udp []byte) error {
+	nhc := r.next(1)
+	if r.err != nil {
+		return r.err
+	}
+	if nhc[0]&nhcUDPMask != nhcUDP {
+		return errNotUDP
+	}
+	if nhc[0]&0x04 != 0 {
+		// the checksum is computed by upper layer, which is not known here
+		return errors.New("lowpan: elided UDP checksum is not supported")
+	}
+	switch nhc[0] & 0x03 {
+	case 0:
+		copy(udp[0:4], r.next(4))
+	case 1:
+		b := r.next(3)
+		udp[0], udp[1], udp[2], udp[3] = b[0], b[1], 0xf0, b[2]
+	case 2:
+		b := r.next(3)
+		udp[0], udp[1], udp[2], udp[3] = 0xf0, b[0], b[1], b[2]
+	case 3:
+		b := r.next(1)
+		udp[0], udp[1], udp[2], udp[3] = 0xf0, 0xb0|b[0]>>4, 0xf0, 0xb0|b[0]&0x0f
+	}
+	copy(udp[6:8], r.next(2))
+	return r.err
+}
+
+// reader reads inline fields of frame, it remembers the first error.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if len(r.b) < n {
+		r.err = errShortFrame
+		return make([]byte, n)
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
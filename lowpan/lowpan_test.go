@@ -0,0 +1,126 @@
+package lowpan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	coap "github.com/go-ocf/go-coap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ipUDPHeader(src, dst string, srcPort, dstPort uint16, hopLimit byte, trafficClass byte, flowLabel uint32, payloadLen int) []byte {
+	h := make([]byte, HeaderSize)
+	h[0] = 6<<4 | trafficClass>>4
+	h[1] = trafficClass<<4 | byte(flowLabel>>16)
+	h[2], h[3] = byte(flowLabel>>8), byte(flowLabel)
+	length := uint16(udpHeaderSize + payloadLen)
+	binary.BigEndian.PutUint16(h[4:6], length)
+	h[6] = udpNextHeader
+	h[7] = hopLimit
+	copy(h[8:24], net.ParseIP(src).To16())
+	copy(h[24:40], net.ParseIP(dst).To16())
+	binary.BigEndian.PutUint16(h[40:42], srcPort)
+	binary.BigEndian.PutUint16(h[42:44], dstPort)
+	binary.BigEndian.PutUint16(h[44:46], length)
+	binary.BigEndian.PutUint16(h[46:48], 0xbeef)
+	return h
+}
+
+func sensorMessages(t *testing.T) map[string][]byte {
+	get := coap.NewDgramMessage(coap.MessageParams{Type: coap.Confirmable, Code: coap.GET, MessageID: 1, Token: []byte{1, 2}})
+	get.SetPathString("/sensors/temp")
+
+	observe := coap.NewDgramMessage(coap.MessageParams{Type: coap.Confirmable, Code: coap.GET, MessageID: 2, Token: []byte{3}})
+	observe.SetPathString("/sensors/temp")
+	observe.SetOption(coap.Observe, 0)
+
+	notification := coap.NewDgramMessage(coap.MessageParams{Type: coap.NonConfirmable, Code: coap.Content, MessageID: 3, Token: []byte{3}})
+	notification.SetOption(coap.Observe, 12)
+	notification.SetOption(coap.ContentFormat, coap.TextPlain)
+	notification.SetPayload([]byte("21.5"))
+
+	post := coap.NewDgramMessage(coap.MessageParams{Type: coap.NonConfirmable, Code: coap.POST, MessageID: 4})
+	post.SetPathString("/telemetry")
+	post.SetOption(coap.ContentFormat, coap.AppCBOR)
+	post.SetPayload([]byte{0xa1, 0x01, 0x18, 0x2a})
+
+	msgs := make(map[string][]byte)
+	for name, m := range map[string]coap.Message{"get": get, "observe": observe, "notification": notification, "post": post} {
+		var b bytes.Buffer
+		require.NoError(t, m.MarshalBinary(&b))
+		msgs[name] = b.Bytes()
+	}
+	return msgs
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	headers := map[string]func(payloadLen int) []byte{
+		"link-local": func(n int) []byte {
+			return ipUDPHeader("fe80::212:4b00:1:2", "fe80::ff:fe00:1", 5683, 5683, 64, 0, 0, n)
+		},
+		"all-coap-nodes": func(n int) []byte {
+			return ipUDPHeader("fe80::ff:fe00:5", "ff02::fd", 49152, 5683, 255, 0, 0, n)
+		},
+		"site-local-multicast": func(n int) []byte {
+			return ipUDPHeader("fe80::1", "ff05::1:3", 5683, 5683, 1, 0, 0, n)
+		},
+		"global": func(n int) []byte {
+			return ipUDPHeader("2001:db8::1", "2001:db8::2", 61616, 61617, 32, 0xb8, 0, n)
+		},
+		"flow-label": func(n int) []byte {
+			return ipUDPHeader("2001:db8::1", "fe80::2", 61440, 5683, 64, 0x01, 0x12345, n)
+		},
+		"traffic-class-and-flow-label": func(n int) []byte {
+			return ipUDPHeader("2001:db8::1", "ff12::1234:5678", 5683, 61450, 7, 0xb9, 0xabcde, n)
+		},
+	}
+	var c Compressor
+	for hname, header := range headers {
+		for mname, msg := range sensorMessages(t) {
+			t.Run(hname+"/"+mname, func(t *testing.T) {
+				ipHdr := header(len(msg))
+				frame, err := c.Compress(ipHdr, msg)
+				require.NoError(t, err)
+				assert.Less(t, len(frame), len(ipHdr)+len(msg))
+
+				gotHdr, gotMsg, err := c.Decompress(frame)
+				require.NoError(t, err)
+				assert.Equal(t, ipHdr, gotHdr)
+				assert.Equal(t, msg, gotMsg)
+			})
+		}
+	}
+}
+
+func TestCompressLinkLocal(t *testing.T) {
+	msg := sensorMessages(t)["get"]
+	ipHdr := ipUDPHeader("fe80::ff:fe00:1", "fe80::ff:fe00:2", 0xf0b1, 0xf0b2, 64, 0, 0, len(msg))
+	frame, err := Compressor{}.Compress(ipHdr, msg)
+	require.NoError(t, err)
+	// IPHC (2), addresses (2+2), NHC UDP with ports (2) and checksum (2)
+	assert.Equal(t, 10+len(msg), len(frame))
+}
+
+func TestCompressInvalidHeader(t *testing.T) {
+	var c Compressor
+	msg := sensorMessages(t)["get"]
+	_, err := c.Compress(make([]byte, 10), msg)
+	assert.Error(t, err)
+
+	ipHdr := ipUDPHeader("fe80::1", "fe80::2", 5683, 5683, 64, 0, 0, len(msg)+1)
+	_, err = c.Compress(ipHdr, msg)
+	assert.Error(t, err)
+
+	ipHdr = ipUDPHeader("fe80::1", "fe80::2", 5683, 5683, 64, 0, 0, len(msg))
+	ipHdr[6] = 6 // TCP
+	_, err = c.Compress(ipHdr, msg)
+	assert.Error(t, err)
+
+	_, _, err = c.Decompress([]byte{0x7c})
+	assert.Error(t, err)
+	_, _, err = c.Decompress([]byte{0x00, 0x00})
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package coap
+
+import (
+	"context"
+	"time"
+)
+
+// MaxAgeToContextDeadline is middleware which sets deadline of request context to now + Max-Age option
+// of request when it's sooner than the current deadline, so handler doesn't compute response which
+// would be discarded.
+func MaxAgeToContextDeadline(next Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		maxAge, ok := r.Msg.Option(MaxAge).(uint32)
+		if !ok {
+			next.ServeCOAP(w, r)
+			return
+		}
+		ctx := r.Ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, cancel := context.WithDeadline(ctx, time.Now().Add(time.Duration(maxAge)*time.Second))
+		defer cancel()
+		next.ServeCOAP(w, &Request{Msg: r.Msg, Client: r.Client, Ctx: ctx, Sequence: r.Sequence})
+	})
+}
@@ -0,0 +1,44 @@
+package coap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxAgeToContextDeadline(t *testing.T) {
+	expired := make(chan time.Duration, 1)
+	handler := MaxAgeToContextDeadline(HandlerFunc(func(w ResponseWriter, r *Request) {
+		start := time.Now()
+		select {
+		case <-r.Ctx.Done():
+			expired <- time.Since(start)
+			w.SetCode(ServiceUnavailable)
+		case <-time.After(time.Second * 2):
+			expired <- 0
+		}
+		w.Write(nil)
+	}))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, handler.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	req, err := co.NewGetRequest("/a")
+	require.NoError(t, err)
+	req.SetOption(MaxAge, uint32(1))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = co.ExchangeWithContext(ctx, req)
+	require.NoError(t, err)
+	d := <-expired
+	assert.InDelta(t, float64(time.Second), float64(d), float64(time.Millisecond*200), "expired after %v", d)
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"log"
 	"reflect"
 	"strconv"
 	"strings"
@@ -61,6 +60,9 @@ const (
 	POST   COAPCode = 2
 	PUT    COAPCode = 3
 	DELETE COAPCode = 4
+	FETCH  COAPCode = 5
+	PATCH  COAPCode = 6
+	IPATCH COAPCode = 7
 )
 
 // Response Codes
@@ -80,9 +82,12 @@ const (
 	MethodNotAllowed        COAPCode = 133
 	NotAcceptable           COAPCode = 134
 	RequestEntityIncomplete COAPCode = 136
+	Conflict                COAPCode = 137
 	PreconditionFailed      COAPCode = 140
 	RequestEntityTooLarge   COAPCode = 141
 	UnsupportedMediaType    COAPCode = 143
+	UnprocessableEntity     COAPCode = 150
+	TooManyRequests         COAPCode = 157
 	InternalServerError     COAPCode = 160
 	NotImplemented          COAPCode = 161
 	BadGateway              COAPCode = 162
@@ -101,36 +106,44 @@ const (
 )
 
 var codeNames = [256]string{
-	GET:                   "GET",
-	POST:                  "POST",
-	PUT:                   "PUT",
-	DELETE:                "DELETE",
-	Created:               "Created",
-	Deleted:               "Deleted",
-	Valid:                 "Valid",
-	Changed:               "Changed",
-	Content:               "Content",
-	BadRequest:            "BadRequest",
-	Unauthorized:          "Unauthorized",
-	BadOption:             "BadOption",
-	Forbidden:             "Forbidden",
-	NotFound:              "NotFound",
-	MethodNotAllowed:      "MethodNotAllowed",
-	NotAcceptable:         "NotAcceptable",
-	PreconditionFailed:    "PreconditionFailed",
-	RequestEntityTooLarge: "RequestEntityTooLarge",
-	UnsupportedMediaType:  "UnsupportedMediaType",
-	InternalServerError:   "InternalServerError",
-	NotImplemented:        "NotImplemented",
-	BadGateway:            "BadGateway",
-	ServiceUnavailable:    "ServiceUnavailable",
-	GatewayTimeout:        "GatewayTimeout",
-	ProxyingNotSupported:  "ProxyingNotSupported",
-	CSM:                   "Capabilities and Settings Messages",
-	Ping:                  "Ping",
-	Pong:                  "Pong",
-	Release:               "Release",
-	Abort:                 "Abort",
+	GET:                     "GET",
+	POST:                    "POST",
+	PUT:                     "PUT",
+	DELETE:                  "DELETE",
+	FETCH:                   "FETCH",
+	PATCH:                   "PATCH",
+	IPATCH:                  "iPATCH",
+	Created:                 "Created",
+	Deleted:                 "Deleted",
+	Valid:                   "Valid",
+	Changed:                 "Changed",
+	Content:                 "Content",
+	Continue:                "Continue",
+	BadRequest:              "BadRequest",
+	Unauthorized:            "Unauthorized",
+	BadOption:               "BadOption",
+	Forbidden:               "Forbidden",
+	NotFound:                "NotFound",
+	MethodNotAllowed:        "MethodNotAllowed",
+	NotAcceptable:           "NotAcceptable",
+	RequestEntityIncomplete: "RequestEntityIncomplete",
+	Conflict:                "Conflict",
+	PreconditionFailed:      "PreconditionFailed",
+	RequestEntityTooLarge:   "RequestEntityTooLarge",
+	UnsupportedMediaType:    "UnsupportedMediaType",
+	UnprocessableEntity:     "UnprocessableEntity",
+	TooManyRequests:         "TooManyRequests",
+	InternalServerError:     "InternalServerError",
+	NotImplemented:          "NotImplemented",
+	BadGateway:              "BadGateway",
+	ServiceUnavailable:      "ServiceUnavailable",
+	GatewayTimeout:          "GatewayTimeout",
+	ProxyingNotSupported:    "ProxyingNotSupported",
+	CSM:                     "Capabilities and Settings Messages",
+	Ping:                    "Ping",
+	Pong:                    "Pong",
+	Release:                 "Release",
+	Abort:                   "Abort",
 }
 
 func init() {
@@ -178,26 +191,36 @@ type OptionID uint16
 
 // Option IDs.
 const (
-	IfMatch       OptionID = 1
-	URIHost       OptionID = 3
-	ETag          OptionID = 4
-	IfNoneMatch   OptionID = 5
-	Observe       OptionID = 6
-	URIPort       OptionID = 7
-	LocationPath  OptionID = 8
-	URIPath       OptionID = 11
-	ContentFormat OptionID = 12
-	MaxAge        OptionID = 14
-	URIQuery      OptionID = 15
-	Accept        OptionID = 17
-	LocationQuery OptionID = 20
-	Block2        OptionID = 23
-	Block1        OptionID = 27
-	Size2         OptionID = 28
-	ProxyURI      OptionID = 35
-	ProxyScheme   OptionID = 39
-	Size1         OptionID = 60
-	NoResponse    OptionID = 258
+	IfMatch          OptionID = 1
+	URIHost          OptionID = 3
+	ETag             OptionID = 4
+	IfNoneMatch      OptionID = 5
+	Observe          OptionID = 6
+	URIPort          OptionID = 7
+	LocationPath     OptionID = 8
+	OSCORE           OptionID = 9
+	URIPath          OptionID = 11
+	ContentFormat    OptionID = 12
+	MaxAge           OptionID = 14
+	URIQuery         OptionID = 15
+	Accept           OptionID = 17
+	LocationQuery    OptionID = 20
+	Block2           OptionID = 23
+	Block1           OptionID = 27
+	Size2            OptionID = 28
+	ProxyURI         OptionID = 35
+	ProxyScheme      OptionID = 39
+	Size1            OptionID = 60
+	Echo             OptionID = 252
+	NoResponse       OptionID = 258
+	RequestTagOption OptionID = 292
+	Priority         OptionID = 65000 // priority of outbound message, internal and never sent, see MessagePriority, from experimental range
+	Origin           OptionID = 65004 // origin of browser based client, from experimental range
+	CompressedPath   OptionID = 65005 // code of Uri-Path prefix, see PathCompressionTable, from experimental range
+	PinningSessionID OptionID = 65020 // pins blocks of transfer to one server instance, elective and NoCacheKey from experimental range
+	RequestSeqNum    OptionID = 65025 // monotonically increasing number of request for replay protection, critical from experimental range
+	ServerDraining   OptionID = 65028 // set to 1 in responses of server which drains connections, elective from experimental range
+	PayloadCRC       OptionID = 65030 // CRC-32C of payload, elective and unsafe to forward from experimental range
 )
 
 // Option value format (RFC7252 section 3.2)
@@ -218,26 +241,35 @@ type optionDef struct {
 }
 
 var coapOptionDefs = map[OptionID]optionDef{
-	IfMatch:       optionDef{valueFormat: valueOpaque, minLen: 0, maxLen: 8},
-	URIHost:       optionDef{valueFormat: valueString, minLen: 1, maxLen: 255},
-	ETag:          optionDef{valueFormat: valueOpaque, minLen: 1, maxLen: 8},
-	IfNoneMatch:   optionDef{valueFormat: valueEmpty, minLen: 0, maxLen: 0},
-	Observe:       optionDef{valueFormat: valueUint, minLen: 0, maxLen: 3},
-	URIPort:       optionDef{valueFormat: valueUint, minLen: 0, maxLen: 2},
-	LocationPath:  optionDef{valueFormat: valueString, minLen: 0, maxLen: 255},
-	URIPath:       optionDef{valueFormat: valueString, minLen: 0, maxLen: 255},
-	ContentFormat: optionDef{valueFormat: valueUint, minLen: 0, maxLen: 2},
-	MaxAge:        optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
-	URIQuery:      optionDef{valueFormat: valueString, minLen: 0, maxLen: 255},
-	Accept:        optionDef{valueFormat: valueUint, minLen: 0, maxLen: 2},
-	LocationQuery: optionDef{valueFormat: valueString, minLen: 0, maxLen: 255},
-	Block2:        optionDef{valueFormat: valueUint, minLen: 0, maxLen: 3},
-	Block1:        optionDef{valueFormat: valueUint, minLen: 0, maxLen: 3},
-	Size2:         optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
-	ProxyURI:      optionDef{valueFormat: valueString, minLen: 1, maxLen: 1034},
-	ProxyScheme:   optionDef{valueFormat: valueString, minLen: 1, maxLen: 255},
-	Size1:         optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
-	NoResponse:    optionDef{valueFormat: valueUint, minLen: 0, maxLen: 1},
+	IfMatch:          optionDef{valueFormat: valueOpaque, minLen: 0, maxLen: 8},
+	URIHost:          optionDef{valueFormat: valueString, minLen: 1, maxLen: 255},
+	ETag:             optionDef{valueFormat: valueOpaque, minLen: 1, maxLen: 8},
+	IfNoneMatch:      optionDef{valueFormat: valueEmpty, minLen: 0, maxLen: 0},
+	Observe:          optionDef{valueFormat: valueUint, minLen: 0, maxLen: 3},
+	URIPort:          optionDef{valueFormat: valueUint, minLen: 0, maxLen: 2},
+	LocationPath:     optionDef{valueFormat: valueString, minLen: 0, maxLen: 255},
+	OSCORE:           optionDef{valueFormat: valueOpaque, minLen: 0, maxLen: 255},
+	URIPath:          optionDef{valueFormat: valueString, minLen: 0, maxLen: 255},
+	ContentFormat:    optionDef{valueFormat: valueUint, minLen: 0, maxLen: 2},
+	MaxAge:           optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
+	URIQuery:         optionDef{valueFormat: valueString, minLen: 0, maxLen: 255},
+	Accept:           optionDef{valueFormat: valueUint, minLen: 0, maxLen: 2},
+	LocationQuery:    optionDef{valueFormat: valueString, minLen: 0, maxLen: 255},
+	Block2:           optionDef{valueFormat: valueUint, minLen: 0, maxLen: 3},
+	Block1:           optionDef{valueFormat: valueUint, minLen: 0, maxLen: 3},
+	Size2:            optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
+	ProxyURI:         optionDef{valueFormat: valueString, minLen: 1, maxLen: 1034},
+	ProxyScheme:      optionDef{valueFormat: valueString, minLen: 1, maxLen: 255},
+	Size1:            optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
+	Echo:             optionDef{valueFormat: valueOpaque, minLen: 1, maxLen: 40},
+	NoResponse:       optionDef{valueFormat: valueUint, minLen: 0, maxLen: 1},
+	RequestTagOption: optionDef{valueFormat: valueOpaque, minLen: 0, maxLen: 8},
+	Origin:           optionDef{valueFormat: valueString, minLen: 1, maxLen: 255},
+	CompressedPath:   optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
+	PinningSessionID: optionDef{valueFormat: valueOpaque, minLen: 1, maxLen: 16},
+	RequestSeqNum:    optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
+	ServerDraining:   optionDef{valueFormat: valueUint, minLen: 0, maxLen: 1},
+	PayloadCRC:       optionDef{valueFormat: valueUint, minLen: 0, maxLen: 4},
 }
 
 // MediaType specifies the content format of a message.
@@ -258,6 +290,7 @@ const (
 	AppJsonMergePatch MediaType = 52    //application/merge-patch+json (RFC7396)
 	AppCBOR           MediaType = 60    //application/cbor (RFC 7049)
 	AppCWT            MediaType = 61    //application/cwt
+	AppMultipartCore  MediaType = 62    //application/multipart-core (RFC 8710)
 	AppCoseEncrypt    MediaType = 96    //application/cose; cose-type="cose-encrypt" (RFC 8152)
 	AppCoseMac        MediaType = 97    //application/cose; cose-type="cose-mac" (RFC 8152)
 	AppCoseSign       MediaType = 98    //application/cose; cose-type="cose-sign" (RFC 8152)
@@ -297,6 +330,8 @@ func (c MediaType) String() string {
 		return "application/cbor" // (RFC 7049)
 	case AppCWT:
 		return "application/cwt"
+	case AppMultipartCore:
+		return "application/multipart-core" // (RFC 8710)
 	case AppCoseEncrypt:
 		return "application/cose; cose-type=\"cose-encrypt\"" // (RFC 8152)
 	case AppCoseMac:
@@ -391,6 +426,37 @@ func (o option) writeData(buf io.Writer) error {
 	return encodeInt(buf, v)
 }
 
+// putInt writes v to buf by minimal count of bytes, see lengthInt.
+func putInt(buf []byte, v uint32) int {
+	n := lengthInt(v)
+	for i := n - 1; i >= 0; i-- {
+		buf[i] = byte(v)
+		v >>= 8
+	}
+	return n
+}
+
+// marshalData writes value of option to buf, the value must be valid by toBytesLength.
+func (o option) marshalData(buf []byte) int {
+	switch i := o.Value.(type) {
+	case string:
+		return copy(buf, i)
+	case []byte:
+		return copy(buf, i)
+	case MediaType:
+		return putInt(buf, uint32(i))
+	case int:
+		return putInt(buf, uint32(i))
+	case int32:
+		return putInt(buf, uint32(i))
+	case uint:
+		return putInt(buf, uint32(i))
+	case uint32:
+		return putInt(buf, i)
+	}
+	return 0
+}
+
 func (o option) toBytesLength() (int, error) {
 	var v uint32
 
@@ -461,6 +527,15 @@ func (o options) Swap(i, j int) {
 	o[i], o[j] = o[j], o[i]
 }
 
+// sortOptions sorts options by ID like sort.Stable, but without allocation.
+func sortOptions(o options) {
+	for i := 1; i < len(o); i++ {
+		for j := i; j > 0 && o[j].ID < o[j-1].ID; j-- {
+			o[j], o[j-1] = o[j-1], o[j]
+		}
+	}
+}
+
 func (o options) Remove(oid OptionID) options {
 	idx := 0
 	for i := 0; i < len(o); i++ {
@@ -691,9 +766,13 @@ const (
 	extoptWordCode   = 14
 	extoptWordAddend = 269
 	extoptError      = 15
+
+	// maxOptionLength is the largest length encodable by extended option header.
+	maxOptionLength = 0xffff + extoptWordAddend
+	maxOptionID     = 0xffff
 )
 
-func writeOpt(o option, buf io.Writer, delta int) {
+func writeOpt(o option, buf io.Writer, delta int) error {
 	/*
 	     0   1   2   3   4   5   6   7
 	   +---------------+---------------+
@@ -743,19 +822,54 @@ func writeOpt(o option, buf io.Writer, delta int) {
 
 	len, err := o.toBytesLength()
 	if err != nil {
-		log.Fatal(err)
-	} else {
-		writeOptHeader(delta, len)
-		o.writeData(buf)
+		return err
+	}
+	if len > maxOptionLength {
+		return ErrOptionTooLong
+	}
+	writeOptHeader(delta, len)
+	return o.writeData(buf)
+}
+
+func putOptHeaderExt(buf []byte, opt, ext int) int {
+	switch opt {
+	case extoptByteCode:
+		buf[0] = byte(ext)
+		return 1
+	case extoptWordCode:
+		binary.BigEndian.PutUint16(buf, uint16(ext))
+		return 2
+	}
+	return 0
+}
+
+// marshalOpts writes sorted options to buf which has space for bytesLengthOpts of them.
+func marshalOpts(buf []byte, opts options) int {
+	n := 0
+	prev := 0
+	for _, o := range opts {
+		length, _ := o.toBytesLength()
+		d, dx := extendOpt(int(o.ID) - prev)
+		l, lx := extendOpt(length)
+		buf[n] = byte(d<<4) | byte(l)
+		n++
+		n += putOptHeaderExt(buf[n:], d, dx)
+		n += putOptHeaderExt(buf[n:], l, lx)
+		n += o.marshalData(buf[n:])
+		prev = int(o.ID)
 	}
+	return n
 }
 
-func writeOpts(buf io.Writer, opts options) {
+func writeOpts(buf io.Writer, opts options) error {
 	prev := 0
 	for _, o := range opts {
-		writeOpt(o, buf, int(o.ID)-prev)
+		if err := writeOpt(o, buf, int(o.ID)-prev); err != nil {
+			return err
+		}
 		prev = int(o.ID)
 	}
+	return nil
 }
 
 func extendOpt(opt int) (int, int) {
@@ -794,7 +908,7 @@ func lengthOptHeader(delta, length int) int {
 	return res
 }
 
-func lengthOpt(o option, delta int) int {
+func lengthOpt(o option, delta int) (int, error) {
 	/*
 	     0   1   2   3   4   5   6   7
 	   +---------------+---------------+
@@ -825,27 +939,36 @@ func lengthOpt(o option, delta int) int {
 
 	res, err := o.toBytesLength()
 	if err != nil {
-		log.Fatal(err)
-	} else {
-		res = res + lengthOptHeader(delta, res)
+		return 0, err
 	}
-	return res
+	if res > maxOptionLength {
+		return 0, ErrOptionTooLong
+	}
+	return res + lengthOptHeader(delta, res), nil
 }
 
-func bytesLengthOpts(opts options) int {
+func bytesLengthOpts(opts options) (int, error) {
 	length := 0
 	prev := 0
 	for _, o := range opts {
-		length = length + lengthOpt(o, int(o.ID)-prev)
+		l, err := lengthOpt(o, int(o.ID)-prev)
+		if err != nil {
+			return 0, err
+		}
+		length = length + l
 		prev = int(o.ID)
 	}
-	return length
+	return length, nil
 }
 
+// initialOptionsCap is capacity of options of parsed message, most messages fit it without growing.
+const initialOptionsCap = 8
+
 // parseBody extracts the options and payload from a byte slice.  The supplied
 // byte slice contains everything following the message header (everything
-// after the token).
-func parseBody(optionDefs map[OptionID]optionDef, data []byte) (options, []byte, error) {
+// after the token). Options are appended to opts, eg. emptied options of pooled message.
+// Payload and opaque option values are not copied, they refer to data.
+func parseBody(optionDefs map[OptionID]optionDef, data []byte, opts options) (options, []byte, error) {
 	prev := 0
 
 	parseExtOpt := func(opt int) (int, error) {
@@ -866,8 +989,6 @@ func parseBody(optionDefs map[OptionID]optionDef, data []byte) (options, []byte,
 		return opt, nil
 	}
 
-	var opts options
-
 	for len(data) > 0 {
 		if data[0] == 0xff {
 			data = data[1:]
@@ -896,12 +1017,18 @@ func parseBody(optionDefs map[OptionID]optionDef, data []byte) (options, []byte,
 			return nil, nil, ErrMessageTruncated
 		}
 
+		if prev+delta > maxOptionID {
+			return nil, nil, ErrOptionGapTooLarge
+		}
 		oid := OptionID(prev + delta)
 		opval := parseOptionValue(optionDefs, oid, data[:length])
 		data = data[length:]
 		prev = int(oid)
 
 		if opval != nil {
+			if opts == nil {
+				opts = make(options, 0, initialOptionsCap)
+			}
 			opt := option{ID: oid, Value: opval}
 			opts = append(opts, opt)
 		}
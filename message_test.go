@@ -3,8 +3,11 @@ package coap
 import (
 	"bytes"
 	"fmt"
+	"math/rand"
 	"reflect"
+	"sort"
 	"testing"
+	"testing/quick"
 )
 
 // assertEqualMessages compares the e(xptected) message to the a(ctual) message
@@ -1172,3 +1175,191 @@ func TestSetCode(t *testing.T) {
 		t.Fatalf("Expected\n%#v\ngot\n%#v", exp, buf.Bytes())
 	}
 }
+
+var optionExtBoundaries = []struct {
+	value int
+	hdr   []byte // nibble followed by extended bytes
+}{
+	{12, []byte{12}},
+	{13, []byte{13, 0}},
+	{14, []byte{13, 1}},
+	{268, []byte{13, 255}},
+	{269, []byte{14, 0, 0}},
+	{65804, []byte{14, 0xff, 0xff}},
+}
+
+func TestOptionDeltaExtendedEncoding(t *testing.T) {
+	for _, b := range optionExtBoundaries {
+		if b.value > maxOptionID {
+			continue
+		}
+		msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET})
+		msg.AddOption(OptionID(b.value), []byte{})
+		buf := &bytes.Buffer{}
+		if err := msg.MarshalBinary(buf); err != nil {
+			t.Fatalf("delta %v: Error encoding request: %v", b.value, err)
+		}
+		exp := append([]byte{b.hdr[0] << 4}, b.hdr[1:]...)
+		if got := buf.Bytes()[4:]; !bytes.Equal(exp, got) {
+			t.Errorf("delta %v: Expected\n%#v\ngot\n%#v", b.value, exp, got)
+		}
+		parsed, err := ParseDgramMessage(buf.Bytes())
+		if err != nil {
+			t.Fatalf("delta %v: Error parsing request: %v", b.value, err)
+		}
+		if opts := parsed.AllOptions(); len(opts) != 1 || opts[0].ID != OptionID(b.value) {
+			t.Errorf("delta %v: Expected one option with ID %v, got %v", b.value, b.value, opts)
+		}
+	}
+}
+
+func TestOptionDeltaExtendedDecodingOverflow(t *testing.T) {
+	// option 1000 followed by delta 65804 exceeds 16 bits of option number
+	data := []byte{0x40, 0x01, 0x00, 0x00, 0xe0, 0x02, 0xdb, 0xe0, 0xff, 0xff}
+	_, err := ParseDgramMessage(data)
+	if err != ErrOptionGapTooLarge {
+		t.Errorf("Expected %v, got %v", ErrOptionGapTooLarge, err)
+	}
+}
+
+func TestOptionLengthExtendedEncoding(t *testing.T) {
+	// option 2 is not defined, value is kept as opaque
+	const id = OptionID(2)
+	for _, b := range optionExtBoundaries {
+		value := bytes.Repeat([]byte{0xab}, b.value)
+		msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET})
+		msg.AddOption(id, value)
+		buf := &bytes.Buffer{}
+		if err := msg.MarshalBinary(buf); err != nil {
+			t.Fatalf("length %v: Error encoding request: %v", b.value, err)
+		}
+		exp := append([]byte{byte(id)<<4 | b.hdr[0]}, b.hdr[1:]...)
+		if got := buf.Bytes()[4 : 4+len(exp)]; !bytes.Equal(exp, got) {
+			t.Errorf("length %v: Expected\n%#v\ngot\n%#v", b.value, exp, got)
+		}
+		if buf.Len() != 4+len(exp)+b.value {
+			t.Errorf("length %v: Expected message length %v, got %v", b.value, 4+len(exp)+b.value, buf.Len())
+		}
+		parsed, err := ParseDgramMessage(buf.Bytes())
+		if err != nil {
+			t.Fatalf("length %v: Error parsing request: %v", b.value, err)
+		}
+		if v, ok := parsed.Option(id).([]byte); !ok || !bytes.Equal(value, v) {
+			t.Errorf("length %v: Expected value of length %v, got %v", b.value, b.value, len(v))
+		}
+	}
+
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET})
+	msg.AddOption(id, make([]byte, maxOptionLength+1))
+	if err := msg.MarshalBinary(&bytes.Buffer{}); err != ErrOptionTooLong {
+		t.Errorf("Expected %v, got %v", ErrOptionTooLong, err)
+	}
+	tcp := NewTcpMessage(MessageParams{Code: GET})
+	tcp.AddOption(id, make([]byte, maxOptionLength+1))
+	if err := tcp.MarshalBinary(&bytes.Buffer{}); err != ErrOptionTooLong {
+		t.Errorf("Expected %v, got %v", ErrOptionTooLong, err)
+	}
+}
+
+// randomOptions are options not defined by RFC, so parser keeps their values as opaque.
+type randomOptions options
+
+func (randomOptions) Generate(r *rand.Rand, size int) reflect.Value {
+	opts := make(randomOptions, r.Intn(size+1))
+	for i := range opts {
+		id := OptionID(r.Intn(maxOptionID + 1))
+		for _, ok := coapOptionDefs[id]; ok; _, ok = coapOptionDefs[id] {
+			id++
+		}
+		var l int
+		switch r.Intn(4) {
+		case 0:
+			l = r.Intn(extoptByteAddend + 2)
+		case 1:
+			l = r.Intn(extoptWordAddend + 2)
+		case 2:
+			l = r.Intn(1024)
+		default:
+			l = extoptWordAddend + r.Intn(maxOptionLength-extoptWordAddend+1)
+			if r.Intn(4) != 0 {
+				l = r.Intn(64)
+			}
+		}
+		v := make([]byte, l)
+		r.Read(v)
+		opts[i] = option{ID: id, Value: v}
+	}
+	sort.SliceStable(opts, func(i, j int) bool { return opts[i].ID < opts[j].ID })
+	return reflect.ValueOf(opts)
+}
+
+func TestOptionsEncodingRoundTrip(t *testing.T) {
+	roundTrip := func(opts randomOptions) bool {
+		msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET})
+		for _, o := range opts {
+			msg.AddOption(o.ID, o.Value)
+		}
+		buf := &bytes.Buffer{}
+		if err := msg.MarshalBinary(buf); err != nil {
+			t.Logf("Error encoding request: %v", err)
+			return false
+		}
+		parsed, err := ParseDgramMessage(buf.Bytes())
+		if err != nil {
+			t.Logf("Error parsing request: %v", err)
+			return false
+		}
+		got := parsed.AllOptions()
+		if len(opts) == 0 {
+			return len(got) == 0
+		}
+		return reflect.DeepEqual(options(opts), got)
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMarshalToMatchesMarshalBinary(t *testing.T) {
+	marshal := func(opts randomOptions, payload []byte) bool {
+		msg := NewDgramMessage(MessageParams{Type: NonConfirmable, Code: POST, MessageID: 7, Token: []byte{1, 2, 3}, Payload: payload})
+		for _, o := range opts {
+			msg.AddOption(o.ID, o.Value)
+		}
+		buf := &bytes.Buffer{}
+		if err := msg.MarshalBinary(buf); err != nil {
+			t.Logf("Error encoding request: %v", err)
+			return false
+		}
+		data := make([]byte, buf.Len()+10)
+		n, err := msg.MarshalTo(data)
+		if err != nil {
+			t.Logf("Error encoding request to buffer: %v", err)
+			return false
+		}
+		return bytes.Equal(buf.Bytes(), data[:n])
+	}
+	if err := quick.Check(marshal, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMarshalToShortBuffer(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1, Payload: []byte("abc")})
+	msg.SetPathString("/a/b")
+	size, err := msg.ToBytesLength()
+	if err != nil {
+		t.Fatalf("Error computing size: %v", err)
+	}
+	if _, err := msg.MarshalTo(make([]byte, size-1)); err != ErrShortBuffer {
+		t.Errorf("Expected %v, got %v", ErrShortBuffer, err)
+	}
+	if n, err := msg.MarshalTo(make([]byte, size)); err != nil || n != size {
+		t.Errorf("Expected %v bytes, got %v: %v", size, n, err)
+	}
+
+	msg.SetOption(ContentFormat, 1.5)
+	if _, err := msg.MarshalTo(make([]byte, 100)); err == nil {
+		t.Error("Expected error of invalid option value")
+	}
+}
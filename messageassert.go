@@ -0,0 +1,107 @@
+package coap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func formatOptionValues(values []interface{}) string {
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		switch val := v.(type) {
+		case []byte:
+			s = append(s, "0x"+hex.EncodeToString(val))
+		case string:
+			s = append(s, fmt.Sprintf("%q", val))
+		default:
+			s = append(s, fmt.Sprintf("%v", val))
+		}
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+func optionValues(m Message) map[OptionID][]interface{} {
+	values := make(map[OptionID][]interface{})
+	for _, o := range m.AllOptions() {
+		values[o.ID] = append(values[o.ID], o.Value)
+	}
+	return values
+}
+
+// diffMessages returns human-readable differences of messages, one per line.
+func diffMessages(want, got Message) []string {
+	var diffs []string
+	add := func(field string, w, g interface{}) {
+		diffs = append(diffs, fmt.Sprintf("%v: want %v, got %v", field, w, g))
+	}
+	if want.Type() != got.Type() {
+		add("type", want.Type(), got.Type())
+	}
+	if want.Code() != got.Code() {
+		add("code", want.Code(), got.Code())
+	}
+	if want.MessageID() != got.MessageID() {
+		add("message ID", want.MessageID(), got.MessageID())
+	}
+	if !bytes.Equal(want.Token(), got.Token()) {
+		add("token", "0x"+hex.EncodeToString(want.Token()), "0x"+hex.EncodeToString(got.Token()))
+	}
+	wantOpts, gotOpts := optionValues(want), optionValues(got)
+	ids := make([]OptionID, 0, len(wantOpts)+len(gotOpts))
+	for id := range wantOpts {
+		ids = append(ids, id)
+	}
+	for id := range gotOpts {
+		if _, ok := wantOpts[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if !reflect.DeepEqual(wantOpts[id], gotOpts[id]) {
+			add("option "+optionName(id), formatOptionValues(wantOpts[id]), formatOptionValues(gotOpts[id]))
+		}
+	}
+	if !bytes.Equal(want.Payload(), got.Payload()) {
+		add("payload", "0x"+hex.EncodeToString(want.Payload()), "0x"+hex.EncodeToString(got.Payload()))
+	}
+	return diffs
+}
+
+// AssertMessageEqual reports error to t with differing fields when messages are not equal.
+// Type, code, message ID, token, options and payload are compared.
+func AssertMessageEqual(t testing.TB, want, got Message) bool {
+	t.Helper()
+	switch {
+	case want == nil && got == nil:
+		return true
+	case want == nil || got == nil:
+		t.Errorf("messages are not equal: want %v, got %v", want, got)
+		return false
+	}
+	diffs := diffMessages(want, got)
+	if len(diffs) == 0 {
+		return true
+	}
+	t.Errorf("messages are not equal:\n\t%v", strings.Join(diffs, "\n\t"))
+	return false
+}
+
+// AssertMessageCode reports error to t when message has a different code.
+func AssertMessageCode(t testing.TB, code COAPCode, msg Message) bool {
+	t.Helper()
+	if msg == nil {
+		t.Errorf("message code: want %v, got nil message", code)
+		return false
+	}
+	if msg.Code() != code {
+		t.Errorf("message code: want %v, got %v", code, msg.Code())
+		return false
+	}
+	return true
+}
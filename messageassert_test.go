@@ -0,0 +1,54 @@
+package coap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingTB) Helper() {}
+
+func (t *recordingTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func newAssertMessage(code COAPCode) Message {
+	m := NewDgramMessage(MessageParams{Type: Acknowledgement, Code: code, MessageID: 7, Token: []byte{0xab}, Payload: []byte("hi")})
+	m.SetOption(ContentFormat, TextPlain)
+	m.SetPathString("a/b")
+	return m
+}
+
+func TestAssertMessageEqual(t *testing.T) {
+	rt := &recordingTB{TB: t}
+	assert.True(t, AssertMessageEqual(rt, newAssertMessage(Content), newAssertMessage(Content)))
+	assert.Empty(t, rt.errors)
+
+	got := newAssertMessage(NotFound)
+	got.SetToken([]byte{0xcd})
+	got.SetPathString("a/c")
+	got.SetOption(MaxAge, uint32(60))
+	got.SetPayload([]byte{0x01})
+	assert.False(t, AssertMessageEqual(rt, newAssertMessage(Content), got))
+	assert.Equal(t, []string{"messages are not equal:\n" +
+		"\tcode: want Content, got NotFound\n" +
+		"\ttoken: want 0xab, got 0xcd\n" +
+		"\toption Uri-Path: want [\"a\", \"b\"], got [\"a\", \"c\"]\n" +
+		"\toption Max-Age: want [], got [60]\n" +
+		"\tpayload: want 0x6869, got 0x01"}, rt.errors)
+}
+
+func TestAssertMessageCode(t *testing.T) {
+	rt := &recordingTB{TB: t}
+	assert.True(t, AssertMessageCode(rt, Content, newAssertMessage(Content)))
+	assert.Empty(t, rt.errors)
+
+	assert.False(t, AssertMessageCode(rt, Content, newAssertMessage(NotFound)))
+	assert.Equal(t, []string{"message code: want Content, got NotFound"}, rt.errors)
+}
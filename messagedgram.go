@@ -1,10 +1,8 @@
 package coap
 
 import (
-	"bytes"
 	"encoding/binary"
 	"io"
-	"sort"
 )
 
 // DgramMessage implements Message interface.
@@ -36,9 +34,30 @@ func (m *DgramMessage) SetMessageID(messageID uint16) {
 
 // MarshalBinary produces the binary form of this DgramMessage.
 func (m *DgramMessage) MarshalBinary(buf io.Writer) error {
-	tmpbuf := []byte{0, 0}
-	binary.BigEndian.PutUint16(tmpbuf, m.MessageID())
+	data, err := marshalWriteBuffer(m)
+	if err != nil {
+		return err
+	}
+	_, err = buf.Write(*data)
+	putWriteBuffer(data)
+	return err
+}
 
+// MarshalTo writes the binary form of this DgramMessage to buf and returns count of written bytes,
+// it doesn't allocate. It returns ErrShortBuffer when buf is shorter than ToBytesLength.
+func (m *DgramMessage) MarshalTo(buf []byte) (int, error) {
+	size, err := m.ToBytesLength()
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) < size {
+		return 0, ErrShortBuffer
+	}
+	return m.marshalTo(buf), nil
+}
+
+// marshalTo writes message to buf of ToBytesLength at least.
+func (m *DgramMessage) marshalTo(buf []byte) int {
 	/*
 	     0                   1                   2                   3
 	    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
@@ -53,37 +72,40 @@ func (m *DgramMessage) MarshalBinary(buf io.Writer) error {
 	   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 	*/
 
-	buf.Write([]byte{
-		(1 << 6) | (uint8(m.Type()) << 4) | uint8(0xf&len(m.MessageBase.token)),
-		byte(m.MessageBase.code),
-		tmpbuf[0], tmpbuf[1],
-	})
-
-	if len(m.MessageBase.token) > MaxTokenSize {
-		return ErrInvalidTokenLen
-	}
-	buf.Write(m.MessageBase.token)
-
-	sort.Stable(&m.MessageBase.opts)
-	writeOpts(buf, m.MessageBase.opts)
-
+	buf[0] = (1 << 6) | (uint8(m.Type()) << 4) | uint8(0xf&len(m.MessageBase.token))
+	buf[1] = byte(m.MessageBase.code)
+	binary.BigEndian.PutUint16(buf[2:4], m.messageID)
+	n := 4 + copy(buf[4:], m.MessageBase.token)
+	n += marshalOpts(buf[n:], m.MessageBase.opts)
 	if len(m.MessageBase.payload) > 0 {
-		buf.Write([]byte{0xff})
+		buf[n] = 0xff
+		n++
+		n += copy(buf[n:], m.MessageBase.payload)
 	}
+	return n
+}
 
-	buf.Write(m.MessageBase.payload)
-
+// ValidateVersion checks that datagram carries CoAP version 1 (RFC 7252 section 3). Datagrams of
+// other versions are silently discarded by server and client. CoAP over TCP has no version field.
+func ValidateVersion(data []byte) error {
+	if len(data) < 1 {
+		return ErrMessageTruncated
+	}
+	if data[0]>>6 != 1 {
+		return ErrMessageInvalidVersion
+	}
 	return nil
 }
 
-// UnmarshalBinary parses the given binary slice as a DgramMessage.
+// UnmarshalBinary parses the given binary slice as a DgramMessage. Payload and opaque options
+// of the message refer to data, they are not copied.
 func (m *DgramMessage) UnmarshalBinary(data []byte) error {
 	if len(data) < 4 {
 		return ErrMessageTruncated
 	}
 
-	if data[0]>>6 != 1 {
-		return ErrMessageInvalidVersion
+	if err := ValidateVersion(data); err != nil {
+		return err
 	}
 
 	m.MessageBase.typ = COAPType((data[0] >> 4) & 0x3)
@@ -104,7 +126,12 @@ func (m *DgramMessage) UnmarshalBinary(data []byte) error {
 	copy(m.MessageBase.token, data[4:4+tokenLen])
 	b := data[4+tokenLen:]
 
-	o, p, err := parseBody(coapOptionDefs, b)
+	opts := m.MessageBase.opts
+	if len(opts) > 0 {
+		// options may be shared, only emptied options of pooled message are reused
+		opts = nil
+	}
+	o, p, err := parseBody(coapOptionDefs, b, opts)
 	if err != nil {
 		return err
 	}
@@ -123,10 +150,5 @@ func ParseDgramMessage(data []byte) (*DgramMessage, error) {
 
 // ToBytesLength gets the length of the message
 func (m *DgramMessage) ToBytesLength() (int, error) {
-	buf := bytes.NewBuffer(make([]byte, 0, 1024))
-	if err := m.MarshalBinary(buf); err != nil {
-		return 0, err
-	}
-
-	return len(buf.Bytes()), nil
+	return wireSize(m)
 }
@@ -0,0 +1,64 @@
+package coap
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// messageIDRetries is count of additional calls of generator when generated ID is in use.
+const messageIDRetries = 3
+
+type usedMessageID struct {
+	id      uint16
+	expires time.Time
+}
+
+// messageIDAllocator allocates message IDs by custom generator and refuses IDs used
+// for the peer within EXCHANGE_LIFETIME.
+type messageIDAllocator struct {
+	generate func(peer net.Addr) uint16
+	peer     net.Addr
+	lifetime time.Duration
+
+	lock  sync.Mutex
+	used  map[uint16]time.Time
+	order []usedMessageID // used IDs ordered by expiration
+}
+
+func newMessageIDAllocator(generate func(peer net.Addr) uint16, peer net.Addr) *messageIDAllocator {
+	return &messageIDAllocator{
+		generate: generate,
+		peer:     peer,
+		lifetime: DefaultExchangeLifetime,
+		used:     make(map[uint16]time.Time),
+	}
+}
+
+func (a *messageIDAllocator) next() (uint16, error) {
+	for i := 0; i <= messageIDRetries; i++ {
+		id := a.generate(a.peer)
+		if a.reserve(id, time.Now()) {
+			return id, nil
+		}
+	}
+	return 0, ErrMessageIDInUse
+}
+
+func (a *messageIDAllocator) reserve(id uint16, now time.Time) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for len(a.order) > 0 && !now.Before(a.order[0].expires) {
+		if a.used[a.order[0].id] == a.order[0].expires {
+			delete(a.used, a.order[0].id)
+		}
+		a.order = a.order[1:]
+	}
+	if _, ok := a.used[id]; ok {
+		return false
+	}
+	expires := now.Add(a.lifetime)
+	a.used[id] = expires
+	a.order = append(a.order, usedMessageID{id: id, expires: expires})
+	return true
+}
@@ -0,0 +1,79 @@
+package coap
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageIDAllocatorRetry(t *testing.T) {
+	ids := []uint16{1, 1, 1, 2}
+	var calls int
+	a := newMessageIDAllocator(func(peer net.Addr) uint16 {
+		id := ids[calls%len(ids)]
+		calls++
+		return id
+	}, nil)
+
+	id, err := a.next()
+	require.NoError(t, err)
+	require.Equal(t, uint16(1), id)
+	// 1 is in use, generator is called again until it returns 2
+	id, err = a.next()
+	require.NoError(t, err)
+	require.Equal(t, uint16(2), id)
+	require.Equal(t, 4, calls)
+}
+
+func TestMessageIDAllocatorExpiration(t *testing.T) {
+	a := newMessageIDAllocator(func(peer net.Addr) uint16 { return 7 }, nil)
+	now := time.Now()
+	require.True(t, a.reserve(7, now))
+	require.False(t, a.reserve(7, now.Add(a.lifetime-time.Second)))
+	require.True(t, a.reserve(7, now.Add(a.lifetime)))
+	require.Len(t, a.order, 1)
+}
+
+func TestClientMessageIDGeneratorCollision(t *testing.T) {
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("hello"))
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	var calls int32
+	client := Client{MessageIDGenerator: func(peer net.Addr) uint16 {
+		require.Equal(t, addr, peer.String())
+		atomic.AddInt32(&calls, 1)
+		return 42
+	}}
+	co, err := client.Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = co.Get("/a")
+		}(i)
+	}
+	wg.Wait()
+
+	if errs[0] != nil {
+		errs[0], errs[1] = errs[1], errs[0]
+	}
+	require.NoError(t, errs[0])
+	require.Equal(t, ErrMessageIDInUse, errs[1])
+	require.Equal(t, int32(1+1+messageIDRetries), atomic.LoadInt32(&calls))
+}
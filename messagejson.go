@@ -0,0 +1,187 @@
+package coap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+var optionNames = map[OptionID]string{
+	IfMatch:          "If-Match",
+	URIHost:          "Uri-Host",
+	ETag:             "ETag",
+	IfNoneMatch:      "If-None-Match",
+	Observe:          "Observe",
+	URIPort:          "Uri-Port",
+	LocationPath:     "Location-Path",
+	OSCORE:           "OSCORE",
+	URIPath:          "Uri-Path",
+	ContentFormat:    "Content-Format",
+	MaxAge:           "Max-Age",
+	URIQuery:         "Uri-Query",
+	Accept:           "Accept",
+	LocationQuery:    "Location-Query",
+	Block2:           "Block2",
+	Block1:           "Block1",
+	Size2:            "Size2",
+	ProxyURI:         "Proxy-Uri",
+	ProxyScheme:      "Proxy-Scheme",
+	Size1:            "Size1",
+	Echo:             "Echo",
+	NoResponse:       "No-Response",
+	RequestTagOption: "Request-Tag",
+	Origin:           "Origin",
+	CompressedPath:   "Compressed-Path",
+	PinningSessionID: "Pinning-Session-ID",
+	RequestSeqNum:    "Request-Seq-Num",
+	ServerDraining:   "Server-Draining",
+	PayloadCRC:       "Payload-CRC",
+}
+
+type jsonOption struct {
+	ID    OptionID        `json:"id"`
+	Name  string          `json:"name,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type jsonMessage struct {
+	TCP       bool         `json:"tcp,omitempty"`
+	Type      string       `json:"type,omitempty"`
+	Code      string       `json:"code"`
+	MessageID uint16       `json:"messageID,omitempty"`
+	Token     []byte       `json:"token,omitempty"`
+	Options   []jsonOption `json:"options,omitempty"`
+	Payload   []byte       `json:"payload,omitempty"`
+}
+
+func encodeJSONOptionValue(v interface{}) (json.RawMessage, error) {
+	switch val := v.(type) {
+	case MediaType:
+		return json.Marshal(uint32(val))
+	case uint32, string:
+		return json.Marshal(val)
+	case []byte:
+		if len(val) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(base64.StdEncoding.EncodeToString(val))
+	}
+	return nil, fmt.Errorf("invalid type for option: %T", v)
+}
+
+func decodeJSONOptionValue(id OptionID, data json.RawMessage) (interface{}, error) {
+	format := valueUnknown
+	if def, ok := coapOptionDefs[id]; ok {
+		format = def.valueFormat
+	}
+	if len(data) == 0 {
+		if format == valueUint {
+			return uint32(0), nil
+		}
+		return []byte{}, nil
+	}
+	if format == valueUnknown {
+		// json number of unknown option is uint
+		var v uint32
+		if err := json.Unmarshal(data, &v); err == nil {
+			return v, nil
+		}
+		format = valueOpaque
+	}
+	switch format {
+	case valueUint:
+		var v uint32
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		if id == ContentFormat || id == Accept {
+			return MediaType(v), nil
+		}
+		return v, nil
+	case valueString:
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		var v []byte
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+}
+
+// MessageToJSON encodes message to JSON for logging and debugging. Options are sorted by ID
+// and binary fields are base64 encoded, so output is deterministic.
+func MessageToJSON(msg Message) ([]byte, error) {
+	opts := append(options(nil), msg.AllOptions()...)
+	sort.Stable(opts)
+	m := jsonMessage{
+		Code:    msg.Code().String(),
+		Token:   msg.Token(),
+		Payload: msg.Payload(),
+	}
+	if _, ok := msg.(*TcpMessage); ok {
+		m.TCP = true
+	} else {
+		m.Type = msg.Type().String()
+		m.MessageID = msg.MessageID()
+	}
+	for _, o := range opts {
+		v, err := encodeJSONOptionValue(o.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode option %v: %v", o.ID, err)
+		}
+		m.Options = append(m.Options, jsonOption{ID: o.ID, Name: optionNames[o.ID], Value: v})
+	}
+	return json.Marshal(m)
+}
+
+func parseJSONName(names *[256]string, name string) (uint8, bool) {
+	for i, n := range names {
+		if n == name {
+			return uint8(i), true
+		}
+	}
+	return 0, false
+}
+
+// MessageFromJSON decodes message encoded by MessageToJSON.
+func MessageFromJSON(data []byte) (Message, error) {
+	var m jsonMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	code, ok := parseJSONName(&codeNames, m.Code)
+	if !ok {
+		return nil, fmt.Errorf("invalid code: %v", m.Code)
+	}
+	var typ uint8
+	if !m.TCP {
+		if typ, ok = parseJSONName(&typeNames, m.Type); !ok {
+			return nil, fmt.Errorf("invalid type: %v", m.Type)
+		}
+	}
+	p := MessageParams{
+		Type:      COAPType(typ),
+		Code:      COAPCode(code),
+		MessageID: m.MessageID,
+		Token:     m.Token,
+		Payload:   m.Payload,
+	}
+	var msg Message = NewDgramMessage(p)
+	if m.TCP {
+		msg = NewTcpMessage(p)
+	}
+	for _, o := range m.Options {
+		v, err := decodeJSONOptionValue(o.ID, o.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode option %v: %v", o.ID, err)
+		}
+		msg.AddOption(o.ID, v)
+	}
+	return msg, nil
+}
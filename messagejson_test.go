@@ -0,0 +1,71 @@
+package coap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessageJSONRoundTrip(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{
+		Type:      Confirmable,
+		Code:      PUT,
+		MessageID: 12345,
+		Token:     []byte{0xde, 0xad, 0xbe, 0xef},
+		Payload:   []byte("payload"),
+	})
+	msg.SetOption(IfMatch, []byte{1, 2})
+	msg.SetOption(URIHost, "example.com")
+	msg.SetOption(ETag, []byte{3, 4})
+	msg.SetOption(IfNoneMatch, []byte{})
+	msg.SetOption(Observe, uint32(1))
+	msg.SetOption(URIPort, uint32(5683))
+	msg.AddOption(LocationPath, "loc")
+	msg.SetPathString("/a/b")
+	msg.SetOption(ContentFormat, AppJSON)
+	msg.SetOption(MaxAge, uint32(60))
+	msg.SetQueryString("x=1&y=2")
+	msg.SetOption(Accept, AppCBOR)
+	msg.AddOption(LocationQuery, "q=1")
+	msg.SetOption(Block2, uint32(6))
+	msg.SetOption(Block1, uint32(14))
+	msg.SetOption(Size2, uint32(1024))
+	msg.SetOption(ProxyURI, "coap://proxy")
+	msg.SetOption(ProxyScheme, "coap")
+	msg.SetOption(Size1, uint32(2048))
+	msg.SetOption(NoResponse, uint32(2))
+
+	data, err := MessageToJSON(msg)
+	if err != nil {
+		t.Fatalf("cannot encode: %v", err)
+	}
+	again, err := MessageToJSON(msg)
+	if err != nil || string(again) != string(data) {
+		t.Fatalf("encoding is not deterministic")
+	}
+	decoded, err := MessageFromJSON(data)
+	if err != nil {
+		t.Fatalf("cannot decode %s: %v", data, err)
+	}
+	if decoded.Type() != msg.Type() || decoded.Code() != msg.Code() || decoded.MessageID() != msg.MessageID() {
+		t.Fatalf("header doesn't match: %s", data)
+	}
+	if !reflect.DeepEqual(decoded.Token(), msg.Token()) || !reflect.DeepEqual(decoded.Payload(), msg.Payload()) {
+		t.Fatalf("token or payload doesn't match: %s", data)
+	}
+	if !reflect.DeepEqual(decoded.AllOptions(), msg.AllOptions()) {
+		t.Fatalf("options don't match: %v != %v", decoded.AllOptions(), msg.AllOptions())
+	}
+
+	tcp := NewTcpMessage(MessageParams{Code: Content, Token: []byte{1}})
+	data, err = MessageToJSON(tcp)
+	if err != nil {
+		t.Fatalf("cannot encode: %v", err)
+	}
+	decoded, err = MessageFromJSON(data)
+	if err != nil {
+		t.Fatalf("cannot decode %s: %v", data, err)
+	}
+	if _, ok := decoded.(*TcpMessage); !ok || decoded.Code() != Content {
+		t.Fatalf("invalid tcp message decoded from %s", data)
+	}
+}
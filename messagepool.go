@@ -0,0 +1,173 @@
+package coap
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// maxDgramSize is size of buffer for reading of datagram.
+const maxDgramSize = int(^uint16(0))
+
+// dgramBuffers are read buffers of server without MessagePool. Datagram is copied out of them,
+// so parsed message doesn't retain whole buffer.
+var dgramBuffers = sync.Pool{New: func() interface{} {
+	buf := make([]byte, maxDgramSize)
+	return &buf
+}}
+
+// maxPooledWriteBuffer is capacity of largest buffer kept by writeBuffers.
+const maxPooledWriteBuffer = 16 * 1024
+
+// writeBuffers are buffers of datagrams serialized by marshalWriteBuffer.
+var writeBuffers = sync.Pool{New: func() interface{} {
+	buf := make([]byte, 0, 1500)
+	return &buf
+}}
+
+// marshalWriteBuffer serializes msg to buffer of writeBuffers, the buffer is returned by putWriteBuffer
+// after the datagram is written.
+func marshalWriteBuffer(msg Message) (*[]byte, error) {
+	buf := writeBuffers.Get().(*[]byte)
+	m, ok := msg.(*DgramMessage)
+	if !ok {
+		b := bytes.NewBuffer((*buf)[:0])
+		if err := msg.MarshalBinary(b); err != nil {
+			putWriteBuffer(buf)
+			return nil, err
+		}
+		*buf = b.Bytes()
+		return buf, nil
+	}
+	size, err := m.ToBytesLength()
+	if err != nil {
+		putWriteBuffer(buf)
+		return nil, err
+	}
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	*buf = (*buf)[:size]
+	m.marshalTo(*buf)
+	return buf, nil
+}
+
+func putWriteBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledWriteBuffer {
+		writeBuffers.Put(buf)
+	}
+}
+
+// MessagePoolStats contains counters of MessagePool.
+type MessagePoolStats struct {
+	// Hits is count of messages which were reused.
+	Hits uint64
+	// Misses is count of messages which were allocated because pool was empty.
+	Misses uint64
+}
+
+// MessagePool reuses datagram messages and read buffers of the server receive path
+// to reduce GC pressure under load.
+//
+// When server uses MessagePool, request message and its payload are returned to the pool
+// after handler returns, so handler must not retain Request.Msg, its token, options and payload
+// or use ResponseWriter asynchronously.
+type MessagePool struct {
+	messages sync.Pool
+	buffers  sync.Pool
+
+	hits   uint64
+	misses uint64
+}
+
+// NewMessagePool creates pool with initialSize pre-allocated messages.
+func NewMessagePool(initialSize int) *MessagePool {
+	p := &MessagePool{}
+	for i := 0; i < initialSize; i++ {
+		p.messages.Put(&DgramMessage{})
+	}
+	return p
+}
+
+// Get returns empty message from the pool.
+func (p *MessagePool) Get() *DgramMessage {
+	if msg, ok := p.messages.Get().(*DgramMessage); ok {
+		atomic.AddUint64(&p.hits, 1)
+		return msg
+	}
+	atomic.AddUint64(&p.misses, 1)
+	return &DgramMessage{}
+}
+
+// Put zeroes message and returns it to the pool. Capacity of its options is kept for reuse.
+func (p *MessagePool) Put(msg *DgramMessage) {
+	opts := msg.opts
+	for i := range opts {
+		opts[i] = option{}
+	}
+	*msg = DgramMessage{}
+	msg.opts = opts[:0]
+	p.messages.Put(msg)
+}
+
+// PoolStats returns hit/miss counters of the pool.
+func (p *MessagePool) PoolStats() MessagePoolStats {
+	return MessagePoolStats{
+		Hits:   atomic.LoadUint64(&p.hits),
+		Misses: atomic.LoadUint64(&p.misses),
+	}
+}
+
+func (p *MessagePool) getBuffer() *[]byte {
+	if buf, ok := p.buffers.Get().(*[]byte); ok {
+		return buf
+	}
+	buf := make([]byte, maxDgramSize)
+	return &buf
+}
+
+func (p *MessagePool) putBuffer(buf *[]byte) {
+	p.buffers.Put(buf)
+}
+
+// readBuffer returns buffer for reading of datagram.
+func (srv *Server) readBuffer() *[]byte {
+	if srv.MessagePool != nil {
+		return srv.MessagePool.getBuffer()
+	}
+	return dgramBuffers.Get().(*[]byte)
+}
+
+// parseDgramMessage parses datagram read to buf by readBuffer.
+func (srv *Server) parseDgramMessage(buf *[]byte, n int) (*DgramMessage, error) {
+	if err := ValidateVersion((*buf)[:n]); err != nil {
+		if err == ErrMessageInvalidVersion {
+			atomic.AddInt64(&srv.receivedWrongVersion, 1)
+		}
+		srv.releaseDgram(nil, buf)
+		return nil, err
+	}
+	if srv.MessagePool == nil {
+		data := make([]byte, n)
+		copy(data, (*buf)[:n])
+		dgramBuffers.Put(buf)
+		return ParseDgramMessage(data)
+	}
+	msg := srv.MessagePool.Get()
+	if err := msg.UnmarshalBinary((*buf)[:n]); err != nil {
+		srv.releaseDgram(msg, buf)
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (srv *Server) releaseDgram(msg *DgramMessage, buf *[]byte) {
+	if srv.MessagePool == nil {
+		dgramBuffers.Put(buf)
+		return
+	}
+	if msg != nil {
+		srv.MessagePool.Put(msg)
+	}
+	srv.MessagePool.putBuffer(buf)
+}
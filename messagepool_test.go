@@ -0,0 +1,135 @@
+package coap
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+	"github.com/stretchr/testify/require"
+)
+
+// runLocalUDPServer serves srv on local UDP port.
+func runLocalUDPServer(tb testing.TB, srv *Server) (string, func()) {
+	a, err := net.ResolveUDPAddr("udp", ":0")
+	require.NoError(tb, err)
+	pc, err := net.ListenUDP("udp", a)
+	require.NoError(tb, err)
+	connUDP := coapNet.NewConnUDP(pc, time.Millisecond*100, 2)
+	started := make(chan struct{})
+	if srv.NotifyStartedFunc == nil {
+		// Shutdown before the server started races with it
+		srv.NotifyStartedFunc = func() { close(started) }
+	} else {
+		close(started)
+	}
+	fin := make(chan error, 1)
+	go func() {
+		fin <- srv.activateAndServe(nil, nil, connUDP)
+		connUDP.Close()
+	}()
+	<-started
+	var once sync.Once
+	return pc.LocalAddr().String(), func() {
+		once.Do(func() {
+			srv.Shutdown()
+			<-fin
+		})
+	}
+}
+
+func TestMessagePoolPutZeroes(t *testing.T) {
+	p := NewMessagePool(1)
+	msg := p.Get()
+	require.NoError(t, msg.UnmarshalBinary(mustMarshal(t, newBenchMessage())))
+	p.Put(msg)
+	// emptied options keep capacity for reuse
+	require.Len(t, msg.opts, 0)
+	require.True(t, cap(msg.opts) > 0)
+	msg.opts = nil
+	require.Equal(t, DgramMessage{}, *msg)
+	// sync.Pool may drop items, eg. with -race
+	stats := p.PoolStats()
+	require.Equal(t, uint64(1), stats.Hits+stats.Misses)
+}
+
+func mustMarshal(t *testing.T, msg Message) []byte {
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, msg.MarshalBinary(buf))
+	return buf.Bytes()
+}
+
+// TestServerMessagePool is meant to be run with -race.
+func TestServerMessagePool(t *testing.T) {
+	pool := NewMessagePool(16)
+	srv := &Server{
+		MessagePool: pool,
+		Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+			w.SetContentFormat(TextPlain)
+			w.Write(append([]byte(r.Msg.PathString()+":"), r.Msg.Payload()...))
+		}),
+	}
+	addr, shutdown := runLocalUDPServer(t, srv)
+	defer shutdown()
+
+	const clients = 8
+	const requests = 50
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			co, err := Dial("udp", addr)
+			require.NoError(t, err)
+			defer co.Close()
+			for j := 0; j < requests; j++ {
+				path := fmt.Sprintf("c%v", i)
+				payload := fmt.Sprintf("r%v", j)
+				resp, err := co.Post("/"+path, TextPlain, bytes.NewBufferString(payload))
+				require.NoError(t, err)
+				require.Equal(t, path+":"+payload, string(resp.Payload()))
+			}
+		}(i)
+	}
+	wg.Wait()
+	stats := pool.PoolStats()
+	require.Equal(t, uint64(clients*requests), stats.Hits+stats.Misses)
+}
+
+// Measured on a single vCPU Intel Xeon Linux VM (client and server in the process):
+//
+//	BenchmarkServerThroughputMessagePool/without_pool   3794 B/op   85 allocs/op
+//	BenchmarkServerThroughputMessagePool/with_pool      3482 B/op   82 allocs/op
+//
+// The pool saves the read buffer and the message of every datagram, remaining allocations
+// come from the client, UDP session lookup and request context.
+func BenchmarkServerThroughputMessagePool(b *testing.B) {
+	for _, pool := range []*MessagePool{nil, NewMessagePool(64)} {
+		name := "without pool"
+		if pool != nil {
+			name = "with pool"
+		}
+		b.Run(name, func(b *testing.B) {
+			addr, shutdown := runLocalUDPServer(b, &Server{MessagePool: pool, Handler: HandlerFunc(benchHandler)})
+			defer shutdown()
+			co, err := Dial("udp", addr)
+			require.NoError(b, err)
+			defer co.Close()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req, err := co.NewGetRequest("/empty")
+				if err != nil {
+					b.Fatalf("cannot create request: %v", err)
+				}
+				req.SetType(NonConfirmable)
+				if _, err := co.Exchange(req); err != nil {
+					b.Fatalf("cannot exchange: %v", err)
+				}
+			}
+		})
+	}
+}
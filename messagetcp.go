@@ -156,7 +156,10 @@ func (m *TcpMessage) MarshalBinary(buf io.Writer) error {
 		//for separator 0xff
 		payloadLen++
 	}
-	optionsLen := bytesLengthOpts(m.MessageBase.opts)
+	optionsLen, err := bytesLengthOpts(m.MessageBase.opts)
+	if err != nil {
+		return err
+	}
 	bufLen := payloadLen + optionsLen
 	var lenNib uint8
 	var extLenBytes []byte
@@ -206,7 +209,9 @@ func (m *TcpMessage) MarshalBinary(buf io.Writer) error {
 
 	bufLen = bufLen + len(hdr)
 	buf.Write(hdr[:hdrLen])
-	writeOpts(buf, m.MessageBase.opts)
+	if err := writeOpts(buf, m.MessageBase.opts); err != nil {
+		return err
+	}
 	if len(m.MessageBase.payload) > 0 {
 		buf.Write([]byte{0xff})
 		buf.Write(m.MessageBase.payload)
@@ -320,7 +325,7 @@ func parseTcpOptionsPayload(mti msgTcpInfo, b []byte) (options, []byte, error) {
 		optionDefs = signalAbortOptionDefs
 	}
 
-	o, p, err := parseBody(optionDefs, b)
+	o, p, err := parseBody(optionDefs, b, nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -337,12 +342,7 @@ func (m *TcpMessage) fill(mti msgTcpInfo, o options, p []byte) {
 }
 
 func (m *TcpMessage) ToBytesLength() (int, error) {
-	buf := bytes.NewBuffer(make([]byte, 0, 1024))
-	if err := m.MarshalBinary(buf); err != nil {
-		return 0, err
-	}
-
-	return len(buf.Bytes()), nil
+	return wireSize(m)
 }
 
 type contextBytesReader struct {
@@ -0,0 +1,148 @@
+package coap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RequestMetrics contains timestamps of processing of request.
+type RequestMetrics struct {
+	lock             sync.Mutex
+	startedAt        time.Time
+	writeFirstByteAt time.Time
+	writeLastByteAt  time.Time
+}
+
+func newRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{startedAt: time.Now()}
+}
+
+// StartedAt returns time when processing of request started.
+func (m *RequestMetrics) StartedAt() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.startedAt
+}
+
+// WriteFirstByteAt returns time when the first response was written, it's zero when nothing was written.
+func (m *RequestMetrics) WriteFirstByteAt() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.writeFirstByteAt
+}
+
+// WriteLastByteAt returns time when writing of response was finished.
+func (m *RequestMetrics) WriteLastByteAt() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.writeLastByteAt
+}
+
+// TTFB returns time to first byte of response.
+func (m *RequestMetrics) TTFB() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.writeFirstByteAt.IsZero() {
+		return 0
+	}
+	return m.writeFirstByteAt.Sub(m.startedAt)
+}
+
+// TTLB returns time to last byte of response.
+func (m *RequestMetrics) TTLB() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.writeLastByteAt.IsZero() {
+		return 0
+	}
+	return m.writeLastByteAt.Sub(m.startedAt)
+}
+
+type requestMetricsKey struct{}
+
+// MetricsFromContext returns metrics of request stored by MetricsMiddleware, or nil.
+func MetricsFromContext(ctx context.Context) *RequestMetrics {
+	if ctx == nil {
+		return nil
+	}
+	m, _ := ctx.Value(requestMetricsKey{}).(*RequestMetrics)
+	return m
+}
+
+// ResponseWriterMetrics records time of the first write and of the end of writing of response.
+type ResponseWriterMetrics struct {
+	ResponseWriter
+	metrics *RequestMetrics
+}
+
+// NewResponseWriterMetrics wraps w to record write times to metrics.
+func NewResponseWriterMetrics(w ResponseWriter, metrics *RequestMetrics) *ResponseWriterMetrics {
+	return &ResponseWriterMetrics{ResponseWriter: w, metrics: metrics}
+}
+
+// Metrics returns recorded metrics.
+func (w *ResponseWriterMetrics) Metrics() *RequestMetrics {
+	return w.metrics
+}
+
+func (w *ResponseWriterMetrics) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *ResponseWriterMetrics) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *ResponseWriterMetrics) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *ResponseWriterMetrics) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	w.metrics.lock.Lock()
+	if w.metrics.writeFirstByteAt.IsZero() {
+		w.metrics.writeFirstByteAt = time.Now()
+	}
+	w.metrics.lock.Unlock()
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+// Close finishes writing of response and records time of last byte.
+func (w *ResponseWriterMetrics) Close() error {
+	w.metrics.lock.Lock()
+	defer w.metrics.lock.Unlock()
+	if w.metrics.writeLastByteAt.IsZero() {
+		w.metrics.writeLastByteAt = time.Now()
+	}
+	return nil
+}
+
+// MetricsMiddleware measures processing of requests. Metrics are accessible by handler
+// via MetricsFromContext and report is called with them after handler returns.
+func MetricsMiddleware(report func(r *Request, m *RequestMetrics)) MiddlewareFunc {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			m := newRequestMetrics()
+			ctx := r.Ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req := &Request{
+				Msg:      r.Msg,
+				Client:   r.Client,
+				Ctx:      context.WithValue(ctx, requestMetricsKey{}, m),
+				Sequence: r.Sequence,
+			}
+			mw := NewResponseWriterMetrics(w, m)
+			defer func() {
+				mw.Close()
+				if report != nil {
+					report(req, m)
+				}
+			}()
+			next.ServeCOAP(mw, req)
+		})
+	}
+}
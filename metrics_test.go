@@ -0,0 +1,47 @@
+package coap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	reports := make(chan *RequestMetrics, 1)
+	h := MetricsMiddleware(func(r *Request, m *RequestMetrics) {
+		reports <- m
+	})(HandlerFunc(func(w ResponseWriter, r *Request) {
+		require.NotNil(t, MetricsFromContext(r.Ctx))
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("chunk 1"))
+		time.Sleep(time.Millisecond * 100)
+		w.Write([]byte("chunk 2"))
+	}))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, h.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	req, err := co.NewGetRequest("/a")
+	require.NoError(t, err)
+	req.SetType(NonConfirmable)
+	_, err = co.Exchange(req)
+	require.NoError(t, err)
+
+	var m *RequestMetrics
+	select {
+	case m = <-reports:
+	case <-time.After(time.Second * 3):
+		t.Fatal("metrics were not reported")
+	}
+	require.True(t, m.TTFB() > 0)
+	d := m.TTLB() - m.TTFB()
+	require.True(t, d >= time.Millisecond*100 && d < time.Millisecond*150, "TTLB-TTFB=%v", d)
+	require.Equal(t, m.WriteLastByteAt().Sub(m.WriteFirstByteAt()), d)
+}
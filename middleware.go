@@ -0,0 +1,4 @@
+package coap
+
+// MiddlewareFunc wraps handler to extend its behavior, eg. to check preconditions of requests.
+type MiddlewareFunc func(next Handler) Handler
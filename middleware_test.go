@@ -0,0 +1,77 @@
+package coap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeMuxUse(t *testing.T) {
+	var lock sync.Mutex
+	var order []string
+	trace := func(name string) MiddlewareFunc {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(w ResponseWriter, r *Request) {
+				lock.Lock()
+				order = append(order, name)
+				lock.Unlock()
+				next.ServeCOAP(w, r)
+			})
+		}
+	}
+	mux := NewServeMux()
+	mux.Use(trace("outer"))
+	mux.Use(trace("inner"))
+	mux.Use(func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			if r.Msg.QueryString() != "token=secret" {
+				w.SetCode(Unauthorized)
+				w.Write(nil)
+				return
+			}
+			next.ServeCOAP(w, r)
+		})
+	})
+	mux.HandleFunc("/a", func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("a"))
+	})
+	addr, shutdown := runLocalUDPServer(t, &Server{Handler: mux})
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	get := func(path string) (Message, error) {
+		req, err := co.NewGetRequest(path)
+		require.NoError(t, err)
+		req.AddOption(URIQuery, "token=secret")
+		resp, err := co.Exchange(req)
+		if err != nil {
+			return nil, err
+		}
+		return resp, responseError(resp)
+	}
+	resp, err := get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(resp.Payload()))
+	lock.Lock()
+	assert.Equal(t, []string{"outer", "inner"}, order)
+	lock.Unlock()
+
+	_, err = co.Get("/a")
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, Unauthorized, code)
+
+	// default handler is wrapped too
+	_, err = get("/b")
+	code, ok = ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, NotFound, code)
+	lock.Lock()
+	assert.Len(t, order, 6)
+	lock.Unlock()
+}
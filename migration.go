@@ -0,0 +1,49 @@
+package coap
+
+import (
+	"net"
+)
+
+func udpSessionOf(s networkSession) (*sessionUDP, bool) {
+	if b, ok := s.(*blockWiseSession); ok {
+		s = b.networkSession
+	}
+	u, ok := s.(*sessionUDP)
+	return u, ok
+}
+
+// MigrateConnection moves UDP session of peer at oldAddr to newAddr, eg. when mobile client changed
+// its IP address. Observations and blockwise transfers in progress continue at the new address.
+// Session that already exists for newAddr is replaced.
+func (srv *Server) MigrateConnection(oldAddr, newAddr net.Addr) error {
+	raddr, ok := newAddr.(*net.UDPAddr)
+	if !ok {
+		return ErrNotSupported
+	}
+	srv.sessionUDPMapLock.Lock()
+	var key string
+	var session *sessionUDP
+	for k, s := range srv.sessionUDPMap {
+		if u, ok := udpSessionOf(s); ok && u.RemoteAddr().String() == oldAddr.String() {
+			key, session = k, u
+			break
+		}
+	}
+	if session == nil {
+		srv.sessionUDPMapLock.Unlock()
+		return ErrSessionNotFound
+	}
+	data := session.udpData().WithRemoteAddr(raddr)
+	replaced := srv.sessionUDPMap[data.Key()]
+	srv.sessionUDPMap[data.Key()] = srv.sessionUDPMap[key]
+	delete(srv.sessionUDPMap, key)
+	session.setUDPData(data)
+	srv.sessionUDPMapLock.Unlock()
+
+	if replaced != nil {
+		sessionEnded(replaced)
+		srv.NotifySessionEndFunc(&ClientConn{commander: &ClientCommander{networkSession: replaced}}, nil)
+	}
+	srv.observers.migrateClient(oldAddr, newAddr)
+	return nil
+}
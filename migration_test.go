@@ -0,0 +1,71 @@
+package coap
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sendBlock1(t *testing.T, conn *net.UDPConn, to net.Addr, mid uint16, num uint, more bool, payload []byte) Message {
+	req := NewDgramMessage(MessageParams{Type: Confirmable, Code: POST, MessageID: mid, Token: []byte{1, 2, 3}, Payload: payload})
+	req.SetPathString("/upload")
+	block, err := MarshalBlockOption(BlockWiseSzx16, num, more)
+	require.NoError(t, err)
+	req.SetOption(Block1, block)
+	var buf bytes.Buffer
+	require.NoError(t, req.MarshalBinary(&buf))
+	_, err = conn.WriteTo(buf.Bytes(), to)
+	require.NoError(t, err)
+
+	b := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	n, err := conn.Read(b)
+	require.NoError(t, err)
+	resp, err := ParseDgramMessage(b[:n])
+	require.NoError(t, err)
+	return resp
+}
+
+func TestServerMigrateConnection(t *testing.T) {
+	received := make(chan []byte, 1)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		received <- r.Msg.Payload()
+		w.SetCode(Changed)
+		w.Write(nil)
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	saddr, err := net.ResolveUDPAddr("udp", addr)
+	require.NoError(t, err)
+	addr1, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer addr1.Close()
+	addr2, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer addr2.Close()
+
+	payload := []byte("0123456789abcdef0123456789ABCDEFxyz")
+	resp := sendBlock1(t, addr1, saddr, 1, 0, true, payload[:16])
+	assert.Equal(t, Continue, resp.Code())
+
+	require.NoError(t, s.MigrateConnection(addr1.LocalAddr(), addr2.LocalAddr()))
+	resp = sendBlock1(t, addr2, saddr, 2, 1, true, payload[16:32])
+	assert.Equal(t, Continue, resp.Code())
+	resp = sendBlock1(t, addr2, saddr, 3, 2, false, payload[32:])
+	assert.Equal(t, Changed, resp.Code())
+	select {
+	case p := <-received:
+		assert.Equal(t, payload, p)
+	case <-time.After(time.Second):
+		require.FailNow(t, "handler wasn't called")
+	}
+
+	assert.Equal(t, ErrSessionNotFound, s.MigrateConnection(addr1.LocalAddr(), addr2.LocalAddr()))
+}
@@ -0,0 +1,116 @@
+package coap
+
+import (
+	"bytes"
+	"log"
+	"sync"
+)
+
+// MinimalConfig is agreement of peers using minimal encoding, both of them must use the same one.
+type MinimalConfig struct {
+	Type           COAPType // type of all messages
+	Token          []byte   // token of all messages, empty by default
+	FirstMessageID uint16   // message ID of the first message, next ones are sequential
+	MaxBytes       int      // encoded messages over MaxBytes are logged, 0 disables the check
+}
+
+// MinimalEncoder encodes datagram messages for links of a few bytes per frame, eg. LoRaWAN. Type,
+// token and message ID are implicit by MinimalConfig, frame contains code, options and payload.
+// Options must be encoded by single nibble of delta and length, eg. Uri-Path up to 12 bytes.
+// Frames must be decoded in order of encoding, so lost frame must be recovered by the application.
+type MinimalEncoder struct {
+	cfg MinimalConfig
+
+	lock sync.Mutex
+	next uint16
+}
+
+// NewMinimalEncoder creates encoder of cfg.
+func NewMinimalEncoder(cfg MinimalConfig) *MinimalEncoder {
+	return &MinimalEncoder{cfg: cfg, next: cfg.FirstMessageID}
+}
+
+// NextMessageID returns message ID which the next encoded message must have.
+func (e *MinimalEncoder) NextMessageID() uint16 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.next
+}
+
+// Encode encodes msg, which must match the agreement and have message ID returned by NextMessageID.
+func (e *MinimalEncoder) Encode(msg *DgramMessage) ([]byte, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if msg.Type() != e.cfg.Type || !bytes.Equal(msg.Token(), e.cfg.Token) || msg.MessageID() != e.next {
+		return nil, ErrMinimalAgreement
+	}
+	var buf bytes.Buffer
+	if err := msg.MarshalBinary(&buf); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()[4+len(msg.Token()):]
+	if err := checkMinimalOptions(data); err != nil {
+		return nil, err
+	}
+	frame := append([]byte{byte(msg.Code())}, data...)
+	if e.cfg.MaxBytes > 0 && len(frame) > e.cfg.MaxBytes {
+		log.Printf("minimal encoding: message %v has %v bytes, over limit %v bytes", msg.MessageID(), len(frame), e.cfg.MaxBytes)
+	}
+	e.next++
+	return frame, nil
+}
+
+// checkMinimalOptions checks that options of data don't use extended delta or length.
+func checkMinimalOptions(data []byte) error {
+	for len(data) > 0 && data[0] != 0xff {
+		delta, length := int(data[0]>>4), int(data[0]&0x0f)
+		switch {
+		case delta > 12:
+			return ErrOptionGapTooLarge
+		case length > 12:
+			return ErrOptionTooLong
+		case len(data) < 1+length:
+			return ErrOptionTruncated
+		}
+		data = data[1+length:]
+	}
+	return nil
+}
+
+// MinimalDecoder decodes frames created by MinimalEncoder.
+type MinimalDecoder struct {
+	cfg MinimalConfig
+
+	lock sync.Mutex
+	next uint16
+}
+
+// NewMinimalDecoder creates decoder of cfg.
+func NewMinimalDecoder(cfg MinimalConfig) *MinimalDecoder {
+	return &MinimalDecoder{cfg: cfg, next: cfg.FirstMessageID}
+}
+
+// Decode restores message from frame, message ID is the next one of sequence.
+func (d *MinimalDecoder) Decode(frame []byte) (*DgramMessage, error) {
+	if len(frame) < 1 {
+		return nil, ErrMessageTruncated
+	}
+	if len(d.cfg.Token) > MaxTokenSize {
+		return nil, ErrInvalidTokenLen
+	}
+	if err := checkMinimalOptions(frame[1:]); err != nil {
+		return nil, err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	data := make([]byte, 0, 4+len(d.cfg.Token)+len(frame)-1)
+	data = append(data, 1<<6|byte(d.cfg.Type)<<4|byte(len(d.cfg.Token)), frame[0], byte(d.next>>8), byte(d.next))
+	data = append(data, d.cfg.Token...)
+	data = append(data, frame[1:]...)
+	msg, err := ParseDgramMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	d.next++
+	return msg, nil
+}
@@ -0,0 +1,78 @@
+package coap
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertSameDgram(t *testing.T, expected, actual *DgramMessage) {
+	var e, a bytes.Buffer
+	require.NoError(t, expected.MarshalBinary(&e))
+	require.NoError(t, actual.MarshalBinary(&a))
+	assert.Equal(t, e.Bytes(), a.Bytes())
+}
+
+func TestMinimalEncoding(t *testing.T) {
+	cfg := MinimalConfig{Type: NonConfirmable, FirstMessageID: 100, MaxBytes: 11}
+	enc := NewMinimalEncoder(cfg)
+	dec := NewMinimalDecoder(cfg)
+
+	get := NewDgramMessage(MessageParams{Type: NonConfirmable, Code: GET, MessageID: enc.NextMessageID()})
+	get.SetPathString("/ab")
+	frame, err := enc.Encode(get)
+	require.NoError(t, err)
+	assert.Len(t, frame, 4)
+	restored, err := dec.Decode(frame)
+	require.NoError(t, err)
+	assertSameDgram(t, get, restored)
+
+	post := NewDgramMessage(MessageParams{Type: NonConfirmable, Code: POST, MessageID: enc.NextMessageID(), Payload: []byte{21}})
+	post.SetPathString("/t")
+	post.SetOption(ContentFormat, AppCBOR)
+	assert.Equal(t, uint16(101), post.MessageID())
+	frame, err = enc.Encode(post)
+	require.NoError(t, err)
+	restored, err = dec.Decode(frame)
+	require.NoError(t, err)
+	assertSameDgram(t, post, restored)
+}
+
+func TestMinimalEncodingAgreement(t *testing.T) {
+	enc := NewMinimalEncoder(MinimalConfig{Type: Confirmable})
+	_, err := enc.Encode(NewDgramMessage(MessageParams{Type: NonConfirmable, Code: GET}))
+	assert.Equal(t, ErrMinimalAgreement, err)
+	_, err = enc.Encode(NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, Token: []byte{1}}))
+	assert.Equal(t, ErrMinimalAgreement, err)
+	_, err = enc.Encode(NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 5}))
+	assert.Equal(t, ErrMinimalAgreement, err)
+
+	// Uri-Query needs extended delta
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET})
+	msg.SetQueryString("a=1")
+	_, err = enc.Encode(msg)
+	assert.Equal(t, ErrOptionGapTooLarge, err)
+	msg = NewDgramMessage(MessageParams{Type: Confirmable, Code: GET})
+	msg.SetPathString("/" + strings.Repeat("a", 13))
+	_, err = enc.Encode(msg)
+	assert.Equal(t, ErrOptionTooLong, err)
+
+	_, err = NewMinimalDecoder(MinimalConfig{}).Decode([]byte{byte(GET), 0xb5, 'a'})
+	assert.Equal(t, ErrOptionTruncated, err)
+}
+
+func TestMinimalEncodingMaxBytes(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+	enc := NewMinimalEncoder(MinimalConfig{Type: NonConfirmable, MaxBytes: 4})
+	msg := NewDgramMessage(MessageParams{Type: NonConfirmable, Code: POST, Payload: []byte("too long")})
+	_, err := enc.Encode(msg)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "over limit 4 bytes")
+}
@@ -0,0 +1,153 @@
+package coap
+
+const (
+	cborMajorUint  = 0
+	cborMajorBytes = 2
+	cborMajorArray = 4
+	cborNull       = 0xf6
+)
+
+// MultipartPart is representation of multipart-core payload (RFC 8710). Nil Data is sent as null,
+// it means that representation of ContentFormat isn't available.
+type MultipartPart struct {
+	ContentFormat MediaType
+	Data          []byte
+}
+
+// MultipartPayload builds application/multipart-core payload.
+type MultipartPayload struct {
+	parts []MultipartPart
+}
+
+// Add appends representation data in contentFormat.
+func (p *MultipartPayload) Add(contentFormat MediaType, data []byte) *MultipartPayload {
+	p.parts = append(p.parts, MultipartPart{ContentFormat: contentFormat, Data: data})
+	return p
+}
+
+// Parts returns added representations.
+func (p *MultipartPayload) Parts() []MultipartPart {
+	return p.parts
+}
+
+// Encode encodes representations as CBOR array of content formats and byte strings.
+func (p *MultipartPayload) Encode() []byte {
+	return encodeMultipart(p.parts)
+}
+
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= 0xff:
+		return append(b, m|24, byte(n))
+	case n <= 0xffff:
+		return append(b, m|25, byte(n>>8), byte(n))
+	case n <= 0xffffffff:
+		return append(b, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, m|27, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// readCBORHead decodes head of definite length data item.
+func readCBORHead(b []byte) (major byte, n uint64, rest []byte, err error) {
+	if len(b) == 0 {
+		return 0, 0, nil, ErrInvalidMultipart
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	b = b[1:]
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), b, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, nil, ErrInvalidMultipart
+	}
+	if len(b) < size {
+		return 0, 0, nil, ErrInvalidMultipart
+	}
+	for _, c := range b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	return major, n, b[size:], nil
+}
+
+func encodeMultipart(parts []MultipartPart) []byte {
+	b := appendCBORHead(nil, cborMajorArray, uint64(2*len(parts)))
+	for _, p := range parts {
+		b = appendCBORHead(b, cborMajorUint, uint64(p.ContentFormat))
+		if p.Data == nil {
+			b = append(b, cborNull)
+			continue
+		}
+		b = appendCBORHead(b, cborMajorBytes, uint64(len(p.Data)))
+		b = append(b, p.Data...)
+	}
+	return b
+}
+
+// DecodeMultipart decodes application/multipart-core payload.
+func DecodeMultipart(payload []byte) ([]MultipartPart, error) {
+	major, n, b, err := readCBORHead(payload)
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMajorArray || n%2 != 0 || n > uint64(len(b)) {
+		return nil, ErrInvalidMultipart
+	}
+	parts := make([]MultipartPart, 0, n/2)
+	for i := uint64(0); i < n; i += 2 {
+		var cf uint64
+		if major, cf, b, err = readCBORHead(b); err != nil {
+			return nil, err
+		}
+		if major != cborMajorUint || cf > 0xffff {
+			return nil, ErrInvalidMultipart
+		}
+		part := MultipartPart{ContentFormat: MediaType(cf)}
+		if len(b) > 0 && b[0] == cborNull {
+			b = b[1:]
+			parts = append(parts, part)
+			continue
+		}
+		var l uint64
+		if major, l, b, err = readCBORHead(b); err != nil {
+			return nil, err
+		}
+		if major != cborMajorBytes || l > uint64(len(b)) {
+			return nil, ErrInvalidMultipart
+		}
+		part.Data = append([]byte{}, b[:l]...)
+		b = b[l:]
+		parts = append(parts, part)
+	}
+	if len(b) > 0 {
+		return nil, ErrInvalidMultipart
+	}
+	return parts, nil
+}
+
+// ParseMultipart decodes representations of msg with application/multipart-core payload.
+func ParseMultipart(msg Message) ([]MultipartPart, error) {
+	if cf, ok := msg.Option(ContentFormat).(MediaType); !ok || cf != AppMultipartCore {
+		return nil, ErrInvalidMultipart
+	}
+	return DecodeMultipart(msg.Payload())
+}
+
+// NewMultipartResponse creates response of w with code carrying parts as application/multipart-core.
+func NewMultipartResponse(w ResponseWriter, code COAPCode, parts []MultipartPart) Message {
+	resp := w.NewResponse(code)
+	resp.SetOption(ContentFormat, AppMultipartCore)
+	resp.SetPayload(encodeMultipart(parts))
+	return resp
+}
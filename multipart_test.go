@@ -0,0 +1,61 @@
+package coap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultipartPayload(t *testing.T) {
+	cbor := []byte{0xa1, 0x64, 't', 'e', 'm', 'p', 21}
+	p := new(MultipartPayload).Add(AppJSON, []byte(`{"temp":21}`)).Add(AppCBOR, cbor).Add(TextPlain, nil)
+	data := p.Encode()
+	assert.Equal(t, []byte{0x86, 0x18, 50, 0x4b}, data[:4])
+	assert.Equal(t, []byte{0x18, 60, 0x47}, data[4+11:4+11+3])
+	assert.Equal(t, []byte{0x00, 0xf6}, data[len(data)-2:])
+
+	parts, err := DecodeMultipart(data)
+	require.NoError(t, err)
+	assert.Equal(t, p.Parts(), parts)
+
+	big := bytes.Repeat([]byte{1}, 300)
+	parts, err = DecodeMultipart(new(MultipartPayload).Add(AppOcfCbor, big).Encode())
+	require.NoError(t, err)
+	assert.Equal(t, []MultipartPart{{ContentFormat: AppOcfCbor, Data: big}}, parts)
+
+	for _, invalid := range [][]byte{nil, {0x81, 0x00}, {0x82, 0x00}, {0x82, 0x00, 0x45, 1}, {0x82, 0x41, 0x00, 0x40}, {0x82, 0x00, 0x40, 0x00}} {
+		_, err := DecodeMultipart(invalid)
+		assert.Equal(t, ErrInvalidMultipart, err, "%x", invalid)
+	}
+}
+
+func TestNewMultipartResponse(t *testing.T) {
+	cbor := []byte{0xa1, 0x64, 't', 'e', 'm', 'p', 21}
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		p := new(MultipartPayload).Add(AppJSON, []byte(`{"temp":21}`)).Add(AppCBOR, cbor)
+		w.WriteMsg(NewMultipartResponse(w, Content, p.Parts()))
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Get("/bundle")
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code())
+	parts, err := ParseMultipart(resp)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, MultipartPart{ContentFormat: AppJSON, Data: []byte(`{"temp":21}`)}, parts[0])
+	assert.Equal(t, MultipartPart{ContentFormat: AppCBOR, Data: cbor}, parts[1])
+
+	resp.SetOption(ContentFormat, AppCBOR)
+	_, err = ParseMultipart(resp)
+	assert.Equal(t, ErrInvalidMultipart, err)
+}
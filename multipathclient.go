@@ -0,0 +1,196 @@
+package coap
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+)
+
+// multipathFailureRateWeight is weight of the latest result in moving average of failure rate.
+const multipathFailureRateWeight = 0.2
+
+// MultipathStats contains results of requests sent via an interface.
+type MultipathStats struct {
+	Successes int
+	Failures  int
+	// FailureRate is exponential moving average of recent failures, between 0 and 1.
+	FailureRate float64
+}
+
+// MultipathClient sends the same request via connections over all network interfaces, eg. WiFi
+// and cellular, and returns the first successful response. Requests via other interfaces are cancelled.
+type MultipathClient struct {
+	// SingleInterface sends requests only via BestInterface.
+	SingleInterface bool
+
+	conns map[string]*ClientConn
+	names []string
+
+	lock  sync.Mutex
+	stats map[string]*MultipathStats
+}
+
+// NewMultipathClient creates multipath client over connections keyed by interface name.
+func NewMultipathClient(conns map[string]*ClientConn) *MultipathClient {
+	c := &MultipathClient{
+		conns: conns,
+		stats: make(map[string]*MultipathStats, len(conns)),
+	}
+	for name := range conns {
+		c.names = append(c.names, name)
+		c.stats[name] = &MultipathStats{}
+	}
+	sort.Strings(c.names)
+	return c
+}
+
+func (c *MultipathClient) record(name string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s := c.stats[name]
+	failure := 0.0
+	if err != nil {
+		s.Failures++
+		failure = 1
+	} else {
+		s.Successes++
+	}
+	s.FailureRate += multipathFailureRateWeight * (failure - s.FailureRate)
+}
+
+// Stats returns results of requests per interface.
+func (c *MultipathClient) Stats() map[string]MultipathStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	res := make(map[string]MultipathStats, len(c.stats))
+	for name, s := range c.stats {
+		res[name] = *s
+	}
+	return res
+}
+
+// BestInterface returns interface with the lowest recent failure rate, ties are broken by name.
+func (c *MultipathClient) BestInterface() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var best string
+	for _, name := range c.names {
+		if best == "" || c.stats[name].FailureRate < c.stats[best].FailureRate {
+			best = name
+		}
+	}
+	return best
+}
+
+// Exchange same as ExchangeWithContext without context.
+func (c *MultipathClient) Exchange(m Message) (Message, error) {
+	return c.ExchangeWithContext(context.Background(), m)
+}
+
+// ExchangeWithContext performs a synchronous query via all interfaces.
+func (c *MultipathClient) ExchangeWithContext(ctx context.Context, m Message) (Message, error) {
+	if len(c.conns) == 0 {
+		return nil, ErrInvalidRequest
+	}
+	names := c.names
+	if c.SingleInterface {
+		names = []string{c.BestInterface()}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgingResult, len(names))
+	for _, name := range names {
+		go func(name string, co *ClientConn) {
+			resp, err := co.ExchangeWithContext(ctx, copyMessage(co, m))
+			if err == nil || ctx.Err() == nil {
+				// cancelled requests of other interfaces are not failures
+				c.record(name, err)
+			}
+			results <- hedgingResult{msg: resp, err: err}
+		}(name, c.conns[name])
+	}
+
+	var err error
+	for range names {
+		r := <-results
+		if r.err == nil {
+			return r.msg, nil
+		}
+		err = r.err
+	}
+	return nil, err
+}
+
+func (c *MultipathClient) anyConn() *ClientConn {
+	return c.conns[c.names[0]]
+}
+
+func (c *MultipathClient) do(ctx context.Context, req Message, err error) (Message, error) {
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.ExchangeWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, responseError(resp)
+}
+
+// Get retrieves the resource identified by the request path.
+func (c *MultipathClient) Get(path string) (Message, error) {
+	return c.GetWithContext(context.Background(), path)
+}
+
+// GetWithContext retrieves with context the resource identified by the request path.
+func (c *MultipathClient) GetWithContext(ctx context.Context, path string) (Message, error) {
+	if len(c.conns) == 0 {
+		return nil, ErrInvalidRequest
+	}
+	req, err := c.anyConn().NewGetRequest(path)
+	return c.do(ctx, req, err)
+}
+
+// Post creates the resource identified by the request path.
+func (c *MultipathClient) Post(path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.PostWithContext(context.Background(), path, contentFormat, body)
+}
+
+// PostWithContext creates with context the resource identified by the request path.
+func (c *MultipathClient) PostWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	if len(c.conns) == 0 {
+		return nil, ErrInvalidRequest
+	}
+	req, err := c.anyConn().NewPostRequest(path, contentFormat, body)
+	return c.do(ctx, req, err)
+}
+
+// Put updates the resource identified by the request path.
+func (c *MultipathClient) Put(path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.PutWithContext(context.Background(), path, contentFormat, body)
+}
+
+// PutWithContext updates with context the resource identified by the request path.
+func (c *MultipathClient) PutWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	if len(c.conns) == 0 {
+		return nil, ErrInvalidRequest
+	}
+	req, err := c.anyConn().NewPutRequest(path, contentFormat, body)
+	return c.do(ctx, req, err)
+}
+
+// Delete deletes the resource identified by the request path.
+func (c *MultipathClient) Delete(path string) (Message, error) {
+	return c.DeleteWithContext(context.Background(), path)
+}
+
+// DeleteWithContext deletes with context the resource identified by the request path.
+func (c *MultipathClient) DeleteWithContext(ctx context.Context, path string) (Message, error) {
+	if len(c.conns) == 0 {
+		return nil, ErrInvalidRequest
+	}
+	req, err := c.anyConn().NewDeleteRequest(path)
+	return c.do(ctx, req, err)
+}
@@ -0,0 +1,75 @@
+package coap
+
+import (
+	"testing"
+	"time"
+)
+
+// downInterfaceConn returns connection whose exchanges fail immediately.
+func downInterfaceConn(t *testing.T) *ClientConn {
+	s, addr, fin, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, nil)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	co, err := Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to dialing: %v", err)
+	}
+	// wait until connection is served
+	co.Get("/a")
+	co.Close()
+	s.Shutdown()
+	<-fin
+	return co
+}
+
+func TestMultipathClientGet(t *testing.T) {
+	cellular, closeCellular := runHedgingServer(t, 0, "cellular")
+	defer closeCellular()
+	wifi := downInterfaceConn(t)
+
+	c := NewMultipathClient(map[string]*ClientConn{"wifi": wifi, "cellular": cellular})
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get("/a")
+		if err != nil {
+			t.Fatalf("unable to get: %v", err)
+		}
+		if string(resp.Payload()) != "cellular" {
+			t.Fatalf("unexpected payload: %s", resp.Payload())
+		}
+	}
+	// failure of wifi may be recorded after the response via cellular is returned
+	deadline := time.Now().Add(time.Second)
+	for c.Stats()["wifi"].Failures < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	stats := c.Stats()
+	if stats["cellular"].Successes != 3 || stats["cellular"].FailureRate != 0 {
+		t.Fatalf("unexpected stats of cellular: %+v", stats["cellular"])
+	}
+	if stats["wifi"].Failures != 3 || stats["wifi"].FailureRate <= 0 {
+		t.Fatalf("unexpected stats of wifi: %+v", stats["wifi"])
+	}
+	if best := c.BestInterface(); best != "cellular" {
+		t.Fatalf("unexpected best interface: %v", best)
+	}
+
+	c.SingleInterface = true
+	resp, err := c.Get("/a")
+	if err != nil {
+		t.Fatalf("unable to get: %v", err)
+	}
+	if string(resp.Payload()) != "cellular" {
+		t.Fatalf("unexpected payload: %s", resp.Payload())
+	}
+	if failures := c.Stats()["wifi"].Failures; failures != 3 {
+		t.Fatalf("request was sent via wifi in single interface mode: %v failures", failures)
+	}
+}
+
+func TestMultipathClientAllInterfacesFail(t *testing.T) {
+	c := NewMultipathClient(map[string]*ClientConn{"wifi": downInterfaceConn(t), "cellular": downInterfaceConn(t)})
+	if _, err := c.Get("/a"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,105 @@
+package net
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// LetsEncryptStagingURL is directory of Let's Encrypt staging environment.
+const LetsEncryptStagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+// ACMEConfig configures TLS listener with certificates provisioned and renewed by ACME (eg. Let's Encrypt).
+type ACMEConfig struct {
+	// Network and address to listen on, defaults are "tcp" and ":5684".
+	Network string
+	Addr    string
+	// Email is contact address of ACME account.
+	Email string
+	// CacheDir is directory where account key and certificates are stored. When empty,
+	// certificates are kept only in memory and they are requested again after restart.
+	CacheDir string
+	// DirectoryURL is ACME directory, defaults to Let's Encrypt.
+	DirectoryURL string
+	// DryRun uses Let's Encrypt staging environment when DirectoryURL is not set.
+	DryRun bool
+	// HTTPChallengeAddr is address where HTTP-01 challenges are served, eg. ":80".
+	// When empty, only TLS-ALPN-01 challenges on the listener are used.
+	HTTPChallengeAddr string
+	// HTTPClient is used for communication with ACME server, eg. to trust CA of test server.
+	HTTPClient *http.Client
+	// RenewBefore is how early before expiration certificates are renewed, defaults to 30 days.
+	RenewBefore time.Duration
+	// HeartBeat of the listener, defaults to 100ms.
+	HeartBeat time.Duration
+}
+
+func (c *ACMEConfig) directoryURL() string {
+	switch {
+	case c.DirectoryURL != "":
+		return c.DirectoryURL
+	case c.DryRun:
+		return LetsEncryptStagingURL
+	}
+	return acme.LetsEncryptURL
+}
+
+func newACMEManager(domain string, cfg *ACMEConfig) *autocert.Manager {
+	m := &autocert.Manager{
+		// creating ACME listener means acceptance of CA's terms of service
+		Prompt:      autocert.AcceptTOS,
+		HostPolicy:  autocert.HostWhitelist(domain),
+		Email:       cfg.Email,
+		RenewBefore: cfg.RenewBefore,
+		Client: &acme.Client{
+			DirectoryURL: cfg.directoryURL(),
+			HTTPClient:   cfg.HTTPClient,
+		},
+	}
+	if cfg.CacheDir != "" {
+		m.Cache = autocert.DirCache(cfg.CacheDir)
+	}
+	return m
+}
+
+// NewACMETLSListener creates TLS listener for domain with certificate obtained from ACME server.
+// The certificate is requested at first handshake and renewed in background, renewed certificate
+// is used for new handshakes and existing connections are not affected.
+func NewACMETLSListener(domain string, cfg *ACMEConfig) (*TLSListener, error) {
+	if cfg == nil {
+		cfg = &ACMEConfig{}
+	}
+	network, addr, heartBeat := cfg.Network, cfg.Addr, cfg.HeartBeat
+	if network == "" {
+		network = "tcp"
+	}
+	if addr == "" {
+		addr = ":5684"
+	}
+	if heartBeat == 0 {
+		heartBeat = time.Millisecond * 100
+	}
+	m := newACMEManager(domain, cfg)
+	tlsCfg := m.TLSConfig()
+	// clients of coaps+tcp offer ALPNCoAP, handshake fails when server doesn't support it
+	tlsCfg.NextProtos = append(tlsCfg.NextProtos, ALPNCoAP)
+	l, err := NewTLSListener(network, addr, tlsCfg, heartBeat)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HTTPChallengeAddr != "" {
+		ln, err := net.Listen("tcp", cfg.HTTPChallengeAddr)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("cannot create http challenge listener: %v", err)
+		}
+		srv := &http.Server{Handler: m.HTTPHandler(nil)}
+		go srv.Serve(ln)
+		l.closeFunc = srv.Close
+	}
+	return l, nil
+}
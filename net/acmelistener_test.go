@@ -0,0 +1,87 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+func TestACMEConfigDirectoryURL(t *testing.T) {
+	assert.Equal(t, acme.LetsEncryptURL, (&ACMEConfig{}).directoryURL())
+	assert.Equal(t, LetsEncryptStagingURL, (&ACMEConfig{DryRun: true}).directoryURL())
+	assert.Equal(t, "https://localhost:14000/dir", (&ACMEConfig{DryRun: true, DirectoryURL: "https://localhost:14000/dir"}).directoryURL())
+}
+
+func TestNewACMETLSListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := NewACMETLSListener("example.com", &ACMEConfig{
+		Addr:              "127.0.0.1:",
+		CacheDir:          dir,
+		DryRun:            true,
+		HTTPChallengeAddr: "127.0.0.1:",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, l.closeFunc)
+	assert.Contains(t, l.cfg.NextProtos, ALPNCoAP)
+	assert.Contains(t, l.cfg.NextProtos, acme.ALPNProto)
+
+	m := newACMEManager("example.com", &ACMEConfig{DryRun: true})
+	assert.Contains(t, m.TLSConfig().NextProtos, acme.ALPNProto)
+	assert.Error(t, m.HostPolicy(context.Background(), "other.com"))
+	assert.NoError(t, m.HostPolicy(context.Background(), "example.com"))
+
+	err = l.Close()
+	require.NoError(t, err)
+}
+
+// TestACMETLSListenerPebble obtains certificate from pebble (https://github.com/letsencrypt/pebble)
+// started by eg.: PEBBLE_VA_ALWAYS_VALID=1 pebble -config test/config/pebble-config.json
+func TestACMETLSListenerPebble(t *testing.T) {
+	dirURL := os.Getenv("PEBBLE_ACME_DIRECTORY")
+	if dirURL == "" {
+		t.Skip("PEBBLE_ACME_DIRECTORY is not set")
+	}
+	l, err := NewACMETLSListener("localhost", &ACMEConfig{
+		Addr:         "127.0.0.1:",
+		DirectoryURL: dirURL,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				// pebble uses self-signed certificate of its API
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		c, err := l.AcceptWithContext(context.Background())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.(*tls.Conn).Handshake()
+	}()
+
+	c, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Minute}, "tcp", l.Addr().String(), &tls.Config{
+		ServerName:         "localhost",
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+	certs := c.ConnectionState().PeerCertificates
+	require.NotEmpty(t, certs)
+	assert.NoError(t, certs[0].VerifyHostname("localhost"))
+}
@@ -0,0 +1,116 @@
+package net
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// byteLimiter is token bucket of bytes. Request bigger than the bucket borrows tokens, so the following
+// requests wait until the debt is paid.
+type byteLimiter struct {
+	lock        sync.Mutex
+	bytesPerSec float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+}
+
+func newByteLimiter(bytesPerSec int64) *byteLimiter {
+	return &byteLimiter{
+		bytesPerSec: float64(bytesPerSec),
+		burst:       float64(bytesPerSec),
+		tokens:      float64(bytesPerSec),
+		last:        time.Now(),
+	}
+}
+
+// reserve takes n tokens and returns how long the caller must wait before using them.
+func (l *byteLimiter) reserve(n int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.bytesPerSec
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.bytesPerSec * float64(time.Second))
+}
+
+func (l *byteLimiter) cancel(n int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.tokens += float64(n)
+}
+
+// waitN blocks until n bytes are allowed. When ctx is done first, tokens are returned and ctx.Err()
+// is returned.
+func (l *byteLimiter) waitN(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	wait := l.reserve(n)
+	if wait == 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel(n)
+		return ctx.Err()
+	}
+}
+
+// BandwidthLimitedConn wraps net.Conn and limits bytes read and written per second, shared by both
+// directions. Write waits before data are written, Read waits after data are read, so the next read
+// is delayed.
+//
+// Multiple goroutines may invoke methods on a BandwidthLimitedConn simultaneously.
+type BandwidthLimitedConn struct {
+	net.Conn
+	limiter *byteLimiter
+}
+
+// NewBandwidthLimitedConn creates connection over c which transfers at most bytesPerSec bytes per second.
+func NewBandwidthLimitedConn(c net.Conn, bytesPerSec int64) *BandwidthLimitedConn {
+	return &BandwidthLimitedConn{Conn: c, limiter: newByteLimiter(bytesPerSec)}
+}
+
+// Read reads data and waits until their length is allowed by limit.
+func (c *BandwidthLimitedConn) Read(b []byte) (int, error) {
+	return c.ReadWithContext(context.Background(), b)
+}
+
+// ReadWithContext reads data and waits until their length is allowed by limit or ctx is done.
+func (c *BandwidthLimitedConn) ReadWithContext(ctx context.Context, b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		if errW := c.limiter.waitN(ctx, n); errW != nil {
+			return n, errW
+		}
+	}
+	return n, err
+}
+
+// Write waits until length of b is allowed by limit and writes it.
+func (c *BandwidthLimitedConn) Write(b []byte) (int, error) {
+	return c.WriteWithContext(context.Background(), b)
+}
+
+// WriteWithContext waits until length of b is allowed by limit and writes it. When ctx is done first,
+// nothing is written and ctx.Err() is returned.
+func (c *BandwidthLimitedConn) WriteWithContext(ctx context.Context, b []byte) (int, error) {
+	if err := c.limiter.waitN(ctx, len(b)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
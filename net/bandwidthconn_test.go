@@ -0,0 +1,47 @@
+package net
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthLimitedConn(t *testing.T) {
+	l, fin := runUDPEchoServer(t)
+	defer fin()
+	conn, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := NewBandwidthLimitedConn(conn, 1024)
+
+	start := time.Now()
+	data := make([]byte, 512)
+	for i := 0; i < 20; i++ {
+		_, err := c.Write(data)
+		require.NoError(t, err)
+	}
+	// the first second is allowed by full bucket
+	elapsed := time.Since(start)
+	assert.InDelta(t, float64(time.Second*9), float64(elapsed), float64(time.Second*2), "elapsed %v", elapsed)
+}
+
+func TestBandwidthLimitedConnContext(t *testing.T) {
+	l, fin := runUDPEchoServer(t)
+	defer fin()
+	conn, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := NewBandwidthLimitedConn(conn, 100)
+
+	_, err = c.Write(make([]byte, 100))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	n, err := c.WriteWithContext(ctx, make([]byte, 100))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,192 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+var errChaosWrite = errors.New("chaos: injected write error")
+
+// Dialer dials connections, it is implemented by net.Dialer.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// ChaosConfig configures faults injected by ChaosConn into outgoing packets and drops of incoming ones.
+type ChaosConfig struct {
+	DropProbability     float64       // probability of dropping packet
+	ReadDropProbability float64       // probability of dropping read packet
+	Delay               time.Duration // delay of every packet
+	Reorder             bool          // every other packet is held and sent after the next one
+	CorruptProbability  float64       // probability of flipping one bit in packet
+	ErrorProbability    float64       // probability of failing write of packet by error
+	Rand                *rand.Rand    // source of randomness, defaults to time seeded source
+}
+
+// ChaosConn wraps net.Conn and injects faults into written packets to simulate an unreliable network.
+// Faults can be changed at any time.
+//
+// Multiple goroutines may invoke methods on a ChaosConn simultaneously.
+type ChaosConn struct {
+	net.Conn
+
+	lock        sync.Mutex
+	cfg         ChaosConfig
+	held        []byte
+	dropped     int
+	droppedRead int
+}
+
+// NewChaosConn creates chaos connection over c.
+func NewChaosConn(c net.Conn, cfg ChaosConfig) *ChaosConn {
+	if cfg.Rand == nil {
+		cfg.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &ChaosConn{Conn: c, cfg: cfg}
+}
+
+// DropPacketProbability sets probability of dropping packet.
+func (c *ChaosConn) DropPacketProbability(p float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cfg.DropProbability = p
+}
+
+// DropReadPacketProbability sets probability of dropping read packet.
+func (c *ChaosConn) DropReadPacketProbability(p float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cfg.ReadDropProbability = p
+}
+
+// DelayPacket sets delay of every packet.
+func (c *ChaosConn) DelayPacket(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cfg.Delay = d
+}
+
+// ReorderPackets enables swapping order of consecutive packets.
+func (c *ChaosConn) ReorderPackets(reorder bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cfg.Reorder = reorder
+}
+
+// CorruptPacket sets probability of corrupting packet.
+func (c *ChaosConn) CorruptPacket(p float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cfg.CorruptProbability = p
+}
+
+// FailWrite sets probability of failing write by error.
+func (c *ChaosConn) FailWrite(p float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cfg.ErrorProbability = p
+}
+
+// Dropped returns count of dropped packets.
+func (c *ChaosConn) Dropped() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.dropped
+}
+
+// DroppedReads returns count of dropped read packets.
+func (c *ChaosConn) DroppedReads() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.droppedRead
+}
+
+func (c *ChaosConn) dropRead() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cfg.ReadDropProbability <= 0 || c.cfg.Rand.Float64() >= c.cfg.ReadDropProbability {
+		return false
+	}
+	c.droppedRead++
+	return true
+}
+
+// Read reads next packet which isn't dropped.
+func (c *ChaosConn) Read(b []byte) (int, error) {
+	for {
+		n, err := c.Conn.Read(b)
+		if err != nil || !c.dropRead() {
+			return n, err
+		}
+	}
+}
+
+// Write writes packet with injected faults. Dropped packet is reported as written.
+func (c *ChaosConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	cfg := c.cfg
+	if cfg.ErrorProbability > 0 && cfg.Rand.Float64() < cfg.ErrorProbability {
+		c.lock.Unlock()
+		return 0, errChaosWrite
+	}
+	if cfg.DropProbability > 0 && cfg.Rand.Float64() < cfg.DropProbability {
+		c.dropped++
+		c.lock.Unlock()
+		return len(b), nil
+	}
+	packet := append([]byte(nil), b...)
+	if len(packet) > 0 && cfg.CorruptProbability > 0 && cfg.Rand.Float64() < cfg.CorruptProbability {
+		packet[cfg.Rand.Intn(len(packet))] ^= 1 << uint(cfg.Rand.Intn(8))
+	}
+	var packets [][]byte
+	switch {
+	case cfg.Reorder && c.held == nil:
+		c.held = packet
+	case c.held != nil:
+		packets = [][]byte{packet, c.held}
+		c.held = nil
+	default:
+		packets = [][]byte{packet}
+	}
+	c.lock.Unlock()
+
+	if cfg.Delay > 0 {
+		time.Sleep(cfg.Delay)
+	}
+	for _, p := range packets {
+		if _, err := c.Conn.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+type chaosDialer struct {
+	inner Dialer
+	lock  sync.Mutex
+	cfg   ChaosConfig
+}
+
+// NewChaosDialer creates dialer which wraps connections dialed by inner into ChaosConn.
+func NewChaosDialer(inner Dialer, cfg ChaosConfig) Dialer {
+	return &chaosDialer{inner: inner, cfg: cfg}
+}
+
+func (d *chaosDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := d.inner.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	d.lock.Lock()
+	cfg := d.cfg
+	if cfg.Rand != nil {
+		// every connection needs own source, rand.Rand is not safe for concurrent use
+		cfg.Rand = rand.New(rand.NewSource(cfg.Rand.Int63()))
+	}
+	d.lock.Unlock()
+	return NewChaosConn(c, cfg), nil
+}
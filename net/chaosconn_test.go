@@ -0,0 +1,73 @@
+package net
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runUDPEchoServer(t *testing.T) (*net.UDPConn, func()) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := l.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			l.WriteToUDP(buf[:n], addr)
+		}
+	}()
+	return l, func() {
+		l.Close()
+		<-done
+	}
+}
+
+func TestChaosConnFaults(t *testing.T) {
+	l, fin := runUDPEchoServer(t)
+	defer fin()
+
+	inner, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	c := NewChaosConn(inner, ChaosConfig{})
+	defer c.Close()
+	buf := make([]byte, 1500)
+	read := func() []byte {
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		return append([]byte(nil), buf[:n]...)
+	}
+
+	c.ReorderPackets(true)
+	c.Write([]byte("first"))
+	c.Write([]byte("second"))
+	assert.Equal(t, "second", string(read()))
+	assert.Equal(t, "first", string(read()))
+	c.ReorderPackets(false)
+
+	c.CorruptPacket(1)
+	c.Write([]byte("payload"))
+	assert.NotEqual(t, "payload", string(read()))
+	c.CorruptPacket(0)
+
+	c.DelayPacket(time.Millisecond * 50)
+	start := time.Now()
+	c.Write([]byte("delayed"))
+	assert.Equal(t, "delayed", string(read()))
+	assert.True(t, time.Since(start) >= time.Millisecond*50)
+
+	c.DropPacketProbability(1)
+	c.Write([]byte("dropped"))
+	c.SetReadDeadline(time.Now().Add(time.Millisecond * 50))
+	_, err = c.Read(buf)
+	assert.Error(t, err)
+	assert.Equal(t, 1, c.Dropped())
+}
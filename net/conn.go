@@ -29,6 +29,11 @@ func NewConn(c net.Conn, heartBeat time.Duration) *Conn {
 	return &connection
 }
 
+// Connection returns the underlying connection.
+func (c *Conn) Connection() net.Conn {
+	return c.connection
+}
+
 // LocalAddr returns the local network address. The Addr returned is shared by all invocations of LocalAddr, so do not modify it.
 func (c *Conn) LocalAddr() net.Addr {
 	return c.connection.LocalAddr()
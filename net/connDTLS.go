@@ -1,6 +1,8 @@
 package net
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -8,6 +10,9 @@ import (
 	"time"
 )
 
+// ErrNotConnDTLS is returned by OnClose for connection which is not ConnDTLS.
+var ErrNotConnDTLS = errors.New("connection is not ConnDTLS")
+
 type connDTLSData struct {
 	data []byte
 	err  error
@@ -20,6 +25,12 @@ type ConnDTLS struct {
 	wg         sync.WaitGroup
 
 	readDeadline atomic.Value
+	onClose      func() // called when connection is closed, eg. to release slot of listener
+	fingerprint  *ClientHelloFingerprint
+
+	closeLock  sync.Mutex
+	closed     bool
+	closeFuncs []func(conn net.Conn) // registered by OnClose
 }
 
 func (c *ConnDTLS) readLoop() {
@@ -28,6 +39,10 @@ func (c *ConnDTLS) readLoop() {
 	for {
 		n, err := c.conn.Read(buf)
 		d := connDTLSData{err: err}
+		if err != nil {
+			// closed by peer, Close may be called by callbacks so they don't block readLoop
+			go c.runCloseFuncs()
+		}
 		if err == nil && n > 0 {
 			d.data = append(d.data, buf[:n]...)
 		}
@@ -114,9 +129,52 @@ func (c *ConnDTLS) Close() error {
 	err := c.conn.Close()
 	close(c.doneCh)
 	c.wg.Wait()
+	if c.onClose != nil {
+		c.onClose()
+	}
+	c.runCloseFuncs()
 	return err
 }
 
+// runCloseFuncs calls functions registered by OnClose once, the last registered first.
+func (c *ConnDTLS) runCloseFuncs() {
+	c.closeLock.Lock()
+	if c.closed {
+		c.closeLock.Unlock()
+		return
+	}
+	c.closed = true
+	fns := c.closeFuncs
+	c.closeFuncs = nil
+	c.closeLock.Unlock()
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i](c)
+	}
+}
+
+// OnClose registers fn to be called when conn, which must be ConnDTLS, is closed by Close or by peer.
+// Functions are called in reverse order of registration. When conn is closed already, fn is called immediately.
+func OnClose(conn net.Conn, fn func(conn net.Conn)) error {
+	c, ok := conn.(*ConnDTLS)
+	if !ok {
+		return ErrNotConnDTLS
+	}
+	c.closeLock.Lock()
+	if c.closed {
+		c.closeLock.Unlock()
+		fn(c)
+		return nil
+	}
+	c.closeFuncs = append(c.closeFuncs, fn)
+	c.closeLock.Unlock()
+	return nil
+}
+
+// CancelOnClose calls cancel, eg. of context used with conn, when conn is closed.
+func CancelOnClose(conn net.Conn, cancel func()) error {
+	return OnClose(conn, func(net.Conn) { cancel() })
+}
+
 func (c *ConnDTLS) LocalAddr() net.Addr {
 	return c.conn.LocalAddr()
 }
@@ -125,6 +183,14 @@ func (c *ConnDTLS) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
+// RemoteCertificate returns certificate of peer, it's nil when peer didn't send any.
+func (c *ConnDTLS) RemoteCertificate() *x509.Certificate {
+	if conn, ok := c.conn.(interface{ RemoteCertificate() *x509.Certificate }); ok {
+		return conn.RemoteCertificate()
+	}
+	return nil
+}
+
 func (c *ConnDTLS) SetDeadline(t time.Time) error {
 	err := c.SetReadDeadline(t)
 	if err != nil {
@@ -0,0 +1,50 @@
+package net
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnClose(t *testing.T) {
+	c, peer := net.Pipe()
+	defer peer.Close()
+	conn := NewConnDTLS(c)
+
+	calls := make(chan int, 4)
+	for i := 0; i < 3; i++ {
+		i := i
+		require.NoError(t, OnClose(conn, func(cc net.Conn) {
+			assert.Equal(t, conn, cc)
+			calls <- i
+		}))
+	}
+	require.NoError(t, conn.Close())
+	require.Len(t, calls, 3)
+	assert.Equal(t, []int{2, 1, 0}, []int{<-calls, <-calls, <-calls})
+
+	// already closed
+	require.NoError(t, OnClose(conn, func(net.Conn) { calls <- 3 }))
+	assert.Equal(t, 3, <-calls)
+
+	assert.Equal(t, ErrNotConnDTLS, OnClose(peer, func(net.Conn) {}))
+}
+
+func TestCancelOnClosePeer(t *testing.T) {
+	c, peer := net.Pipe()
+	conn := NewConnDTLS(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, CancelOnClose(conn, cancel))
+
+	peer.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		require.FailNow(t, "context was not cancelled when peer closed connection")
+	}
+	require.NoError(t, conn.Close())
+}
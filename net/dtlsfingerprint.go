@@ -0,0 +1,157 @@
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	dtlsRecordHeaderSize      = 13
+	dtlsHandshakeHeaderSize   = 12
+	dtlsContentTypeHandshake  = 22
+	dtlsHandshakeClientHello  = 1
+	extensionMaxFragmentLenID = 1
+)
+
+// ClientHelloFingerprint identifies implementation of DTLS client by parameters of its ClientHello,
+// which are the same for all connections of the client regardless of its random values.
+type ClientHelloFingerprint struct {
+	RecordVersion     uint16   // version of record layer, eg. 0xfefd for DTLS 1.2
+	CipherSuites      []uint16 // offered cipher suites, sorted
+	Extensions        []uint16 // types of offered extensions, sorted
+	MaxFragmentLength uint8    // code of max_fragment_length extension (RFC 6066), 0 when not offered
+}
+
+func hexList(ids []uint16) string {
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, fmt.Sprintf("%04x", id))
+	}
+	return strings.Join(s, ",")
+}
+
+// String returns canonical form of fingerprint, eg. "fefd|00a8,c0a8|000d,0017|0".
+func (fp *ClientHelloFingerprint) String() string {
+	return fmt.Sprintf("%04x|%v|%v|%v", fp.RecordVersion, hexList(fp.CipherSuites), hexList(fp.Extensions), fp.MaxFragmentLength)
+}
+
+func sortUint16(v []uint16) {
+	sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+}
+
+// parseClientHello computes fingerprint of ClientHello carried by the first DTLS record of datagram.
+func parseClientHello(b []byte) (*ClientHelloFingerprint, bool) {
+	if len(b) < dtlsRecordHeaderSize+dtlsHandshakeHeaderSize || b[0] != dtlsContentTypeHandshake {
+		return nil, false
+	}
+	fp := &ClientHelloFingerprint{RecordVersion: binary.BigEndian.Uint16(b[1:])}
+	recordLen := int(binary.BigEndian.Uint16(b[11:]))
+	b = b[dtlsRecordHeaderSize:]
+	if len(b) < recordLen || b[0] != dtlsHandshakeClientHello {
+		return nil, false
+	}
+	b = b[:recordLen]
+	fragmentLen := int(b[9])<<16 | int(b[10])<<8 | int(b[11])
+	b = b[dtlsHandshakeHeaderSize:]
+	if len(b) < fragmentLen {
+		return nil, false
+	}
+	// client_version and random
+	b = b[:fragmentLen]
+	if len(b) < 34 {
+		return nil, false
+	}
+	b = b[34:]
+	// session_id and cookie
+	for i := 0; i < 2; i++ {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return nil, false
+		}
+		b = b[1+int(b[0]):]
+	}
+	if len(b) < 2 {
+		return nil, false
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if n%2 != 0 || len(b) < 2+n {
+		return nil, false
+	}
+	for i := 2; i < 2+n; i += 2 {
+		fp.CipherSuites = append(fp.CipherSuites, binary.BigEndian.Uint16(b[i:]))
+	}
+	b = b[2+n:]
+	// compression_methods
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, false
+	}
+	b = b[1+int(b[0]):]
+	if len(b) >= 2 {
+		n = int(binary.BigEndian.Uint16(b))
+		b = b[2:]
+		if len(b) < n {
+			return nil, false
+		}
+		b = b[:n]
+		for len(b) >= 4 {
+			typ := binary.BigEndian.Uint16(b)
+			l := int(binary.BigEndian.Uint16(b[2:]))
+			if len(b) < 4+l {
+				return nil, false
+			}
+			fp.Extensions = append(fp.Extensions, typ)
+			if typ == extensionMaxFragmentLenID && l == 1 {
+				fp.MaxFragmentLength = b[4]
+			}
+			b = b[4+l:]
+		}
+	}
+	sortUint16(fp.CipherSuites)
+	sortUint16(fp.Extensions)
+	return fp, true
+}
+
+// DTLSFingerprint returns fingerprint of ClientHello of DTLS client connected by conn. It's known
+// for connections accepted by listener of NewDTLSListenerFromConn, which sees datagrams before
+// the handshake, otherwise false is returned.
+func DTLSFingerprint(conn net.Conn) (*ClientHelloFingerprint, bool) {
+	c, ok := conn.(*ConnDTLS)
+	if !ok || c.fingerprint == nil {
+		return nil, false
+	}
+	return c.fingerprint, true
+}
+
+// KnownFingerprintStore holds fingerprints of expected DTLS clients with metadata, eg. name of
+// device firmware. Zero value is empty store ready to use.
+type KnownFingerprintStore struct {
+	lock  sync.Mutex
+	known map[string]string
+}
+
+// IsKnown reports whether fp was added to the store.
+func (s *KnownFingerprintStore) IsKnown(fp *ClientHelloFingerprint) bool {
+	_, ok := s.Metadata(fp)
+	return ok
+}
+
+// Metadata returns metadata of known fp.
+func (s *KnownFingerprintStore) Metadata(fp *ClientHelloFingerprint) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	m, ok := s.known[fp.String()]
+	return m, ok
+}
+
+// Add adds fp with metadata to the store, metadata of already known fp is replaced.
+func (s *KnownFingerprintStore) Add(fp *ClientHelloFingerprint, metadata string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.known == nil {
+		s.known = make(map[string]string)
+	}
+	s.known[fp.String()] = metadata
+}
@@ -0,0 +1,111 @@
+package net
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialPSKWithSuites(addr net.Addr, suites []dtls.CipherSuiteID) (*dtls.Conn, error) {
+	connectTimeout := time.Second * 3
+	return dtls.Dial("udp", addr.(*net.UDPAddr), &dtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("client"),
+		CipherSuites:    suites,
+		ConnectTimeout:  &connectTimeout,
+	})
+}
+
+func TestDTLSFingerprint(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	cfg := testPSKConfig()
+	cfg.CipherSuites = []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8, dtls.TLS_PSK_WITH_AES_128_GCM_SHA256}
+	l, err := NewDTLSListenerFromConn(conn, cfg, time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	var store KnownFingerprintStore
+	l.SetFingerprintStore(&store)
+
+	clients := [][]dtls.CipherSuiteID{
+		{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+		{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256, dtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	seen := make(map[string]bool)
+	for _, suites := range clients {
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			c, err := l.Accept()
+			if err == nil {
+				accepted <- c
+			}
+		}()
+		c, err := dialPSKWithSuites(l.Addr(), suites)
+		require.NoError(t, err)
+		defer c.Close()
+
+		var s net.Conn
+		select {
+		case s = <-accepted:
+			defer s.Close()
+		case <-time.After(time.Second * 3):
+			require.FailNow(t, "connection not accepted")
+		}
+		fp, ok := DTLSFingerprint(s)
+		require.True(t, ok)
+		assert.Equal(t, uint16(0xfefd), fp.RecordVersion)
+		assert.Len(t, fp.CipherSuites, len(suites))
+		assert.Equal(t, uint8(0), fp.MaxFragmentLength)
+		assert.False(t, seen[fp.String()], "fingerprint %v is not distinct", fp)
+		seen[fp.String()] = true
+
+		assert.False(t, store.IsKnown(fp))
+		store.Add(fp, "client")
+		assert.True(t, store.IsKnown(fp))
+		m, ok := store.Metadata(fp)
+		assert.True(t, ok)
+		assert.Equal(t, "client", m)
+	}
+	assert.Len(t, seen, 3)
+
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+	_, ok := DTLSFingerprint(p1)
+	assert.False(t, ok)
+}
+
+func TestParseClientHelloMaxFragmentLength(t *testing.T) {
+	hello := []byte{
+		0xfe, 0xfd, // client_version
+	}
+	hello = append(hello, make([]byte, 32)...) // random
+	hello = append(hello,
+		0x00,                               // session_id
+		0x00,                               // cookie
+		0x00, 0x04, 0xc0, 0xa8, 0x00, 0xa8, // cipher_suites
+		0x01, 0x00, // compression_methods
+		0x00, 0x09, // extensions
+		0x00, 0x17, 0x00, 0x00, // extended_master_secret
+		0x00, 0x01, 0x00, 0x01, 0x02, // max_fragment_length 2^10
+	)
+	handshake := append([]byte{dtlsHandshakeClientHello, 0, 0, byte(len(hello)), 0, 0, 0, 0, 0, 0, 0, byte(len(hello))}, hello...)
+	record := append([]byte{dtlsContentTypeHandshake, 0xfe, 0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(len(handshake))}, handshake...)
+
+	fp, ok := parseClientHello(record)
+	require.True(t, ok)
+	assert.Equal(t, []uint16{0x00a8, 0xc0a8}, fp.CipherSuites)
+	assert.Equal(t, []uint16{0x0001, 0x0017}, fp.Extensions)
+	assert.Equal(t, uint8(2), fp.MaxFragmentLength)
+	assert.Equal(t, "fefd|00a8,c0a8|0001,0017|2", fp.String())
+
+	_, ok = parseClientHello(record[:len(record)-3])
+	assert.False(t, ok)
+}
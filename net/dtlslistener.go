@@ -2,7 +2,9 @@ package net
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -11,40 +13,206 @@ import (
 	"github.com/pion/dtls"
 )
 
+var errListenerClosed = errors.New("listener closed")
+
 type connData struct {
-	conn net.Conn
-	err  error
+	conn   net.Conn
+	err    error
+	queued time.Time // when the connection was queued, for ListenerMetrics
+}
+
+// AcceptedConn is connection delivered by DTLSListener.Connections, Err is set when accepting failed.
+type AcceptedConn struct {
+	Conn net.Conn
+	Err  error
+}
+
+// BackpressureConfig slows down accepting of DTLS handshakes when application doesn't
+// take accepted connections fast enough.
+type BackpressureConfig struct {
+	// QueueSize is capacity of queue of accepted connections. Defaults is 0 - unbuffered queue
+	// and accepting waits for application.
+	QueueSize int
+	// SlowDownAt is fraction of full queue (0-1) from which accepting is slowed down.
+	SlowDownAt float64
+	// SlowDownDelay is delay before next accept when queue is filled over SlowDownAt.
+	SlowDownDelay time.Duration
+	// MaxConnections is maximal count of active connections. When it's reached, accepted connections
+	// wait until an active connection is closed. Default is 0 - unlimited.
+	MaxConnections int
+}
+
+func (c BackpressureConfig) overloaded(queueLen int) bool {
+	if c.QueueSize == 0 || c.SlowDownDelay == 0 {
+		return false
+	}
+	return float64(queueLen) >= c.SlowDownAt*float64(c.QueueSize)
+}
+
+// dtlsAcceptor accepts DTLS connections of one socket, it is implemented by dtls.Listener.
+type dtlsAcceptor interface {
+	Accept() (net.Conn, error)
+	Close(shutdownTimeout time.Duration) error
+	Addr() net.Addr
 }
 
 // DTLSListener is a DTLS listener that provides accept with context.
 type DTLSListener struct {
-	listener  *dtls.Listener
-	heartBeat time.Duration
-	wg        sync.WaitGroup
-	doneCh    chan struct{}
-	connCh    chan connData
+	listeners    []dtlsAcceptor
+	conn         *net.UDPConn // socket created outside of dtls package, it can be handed off
+	networks     []string
+	backpressure BackpressureConfig
+	wg           sync.WaitGroup
+	doneCh       chan struct{}
+	connCh       chan connData
+	slots        chan struct{} // semaphore of active connections when MaxConnections is set
+	active       int64
+	closing      int32
+
+	connectionsOnce sync.Once
+	connections     chan AcceptedConn
+	delivering      int32 // connection taken from connCh is waiting for Connections reader
+
+	drainTimeout time.Duration
+	fingerprints *KnownFingerprintStore
+	stats        acceptStats
 
-	deadline atomic.Value
+	failedInit sync.Once
+	failedOnce sync.Once
+	failed     chan struct{}
+
+	deadline           atomic.Value
+	handshakeErrorFunc atomic.Value // func(err error)
 }
 
-func (l *DTLSListener) acceptLoop() {
+// maxAcceptLoopRestarts is count of restarts of accept loop which stopped unexpectedly, eg. by panic
+// of dtls package, before the listener fails.
+const maxAcceptLoopRestarts = 3
+
+// acceptLoopRestartDelay is delay before the first restart of accept loop, it doubles by every restart.
+var acceptLoopRestartDelay = time.Millisecond * 100
+
+// acceptLoop runs accepting and restarts it when it stops unexpectedly. When restarts are
+// exhausted, Failed is closed.
+func (l *DTLSListener) acceptLoop(accept func() (net.Conn, error)) {
 	defer l.wg.Done()
+	delay := acceptLoopRestartDelay
+	for restarts := 0; ; restarts++ {
+		if l.accepting(accept) {
+			return
+		}
+		if restarts == maxAcceptLoopRestarts {
+			l.failedOnce.Do(func() { close(l.failedCh()) })
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-l.doneCh:
+			return
+		}
+		delay *= 2
+	}
+}
+
+// accepting accepts connections until the listener is closed, then it returns true. It returns
+// false when accept panics.
+func (l *DTLSListener) accepting(accept func() (net.Conn, error)) (closed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			closed = false
+		}
+	}()
 	for {
-		conn, err := l.listener.Accept()
+		if l.backpressure.overloaded(len(l.connCh)) {
+			// the handshakes are queued by the dtls listener meanwhile
+			select {
+			case <-time.After(l.backpressure.SlowDownDelay):
+			case <-l.doneCh:
+				return true
+			}
+		}
+		conn, err := accept()
+		if err != nil && !l.closed(err) {
+			// handshake with the peer failed, eg. its PSK identity is unknown
+			atomic.AddInt64(&l.stats.errors, 1)
+			if f, ok := l.handshakeErrorFunc.Load().(func(error)); ok && f != nil {
+				f(err)
+			}
+			continue
+		}
+		if err == nil && l.slots != nil {
+			l.wg.Add(1)
+			go l.deliverWhenSlotFree(conn)
+			continue
+		}
 		select {
-		case l.connCh <- connData{conn: conn, err: err}:
+		case l.connCh <- connData{conn: conn, err: err, queued: time.Now()}:
 			if err != nil {
+				return true
+			}
+		case <-l.doneCh:
+			return true
+		}
+	}
+}
+
+func (l *DTLSListener) failedCh() chan struct{} {
+	l.failedInit.Do(func() { l.failed = make(chan struct{}) })
+	return l.failed
+}
+
+// Failed returns channel which is closed when accepting failed permanently, after accept loop was
+// restarted 3 times. The listener doesn't accept new connections then and it should be closed.
+func (l *DTLSListener) Failed() <-chan struct{} {
+	return l.failedCh()
+}
+
+// closed reports whether accept failed by err because the listener is closed.
+func (l *DTLSListener) closed(err error) bool {
+	if atomic.LoadInt32(&l.closing) != 0 || err == errClosedUDPDemux {
+		return true
+	}
+	// error of closed listener of dtls package is not exported
+	return err.Error() == "udp: listener closed"
+}
+
+// deliverWhenSlotFree waits for free slot of active connection and passes conn to Accept.
+// Waiting in own goroutine keeps accepting of other connections. Data received meanwhile are
+// dropped, otherwise the dtls listener would stop reading of the socket for all connections.
+func (l *DTLSListener) deliverWhenSlotFree(conn net.Conn) {
+	defer l.wg.Done()
+	c := NewConnDTLS(conn)
+	for acquired := false; !acquired; {
+		select {
+		case l.slots <- struct{}{}:
+			acquired = true
+		case d := <-c.readDataCh:
+			if d.err != nil {
+				c.Close()
 				return
 			}
 		case <-l.doneCh:
+			c.Close()
 			return
 		}
 	}
+	select {
+	case l.connCh <- connData{conn: c, queued: time.Now()}:
+	case <-l.doneCh:
+		<-l.slots
+		c.Close()
+	}
 }
 
 // NewDTLSListener creates dtls listener.
-// Known networks are "udp", "udp4" (IPv4-only), "udp6" (IPv6-only).
+// Known networks are "udp", "udp4" (IPv4-only), "udp6" (IPv6-only). heartBeat is unused,
+// accepting is driven by handshakes instead of polling, it's kept for compatibility.
 func NewDTLSListener(network string, addr string, cfg *dtls.Config, heartBeat time.Duration) (*DTLSListener, error) {
+	return NewDTLSListenerWithBackpressure(network, addr, cfg, heartBeat, BackpressureConfig{})
+}
+
+// NewDTLSListenerWithBackpressure creates dtls listener which slows down accepting by backpressure.
+func NewDTLSListenerWithBackpressure(network string, addr string, cfg *dtls.Config, heartBeat time.Duration, backpressure BackpressureConfig) (*DTLSListener, error) {
 	a, err := net.ResolveUDPAddr(network, addr)
 	if err != nil {
 		return nil, fmt.Errorf("cannot resolve address: %v", err)
@@ -53,42 +221,198 @@ func NewDTLSListener(network string, addr string, cfg *dtls.Config, heartBeat ti
 	if err != nil {
 		return nil, fmt.Errorf("cannot create new dtls listener: %v", err)
 	}
+	networks := []string{network}
+	if network == "udp" {
+		networks = udpNetworks(listener.Addr().(*net.UDPAddr).IP)
+	}
+	return newDTLSListener([]dtlsAcceptor{listener}, networks, backpressure), nil
+}
+
+// NewDTLSListenerFromConn creates dtls listener which serves already opened socket conn,
+// the listener takes ownership of conn.
+func NewDTLSListenerFromConn(conn *net.UDPConn, cfg *dtls.Config, heartBeat time.Duration) (*DTLSListener, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("cannot create new dtls listener: no config provided")
+	}
+	networks := udpNetworks(conn.LocalAddr().(*net.UDPAddr).IP)
+	l := newDTLSListener([]dtlsAcceptor{udpDemuxDTLSListener{udpDemux: newUDPDemux(conn), cfg: cfg}}, networks, BackpressureConfig{})
+	l.conn = conn
+	return l, nil
+}
+
+func newDTLSListener(listeners []dtlsAcceptor, networks []string, backpressure BackpressureConfig) *DTLSListener {
 	l := DTLSListener{
-		listener:  listener,
-		heartBeat: heartBeat,
-		doneCh:    make(chan struct{}),
-		connCh:    make(chan connData),
+		listeners:    listeners,
+		networks:     networks,
+		backpressure: backpressure,
+		doneCh:       make(chan struct{}),
+		connCh:       make(chan connData, backpressure.QueueSize),
+	}
+	if backpressure.MaxConnections > 0 {
+		l.slots = make(chan struct{}, backpressure.MaxConnections)
+	}
+	for _, listener := range listeners {
+		l.wg.Add(1)
+		go l.acceptLoop(listener.Accept)
+	}
+	return &l
+}
+
+// udpNetworks returns stacks served by socket bound to ip via network "udp".
+func udpNetworks(ip net.IP) []string {
+	switch {
+	case ip.To4() != nil:
+		return []string{"udp4"}
+	case ip.IsUnspecified() && supportsDualStack():
+		return []string{"udp4", "udp6"}
 	}
-	l.wg.Add(1)
+	return []string{"udp6"}
+}
 
-	go l.acceptLoop()
+// supportsDualStack is replaceable for tests.
+var supportsDualStack = detectDualStack
 
-	return &l, nil
+// detectDualStack detects whether a socket bound via "udp" to wildcard address
+// receives also IPv4 packets.
+func detectDualStack() bool {
+	c, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return false
+	}
+	defer c.Close()
+	a := c.LocalAddr().(*net.UDPAddr)
+	if a.IP.To4() != nil {
+		return false
+	}
+	sender, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: a.Port})
+	if err != nil {
+		return false
+	}
+	defer sender.Close()
+	if _, err := sender.Write([]byte{0}); err != nil {
+		return false
+	}
+	if err := c.SetReadDeadline(time.Now().Add(time.Millisecond * 100)); err != nil {
+		return false
+	}
+	_, err = c.Read(make([]byte, 1))
+	return err == nil
 }
 
-// AcceptWithContext waits with context for a generic Conn.
+// NewDualStackDTLSListener creates dtls listener which serves IPv4 and IPv6 clients.
+// When the OS provides a dual-stack socket, single socket is used, otherwise
+// udp4 and udp6 sockets are bound to the same port and their connections are merged.
+func NewDualStackDTLSListener(addr string, cfg *dtls.Config, heartBeat time.Duration) (*DTLSListener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve address: %v", err)
+	}
+	if host != "" || supportsDualStack() {
+		return NewDTLSListener("udp", addr, cfg, heartBeat)
+	}
+
+	a, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve address: %v", err)
+	}
+	l4, err := dtls.Listen("udp4", a, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new dtls listener: %v", err)
+	}
+	// bind udp6 to the same port, it matters when port is chosen by OS
+	a6 := &net.UDPAddr{Port: l4.Addr().(*net.UDPAddr).Port}
+	l6, err := dtls.Listen("udp6", a6, cfg)
+	if err != nil {
+		// IPv6 is not available
+		return newDTLSListener([]dtlsAcceptor{l4}, []string{"udp4"}, BackpressureConfig{}), nil
+	}
+	return newDTLSListener([]dtlsAcceptor{l4, l6}, []string{"udp4", "udp6"}, BackpressureConfig{}), nil
+}
+
+// AcceptWithContext waits with context for a generic Conn, it takes connections from Connections.
 func (l *DTLSListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("cannot accept connections: %v", ctx.Err())
+	case c, ok := <-l.Connections():
+		if !ok {
+			return nil, fmt.Errorf("cannot accept connections: %v", errListenerClosed)
+		}
+		if c.Err != nil {
+			return nil, fmt.Errorf("cannot accept connections: %v", c.Err)
+		}
+		return c.Conn, nil
+	}
+}
+
+// Connections returns channel of accepted connections, so server built around select can wait for them
+// with its own channels. The channel is closed when the listener is closed. Connections buffered by
+// BackpressureConfig.QueueSize are delivered to it one by one. Connections (and AcceptWithContext)
+// must not be used together with Accept on the same listener, they would take each other's connections.
+func (l *DTLSListener) Connections() <-chan AcceptedConn {
+	l.connectionsOnce.Do(func() {
+		l.connections = make(chan AcceptedConn)
+		if atomic.LoadInt32(&l.closing) != 0 {
+			close(l.connections)
+			return
+		}
+		l.wg.Add(1)
+		go l.deliverConnections()
+	})
+	return l.connections
+}
+
+func (l *DTLSListener) deliverConnections() {
+	defer l.wg.Done()
+	defer close(l.connections)
 	for {
 		select {
-		case <-ctx.Done():
-			if ctx.Err() != nil {
-				return nil, fmt.Errorf("cannot accept connections: %v", ctx.Err())
+		case d := <-l.connCh:
+			atomic.StoreInt32(&l.delivering, 1)
+			conn, err := l.newConn(d)
+			select {
+			case l.connections <- AcceptedConn{Conn: conn, Err: err}:
+				atomic.StoreInt32(&l.delivering, 0)
+				l.stats.accepted(d)
+			case <-l.doneCh:
+				if conn != nil {
+					conn.Close()
+				}
+				return
 			}
-			return nil, nil
-		default:
-		}
-		err := l.SetDeadline(time.Now().Add(l.heartBeat))
-		if err != nil {
-			return nil, fmt.Errorf("cannot accept connections: %v", err)
+		case <-l.doneCh:
+			return
 		}
-		rw, err := l.Accept()
-		if err != nil {
-			if isTemporary(err) {
-				continue
-			}
-			return nil, fmt.Errorf("cannot accept connections: %v", err)
+	}
+}
+
+// SetDrainOnClose makes Close wait up to timeout until connections accepted already are taken by
+// Accept or Connections, so requests which arrived before Close are served. New handshakes are
+// accepted meanwhile. It must be called before the listener is served.
+func (l *DTLSListener) SetDrainOnClose(timeout time.Duration) {
+	l.drainTimeout = timeout
+}
+
+// SetFingerprintStore makes the listener log accepted connections whose DTLSFingerprint isn't known
+// by store, eg. to detect scanners. It must be called before the listener is served.
+func (l *DTLSListener) SetFingerprintStore(store *KnownFingerprintStore) {
+	l.fingerprints = store
+}
+
+// SetHandshakeErrorFunc sets f which is called with error of every failed handshake, eg. to alert
+// on spikes of failures. It may be called while the listener is served, f is called concurrently
+// by accepting goroutines.
+func (l *DTLSListener) SetHandshakeErrorFunc(f func(err error)) {
+	l.handshakeErrorFunc.Store(f)
+}
+
+// drain waits until queue of accepted connections is empty or deadline.
+func (l *DTLSListener) drain(deadline time.Time) {
+	for time.Now().Before(deadline) {
+		if len(l.connCh) == 0 && atomic.LoadInt32(&l.delivering) == 0 {
+			return
 		}
-		return rw, nil
+		time.Sleep(time.Millisecond)
 	}
 }
 
@@ -107,35 +431,91 @@ func (l *DTLSListener) Accept() (net.Conn, error) {
 	}
 
 	if deadline.IsZero() {
-		select {
-		case d := <-l.connCh:
-			if d.err != nil {
-				return nil, d.err
-			}
-			return NewConnDTLS(d.conn), nil
-		}
+		return l.accepted(<-l.connCh)
 	}
 
+	// ready connection is preferred over expired deadline, select would choose randomly
+	select {
+	case d := <-l.connCh:
+		return l.accepted(d)
+	default:
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
 	select {
 	case d := <-l.connCh:
-		if d.err != nil {
-			return nil, d.err
+		return l.accepted(d)
+	case <-timer.C:
+		select {
+		case d := <-l.connCh:
+			// connection arrived together with the deadline
+			return l.accepted(d)
+		default:
 		}
-		return NewConnDTLS(d.conn), nil
-	case <-time.After(deadline.Sub(time.Now())):
 		return nil, fmt.Errorf(ioTimeout)
 	}
 }
 
-// Close closes the connection.
+func (l *DTLSListener) accepted(d connData) (net.Conn, error) {
+	l.stats.accepted(d)
+	return l.newConn(d)
+}
+
+func (l *DTLSListener) newConn(d connData) (net.Conn, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	c, ok := d.conn.(*ConnDTLS)
+	if !ok {
+		c = NewConnDTLS(d.conn)
+	}
+	if fp, ok := DTLSFingerprint(c); ok && l.fingerprints != nil && !l.fingerprints.IsKnown(fp) {
+		log.Printf("coap: info: unknown DTLS client fingerprint %v of %v", fp, c.RemoteAddr())
+	}
+	atomic.AddInt64(&l.active, 1)
+	c.onClose = func() {
+		atomic.AddInt64(&l.active, -1)
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+	return c, nil
+}
+
+// Metrics returns metrics of accepting.
+func (l *DTLSListener) Metrics() *ListenerMetrics {
+	return &ListenerMetrics{l: l}
+}
+
+// ActiveConnections returns count of accepted connections which are not closed yet.
+func (l *DTLSListener) ActiveConnections() int64 {
+	return atomic.LoadInt64(&l.active)
+}
+
+// Close closes the connection. Queued connections are delivered first when SetDrainOnClose is set.
 func (l *DTLSListener) Close() error {
-	err := l.listener.Close(time.Millisecond * 100)
+	if l.drainTimeout > 0 {
+		l.drain(time.Now().Add(l.drainTimeout))
+	}
+	atomic.StoreInt32(&l.closing, 1)
+	var err error
+	for _, listener := range l.listeners {
+		if e := listener.Close(time.Millisecond * 100); e != nil && err == nil {
+			err = e
+		}
+	}
 	close(l.doneCh)
 	l.wg.Wait()
 	return err
 }
 
 // Addr represents a network end point address.
+// For listener with more sockets it's address of the first one.
 func (l *DTLSListener) Addr() net.Addr {
-	return l.listener.Addr()
+	return l.listeners[0].Addr()
+}
+
+// Networks returns active network stacks, eg. []string{"udp4", "udp6"}.
+func (l *DTLSListener) Networks() []string {
+	return append([]string(nil), l.networks...)
 }
@@ -0,0 +1,371 @@
+package net
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPSKConfig() *dtls.Config {
+	connectTimeout := time.Second * 5
+	return &dtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("go-coap"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		ConnectTimeout:  &connectTimeout,
+	}
+}
+
+func TestDualStackDTLSListener(t *testing.T) {
+	testDualStackDTLSListener(t)
+}
+
+func TestDualStackDTLSListenerSeparateSockets(t *testing.T) {
+	supportsDualStack = func() bool { return false }
+	defer func() { supportsDualStack = detectDualStack }()
+	testDualStackDTLSListener(t)
+}
+
+func testDualStackDTLSListener(t *testing.T) {
+	l, err := NewDualStackDTLSListener(":0", testPSKConfig(), time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Contains(t, l.Networks(), "udp4")
+
+	go func() {
+		for {
+			c, err := l.AcceptWithContext(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				b := make([]byte, 64)
+				for {
+					n, err := c.Read(b)
+					if err != nil {
+						return
+					}
+					c.Write(b[:n])
+				}
+			}()
+		}
+	}()
+
+	port := l.Addr().(*net.UDPAddr).Port
+	clients := map[string]net.IP{"udp4": net.IPv4(127, 0, 0, 1)}
+	if len(l.Networks()) > 1 {
+		clients["udp6"] = net.IPv6loopback
+	}
+	for network, ip := range clients {
+		c, err := dtls.Dial(network, &net.UDPAddr{IP: ip, Port: port}, testPSKConfig())
+		require.NoError(t, err, network)
+		_, err = c.Write([]byte(network))
+		require.NoError(t, err)
+		b := make([]byte, 64)
+		n, err := c.Read(b)
+		require.NoError(t, err)
+		assert.Equal(t, network, string(b[:n]))
+		c.Close()
+	}
+}
+
+type idConn struct {
+	net.Conn
+	id int
+}
+
+func TestDTLSListenerBackpressure(t *testing.T) {
+	cfg := BackpressureConfig{QueueSize: 10, SlowDownAt: 0.5, SlowDownDelay: time.Millisecond * 20}
+	l := &DTLSListener{
+		backpressure: cfg,
+		doneCh:       make(chan struct{}),
+		connCh:       make(chan connData, cfg.QueueSize),
+	}
+	var lock sync.Mutex
+	var accepts []time.Time
+	accept := func() (net.Conn, error) {
+		lock.Lock()
+		accepts = append(accepts, time.Now())
+		id := len(accepts)
+		lock.Unlock()
+		time.Sleep(time.Millisecond)
+		return idConn{id: id}, nil
+	}
+	l.wg.Add(1)
+	go l.acceptLoop(accept)
+
+	// nobody takes connections: queue fills up and accepting slows down
+	time.Sleep(time.Millisecond * 300)
+	lock.Lock()
+	filled := append([]time.Time(nil), accepts...)
+	lock.Unlock()
+	// all slots of the queue and one blocked send
+	require.Len(t, filled, cfg.QueueSize+1)
+	for i := cfg.QueueSize / 2; i < len(filled); i++ {
+		assert.True(t, filled[i].Sub(filled[i-1]) >= cfg.SlowDownDelay, "accept %v wasn't slowed down", i)
+	}
+
+	// drain: accepting recovers
+	nextID := 1
+	take := func() {
+		d := <-l.connCh
+		require.NoError(t, d.err)
+		require.Equal(t, nextID, d.conn.(idConn).id, "connection was discarded")
+		nextID++
+	}
+	deadline := time.Now().Add(time.Millisecond * 200)
+	for time.Now().Before(deadline) {
+		take()
+	}
+	assert.Greater(t, nextID-1-len(filled), 50)
+
+	close(l.doneCh)
+	l.wg.Wait()
+	for len(l.connCh) > 0 {
+		take()
+	}
+}
+
+func TestDTLSListenerMaxConnections(t *testing.T) {
+	l, err := NewDTLSListenerWithBackpressure("udp", "127.0.0.1:0", testPSKConfig(), time.Millisecond*100, BackpressureConfig{MaxConnections: 2})
+	require.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 3)
+	go func() {
+		for {
+			c, err := l.AcceptWithContext(context.Background())
+			if err != nil {
+				return
+			}
+			accepted <- c
+			go func() {
+				defer c.Close()
+				b := make([]byte, 64)
+				for {
+					if _, err := c.Read(b); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	clients := make([]*dtls.Conn, 3)
+	for i := range clients {
+		c, err := dtls.Dial("udp", l.Addr().(*net.UDPAddr), testPSKConfig())
+		require.NoError(t, err)
+		defer c.Close()
+		clients[i] = c
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-accepted:
+		case <-time.After(time.Second):
+			t.Fatalf("connection %v wasn't accepted", i)
+		}
+	}
+	select {
+	case <-accepted:
+		t.Fatalf("third connection was accepted over the limit")
+	case <-time.After(time.Millisecond * 300):
+	}
+	assert.Equal(t, int64(2), l.ActiveConnections())
+
+	require.NoError(t, clients[0].Close())
+	select {
+	case <-accepted:
+	case <-time.After(time.Second * 3):
+		t.Fatalf("third connection wasn't accepted after first one was closed")
+	}
+	assert.Equal(t, int64(2), l.ActiveConnections())
+}
+
+func TestDTLSListenerConnections(t *testing.T) {
+	l, err := NewDTLSListener("udp", "127.0.0.1:0", testPSKConfig(), time.Millisecond*100)
+	require.NoError(t, err)
+
+	quit := make(chan struct{})
+	accepted := make(chan net.Conn, 2)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case c, ok := <-l.Connections():
+				if !ok {
+					return
+				}
+				if c.Err == nil {
+					accepted <- c.Conn
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		c, err := dtls.Dial("udp", l.Addr().(*net.UDPAddr), testPSKConfig())
+		require.NoError(t, err)
+		defer c.Close()
+		select {
+		case c := <-accepted:
+			defer c.Close()
+		case <-time.After(time.Second * 3):
+			t.Fatalf("connection %v wasn't accepted", i)
+		}
+	}
+	assert.Equal(t, int64(2), l.ActiveConnections())
+
+	require.NoError(t, l.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		close(quit)
+		t.Fatal("channel of connections wasn't closed")
+	}
+	_, err = l.AcceptWithContext(context.Background())
+	assert.Error(t, err)
+}
+
+func TestDTLSListenerAcceptDeadlineRace(t *testing.T) {
+	l := &DTLSListener{doneCh: make(chan struct{}), connCh: make(chan connData, 1)}
+	newConn := func() *ConnDTLS {
+		c, peer := net.Pipe()
+		peer.Close()
+		return NewConnDTLS(c)
+	}
+
+	// connection is ready when deadline has expired already
+	for i := 0; i < 100; i++ {
+		conn := newConn()
+		l.connCh <- connData{conn: conn}
+		l.SetDeadline(time.Now())
+		c, err := l.Accept()
+		require.NoError(t, err, "iteration %v", i)
+		require.Equal(t, conn, c)
+		c.Close()
+	}
+
+	// connection arrives around the deadline
+	for i := 0; i < 20; i++ {
+		conn := newConn()
+		sent := make(chan struct{})
+		go func() {
+			defer close(sent)
+			time.Sleep(time.Millisecond)
+			l.connCh <- connData{conn: conn}
+		}()
+		l.SetDeadline(time.Now().Add(time.Millisecond))
+		c, err := l.Accept()
+		if err != nil {
+			// the connection isn't lost, it's taken by the next accept
+			l.SetDeadline(time.Time{})
+			c, err = l.Accept()
+			require.NoError(t, err)
+		}
+		require.Equal(t, conn, c)
+		<-sent
+		c.Close()
+	}
+	assert.Equal(t, int64(0), l.ActiveConnections())
+}
+
+func TestDTLSListenerDrainOnClose(t *testing.T) {
+	newListener := func() *DTLSListener {
+		l := &DTLSListener{doneCh: make(chan struct{}), connCh: make(chan connData, 5)}
+		for i := 0; i < 5; i++ {
+			c, peer := net.Pipe()
+			peer.Close()
+			l.connCh <- connData{conn: NewConnDTLS(c)}
+		}
+		return l
+	}
+
+	l := newListener()
+	l.SetDrainOnClose(time.Second)
+	var accepted, handled int32
+	go func() {
+		// server is busy when Close is called
+		time.Sleep(time.Millisecond * 50)
+		for i := 0; i < 5; i++ {
+			c, err := l.AcceptWithContext(context.Background())
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			time.Sleep(time.Millisecond * 10)
+			c.Close()
+			atomic.AddInt32(&handled, 1)
+		}
+	}()
+	start := time.Now()
+	require.NoError(t, l.Close())
+	assert.True(t, time.Since(start) >= time.Millisecond*50)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&accepted))
+	assert.True(t, atomic.LoadInt32(&handled) >= 4)
+
+	// without drain queued connections are left
+	l = newListener()
+	require.NoError(t, l.Close())
+	assert.Len(t, l.connCh, 5)
+}
+
+func TestDTLSListenerAcceptLoopRestart(t *testing.T) {
+	restartDelay := acceptLoopRestartDelay
+	acceptLoopRestartDelay = time.Millisecond * 10
+	defer func() {
+		acceptLoopRestartDelay = restartDelay
+	}()
+
+	// accept loop recovers
+	l := &DTLSListener{doneCh: make(chan struct{}), connCh: make(chan connData)}
+	var calls int32
+	l.wg.Add(1)
+	go l.acceptLoop(func() (net.Conn, error) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			panic("internal error")
+		}
+		c, peer := net.Pipe()
+		peer.Close()
+		return NewConnDTLS(c), nil
+	})
+	c, err := l.Accept()
+	require.NoError(t, err)
+	c.Close()
+	select {
+	case <-l.Failed():
+		require.FailNow(t, "listener failed")
+	default:
+	}
+	close(l.doneCh)
+	l.wg.Wait()
+
+	// restarts are exhausted
+	l = &DTLSListener{doneCh: make(chan struct{}), connCh: make(chan connData)}
+	calls = 0
+	l.wg.Add(1)
+	go l.acceptLoop(func() (net.Conn, error) {
+		atomic.AddInt32(&calls, 1)
+		panic("internal error")
+	})
+	select {
+	case <-l.Failed():
+	case <-time.After(time.Second):
+		require.FailNow(t, "listener didn't fail")
+	}
+	l.wg.Wait()
+	assert.Equal(t, int32(maxAcceptLoopRestarts+1), atomic.LoadInt32(&calls))
+	close(l.doneCh)
+}
@@ -0,0 +1,66 @@
+// +build !windows
+
+package net
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pion/dtls"
+)
+
+// File returns copy of file descriptor of the listener socket, so it can be passed
+// to a new process, eg. by exec.Cmd.ExtraFiles or SCM_RIGHTS. Only listeners created
+// by NewDTLSListenerFromConn or NewDTLSListenerFromFile own their socket and support it.
+func (l *DTLSListener) File() (*os.File, error) {
+	if l.conn == nil {
+		return nil, fmt.Errorf("cannot get file of dtls listener: socket is owned by dtls package")
+	}
+	// (*net.UDPConn).File returns file whose Fd switches the shared socket to blocking mode,
+	// then reads of the listener cannot be interrupted by Close and steal packets of the new process.
+	rc, err := l.conn.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get file of dtls listener: %v", err)
+	}
+	var fd int
+	var dupErr error
+	err = rc.Control(func(s uintptr) {
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+		fd, dupErr = syscall.Dup(int(s))
+		if dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	})
+	if err == nil {
+		err = dupErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get file of dtls listener: %v", err)
+	}
+	return os.NewFile(uintptr(fd), l.conn.LocalAddr().String()), nil
+}
+
+// NewDTLSListenerFromFile creates dtls listener which serves socket inherited from
+// other process, eg. obtained by DTLSListener.File. The file is not used by the listener
+// after the call, so it should be closed by caller.
+func NewDTLSListenerFromFile(f *os.File, cfg *dtls.Config, heartBeat time.Duration) (*DTLSListener, error) {
+	c, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new dtls listener: %v", err)
+	}
+	conn, ok := c.(*net.UDPConn)
+	if !ok {
+		c.Close()
+		return nil, fmt.Errorf("cannot create new dtls listener: file is not udp socket")
+	}
+	l, err := NewDTLSListenerFromConn(conn, cfg, heartBeat)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return l, nil
+}
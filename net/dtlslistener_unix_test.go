@@ -0,0 +1,112 @@
+// +build !windows
+
+package net
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const handoffChildEnv = "GO_COAP_DTLS_HANDOFF_CHILD"
+
+// serveDTLSEchoWithPrefix answers every read by prefix followed by the data.
+func serveDTLSEchoWithPrefix(l *DTLSListener, prefix string) {
+	for {
+		c, err := l.AcceptWithContext(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			b := make([]byte, 64)
+			for {
+				n, err := c.Read(b)
+				if err != nil {
+					return
+				}
+				c.Write(append([]byte(prefix), b[:n]...))
+			}
+		}()
+	}
+}
+
+func dtlsEcho(t *testing.T, addr net.Addr, data string) string {
+	c, err := dtls.Dial("udp", addr.(*net.UDPAddr), testPSKConfig())
+	require.NoError(t, err)
+	conn := NewConnDTLS(c)
+	defer conn.Close()
+	_, err = conn.Write([]byte(data))
+	require.NoError(t, err)
+	err = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	require.NoError(t, err)
+	b := make([]byte, 64)
+	n, err := conn.Read(b)
+	require.NoError(t, err)
+	return string(b[:n])
+}
+
+// TestDTLSListenerHandoffChild is the new process of TestDTLSListenerHandoff.
+func TestDTLSListenerHandoffChild(t *testing.T) {
+	if os.Getenv(handoffChildEnv) == "" {
+		t.Skip("run by TestDTLSListenerHandoff")
+	}
+	f := os.NewFile(3, "inherited")
+	l, err := NewDTLSListenerFromFile(f, testPSKConfig(), time.Millisecond*100)
+	require.NoError(t, err)
+	f.Close()
+	defer l.Close()
+	fmt.Println("ready")
+	go serveDTLSEchoWithPrefix(l, "child:")
+	time.Sleep(time.Second * 10)
+}
+
+func TestDTLSListenerHandoff(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	parent, err := NewDTLSListenerFromConn(conn, testPSKConfig(), time.Millisecond*100)
+	require.NoError(t, err)
+	go serveDTLSEchoWithPrefix(parent, "parent:")
+	addr := parent.Addr()
+	assert.Equal(t, "parent:a", dtlsEcho(t, addr, "a"))
+
+	f, err := parent.File()
+	require.NoError(t, err)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDTLSListenerHandoffChild$")
+	cmd.Env = append(os.Environ(), handoffChildEnv+"=1")
+	cmd.ExtraFiles = []*os.File{f}
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	f.Close()
+
+	lines := bufio.NewScanner(stdout)
+	for lines.Scan() && lines.Text() != "ready" {
+	}
+	require.Equal(t, "ready", lines.Text())
+
+	// shut down the parent, the child keeps serving the socket
+	require.NoError(t, parent.Close())
+	assert.Equal(t, "child:b", dtlsEcho(t, addr, "b"))
+}
+
+func TestDTLSListenerFileNotSupported(t *testing.T) {
+	l, err := NewDTLSListener("udp", "127.0.0.1:0", testPSKConfig(), time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	_, err = l.File()
+	assert.Error(t, err)
+}
@@ -0,0 +1,17 @@
+package net
+
+import (
+	"net"
+
+	"github.com/pion/dtls"
+)
+
+// DTLSVersion returns version of DTLS negotiated by conn, false when conn isn't DTLS connection.
+// pion/dtls implements DTLS 1.2 only, so it's the version of every DTLS connection.
+func DTLSVersion(conn net.Conn) (string, bool) {
+	switch conn.(type) {
+	case *ConnDTLS, *dtls.Conn:
+		return "DTLS 1.2", true
+	}
+	return "", false
+}
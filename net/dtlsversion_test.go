@@ -0,0 +1,50 @@
+package net
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDTLSVersion(t *testing.T) {
+	l, err := NewPSKDTLSListener("127.0.0.1:0", StaticPSKResolver{"device1": []byte{1}}, time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	c, err := dialPSK(l.Addr(), "device1", []byte{1})
+	require.NoError(t, err)
+	defer c.Close()
+	v, ok := DTLSVersion(c)
+	assert.True(t, ok)
+	assert.Equal(t, "DTLS 1.2", v)
+
+	conn := NewConnDTLS(c)
+	v, ok = DTLSVersion(conn)
+	assert.True(t, ok)
+	assert.Equal(t, "DTLS 1.2", v)
+
+	select {
+	case s := <-accepted:
+		defer s.Close()
+		_, ok = DTLSVersion(s)
+		assert.True(t, ok)
+	case <-time.After(time.Second * 3):
+		require.FailNow(t, "connection not accepted")
+	}
+
+	p1, p2 := net.Pipe()
+	defer p1.Close()
+	defer p2.Close()
+	_, ok = DTLSVersion(p1)
+	assert.False(t, ok)
+}
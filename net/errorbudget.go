@@ -0,0 +1,128 @@
+package net
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrorBudget tracks errors of connection, eg. send errors and retransmissions, in sliding window.
+// When more than MaxErrors errors occur within Window, the budget is exhausted: OnBudgetExhausted
+// is called and the connection is closed when CloseOnExhausted is set. The budget is exhausted
+// again after errors slide out of window or after Reset.
+//
+// Multiple goroutines may invoke methods on a ErrorBudget simultaneously.
+type ErrorBudget struct {
+	MaxErrors         int
+	Window            time.Duration
+	OnBudgetExhausted func(conn net.Conn)
+	CloseOnExhausted  bool
+
+	lock      sync.Mutex
+	errors    []time.Time
+	exhausted bool
+}
+
+// NewErrorBudget creates budget of maxErrors errors per window.
+func NewErrorBudget(maxErrors int, window time.Duration) *ErrorBudget {
+	return &ErrorBudget{MaxErrors: maxErrors, Window: window}
+}
+
+// slide removes errors out of window, b.lock must be held.
+func (b *ErrorBudget) slide(now time.Time) {
+	i := 0
+	for i < len(b.errors) && now.Sub(b.errors[i]) >= b.Window {
+		i++
+	}
+	b.errors = b.errors[i:]
+	if len(b.errors) <= b.MaxErrors {
+		b.exhausted = false
+	}
+}
+
+// RecordError records error of conn.
+func (b *ErrorBudget) RecordError(conn net.Conn) {
+	now := time.Now()
+	b.lock.Lock()
+	b.slide(now)
+	b.errors = append(b.errors, now)
+	exhausted := len(b.errors) > b.MaxErrors && !b.exhausted
+	if exhausted {
+		b.exhausted = true
+	}
+	onExhausted := b.OnBudgetExhausted
+	b.lock.Unlock()
+	if !exhausted {
+		return
+	}
+	if onExhausted != nil {
+		onExhausted(conn)
+	}
+	if b.CloseOnExhausted {
+		conn.Close()
+	}
+}
+
+// Errors returns count of errors within window.
+func (b *ErrorBudget) Errors() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.slide(time.Now())
+	return len(b.errors)
+}
+
+// Exhausted reports whether errors within window exceed MaxErrors.
+func (b *ErrorBudget) Exhausted() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.slide(time.Now())
+	return b.exhausted
+}
+
+// Reset clears recorded errors, eg. on successful reconnect.
+func (b *ErrorBudget) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.errors = nil
+	b.exhausted = false
+}
+
+// ErrorBudgetConn wraps net.Conn and records its read and write errors, except timeouts, to budget.
+type ErrorBudgetConn struct {
+	net.Conn
+	budget *ErrorBudget
+}
+
+// NewErrorBudgetConn creates connection over c which spends budget.
+func NewErrorBudgetConn(c net.Conn, budget *ErrorBudget) *ErrorBudgetConn {
+	return &ErrorBudgetConn{Conn: c, budget: budget}
+}
+
+// Budget returns error budget of connection, eg. to record retransmissions.
+func (c *ErrorBudgetConn) Budget() *ErrorBudget {
+	return c.budget
+}
+
+func (c *ErrorBudgetConn) record(err error) {
+	if err == nil {
+		return
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return
+	}
+	c.budget.RecordError(c)
+}
+
+// Read reads data from connection.
+func (c *ErrorBudgetConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.record(err)
+	return n, err
+}
+
+// Write writes data to connection.
+func (c *ErrorBudgetConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.record(err)
+	return n, err
+}
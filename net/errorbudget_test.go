@@ -0,0 +1,100 @@
+package net
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialErrorBudgetConn(t *testing.T, addr string, budget *ErrorBudget) *ErrorBudgetConn {
+	d := NewChaosDialer(&net.Dialer{}, ChaosConfig{ErrorProbability: 1, Rand: rand.New(rand.NewSource(1))})
+	c, err := d.DialContext(context.Background(), "udp", addr)
+	require.NoError(t, err)
+	return NewErrorBudgetConn(c, budget)
+}
+
+func TestErrorBudgetExhausted(t *testing.T) {
+	l, fin := runUDPEchoServer(t)
+	defer fin()
+
+	exhausted := make(chan net.Conn, 2)
+	budget := NewErrorBudget(5, time.Second)
+	budget.OnBudgetExhausted = func(conn net.Conn) { exhausted <- conn }
+	budget.CloseOnExhausted = true
+	c := dialErrorBudgetConn(t, l.LocalAddr().String(), budget)
+	defer c.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err := c.Write([]byte{byte(i)})
+		require.Error(t, err)
+	}
+	assert.Equal(t, 5, budget.Errors())
+	assert.False(t, budget.Exhausted())
+	select {
+	case <-exhausted:
+		require.FailNow(t, "budget exhausted by 5 errors")
+	default:
+	}
+
+	for i := 5; i < 10; i++ {
+		c.Write([]byte{byte(i)})
+	}
+	assert.True(t, budget.Exhausted())
+	select {
+	case conn := <-exhausted:
+		assert.Equal(t, c, conn)
+	default:
+		require.FailNow(t, "budget not exhausted by 10 errors")
+	}
+	// callback fires once per exhaustion
+	assert.Len(t, exhausted, 0)
+
+	budget.Reset()
+	assert.Equal(t, 0, budget.Errors())
+	assert.False(t, budget.Exhausted())
+}
+
+func TestErrorBudgetWindowSlides(t *testing.T) {
+	l, fin := runUDPEchoServer(t)
+	defer fin()
+
+	calls := 0
+	budget := NewErrorBudget(5, time.Millisecond*200)
+	budget.OnBudgetExhausted = func(conn net.Conn) { calls++ }
+	c := dialErrorBudgetConn(t, l.LocalAddr().String(), budget)
+	defer c.Close()
+
+	for i := 0; i < 5; i++ {
+		c.Write([]byte{byte(i)})
+	}
+	time.Sleep(time.Millisecond * 250)
+	assert.Equal(t, 0, budget.Errors())
+	for i := 0; i < 5; i++ {
+		c.Write([]byte{byte(i)})
+	}
+	assert.Equal(t, 0, calls)
+
+	// the 6th error within window exhausts the budget, eg. retransmission recorded by application
+	c.Budget().RecordError(c)
+	assert.Equal(t, 1, calls)
+}
+
+func TestErrorBudgetConnIgnoresTimeouts(t *testing.T) {
+	l, fin := runUDPEchoServer(t)
+	defer fin()
+
+	budget := NewErrorBudget(0, time.Second)
+	c, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	bc := NewErrorBudgetConn(c, budget)
+	defer bc.Close()
+	bc.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
+	_, err = bc.Read(make([]byte, 10))
+	require.Error(t, err)
+	assert.Equal(t, 0, budget.Errors())
+}
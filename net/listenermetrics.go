@@ -0,0 +1,71 @@
+package net
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// acceptLatencyWindow is count of the latest accepts used for latency percentiles.
+const acceptLatencyWindow = 1024
+
+// acceptStats collects latencies between queueing and taking of accepted connections.
+type acceptStats struct {
+	errors int64
+
+	lock      sync.Mutex
+	latencies [acceptLatencyWindow]time.Duration
+	count     int
+}
+
+func (s *acceptStats) accepted(d connData) {
+	if d.err != nil || d.queued.IsZero() {
+		return
+	}
+	latency := time.Since(d.queued)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.latencies[s.count%acceptLatencyWindow] = latency
+	s.count++
+}
+
+func (s *acceptStats) percentile(p float64) time.Duration {
+	s.lock.Lock()
+	n := s.count
+	if n > acceptLatencyWindow {
+		n = acceptLatencyWindow
+	}
+	latencies := append([]time.Duration(nil), s.latencies[:n]...)
+	s.lock.Unlock()
+	if n == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	i := int(p*float64(n)+0.999999) - 1
+	if i < 0 {
+		i = 0
+	}
+	return latencies[i]
+}
+
+// ListenerMetrics reports state of accepting of DTLSListener.
+type ListenerMetrics struct {
+	l *DTLSListener
+}
+
+// QueueDepth returns count of accepted connections waiting for Accept.
+func (m *ListenerMetrics) QueueDepth() int {
+	return len(m.l.connCh)
+}
+
+// AcceptLatencyP99 returns 99th percentile of time between queueing of accepted connection and its
+// taking by Accept or AcceptWithContext, over the latest 1024 connections.
+func (m *ListenerMetrics) AcceptLatencyP99() time.Duration {
+	return m.l.stats.percentile(0.99)
+}
+
+// TotalAcceptErrors returns count of failed accepts, eg. failed handshakes.
+func (m *ListenerMetrics) TotalAcceptErrors() int64 {
+	return atomic.LoadInt64(&m.l.stats.errors)
+}
@@ -0,0 +1,58 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerMetrics(t *testing.T) {
+	l := &DTLSListener{doneCh: make(chan struct{}), connCh: make(chan connData, 3)}
+	m := l.Metrics()
+	newConn := func() *ConnDTLS {
+		c, peer := net.Pipe()
+		peer.Close()
+		return NewConnDTLS(c)
+	}
+
+	for i := 0; i < 100; i++ {
+		l.connCh <- connData{conn: newConn(), queued: time.Now()}
+		assert.Equal(t, 1, m.QueueDepth())
+		time.Sleep(time.Millisecond * 10)
+		c, err := l.Accept()
+		require.NoError(t, err)
+		c.Close()
+	}
+	p99 := m.AcceptLatencyP99()
+	assert.True(t, p99 >= time.Millisecond*10 && p99 < time.Millisecond*20, "p99 %v", p99)
+	assert.Equal(t, 0, m.QueueDepth())
+
+	var calls int32
+	var handshakeErrors int32
+	l.SetHandshakeErrorFunc(func(err error) {
+		assert.EqualError(t, err, "handshake failed")
+		atomic.AddInt32(&handshakeErrors, 1)
+	})
+	l.wg.Add(1)
+	go l.acceptLoop(func() (net.Conn, error) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			return nil, errors.New("handshake failed")
+		}
+		return newConn(), nil
+	})
+	c, err := l.Accept()
+	require.NoError(t, err)
+	c.Close()
+	assert.Equal(t, int64(2), m.TotalAcceptErrors())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&handshakeErrors))
+	close(l.doneCh)
+	l.wg.Wait()
+	for len(l.connCh) > 0 {
+		(<-l.connCh).conn.Close()
+	}
+}
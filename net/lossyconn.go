@@ -0,0 +1,43 @@
+package net
+
+import (
+	"math/rand"
+	"net"
+)
+
+// LossyDTLSConn wraps datagram connection, eg. UDP socket of DTLS, and randomly drops read and
+// written packets. It's ChaosConn which injects only losses.
+//
+// Multiple goroutines may invoke methods on a LossyDTLSConn simultaneously.
+type LossyDTLSConn struct {
+	*ChaosConn
+}
+
+// LossyConnOption configures connection created by NewLossyDTLSConn.
+type LossyConnOption func(cfg *ChaosConfig)
+
+// WithLossSource makes drops deterministic by source src, connection uses time seeded source by default.
+func WithLossSource(src rand.Source) LossyConnOption {
+	return func(cfg *ChaosConfig) {
+		cfg.Rand = rand.New(src)
+	}
+}
+
+// NewLossyDTLSConn creates connection over inner which drops read packets with probability readLoss
+// and written packets with probability writeLoss. The connection is *LossyDTLSConn, which records
+// counts of dropped packets.
+func NewLossyDTLSConn(inner net.Conn, readLoss, writeLoss float64, opts ...LossyConnOption) net.Conn {
+	cfg := ChaosConfig{
+		DropProbability:     writeLoss,
+		ReadDropProbability: readLoss,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return &LossyDTLSConn{NewChaosConn(inner, cfg)}
+}
+
+// DroppedWrites returns count of dropped written packets.
+func (c *LossyDTLSConn) DroppedWrites() int {
+	return c.Dropped()
+}
@@ -0,0 +1,29 @@
+package net
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLossyDTLSConnDropsReads(t *testing.T) {
+	l, fin := runUDPEchoServer(t)
+	defer fin()
+
+	inner, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	c := NewLossyDTLSConn(inner, 1, 0, WithLossSource(rand.NewSource(1))).(*LossyDTLSConn)
+	defer c.Close()
+
+	_, err = c.Write([]byte("lost"))
+	require.NoError(t, err)
+	c.SetReadDeadline(time.Now().Add(time.Millisecond * 100))
+	_, err = c.Read(make([]byte, 64))
+	assert.Error(t, err)
+	assert.Equal(t, 1, c.DroppedReads())
+	assert.Equal(t, 0, c.DroppedWrites())
+}
@@ -0,0 +1,95 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls"
+)
+
+// ErrUnknownPSKIdentity is returned by StaticPSKResolver for identity without key.
+var ErrUnknownPSKIdentity = errors.New("unknown PSK identity")
+
+// pskConnectTimeout limits handshake of PSK listener, failed handshake blocks accepting of other clients until it expires.
+var pskConnectTimeout = time.Second * 5
+
+// PSKResolver looks up pre-shared key of DTLS client by its identity.
+type PSKResolver interface {
+	GetKey(identity []byte) ([]byte, error)
+}
+
+// StaticPSKResolver resolves keys from map of identity to key.
+type StaticPSKResolver map[string][]byte
+
+// GetKey returns key of identity or ErrUnknownPSKIdentity.
+func (r StaticPSKResolver) GetKey(identity []byte) ([]byte, error) {
+	key, ok := r[string(identity)]
+	if !ok {
+		return nil, ErrUnknownPSKIdentity
+	}
+	return key, nil
+}
+
+type cachedPSK struct {
+	key     []byte
+	expires time.Time
+}
+
+// CachingPSKResolver caches keys resolved by underlying resolver for TTL, errors are not cached.
+type CachingPSKResolver struct {
+	underlying PSKResolver
+	ttl        time.Duration
+
+	lock sync.Mutex
+	keys map[string]cachedPSK
+}
+
+// NewCachingPSKResolver creates resolver which caches keys of underlying for ttl.
+func NewCachingPSKResolver(underlying PSKResolver, ttl time.Duration) *CachingPSKResolver {
+	return &CachingPSKResolver{
+		underlying: underlying,
+		ttl:        ttl,
+		keys:       make(map[string]cachedPSK),
+	}
+}
+
+// GetKey returns cached key of identity or resolves it by underlying resolver.
+func (r *CachingPSKResolver) GetKey(identity []byte) ([]byte, error) {
+	now := time.Now()
+	r.lock.Lock()
+	if k, ok := r.keys[string(identity)]; ok {
+		if now.Before(k.expires) {
+			r.lock.Unlock()
+			return k.key, nil
+		}
+		delete(r.keys, string(identity))
+	}
+	r.lock.Unlock()
+
+	key, err := r.underlying.GetKey(identity)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	r.keys[string(identity)] = cachedPSK{key: key, expires: now.Add(r.ttl)}
+	r.lock.Unlock()
+	return key, nil
+}
+
+// NewPSKDTLSListener creates dtls listener on udp addr which authenticates clients by keys of resolver.
+// Handshake of client whose key is not resolved fails.
+func NewPSKDTLSListener(addr string, resolver PSKResolver, heartBeat time.Duration) (*DTLSListener, error) {
+	if resolver == nil {
+		return nil, fmt.Errorf("cannot create new dtls listener: no PSK resolver provided")
+	}
+	connectTimeout := pskConnectTimeout
+	cfg := &dtls.Config{
+		PSK:             resolver.GetKey,
+		PSKIdentityHint: []byte("go-coap"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		ConnectTimeout:  &connectTimeout,
+	}
+	return NewDTLSListener("udp", addr, cfg, heartBeat)
+}
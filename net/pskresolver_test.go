@@ -0,0 +1,107 @@
+package net
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingPSKResolver struct {
+	PSKResolver
+	calls int32
+}
+
+func (r *countingPSKResolver) GetKey(identity []byte) ([]byte, error) {
+	atomic.AddInt32(&r.calls, 1)
+	return r.PSKResolver.GetKey(identity)
+}
+
+func dialPSK(addr net.Addr, identity string, key []byte) (*dtls.Conn, error) {
+	connectTimeout := time.Second * 3
+	return dtls.Dial("udp", addr.(*net.UDPAddr), &dtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return key, nil
+		},
+		PSKIdentityHint: []byte(identity),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		ConnectTimeout:  &connectTimeout,
+	})
+}
+
+func TestPSKDTLSListener(t *testing.T) {
+	pskConnectTimeout = time.Millisecond * 500
+	defer func() { pskConnectTimeout = time.Second * 5 }()
+	resolver := StaticPSKResolver{"device1": []byte{1, 2, 3}}
+	l, err := NewPSKDTLSListener("127.0.0.1:0", resolver, time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.AcceptWithContext(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				b := make([]byte, 64)
+				for {
+					n, err := c.Read(b)
+					if err != nil {
+						return
+					}
+					c.Write(b[:n])
+				}
+			}()
+		}
+	}()
+
+	ping := func() {
+		c, err := dialPSK(l.Addr(), "device1", []byte{1, 2, 3})
+		require.NoError(t, err)
+		conn := NewConnDTLS(c)
+		defer conn.Close()
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second*5)))
+		b := make([]byte, 64)
+		n, err := conn.Read(b)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(b[:n]))
+	}
+	ping()
+
+	_, err = dialPSK(l.Addr(), "unknown", []byte{1, 2, 3})
+	assert.Error(t, err)
+	// failed handshake doesn't stop the listener
+	ping()
+}
+
+func TestCachingPSKResolver(t *testing.T) {
+	underlying := &countingPSKResolver{PSKResolver: StaticPSKResolver{"device1": []byte{1}}}
+	r := NewCachingPSKResolver(underlying, time.Millisecond*200)
+
+	for i := 0; i < 3; i++ {
+		key, err := r.GetKey([]byte("device1"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1}, key)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&underlying.calls))
+
+	time.Sleep(time.Millisecond * 300)
+	_, err := r.GetKey([]byte("device1"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&underlying.calls))
+
+	// errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err = r.GetKey([]byte("unknown"))
+		assert.Equal(t, ErrUnknownPSKIdentity, err)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&underlying.calls))
+}
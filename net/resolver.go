@@ -0,0 +1,103 @@
+package net
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver resolves UDP addresses, it is implemented by CachingResolver.
+type Resolver interface {
+	ResolveUDPAddr(network, addr string) (*net.UDPAddr, error)
+}
+
+type resolverEntry struct {
+	addr  *net.UDPAddr
+	used  bool // resolved since last refresh
+	timer *time.Timer
+}
+
+type resolverKey struct {
+	network string
+	addr    string
+}
+
+// CachingResolver caches resolved UDP addresses for TTL. When TTL expires and the address was
+// used meanwhile, it's refreshed in the background and cached address is returned until then.
+type CachingResolver struct {
+	ttl time.Duration
+
+	// Lookup resolves address which is not cached, defaults to net.ResolveUDPAddr.
+	Lookup func(network, addr string) (*net.UDPAddr, error)
+
+	lock    sync.Mutex
+	entries map[resolverKey]*resolverEntry
+}
+
+// NewCachingResolver creates resolver which caches addresses for ttl.
+func NewCachingResolver(ttl time.Duration) *CachingResolver {
+	return &CachingResolver{
+		ttl:     ttl,
+		Lookup:  net.ResolveUDPAddr,
+		entries: make(map[resolverKey]*resolverEntry),
+	}
+}
+
+// ResolveUDPAddr returns cached address or resolves it.
+func (r *CachingResolver) ResolveUDPAddr(network, addr string) (*net.UDPAddr, error) {
+	key := resolverKey{network: network, addr: addr}
+	r.lock.Lock()
+	if e, ok := r.entries[key]; ok {
+		e.used = true
+		r.lock.Unlock()
+		return e.addr, nil
+	}
+	r.lock.Unlock()
+
+	a, err := r.Lookup(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if e, ok := r.entries[key]; ok {
+		// resolved concurrently
+		return e.addr, nil
+	}
+	r.store(key, a)
+	return a, nil
+}
+
+// store caches a and schedules its refresh, the caller must hold the lock.
+func (r *CachingResolver) store(key resolverKey, a *net.UDPAddr) {
+	e := &resolverEntry{addr: a}
+	e.timer = time.AfterFunc(r.ttl, func() {
+		r.expire(key, e)
+	})
+	r.entries[key] = e
+}
+
+func (r *CachingResolver) expire(key resolverKey, e *resolverEntry) {
+	r.lock.Lock()
+	used := e.used
+	if !used && r.entries[key] == e {
+		delete(r.entries, key)
+	}
+	r.lock.Unlock()
+	if !used {
+		return
+	}
+
+	a, err := r.Lookup(key.network, key.addr)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.entries[key] != e {
+		return
+	}
+	if err != nil {
+		// next resolution reports the error
+		delete(r.entries, key)
+		return
+	}
+	r.store(key, a)
+}
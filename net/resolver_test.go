@@ -0,0 +1,67 @@
+package net
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockDNS returns address 127.0.0.N for N-th lookup.
+type mockDNS struct {
+	lock    sync.Mutex
+	lookups int
+}
+
+func (d *mockDNS) lookup(network, addr string) (*net.UDPAddr, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.lookups++
+	return net.ResolveUDPAddr(network, fmt.Sprintf("127.0.0.%v:5683", d.lookups))
+}
+
+func (d *mockDNS) count() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.lookups
+}
+
+func TestCachingResolver(t *testing.T) {
+	dns := &mockDNS{}
+	r := NewCachingResolver(time.Millisecond * 100)
+	r.Lookup = dns.lookup
+
+	for i := 0; i < 3; i++ {
+		a, err := r.ResolveUDPAddr("udp", "device.example:5683")
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:5683", a.String())
+	}
+	assert.Equal(t, 1, dns.count())
+
+	// used address is refreshed in the background
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, 2, dns.count())
+	a, err := r.ResolveUDPAddr("udp", "device.example:5683")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.2:5683", a.String())
+
+	// unused address is evicted after next TTL
+	time.Sleep(time.Millisecond * 250)
+	assert.Equal(t, 3, dns.count())
+	a, err = r.ResolveUDPAddr("udp", "device.example:5683")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.4:5683", a.String())
+}
+
+func TestCachingResolverError(t *testing.T) {
+	r := NewCachingResolver(time.Minute)
+	r.Lookup = func(network, addr string) (*net.UDPAddr, error) {
+		return nil, fmt.Errorf("no such host")
+	}
+	_, err := r.ResolveUDPAddr("udp", "device.example:5683")
+	assert.Error(t, err)
+}
@@ -0,0 +1,280 @@
+package net
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SMSSegmentSize is size of text of one SMS.
+const SMSSegmentSize = 140
+
+// smsFragmentSize is size of fragment including its header, base64 encoding of 105 bytes
+// is 140 characters, so every fragment fits one SMS.
+const smsFragmentSize = SMSSegmentSize / 4 * 3
+
+// smsHeaderSize is size of fragment header: fragment number and count of fragments.
+const smsHeaderSize = 2
+
+// smsReceiveMaxBackoff bounds delay between failing receives of SMS.
+const smsReceiveMaxBackoff = time.Second * 5
+
+// Transport dials datagram connections over network which isn't IP one, eg. SMS.
+type Transport interface {
+	// Dial creates connection to addr of the network.
+	Dial(addr string) (net.Conn, error)
+	// Close stops the transport.
+	Close() error
+}
+
+// SMSSender sends SMS via gateway API.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to string, text string) error
+}
+
+// SMSReceiver receives SMS from gateway API.
+type SMSReceiver interface {
+	ReceiveSMS(ctx context.Context) (from string, text string, err error)
+}
+
+// SMSAddr is address of SMS peer - phone number.
+type SMSAddr string
+
+// Network returns name of the network.
+func (a SMSAddr) Network() string { return "sms" }
+
+func (a SMSAddr) String() string { return string(a) }
+
+// SMSTransport carries datagrams over SMS. Datagram is split to fragments with two-byte header
+// (fragment number, count of fragments) and every fragment is base64 encoded to text of at most
+// SMSSegmentSize characters for the gateway API.
+type SMSTransport struct {
+	sender   SMSSender
+	receiver SMSReceiver
+
+	lock   sync.Mutex
+	conns  map[string]*SMSConn
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSMSTransport creates SMS transport and starts receiving of SMS.
+func NewSMSTransport(sender SMSSender, receiver SMSReceiver) Transport {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &SMSTransport{
+		sender:   sender,
+		receiver: receiver,
+		conns:    make(map[string]*SMSConn),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go t.receiveLoop(ctx)
+	return t
+}
+
+func (t *SMSTransport) receiveLoop(ctx context.Context) {
+	defer close(t.done)
+	var backoff time.Duration
+	for {
+		from, text, err := t.receiver.ReceiveSMS(ctx)
+		if err != nil {
+			// gateway may be unavailable for a while, retry with doubled delay
+			backoff = 2 * backoff
+			if backoff == 0 {
+				backoff = time.Millisecond * 10
+			}
+			if backoff > smsReceiveMaxBackoff {
+				backoff = smsReceiveMaxBackoff
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+		segment, err := base64.StdEncoding.DecodeString(text)
+		if err != nil || len(segment) < smsHeaderSize {
+			continue
+		}
+		t.lock.Lock()
+		c := t.conns[from]
+		t.lock.Unlock()
+		if c != nil {
+			c.addFragment(segment)
+		}
+	}
+}
+
+// Dial creates connection to the phone number.
+func (t *SMSTransport) Dial(number string) (net.Conn, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.conns[number]; ok {
+		return nil, fmt.Errorf("cannot dial %v: connection already exists", number)
+	}
+	c := &SMSConn{
+		transport: t,
+		raddr:     SMSAddr(number),
+		readCh:    make(chan []byte, 16),
+		doneCh:    make(chan struct{}),
+	}
+	t.conns[number] = c
+	return c, nil
+}
+
+// Close stops receiving of SMS.
+func (t *SMSTransport) Close() error {
+	t.cancel()
+	<-t.done
+	return nil
+}
+
+func (t *SMSTransport) remove(c *SMSConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.conns[string(c.raddr)] == c {
+		delete(t.conns, string(c.raddr))
+	}
+}
+
+// SMSConn is datagram connection to SMS peer.
+type SMSConn struct {
+	transport *SMSTransport
+	raddr     SMSAddr
+	readCh    chan []byte
+	doneCh    chan struct{}
+	closeOnce sync.Once
+
+	lock      sync.Mutex
+	fragments [][]byte
+	received  int
+
+	readDeadline  atomic.Value
+	writeDeadline atomic.Value
+}
+
+func (c *SMSConn) addFragment(segment []byte) {
+	num, total := int(segment[0]), int(segment[1])
+	if total == 0 || num >= total {
+		return
+	}
+	c.lock.Lock()
+	if len(c.fragments) != total || (num == 0 && c.fragments[0] != nil) {
+		// new datagram
+		c.fragments = make([][]byte, total)
+		c.received = 0
+	}
+	if c.fragments[num] == nil {
+		c.fragments[num] = append([]byte(nil), segment[smsHeaderSize:]...)
+		c.received++
+	}
+	var datagram []byte
+	if c.received == total {
+		for _, f := range c.fragments {
+			datagram = append(datagram, f...)
+		}
+		c.fragments = nil
+		c.received = 0
+	}
+	c.lock.Unlock()
+
+	if datagram != nil {
+		select {
+		case c.readCh <- datagram:
+		default:
+			// reader is too slow, datagram is dropped as by UDP
+		}
+	}
+}
+
+func deadlineCh(v *atomic.Value) (<-chan time.Time, func()) {
+	d, _ := v.Load().(time.Time)
+	if d.IsZero() {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(time.Until(d))
+	return timer.C, func() { timer.Stop() }
+}
+
+// Read reads one datagram.
+func (c *SMSConn) Read(b []byte) (int, error) {
+	timeout, stop := deadlineCh(&c.readDeadline)
+	defer stop()
+	select {
+	case d := <-c.readCh:
+		return copy(b, d), nil
+	case <-timeout:
+		return 0, fmt.Errorf(ioTimeout)
+	case <-c.doneCh:
+		return 0, fmt.Errorf("cannot read from sms connection: connection closed")
+	}
+}
+
+// Write sends datagram as fragments.
+func (c *SMSConn) Write(b []byte) (int, error) {
+	dataSize := smsFragmentSize - smsHeaderSize
+	total := (len(b) + dataSize - 1) / dataSize
+	if total == 0 {
+		total = 1
+	}
+	if total > 255 {
+		return 0, fmt.Errorf("cannot write to sms connection: datagram is too large")
+	}
+	ctx := context.Background()
+	if d, _ := c.writeDeadline.Load().(time.Time); !d.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, d)
+		defer cancel()
+	}
+	for i := 0; i < total; i++ {
+		end := (i + 1) * dataSize
+		if end > len(b) {
+			end = len(b)
+		}
+		segment := append([]byte{byte(i), byte(total)}, b[i*dataSize:end]...)
+		if err := c.transport.sender.SendSMS(ctx, string(c.raddr), base64.StdEncoding.EncodeToString(segment)); err != nil {
+			return 0, fmt.Errorf("cannot write to sms connection: %v", err)
+		}
+	}
+	return len(b), nil
+}
+
+// Close closes the connection.
+func (c *SMSConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.doneCh)
+		c.transport.remove(c)
+	})
+	return nil
+}
+
+// LocalAddr returns the local network address.
+func (c *SMSConn) LocalAddr() net.Addr { return SMSAddr("") }
+
+// RemoteAddr returns the remote network address.
+func (c *SMSConn) RemoteAddr() net.Addr { return c.raddr }
+
+// SetDeadline sets read and write deadlines.
+func (c *SMSConn) SetDeadline(t time.Time) error {
+	c.readDeadline.Store(t)
+	c.writeDeadline.Store(t)
+	return nil
+}
+
+// SetReadDeadline sets read deadline.
+func (c *SMSConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Store(t)
+	return nil
+}
+
+// SetWriteDeadline sets write deadline.
+func (c *SMSConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Store(t)
+	return nil
+}
@@ -0,0 +1,113 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type smsMessage struct {
+	from, text string
+}
+
+// mockSMSGateway delivers SMS between registered phone numbers.
+type mockSMSGateway struct {
+	lock  sync.Mutex
+	boxes map[string]chan smsMessage
+	sent  []smsMessage
+}
+
+type mockSMSEndpoint struct {
+	gw     *mockSMSGateway
+	number string
+}
+
+func (gw *mockSMSGateway) endpoint(number string) *mockSMSEndpoint {
+	gw.lock.Lock()
+	defer gw.lock.Unlock()
+	gw.boxes[number] = make(chan smsMessage, 64)
+	return &mockSMSEndpoint{gw: gw, number: number}
+}
+
+func (e *mockSMSEndpoint) SendSMS(ctx context.Context, to string, text string) error {
+	e.gw.lock.Lock()
+	defer e.gw.lock.Unlock()
+	e.gw.sent = append(e.gw.sent, smsMessage{from: e.number, text: text})
+	e.gw.boxes[to] <- smsMessage{from: e.number, text: text}
+	return nil
+}
+
+func (e *mockSMSEndpoint) ReceiveSMS(ctx context.Context) (string, string, error) {
+	e.gw.lock.Lock()
+	box := e.gw.boxes[e.number]
+	e.gw.lock.Unlock()
+	select {
+	case m := <-box:
+		return m.from, m.text, nil
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+}
+
+func TestSMSTransportFragmentation(t *testing.T) {
+	gw := &mockSMSGateway{boxes: make(map[string]chan smsMessage)}
+	device := gw.endpoint("+420111")
+	server := gw.endpoint("+420222")
+	deviceTransport := NewSMSTransport(device, device)
+	defer deviceTransport.Close()
+	serverTransport := NewSMSTransport(server, server)
+	defer serverTransport.Close()
+
+	deviceConn, err := deviceTransport.Dial("+420222")
+	require.NoError(t, err)
+	defer deviceConn.Close()
+	serverConn, err := serverTransport.Dial("+420111")
+	require.NoError(t, err)
+	defer serverConn.Close()
+
+	// CON POST with payload, 500 bytes total
+	msg := append([]byte{0x40, 0x02, 0x12, 0x34, 0xff}, bytes.Repeat([]byte{0xab}, 495)...)
+	n, err := deviceConn.Write(msg)
+	require.NoError(t, err)
+	assert.Equal(t, 500, n)
+	// 103 bytes of datagram per SMS
+	require.Len(t, gw.sent, 5)
+	for _, m := range gw.sent {
+		assert.True(t, len(m.text) <= SMSSegmentSize, "text of %v characters doesn't fit SMS", len(m.text))
+	}
+
+	serverConn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1024)
+	n, err = serverConn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, buf[:n])
+	assert.Equal(t, "+420111", serverConn.RemoteAddr().String())
+}
+
+// failingSMSReceiver fails every receive and counts them.
+type failingSMSReceiver struct {
+	calls int32
+}
+
+func (r *failingSMSReceiver) ReceiveSMS(ctx context.Context) (string, string, error) {
+	atomic.AddInt32(&r.calls, 1)
+	return "", "", errors.New("gateway unavailable")
+}
+
+func TestSMSTransportReceiveBackoff(t *testing.T) {
+	gw := &mockSMSGateway{boxes: make(map[string]chan smsMessage)}
+	var r failingSMSReceiver
+	transport := NewSMSTransport(gw.endpoint("+420111"), &r)
+	time.Sleep(time.Millisecond * 200)
+	require.NoError(t, transport.Close())
+	// 10, 20, 40 and 80ms delays fit to 200ms
+	calls := atomic.LoadInt32(&r.calls)
+	assert.True(t, calls >= 2 && calls <= 6, "%v receives", calls)
+}
@@ -0,0 +1,161 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ALPNCoAP is ALPN protocol ID of CoAP over TLS (RFC 8323).
+const ALPNCoAP = "coap"
+
+// alpnHandshakeTimeout bounds handshake of connection routed by negotiated protocol.
+var alpnHandshakeTimeout = time.Second * 10
+
+// connListener is net.Listener of connections passed by TLSListener.
+type connListener struct {
+	addr      net.Addr
+	connCh    chan net.Conn
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.connCh:
+		return c, nil
+	case <-l.doneCh:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.doneCh) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// httpFallback serves connections which negotiated other protocol than CoAP. Handshakes run
+// in goroutine per connection, so client which never finishes its handshake doesn't delay others.
+type httpFallback struct {
+	srv      *http.Server
+	listener *connListener
+
+	startOnce  sync.Once
+	coapCh     chan net.Conn
+	acceptDone chan struct{}
+	acceptErr  error
+}
+
+// SetALPN sets protocols offered by ALPN, eg. ALPNCoAP, "h2" and "http/1.1", in order of preference.
+// Protocols already in config of listener, eg. "acme-tls/1" of ACME listener, are kept after them.
+// It must be called before connections are accepted.
+func (l *TLSListener) SetALPN(protocols []string) {
+	cfg := l.cfg.Clone()
+	cfg.NextProtos = mergeProtocols(protocols, l.cfg.NextProtos)
+	l.listener = tls.NewListener(l.tcp, cfg)
+}
+
+func mergeProtocols(protocols, existing []string) []string {
+	merged := append([]string(nil), protocols...)
+	for _, e := range existing {
+		found := false
+		for _, p := range merged {
+			if p == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
+
+// SetHTTPFallback lets h serve connections which negotiated other protocol than ALPNCoAP by ALPN,
+// connections without negotiated protocol are CoAP ones. It must be called before connections are accepted.
+func (l *TLSListener) SetHTTPFallback(h http.Handler) {
+	cl := &connListener{
+		addr:   l.tcp.Addr(),
+		connCh: make(chan net.Conn),
+		doneCh: make(chan struct{}),
+	}
+	srv := &http.Server{Handler: h}
+	go srv.Serve(cl)
+	l.fallback = &httpFallback{
+		srv:        srv,
+		listener:   cl,
+		coapCh:     make(chan net.Conn),
+		acceptDone: make(chan struct{}),
+	}
+}
+
+// accept waits with context for CoAP connection routed from l, routing starts by the first call.
+func (f *httpFallback) accept(ctx context.Context, l net.Listener) (net.Conn, error) {
+	f.startOnce.Do(func() { go f.serve(l) })
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("cannot accept connections: %v", ctx.Err())
+	case c := <-f.coapCh:
+		return c, nil
+	case <-f.acceptDone:
+		return nil, fmt.Errorf("cannot accept connections: %v", f.acceptErr)
+	}
+}
+
+// serve accepts connections of l until it fails and routes each of them in own goroutine.
+func (f *httpFallback) serve(l net.Listener) {
+	for {
+		rw, err := l.Accept()
+		if err != nil {
+			if isTemporary(err) {
+				continue
+			}
+			f.acceptErr = err
+			close(f.acceptDone)
+			return
+		}
+		go f.route(rw)
+	}
+}
+
+// route hands conn to HTTP server unless it negotiated CoAP, CoAP connections are passed to accept.
+func (f *httpFallback) route(conn net.Conn) {
+	c, ok := conn.(*tls.Conn)
+	if !ok {
+		f.deliver(f.coapCh, conn)
+		return
+	}
+	c.SetDeadline(time.Now().Add(alpnHandshakeTimeout))
+	if err := c.Handshake(); err != nil {
+		c.Close()
+		return
+	}
+	c.SetDeadline(time.Time{})
+	if p := c.ConnectionState().NegotiatedProtocol; p == "" || p == ALPNCoAP {
+		f.deliver(f.coapCh, c)
+		return
+	}
+	f.deliver(f.listener.connCh, c)
+}
+
+func (f *httpFallback) deliver(ch chan net.Conn, c net.Conn) {
+	select {
+	case ch <- c:
+	case <-f.listener.doneCh:
+		c.Close()
+	}
+}
+
+func (f *httpFallback) close() error {
+	f.listener.Close()
+	return f.srv.Close()
+}
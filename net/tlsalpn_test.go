@@ -0,0 +1,121 @@
+package net
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSListenerHTTPFallback(t *testing.T) {
+	cert, err := tls.X509KeyPair(CertPEMBlock, KeyPEMBlock)
+	require.NoError(t, err)
+	l, err := NewTLSListener("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}}, time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	l.SetALPN([]string{ALPNCoAP, "h2", "http/1.1"})
+	l.SetHTTPFallback(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("http " + r.Proto))
+	}))
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			b := make([]byte, 4)
+			if _, err := c.Read(b); err == nil {
+				c.Write(append([]byte("coap "), b...))
+			}
+			c.Close()
+		}
+	}()
+
+	coap, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{ALPNCoAP}})
+	require.NoError(t, err)
+	defer coap.Close()
+	_, err = coap.Write([]byte("ping"))
+	require.NoError(t, err)
+	resp, err := ioutil.ReadAll(coap)
+	require.NoError(t, err)
+	assert.Equal(t, "coap ping", string(resp))
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}},
+		ForceAttemptHTTP2: true,
+	}}
+	defer client.CloseIdleConnections()
+	r, err := client.Get("https://" + l.Addr().String() + "/")
+	require.NoError(t, err)
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "http HTTP/2.0", string(body))
+}
+
+func TestTLSListenerSetALPNKeepsProtocols(t *testing.T) {
+	cert, err := tls.X509KeyPair(CertPEMBlock, KeyPEMBlock)
+	require.NoError(t, err)
+	l, err := NewTLSListener("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"acme-tls/1"}}, time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	l.SetALPN([]string{ALPNCoAP, "acme-tls/1"})
+	l.SetALPN([]string{ALPNCoAP})
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Read(make([]byte, 1))
+			c.Close()
+		}
+	}()
+
+	for _, proto := range []string{ALPNCoAP, "acme-tls/1"} {
+		c, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{proto}})
+		require.NoError(t, err)
+		assert.Equal(t, proto, c.ConnectionState().NegotiatedProtocol)
+		c.Close()
+	}
+}
+
+func TestTLSListenerHTTPFallbackStalledHandshake(t *testing.T) {
+	cert, err := tls.X509KeyPair(CertPEMBlock, KeyPEMBlock)
+	require.NoError(t, err)
+	l, err := NewTLSListener("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}}, time.Millisecond*100)
+	require.NoError(t, err)
+	defer l.Close()
+	l.SetALPN([]string{ALPNCoAP, "http/1.1"})
+	l.SetHTTPFallback(http.NotFoundHandler())
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	// client which never starts its handshake
+	stalled, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer stalled.Close()
+
+	coap, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{ALPNCoAP}})
+	require.NoError(t, err)
+	defer coap.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't accepted while other handshake was stalled")
+	}
+}
@@ -13,6 +13,9 @@ type TLSListener struct {
 	tcp       *net.TCPListener
 	listener  net.Listener
 	heartBeat time.Duration
+	closeFunc func() error
+	cfg       *tls.Config
+	fallback  *httpFallback
 }
 
 // NewTLSListener creates tcp listener.
@@ -27,11 +30,15 @@ func NewTLSListener(network string, addr string, cfg *tls.Config, heartBeat time
 		tcp:       tcp,
 		listener:  tls,
 		heartBeat: heartBeat,
+		cfg:       cfg,
 	}, nil
 }
 
 // AcceptContext waits with context for a generic Conn.
 func (l *TLSListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	if l.fallback != nil {
+		return l.fallback.accept(ctx, l.listener)
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -68,7 +75,18 @@ func (l *TLSListener) Accept() (net.Conn, error) {
 
 // Close closes the connection.
 func (l *TLSListener) Close() error {
-	return l.listener.Close()
+	err := l.listener.Close()
+	if l.fallback != nil {
+		if errClose := l.fallback.close(); err == nil {
+			err = errClose
+		}
+	}
+	if l.closeFunc != nil {
+		if errClose := l.closeFunc(); err == nil {
+			err = errClose
+		}
+	}
+	return err
 }
 
 // Addr represents a network end point address.
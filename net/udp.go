@@ -42,6 +42,11 @@ func NewConnUDPContext(raddr *net.UDPAddr, oob []byte) *ConnUDPContext {
 // RemoteAddr returns the remote network address.
 func (s *ConnUDPContext) RemoteAddr() net.Addr { return s.raddr }
 
+// WithRemoteAddr returns copy of context for remote address raddr, eg. of migrated peer.
+func (s *ConnUDPContext) WithRemoteAddr(raddr *net.UDPAddr) *ConnUDPContext {
+	return &ConnUDPContext{raddr: raddr, context: s.context}
+}
+
 // Key returns the key session for the map using
 func (s *ConnUDPContext) Key() string {
 	key := s.RemoteAddr().String() + "-" + base64.StdEncoding.EncodeToString(s.context)
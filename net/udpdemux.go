@@ -0,0 +1,212 @@
+package net
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/dtls"
+)
+
+const udpDemuxReceiveMTU = 8192
+
+var errClosedUDPDemux = errors.New("udp demux: listener closed")
+
+// udpDemux splits packets received by UDP socket to connections of remote peers,
+// so a socket created outside of dtls package can be served by DTLS.
+type udpDemux struct {
+	conn *net.UDPConn
+
+	lock      sync.Mutex
+	accepting bool
+	peers     map[string]*udpDemuxConn
+	acceptCh  chan *udpDemuxConn
+	doneCh    chan struct{}
+	doneOnce  sync.Once
+}
+
+func newUDPDemux(conn *net.UDPConn) *udpDemux {
+	d := &udpDemux{
+		conn:      conn,
+		accepting: true,
+		peers:     make(map[string]*udpDemuxConn),
+		acceptCh:  make(chan *udpDemuxConn),
+		doneCh:    make(chan struct{}),
+	}
+	go d.readLoop()
+	return d
+}
+
+func (d *udpDemux) readLoop() {
+	buf := make([]byte, udpDemuxReceiveMTU)
+	for {
+		n, raddr, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		c, ok := d.peer(raddr)
+		if !ok {
+			continue
+		}
+		if c.hello == nil {
+			// ClientHello is read after the handshake, which waits for this datagram
+			c.hello = append([]byte(nil), buf[:n]...)
+		}
+		select {
+		case b := <-c.readCh:
+			c.sizeCh <- copy(b, buf[:n])
+		case <-c.doneCh:
+		}
+	}
+}
+
+func (d *udpDemux) peer(raddr *net.UDPAddr) (*udpDemuxConn, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	c, ok := d.peers[raddr.String()]
+	if ok {
+		return c, true
+	}
+	if !d.accepting {
+		return nil, false
+	}
+	c = &udpDemuxConn{
+		demux:  d,
+		raddr:  raddr,
+		readCh: make(chan []byte),
+		sizeCh: make(chan int),
+		doneCh: make(chan struct{}),
+	}
+	select {
+	case d.acceptCh <- c:
+	case <-d.doneCh:
+		return nil, false
+	}
+	d.peers[raddr.String()] = c
+	return c, true
+}
+
+// Accept waits for a connection of new peer.
+func (d *udpDemux) Accept() (net.Conn, error) {
+	select {
+	case c := <-d.acceptCh:
+		return c, nil
+	case <-d.doneCh:
+		return nil, errClosedUDPDemux
+	}
+}
+
+// Close stops accepting of new peers, the socket is closed when all connections are closed
+// or shutdownTimeout elapses.
+func (d *udpDemux) Close(shutdownTimeout time.Duration) error {
+	d.doneOnce.Do(func() {
+		// closed before locking, it releases readLoop waiting for Accept with the lock held
+		close(d.doneCh)
+		d.lock.Lock()
+		d.accepting = false
+		d.lock.Unlock()
+	})
+	deadline := time.Now().Add(shutdownTimeout)
+	for time.Now().Before(deadline) {
+		d.lock.Lock()
+		n := len(d.peers)
+		d.lock.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return d.conn.Close()
+}
+
+// Addr returns address of the socket.
+func (d *udpDemux) Addr() net.Addr {
+	return d.conn.LocalAddr()
+}
+
+// udpDemuxDTLSListener serves connections of udpDemux by DTLS.
+type udpDemuxDTLSListener struct {
+	*udpDemux
+	cfg *dtls.Config
+}
+
+// Accept waits for new peer and performs DTLS handshake with it.
+func (l udpDemuxDTLSListener) Accept() (net.Conn, error) {
+	c, err := l.udpDemux.Accept()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dtls.Server(c, l.cfg)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	dc := NewConnDTLS(conn)
+	dc.fingerprint, _ = parseClientHello(c.(*udpDemuxConn).hello)
+	return dc, nil
+}
+
+// udpDemuxConn is connection of one remote peer of udpDemux.
+type udpDemuxConn struct {
+	demux *udpDemux
+	raddr *net.UDPAddr
+	hello []byte // the first datagram of peer
+
+	readCh   chan []byte
+	sizeCh   chan int
+	doneCh   chan struct{}
+	doneOnce sync.Once
+}
+
+func (c *udpDemuxConn) Read(b []byte) (int, error) {
+	select {
+	case c.readCh <- b:
+		return <-c.sizeCh, nil
+	case <-c.doneCh:
+		return 0, io.EOF
+	}
+}
+
+func (c *udpDemuxConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.doneCh:
+		return 0, io.EOF
+	default:
+	}
+	return c.demux.conn.WriteToUDP(b, c.raddr)
+}
+
+func (c *udpDemuxConn) Close() error {
+	c.doneOnce.Do(func() {
+		close(c.doneCh)
+		c.demux.lock.Lock()
+		delete(c.demux.peers, c.raddr.String())
+		c.demux.lock.Unlock()
+	})
+	return nil
+}
+
+func (c *udpDemuxConn) LocalAddr() net.Addr {
+	return c.demux.conn.LocalAddr()
+}
+
+func (c *udpDemuxConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// SetDeadline is not supported, deadlines are handled by ConnDTLS.
+func (c *udpDemuxConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is not supported, deadlines are handled by ConnDTLS.
+func (c *udpDemuxConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is not supported, deadlines are handled by ConnDTLS.
+func (c *udpDemuxConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
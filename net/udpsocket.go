@@ -0,0 +1,55 @@
+package net
+
+import (
+	"errors"
+	"log"
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+var errUnsupportedSocketOption = errors.New("socket option is not supported")
+
+// UDPSocketConfig tunes UDP socket, zero values keep defaults of the system.
+type UDPSocketConfig struct {
+	RecvBufferSize int   // SO_RCVBUF in bytes
+	SendBufferSize int   // SO_SNDBUF in bytes
+	DontFragment   bool  // sets don't fragment bit, so datagrams over path MTU are dropped instead of fragmented
+	DSCP           uint8 // differentiated services code point of outgoing datagrams, eg. 46 for expedited forwarding
+}
+
+// ConfigureUDPSocket applies cfg to conn. Options not supported by the platform are skipped with warning.
+func ConfigureUDPSocket(conn *net.UDPConn, cfg UDPSocketConfig) error {
+	if cfg.RecvBufferSize > 0 {
+		if err := conn.SetReadBuffer(cfg.RecvBufferSize); err != nil {
+			return err
+		}
+	}
+	if cfg.SendBufferSize > 0 {
+		if err := conn.SetWriteBuffer(cfg.SendBufferSize); err != nil {
+			return err
+		}
+	}
+	ip4 := conn.LocalAddr().(*net.UDPAddr).IP.To4() != nil
+	if cfg.DontFragment {
+		if err := setDontFragment(conn, ip4); err == errUnsupportedSocketOption {
+			log.Printf("coap: don't fragment is not supported by platform")
+		} else if err != nil {
+			return err
+		}
+	}
+	if cfg.DSCP > 0 {
+		// DSCP is the upper 6 bits of TOS or traffic class
+		var err error
+		if ip4 {
+			err = ipv4.NewConn(conn).SetTOS(int(cfg.DSCP) << 2)
+		} else {
+			err = ipv6.NewConn(conn).SetTrafficClass(int(cfg.DSCP) << 2)
+		}
+		if err != nil {
+			log.Printf("coap: cannot set DSCP: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package net
+
+import (
+	"net"
+	"syscall"
+)
+
+// options of netinet/in.h and netinet6/in6.h missing in syscall
+const (
+	ipDontFrag   = 28
+	ipv6DontFrag = 62
+)
+
+func setDontFragment(conn *net.UDPConn, ip4 bool) error {
+	return setSockoptInt(conn, func(fd int) error {
+		if ip4 {
+			return syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, ipDontFrag, 1)
+		}
+		return syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, ipv6DontFrag, 1)
+	})
+}
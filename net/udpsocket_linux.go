@@ -0,0 +1,15 @@
+package net
+
+import (
+	"net"
+	"syscall"
+)
+
+func setDontFragment(conn *net.UDPConn, ip4 bool) error {
+	return setSockoptInt(conn, func(fd int) error {
+		if ip4 {
+			return syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+		}
+		return syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+	})
+}
@@ -0,0 +1,43 @@
+package net
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+)
+
+func getSockoptInt(t *testing.T, conn *net.UDPConn, level, opt int) int {
+	raw, err := conn.SyscallConn()
+	require.NoError(t, err)
+	var v int
+	var serr error
+	require.NoError(t, raw.Control(func(fd uintptr) { v, serr = syscall.GetsockoptInt(int(fd), level, opt) }))
+	require.NoError(t, serr)
+	return v
+}
+
+func TestConfigureUDPSocket(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = ConfigureUDPSocket(conn, UDPSocketConfig{
+		RecvBufferSize: 1048576,
+		SendBufferSize: 262144,
+		DontFragment:   true,
+		DSCP:           46,
+	})
+	require.NoError(t, err)
+	assert.True(t, getSockoptInt(t, conn, syscall.SOL_SOCKET, syscall.SO_SNDBUF) >= 262144)
+	assert.Equal(t, syscall.IP_PMTUDISC_DO, getSockoptInt(t, conn, syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER))
+	tos, err := ipv4.NewConn(conn).TOS()
+	require.NoError(t, err)
+	assert.Equal(t, 46<<2, tos)
+	if rmem := getSockoptInt(t, conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF); rmem < 1048576 {
+		t.Skipf("SO_RCVBUF %v is limited by net.core.rmem_max", rmem)
+	}
+}
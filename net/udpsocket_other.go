@@ -0,0 +1,11 @@
+// +build !linux,!darwin,!windows
+
+package net
+
+import (
+	"net"
+)
+
+func setDontFragment(conn *net.UDPConn, ip4 bool) error {
+	return errUnsupportedSocketOption
+}
@@ -0,0 +1,20 @@
+// +build linux darwin
+
+package net
+
+import (
+	"net"
+)
+
+// setSockoptInt calls set with file descriptor of conn.
+func setSockoptInt(conn *net.UDPConn, set func(fd int) error) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) { serr = set(int(fd)) }); err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,31 @@
+package net
+
+import (
+	"net"
+	"syscall"
+)
+
+// options of ws2ipdef.h missing in syscall
+const (
+	ipDontFragment = 14
+	ipv6DontFrag   = 14
+)
+
+func setDontFragment(conn *net.UDPConn, ip4 bool) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		if ip4 {
+			serr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, ipDontFragment, 1)
+		} else {
+			serr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, ipv6DontFrag, 1)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,308 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// WSPath is path of CoAP over WebSockets endpoint (RFC 8323 section 4.3).
+const WSPath = "/.well-known/coap"
+
+// WSSubprotocol is WebSocket subprotocol of CoAP (RFC 8323 section 4.1).
+const WSSubprotocol = "coap"
+
+var errInvalidWSFrame = errors.New("invalid CoAP over WebSockets frame")
+var errWSSubprotocol = errors.New("server doesn't support coap subprotocol")
+
+// tcpHeaderLen returns length of Len and extended length of TCP framed message starting by b
+// (RFC 8323 section 3.2) and length of the rest of message, false when b is shorter than the header.
+func tcpHeaderLen(b []byte) (header int, rest int, ok bool) {
+	if len(b) < 1 {
+		return 0, 0, false
+	}
+	l := int(b[0] >> 4)
+	tkl := int(b[0] & 0xf)
+	switch l {
+	case 13:
+		if len(b) < 2 {
+			return 0, 0, false
+		}
+		return 2, 1 + tkl + int(b[1]) + 13, true
+	case 14:
+		if len(b) < 3 {
+			return 0, 0, false
+		}
+		return 3, 1 + tkl + (int(b[1])<<8 | int(b[2])) + 269, true
+	case 15:
+		if len(b) < 5 {
+			return 0, 0, false
+		}
+		return 5, 1 + tkl + (int(b[1])<<24 | int(b[2])<<16 | int(b[3])<<8 | int(b[4])) + 65805, true
+	}
+	return 1, 1 + tkl + l, true
+}
+
+// wsFrameToTCP converts message of WebSocket frame, which has no length, to TCP framing.
+func wsFrameToTCP(frame []byte) ([]byte, error) {
+	if len(frame) < 2 {
+		return nil, errInvalidWSFrame
+	}
+	tkl := int(frame[0] & 0xf)
+	if frame[0]>>4 != 0 || len(frame) < 2+tkl {
+		return nil, errInvalidWSFrame
+	}
+	l := len(frame) - 2 - tkl
+	var header []byte
+	switch {
+	case l < 13:
+		header = []byte{byte(l<<4) | byte(tkl)}
+	case l < 269:
+		header = []byte{13<<4 | byte(tkl), byte(l - 13)}
+	case l < 65805:
+		l -= 269
+		header = []byte{14<<4 | byte(tkl), byte(l >> 8), byte(l)}
+	default:
+		l -= 65805
+		header = []byte{15<<4 | byte(tkl), byte(l >> 24), byte(l >> 16), byte(l >> 8), byte(l)}
+	}
+	return append(header, frame[1:]...), nil
+}
+
+type wsFrame struct {
+	data []byte
+	err  error
+}
+
+// WSConn is connection of CoAP over WebSockets (RFC 8323 section 4). It converts stream of TCP framed
+// messages to binary WebSocket frames of one message each and back, so it's served as TCP connection.
+//
+// Multiple goroutines may invoke methods on a WSConn simultaneously.
+type WSConn struct {
+	ws         *websocket.Conn
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	readCh     chan wsFrame
+	doneCh     chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+
+	readDeadline atomic.Value
+	readLock     sync.Mutex
+	readBuf      []byte // rest of received message
+
+	writeLock sync.Mutex
+	writeBuf  []byte // incomplete message
+}
+
+func newWSConn(ws *websocket.Conn, localAddr, remoteAddr net.Addr) *WSConn {
+	ws.PayloadType = websocket.BinaryFrame
+	c := WSConn{
+		ws:         ws,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		readCh:     make(chan wsFrame),
+		doneCh:     make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.readLoop()
+	return &c
+}
+
+// readLoop receives frames, deadlines of Read are handled by WSConn so frame is never read partially.
+func (c *WSConn) readLoop() {
+	defer c.wg.Done()
+	for {
+		var frame []byte
+		err := websocket.Message.Receive(c.ws, &frame)
+		var data []byte
+		if err == nil {
+			data, err = wsFrameToTCP(frame)
+		}
+		select {
+		case c.readCh <- wsFrame{data: data, err: err}:
+			if err != nil {
+				return
+			}
+		case <-c.doneCh:
+			return
+		}
+	}
+}
+
+// Read reads stream of TCP framed messages.
+func (c *WSConn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+	if len(c.readBuf) == 0 {
+		var deadline time.Time
+		if v := c.readDeadline.Load(); v != nil {
+			deadline = v.(time.Time)
+		}
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case f := <-c.readCh:
+			if f.err != nil {
+				return 0, f.err
+			}
+			c.readBuf = f.data
+		case <-timeout:
+			return 0, errS{
+				error:     fmt.Errorf(ioTimeout),
+				temporary: true,
+				timeout:   true,
+			}
+		case <-c.doneCh:
+			return 0, fmt.Errorf("connection closed")
+		}
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write writes stream of TCP framed messages, every complete message is sent as one frame.
+func (c *WSConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.writeBuf = append(c.writeBuf, b...)
+	for {
+		header, rest, ok := tcpHeaderLen(c.writeBuf)
+		if !ok || len(c.writeBuf) < header+rest {
+			break
+		}
+		msg := c.writeBuf[:header+rest]
+		frame := make([]byte, 0, len(msg)-header+1)
+		frame = append(frame, msg[0]&0xf)
+		frame = append(frame, msg[header:]...)
+		if _, err := c.ws.Write(frame); err != nil {
+			c.writeBuf = nil
+			return 0, err
+		}
+		c.writeBuf = c.writeBuf[header+rest:]
+	}
+	if len(c.writeBuf) == 0 {
+		c.writeBuf = nil
+	}
+	return len(b), nil
+}
+
+// Close closes the connection.
+func (c *WSConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.ws.Close()
+		close(c.doneCh)
+		c.wg.Wait()
+	})
+	return err
+}
+
+// Done is closed when connection is closed.
+func (c *WSConn) Done() <-chan struct{} {
+	return c.doneCh
+}
+
+// LocalAddr returns the local network address.
+func (c *WSConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// RemoteAddr returns the remote network address.
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// SetDeadline sets read and write deadlines.
+func (c *WSConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets read deadline.
+func (c *WSConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Store(t)
+	return nil
+}
+
+// SetWriteDeadline sets write deadline.
+func (c *WSConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+// wsURL returns URL of endpoint at address, which is host:port or ws:// or wss:// URL.
+func wsURL(address string, secure bool) string {
+	if strings.HasPrefix(address, "ws://") || strings.HasPrefix(address, "wss://") {
+		return address
+	}
+	if secure {
+		return "wss://" + address + WSPath
+	}
+	return "ws://" + address + WSPath
+}
+
+// DialWS connects to CoAP over WebSockets endpoint at address, which is host:port of server with
+// endpoint at WSPath or URL of endpoint. Connection is secured by TLS when tlsConfig is set.
+func DialWS(ctx context.Context, dialer *net.Dialer, address string, tlsConfig *tls.Config) (*WSConn, error) {
+	cfg, err := websocket.NewConfig(wsURL(address, tlsConfig != nil), "http://localhost/")
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial websocket: %v", err)
+	}
+	cfg.Protocol = []string{WSSubprotocol}
+	host := cfg.Location.Host
+	if cfg.Location.Port() == "" {
+		port := "80"
+		if cfg.Location.Scheme == "wss" {
+			port = "443"
+		}
+		host = net.JoinHostPort(host, port)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if cfg.Location.Scheme == "wss" {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" && !tlsConfig.InsecureSkipVerify {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = cfg.Location.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	ws, err := websocket.NewClient(cfg, conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot dial websocket: %v", err)
+	}
+	if p := ws.Config().Protocol; len(p) != 1 || p[0] != WSSubprotocol {
+		ws.Close()
+		return nil, errWSSubprotocol
+	}
+	conn.SetDeadline(time.Time{})
+	return newWSConn(ws, conn.LocalAddr(), conn.RemoteAddr()), nil
+}
@@ -0,0 +1,62 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSFrameToTCP(t *testing.T) {
+	for _, l := range []int{0, 12, 13, 268, 269, 65804, 65805} {
+		// Len 0, TKL 2, code 2.05, token and options with payload
+		frame := append([]byte{0x02, 0x45, 0xaa, 0xbb}, bytes.Repeat([]byte{0xff}, l)...)
+		tcp, err := wsFrameToTCP(frame)
+		require.NoError(t, err)
+		header, rest, ok := tcpHeaderLen(tcp)
+		require.True(t, ok)
+		assert.Equal(t, len(tcp), header+rest, "length %v", l)
+		assert.Equal(t, byte(0x02), tcp[0]&0xf)
+		assert.Equal(t, frame[1:], tcp[header:])
+	}
+	_, err := wsFrameToTCP([]byte{0x12, 0x45, 0xaa, 0xbb})
+	assert.Error(t, err)
+	_, err = wsFrameToTCP([]byte{0x08, 0x45})
+	assert.Error(t, err)
+}
+
+func TestDialWS(t *testing.T) {
+	l, err := NewWSListener("tcp", "127.0.0.1:0", nil)
+	require.NoError(t, err)
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	c, err := DialWS(context.Background(), &net.Dialer{}, "ws://"+l.Addr().String()+WSPath, nil)
+	require.NoError(t, err)
+	defer c.Close()
+	var s net.Conn
+	select {
+	case s = <-accepted:
+		defer s.Close()
+	case <-time.After(time.Second * 3):
+		require.FailNow(t, "connection not accepted")
+	}
+	_, err = c.Write([]byte{0x00, 0x01})
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, err := s.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x01}, buf[:n])
+
+	_, err = DialWS(context.Background(), &net.Dialer{}, "ws://"+l.Addr().String()+"/other", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// WSListener is CoAP over WebSockets listener (RFC 8323 section 4) that provides accept with context.
+// It serves HTTP requests to upgrade to WebSocket with subprotocol coap at WSPath, other requests
+// get 404 Not Found.
+type WSListener struct {
+	listener  net.Listener
+	server    *http.Server
+	connCh    chan *WSConn
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// wsHandshake accepts clients offering coap subprotocol.
+func wsHandshake(cfg *websocket.Config, req *http.Request) error {
+	for _, p := range cfg.Protocol {
+		if p == WSSubprotocol {
+			cfg.Protocol = []string{WSSubprotocol}
+			return nil
+		}
+	}
+	return errWSSubprotocol
+}
+
+// NewWSListener creates CoAP over WebSockets listener, it's secured by TLS (wss) when tlsConfig is set.
+// Known networks are "tcp", "tcp4" (IPv4-only), "tcp6" (IPv6-only).
+func NewWSListener(network string, addr string, tlsConfig *tls.Config) (*WSListener, error) {
+	tcp, err := newNetTCPListen(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new ws listener: %v", err)
+	}
+	var listener net.Listener = tcp
+	if tlsConfig != nil {
+		listener = tls.NewListener(tcp, tlsConfig)
+	}
+	l := &WSListener{
+		listener: listener,
+		connCh:   make(chan *WSConn),
+		doneCh:   make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(WSPath, websocket.Server{Handshake: wsHandshake, Handler: l.serveWS})
+	l.server = &http.Server{Handler: mux}
+	go l.server.Serve(listener)
+	return l, nil
+}
+
+// serveWS passes upgraded connection to Accept, the connection is served until it's closed.
+func (l *WSListener) serveWS(ws *websocket.Conn) {
+	remoteAddr := ws.RemoteAddr()
+	if a, err := net.ResolveTCPAddr("tcp", ws.Request().RemoteAddr); err == nil {
+		remoteAddr = a
+	}
+	c := newWSConn(ws, l.listener.Addr(), remoteAddr)
+	select {
+	case l.connCh <- c:
+	case <-l.doneCh:
+		c.Close()
+		return
+	}
+	<-c.Done()
+}
+
+// AcceptWithContext waits with context for a generic Conn.
+func (l *WSListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	select {
+	case c := <-l.connCh:
+		return c, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("cannot accept connections: %v", ctx.Err())
+	case <-l.doneCh:
+		return nil, fmt.Errorf("cannot accept connections: %v", errListenerClosed)
+	}
+}
+
+// Accept waits for a generic Conn.
+func (l *WSListener) Accept() (net.Conn, error) {
+	return l.AcceptWithContext(context.Background())
+}
+
+// Close closes the listener, accepted connections are not closed.
+func (l *WSListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.doneCh)
+		err = l.server.Close()
+	})
+	return err
+}
+
+// Addr represents a network end point address.
+func (l *WSListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
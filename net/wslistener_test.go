@@ -0,0 +1,67 @@
+package net
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func dialRawWS(t *testing.T, addr net.Addr, protocol string) (*websocket.Conn, error) {
+	cfg, err := websocket.NewConfig("ws://"+addr.String()+WSPath, "http://localhost/")
+	require.NoError(t, err)
+	if protocol != "" {
+		cfg.Protocol = []string{protocol}
+	}
+	return websocket.DialConfig(cfg)
+}
+
+func TestWSListener(t *testing.T) {
+	l, err := NewWSListener("tcp", "127.0.0.1:0", nil)
+	require.NoError(t, err)
+	defer l.Close()
+
+	_, err = dialRawWS(t, l.Addr(), "")
+	assert.Error(t, err)
+
+	ws, err := dialRawWS(t, l.Addr(), WSSubprotocol)
+	require.NoError(t, err)
+	defer ws.Close()
+	ws.PayloadType = websocket.BinaryFrame
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	c, err := l.AcceptWithContext(ctx)
+	require.NoError(t, err)
+	defer c.Close()
+	_, ok := c.RemoteAddr().(*net.TCPAddr)
+	assert.True(t, ok)
+
+	// GET with token 0x01 and Uri-Path "a"
+	_, err = ws.Write([]byte{0x01, 0x01, 0x01, 0xb1, 'a'})
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, err := c.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x21, 0x01, 0x01, 0xb1, 'a'}, buf[:n])
+
+	// stream written in parts is sent as one frame per message
+	stream := []byte{0x21, 0x45, 0x01, 0xff, 'x', 0x00, 0x44}
+	for _, part := range [][]byte{stream[:1], stream[1:6], stream[6:]} {
+		_, err = c.Write(part)
+		require.NoError(t, err)
+	}
+	var frame []byte
+	require.NoError(t, websocket.Message.Receive(ws, &frame))
+	assert.Equal(t, []byte{0x01, 0x45, 0x01, 0xff, 'x'}, frame)
+	require.NoError(t, websocket.Message.Receive(ws, &frame))
+	assert.Equal(t, []byte{0x00, 0x44}, frame)
+
+	c.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
+	_, err = c.Read(buf)
+	require.Error(t, err)
+	assert.True(t, err.(net.Error).Timeout())
+}
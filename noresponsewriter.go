@@ -1,6 +1,18 @@
 package coap
 
-import "context"
+import (
+	"context"
+	"io"
+)
+
+// Values of No-Response option (RFC 7967), they are combined to suppress more classes of responses.
+const (
+	NoResponse2xx uint32 = 2
+	NoResponse4xx uint32 = 8
+	NoResponse5xx uint32 = 16
+	// NoResponseAll suppresses all responses.
+	NoResponseAll = NoResponse2xx | NoResponse4xx | NoResponse5xx
+)
 
 var (
 	resp2XXCodes = []COAPCode{Created, Deleted, Valid, Changed, Content}
@@ -89,8 +101,53 @@ func (w *noResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message)
 
 	for _, code := range suppressedCodes {
 		if code == msg.Code() {
-			return ErrMessageNotInterested
+			return w.suppress(ctx)
 		}
 	}
 	return w.ResponseWriter.getReq().Client.WriteMsgWithContext(ctx, msg)
 }
+
+// suppress drops response, confirmable request is acknowledged by empty ACK instead of
+// piggybacked response, so client doesn't retransmit it (RFC 7967 section 2).
+func (w *noResponseWriter) suppress(ctx context.Context) error {
+	r := w.ResponseWriter.getReq()
+	if r.Msg.Type() == Confirmable && !r.Client.networkSession().IsTCP() {
+		ack := r.Client.NewMessage(MessageParams{
+			Type:      Acknowledgement,
+			Code:      Empty,
+			MessageID: r.Msg.MessageID(),
+		})
+		if err := r.Client.WriteMsgWithContext(ctx, ack); err != nil {
+			return err
+		}
+	}
+	return ErrMessageNotInterested
+}
+
+// PostNoResponse sends non-confirmable POST with No-Response option of value noResponse.
+// See PostNoResponseWithContext.
+func (co *ClientConn) PostNoResponse(path string, contentFormat MediaType, body io.Reader, noResponse uint32) (Message, error) {
+	return co.PostNoResponseWithContext(context.Background(), path, contentFormat, body, noResponse)
+}
+
+// PostNoResponseWithContext sends with context non-confirmable POST with No-Response option of value
+// noResponse, eg. telemetry with NoResponseAll. When all responses are suppressed it returns after
+// the request is written with nil response, otherwise it waits for response until ctx is done,
+// so ctx should have deadline.
+func (co *ClientConn) PostNoResponseWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader, noResponse uint32) (Message, error) {
+	req, err := co.NewPostRequest(path, contentFormat, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetType(NonConfirmable)
+	req.SetOption(NoResponse, noResponse)
+	if noResponse&NoResponseAll == NoResponseAll {
+		// blockwise session would wait for response of the payload
+		return nil, withoutBlockWise(co.networkSession()).WriteMsgWithContext(ctx, req)
+	}
+	resp, err := co.ExchangeWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, responseError(resp)
+}
@@ -1,9 +1,15 @@
 package coap
 
 import (
+	"bytes"
+	"context"
 	"reflect"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNoResponse2XXCodes(t *testing.T) {
@@ -107,3 +113,76 @@ func TestNoResponseBehaviour(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestNoResponseConfirmableAck(t *testing.T) {
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":", false, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("suppressed"))
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	msgs := make(chan Message, 1)
+	blockWiseTransfer := false
+	c := Client{Net: "udp", BlockWiseTransfer: &blockWiseTransfer, Handler: func(w ResponseWriter, r *Request) {
+		msgs <- r.Msg
+	}}
+	con, err := c.Dial(addr)
+	require.NoError(t, err)
+	defer con.Close()
+
+	req, err := con.NewPostRequest("/a", TextPlain, bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+	req.SetOption(NoResponse, NoResponse2xx)
+	err = con.WriteMsg(req)
+	require.NoError(t, err)
+
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, Acknowledgement, msg.Type())
+		assert.Equal(t, Empty, msg.Code())
+		assert.Equal(t, req.MessageID(), msg.MessageID())
+		assert.Empty(t, msg.Payload())
+	case <-time.After(time.Second):
+		t.Fatal("empty ACK was not received")
+	}
+}
+
+func TestPostNoResponse(t *testing.T) {
+	received := make(chan []byte, 1)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":", false, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		received <- r.Msg.Payload()
+		w.SetCode(Changed)
+		w.Write(nil)
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	c := Client{Net: "udp"}
+	con, err := c.Dial(addr)
+	require.NoError(t, err)
+	defer con.Close()
+
+	resp, err := con.PostNoResponse("/a", TextPlain, bytes.NewReader([]byte("telemetry")), NoResponseAll)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+	select {
+	case p := <-received:
+		assert.Equal(t, []byte("telemetry"), p)
+	case <-time.After(time.Second):
+		t.Fatal("request was not received")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err = con.PostNoResponseWithContext(ctx, "/a", TextPlain, bytes.NewReader([]byte("telemetry")), NoResponse4xx|NoResponse5xx)
+	require.NoError(t, err)
+	assert.Equal(t, Changed, resp.Code())
+	<-received
+}
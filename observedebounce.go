@@ -0,0 +1,85 @@
+package coap
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type debouncedNotification struct {
+	conn  *ClientConn
+	msg   Message
+	timer *time.Timer
+}
+
+// DebouncedObserveRegistry delays notifications of observations until their resource settles.
+// Notification waits debounce before it is sent, a newer notification of the same
+// observation replaces it and restarts the wait, so only the latest one is sent.
+// Notification of observation which was removed from the underlying registry meanwhile is dropped.
+type DebouncedObserveRegistry struct {
+	registry *ObserveRegistry
+	debounce time.Duration
+
+	// ErrorFunc is called when sending of delayed notification fails.
+	ErrorFunc func(err error)
+
+	lock    sync.Mutex
+	pending map[string]*debouncedNotification
+}
+
+// NewDebouncedObserveRegistry creates registry which debounces notifications of observations
+// tracked by underlying, eg. Server.ObserveRegistry. When underlying is nil, all notifications are sent.
+func NewDebouncedObserveRegistry(underlying *ObserveRegistry, debounce time.Duration) *DebouncedObserveRegistry {
+	return &DebouncedObserveRegistry{
+		registry: underlying,
+		debounce: debounce,
+		pending:  make(map[string]*debouncedNotification),
+	}
+}
+
+func debounceKey(addr net.Addr, token []byte) string {
+	return addr.String() + " " + string(token)
+}
+
+// Notify queues notification msg for observer conn, the observation is identified by token of msg.
+func (d *DebouncedObserveRegistry) Notify(conn *ClientConn, msg Message) {
+	key := debounceKey(conn.RemoteAddr(), msg.Token())
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if n, ok := d.pending[key]; ok {
+		n.conn, n.msg = conn, msg
+		n.timer.Reset(d.debounce)
+		return
+	}
+	n := &debouncedNotification{conn: conn, msg: msg}
+	n.timer = time.AfterFunc(d.debounce, func() { d.fire(key, n) })
+	d.pending[key] = n
+}
+
+func (d *DebouncedObserveRegistry) fire(key string, n *debouncedNotification) {
+	d.lock.Lock()
+	if d.pending[key] != n {
+		d.lock.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	conn, msg := n.conn, n.msg
+	d.lock.Unlock()
+
+	if d.registry != nil && !d.registry.registered(conn.RemoteAddr(), msg.Token()) {
+		return
+	}
+	if err := conn.WriteMsg(msg); err != nil && d.ErrorFunc != nil {
+		d.ErrorFunc(err)
+	}
+}
+
+// Stop drops pending notifications.
+func (d *DebouncedObserveRegistry) Stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for key, n := range d.pending {
+		n.timer.Stop()
+		delete(d.pending, key)
+	}
+}
@@ -0,0 +1,83 @@
+package coap
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebouncedObserveRegistry(t *testing.T) {
+	observers := make(chan *Request, 1)
+	s := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		resp := w.NewResponse(Content)
+		resp.SetOption(Observe, 2)
+		resp.SetPayload([]byte("initial"))
+		w.WriteMsg(resp)
+		observers <- r
+	})}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+	notifications := make(chan string, 16)
+	o, err := co.Observe("/sensor", func(req *Request) {
+		notifications <- string(req.Msg.Payload())
+	})
+	require.NoError(t, err)
+	defer o.Cancel()
+	assert.Equal(t, "initial", <-notifications)
+	r := <-observers
+
+	d := NewDebouncedObserveRegistry(s.ObserveRegistry(), time.Millisecond*50)
+	for i := 0; i < 10; i++ {
+		msg := r.Client.NewMessage(MessageParams{
+			Type:      NonConfirmable,
+			Code:      Content,
+			MessageID: GenerateMessageID(),
+			Token:     r.Msg.Token(),
+			Payload:   []byte(fmt.Sprintf("update %v", i)),
+		})
+		msg.SetOption(Observe, uint32(3+i))
+		d.Notify(r.Client, msg)
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case n := <-notifications:
+		assert.Equal(t, "update 9", n)
+	case <-time.After(time.Second):
+		require.FailNow(t, "notification was not received")
+	}
+	select {
+	case n := <-notifications:
+		require.FailNow(t, "unexpected notification", n)
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	// notification of cancelled observation is dropped
+	require.NoError(t, o.Cancel())
+	time.Sleep(time.Millisecond * 100)
+	require.Zero(t, s.ObserveRegistry().TotalObserverCount())
+	msg := r.Client.NewMessage(MessageParams{
+		Type:      NonConfirmable,
+		Code:      Content,
+		MessageID: GenerateMessageID(),
+		Token:     r.Msg.Token(),
+		Payload:   []byte("late"),
+	})
+	msg.SetOption(Observe, uint32(20))
+	d.Notify(r.Client, msg)
+	time.Sleep(time.Millisecond * 100)
+	d.lock.Lock()
+	assert.Empty(t, d.pending)
+	d.lock.Unlock()
+	select {
+	case n := <-notifications:
+		require.FailNow(t, "unexpected notification", n)
+	default:
+	}
+}
@@ -0,0 +1,93 @@
+package coap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HeartbeatObservation is observation which is registered again when no notification
+// arrives for twice the heartbeat interval of the server, see Server.ObserveHeartbeat.
+type HeartbeatObservation struct {
+	client      *ClientConn
+	path        string
+	interval    time.Duration
+	observeFunc func(req *Request)
+	options     []func(Message)
+
+	lock     sync.Mutex
+	obs      *Observation
+	watchdog *time.Timer
+	canceled bool
+}
+
+// ObserveWithHeartbeat subscribes to path of server which sends notification at least every interval.
+// When no notification arrives for 2 * interval, the observation is treated as lost and registered again,
+// failed registration is retried after next 2 * interval.
+func (co *ClientConn) ObserveWithHeartbeat(
+	ctx context.Context,
+	path string,
+	interval time.Duration,
+	observeFunc func(req *Request),
+	options ...func(Message),
+) (*HeartbeatObservation, error) {
+	o := &HeartbeatObservation{
+		client:      co,
+		path:        path,
+		interval:    interval,
+		observeFunc: observeFunc,
+		options:     options,
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	obs, err := co.ObserveWithContext(ctx, path, o.notify, options...)
+	if err != nil {
+		return nil, err
+	}
+	o.obs = obs
+	o.watchdog = time.AfterFunc(2*interval, o.lost)
+	return o, nil
+}
+
+func (o *HeartbeatObservation) notify(req *Request) {
+	o.lock.Lock()
+	if !o.canceled && o.watchdog != nil {
+		o.watchdog.Reset(2 * o.interval)
+	}
+	o.lock.Unlock()
+	o.observeFunc(req)
+}
+
+func (o *HeartbeatObservation) lost() {
+	o.lock.Lock()
+	if o.canceled {
+		o.lock.Unlock()
+		return
+	}
+	old := o.obs
+	obs, err := o.client.ObserveWithContext(context.Background(), o.path, o.notify, o.options...)
+	if err == nil {
+		o.obs = obs
+	}
+	o.watchdog.Reset(2 * o.interval)
+	o.lock.Unlock()
+
+	if err == nil {
+		old.Cancel()
+	}
+}
+
+// Cancel same as CancelWithContext without context.
+func (o *HeartbeatObservation) Cancel() error {
+	return o.CancelWithContext(context.Background())
+}
+
+// CancelWithContext removes observation from server and stops watching of heartbeat.
+func (o *HeartbeatObservation) CancelWithContext(ctx context.Context) error {
+	o.lock.Lock()
+	o.canceled = true
+	o.watchdog.Stop()
+	obs := o.obs
+	o.lock.Unlock()
+	return obs.CancelWithContext(ctx)
+}
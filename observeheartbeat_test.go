@@ -0,0 +1,128 @@
+package coap
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifyOnce answers observe registration by single notification.
+func notifyOnce(registrations *int32) HandlerFunc {
+	return func(w ResponseWriter, r *Request) {
+		if r.Msg.Option(Observe) == nil {
+			w.SetCode(Content)
+			w.Write(nil)
+			return
+		}
+		atomic.AddInt32(registrations, 1)
+		resp := w.NewResponse(Content)
+		resp.SetOption(Observe, 2)
+		resp.SetOption(ContentFormat, TextPlain)
+		resp.SetPayload([]byte("stable"))
+		w.WriteMsg(resp)
+	}
+}
+
+func TestObserveHeartbeat(t *testing.T) {
+	var registrations int32
+	s := &Server{Handler: notifyOnce(&registrations), ObserveHeartbeat: time.Second}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	notifications := make(chan *Request, 8)
+	o, err := co.ObserveWithHeartbeat(context.Background(), "/obs", time.Second, func(req *Request) {
+		notifications <- req
+	})
+	require.NoError(t, err)
+	defer o.Cancel()
+
+	for i := 0; i < 4; i++ {
+		select {
+		case req := <-notifications:
+			assert.Equal(t, "stable", string(req.Msg.Payload()))
+			if i > 0 {
+				assert.Equal(t, Confirmable, req.Msg.Type(), "heartbeat %v", i)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("notification %v was not received", i)
+		}
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&registrations))
+
+	require.NoError(t, o.Cancel())
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, 0, s.observers.TotalObserverCount())
+	select {
+	case <-notifications:
+		t.Fatalf("heartbeat was sent after cancellation")
+	case <-time.After(time.Millisecond * 1500):
+	}
+}
+
+func TestObserveHeartbeatMessagePool(t *testing.T) {
+	var registrations int32
+	s := &Server{Handler: notifyOnce(&registrations), ObserveHeartbeat: time.Millisecond * 200, MessagePool: NewMessagePool(1)}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	notifications := make(chan *Request, 8)
+	o, err := co.Observe("/obs", func(req *Request) {
+		notifications <- req
+	})
+	require.NoError(t, err)
+	defer o.Cancel()
+	<-notifications
+
+	// reuse pooled message of the registration by other requests
+	for i := 0; i < 10; i++ {
+		_, err := co.Get("/other")
+		require.NoError(t, err)
+	}
+	select {
+	case req := <-notifications:
+		assert.Equal(t, Confirmable, req.Msg.Type())
+		assert.Equal(t, "stable", string(req.Msg.Payload()))
+	case <-time.After(time.Second):
+		t.Fatalf("heartbeat was not received")
+	}
+	assert.Equal(t, 1, s.observers.TotalObserverCount())
+}
+
+func TestObserveHeartbeatLost(t *testing.T) {
+	var registrations int32
+	// server doesn't send heartbeats, so observation looks lost
+	s := &Server{Handler: notifyOnce(&registrations)}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	notifications := make(chan *Request, 8)
+	o, err := co.ObserveWithHeartbeat(context.Background(), "/obs", time.Millisecond*200, func(req *Request) {
+		notifications <- req
+	})
+	require.NoError(t, err)
+	defer o.Cancel()
+
+	<-notifications
+	select {
+	case <-notifications:
+	case <-time.After(time.Second):
+		t.Fatalf("notification of new registration was not received")
+	}
+	assert.True(t, atomic.LoadInt32(&registrations) >= 2)
+}
@@ -0,0 +1,438 @@
+package coap
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultObserveConfirmableInterval is interval of confirmable notifications when
+// ObserveManager.ConfirmableInterval is not set, RFC 7641 section 4.5 requires at least one per day.
+const DefaultObserveConfirmableInterval = 24 * time.Hour
+
+// DefaultObserveAckTimeout is time to acknowledge confirmable notification when
+// ObserveManager.AckTimeout is not set, MAX_TRANSMIT_WAIT of RFC 7252.
+const DefaultObserveAckTimeout = 93 * time.Second
+
+// maxObserveSequence is the highest value of Observe option, it has 24 bits.
+const maxObserveSequence = 1<<24 - 1
+
+type managedObserver struct {
+	key      string
+	resource *observableResource
+	client   *ClientConn
+	req      *Request // copy of registration
+
+	lastConfirmable time.Time
+	pendingKey      string // notification waiting for acknowledgement
+	ackTimer        *time.Timer
+}
+
+type observableResource struct {
+	path      string
+	handler   Handler
+	seq       uint32
+	observers map[string]*managedObserver
+}
+
+// ObserveManager keeps observers of resources (RFC 7641), so handler of resource doesn't track them.
+// Handler of resource is wrapped by Observable, the manager registers GET with Observe 0 and
+// deregisters GET with Observe 1. Notify or NotifyChanged sends notification to every observer
+// of resource with the next sequence number.
+//
+// Observer is removed when sending of notification fails, when client answers notification by
+// Reset or doesn't acknowledge confirmable notification within AckTimeout. Acknowledgements and
+// Resets are received by Middleware, which must be added by Server.Use.
+type ObserveManager struct {
+	// Confirmable sends every notification as confirmable, otherwise notifications are
+	// non-confirmable except one per ConfirmableInterval (DefaultObserveConfirmableInterval when 0).
+	Confirmable         bool
+	ConfirmableInterval time.Duration
+	// AckTimeout is time to acknowledge confirmable notification, DefaultObserveAckTimeout when 0.
+	AckTimeout time.Duration
+	// ErrorFunc is called when observer is removed because of failure.
+	ErrorFunc func(err error)
+
+	lock      sync.Mutex
+	resources map[string]*observableResource
+	pending   map[string]*managedObserver // by client address and message ID
+}
+
+// NewObserveManager creates manager without observers.
+func NewObserveManager() *ObserveManager {
+	return &ObserveManager{
+		resources: make(map[string]*observableResource),
+		pending:   make(map[string]*managedObserver),
+	}
+}
+
+func observeResourceKey(path string) string {
+	return strings.Trim(path, "/")
+}
+
+func managedObserverKey(addr net.Addr, token []byte) string {
+	return addr.String() + "/" + string(token)
+}
+
+func pendingNotificationKey(addr net.Addr, messageID uint16) string {
+	return addr.String() + "/" + string([]byte{byte(messageID >> 8), byte(messageID)})
+}
+
+// cloneRequestMsg copies msg, which may be borrowed from Server.MessagePool.
+func cloneRequestMsg(c *ClientConn, msg Message) Message {
+	cp := c.NewMessage(MessageParams{
+		Type:      msg.Type(),
+		Code:      msg.Code(),
+		MessageID: msg.MessageID(),
+		Token:     append([]byte(nil), msg.Token()...),
+		Payload:   append([]byte(nil), msg.Payload()...),
+	})
+	for _, o := range msg.AllOptions() {
+		v := o.Value
+		if b, ok := v.([]byte); ok {
+			v = append([]byte(nil), b...)
+		}
+		cp.AddOption(o.ID, v)
+	}
+	return cp
+}
+
+// Observable wraps handler of resource to register its observers. The resource is identified
+// by path of request.
+func (m *ObserveManager) Observable(handler Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		obs, ok := r.Msg.Option(Observe).(uint32)
+		if !ok || r.Msg.Code() != GET && r.Msg.Code() != FETCH {
+			handler.ServeCOAP(w, r)
+			return
+		}
+		if obs != 0 {
+			m.deregister(r.Msg.PathString(), r.Client.RemoteAddr(), r.Msg.Token())
+			handler.ServeCOAP(w, r)
+			return
+		}
+		o := m.register(handler, r)
+		handler.ServeCOAP(&observeManagerResponseWriter{ResponseWriter: w, m: m, o: o}, r)
+	})
+}
+
+func (m *ObserveManager) register(handler Handler, r *Request) *managedObserver {
+	key := observeResourceKey(r.Msg.PathString())
+	msg := cloneRequestMsg(r.Client, r.Msg)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res, ok := m.resources[key]
+	if !ok {
+		res = &observableResource{path: key, observers: make(map[string]*managedObserver)}
+		m.resources[key] = res
+	}
+	res.handler = handler
+	o := &managedObserver{
+		key:             managedObserverKey(r.Client.RemoteAddr(), r.Msg.Token()),
+		resource:        res,
+		client:          r.Client,
+		req:             &Request{Msg: msg, Client: r.Client, Ctx: context.Background(), Sequence: r.Sequence},
+		lastConfirmable: time.Now(),
+	}
+	if prev, ok := res.observers[o.key]; ok {
+		// re-registration
+		m.clearPending(prev)
+	}
+	res.observers[o.key] = o
+	return o
+}
+
+func (m *ObserveManager) deregister(path string, addr net.Addr, token []byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res, ok := m.resources[observeResourceKey(path)]
+	if !ok {
+		return
+	}
+	if o, ok := res.observers[managedObserverKey(addr, token)]; ok {
+		m.remove(o)
+	}
+}
+
+// remove removes observer, lock must be held.
+func (m *ObserveManager) remove(o *managedObserver) {
+	m.clearPending(o)
+	if o.resource.observers[o.key] == o {
+		delete(o.resource.observers, o.key)
+	}
+}
+
+func (m *ObserveManager) clearPending(o *managedObserver) {
+	if o.ackTimer != nil {
+		o.ackTimer.Stop()
+		o.ackTimer = nil
+	}
+	if o.pendingKey != "" {
+		delete(m.pending, o.pendingKey)
+		o.pendingKey = ""
+	}
+}
+
+func (m *ObserveManager) fail(o *managedObserver, err error) {
+	m.lock.Lock()
+	m.remove(o)
+	m.lock.Unlock()
+	if m.ErrorFunc != nil {
+		m.ErrorFunc(err)
+	}
+}
+
+// ObserverCount returns count of observers of resource at path.
+func (m *ObserveManager) ObserverCount(path string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if res, ok := m.resources[observeResourceKey(path)]; ok {
+		return len(res.observers)
+	}
+	return 0
+}
+
+// nextSequence increments sequence number of resource at path and returns its observers.
+func (m *ObserveManager) nextSequence(path string) (uint32, []*managedObserver) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res, ok := m.resources[observeResourceKey(path)]
+	if !ok {
+		return 0, nil
+	}
+	res.seq = (res.seq + 1) & maxObserveSequence
+	observers := make([]*managedObserver, 0, len(res.observers))
+	for _, o := range res.observers {
+		observers = append(observers, o)
+	}
+	return res.seq, observers
+}
+
+func (m *ObserveManager) sequence(o *managedObserver) uint32 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return o.resource.seq
+}
+
+// Notify sends notification 2.05 Content with payload to observers of resource at path.
+func (m *ObserveManager) Notify(path string, contentFormat MediaType, payload []byte) {
+	m.NotifyWithContext(context.Background(), path, contentFormat, payload)
+}
+
+// NotifyWithContext sends with context notification 2.05 Content with payload to observers of resource at path.
+func (m *ObserveManager) NotifyWithContext(ctx context.Context, path string, contentFormat MediaType, payload []byte) {
+	seq, observers := m.nextSequence(path)
+	for _, o := range observers {
+		msg := o.client.NewMessage(MessageParams{
+			Code:    Content,
+			Token:   o.req.Msg.Token(),
+			Payload: payload,
+		})
+		msg.SetOption(ContentFormat, contentFormat)
+		m.send(ctx, o, seq, msg)
+	}
+}
+
+// NotifyChanged calls handler of resource at path for every observer, notifications are
+// the responses written by handler to its registration request.
+func (m *ObserveManager) NotifyChanged(path string) {
+	m.NotifyChangedWithContext(context.Background(), path)
+}
+
+// NotifyChangedWithContext calls with context handler of resource at path for every observer.
+func (m *ObserveManager) NotifyChangedWithContext(ctx context.Context, path string) {
+	seq, observers := m.nextSequence(path)
+	for _, o := range observers {
+		m.lock.Lock()
+		handler := o.resource.handler
+		m.lock.Unlock()
+		req := &Request{Msg: o.req.Msg, Client: o.client, Ctx: ctx, Sequence: o.req.Sequence}
+		w := &observeNotificationWriter{
+			responseWriter: &responseWriter{req: req},
+			m:              m,
+			o:              o,
+			seq:            seq,
+		}
+		handler.ServeCOAP(w, req)
+	}
+}
+
+// send sends notification msg with sequence number seq to observer o.
+func (m *ObserveManager) send(ctx context.Context, o *managedObserver, seq uint32, msg Message) error {
+	session := o.client.networkSession()
+	if b, ok := session.(*blockWiseSession); ok {
+		// blockwise would send it as acknowledgement of the registration
+		session = b.networkSession
+	}
+	msg.SetOption(Observe, seq)
+	msg.SetMessageID(GenerateMessageID())
+	confirmable := false
+	if !session.IsTCP() {
+		interval := m.ConfirmableInterval
+		if interval == 0 {
+			interval = DefaultObserveConfirmableInterval
+		}
+		m.lock.Lock()
+		if m.Confirmable || time.Since(o.lastConfirmable) >= interval {
+			confirmable = true
+			o.lastConfirmable = time.Now()
+			m.clearPending(o)
+			o.pendingKey = pendingNotificationKey(o.client.RemoteAddr(), msg.MessageID())
+			m.pending[o.pendingKey] = o
+		}
+		m.lock.Unlock()
+		msg.SetType(NonConfirmable)
+		if confirmable {
+			msg.SetType(Confirmable)
+		}
+	}
+	if err := session.WriteMsgWithContext(ctx, msg); err != nil {
+		m.fail(o, err)
+		return err
+	}
+	if confirmable {
+		m.waitAck(o, msg.MessageID())
+	}
+	return nil
+}
+
+func (m *ObserveManager) waitAck(o *managedObserver, messageID uint16) {
+	timeout := m.AckTimeout
+	if timeout == 0 {
+		timeout = DefaultObserveAckTimeout
+	}
+	key := pendingNotificationKey(o.client.RemoteAddr(), messageID)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if o.pendingKey != key {
+		// acknowledged or superseded meanwhile
+		return
+	}
+	o.ackTimer = time.AfterFunc(timeout, func() {
+		m.lock.Lock()
+		expired := m.pending[key] == o
+		m.lock.Unlock()
+		if expired {
+			m.fail(o, ErrTimeout)
+		}
+	})
+}
+
+// Middleware receives acknowledgements and resets of confirmable notifications, client which
+// resets notification is removed from observers. It's added by Server.Use.
+func (m *ObserveManager) Middleware(next Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		typ := r.Msg.Type()
+		if r.Msg.Code() != Empty || typ != Acknowledgement && typ != Reset {
+			next.ServeCOAP(w, r)
+			return
+		}
+		m.lock.Lock()
+		o, ok := m.pending[pendingNotificationKey(r.Client.RemoteAddr(), r.Msg.MessageID())]
+		if ok {
+			if typ == Reset {
+				m.remove(o)
+			} else {
+				m.clearPending(o)
+			}
+		}
+		m.lock.Unlock()
+		if !ok {
+			next.ServeCOAP(w, r)
+		}
+	})
+}
+
+// observeManagerResponseWriter adds sequence number to response of registration, observer is
+// removed when handler doesn't accept observation.
+type observeManagerResponseWriter struct {
+	ResponseWriter
+	m *ObserveManager
+	o *managedObserver
+}
+
+func (w *observeManagerResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *observeManagerResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *observeManagerResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *observeManagerResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	if isErrorCode(msg.Code()) {
+		w.m.lock.Lock()
+		w.m.remove(w.o)
+		w.m.lock.Unlock()
+	} else {
+		msg.SetOption(Observe, w.m.sequence(w.o))
+	}
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+// observeNotificationWriter sends responses of handler as notifications to observer.
+type observeNotificationWriter struct {
+	*responseWriter
+	m   *ObserveManager
+	o   *managedObserver
+	seq uint32
+}
+
+func (w *observeNotificationWriter) NewResponse(code COAPCode) Message {
+	return w.o.client.NewMessage(MessageParams{
+		Code:  code,
+		Token: w.o.req.Msg.Token(),
+	})
+}
+
+func (w *observeNotificationWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *observeNotificationWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.req.Msg.Code(), w.code, w.contentFormat, p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *observeNotificationWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *observeNotificationWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	switch msg.Code() {
+	case GET, POST, PUT, DELETE:
+		return ErrInvalidReponseCode
+	}
+	if isErrorCode(msg.Code()) {
+		// RFC 7641 section 4.2, error response ends observation
+		w.m.lock.Lock()
+		w.m.remove(w.o)
+		w.m.lock.Unlock()
+		msg.SetType(NonConfirmable)
+		msg.SetMessageID(GenerateMessageID())
+		return w.o.client.WriteMsgWithContext(ctx, msg)
+	}
+	return w.m.send(ctx, w.o, w.seq, msg)
+}
+
+func (w *observeNotificationWriter) WriteError(err error) {
+	writeError(w, err)
+}
+
+func (w *observeNotificationWriter) WriteReader(rd io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return w.WriteReaderWithContext(context.Background(), rd, contentFormat, szx)
+}
+
+func (w *observeNotificationWriter) WriteReaderWithContext(ctx context.Context, rd io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return writeReaderWhole(ctx, w, rd, contentFormat)
+}
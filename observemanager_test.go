@@ -0,0 +1,136 @@
+package coap
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runObserveManagerServer(t *testing.T, m *ObserveManager) (string, func()) {
+	var value int32
+	mux := NewServeMux()
+	mux.Handle("/temp", m.Observable(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte{byte('0' + atomic.LoadInt32(&value))})
+	})))
+	mux.HandleFunc("/set", func(w ResponseWriter, r *Request) {
+		atomic.StoreInt32(&value, int32(r.Msg.Payload()[0]-'0'))
+		m.NotifyChanged("/temp")
+		w.SetCode(Changed)
+		w.Write(nil)
+	})
+	s := &Server{Handler: mux}
+	s.Use(m.Middleware)
+	return runLocalUDPServer(t, s)
+}
+
+type observedNotifications struct {
+	lock sync.Mutex
+	msgs []Message
+	ch   chan struct{}
+}
+
+func newObservedNotifications() *observedNotifications {
+	return &observedNotifications{ch: make(chan struct{}, 16)}
+}
+
+func (n *observedNotifications) add(r *Request) {
+	n.lock.Lock()
+	n.msgs = append(n.msgs, r.Msg)
+	n.lock.Unlock()
+	n.ch <- struct{}{}
+}
+
+func (n *observedNotifications) wait(t *testing.T) Message {
+	select {
+	case <-n.ch:
+	case <-time.After(time.Second * 2):
+		require.FailNow(t, "notification timeout")
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.msgs[len(n.msgs)-1]
+}
+
+func TestObserveManagerNotify(t *testing.T) {
+	m := NewObserveManager()
+	addr, shutdown := runObserveManagerServer(t, m)
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	n := newObservedNotifications()
+	obs, err := co.Observe("/temp", n.add)
+	require.NoError(t, err)
+	first := n.wait(t)
+	assert.Equal(t, []byte("0"), first.Payload())
+	assert.Equal(t, uint32(0), first.Option(Observe))
+	assert.Equal(t, 1, m.ObserverCount("/temp"))
+
+	m.Notify("/temp", TextPlain, []byte("21.5"))
+	msg := n.wait(t)
+	assert.Equal(t, []byte("21.5"), msg.Payload())
+	assert.Equal(t, uint32(1), msg.Option(Observe))
+	assert.Equal(t, NonConfirmable, msg.Type())
+
+	_, err = co.Post("/set", TextPlain, bytes.NewReader([]byte("7")))
+	require.NoError(t, err)
+	msg = n.wait(t)
+	assert.Equal(t, []byte("7"), msg.Payload())
+	assert.Equal(t, uint32(2), msg.Option(Observe))
+	assert.Equal(t, TextPlain, msg.Option(ContentFormat))
+
+	require.NoError(t, obs.Cancel())
+	require.Eventually(t, func() bool { return m.ObserverCount("/temp") == 0 }, time.Second, time.Millisecond*10)
+}
+
+func TestObserveManagerPrunesObservers(t *testing.T) {
+	errs := make(chan error, 1)
+	m := NewObserveManager()
+	m.Confirmable = true
+	m.AckTimeout = time.Millisecond * 100
+	m.ErrorFunc = func(err error) { errs <- err }
+	addr, shutdown := runObserveManagerServer(t, m)
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	// reset of confirmable notification
+	n := newObservedNotifications()
+	_, err = co.Observe("/temp", n.add)
+	require.NoError(t, err)
+	n.wait(t)
+	m.Notify("/temp", TextPlain, []byte("1"))
+	msg := n.wait(t)
+	require.Equal(t, Confirmable, msg.Type())
+	require.NoError(t, co.WriteMsg(co.NewMessage(MessageParams{Type: Reset, Code: Empty, MessageID: msg.MessageID()})))
+	require.Eventually(t, func() bool { return m.ObserverCount("/temp") == 0 }, time.Second, time.Millisecond*10)
+
+	// acknowledgement keeps observer
+	_, err = co.Observe("/temp", n.add)
+	require.NoError(t, err)
+	n.wait(t)
+	m.Notify("/temp", TextPlain, []byte("2"))
+	msg = n.wait(t)
+	require.NoError(t, co.WriteMsg(co.NewMessage(MessageParams{Type: Acknowledgement, Code: Empty, MessageID: msg.MessageID()})))
+	time.Sleep(m.AckTimeout * 2)
+	require.Equal(t, 1, m.ObserverCount("/temp"))
+
+	// missing acknowledgement
+	m.Notify("/temp", TextPlain, []byte("3"))
+	n.wait(t)
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrTimeout, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "observer was not removed")
+	}
+	assert.Equal(t, 0, m.ObserverCount("/temp"))
+}
@@ -0,0 +1,279 @@
+package coap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+type observeEntry struct {
+	heartbeat *time.Timer
+}
+
+func (e *observeEntry) stop() {
+	if e.heartbeat != nil {
+		e.heartbeat.Stop()
+	}
+}
+
+// ObserveRegistry tracks active observations of the server by client address.
+type ObserveRegistry struct {
+	lock            sync.Mutex
+	clients         map[string]map[string]*observeEntry
+	instrumentation Instrumentation // nil when not set
+}
+
+func (o *ObserveRegistry) setInstrumentation(i Instrumentation) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.instrumentation = i
+}
+
+// removed reports count of removed observations.
+func (o *ObserveRegistry) removed(count int) {
+	if o.instrumentation == nil {
+		return
+	}
+	for i := 0; i < count; i++ {
+		o.instrumentation.ObserveDeregistered()
+	}
+}
+
+// register adds observation of client. It returns false when client
+// already has max observations, max <= 0 means unlimited.
+func (o *ObserveRegistry) register(addr net.Addr, token []byte, max int) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.clients == nil {
+		o.clients = make(map[string]map[string]*observeEntry)
+	}
+	tokens := o.clients[addr.String()]
+	if _, ok := tokens[string(token)]; ok {
+		// re-registration
+		return true
+	}
+	if max > 0 && len(tokens) >= max {
+		return false
+	}
+	if tokens == nil {
+		tokens = make(map[string]*observeEntry)
+		o.clients[addr.String()] = tokens
+	}
+	tokens[string(token)] = &observeEntry{}
+	if o.instrumentation != nil {
+		o.instrumentation.ObserveRegistered()
+	}
+	return true
+}
+
+// setHeartbeat binds heartbeat timer to observation, previous timer is stopped. It returns false
+// when the observation is not registered.
+func (o *ObserveRegistry) setHeartbeat(addr net.Addr, token []byte, heartbeat *time.Timer) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	e, ok := o.clients[addr.String()][string(token)]
+	if !ok {
+		return false
+	}
+	if e.heartbeat != heartbeat {
+		e.stop()
+		e.heartbeat = heartbeat
+	}
+	return true
+}
+
+func (o *ObserveRegistry) registered(addr net.Addr, token []byte) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	_, ok := o.clients[addr.String()][string(token)]
+	return ok
+}
+
+func (o *ObserveRegistry) deregister(addr net.Addr, token []byte) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	tokens := o.clients[addr.String()]
+	if e, ok := tokens[string(token)]; ok {
+		e.stop()
+		delete(tokens, string(token))
+		o.removed(1)
+	}
+	if len(tokens) == 0 {
+		delete(o.clients, addr.String())
+	}
+}
+
+// migrateClient moves observations of client at addr to newAddr.
+func (o *ObserveRegistry) migrateClient(addr, newAddr net.Addr) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	tokens, ok := o.clients[addr.String()]
+	if !ok {
+		return
+	}
+	delete(o.clients, addr.String())
+	if existing, ok := o.clients[newAddr.String()]; ok {
+		for token, e := range tokens {
+			if _, ok := existing[token]; ok {
+				o.removed(1)
+			}
+			existing[token] = e
+		}
+		return
+	}
+	o.clients[newAddr.String()] = tokens
+}
+
+func (o *ObserveRegistry) removeClient(addr net.Addr) {
+	if addr == nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, e := range o.clients[addr.String()] {
+		e.stop()
+	}
+	o.removed(len(o.clients[addr.String()]))
+	delete(o.clients, addr.String())
+}
+
+// TotalObserverCount returns count of active observations of all clients.
+func (o *ObserveRegistry) TotalObserverCount() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var n int
+	for _, tokens := range o.clients {
+		n += len(tokens)
+	}
+	return n
+}
+
+// ObserverCountByClient returns count of active observations of client.
+func (o *ObserveRegistry) ObserverCountByClient(addr net.Addr) int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.clients[addr.String()])
+}
+
+// observeResponseWriter drops registration when handler doesn't accept observation.
+// When heartbeat is set, the last notification is resent as confirmable after heartbeat
+// without notification.
+type observeResponseWriter struct {
+	ResponseWriter
+	registry  *ObserveRegistry
+	heartbeat time.Duration
+	// client, addr and token identify the observation, they are copied at registration
+	// because request message is returned to MessagePool after handler returns.
+	client *ClientConn
+	addr   net.Addr
+	token  []byte
+
+	lock  sync.Mutex
+	last  Message
+	timer *time.Timer
+}
+
+func (w *observeResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *observeResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *observeResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *observeResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	if msg.Option(Observe) == nil || isErrorCode(msg.Code()) {
+		w.registry.deregister(w.addr, w.token)
+	} else if w.heartbeat > 0 {
+		w.scheduleHeartbeat(msg)
+	}
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+func (w *observeResponseWriter) scheduleHeartbeat(msg Message) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	// copied, msg is modified by writers down the chain
+	w.last = copyNotification(w.client, msg)
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.heartbeat, w.sendHeartbeat)
+	} else {
+		w.timer.Reset(w.heartbeat)
+	}
+	if !w.registry.setHeartbeat(w.addr, w.token, w.timer) {
+		w.timer.Stop()
+	}
+}
+
+// sendHeartbeat resends the last notification with the same sequence number,
+// so it doesn't supersede a notification sent by handler meanwhile.
+func (w *observeResponseWriter) sendHeartbeat() {
+	w.lock.Lock()
+	if !w.registry.setHeartbeat(w.addr, w.token, w.timer) {
+		// observation was cancelled meanwhile
+		w.lock.Unlock()
+		return
+	}
+	msg := copyNotification(w.client, w.last)
+	msg.SetMessageID(GenerateMessageID())
+	w.timer.Reset(w.heartbeat)
+	w.lock.Unlock()
+
+	session := w.client.networkSession()
+	if b, ok := session.(*blockWiseSession); ok {
+		// blockwise would send it as acknowledgement of the registration
+		session = b.networkSession
+	}
+	if err := session.WriteMsgWithContext(context.Background(), msg); err != nil {
+		w.registry.deregister(w.addr, w.token)
+	}
+}
+
+func copyNotification(c *ClientConn, msg Message) Message {
+	cp := c.NewMessage(MessageParams{
+		Type:    Confirmable,
+		Code:    msg.Code(),
+		Token:   msg.Token(),
+		Payload: msg.Payload(),
+	})
+	for _, o := range msg.AllOptions() {
+		cp.AddOption(o.ID, o.Value)
+	}
+	return cp
+}
+
+// handleObserveMsg maintains registry of observations and rejects new observations
+// over MaxObserversPerClient with 5.03 Service Unavailable.
+func (srv *Server) handleObserveMsg(w ResponseWriter, r *Request, next HandlerFunc) {
+	if r.Msg.Code() != GET && r.Msg.Code() != FETCH {
+		next(w, r)
+		return
+	}
+	obs, ok := r.Msg.Option(Observe).(uint32)
+	if !ok || obs != 0 {
+		// deregistration
+		srv.observers.deregister(r.Client.RemoteAddr(), r.Msg.Token())
+		next(w, r)
+		return
+	}
+	if !srv.observers.register(r.Client.RemoteAddr(), r.Msg.Token(), srv.MaxObserversPerClient) {
+		w.SetCode(ServiceUnavailable)
+		w.Write(nil)
+		return
+	}
+	next(&observeResponseWriter{
+		ResponseWriter: w,
+		registry:       &srv.observers,
+		heartbeat:      srv.ObserveHeartbeat,
+		client:         r.Client,
+		addr:           r.Client.RemoteAddr(),
+		token:          append([]byte(nil), r.Msg.Token()...),
+	}, r)
+}
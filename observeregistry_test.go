@@ -0,0 +1,110 @@
+package coap
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type observeSubscription struct {
+	client *ClientConn
+	token  []byte
+}
+
+func TestMaxObserversPerClient(t *testing.T) {
+	const max = 3
+	var lock sync.Mutex
+	var subs []observeSubscription
+	handler := func(w ResponseWriter, r *Request) {
+		if r.Msg.Option(Observe) == nil {
+			w.SetCode(Content)
+			w.Write(nil)
+			return
+		}
+		lock.Lock()
+		subs = append(subs, observeSubscription{client: r.Client, token: r.Msg.Token()})
+		lock.Unlock()
+		resp := w.NewResponse(Content)
+		resp.SetOption(Observe, 1)
+		resp.SetOption(ContentFormat, TextPlain)
+		resp.SetPayload([]byte("0"))
+		w.WriteMsg(resp)
+	}
+
+	s := &Server{Handler: HandlerFunc(handler), MaxObserversPerClient: max}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	notifications := make([]chan *Request, max+1)
+	for i := range notifications {
+		ch := make(chan *Request, 4)
+		notifications[i] = ch
+		_, err := co.Observe("/obs", func(req *Request) {
+			ch <- req
+		})
+		require.NoError(t, err)
+		select {
+		case req := <-ch:
+			if i < max {
+				require.Equal(t, Content, req.Msg.Code())
+			} else {
+				require.Equal(t, ServiceUnavailable, req.Msg.Code())
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout of observe response %v", i)
+		}
+	}
+	require.Equal(t, max, s.ObserveRegistry().TotalObserverCount())
+	require.Equal(t, max, s.ObserveRegistry().ObserverCountByClient(co.LocalAddr()))
+
+	lock.Lock()
+	require.Len(t, subs, max)
+	for _, sub := range subs {
+		n := sub.client.NewMessage(MessageParams{
+			Type:      NonConfirmable,
+			Code:      Content,
+			MessageID: GenerateMessageID(),
+			Token:     sub.token,
+			Payload:   []byte("1"),
+		})
+		n.SetOption(Observe, 2)
+		n.SetOption(ContentFormat, TextPlain)
+		require.NoError(t, sub.client.WriteMsg(n))
+	}
+	lock.Unlock()
+
+	for i := 0; i < max; i++ {
+		select {
+		case req := <-notifications[i]:
+			require.Equal(t, []byte("1"), req.Msg.Payload())
+		case <-time.After(time.Second * 3):
+			t.Fatalf("timeout of notification %v", i)
+		}
+	}
+}
+
+func TestObserveRegistry(t *testing.T) {
+	var r ObserveRegistry
+	a := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	b := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2}
+	require.True(t, r.register(a, []byte{1}, 2))
+	require.True(t, r.register(a, []byte{2}, 2))
+	require.True(t, r.register(a, []byte{2}, 2))
+	require.False(t, r.register(a, []byte{3}, 2))
+	require.True(t, r.register(b, []byte{1}, 2))
+	require.Equal(t, 3, r.TotalObserverCount())
+	require.Equal(t, 2, r.ObserverCountByClient(a))
+
+	r.deregister(a, []byte{1})
+	require.True(t, r.register(a, []byte{3}, 2))
+	r.removeClient(a)
+	require.Equal(t, 0, r.ObserverCountByClient(a))
+	require.Equal(t, 1, r.TotalObserverCount())
+}
@@ -0,0 +1,188 @@
+package coap
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Option is CoAP option with its value, value is string, []byte, uint32 or MediaType.
+type Option = option
+
+// OptionBuilder builds options (RFC 7252 section 5.10) from typed values. Values are validated by Build.
+type OptionBuilder struct {
+	opts options
+	errs []error
+}
+
+// NewOptionBuilder creates empty builder.
+func NewOptionBuilder() *OptionBuilder {
+	return &OptionBuilder{}
+}
+
+func (b *OptionBuilder) add(id OptionID, v interface{}) *OptionBuilder {
+	b.opts = append(b.opts, option{ID: id, Value: v})
+	return b
+}
+
+func (b *OptionBuilder) addErr(format string, a ...interface{}) *OptionBuilder {
+	b.errs = append(b.errs, fmt.Errorf(format, a...))
+	return b
+}
+
+// IfMatch appends If-Match option.
+func (b *OptionBuilder) IfMatch(etag []byte) *OptionBuilder {
+	return b.add(IfMatch, etag)
+}
+
+// URIHost sets Uri-Host option.
+func (b *OptionBuilder) URIHost(host string) *OptionBuilder {
+	return b.add(URIHost, host)
+}
+
+// ETag appends ETag option.
+func (b *OptionBuilder) ETag(tag []byte) *OptionBuilder {
+	return b.add(ETag, tag)
+}
+
+// IfNoneMatch sets If-None-Match option.
+func (b *OptionBuilder) IfNoneMatch() *OptionBuilder {
+	return b.add(IfNoneMatch, []byte{})
+}
+
+// Observe sets Observe option, value must fit in 24 bits.
+func (b *OptionBuilder) Observe(n uint32) *OptionBuilder {
+	return b.add(Observe, n)
+}
+
+// URIPort sets Uri-Port option.
+func (b *OptionBuilder) URIPort(port uint16) *OptionBuilder {
+	return b.add(URIPort, uint32(port))
+}
+
+// LocationPath appends Location-Path segment.
+func (b *OptionBuilder) LocationPath(segment string) *OptionBuilder {
+	return b.add(LocationPath, segment)
+}
+
+// URIPath appends Uri-Path segment.
+func (b *OptionBuilder) URIPath(segment string) *OptionBuilder {
+	return b.add(URIPath, segment)
+}
+
+// ContentFormat sets Content-Format option.
+func (b *OptionBuilder) ContentFormat(cf MediaType) *OptionBuilder {
+	return b.add(ContentFormat, cf)
+}
+
+// MaxAge sets Max-Age option in seconds.
+func (b *OptionBuilder) MaxAge(secs uint32) *OptionBuilder {
+	return b.add(MaxAge, secs)
+}
+
+// URIQuery appends Uri-Query argument, eg. "k=v".
+func (b *OptionBuilder) URIQuery(kv string) *OptionBuilder {
+	return b.add(URIQuery, kv)
+}
+
+// Accept sets Accept option.
+func (b *OptionBuilder) Accept(cf MediaType) *OptionBuilder {
+	return b.add(Accept, cf)
+}
+
+// LocationQuery appends Location-Query argument.
+func (b *OptionBuilder) LocationQuery(kv string) *OptionBuilder {
+	return b.add(LocationQuery, kv)
+}
+
+func (b *OptionBuilder) block(id OptionID, num uint, more bool, szx BlockWiseSzx) *OptionBuilder {
+	v, err := MarshalBlockOption(szx, num, more)
+	if err != nil {
+		return b.addErr("invalid %v option: %v", optionName(id), err)
+	}
+	return b.add(id, v)
+}
+
+// Block2 sets Block2 option (RFC 7959).
+func (b *OptionBuilder) Block2(num uint, more bool, szx BlockWiseSzx) *OptionBuilder {
+	return b.block(Block2, num, more, szx)
+}
+
+// Block1 sets Block1 option (RFC 7959).
+func (b *OptionBuilder) Block1(num uint, more bool, szx BlockWiseSzx) *OptionBuilder {
+	return b.block(Block1, num, more, szx)
+}
+
+// Size2 sets Size2 option.
+func (b *OptionBuilder) Size2(size uint32) *OptionBuilder {
+	return b.add(Size2, size)
+}
+
+// ProxyURI sets Proxy-Uri option.
+func (b *OptionBuilder) ProxyURI(uri string) *OptionBuilder {
+	return b.add(ProxyURI, uri)
+}
+
+// ProxyScheme sets Proxy-Scheme option.
+func (b *OptionBuilder) ProxyScheme(scheme string) *OptionBuilder {
+	return b.add(ProxyScheme, scheme)
+}
+
+// Size1 sets Size1 option.
+func (b *OptionBuilder) Size1(size uint32) *OptionBuilder {
+	return b.add(Size1, size)
+}
+
+func optionName(id OptionID) string {
+	if n, ok := optionNames[id]; ok {
+		return n
+	}
+	return fmt.Sprintf("%d", id)
+}
+
+var repeatableOptions = map[OptionID]bool{
+	IfMatch:       true,
+	ETag:          true,
+	LocationPath:  true,
+	URIPath:       true,
+	URIQuery:      true,
+	LocationQuery: true,
+}
+
+func validateOption(o option) error {
+	def, ok := coapOptionDefs[o.ID]
+	if !ok {
+		return nil
+	}
+	l, err := o.toBytesLength()
+	if err != nil {
+		return err
+	}
+	if l < def.minLen || l > def.maxLen {
+		if def.minLen == def.maxLen {
+			return fmt.Errorf("invalid %v option: length %v must be %v", optionName(o.ID), l, def.maxLen)
+		}
+		return fmt.Errorf("invalid %v option: length %v is out of range %v-%v", optionName(o.ID), l, def.minLen, def.maxLen)
+	}
+	return nil
+}
+
+// Build validates options and returns them in canonical order, options with the same ID keep order of adding.
+func (b *OptionBuilder) Build() ([]Option, error) {
+	if len(b.errs) > 0 {
+		return nil, b.errs[0]
+	}
+	seen := make(map[OptionID]bool, len(b.opts))
+	for _, o := range b.opts {
+		if seen[o.ID] && !repeatableOptions[o.ID] {
+			return nil, fmt.Errorf("invalid %v option: option is not repeatable", optionName(o.ID))
+		}
+		seen[o.ID] = true
+		if err := validateOption(o); err != nil {
+			return nil, err
+		}
+	}
+	res := make(options, len(b.opts))
+	copy(res, b.opts)
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
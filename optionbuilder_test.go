@@ -0,0 +1,71 @@
+package coap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionBuilderBuild(t *testing.T) {
+	opts, err := NewOptionBuilder().
+		MaxAge(60).
+		URIPath("a").
+		ContentFormat(AppJSON).
+		URIQuery("k=v").
+		URIPath("b").
+		ETag([]byte{1, 2}).
+		Observe(0).
+		Block2(3, true, BlockWiseSzx64).
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, []Option{
+		{ID: ETag, Value: []byte{1, 2}},
+		{ID: Observe, Value: uint32(0)},
+		{ID: URIPath, Value: "a"},
+		{ID: URIPath, Value: "b"},
+		{ID: ContentFormat, Value: AppJSON},
+		{ID: MaxAge, Value: uint32(60)},
+		{ID: URIQuery, Value: "k=v"},
+		{ID: Block2, Value: uint32(3<<4 | 1<<3 | uint32(BlockWiseSzx64))},
+	}, opts)
+
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	for _, o := range opts {
+		msg.AddOption(o.ID, o.Value)
+	}
+	buf := &bytes.Buffer{}
+	err = msg.MarshalBinary(buf)
+	require.NoError(t, err)
+	parsed, err := ParseDgramMessage(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "a/b", parsed.PathString())
+	assert.Equal(t, AppJSON, parsed.Option(ContentFormat))
+	assert.Equal(t, uint32(60), parsed.Option(MaxAge))
+}
+
+func TestOptionBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *OptionBuilder
+		wantErr string
+	}{
+		{"long etag", NewOptionBuilder().ETag(make([]byte, 9)), "invalid ETag option: length 9 is out of range 1-8"},
+		{"empty etag", NewOptionBuilder().ETag(nil), "invalid ETag option: length 0 is out of range 1-8"},
+		{"observe over 24 bits", NewOptionBuilder().Observe(1 << 24), "invalid Observe option: length 4 is out of range 0-3"},
+		{"long path", NewOptionBuilder().URIPath(strings.Repeat("a", 256)), "invalid Uri-Path option: length 256 is out of range 0-255"},
+		{"empty host", NewOptionBuilder().URIHost(""), "invalid Uri-Host option: length 0 is out of range 1-255"},
+		{"block number", NewOptionBuilder().Block1(1<<20, false, BlockWiseSzx16), "invalid Block1 option: " + ErrBlockNumberExceedLimit.Error()},
+		{"block szx", NewOptionBuilder().Block2(0, false, BlockWiseSzxCount), "invalid Block2 option: " + ErrInvalidBlockWiseSzx.Error()},
+		{"repeated max-age", NewOptionBuilder().MaxAge(1).MaxAge(2), "invalid Max-Age option: option is not repeatable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.builder.Build()
+			require.Error(t, err)
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package coap
+
+import (
+	"fmt"
+)
+
+// ValidateOptionOrder checks that options of msg are in ascending order of option number as required
+// by RFC 7252 section 3.1. Messages parsed from wire are ordered by the delta encoding, messages
+// built by AddOption are ordered only when they are marshalled.
+func ValidateOptionOrder(msg Message) error {
+	opts := msg.AllOptions()
+	for i := 1; i < len(opts); i++ {
+		if opts[i].ID < opts[i-1].ID {
+			return fmt.Errorf("%w: option %v follows option %v", ErrOptionsNotOrdered, optionName(opts[i].ID), optionName(opts[i-1].ID))
+		}
+	}
+	return nil
+}
+
+// rejectUnorderedOptions answers request with options out of order by 4.00 Bad Request.
+func (srv *Server) rejectUnorderedOptions(w ResponseWriter, r *Request) bool {
+	if !srv.StrictOptionOrder || r.Msg.Code() == Empty || r.Msg.Code() >= Created {
+		return false
+	}
+	err := ValidateOptionOrder(r.Msg)
+	if err == nil {
+		return false
+	}
+	w.SetCode(BadRequest)
+	w.SetContentFormat(TextPlain)
+	w.Write([]byte(err.Error()))
+	return true
+}
@@ -0,0 +1,61 @@
+package coap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOptionOrder(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	msg.AddOption(URIPath, "a")
+	msg.AddOption(URIQuery, "q")
+	require.NoError(t, ValidateOptionOrder(msg))
+
+	// swapped order
+	msg = NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	msg.AddOption(URIQuery, "q")
+	msg.AddOption(URIPath, "a")
+	err := ValidateOptionOrder(msg)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrOptionsNotOrdered))
+	assert.Contains(t, err.Error(), "Uri-Path")
+
+	// marshalling sorts options
+	var buf bytes.Buffer
+	require.NoError(t, msg.MarshalBinary(&buf))
+	parsed, err := ParseDgramMessage(buf.Bytes())
+	require.NoError(t, err)
+	assert.NoError(t, ValidateOptionOrder(parsed))
+}
+
+type codeRecorder struct {
+	ResponseWriter
+	code    COAPCode
+	payload []byte
+}
+
+func (w *codeRecorder) SetCode(code COAPCode)                    { w.code = code }
+func (w *codeRecorder) SetContentFormat(contentFormat MediaType) {}
+func (w *codeRecorder) Write(p []byte) (int, error) {
+	w.payload = p
+	return len(p), nil
+}
+
+func TestServerStrictOptionOrder(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	msg.AddOption(URIQuery, "q")
+	msg.AddOption(URIPath, "a")
+	r := &Request{Msg: msg}
+
+	w := &codeRecorder{}
+	srv := &Server{}
+	assert.False(t, srv.rejectUnorderedOptions(w, r))
+	srv.StrictOptionOrder = true
+	assert.True(t, srv.rejectUnorderedOptions(w, r))
+	assert.Equal(t, BadRequest, w.code)
+	assert.Contains(t, string(w.payload), "Uri-Path")
+}
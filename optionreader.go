@@ -0,0 +1,179 @@
+package coap
+
+// OptionReader reads options of message (RFC 7252 section 5.10) as typed values. Values parsed
+// from wire and values set by AddOption as any of integer types, string or []byte are accepted,
+// values of other types are treated as missing option.
+type OptionReader struct {
+	msg Message
+}
+
+// ReadOptions creates reader of options of msg.
+func ReadOptions(msg Message) OptionReader {
+	return OptionReader{msg: msg}
+}
+
+func optionUint(v interface{}) (uint32, bool) {
+	switch i := v.(type) {
+	case uint32:
+		return i, true
+	case MediaType:
+		return uint32(i), true
+	case uint:
+		return uint32(i), true
+	case int:
+		return uint32(i), i >= 0
+	case int32:
+		return uint32(i), i >= 0
+	case uint16:
+		return uint32(i), true
+	case uint8:
+		return uint32(i), true
+	case []byte:
+		// value of option unknown to parser
+		if len(i) > 4 {
+			return 0, false
+		}
+		return decodeInt(i), true
+	}
+	return 0, false
+}
+
+func optionString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	}
+	return "", false
+}
+
+func optionOpaque(v interface{}) ([]byte, bool) {
+	switch b := v.(type) {
+	case []byte:
+		return b, true
+	case string:
+		return []byte(b), true
+	}
+	return nil, false
+}
+
+func (r OptionReader) uint(id OptionID) (uint32, bool) {
+	v := r.msg.Option(id)
+	if v == nil {
+		return 0, false
+	}
+	return optionUint(v)
+}
+
+func (r OptionReader) string(id OptionID) (string, bool) {
+	v := r.msg.Option(id)
+	if v == nil {
+		return "", false
+	}
+	return optionString(v)
+}
+
+func (r OptionReader) strings(id OptionID) ([]string, bool) {
+	var res []string
+	for _, v := range r.msg.Options(id) {
+		if s, ok := optionString(v); ok {
+			res = append(res, s)
+		}
+	}
+	return res, len(res) > 0
+}
+
+func (r OptionReader) opaques(id OptionID) ([][]byte, bool) {
+	var res [][]byte
+	for _, v := range r.msg.Options(id) {
+		if b, ok := optionOpaque(v); ok {
+			res = append(res, b)
+		}
+	}
+	return res, len(res) > 0
+}
+
+// IfMatch returns values of If-Match options, empty value matches any representation.
+func (r OptionReader) IfMatch() ([][]byte, bool) {
+	return r.opaques(IfMatch)
+}
+
+// URIHost returns Uri-Host option.
+func (r OptionReader) URIHost() (string, bool) {
+	return r.string(URIHost)
+}
+
+// ETag returns values of ETag options, response carries one and request may carry several.
+func (r OptionReader) ETag() ([][]byte, bool) {
+	return r.opaques(ETag)
+}
+
+// IfNoneMatch reports whether If-None-Match option is present.
+func (r OptionReader) IfNoneMatch() bool {
+	return r.msg.Option(IfNoneMatch) != nil
+}
+
+// Observe returns Observe option (RFC 7641), 0 registers and 1 deregisters observation in requests.
+func (r OptionReader) Observe() (uint32, bool) {
+	v, ok := r.uint(Observe)
+	return v, ok && v <= max3ByteNumber
+}
+
+// URIPort returns Uri-Port option.
+func (r OptionReader) URIPort() (uint16, bool) {
+	v, ok := r.uint(URIPort)
+	return uint16(v), ok && v <= 0xffff
+}
+
+// LocationPath returns segments of Location-Path options.
+func (r OptionReader) LocationPath() ([]string, bool) {
+	return r.strings(LocationPath)
+}
+
+// URIPath returns segments of Uri-Path options.
+func (r OptionReader) URIPath() ([]string, bool) {
+	return r.strings(URIPath)
+}
+
+// ContentFormat returns Content-Format option.
+func (r OptionReader) ContentFormat() (MediaType, bool) {
+	v, ok := r.uint(ContentFormat)
+	return MediaType(v), ok && v <= 0xffff
+}
+
+// MaxAge returns Max-Age option in seconds, response without it is fresh for 60 seconds.
+func (r OptionReader) MaxAge() (uint32, bool) {
+	return r.uint(MaxAge)
+}
+
+// URIQuery returns arguments of Uri-Query options.
+func (r OptionReader) URIQuery() ([]string, bool) {
+	return r.strings(URIQuery)
+}
+
+// Accept returns Accept option.
+func (r OptionReader) Accept() (MediaType, bool) {
+	v, ok := r.uint(Accept)
+	return MediaType(v), ok && v <= 0xffff
+}
+
+// LocationQuery returns arguments of Location-Query options.
+func (r OptionReader) LocationQuery() ([]string, bool) {
+	return r.strings(LocationQuery)
+}
+
+// ProxyURI returns Proxy-Uri option.
+func (r OptionReader) ProxyURI() (string, bool) {
+	return r.string(ProxyURI)
+}
+
+// ProxyScheme returns Proxy-Scheme option.
+func (r OptionReader) ProxyScheme() (string, bool) {
+	return r.string(ProxyScheme)
+}
+
+// Size1 returns Size1 option.
+func (r OptionReader) Size1() (uint32, bool) {
+	return r.uint(Size1)
+}
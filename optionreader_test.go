@@ -0,0 +1,127 @@
+package coap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wireMessage returns msg parsed from its serialisation, so options are decoded from wire.
+func wireMessage(t *testing.T, msg Message) Message {
+	var buf bytes.Buffer
+	require.NoError(t, msg.MarshalBinary(&buf))
+	parsed, err := ParseDgramMessage(buf.Bytes())
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestOptionReaderUints(t *testing.T) {
+	tests := []struct {
+		name string
+		id   OptionID
+		val  interface{}
+		read func(r OptionReader) (uint32, bool)
+	}{
+		{"Observe zero", Observe, uint32(0), OptionReader.Observe},
+		{"Observe max", Observe, uint32(0xffffff), OptionReader.Observe},
+		{"Uri-Port zero", URIPort, 0, func(r OptionReader) (uint32, bool) { v, ok := r.URIPort(); return uint32(v), ok }},
+		{"Uri-Port max", URIPort, uint(65535), func(r OptionReader) (uint32, bool) { v, ok := r.URIPort(); return uint32(v), ok }},
+		{"Content-Format zero", ContentFormat, TextPlain, func(r OptionReader) (uint32, bool) { v, ok := r.ContentFormat(); return uint32(v), ok }},
+		{"Content-Format max", ContentFormat, MediaType(65535), func(r OptionReader) (uint32, bool) { v, ok := r.ContentFormat(); return uint32(v), ok }},
+		{"Accept", Accept, AppCBOR, func(r OptionReader) (uint32, bool) { v, ok := r.Accept(); return uint32(v), ok }},
+		{"Max-Age zero", MaxAge, uint32(0), OptionReader.MaxAge},
+		{"Max-Age max", MaxAge, uint32(0xffffffff), OptionReader.MaxAge},
+		{"Size1 max", Size1, uint32(0xffffffff), OptionReader.Size1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+			_, ok := tt.read(ReadOptions(msg))
+			assert.False(t, ok)
+			msg.AddOption(tt.id, tt.val)
+			want, _ := optionUint(tt.val)
+			for _, m := range []Message{msg, wireMessage(t, msg)} {
+				v, ok := tt.read(ReadOptions(m))
+				assert.True(t, ok)
+				assert.Equal(t, want, v)
+			}
+		})
+	}
+}
+
+func TestOptionReaderOutOfRange(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	msg.AddOption(URIPort, 70000)
+	msg.AddOption(Observe, uint32(0x1000000))
+	msg.AddOption(MaxAge, "60")
+	_, ok := ReadOptions(msg).URIPort()
+	assert.False(t, ok)
+	_, ok = ReadOptions(msg).Observe()
+	assert.False(t, ok)
+	_, ok = ReadOptions(msg).MaxAge()
+	assert.False(t, ok)
+}
+
+func TestOptionReaderStrings(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	r := ReadOptions(msg)
+	_, ok := r.URIPath()
+	assert.False(t, ok)
+	_, ok = r.URIHost()
+	assert.False(t, ok)
+
+	msg.AddOption(URIHost, "example.com")
+	msg.AddOption(URIPath, []string{"a", "", "c"})
+	msg.AddOption(URIQuery, []string{"x=1", "y"})
+	msg.AddOption(LocationPath, []string{"new", "1"})
+	msg.AddOption(LocationQuery, "q")
+	msg.AddOption(ProxyScheme, "coap")
+	msg.AddOption(ProxyURI, string(bytes.Repeat([]byte("u"), 1034)))
+	for _, m := range []Message{msg, wireMessage(t, msg)} {
+		r := ReadOptions(m)
+		host, ok := r.URIHost()
+		assert.True(t, ok)
+		assert.Equal(t, "example.com", host)
+		path, ok := r.URIPath()
+		assert.True(t, ok)
+		assert.Equal(t, []string{"a", "", "c"}, path)
+		query, _ := r.URIQuery()
+		assert.Equal(t, []string{"x=1", "y"}, query)
+		loc, _ := r.LocationPath()
+		assert.Equal(t, []string{"new", "1"}, loc)
+		locQuery, _ := r.LocationQuery()
+		assert.Equal(t, []string{"q"}, locQuery)
+		scheme, _ := r.ProxyScheme()
+		assert.Equal(t, "coap", scheme)
+		uri, ok := r.ProxyURI()
+		assert.True(t, ok)
+		assert.Len(t, uri, 1034)
+	}
+}
+
+func TestOptionReaderOpaques(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: PUT, MessageID: 1})
+	r := ReadOptions(msg)
+	_, ok := r.ETag()
+	assert.False(t, ok)
+	assert.False(t, r.IfNoneMatch())
+
+	msg.AddOption(IfMatch, []byte{})
+	msg.AddOption(IfMatch, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	msg.AddOption(ETag, []byte{1})
+	msg.AddOption(ETag, []byte{2, 3})
+	msg.AddOption(IfNoneMatch, []byte{})
+	for _, m := range []Message{msg, wireMessage(t, msg)} {
+		r := ReadOptions(m)
+		ifMatch, ok := r.IfMatch()
+		assert.True(t, ok)
+		require.Len(t, ifMatch, 2)
+		assert.Len(t, ifMatch[0], 0)
+		assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, ifMatch[1])
+		etags, _ := r.ETag()
+		assert.Equal(t, [][]byte{{1}, {2, 3}}, etags)
+		assert.True(t, r.IfNoneMatch())
+	}
+}
@@ -0,0 +1,21 @@
+package coap
+
+// NewOriginFilterMiddleware allows only requests from browser based clients whose Origin option
+// is in allowed, "*" allows all origins. Other requests get 4.03 Forbidden. Requests without
+// Origin option are not sent by browser, so they are allowed.
+func NewOriginFilterMiddleware(allowed []string) MiddlewareFunc {
+	origins := make(map[string]bool, len(allowed))
+	for _, o := range allowed {
+		origins[o] = true
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			if origin, ok := r.Msg.Option(Origin).(string); ok && !origins["*"] && !origins[origin] {
+				w.SetCode(Forbidden)
+				w.Write(nil)
+				return
+			}
+			next.ServeCOAP(w, r)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package coap
+
+import (
+	"testing"
+)
+
+func TestOriginFilterMiddleware(t *testing.T) {
+	testOriginFilterMiddleware(t, []string{"https://a.example", "https://b.example"}, map[string]COAPCode{
+		"https://a.example": Content,
+		"https://b.example": Content,
+		"https://c.example": Forbidden,
+		"":                  Content,
+	})
+	testOriginFilterMiddleware(t, []string{"*"}, map[string]COAPCode{
+		"https://c.example": Content,
+	})
+}
+
+func testOriginFilterMiddleware(t *testing.T, allowed []string, expected map[string]COAPCode) {
+	resource := HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("resource"))
+	})
+	mux := NewServeMux()
+	mux.Handle("/r", NewOriginFilterMiddleware(allowed)(resource))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, mux.ServeCOAP)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("unable to dialing: %v", err)
+	}
+	defer co.Close()
+
+	for origin, code := range expected {
+		req, err := co.NewGetRequest("/r")
+		if err != nil {
+			t.Fatalf("cannot create request: %v", err)
+		}
+		if origin != "" {
+			req.SetOption(Origin, origin)
+		}
+		resp, err := co.Exchange(req)
+		if err != nil {
+			t.Fatalf("cannot get: %v", err)
+		}
+		if resp.Code() != code {
+			t.Fatalf("origin %q: expected %v, got %v", origin, code, resp.Code())
+		}
+	}
+}
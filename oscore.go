@@ -0,0 +1,315 @@
+package coap
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	oscoreVersion   = 1
+	oscoreAlgAESCCM = 10 // AES-CCM-16-64-128, the mandatory algorithm of OSCORE
+	oscoreKeyLen    = 16
+	oscoreTagLen    = 8
+	oscoreNonceLen  = 13
+	oscoreMaxIDLen  = oscoreNonceLen - 6
+	oscoreMaxPIVLen = 5
+	oscoreMaxSeq    = 1<<40 - 1
+
+	oscoreReplayWindowSize = 32
+	cborMajorText          = 3
+)
+
+// oscoreReplayWindow is sliding window of received sequence numbers (RFC 8613 section 7.4).
+type oscoreReplayWindow struct {
+	initialized bool
+	top         uint64
+	bitmap      uint32
+}
+
+func (w *oscoreReplayWindow) accepts(seq uint64) bool {
+	if !w.initialized || seq > w.top {
+		return true
+	}
+	d := w.top - seq
+	return d < oscoreReplayWindowSize && w.bitmap&(1<<d) == 0
+}
+
+func (w *oscoreReplayWindow) add(seq uint64) {
+	switch {
+	case !w.initialized:
+		w.initialized, w.top, w.bitmap = true, seq, 1
+	case seq > w.top:
+		if shift := seq - w.top; shift < oscoreReplayWindowSize {
+			w.bitmap <<= shift
+		} else {
+			w.bitmap = 0
+		}
+		w.top = seq
+		w.bitmap |= 1
+	default:
+		w.bitmap |= 1 << (w.top - seq)
+	}
+}
+
+// OSCOREContext is security context of OSCORE (RFC 8613) shared by two endpoints. Keys are derived
+// from master secret by HKDF-SHA256, messages are protected by AES-CCM-16-64-128.
+//
+// Multiple goroutines may invoke methods on a OSCOREContext simultaneously.
+type OSCOREContext struct {
+	senderID    []byte
+	recipientID []byte
+	idContext   []byte
+	commonIV    []byte
+	sender      cipher.AEAD
+	recipient   cipher.AEAD
+
+	lock      sync.Mutex
+	senderSeq uint64
+	replay    oscoreReplayWindow
+}
+
+// oscoreInfo encodes info of key derivation, CBOR array [id, id_context, alg_aead, type, L].
+func oscoreInfo(id, idContext []byte, typ string, l int) []byte {
+	b := appendCBORHead(nil, cborMajorArray, 5)
+	b = appendCBORHead(b, cborMajorBytes, uint64(len(id)))
+	b = append(b, id...)
+	if idContext == nil {
+		b = append(b, cborNull)
+	} else {
+		b = appendCBORHead(b, cborMajorBytes, uint64(len(idContext)))
+		b = append(b, idContext...)
+	}
+	b = appendCBORHead(b, cborMajorUint, oscoreAlgAESCCM)
+	b = appendCBORHead(b, cborMajorText, uint64(len(typ)))
+	b = append(b, typ...)
+	return appendCBORHead(b, cborMajorUint, uint64(l))
+}
+
+func oscoreDerive(masterSecret, masterSalt, id, idContext []byte, typ string, l int) ([]byte, error) {
+	out := make([]byte, l)
+	_, err := io.ReadFull(hkdf.New(sha256.New, masterSecret, masterSalt, oscoreInfo(id, idContext, typ, l)), out)
+	return out, err
+}
+
+// NewOSCOREContext derives security context of endpoint with senderID from master secret and master salt
+// (RFC 8613 section 3.2), peer uses the context with swapped IDs. IDs are up to 7 bytes long, idContext
+// is optional.
+func NewOSCOREContext(masterSecret, masterSalt, senderID, recipientID, idContext []byte) (*OSCOREContext, error) {
+	if len(senderID) > oscoreMaxIDLen || len(recipientID) > oscoreMaxIDLen {
+		return nil, ErrOSCOREInvalidContext
+	}
+	senderKey, err := oscoreDerive(masterSecret, masterSalt, senderID, idContext, "Key", oscoreKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	recipientKey, err := oscoreDerive(masterSecret, masterSalt, recipientID, idContext, "Key", oscoreKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	commonIV, err := oscoreDerive(masterSecret, masterSalt, []byte{}, idContext, "IV", oscoreNonceLen)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := newAESCCM(senderKey, oscoreTagLen, oscoreNonceLen)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := newAESCCM(recipientKey, oscoreTagLen, oscoreNonceLen)
+	if err != nil {
+		return nil, err
+	}
+	return &OSCOREContext{
+		senderID:    append([]byte{}, senderID...),
+		recipientID: append([]byte{}, recipientID...),
+		idContext:   idContext,
+		commonIV:    commonIV,
+		sender:      sender,
+		recipient:   recipient,
+	}, nil
+}
+
+// SenderID returns ID of this endpoint.
+func (c *OSCOREContext) SenderID() []byte {
+	return c.senderID
+}
+
+// RecipientID returns ID of peer.
+func (c *OSCOREContext) RecipientID() []byte {
+	return c.recipientID
+}
+
+// nextPIV returns Partial IV of the next message sent by this endpoint.
+func (c *OSCOREContext) nextPIV() ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.senderSeq > oscoreMaxSeq {
+		return nil, ErrOSCORESequenceExhausted
+	}
+	seq := c.senderSeq
+	c.senderSeq++
+	return encodePIV(seq), nil
+}
+
+// checkReplay reports whether message with piv from peer was not received yet, when record is set
+// the piv is recorded.
+func (c *OSCOREContext) checkReplay(piv []byte, record bool) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	seq := decodePIV(piv)
+	if !c.replay.accepts(seq) {
+		return false
+	}
+	if record {
+		c.replay.add(seq)
+	}
+	return true
+}
+
+// nonce computes AEAD nonce of piv generated by endpoint with id (RFC 8613 section 5.2).
+func (c *OSCOREContext) nonce(id, piv []byte) []byte {
+	n := make([]byte, oscoreNonceLen)
+	n[0] = byte(len(id))
+	copy(n[1+oscoreMaxIDLen-len(id):], id)
+	copy(n[oscoreNonceLen-len(piv):], piv)
+	xorBytes(n, n, c.commonIV)
+	return n
+}
+
+func encodePIV(seq uint64) []byte {
+	var b []byte
+	for seq > 0 {
+		b = append([]byte{byte(seq)}, b...)
+		seq >>= 8
+	}
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	return b
+}
+
+func decodePIV(piv []byte) uint64 {
+	var seq uint64
+	for _, b := range piv {
+		seq = seq<<8 | uint64(b)
+	}
+	return seq
+}
+
+// oscoreAAD encodes additional authenticated data, CBOR Enc_structure of COSE_Encrypt0 with
+// external_aad [oscore_version, [alg_aead], request_kid, request_piv, options] (RFC 8613 section 5.4).
+func oscoreAAD(requestKid, requestPIV []byte) []byte {
+	ext := appendCBORHead(nil, cborMajorArray, 5)
+	ext = appendCBORHead(ext, cborMajorUint, oscoreVersion)
+	ext = appendCBORHead(ext, cborMajorArray, 1)
+	ext = appendCBORHead(ext, cborMajorUint, oscoreAlgAESCCM)
+	ext = appendCBORHead(ext, cborMajorBytes, uint64(len(requestKid)))
+	ext = append(ext, requestKid...)
+	ext = appendCBORHead(ext, cborMajorBytes, uint64(len(requestPIV)))
+	ext = append(ext, requestPIV...)
+	// no Class I options
+	ext = appendCBORHead(ext, cborMajorBytes, 0)
+
+	b := appendCBORHead(nil, cborMajorArray, 3)
+	b = appendCBORHead(b, cborMajorText, uint64(len("Encrypt0")))
+	b = append(b, "Encrypt0"...)
+	b = appendCBORHead(b, cborMajorBytes, 0)
+	b = appendCBORHead(b, cborMajorBytes, uint64(len(ext)))
+	return append(b, ext...)
+}
+
+// oscoreOption is value of OSCORE option, compressed COSE object (RFC 8613 section 6.1).
+type oscoreOption struct {
+	piv        []byte
+	kidCtx     []byte // nil when absent
+	kid        []byte
+	kidPresent bool
+}
+
+func (o oscoreOption) marshal() []byte {
+	if len(o.piv) == 0 && o.kidCtx == nil && !o.kidPresent {
+		return []byte{}
+	}
+	b := []byte{byte(len(o.piv))}
+	b = append(b, o.piv...)
+	if o.kidCtx != nil {
+		b[0] |= 0x10
+		b = append(b, byte(len(o.kidCtx)))
+		b = append(b, o.kidCtx...)
+	}
+	if o.kidPresent {
+		b[0] |= 0x08
+		b = append(b, o.kid...)
+	}
+	return b
+}
+
+func parseOSCOREOption(b []byte) (oscoreOption, error) {
+	var o oscoreOption
+	if len(b) == 0 {
+		return o, nil
+	}
+	flags := b[0]
+	n := int(flags & 0x07)
+	if flags&0xe0 != 0 || n > oscoreMaxPIVLen || len(b) < 1+n {
+		return o, ErrOSCOREInvalidOption
+	}
+	o.piv = b[1 : 1+n]
+	b = b[1+n:]
+	if flags&0x10 != 0 {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return o, ErrOSCOREInvalidOption
+		}
+		o.kidCtx = b[1 : 1+int(b[0])]
+		b = b[1+int(b[0]):]
+	}
+	if flags&0x08 != 0 {
+		o.kidPresent = true
+		o.kid = b
+	} else if len(b) > 0 {
+		return o, ErrOSCOREInvalidOption
+	}
+	return o, nil
+}
+
+// OSCOREContextStore holds security contexts of peers by their sender IDs, server finds context
+// of request by kid of OSCORE option.
+type OSCOREContextStore struct {
+	lock     sync.Mutex
+	contexts map[string]*OSCOREContext
+}
+
+// NewOSCOREContextStore creates empty store.
+func NewOSCOREContextStore() *OSCOREContextStore {
+	return &OSCOREContextStore{contexts: make(map[string]*OSCOREContext)}
+}
+
+func oscoreStoreKey(kid, idContext []byte) string {
+	return hex.EncodeToString(idContext) + "/" + hex.EncodeToString(kid)
+}
+
+// Add adds ctx of peer with ctx.RecipientID, context with the same IDs is replaced.
+func (s *OSCOREContextStore) Add(ctx *OSCOREContext) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.contexts[oscoreStoreKey(ctx.recipientID, ctx.idContext)] = ctx
+}
+
+// Remove removes context of peer with kid.
+func (s *OSCOREContextStore) Remove(kid, idContext []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.contexts, oscoreStoreKey(kid, idContext))
+}
+
+// Get returns context of peer with kid.
+func (s *OSCOREContextStore) Get(kid, idContext []byte) (*OSCOREContext, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ctx, ok := s.contexts[oscoreStoreKey(kid, idContext)]
+	return ctx, ok
+}
@@ -0,0 +1,148 @@
+package coap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 8613 appendix C.1.1, client
+func newTestOSCOREContexts(t *testing.T) (client, server *OSCOREContext) {
+	secret := mustDecodeHex(t, "0102030405060708090a0b0c0d0e0f10")
+	salt := mustDecodeHex(t, "9e7ca92223786340")
+	client, err := NewOSCOREContext(secret, salt, []byte{}, []byte{0x01}, nil)
+	require.NoError(t, err)
+	server, err = NewOSCOREContext(secret, salt, []byte{0x01}, []byte{}, nil)
+	require.NoError(t, err)
+	return client, server
+}
+
+func TestOSCOREContextDerivation(t *testing.T) {
+	client, server := newTestOSCOREContexts(t)
+	assert.Equal(t, mustDecodeHex(t, "4622d4dd6d944168eefb54987c"), client.commonIV)
+	assert.Equal(t, client.commonIV, server.commonIV)
+
+	nonce := make([]byte, oscoreNonceLen)
+	plaintext := []byte("plaintext")
+	for key, aead := range map[string]interface{ Seal(_, _, _, _ []byte) []byte }{
+		"f0910ed7295e6ad4b54fc793154302ff": client.sender,
+		"ffb14e093c94c9cac9471648b4f98710": client.recipient,
+	} {
+		expected, err := newAESCCM(mustDecodeHex(t, key), oscoreTagLen, oscoreNonceLen)
+		require.NoError(t, err)
+		assert.Equal(t, expected.Seal(nil, nonce, plaintext, nil), aead.Seal(nil, nonce, plaintext, nil), key)
+	}
+
+	_, err := NewOSCOREContext([]byte{1}, nil, make([]byte, oscoreMaxIDLen+1), nil, nil)
+	assert.Equal(t, ErrOSCOREInvalidContext, err)
+}
+
+// RFC 8613 appendix C.4
+func TestOSCOREProtectRequest(t *testing.T) {
+	client, _ := newTestOSCOREContexts(t)
+	client.senderSeq = 20
+
+	assert.Equal(t, mustDecodeHex(t, "8368456e63727970743040488501810a40411440"), oscoreAAD([]byte{}, []byte{0x14}))
+	assert.Equal(t, mustDecodeHex(t, "4622d4dd6d944168eefb549868"), client.nonce([]byte{}, []byte{0x14}))
+
+	req := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 0x5d1f, Token: []byte{}})
+	req.SetOption(URIHost, "localhost")
+	req.SetPathString("/tv1")
+	plaintext, err := oscorePlaintext(req, true)
+	require.NoError(t, err)
+	assert.Equal(t, mustDecodeHex(t, "01b3747631"), plaintext)
+
+	protected, r, err := client.protectRequest(func(p MessageParams) Message { return NewDgramMessage(p) }, req)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x14}, r.piv)
+	assert.Equal(t, POST, protected.Code())
+	assert.Equal(t, "localhost", protected.Option(URIHost))
+	assert.Nil(t, protected.Option(URIPath))
+	assert.Equal(t, mustDecodeHex(t, "0914"), protected.Option(OSCORE))
+	assert.Equal(t, mustDecodeHex(t, "612f1092f1776f1c1668b3825e"), protected.Payload())
+}
+
+func TestOSCOREResponse(t *testing.T) {
+	client, server := newTestOSCOREContexts(t)
+	store := NewOSCOREContextStore()
+	store.Add(server)
+	newMessage := func(p MessageParams) Message { return NewDgramMessage(p) }
+
+	req := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1, Token: []byte{1}})
+	req.SetPathString("/a/b")
+	req.SetOption(Observe, uint32(0))
+	protected, r, err := client.protectRequest(newMessage, req)
+	require.NoError(t, err)
+	assert.Equal(t, FETCH, protected.Code())
+	assert.Equal(t, uint32(0), protected.Option(Observe))
+
+	inner, sr, code, err := unprotectRequest(newMessage, store, protected)
+	require.NoError(t, err)
+	assert.Equal(t, Empty, code)
+	assert.Equal(t, GET, inner.Code())
+	assert.Equal(t, "a/b", inner.PathString())
+	assert.Equal(t, uint32(0), inner.Option(Observe))
+
+	// replay
+	_, _, code, err = unprotectRequest(newMessage, store, protected)
+	assert.Equal(t, ErrOSCOREReplay, err)
+	assert.Equal(t, Unauthorized, code)
+
+	// notifications carry own Partial IV
+	for i := 0; i < 2; i++ {
+		resp := NewDgramMessage(MessageParams{Type: Confirmable, Code: Content, MessageID: uint16(2 + i), Token: []byte{1}, Payload: []byte("21.5")})
+		resp.SetOption(Observe, uint32(2+i))
+		resp.SetOption(ContentFormat, TextPlain)
+		presp, err := sr.protectResponse(newMessage, resp)
+		require.NoError(t, err)
+		assert.Equal(t, Content, presp.Code())
+		assert.Equal(t, uint32(2+i), presp.Option(Observe))
+		assert.Nil(t, presp.Option(ContentFormat))
+
+		uresp, err := r.unprotectResponse(newMessage, presp)
+		require.NoError(t, err)
+		assert.Equal(t, Content, uresp.Code())
+		assert.Equal(t, TextPlain, uresp.Option(ContentFormat))
+		assert.Equal(t, []byte("21.5"), uresp.Payload())
+	}
+
+	resp := NewDgramMessage(MessageParams{Type: Acknowledgement, Code: Content, MessageID: 1, Token: []byte{1}})
+	presp, err := sr.protectResponse(newMessage, resp)
+	require.NoError(t, err)
+	assert.Equal(t, Changed, presp.Code())
+	assert.Equal(t, []byte{}, presp.Option(OSCORE))
+	presp.Payload()[0] ^= 1
+	_, err = r.unprotectResponse(newMessage, presp)
+	assert.Equal(t, ErrOSCOREDecryptionFailed, err)
+}
+
+func TestOSCOREOption(t *testing.T) {
+	for _, o := range []oscoreOption{
+		{},
+		{piv: []byte{0x14}, kid: []byte{}, kidPresent: true},
+		{piv: []byte{1, 2, 3}, kidCtx: []byte{0x37, 0xcb}, kid: []byte{1}, kidPresent: true},
+		{piv: []byte{5}},
+	} {
+		parsed, err := parseOSCOREOption(o.marshal())
+		require.NoError(t, err)
+		assert.Equal(t, o.marshal(), parsed.marshal())
+		assert.Equal(t, o.kidPresent, parsed.kidPresent)
+	}
+	for _, v := range [][]byte{{0x06, 1, 2}, {0x20}, {0x11, 1, 5, 1}, {0x01, 1, 2}} {
+		_, err := parseOSCOREOption(v)
+		assert.Equal(t, ErrOSCOREInvalidOption, err, "%x", v)
+	}
+}
+
+func TestOSCOREReplayWindow(t *testing.T) {
+	var w oscoreReplayWindow
+	for _, seq := range []uint64{5, 3, 40, 20} {
+		require.True(t, w.accepts(seq), seq)
+		w.add(seq)
+		assert.False(t, w.accepts(seq), seq)
+	}
+	assert.False(t, w.accepts(5), "outside of window")
+	assert.True(t, w.accepts(30))
+	assert.True(t, w.accepts(41))
+}
@@ -0,0 +1,103 @@
+package coap
+
+import (
+	"context"
+	"io"
+)
+
+// OSCOREClientConn protects requests of ClientConn by OSCORE (RFC 8613) and unprotects responses,
+// so they pass proxies without exposing code, payload and most of options.
+type OSCOREClientConn struct {
+	co  *ClientConn
+	ctx *OSCOREContext
+}
+
+// NewOSCOREClientConn wraps co to protect messages by security context ctx.
+func NewOSCOREClientConn(co *ClientConn, ctx *OSCOREContext) *OSCOREClientConn {
+	return &OSCOREClientConn{co: co, ctx: ctx}
+}
+
+// ClientConn returns wrapped connection.
+func (c *OSCOREClientConn) ClientConn() *ClientConn {
+	return c.co
+}
+
+// Exchange sends protected request m and returns unprotected response.
+func (c *OSCOREClientConn) Exchange(m Message) (Message, error) {
+	return c.ExchangeWithContext(context.Background(), m)
+}
+
+// ExchangeWithContext sends protected request m with context and returns unprotected response.
+// Response which is not protected, eg. error of server which cannot verify the request, is
+// returned with ErrOSCOREUnprotected.
+func (c *OSCOREClientConn) ExchangeWithContext(ctx context.Context, m Message) (Message, error) {
+	req, r, err := c.ctx.protectRequest(c.co.NewMessage, m)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.co.ExchangeWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := r.unprotectResponse(c.co.NewMessage, resp)
+	if err == ErrOSCOREUnprotected {
+		return resp, err
+	}
+	return inner, err
+}
+
+// Get retrieves the resource identified by the request path
+func (c *OSCOREClientConn) Get(path string) (Message, error) {
+	return c.GetWithContext(context.Background(), path)
+}
+
+// GetWithContext retrieves with context the resource identified by the request path
+func (c *OSCOREClientConn) GetWithContext(ctx context.Context, path string) (Message, error) {
+	req, err := c.co.NewGetRequest(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExchangeWithContext(ctx, req)
+}
+
+// Post updates the resource identified by the request path
+func (c *OSCOREClientConn) Post(path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.PostWithContext(context.Background(), path, contentFormat, body)
+}
+
+// PostWithContext updates with context the resource identified by the request path
+func (c *OSCOREClientConn) PostWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	req, err := c.co.NewPostRequest(path, contentFormat, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExchangeWithContext(ctx, req)
+}
+
+// Put creates the resource identified by the request path
+func (c *OSCOREClientConn) Put(path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.PutWithContext(context.Background(), path, contentFormat, body)
+}
+
+// PutWithContext creates with context the resource identified by the request path
+func (c *OSCOREClientConn) PutWithContext(ctx context.Context, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	req, err := c.co.NewPutRequest(path, contentFormat, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExchangeWithContext(ctx, req)
+}
+
+// Delete deletes the resource identified by the request path
+func (c *OSCOREClientConn) Delete(path string) (Message, error) {
+	return c.DeleteWithContext(context.Background(), path)
+}
+
+// DeleteWithContext deletes with context the resource identified by the request path
+func (c *OSCOREClientConn) DeleteWithContext(ctx context.Context, path string) (Message, error) {
+	req, err := c.co.NewDeleteRequest(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExchangeWithContext(ctx, req)
+}
@@ -0,0 +1,215 @@
+package coap
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// oscoreOuterOptions are Class U options (RFC 8613 section 4.1), they stay readable by proxies.
+// Options of value true are also protected as Class E options in requests.
+var oscoreOuterOptions = map[OptionID]bool{
+	URIHost:     false,
+	URIPort:     false,
+	Observe:     true,
+	ProxyScheme: false,
+	Block1:      false,
+	Block2:      false,
+	Size1:       false,
+	Size2:       false,
+	NoResponse:  true,
+	OSCORE:      false,
+}
+
+// oscoreTransportOptions refer to protected message, not to the inner one.
+var oscoreTransportOptions = map[OptionID]bool{
+	Block1: true,
+	Block2: true,
+	Size1:  true,
+	Size2:  true,
+	OSCORE: true,
+}
+
+// oscoreInner reports whether option id of request or response is protected.
+func oscoreInner(id OptionID, request bool) bool {
+	alsoInner, outer := oscoreOuterOptions[id]
+	return !outer || alsoInner && request
+}
+
+// oscorePlaintext encodes code, protected options and payload of msg (RFC 8613 section 5.3).
+func oscorePlaintext(msg Message, request bool) ([]byte, error) {
+	if msg.Option(ProxyURI) != nil {
+		return nil, fmt.Errorf("%w: Proxy-Uri of OSCORE request, use Proxy-Scheme and Uri-Host", ErrNotSupported)
+	}
+	inner := NewDgramMessage(MessageParams{Code: msg.Code(), Payload: msg.Payload()})
+	for _, o := range msg.AllOptions() {
+		if oscoreInner(o.ID, request) {
+			inner.AddOption(o.ID, o.Value)
+		}
+	}
+	var buf bytes.Buffer
+	if err := inner.MarshalBinary(&buf); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	// code followed by options and payload, without the rest of header
+	return append([]byte{b[1]}, b[4:]...), nil
+}
+
+// parseOSCOREPlaintext decodes plaintext of oscorePlaintext.
+func parseOSCOREPlaintext(p []byte) (*DgramMessage, error) {
+	if len(p) == 0 {
+		return nil, ErrOSCOREDecryptionFailed
+	}
+	return ParseDgramMessage(append([]byte{0x40, p[0], 0, 0}, p[1:]...))
+}
+
+// oscoreOuter creates outer message of msg with unprotected options and ciphertext as payload.
+func oscoreOuter(newMessage func(MessageParams) Message, msg Message, code COAPCode, option []byte, ciphertext []byte) Message {
+	outer := newMessage(MessageParams{
+		Type:      msg.Type(),
+		Code:      code,
+		MessageID: msg.MessageID(),
+		Token:     msg.Token(),
+		Payload:   ciphertext,
+	})
+	for _, o := range msg.AllOptions() {
+		if _, ok := oscoreOuterOptions[o.ID]; ok && o.ID != OSCORE {
+			outer.AddOption(o.ID, o.Value)
+		}
+	}
+	outer.SetOption(OSCORE, option)
+	return outer
+}
+
+// oscoreInnerMessage creates message of outer message protected by OSCORE with decrypted inner message.
+func oscoreInnerMessage(newMessage func(MessageParams) Message, outer Message, inner *DgramMessage) Message {
+	msg := newMessage(MessageParams{
+		Type:      outer.Type(),
+		Code:      inner.Code(),
+		MessageID: outer.MessageID(),
+		Token:     outer.Token(),
+		Payload:   inner.Payload(),
+	})
+	innerIDs := make(map[OptionID]bool)
+	for _, o := range inner.AllOptions() {
+		innerIDs[o.ID] = true
+	}
+	for _, o := range outer.AllOptions() {
+		if !innerIDs[o.ID] && !oscoreTransportOptions[o.ID] {
+			msg.AddOption(o.ID, o.Value)
+		}
+	}
+	for _, o := range inner.AllOptions() {
+		msg.AddOption(o.ID, o.Value)
+	}
+	return msg
+}
+
+// oscoreRequest is request protected by security context.
+type oscoreRequest struct {
+	ctx *OSCOREContext
+	kid []byte // sender ID of client
+	piv []byte
+}
+
+// protectRequest protects req sent by client using security context c.
+func (c *OSCOREContext) protectRequest(newMessage func(MessageParams) Message, req Message) (Message, oscoreRequest, error) {
+	plaintext, err := oscorePlaintext(req, true)
+	if err != nil {
+		return nil, oscoreRequest{}, err
+	}
+	piv, err := c.nextPIV()
+	if err != nil {
+		return nil, oscoreRequest{}, err
+	}
+	r := oscoreRequest{ctx: c, kid: c.senderID, piv: piv}
+	ciphertext := c.sender.Seal(nil, c.nonce(c.senderID, piv), plaintext, oscoreAAD(r.kid, piv))
+	option := oscoreOption{piv: piv, kidCtx: c.idContext, kid: c.senderID, kidPresent: true}
+	code := POST
+	if req.Option(Observe) != nil {
+		code = FETCH
+	}
+	return oscoreOuter(newMessage, req, code, option.marshal(), ciphertext), r, nil
+}
+
+// unprotectRequest decrypts request protected by one of contexts of store, it returns response code
+// of failure.
+func unprotectRequest(newMessage func(MessageParams) Message, store *OSCOREContextStore, req Message) (Message, oscoreRequest, COAPCode, error) {
+	v, ok := req.Option(OSCORE).([]byte)
+	if !ok {
+		return nil, oscoreRequest{}, Unauthorized, ErrOSCOREUnprotected
+	}
+	o, err := parseOSCOREOption(v)
+	if err != nil || !o.kidPresent || len(o.piv) == 0 {
+		return nil, oscoreRequest{}, BadOption, ErrOSCOREInvalidOption
+	}
+	c, ok := store.Get(o.kid, o.kidCtx)
+	if !ok {
+		return nil, oscoreRequest{}, Unauthorized, ErrOSCOREContextNotFound
+	}
+	if !c.checkReplay(o.piv, false) {
+		return nil, oscoreRequest{}, Unauthorized, ErrOSCOREReplay
+	}
+	r := oscoreRequest{ctx: c, kid: o.kid, piv: o.piv}
+	plaintext, err := c.recipient.Open(nil, c.nonce(o.kid, o.piv), req.Payload(), oscoreAAD(o.kid, o.piv))
+	if err != nil {
+		return nil, r, BadRequest, ErrOSCOREDecryptionFailed
+	}
+	// replayed copy might have been decrypted concurrently
+	if !c.checkReplay(o.piv, true) {
+		return nil, r, Unauthorized, ErrOSCOREReplay
+	}
+	inner, err := parseOSCOREPlaintext(plaintext)
+	if err != nil {
+		return nil, r, BadRequest, ErrOSCOREDecryptionFailed
+	}
+	return oscoreInnerMessage(newMessage, req, inner), r, Empty, nil
+}
+
+// protectResponse protects resp to request r. Notifications of observation carry own Partial IV,
+// other responses use nonce of the request.
+func (r oscoreRequest) protectResponse(newMessage func(MessageParams) Message, resp Message) (Message, error) {
+	plaintext, err := oscorePlaintext(resp, false)
+	if err != nil {
+		return nil, err
+	}
+	var option oscoreOption
+	nonce := r.ctx.nonce(r.kid, r.piv)
+	code := Changed
+	if resp.Option(Observe) != nil {
+		code = Content
+		piv, err := r.ctx.nextPIV()
+		if err != nil {
+			return nil, err
+		}
+		option.piv = piv
+		nonce = r.ctx.nonce(r.ctx.senderID, piv)
+	}
+	ciphertext := r.ctx.sender.Seal(nil, nonce, plaintext, oscoreAAD(r.kid, r.piv))
+	return oscoreOuter(newMessage, resp, code, option.marshal(), ciphertext), nil
+}
+
+// unprotectResponse decrypts response to request r.
+func (r oscoreRequest) unprotectResponse(newMessage func(MessageParams) Message, resp Message) (Message, error) {
+	v, ok := resp.Option(OSCORE).([]byte)
+	if !ok {
+		return nil, ErrOSCOREUnprotected
+	}
+	o, err := parseOSCOREOption(v)
+	if err != nil {
+		return nil, err
+	}
+	nonce := r.ctx.nonce(r.kid, r.piv)
+	if len(o.piv) > 0 {
+		nonce = r.ctx.nonce(r.ctx.recipientID, o.piv)
+	}
+	plaintext, err := r.ctx.recipient.Open(nil, nonce, resp.Payload(), oscoreAAD(r.kid, r.piv))
+	if err != nil {
+		return nil, ErrOSCOREDecryptionFailed
+	}
+	inner, err := parseOSCOREPlaintext(plaintext)
+	if err != nil {
+		return nil, ErrOSCOREDecryptionFailed
+	}
+	return oscoreInnerMessage(newMessage, resp, inner), nil
+}
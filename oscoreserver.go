@@ -0,0 +1,110 @@
+package coap
+
+import (
+	"context"
+	"io"
+)
+
+type oscoreContextKey struct{}
+
+// OSCOREContextFromContext returns security context of request unprotected by OSCOREMiddleware.
+func OSCOREContextFromContext(ctx context.Context) (*OSCOREContext, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	c, ok := ctx.Value(oscoreContextKey{}).(*OSCOREContext)
+	return c, ok
+}
+
+// oscoreResponseWriter protects responses to request unprotected by OSCOREMiddleware.
+type oscoreResponseWriter struct {
+	ResponseWriter
+	req    *Request // unprotected request
+	oscore oscoreRequest
+}
+
+func (w *oscoreResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *oscoreResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.req.Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *oscoreResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *oscoreResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	switch msg.Code() {
+	case GET, POST, PUT, DELETE:
+		return ErrInvalidReponseCode
+	}
+	resp, err := w.oscore.protectResponse(w.req.Client.NewMessage, msg)
+	if err != nil {
+		return err
+	}
+	return w.ResponseWriter.WriteMsgWithContext(ctx, resp)
+}
+
+func (w *oscoreResponseWriter) WriteError(err error) {
+	writeError(w, err)
+}
+
+func (w *oscoreResponseWriter) WriteReader(rd io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return w.WriteReaderWithContext(context.Background(), rd, contentFormat, szx)
+}
+
+func (w *oscoreResponseWriter) WriteReaderWithContext(ctx context.Context, rd io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return writeReaderWhole(ctx, w, rd, contentFormat)
+}
+
+func (w *oscoreResponseWriter) getReq() *Request {
+	return w.req
+}
+
+// OSCOREMiddleware unprotects requests protected by OSCORE (RFC 8613) with security contexts
+// of store and protects responses of handler. Handler gets the security context via
+// OSCOREContextFromContext. Requests which aren't protected or cannot be verified get
+// unprotected 4.01 Unauthorized, 4.02 Bad Option or 4.00 Bad Request with diagnostic payload.
+func OSCOREMiddleware(store *OSCOREContextStore) MiddlewareFunc {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			msg, oscore, code, err := unprotectRequest(r.Client.NewMessage, store, r.Msg)
+			if err != nil {
+				// RFC 8613 section 8.2, error responses are not protected
+				resp := w.NewResponse(code)
+				resp.SetOption(ContentFormat, TextPlain)
+				resp.SetPayload([]byte(oscoreDiagnostic(err)))
+				w.WriteMsg(resp)
+				return
+			}
+			ctx := r.Ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req := &Request{
+				Msg:      msg,
+				Client:   r.Client,
+				Ctx:      context.WithValue(ctx, oscoreContextKey{}, oscore.ctx),
+				Sequence: r.Sequence,
+			}
+			next.ServeCOAP(&oscoreResponseWriter{ResponseWriter: w, req: req, oscore: oscore}, req)
+		})
+	}
+}
+
+// oscoreDiagnostic returns diagnostic payload of err (RFC 8613 section 8.2).
+func oscoreDiagnostic(err error) string {
+	switch err {
+	case ErrOSCOREContextNotFound:
+		return "Security context not found"
+	case ErrOSCOREReplay:
+		return "Replay detected"
+	case ErrOSCOREDecryptionFailed:
+		return "Decryption failed"
+	}
+	return err.Error()
+}
@@ -0,0 +1,87 @@
+package coap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOSCOREMiddleware(t *testing.T) {
+	clientCtx, serverCtx := newTestOSCOREContexts(t)
+	store := NewOSCOREContextStore()
+	store.Add(serverCtx)
+
+	mux := NewServeMux()
+	mux.HandleFunc("/a", func(w ResponseWriter, r *Request) {
+		c, ok := OSCOREContextFromContext(r.Ctx)
+		assert.True(t, ok)
+		assert.Equal(t, serverCtx, c)
+		switch r.Msg.Code() {
+		case GET:
+			w.SetContentFormat(TextPlain)
+			w.Write([]byte("hello"))
+		case PUT:
+			b, _ := ioutil.ReadAll(bytes.NewReader(r.Msg.Payload()))
+			w.SetContentFormat(TextPlain)
+			w.Write(b)
+		}
+	})
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, OSCOREMiddleware(store)(mux).ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+	oco := NewOSCOREClientConn(co, clientCtx)
+
+	resp, err := oco.Get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code())
+	assert.Equal(t, TextPlain, resp.Option(ContentFormat))
+	assert.Equal(t, []byte("hello"), resp.Payload())
+
+	resp, err = oco.Put("/a", TextPlain, bytes.NewReader([]byte("on")))
+	require.NoError(t, err)
+	assert.Equal(t, Created, resp.Code())
+	assert.Equal(t, []byte("on"), resp.Payload())
+
+	resp, err = oco.Get("/b")
+	require.NoError(t, err)
+	assert.Equal(t, NotFound, resp.Code())
+
+	// unprotected request
+	req, err := co.NewGetRequest("/a")
+	require.NoError(t, err)
+	resp, err = co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, Unauthorized, resp.Code())
+
+	// replayed request
+	req, err = co.NewGetRequest("/a")
+	require.NoError(t, err)
+	protected, _, err := clientCtx.protectRequest(co.NewMessage, req)
+	require.NoError(t, err)
+	resp, err = co.Exchange(protected)
+	require.NoError(t, err)
+	assert.Equal(t, Changed, resp.Code())
+	protected.SetMessageID(protected.MessageID() + 1)
+	resp, err = co.Exchange(protected)
+	require.NoError(t, err)
+	assert.Equal(t, Unauthorized, resp.Code())
+	assert.Equal(t, "Replay detected", string(resp.Payload()))
+
+	// unknown security context
+	store.Remove(serverCtx.RecipientID(), nil)
+	resp, err = oco.Get("/a")
+	assert.Equal(t, ErrOSCOREUnprotected, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, Unauthorized, resp.Code())
+	assert.Equal(t, "Security context not found", string(resp.Payload()))
+}
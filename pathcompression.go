@@ -0,0 +1,93 @@
+package coap
+
+import (
+	"strings"
+)
+
+// PathCompressionTable replaces known Uri-Path prefixes by their index in Prefixes, which is sent
+// in CompressedPath option together with Version. Both sides must use the same table, Version must
+// be changed whenever Prefixes are changed. Version is between 0 and 15.
+type PathCompressionTable struct {
+	Version  uint8
+	Prefixes []string // / separated paths, eg. "org/acme/device"
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+func hasPathPrefix(path, prefix []string) bool {
+	if len(prefix) == 0 || len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Compress replaces the longest prefix of msg path found in table by CompressedPath option.
+// Message with CompressedPath option or without known prefix is not changed.
+func (t PathCompressionTable) Compress(msg Message) {
+	if msg.Option(CompressedPath) != nil {
+		return
+	}
+	path := msg.Path()
+	best, bestLen := -1, 0
+	for i, p := range t.Prefixes {
+		prefix := splitPath(p)
+		if len(prefix) > bestLen && hasPathPrefix(path, prefix) {
+			best, bestLen = i, len(prefix)
+		}
+	}
+	if best < 0 {
+		return
+	}
+	msg.RemoveOption(URIPath)
+	if rest := path[bestLen:]; len(rest) > 0 {
+		msg.SetPath(rest)
+	}
+	msg.SetOption(CompressedPath, uint32(best)<<4|uint32(t.Version&0xf))
+}
+
+// Decompress expands CompressedPath option of msg back to Uri-Path options.
+func (t PathCompressionTable) Decompress(msg Message) error {
+	v, ok := msg.Option(CompressedPath).(uint32)
+	if !ok {
+		return nil
+	}
+	idx := int(v >> 4)
+	if uint8(v&0xf) != t.Version&0xf || idx >= len(t.Prefixes) {
+		return ErrInvalidCompressedPath
+	}
+	path := append(splitPath(t.Prefixes[idx]), msg.Path()...)
+	msg.RemoveOption(CompressedPath)
+	msg.SetPath(path)
+	return nil
+}
+
+// NewPathDecompressionMiddleware expands compressed paths of requests by table before next handler gets
+// them. Request with unknown version or prefix code gets 4.02 Bad Option.
+func NewPathDecompressionMiddleware(table PathCompressionTable) MiddlewareFunc {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			if r.Msg.Option(CompressedPath) == nil {
+				next.ServeCOAP(w, r)
+				return
+			}
+			msg := copyMessage(r.Client, r.Msg)
+			if err := table.Decompress(msg); err != nil {
+				w.SetCode(BadOption)
+				w.Write(nil)
+				return
+			}
+			next.ServeCOAP(w, &Request{Msg: msg, Client: r.Client, Ctx: r.Ctx, Sequence: r.Sequence})
+		})
+	}
+}
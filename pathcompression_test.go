@@ -0,0 +1,81 @@
+package coap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func marshalDgram(t *testing.T, msg Message) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, msg.MarshalBinary(&buf))
+	return buf.Bytes()
+}
+
+func TestPathCompressionTable(t *testing.T) {
+	table := PathCompressionTable{Version: 1, Prefixes: []string{"org/acme", "/org/acme/device/sensor"}}
+	path := "/org/acme/device/sensor/temperature/celsius"
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	empty := len(marshalDgram(t, msg))
+	msg.SetPathString(path)
+	uncompressed := len(marshalDgram(t, msg)) - empty
+	assert.True(t, uncompressed > 40)
+
+	table.Compress(msg)
+	assert.Equal(t, []string{"temperature", "celsius"}, msg.Path())
+	data := marshalDgram(t, msg)
+	compressed, err := ParseDgramMessage(data)
+	require.NoError(t, err)
+
+	// whole path is in table
+	full := PathCompressionTable{Version: 1, Prefixes: []string{path}}
+	short := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	short.SetPathString(path)
+	full.Compress(short)
+	assert.True(t, len(marshalDgram(t, short))-empty < 10)
+	require.NoError(t, full.Decompress(short))
+	assert.Equal(t, path, "/"+short.PathString())
+
+	require.NoError(t, table.Decompress(compressed))
+	assert.Equal(t, path, "/"+compressed.PathString())
+	assert.Nil(t, compressed.Option(CompressedPath))
+
+	// tables must match
+	msg.SetOption(CompressedPath, uint32(1)<<4|2)
+	assert.Equal(t, ErrInvalidCompressedPath, table.Decompress(msg))
+	msg.SetOption(CompressedPath, uint32(5)<<4|1)
+	assert.Equal(t, ErrInvalidCompressedPath, table.Decompress(msg))
+}
+
+func TestPathDecompressionMiddleware(t *testing.T) {
+	table := PathCompressionTable{Prefixes: []string{"org/acme/device"}}
+	handler := NewPathDecompressionMiddleware(table)(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(r.Msg.PathString()))
+	}))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, handler.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	req, err := co.NewGetRequest("/org/acme/device/sensor")
+	require.NoError(t, err)
+	table.Compress(req)
+	resp, err := co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, "org/acme/device/sensor", string(resp.Payload()))
+
+	req, err = co.NewGetRequest("/sensor")
+	require.NoError(t, err)
+	req.SetOption(CompressedPath, uint32(3)<<4)
+	resp, err = co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, BadOption, resp.Code())
+}
@@ -0,0 +1,357 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PersistentTCPClient reuses CoAP/TCP connections for subsequent requests to the
+// same address instead of dialing a new connection for every request.
+// When server releases connection with alternative addresses (RFC 8323 section 5.5),
+// next connections for the address are dialed to the alternatives in order and to the
+// address itself as the last one.
+//
+// Multiple goroutines may invoke methods on a PersistentTCPClient simultaneously.
+type PersistentTCPClient struct {
+	Client             Client        // template of client used for dialing, Net defaults to "tcp"
+	IdleTimeout        time.Duration // connection is closed when it was not used for IdleTimeout, 0 means never
+	MaxRequestsPerConn int           // connection is closed after it served MaxRequestsPerConn requests, 0 means unlimited
+
+	// DialFunc is used to create new connections, defaults to Client.DialWithContext.
+	DialFunc func(ctx context.Context, address string) (*ClientConn, error)
+
+	connsLock    sync.Mutex
+	conns        map[string]*persistentConn
+	retired      map[string]*ClientConn // the last retired connection per address
+	alternatives map[string][]string
+	dialing      map[string]*persistentDial // dials in progress per address
+}
+
+// persistentDial is dial in progress, err is set when done is closed.
+type persistentDial struct {
+	done     chan struct{}
+	err      error
+	canceled bool // context of dialing request was done
+}
+
+type persistentConn struct {
+	co       *ClientConn
+	address  string
+	requests int
+	inFlight map[string]Message // requests waiting for response, indexed by token
+	reserved int                // slots acquired for requests which are not created yet
+	retired  bool
+	lastUsed time.Time
+	idle     *time.Timer
+}
+
+// busy reports whether connection has in-flight or reserved requests.
+func (pc *persistentConn) busy() bool {
+	return pc.reserved > 0 || len(pc.inFlight) > 0
+}
+
+func (c *PersistentTCPClient) dial(ctx context.Context, address string) (*ClientConn, error) {
+	if c.DialFunc != nil {
+		return c.DialFunc(ctx, address)
+	}
+	client := c.Client
+	switch client.Net {
+	case "":
+		client.Net = "tcp"
+	case "tcp", "tcp4", "tcp6", "tcp-tls", "tcp4-tls", "tcp6-tls":
+	default:
+		return nil, ErrInvalidNetParameter
+	}
+	return client.DialWithContext(ctx, address)
+}
+
+// acquire returns connection for address and reserves slot for in-flight request.
+// Connection is dialed without holding connsLock, concurrent requests to the address wait
+// for the same dial, so slow address doesn't block requests to other ones.
+func (c *PersistentTCPClient) acquire(ctx context.Context, address string) (*persistentConn, error) {
+	for {
+		c.connsLock.Lock()
+		if c.conns == nil {
+			c.conns = make(map[string]*persistentConn)
+		}
+		pc := c.conns[address]
+		if pc != nil && pc.co.Released() {
+			c.retireLocked(pc)
+			if !pc.busy() {
+				pc.co.Close()
+			}
+			pc = nil
+		}
+		if pc != nil {
+			c.reserveLocked(pc)
+			c.connsLock.Unlock()
+			return pc, nil
+		}
+		if d, ok := c.dialing[address]; ok {
+			c.connsLock.Unlock()
+			select {
+			case <-d.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if d.err != nil && !d.canceled {
+				return nil, d.err
+			}
+			// connection is dialed or dial was canceled by its caller, check again
+			continue
+		}
+		d := &persistentDial{done: make(chan struct{})}
+		if c.dialing == nil {
+			c.dialing = make(map[string]*persistentDial)
+		}
+		c.dialing[address] = d
+		addresses := c.dialAddressesLocked(address)
+		c.connsLock.Unlock()
+
+		co, err := c.dialAny(ctx, addresses)
+
+		c.connsLock.Lock()
+		delete(c.dialing, address)
+		d.err, d.canceled = err, ctx.Err() != nil
+		close(d.done)
+		if err != nil {
+			c.connsLock.Unlock()
+			return nil, err
+		}
+		pc = &persistentConn{
+			co:       co,
+			address:  address,
+			inFlight: make(map[string]Message),
+		}
+		c.conns[address] = pc
+		c.reserveLocked(pc)
+		c.connsLock.Unlock()
+		return pc, nil
+	}
+}
+
+// reserveLocked reserves slot of pc for in-flight request.
+func (c *PersistentTCPClient) reserveLocked(pc *persistentConn) {
+	if pc.idle != nil {
+		pc.idle.Stop()
+		pc.idle = nil
+	}
+	pc.requests++
+	if c.MaxRequestsPerConn > 0 && pc.requests >= c.MaxRequestsPerConn {
+		c.retireLocked(pc)
+	}
+	pc.reserved++
+}
+
+// track moves reserved slot of pc to in-flight request req. CoAP over TCP has no message IDs,
+// responses are matched by token, so token of req must not be used by other in-flight request.
+func (c *PersistentTCPClient) track(pc *persistentConn, req Message) error {
+	c.connsLock.Lock()
+	defer c.connsLock.Unlock()
+	token := string(req.Token())
+	if _, ok := pc.inFlight[token]; ok {
+		return ErrTokenAlreadyExist
+	}
+	pc.reserved--
+	pc.inFlight[token] = req
+	return nil
+}
+
+// release unregisters in-flight request req, or reserved slot when req is nil, and closes
+// connection when it is not needed anymore.
+func (c *PersistentTCPClient) release(pc *persistentConn, req Message, err error) {
+	c.connsLock.Lock()
+	defer c.connsLock.Unlock()
+	if req == nil {
+		pc.reserved--
+	} else {
+		delete(pc.inFlight, string(req.Token()))
+	}
+	pc.lastUsed = time.Now()
+	if err != nil {
+		// connection can be broken - don't use it for next requests
+		c.retireLocked(pc)
+	}
+	if pc.busy() {
+		return
+	}
+	if pc.retired {
+		pc.co.Close()
+		return
+	}
+	if c.IdleTimeout > 0 {
+		pc.idle = time.AfterFunc(c.IdleTimeout, func() {
+			c.closeIdle(pc)
+		})
+	}
+}
+
+func (c *PersistentTCPClient) retireLocked(pc *persistentConn) {
+	if pc.retired {
+		return
+	}
+	pc.retired = true
+	if c.conns[pc.address] == pc {
+		delete(c.conns, pc.address)
+	}
+	if c.retired == nil {
+		c.retired = make(map[string]*ClientConn)
+	}
+	c.retired[pc.address] = pc.co
+}
+
+// dialAddressesLocked returns alternative addresses advertised for address and then address.
+// Alternatives are taken from Release of retired connection, which may be handled after it was retired.
+func (c *PersistentTCPClient) dialAddressesLocked(address string) []string {
+	if co, ok := c.retired[address]; ok {
+		if alts := co.AlternativeAddresses(); len(alts) > 0 {
+			if c.alternatives == nil {
+				c.alternatives = make(map[string][]string)
+			}
+			c.alternatives[address] = alts
+			delete(c.retired, address)
+		}
+	}
+	return append(append([]string(nil), c.alternatives[address]...), address)
+}
+
+// dialAny dials addresses in order and returns the first connection.
+func (c *PersistentTCPClient) dialAny(ctx context.Context, addresses []string) (*ClientConn, error) {
+	var err error
+	for _, a := range addresses {
+		var co *ClientConn
+		if co, err = c.dial(ctx, a); err == nil {
+			return co, nil
+		}
+	}
+	return nil, err
+}
+
+func (c *PersistentTCPClient) closeIdle(pc *persistentConn) {
+	c.connsLock.Lock()
+	defer c.connsLock.Unlock()
+	if pc.retired || pc.busy() || time.Since(pc.lastUsed) < c.IdleTimeout {
+		return
+	}
+	c.retireLocked(pc)
+	pc.co.Close()
+}
+
+func (c *PersistentTCPClient) do(ctx context.Context, address string, newReq func(co *ClientConn) (Message, error)) (Message, error) {
+	pc, err := c.acquire(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	req, err := newReq(pc.co)
+	if err == nil {
+		err = c.track(pc, req)
+	}
+	if err != nil {
+		c.release(pc, nil, nil)
+		return nil, err
+	}
+	resp, err := pc.co.ExchangeWithContext(ctx, req)
+	c.release(pc, req, err)
+	if err != nil {
+		return nil, err
+	}
+	return resp, responseError(resp)
+}
+
+// ExchangeWithContext sends request over persistent connection to address and waits for response.
+// The request must be created by NewTcpMessage.
+func (c *PersistentTCPClient) ExchangeWithContext(ctx context.Context, address string, req Message) (Message, error) {
+	return c.do(ctx, address, func(co *ClientConn) (Message, error) {
+		return req, nil
+	})
+}
+
+// Exchange same as ExchangeWithContext without context.
+func (c *PersistentTCPClient) Exchange(address string, req Message) (Message, error) {
+	return c.ExchangeWithContext(context.Background(), address, req)
+}
+
+// Get retrieves the resource identified by the request path.
+func (c *PersistentTCPClient) Get(address, path string) (Message, error) {
+	return c.GetWithContext(context.Background(), address, path)
+}
+
+// GetWithContext retrieves with context the resource identified by the request path.
+func (c *PersistentTCPClient) GetWithContext(ctx context.Context, address, path string) (Message, error) {
+	return c.do(ctx, address, func(co *ClientConn) (Message, error) {
+		return co.NewGetRequest(path)
+	})
+}
+
+// Post updates the resource identified by the request path.
+func (c *PersistentTCPClient) Post(address, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.PostWithContext(context.Background(), address, path, contentFormat, body)
+}
+
+// PostWithContext updates with context the resource identified by the request path.
+func (c *PersistentTCPClient) PostWithContext(ctx context.Context, address, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.do(ctx, address, func(co *ClientConn) (Message, error) {
+		return co.NewPostRequest(path, contentFormat, body)
+	})
+}
+
+// Put creates the resource identified by the request path.
+func (c *PersistentTCPClient) Put(address, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.PutWithContext(context.Background(), address, path, contentFormat, body)
+}
+
+// PutWithContext creates with context the resource identified by the request path.
+func (c *PersistentTCPClient) PutWithContext(ctx context.Context, address, path string, contentFormat MediaType, body io.Reader) (Message, error) {
+	return c.do(ctx, address, func(co *ClientConn) (Message, error) {
+		return co.NewPutRequest(path, contentFormat, body)
+	})
+}
+
+// Delete deletes the resource identified by the request path.
+func (c *PersistentTCPClient) Delete(address, path string) (Message, error) {
+	return c.DeleteWithContext(context.Background(), address, path)
+}
+
+// DeleteWithContext deletes with context the resource identified by the request path.
+func (c *PersistentTCPClient) DeleteWithContext(ctx context.Context, address, path string) (Message, error) {
+	return c.do(ctx, address, func(co *ClientConn) (Message, error) {
+		return co.NewDeleteRequest(path)
+	})
+}
+
+// InFlight returns count of requests waiting for response over connection to address.
+func (c *PersistentTCPClient) InFlight(address string) int {
+	c.connsLock.Lock()
+	defer c.connsLock.Unlock()
+	if pc, ok := c.conns[address]; ok {
+		return len(pc.inFlight)
+	}
+	return 0
+}
+
+// Close closes all idle connections. Connections with in-flight requests are closed
+// when the last request is finished.
+func (c *PersistentTCPClient) Close() error {
+	c.connsLock.Lock()
+	defer c.connsLock.Unlock()
+	var errs []string
+	for _, pc := range c.conns {
+		c.retireLocked(pc)
+		if pc.idle != nil {
+			pc.idle.Stop()
+		}
+		if !pc.busy() {
+			if err := pc.co.Close(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot close persistent connections: %v", strings.Join(errs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testPersistentTCPClient(t *testing.T, c *PersistentTCPClient, requests int) int32 {
+	s, addr, fin, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetCode(Valid)
+		w.Write(nil)
+	})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	defer c.Close()
+
+	var dials int32
+	c.DialFunc = func(ctx context.Context, address string) (*ClientConn, error) {
+		atomic.AddInt32(&dials, 1)
+		client := Client{Net: "tcp"}
+		return client.DialWithContext(ctx, address)
+	}
+
+	for i := 0; i < requests; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := c.GetWithContext(ctx, addr, "/test")
+		cancel()
+		if err != nil {
+			t.Fatalf("unable to get: %v", err)
+		}
+		if resp.Code() != Valid {
+			t.Fatalf("unexpected code: %v", resp.Code())
+		}
+	}
+	if c.InFlight(addr) != 0 {
+		t.Fatalf("unexpected in-flight requests: %v", c.InFlight(addr))
+	}
+	return atomic.LoadInt32(&dials)
+}
+
+func TestPersistentTCPClientReuseConnection(t *testing.T) {
+	dials := testPersistentTCPClient(t, &PersistentTCPClient{}, 100)
+	if dials != 1 {
+		t.Fatalf("expected 1 dial, got %v", dials)
+	}
+}
+
+func TestPersistentTCPClientMaxRequestsPerConn(t *testing.T) {
+	dials := testPersistentTCPClient(t, &PersistentTCPClient{MaxRequestsPerConn: 10}, 100)
+	if dials != 10 {
+		t.Fatalf("expected 10 dials, got %v", dials)
+	}
+}
+
+func TestPersistentTCPClientSlowDialDoesntBlockOtherAddresses(t *testing.T) {
+	s, addr, fin, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetCode(Valid)
+		w.Write(nil)
+	})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	const slow = "192.0.2.1:5683"
+	unblock := make(chan struct{})
+	var slowDials int32
+	c := &PersistentTCPClient{DialFunc: func(ctx context.Context, address string) (*ClientConn, error) {
+		if address == slow {
+			atomic.AddInt32(&slowDials, 1)
+			<-unblock
+			return nil, fmt.Errorf("unreachable")
+		}
+		client := Client{Net: "tcp"}
+		return client.DialWithContext(ctx, address)
+	}}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Get(slow, "/test"); err == nil {
+				t.Errorf("expected error of unreachable address")
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := c.GetWithContext(ctx, addr, "/test")
+	if err != nil {
+		t.Fatalf("unable to get while other address is dialed: %v", err)
+	}
+	if resp.Code() != Valid {
+		t.Fatalf("unexpected code: %v", resp.Code())
+	}
+	close(unblock)
+	wg.Wait()
+	if n := atomic.LoadInt32(&slowDials); n != 1 {
+		t.Fatalf("expected 1 dial of concurrent requests, got %v", n)
+	}
+}
+
+func TestPersistentTCPClientTracksRequestsByToken(t *testing.T) {
+	unblock := make(chan struct{})
+	s, addr, fin, err := RunLocalServerTCPWithHandler(":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		<-unblock
+		w.SetCode(Valid)
+		w.Write(nil)
+	})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	c := &PersistentTCPClient{}
+	defer c.Close()
+
+	newReq := func() Message {
+		return NewTcpMessage(MessageParams{Code: GET, Token: []byte("same")})
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Exchange(addr, newReq())
+		done <- err
+	}()
+	for i := 0; c.InFlight(addr) == 0; i++ {
+		if i > 100 {
+			t.Fatalf("request is not in flight")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if _, err := c.Exchange(addr, newReq()); err != ErrTokenAlreadyExist {
+		t.Fatalf("expected ErrTokenAlreadyExist, got %v", err)
+	}
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatalf("unable to exchange: %v", err)
+	}
+	if c.InFlight(addr) != 0 {
+		t.Fatalf("unexpected in-flight requests: %v", c.InFlight(addr))
+	}
+}
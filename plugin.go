@@ -0,0 +1,109 @@
+package coap
+
+import (
+	"context"
+	"sync"
+)
+
+// Plugin is optional module of server, eg. authorization or caching. Init installs
+// the plugin by API of server, eg. routes by ServeMux and middleware by Use, and
+// Shutdown uninstalls what it can, eg. routes by ServeMux.HandleRemove.
+type Plugin interface {
+	Name() string
+	Init(srv *Server) error
+	Shutdown(ctx context.Context) error
+}
+
+// pluginState holds plugins and middleware of server.
+type pluginState struct {
+	registerLock sync.Mutex // serializes registrations, so Init may use the server API
+
+	lock        sync.RWMutex
+	plugins     []Plugin
+	middlewares []MiddlewareFunc
+}
+
+// RegisterPlugin initializes p and adds it to active plugins, name of plugin must be unique.
+func (srv *Server) RegisterPlugin(p Plugin) error {
+	srv.plugins.registerLock.Lock()
+	defer srv.plugins.registerLock.Unlock()
+	for _, active := range srv.Plugins() {
+		if active.Name() == p.Name() {
+			return ErrPluginAlreadyRegistered
+		}
+	}
+	if err := p.Init(srv); err != nil {
+		return err
+	}
+	srv.plugins.lock.Lock()
+	defer srv.plugins.lock.Unlock()
+	srv.plugins.plugins = append(srv.plugins.plugins, p)
+	return nil
+}
+
+// UnregisterPlugin removes plugin of name from active plugins and shuts it down.
+func (srv *Server) UnregisterPlugin(ctx context.Context, name string) error {
+	srv.plugins.lock.Lock()
+	var p Plugin
+	for i, active := range srv.plugins.plugins {
+		if active.Name() == name {
+			p = active
+			srv.plugins.plugins = append(srv.plugins.plugins[:i:i], srv.plugins.plugins[i+1:]...)
+			break
+		}
+	}
+	srv.plugins.lock.Unlock()
+	if p == nil {
+		return ErrPluginNotRegistered
+	}
+	return p.Shutdown(ctx)
+}
+
+// Plugins returns active plugins in order of registration.
+func (srv *Server) Plugins() []Plugin {
+	srv.plugins.lock.RLock()
+	defer srv.plugins.lock.RUnlock()
+	return append([]Plugin(nil), srv.plugins.plugins...)
+}
+
+// shutdownPlugins shuts down all plugins, the last registered first. It returns the first error.
+func (srv *Server) shutdownPlugins(ctx context.Context) error {
+	srv.plugins.lock.Lock()
+	plugins := srv.plugins.plugins
+	srv.plugins.plugins = nil
+	srv.plugins.lock.Unlock()
+	var err error
+	for i := len(plugins) - 1; i >= 0; i-- {
+		if errShutdown := plugins[i].Shutdown(ctx); err == nil {
+			err = errShutdown
+		}
+	}
+	return err
+}
+
+// Use adds middleware applied to Handler of server, middleware added first is the outermost one.
+func (srv *Server) Use(mw MiddlewareFunc) {
+	srv.plugins.lock.Lock()
+	defer srv.plugins.lock.Unlock()
+	srv.plugins.middlewares = append(srv.plugins.middlewares, mw)
+}
+
+func (srv *Server) applyMiddlewares(h Handler) Handler {
+	srv.plugins.lock.RLock()
+	mws := srv.plugins.middlewares
+	srv.plugins.lock.RUnlock()
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// ServeMux returns Handler of server when it's ServeMux, DefaultServeMux when Handler is nil
+// and nil otherwise.
+func (srv *Server) ServeMux() *ServeMux {
+	if srv.Handler == nil {
+		return DefaultServeMux
+	}
+	mux, _ := srv.Handler.(*ServeMux)
+	return mux
+}
@@ -0,0 +1,85 @@
+package coap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type helloPlugin struct {
+	mux      *ServeMux
+	requests int32
+	shutdown int32
+}
+
+func (p *helloPlugin) Name() string { return "hello" }
+
+func (p *helloPlugin) Init(srv *Server) error {
+	p.mux = srv.ServeMux()
+	if p.mux == nil {
+		return errors.New("server doesn't use ServeMux")
+	}
+	srv.Use(func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			atomic.AddInt32(&p.requests, 1)
+			next.ServeCOAP(w, r)
+		})
+	})
+	return p.mux.Handle("/plugins/hello", HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("hello"))
+	}))
+}
+
+func (p *helloPlugin) Shutdown(ctx context.Context) error {
+	atomic.AddInt32(&p.shutdown, 1)
+	return p.mux.HandleRemove("/plugins/hello")
+}
+
+type failingPlugin struct{}
+
+func (failingPlugin) Name() string                       { return "failing" }
+func (failingPlugin) Init(srv *Server) error             { return errors.New("init failed") }
+func (failingPlugin) Shutdown(ctx context.Context) error { return nil }
+
+func TestServerPlugins(t *testing.T) {
+	s := &Server{Handler: NewServeMux()}
+	p := &helloPlugin{}
+	require.NoError(t, s.RegisterPlugin(p))
+	assert.Equal(t, ErrPluginAlreadyRegistered, s.RegisterPlugin(&helloPlugin{}))
+	assert.EqualError(t, s.RegisterPlugin(failingPlugin{}), "init failed")
+	assert.Equal(t, []Plugin{p}, s.Plugins())
+
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Get("/plugins/hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(resp.Payload()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&p.requests))
+
+	require.NoError(t, s.UnregisterPlugin(context.Background(), "hello"))
+	assert.Empty(t, s.Plugins())
+	assert.Equal(t, ErrPluginNotRegistered, s.UnregisterPlugin(context.Background(), "hello"))
+	_, err = co.Get("/plugins/hello")
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, NotFound, code)
+}
+
+func TestServerShutdownPlugins(t *testing.T) {
+	s := &Server{Handler: NewServeMux()}
+	p := &helloPlugin{}
+	require.NoError(t, s.RegisterPlugin(p))
+	_, shutdown := runLocalUDPServer(t, s)
+	shutdown()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&p.shutdown))
+	assert.Empty(t, s.Plugins())
+}
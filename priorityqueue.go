@@ -0,0 +1,145 @@
+package coap
+
+import (
+	"context"
+	"sync"
+)
+
+// MessagePriority returns message option which sets priority of the outbound message.
+// Messages with higher priority are written before messages with lower priority
+// when the outbound priority queue is enabled by OutboundPriorityLevels.
+func MessagePriority(p uint8) func(Message) {
+	return func(m Message) {
+		m.SetOption(Priority, uint32(p))
+	}
+}
+
+// messagePriority returns priority of message, the message isn't changed so every
+// retransmission of it has the same priority.
+func messagePriority(m Message) uint8 {
+	v, ok := m.Option(Priority).(uint32)
+	if !ok {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// withoutPriority returns message to be encoded: m when it has no Priority option, otherwise
+// copy of m without the internal option. Option is removed from message of other implementation.
+func withoutPriority(m Message) Message {
+	if m.Option(Priority) == nil {
+		return m
+	}
+	opts := make(options, 0, len(m.AllOptions()))
+	for _, o := range m.AllOptions() {
+		if o.ID != Priority {
+			opts = append(opts, o)
+		}
+	}
+	switch v := m.(type) {
+	case *DgramMessage:
+		c := *v
+		c.opts = opts
+		return &c
+	case *TcpMessage:
+		c := *v
+		c.opts = opts
+		return &c
+	}
+	m.RemoveOption(Priority)
+	return m
+}
+
+// priorityWriteQueue serializes writes to a connection. When the connection is busy,
+// writers wait in queue and the writer with the highest priority is served first.
+type priorityWriteQueue struct {
+	lock   sync.Mutex
+	busy   bool
+	levels [][]chan struct{}
+}
+
+func newPriorityWriteQueue(levels int) *priorityWriteQueue {
+	if levels <= 0 {
+		return nil
+	}
+	if levels > 256 {
+		levels = 256
+	}
+	return &priorityWriteQueue{
+		levels: make([][]chan struct{}, levels),
+	}
+}
+
+func (q *priorityWriteQueue) level(priority uint8) int {
+	return int(priority) * len(q.levels) / 256
+}
+
+func (q *priorityWriteQueue) acquire(ctx context.Context, priority uint8) error {
+	q.lock.Lock()
+	if !q.busy {
+		q.busy = true
+		q.lock.Unlock()
+		return nil
+	}
+	lvl := q.level(priority)
+	ch := make(chan struct{})
+	q.levels[lvl] = append(q.levels[lvl], ch)
+	q.lock.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		q.lock.Lock()
+		for i, c := range q.levels[lvl] {
+			if c == ch {
+				q.levels[lvl] = append(q.levels[lvl][:i], q.levels[lvl][i+1:]...)
+				q.lock.Unlock()
+				return ctx.Err()
+			}
+		}
+		q.lock.Unlock()
+		// queue was handed over to us in meantime
+		q.release()
+		return ctx.Err()
+	}
+}
+
+func (q *priorityWriteQueue) release() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for lvl := len(q.levels) - 1; lvl >= 0; lvl-- {
+		if len(q.levels[lvl]) > 0 {
+			ch := q.levels[lvl][0]
+			q.levels[lvl] = q.levels[lvl][1:]
+			close(ch)
+			return
+		}
+	}
+	q.busy = false
+}
+
+func (q *priorityWriteQueue) waiting() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	n := 0
+	for _, l := range q.levels {
+		n += len(l)
+	}
+	return n
+}
+
+// write invokes write when all writers with higher priority are served.
+func (q *priorityWriteQueue) write(ctx context.Context, priority uint8, write func() error) error {
+	if q == nil {
+		return write()
+	}
+	if err := q.acquire(ctx, priority); err != nil {
+		return err
+	}
+	defer q.release()
+	return write()
+}
@@ -0,0 +1,97 @@
+package coap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+)
+
+type recordingConnUDP struct {
+	lock    sync.Mutex
+	written []Message
+	entered chan struct{}
+	block   chan struct{}
+}
+
+func (c *recordingConnUDP) LocalAddr() net.Addr  { return &net.UDPAddr{} }
+func (c *recordingConnUDP) RemoteAddr() net.Addr { return &net.UDPAddr{} }
+func (c *recordingConnUDP) Close() error         { return nil }
+func (c *recordingConnUDP) ReadWithContext(ctx context.Context, buffer []byte) (int, *coapNet.ConnUDPContext, error) {
+	<-ctx.Done()
+	return 0, nil, ctx.Err()
+}
+
+func (c *recordingConnUDP) WriteWithContext(ctx context.Context, udpCtx *coapNet.ConnUDPContext, buffer []byte) error {
+	if c.block != nil {
+		close(c.entered)
+		<-c.block
+		c.block = nil
+	}
+	msg, err := ParseDgramMessage(append([]byte(nil), buffer...))
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.written = append(c.written, msg)
+	return nil
+}
+
+func TestPriorityQueueHighPriorityFirst(t *testing.T) {
+	conn := &recordingConnUDP{entered: make(chan struct{}), block: make(chan struct{})}
+	session, err := newSessionUDP(conn, &Server{OutboundPriorityLevels: 2}, coapNet.NewConnUDPContext(&net.UDPAddr{}, nil))
+	if err != nil {
+		t.Fatalf("cannot create session: %v", err)
+	}
+	s := session.(*sessionUDP)
+
+	send := func(wg *sync.WaitGroup, priority uint8, payload string) {
+		defer wg.Done()
+		msg := s.NewMessage(MessageParams{
+			Type:      NonConfirmable,
+			Code:      Content,
+			MessageID: GenerateMessageID(),
+			Payload:   []byte(payload),
+		})
+		MessagePriority(priority)(msg)
+		if err := s.WriteMsgWithContext(context.Background(), msg); err != nil {
+			t.Errorf("cannot write msg: %v", err)
+		}
+		// retransmission writes the same message again with its priority
+		if v := msg.Option(Priority); v != uint32(priority) {
+			t.Errorf("priority option of written message changed to %v", v)
+		}
+	}
+
+	var wg sync.WaitGroup
+	// first write blocks the connection so other writes are queued
+	wg.Add(1)
+	go send(&wg, 0, "blocker")
+	<-conn.entered
+	wg.Add(101)
+	for i := 0; i < 100; i++ {
+		go send(&wg, 0, "low")
+	}
+	go send(&wg, 255, "high")
+	for s.writeQueue.waiting() < 101 {
+		time.Sleep(time.Millisecond)
+	}
+	close(conn.block)
+	wg.Wait()
+
+	if len(conn.written) != 102 {
+		t.Fatalf("expected 102 messages, got %v", len(conn.written))
+	}
+	if string(conn.written[1].Payload()) != "high" {
+		t.Fatalf("expected high priority message to be written first")
+	}
+	for _, m := range conn.written {
+		if m.Option(Priority) != nil {
+			t.Fatalf("internal priority option was written to connection")
+		}
+	}
+}
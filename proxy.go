@@ -0,0 +1,434 @@
+package coap
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxiedOptions are options of downstream request replaced by target of forwarded request.
+var proxiedOptions = []OptionID{URIPath, URIQuery, ProxyURI, ProxyScheme}
+
+// proxyForwarder forwards requests to upstream connections and relays responses. Observation of
+// downstream client is mapped to observation of upstream, notifications are relayed to the client.
+type proxyForwarder struct {
+	lock         sync.Mutex
+	observations map[string]*Observation
+}
+
+func (f *proxyForwarder) cancelObservation(key string) {
+	f.lock.Lock()
+	o, ok := f.observations[key]
+	delete(f.observations, key)
+	f.lock.Unlock()
+	if ok {
+		o.Cancel()
+	}
+}
+
+// sessionEnded cancels upstream observations of downstream client c.
+func (f *proxyForwarder) sessionEnded(c *ClientConn) {
+	prefix := c.RemoteAddr().String() + "/"
+	f.lock.Lock()
+	var obs []*Observation
+	for k, o := range f.observations {
+		if strings.HasPrefix(k, prefix) {
+			obs = append(obs, o)
+			delete(f.observations, k)
+		}
+	}
+	f.lock.Unlock()
+	for _, o := range obs {
+		o.Cancel()
+	}
+}
+
+// close cancels all upstream observations.
+func (f *proxyForwarder) close() {
+	f.lock.Lock()
+	obs := f.observations
+	f.observations = nil
+	f.lock.Unlock()
+	for _, o := range obs {
+		o.Cancel()
+	}
+}
+
+// proxyErrorCode returns code of response to downstream client when upstream exchange with
+// context ctx fails by err. Exchange wraps error of context, so deadline is checked by ctx.
+func proxyErrorCode(ctx context.Context, err error) COAPCode {
+	if err == ErrTimeout || ctx.Err() == context.DeadlineExceeded {
+		return GatewayTimeout
+	}
+	return BadGateway
+}
+
+// forward sends request r to upstream for resource of path and query and relays the response to w.
+// Messages are created by sessions of their sides, so they are framed by transport of the side and
+// block-wise transfers are done by each side with own block size.
+func (f *proxyForwarder) forward(w ResponseWriter, r *Request, upstream *ClientConn, timeout time.Duration, path string, query []string) {
+	if r.Msg.Code() == GET {
+		if obs, ok := r.Msg.Option(Observe).(uint32); ok {
+			key := bridgeObservationKey(r.Client.RemoteAddr(), r.Msg.Token())
+			if obs == 0 {
+				f.observe(w, r, upstream, key, path, query)
+				return
+			}
+			f.cancelObservation(key)
+		}
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		w.SetCode(InternalServerError)
+		w.Write(nil)
+		return
+	}
+	req := upstream.NewMessage(MessageParams{
+		Type:      Confirmable,
+		Code:      r.Msg.Code(),
+		MessageID: GenerateMessageID(),
+		Token:     token,
+	})
+	copyForwardedOptions(req, r.Msg, proxiedOptions...)
+	req.SetPathString(path)
+	if len(query) > 0 {
+		req.SetQuery(query)
+	}
+	if len(r.Msg.Payload()) > 0 {
+		req.SetPayload(r.Msg.Payload())
+	}
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	resp, err := upstream.ExchangeWithContext(ctx, req)
+	if err != nil {
+		w.SetCode(proxyErrorCode(ctx, err))
+		w.Write(nil)
+		return
+	}
+	relay(w, resp)
+}
+
+func (f *proxyForwarder) observe(w ResponseWriter, r *Request, upstream *ClientConn, key, path string, query []string) {
+	f.cancelObservation(key)
+	ctx := context.Background()
+	o, err := upstream.ObserveWithContext(ctx, path, func(req *Request) {
+		if err := relay(w, req.Msg); err != nil {
+			f.cancelObservation(key)
+		}
+	}, func(m Message) {
+		copyForwardedOptions(m, r.Msg, proxiedOptions...)
+		if len(query) > 0 {
+			m.SetQuery(query)
+		}
+	})
+	if err != nil {
+		w.SetCode(proxyErrorCode(ctx, err))
+		w.Write(nil)
+		return
+	}
+	f.lock.Lock()
+	if f.observations == nil {
+		f.observations = make(map[string]*Observation)
+	}
+	f.observations[key] = o
+	f.lock.Unlock()
+}
+
+// isProxyRequest reports whether msg is request for forward proxy (RFC 7252 section 5.7.2).
+func isProxyRequest(msg Message) bool {
+	return msg.Option(ProxyURI) != nil || msg.Option(ProxyScheme) != nil
+}
+
+// proxyTarget is resource requested by Proxy-Uri or Proxy-Scheme option.
+type proxyTarget struct {
+	scheme string
+	addr   string
+	path   string
+	query  []string
+}
+
+// parseProxyTarget returns target of proxy request msg. The target given by Proxy-Uri is
+// returned with ErrProxySchemeNotSupported when its scheme is not supported.
+func parseProxyTarget(msg Message) (proxyTarget, error) {
+	if raw, ok := msg.Option(ProxyURI).(string); ok {
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() {
+			return proxyTarget{}, ErrInvalidProxyURI
+		}
+		if _, ok := schemeNets[strings.ToLower(u.Scheme)]; !ok {
+			return proxyTarget{}, ErrProxySchemeNotSupported
+		}
+		cu, err := ParseCoAPURI(raw)
+		if err != nil {
+			return proxyTarget{}, ErrInvalidProxyURI
+		}
+		t := proxyTarget{
+			scheme: cu.Scheme,
+			addr:   net.JoinHostPort(cu.Host, strconv.Itoa(cu.Addr.Port)),
+			path:   strings.Join(cu.Path, "/"),
+		}
+		if u.RawQuery != "" {
+			// keep order of arguments, url.Values doesn't
+			for _, q := range strings.Split(u.RawQuery, "&") {
+				v, err := url.QueryUnescape(q)
+				if err != nil {
+					return proxyTarget{}, ErrInvalidProxyURI
+				}
+				t.query = append(t.query, v)
+			}
+		}
+		return t, nil
+	}
+	scheme, _ := msg.Option(ProxyScheme).(string)
+	scheme = strings.ToLower(scheme)
+	if _, ok := schemeNets[scheme]; !ok {
+		return proxyTarget{}, ErrProxySchemeNotSupported
+	}
+	host, ok := msg.Option(URIHost).(string)
+	if !ok {
+		return proxyTarget{}, ErrInvalidProxyURI
+	}
+	port, _ := defaultPortOfScheme(scheme)
+	if p, ok := msg.Option(URIPort).(uint32); ok {
+		port = int(p)
+	}
+	return proxyTarget{
+		scheme: scheme,
+		addr:   net.JoinHostPort(host, strconv.Itoa(port)),
+		path:   msg.PathString(),
+		query:  msg.Query(),
+	}, nil
+}
+
+// ForwardProxy serves requests with Proxy-Uri or Proxy-Scheme option (RFC 7252 section 5.7.2) by
+// forwarding them to origin server of "coap", "coaps", "coap+tcp" or "coaps+tcp" URI and relays
+// responses back. Connections to origin servers are dialed by Client and reused. Observations are
+// proxied, block-wise transfers are reassembled by proxy and sent by blocks of the other side.
+// SessionEnded must be called from Server.NotifySessionEndFunc, so observations of clients which
+// are gone are cancelled.
+type ForwardProxy struct {
+	Client  Client        // template of client used for dialing, Net is set by scheme of URI
+	Timeout time.Duration // timeout of exchange with origin server, 0 means it's limited by context of request only
+
+	forwarder proxyForwarder
+	lock      sync.Mutex
+	conns     map[string]*ClientConn
+}
+
+// NewForwardProxy creates forward proxy which dials origin servers by default Client.
+func NewForwardProxy() *ForwardProxy {
+	return &ForwardProxy{conns: make(map[string]*ClientConn)}
+}
+
+// conn returns connection to origin server of scheme and addr, dialed one when there is none.
+func (p *ForwardProxy) conn(ctx context.Context, scheme, addr string) (*ClientConn, error) {
+	key := scheme + "://" + addr
+	p.lock.Lock()
+	co, ok := p.conns[key]
+	p.lock.Unlock()
+	if ok {
+		return co, nil
+	}
+
+	client := p.Client
+	client.Net = schemeNets[scheme]
+	notifySessionEnd := client.NotifySessionEndFunc
+	client.NotifySessionEndFunc = func(err error) {
+		p.lock.Lock()
+		if p.conns[key] == co {
+			delete(p.conns, key)
+		}
+		p.lock.Unlock()
+		if notifySessionEnd != nil {
+			notifySessionEnd(err)
+		}
+	}
+	dialed, err := client.DialWithContext(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if active, ok := p.conns[key]; ok {
+		// dialed concurrently
+		dialed.Close()
+		return active, nil
+	}
+	co = dialed
+	p.conns[key] = co
+	return co, nil
+}
+
+// ServeCOAP forwards proxy request to origin server, other requests get 4.04 Not Found. Request with
+// unsupported scheme gets 5.05 Proxying Not Supported, origin server which cannot be reached 5.02 Bad
+// Gateway and which doesn't respond in time 5.04 Gateway Timeout.
+func (p *ForwardProxy) ServeCOAP(w ResponseWriter, r *Request) {
+	if !isProxyRequest(r.Msg) {
+		w.SetCode(NotFound)
+		w.Write(nil)
+		return
+	}
+	t, err := parseProxyTarget(r.Msg)
+	switch err {
+	case nil:
+	case ErrProxySchemeNotSupported:
+		w.SetCode(ProxyingNotSupported)
+		w.Write(nil)
+		return
+	default:
+		w.SetCode(BadOption)
+		w.Write(nil)
+		return
+	}
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	co, err := p.conn(ctx, t.scheme, t.addr)
+	if err != nil {
+		w.SetCode(BadGateway)
+		w.Write(nil)
+		return
+	}
+	p.forwarder.forward(w, r, co, p.Timeout, t.path, t.query)
+}
+
+// Middleware forwards proxy requests and passes other requests to next, so server can be proxy
+// and origin server at once.
+func (p *ForwardProxy) Middleware(next Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if isProxyRequest(r.Msg) {
+			p.ServeCOAP(w, r)
+			return
+		}
+		next.ServeCOAP(w, r)
+	})
+}
+
+// SessionEnded cancels upstream observations of downstream client c, it has signature of
+// Server.NotifySessionEndFunc.
+func (p *ForwardProxy) SessionEnded(c *ClientConn, err error) {
+	p.forwarder.sessionEnded(c)
+}
+
+// Close cancels proxied observations and closes connections to origin servers.
+func (p *ForwardProxy) Close() error {
+	p.forwarder.close()
+	p.lock.Lock()
+	conns := p.conns
+	p.conns = make(map[string]*ClientConn)
+	p.lock.Unlock()
+	for _, co := range conns {
+		co.Close()
+	}
+	return nil
+}
+
+// reverseProxyRoute forwards requests of path prefix to upstream path.
+type reverseProxyRoute struct {
+	prefix       []string
+	upstream     *ClientConn
+	upstreamPath []string
+}
+
+// ReverseProxy forwards requests to upstream servers by path prefix, similar to httputil.ReverseProxy.
+// Clients don't know about proxy, the upstream servers are hidden behind its resources.
+// SessionEnded must be called from Server.NotifySessionEndFunc as by ForwardProxy.
+type ReverseProxy struct {
+	Timeout time.Duration // timeout of exchange with upstream server, 0 means it's limited by context of request only
+
+	forwarder proxyForwarder
+	lock      sync.RWMutex
+	routes    []reverseProxyRoute
+}
+
+// NewReverseProxy creates reverse proxy without routes.
+func NewReverseProxy() *ReverseProxy {
+	return &ReverseProxy{}
+}
+
+func splitProxyPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// Handle forwards requests of resources under path prefix to upstream, prefix is replaced by
+// upstreamPath, eg. "/sensors/temp" is forwarded as "/api/temp" by route of prefix "/sensors"
+// and upstreamPath "/api". The longest matching prefix wins.
+func (p *ReverseProxy) Handle(prefix string, upstream *ClientConn, upstreamPath string) {
+	route := reverseProxyRoute{prefix: splitProxyPath(prefix), upstream: upstream, upstreamPath: splitProxyPath(upstreamPath)}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, rt := range p.routes {
+		if strings.Join(rt.prefix, "/") == strings.Join(route.prefix, "/") {
+			p.routes[i] = route
+			return
+		}
+	}
+	p.routes = append(p.routes, route)
+}
+
+// match returns upstream and its path for request path.
+func (p *ReverseProxy) match(path []string) (*ClientConn, string, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	var match *reverseProxyRoute
+	for i, rt := range p.routes {
+		if len(rt.prefix) > len(path) || (match != nil && len(rt.prefix) <= len(match.prefix)) {
+			continue
+		}
+		matches := true
+		for j, s := range rt.prefix {
+			if path[j] != s {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			match = &p.routes[i]
+		}
+	}
+	if match == nil {
+		return nil, "", false
+	}
+	upstreamPath := append(append([]string(nil), match.upstreamPath...), path[len(match.prefix):]...)
+	return match.upstream, strings.Join(upstreamPath, "/"), true
+}
+
+// ServeCOAP forwards request to upstream of matching route, request without route gets 4.04 Not Found.
+func (p *ReverseProxy) ServeCOAP(w ResponseWriter, r *Request) {
+	upstream, path, ok := p.match(r.Msg.Path())
+	if !ok {
+		w.SetCode(NotFound)
+		w.Write(nil)
+		return
+	}
+	p.forwarder.forward(w, r, upstream, p.Timeout, path, r.Msg.Query())
+}
+
+// SessionEnded cancels upstream observations of downstream client c, it has signature of
+// Server.NotifySessionEndFunc.
+func (p *ReverseProxy) SessionEnded(c *ClientConn, err error) {
+	p.forwarder.sessionEnded(c)
+}
+
+// Close cancels proxied observations, upstream connections are left open.
+func (p *ReverseProxy) Close() error {
+	p.forwarder.close()
+	return nil
+}
@@ -0,0 +1,300 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testProxyOriginHandler(name string) HandlerFunc {
+	return func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		if r.Msg.PathString() == "big" {
+			w.Write(bytes.Repeat([]byte("x"), 3000))
+			return
+		}
+		w.Write([]byte(fmt.Sprintf("%v %v %v", name, r.Msg.PathString(), r.Msg.QueryString())))
+	}
+}
+
+func testLocalURI(t *testing.T, scheme, addr, path string) string {
+	_, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	return scheme + "://127.0.0.1:" + port + path
+}
+
+func proxyGet(t *testing.T, co *ClientConn, options ...func(Message)) (Message, error) {
+	req, err := co.NewGetRequest("")
+	require.NoError(t, err)
+	for _, o := range options {
+		o(req)
+	}
+	resp, err := co.Exchange(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, responseError(resp)
+}
+
+func TestForwardProxy(t *testing.T) {
+	udpOrigin, udpAddr, udpFin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx256, testProxyOriginHandler("udp"))
+	require.NoError(t, err)
+	defer func() {
+		udpOrigin.Shutdown()
+		<-udpFin
+	}()
+	tcpOrigin, tcpAddr, tcpFin, err := RunLocalServerTCPWithHandler("127.0.0.1:0", false, BlockWiseSzx1024, testProxyOriginHandler("tcp"))
+	require.NoError(t, err)
+	defer func() {
+		tcpOrigin.Shutdown()
+		<-tcpFin
+	}()
+
+	proxy := NewForwardProxy()
+	defer proxy.Close()
+	addr, shutdown := runLocalUDPServer(t, &Server{Handler: proxy.Middleware(testProxyOriginHandler("proxy"))})
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := proxyGet(t, co, func(m Message) {
+		m.SetOption(ProxyURI, testLocalURI(t, "coap", udpAddr, "/a/b?x=1&y=%2F"))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "udp a/b x=1&y=/", string(resp.Payload()))
+
+	resp, err = proxyGet(t, co, func(m Message) {
+		m.SetOption(ProxyURI, testLocalURI(t, "coap+tcp", tcpAddr, "/c"))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tcp c ", string(resp.Payload()))
+
+	_, port, err := net.SplitHostPort(udpAddr)
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	resp, err = proxyGet(t, co, func(m Message) {
+		m.SetOption(ProxyScheme, "coap")
+		m.SetOption(URIHost, "127.0.0.1")
+		m.SetOption(URIPort, uint32(p))
+		m.SetPathString("/d")
+		m.SetQueryString("q=1")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "udp d q=1", string(resp.Payload()))
+
+	// block-wise transfers of both sides
+	resp, err = proxyGet(t, co, func(m Message) {
+		m.SetOption(ProxyURI, testLocalURI(t, "coap", udpAddr, "/big"))
+	})
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("x"), 3000), resp.Payload())
+
+	_, err = proxyGet(t, co, func(m Message) {
+		m.SetOption(ProxyURI, "http://127.0.0.1/a")
+	})
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, ProxyingNotSupported, code)
+
+	_, err = proxyGet(t, co, func(m Message) {
+		m.SetOption(ProxyURI, "/relative")
+	})
+	code, ok = ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, BadOption, code)
+
+	// not proxy request is served by next
+	resp, err = co.Get("/e")
+	require.NoError(t, err)
+	assert.Equal(t, "proxy e ", string(resp.Payload()))
+}
+
+func TestForwardProxyGatewayTimeout(t *testing.T) {
+	release := make(chan struct{})
+	origin, originAddr, originFin, err := RunLocalServerTCPWithHandler("127.0.0.1:0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		<-release
+		w.SetCode(Content)
+		w.Write(nil)
+	})
+	require.NoError(t, err)
+	defer func() {
+		origin.Shutdown()
+		<-originFin
+	}()
+	defer close(release)
+
+	proxy := NewForwardProxy()
+	proxy.Timeout = time.Millisecond * 100
+	defer proxy.Close()
+	addr, shutdown := runLocalUDPServer(t, &Server{Handler: proxy})
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	_, err = proxyGet(t, co, func(m Message) {
+		m.SetOption(ProxyURI, testLocalURI(t, "coap+tcp", originAddr, "/slow"))
+	})
+	code, ok := ResponseCode(err)
+	require.True(t, ok, "%v", err)
+	assert.Equal(t, GatewayTimeout, code)
+}
+
+func TestForwardProxyObserve(t *testing.T) {
+	origin, originAddr, originFin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		if r.Msg.Option(Observe) == nil {
+			w.SetCode(BadRequest)
+			w.Write(nil)
+			return
+		}
+		go func() {
+			for i := 1; i <= 3; i++ {
+				resp := w.NewResponse(Content)
+				resp.SetOption(Observe, uint32(i+1))
+				resp.SetOption(ContentFormat, TextPlain)
+				resp.SetPayload([]byte(fmt.Sprintf("notification %v", i)))
+				if err := w.WriteMsg(resp); err != nil {
+					return
+				}
+				time.Sleep(time.Millisecond * 50)
+			}
+		}()
+	})
+	require.NoError(t, err)
+	defer func() {
+		origin.Shutdown()
+		<-originFin
+	}()
+
+	proxy := NewForwardProxy()
+	defer proxy.Close()
+	addr, shutdown := runLocalUDPServer(t, &Server{Handler: proxy})
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	notifications := make(chan string, 10)
+	o, err := co.ObserveWithContext(context.Background(), "", func(req *Request) {
+		notifications <- string(req.Msg.Payload())
+	}, func(m Message) {
+		m.SetOption(ProxyURI, testLocalURI(t, "coap", originAddr, "/obs"))
+	})
+	require.NoError(t, err)
+	defer o.Cancel()
+	for i := 1; i <= 3; i++ {
+		select {
+		case n := <-notifications:
+			assert.Equal(t, fmt.Sprintf("notification %v", i), n)
+		case <-time.After(time.Second * 3):
+			t.Fatalf("notification %v was not received", i)
+		}
+	}
+}
+
+func TestReverseProxy(t *testing.T) {
+	origin, originAddr, originFin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", true, BlockWiseSzx256, testProxyOriginHandler("origin"))
+	require.NoError(t, err)
+	defer func() {
+		origin.Shutdown()
+		<-originFin
+	}()
+	upstream, err := Dial("udp", originAddr)
+	require.NoError(t, err)
+	defer upstream.Close()
+
+	proxy := NewReverseProxy()
+	defer proxy.Close()
+	proxy.Handle("/sensors", upstream, "/api")
+	proxy.Handle("/sensors/special", upstream, "/")
+	addr, shutdown := runLocalUDPServer(t, &Server{Handler: proxy})
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	req, err := co.NewGetRequest("/sensors/temp")
+	require.NoError(t, err)
+	req.SetQueryString("unit=c")
+	resp, err := co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, "origin api/temp unit=c", string(resp.Payload()))
+
+	resp, err = co.Get("/sensors/special/a")
+	require.NoError(t, err)
+	assert.Equal(t, "origin a ", string(resp.Payload()))
+
+	resp, err = co.Get("/sensors/special/big")
+	require.NoError(t, err)
+	assert.Len(t, resp.Payload(), 3000)
+
+	_, err = co.Get("/sensorsx")
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, NotFound, code)
+}
+
+func TestReverseProxyCancelsObservationOfEndedSession(t *testing.T) {
+	origin, originAddr, originFin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		resp := w.NewResponse(Content)
+		resp.SetOption(Observe, uint32(2))
+		resp.SetOption(ContentFormat, TextPlain)
+		resp.SetPayload([]byte("notification"))
+		w.WriteMsg(resp)
+	})
+	require.NoError(t, err)
+	defer func() {
+		origin.Shutdown()
+		<-originFin
+	}()
+	upstream, err := Dial("udp", originAddr)
+	require.NoError(t, err)
+	defer upstream.Close()
+
+	proxy := NewReverseProxy()
+	defer proxy.Close()
+	proxy.Handle("/", upstream, "/")
+	l, err := coapNet.NewTCPListener("tcp", "127.0.0.1:0", time.Millisecond*100)
+	require.NoError(t, err)
+	srv := &Server{Listener: l, Handler: proxy, NotifySessionEndFunc: proxy.SessionEnded}
+	fin := make(chan error, 1)
+	go func() {
+		fin <- srv.ActivateAndServe()
+	}()
+	defer func() {
+		srv.Shutdown()
+		<-fin
+	}()
+
+	co, err := Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	notified := make(chan struct{}, 1)
+	_, err = co.Observe("/obs", func(req *Request) {
+		select {
+		case notified <- struct{}{}:
+		default:
+		}
+	})
+	require.NoError(t, err)
+	<-notified
+	observations := func() int {
+		proxy.forwarder.lock.Lock()
+		defer proxy.forwarder.lock.Unlock()
+		return len(proxy.forwarder.observations)
+	}
+	require.Equal(t, 1, observations())
+
+	// client is gone without deregistration
+	co.Close()
+	require.Eventually(t, func() bool { return observations() == 0 }, time.Second, time.Millisecond*10)
+}
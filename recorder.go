@@ -0,0 +1,172 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+)
+
+// Exchanger performs synchronous request/response exchange, it is implemented
+// by ClientConn, HedgingClient, Recorder and Playback.
+type Exchanger interface {
+	ExchangeWithContext(ctx context.Context, m Message) (Message, error)
+}
+
+// RecordedInteraction is request/response pair stored by Recorder.
+type RecordedInteraction struct {
+	Method   string `json:"method"`
+	URI      string `json:"uri"`
+	TCP      bool   `json:"tcp,omitempty"`
+	Response []byte `json:"response"` // response encoded by MarshalBinary
+}
+
+func interactionURI(m Message) string {
+	uri := "/" + m.PathString()
+	if q := m.QueryString(); q != "" {
+		uri += "?" + q
+	}
+	return uri
+}
+
+// Recorder wraps a client and records all request/response pairs,
+// so they can be replayed later by Playback.
+type Recorder struct {
+	inner Exchanger
+
+	lock         sync.Mutex
+	interactions []RecordedInteraction
+}
+
+// NewRecorder creates recorder over inner client.
+func NewRecorder(inner Exchanger) *Recorder {
+	return &Recorder{inner: inner}
+}
+
+// Exchange same as ExchangeWithContext without context.
+func (r *Recorder) Exchange(m Message) (Message, error) {
+	return r.ExchangeWithContext(context.Background(), m)
+}
+
+// ExchangeWithContext performs a synchronous query via inner client and records the response.
+func (r *Recorder) ExchangeWithContext(ctx context.Context, m Message) (Message, error) {
+	resp, err := r.inner.ExchangeWithContext(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, 256))
+	if err := resp.MarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	_, tcp := resp.(*TcpMessage)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.interactions = append(r.interactions, RecordedInteraction{
+		Method:   m.Code().String(),
+		URI:      interactionURI(m),
+		TCP:      tcp,
+		Response: buf.Bytes(),
+	})
+	return resp, nil
+}
+
+// Interactions returns copy of recorded interactions.
+func (r *Recorder) Interactions() []RecordedInteraction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]RecordedInteraction(nil), r.interactions...)
+}
+
+// Save stores recorded interactions to file as JSON.
+func (r *Recorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.Interactions(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Playback replays interactions recorded by Recorder. Requests are matched
+// by method and URI, interactions with same method and URI are replayed
+// in recorded order and the last one is repeated when they are exhausted.
+type Playback struct {
+	// Strict causes ExchangeWithContext to fail with ErrNoRecordedInteraction for unexpected requests,
+	// otherwise NotFound response is returned.
+	Strict bool
+
+	lock         sync.Mutex
+	interactions map[string][]RecordedInteraction
+}
+
+// PlaybackClient loads interactions saved by Recorder.Save. Returned playback is strict.
+func PlaybackClient(file string) (*Playback, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var interactions []RecordedInteraction
+	if err := json.Unmarshal(data, &interactions); err != nil {
+		return nil, err
+	}
+	return NewPlayback(interactions), nil
+}
+
+// NewPlayback creates strict playback from interactions.
+func NewPlayback(interactions []RecordedInteraction) *Playback {
+	p := &Playback{
+		Strict:       true,
+		interactions: make(map[string][]RecordedInteraction),
+	}
+	for _, i := range interactions {
+		key := i.Method + " " + i.URI
+		p.interactions[key] = append(p.interactions[key], i)
+	}
+	return p
+}
+
+func (p *Playback) next(m Message) (RecordedInteraction, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key := m.Code().String() + " " + interactionURI(m)
+	l := p.interactions[key]
+	if len(l) == 0 {
+		return RecordedInteraction{}, false
+	}
+	i := l[0]
+	if len(l) > 1 {
+		p.interactions[key] = l[1:]
+	}
+	return i, true
+}
+
+// Exchange same as ExchangeWithContext without context.
+func (p *Playback) Exchange(m Message) (Message, error) {
+	return p.ExchangeWithContext(context.Background(), m)
+}
+
+// ExchangeWithContext returns recorded response for the request.
+func (p *Playback) ExchangeWithContext(ctx context.Context, m Message) (Message, error) {
+	i, ok := p.next(m)
+	if !ok {
+		if p.Strict {
+			return nil, ErrNoRecordedInteraction
+		}
+		return NewDgramMessage(MessageParams{
+			Type:      Acknowledgement,
+			Code:      NotFound,
+			MessageID: m.MessageID(),
+			Token:     m.Token(),
+		}), nil
+	}
+	var resp Message = &DgramMessage{}
+	if i.TCP {
+		resp = &TcpMessage{}
+	}
+	if err := resp.UnmarshalBinary(i.Response); err != nil {
+		return nil, err
+	}
+	resp.SetToken(m.Token())
+	resp.SetMessageID(m.MessageID())
+	return resp, nil
+}
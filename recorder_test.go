@@ -0,0 +1,84 @@
+package coap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorderPlayback(t *testing.T) {
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(r.Msg.Code().String() + " " + r.Msg.PathString()))
+	})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("unable to dialing: %v", err)
+	}
+	defer co.Close()
+
+	newRequests := func() []Message {
+		a, _ := co.NewGetRequest("/a")
+		b, _ := co.NewGetRequest("/b")
+		c, _ := co.NewDeleteRequest("/a")
+		return []Message{a, b, c}
+	}
+
+	rec := NewRecorder(co)
+	var expected []string
+	for _, req := range newRequests() {
+		resp, err := rec.Exchange(req)
+		if err != nil {
+			t.Fatalf("unable to exchange: %v", err)
+		}
+		expected = append(expected, string(resp.Payload()))
+	}
+
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "interactions.json")
+	if err := rec.Save(file); err != nil {
+		t.Fatalf("unable to save: %v", err)
+	}
+
+	p, err := PlaybackClient(file)
+	if err != nil {
+		t.Fatalf("unable to load: %v", err)
+	}
+	for i, req := range newRequests() {
+		resp, err := p.Exchange(req)
+		if err != nil {
+			t.Fatalf("unable to replay: %v", err)
+		}
+		if string(resp.Payload()) != expected[i] {
+			t.Fatalf("expected %q, got %q", expected[i], resp.Payload())
+		}
+		if string(resp.Token()) != string(req.Token()) {
+			t.Fatalf("token of replayed response doesn't match request")
+		}
+	}
+
+	unexpected, _ := co.NewGetRequest("/c")
+	if _, err := p.Exchange(unexpected); err != ErrNoRecordedInteraction {
+		t.Fatalf("expected ErrNoRecordedInteraction, got %v", err)
+	}
+	p.Strict = false
+	resp, err := p.Exchange(unexpected)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Code() != NotFound {
+		t.Fatalf("expected NotFound, got %v", resp.Code())
+	}
+}
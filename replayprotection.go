@@ -0,0 +1,156 @@
+package coap
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultNonceStoreMaxPeers is count of peers kept by MemoryNonceStore by default.
+const DefaultNonceStoreMaxPeers = 10000
+
+// NonceStore keeps sequence numbers of requests seen from peers.
+type NonceStore interface {
+	// Accept records seq of peer and reports whether it wasn't seen before. Seq which is window
+	// or more below the highest seen one is rejected too.
+	Accept(peer string, seq uint32, window uint32) bool
+}
+
+// seqWindow holds bits of the last window sequence numbers, bit of seq is at seq % window.
+type seqWindow struct {
+	peer    string
+	highest uint32
+	bits    []uint64
+}
+
+func (w *seqWindow) bit(seq, window uint32) (word int, mask uint64) {
+	i := seq % window
+	return int(i / 64), 1 << (i % 64)
+}
+
+func (w *seqWindow) set(seq, window uint32) {
+	word, mask := w.bit(seq, window)
+	w.bits[word] |= mask
+}
+
+func (w *seqWindow) seen(seq, window uint32) bool {
+	word, mask := w.bit(seq, window)
+	return w.bits[word]&mask != 0
+}
+
+// clear clears bits of n sequence numbers from seq, n is less than window. Whole words are cleared
+// at once, so jump forward costs at most window/64 iterations.
+func (w *seqWindow) clear(seq, n, window uint32) {
+	i := seq % window
+	for n > 0 {
+		off := i % 64
+		chunk := 64 - off
+		if chunk > n {
+			chunk = n
+		}
+		if chunk > window-i {
+			chunk = window - i
+		}
+		mask := ^uint64(0)
+		if chunk < 64 {
+			mask = (1<<chunk - 1) << off
+		}
+		w.bits[i/64] &^= mask
+		n -= chunk
+		i = (i + chunk) % window
+	}
+}
+
+func (w *seqWindow) accept(seq, window uint32) bool {
+	if seq <= w.highest {
+		if w.highest-seq >= window || w.seen(seq, window) {
+			return false
+		}
+		w.set(seq, window)
+		return true
+	}
+	if seq-w.highest >= window {
+		for i := range w.bits {
+			w.bits[i] = 0
+		}
+	} else {
+		w.clear(w.highest+1, seq-w.highest-1, window)
+	}
+	w.set(seq, window)
+	w.highest = seq
+	return true
+}
+
+// MemoryNonceStore is NonceStore in memory, it holds bitset of window bits for every peer.
+// Up to MaxPeers peers are kept, the least recently seen one is evicted then and its next
+// request starts new window. So MaxPeers should exceed count of active peers, otherwise
+// requests of evicted peer can be replayed.
+type MemoryNonceStore struct {
+	// MaxPeers bounds count of kept peers, eg. when source addresses are spoofed. It must be set
+	// before the store is used, default is DefaultNonceStoreMaxPeers.
+	MaxPeers int
+
+	lock  sync.Mutex
+	peers map[string]*list.Element // of *seqWindow
+	lru   *list.List               // the most recently seen peer is at front
+}
+
+// NewMemoryNonceStore creates empty store.
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{peers: make(map[string]*list.Element), lru: list.New()}
+}
+
+func (s *MemoryNonceStore) maxPeers() int {
+	if s.MaxPeers > 0 {
+		return s.MaxPeers
+	}
+	return DefaultNonceStoreMaxPeers
+}
+
+// Accept implements NonceStore.
+func (s *MemoryNonceStore) Accept(peer string, seq uint32, window uint32) bool {
+	if window == 0 {
+		window = 1
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.peers[peer]; ok {
+		s.lru.MoveToFront(e)
+		w := e.Value.(*seqWindow)
+		if len(w.bits) == int((window+63)/64) {
+			return w.accept(seq, window)
+		}
+		s.lru.Remove(e)
+		delete(s.peers, peer)
+	}
+	for s.lru.Len() >= s.maxPeers() {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.peers, oldest.Value.(*seqWindow).peer)
+	}
+	w := &seqWindow{peer: peer, highest: seq, bits: make([]uint64, (window+63)/64)}
+	w.set(seq, window)
+	s.peers[peer] = s.lru.PushFront(w)
+	return true
+}
+
+// ReplayProtectionMiddleware rejects requests whose RequestSeqNum option was seen from the peer
+// already, or is window or more below the highest seen one, by 4.03 Forbidden. Requests without
+// the option get 4.00 Bad Request.
+func ReplayProtectionMiddleware(store NonceStore, window uint32) MiddlewareFunc {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			seq, ok := r.Msg.Option(RequestSeqNum).(uint32)
+			if !ok {
+				w.SetCode(BadRequest)
+				w.Write(nil)
+				return
+			}
+			if !store.Accept(r.Client.RemoteAddr().String(), seq, window) {
+				w.SetCode(Forbidden)
+				w.Write(nil)
+				return
+			}
+			next.ServeCOAP(w, r)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package coap
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	s := NewMemoryNonceStore()
+	for _, seq := range []uint32{5, 7, 6, 3, 100} {
+		assert.True(t, s.Accept("a", seq, 64), "seq %v", seq)
+	}
+	for _, seq := range []uint32{5, 6, 7, 100, 36} {
+		assert.False(t, s.Accept("a", seq, 64), "seq %v", seq)
+	}
+	// 37 is in window and seen bit of 37-64 was cleared
+	assert.True(t, s.Accept("a", 37, 64))
+	assert.True(t, s.Accept("b", 5, 64))
+	// jump over window clears everything
+	assert.True(t, s.Accept("a", 1000, 64))
+	assert.True(t, s.Accept("a", 999, 64))
+	assert.False(t, s.Accept("a", 936, 64))
+}
+
+func TestMemoryNonceStoreEvictsLeastRecentlySeenPeer(t *testing.T) {
+	s := NewMemoryNonceStore()
+	s.MaxPeers = 2
+	assert.True(t, s.Accept("a", 1, 64))
+	assert.True(t, s.Accept("b", 1, 64))
+	assert.False(t, s.Accept("a", 1, 64))
+	// b is evicted, a was seen more recently
+	assert.True(t, s.Accept("c", 1, 64))
+	assert.Equal(t, 2, s.lru.Len())
+	assert.False(t, s.Accept("a", 1, 64))
+	assert.True(t, s.Accept("b", 1, 64))
+}
+
+func TestSeqWindowClearMatchesBitByBit(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, window := range []uint32{1, 63, 64, 65, 100, 128, 1000} {
+		words := (window + 63) / 64
+		for i := 0; i < 100; i++ {
+			w := seqWindow{bits: make([]uint64, words)}
+			expected := seqWindow{bits: make([]uint64, words)}
+			for j := range w.bits {
+				w.bits[j] = r.Uint64()
+				expected.bits[j] = w.bits[j]
+			}
+			// accept clears numbers above highest one, they never wrap around
+			seq, n := r.Uint32()/2, uint32(r.Intn(int(window)))
+			w.clear(seq, n, window)
+			for k := uint32(0); k < n; k++ {
+				word, mask := expected.bit(seq+k, window)
+				expected.bits[word] &^= mask
+			}
+			require.Equal(t, expected.bits, w.bits, "window %v, seq %v, n %v", window, seq, n)
+		}
+	}
+}
+
+func TestReplayProtectionMiddleware(t *testing.T) {
+	handler := ReplayProtectionMiddleware(NewMemoryNonceStore(), 32)(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetCode(Changed)
+		w.Write(nil)
+	}))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, handler.ServeCOAP)
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	co, err := (&Client{}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	post := func(seq uint32) COAPCode {
+		req, err := co.NewPostRequest("/door/unlock", TextPlain, bytes.NewReader(nil))
+		require.NoError(t, err)
+		req.SetOption(RequestSeqNum, seq)
+		resp, err := co.Exchange(req)
+		require.NoError(t, err)
+		return resp.Code()
+	}
+	for _, seq := range []uint32{1, 2, 3} {
+		assert.Equal(t, Changed, post(seq))
+	}
+	assert.Equal(t, Forbidden, post(2))
+	assert.Equal(t, Changed, post(4))
+
+	_, err = co.Post("/door/unlock", TextPlain, bytes.NewReader(nil))
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, BadRequest, code)
+}
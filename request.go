@@ -7,4 +7,8 @@ type Request struct {
 	Client *ClientConn
 	Ctx    context.Context
 	Sequence uint64 // discontinuously growing number for every request from connection starts from 0
+
+	// message and read buffer borrowed from Server.MessagePool
+	pooledMsg *DgramMessage
+	pooledBuf *[]byte
 }
@@ -0,0 +1,61 @@
+package coap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+type requestIDKey struct{}
+
+// NewRequestID creates request ID from seconds of current time mod 2^32 in upper 4 bytes
+// and random lower 4 bytes.
+func NewRequestID() (uint64, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return uint64(uint32(time.Now().Unix()))<<32 | uint64(binary.BigEndian.Uint32(b[:])), nil
+}
+
+// TraceableToken encodes request ID as 8-byte token, so request can be traced across services
+// without custom option while the token still correlates responses.
+func TraceableToken(requestID uint64) []byte {
+	token := make([]byte, MaxTokenSize)
+	binary.BigEndian.PutUint64(token, requestID)
+	return token
+}
+
+// RequestIDFromToken extracts request ID encoded by TraceableToken, it's 0 when token is not 8 bytes long.
+func RequestIDFromToken(token []byte) uint64 {
+	if len(token) != MaxTokenSize {
+		return 0
+	}
+	return binary.BigEndian.Uint64(token)
+}
+
+// RequestIDFromContext returns request ID set by RequestIDMiddleware, 0 when there is none.
+func RequestIDFromContext(ctx context.Context) uint64 {
+	if ctx == nil {
+		return 0
+	}
+	id, _ := ctx.Value(requestIDKey{}).(uint64)
+	return id
+}
+
+// RequestIDMiddleware extracts request ID from token of request, handler gets it by RequestIDFromContext.
+func RequestIDMiddleware(next Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		ctx := r.Ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		next.ServeCOAP(w, &Request{
+			Msg:      r.Msg,
+			Client:   r.Client,
+			Ctx:      context.WithValue(ctx, requestIDKey{}, RequestIDFromToken(r.Msg.Token())),
+			Sequence: r.Sequence,
+		})
+	})
+}
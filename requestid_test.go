@@ -0,0 +1,48 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceableToken(t *testing.T) {
+	id, err := NewRequestID()
+	require.NoError(t, err)
+	assert.InDelta(t, uint32(time.Now().Unix()), uint32(id>>32), 1)
+	token := TraceableToken(id)
+	assert.Len(t, token, MaxTokenSize)
+	assert.Equal(t, id, RequestIDFromToken(token))
+	assert.Equal(t, uint64(0), RequestIDFromToken([]byte{1, 2}))
+	assert.Equal(t, uint64(0), RequestIDFromContext(context.Background()))
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	logs := make(chan string, 1)
+	s := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		logs <- fmt.Sprintf("request %016x %v", RequestIDFromContext(r.Ctx), r.Msg.PathString())
+		w.SetCode(Content)
+		w.Write(nil)
+	})}
+	s.Use(RequestIDMiddleware)
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	id, err := NewRequestID()
+	require.NoError(t, err)
+	req, err := co.NewGetRequest("/a")
+	require.NoError(t, err)
+	req.SetToken(TraceableToken(id))
+	resp, err := co.Exchange(req)
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code())
+	assert.Equal(t, TraceableToken(id), resp.Token())
+	assert.Equal(t, fmt.Sprintf("request %016x a", id), <-logs)
+}
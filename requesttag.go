@@ -0,0 +1,29 @@
+package coap
+
+import "bytes"
+
+// RequestTag returns value of Request-Tag option (RFC 9175), ok is false when option is absent.
+func RequestTag(msg Message) ([]byte, bool) {
+	v := msg.Option(RequestTagOption)
+	if v == nil {
+		return nil, false
+	}
+	tag, _ := v.([]byte)
+	return tag, true
+}
+
+// SetRequestTag sets Request-Tag option (RFC 9175). Block-wise transfer keeps the option
+// in all blocks, so blocks can't be spliced with blocks of another transfer.
+func SetRequestTag(msg Message, tag []byte) {
+	if tag == nil {
+		tag = []byte{}
+	}
+	msg.SetOption(RequestTagOption, tag)
+}
+
+// sameRequestTag reports whether block belongs to the same transfer as the first block by Request-Tag.
+func sameRequestTag(first, block Message) bool {
+	a, aok := RequestTag(first)
+	b, bok := RequestTag(block)
+	return aok == bok && bytes.Equal(a, b)
+}
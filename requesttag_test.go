@@ -0,0 +1,113 @@
+package coap
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func runRequestTagServer(t *testing.T, received chan<- []byte) (string, func()) {
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", true, BlockWiseSzx16, func(w ResponseWriter, r *Request) {
+		received <- r.Msg.Payload()
+		w.SetCode(Changed)
+		w.Write(nil)
+	})
+	require.NoError(t, err)
+	return addr, func() {
+		s.Shutdown()
+		<-fin
+	}
+}
+
+func TestRequestTagInterleavedTransfers(t *testing.T) {
+	received := make(chan []byte, 2)
+	addr, shutdown := runRequestTagServer(t, received)
+	defer shutdown()
+
+	szx := BlockWiseSzx16
+	blockWise := true
+	c := Client{Net: "udp", BlockWiseTransfer: &blockWise, BlockWiseTransferSzx: &szx}
+	co, err := c.Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	payloads := [][]byte{bytes.Repeat([]byte{'a'}, 100), bytes.Repeat([]byte{'b'}, 100)}
+	var wg sync.WaitGroup
+	for i, p := range payloads {
+		wg.Add(1)
+		go func(tag byte, p []byte) {
+			defer wg.Done()
+			req, err := co.NewPutRequest("/a", TextPlain, bytes.NewReader(p))
+			require.NoError(t, err)
+			SetRequestTag(req, []byte{tag})
+			resp, err := co.Exchange(req)
+			require.NoError(t, err)
+			require.Equal(t, Changed, resp.Code())
+		}(byte(i), p)
+	}
+	wg.Wait()
+	for i := 0; i < len(payloads); i++ {
+		p := <-received
+		require.True(t, bytes.Equal(p, payloads[0]) || bytes.Equal(p, payloads[1]), "spliced payload %q", p)
+	}
+}
+
+func TestRequestTagSplicedBlockRejected(t *testing.T) {
+	received := make(chan []byte, 1)
+	addr, shutdown := runRequestTagServer(t, received)
+	defer shutdown()
+
+	conn, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	exchange := func(num uint, tag []byte) Message {
+		block, err := MarshalBlockOption(BlockWiseSzx16, num, true)
+		require.NoError(t, err)
+		req := NewDgramMessage(MessageParams{
+			Type:      Confirmable,
+			Code:      PUT,
+			MessageID: GenerateMessageID(),
+			Token:     []byte{1, 2, 3, 4},
+			Payload:   bytes.Repeat([]byte{'x'}, 16),
+		})
+		req.SetPathString("/a")
+		req.SetOption(Block1, block)
+		if tag != nil {
+			SetRequestTag(req, tag)
+		}
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, req.MarshalBinary(buf))
+		_, err = conn.Write(buf.Bytes())
+		require.NoError(t, err)
+
+		conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+		b := make([]byte, 1500)
+		n, err := conn.Read(b)
+		require.NoError(t, err)
+		resp, err := ParseDgramMessage(b[:n])
+		require.NoError(t, err)
+		require.Equal(t, req.MessageID(), resp.MessageID())
+		return resp
+	}
+
+	resp := exchange(0, []byte{0xA})
+	require.Equal(t, Continue, resp.Code())
+	resp = exchange(1, []byte{0xB})
+	require.Equal(t, BadRequest, resp.Code())
+
+	resp = exchange(0, []byte{0xA})
+	require.Equal(t, Continue, resp.Code())
+	resp = exchange(1, nil)
+	require.Equal(t, BadRequest, resp.Code())
+
+	select {
+	case p := <-received:
+		t.Fatalf("handler was called with spliced payload %q", p)
+	default:
+	}
+}
@@ -0,0 +1,156 @@
+package coap
+
+import (
+	"context"
+	"sync"
+)
+
+type resourceLock struct {
+	readers        int
+	writer         bool
+	waiters        int
+	writersWaiting int
+	changed        chan struct{}
+}
+
+func (l *resourceLock) idle() bool {
+	return l.readers == 0 && !l.writer && l.waiters == 0
+}
+
+// ResourceMutex is reader/writer lock of resources identified by path. Waiting for the lock
+// can be cancelled by context. Waiting writers take precedence over new readers.
+type ResourceMutex struct {
+	lock      sync.Mutex
+	resources map[string]*resourceLock
+}
+
+// NewResourceMutex creates lock of resources.
+func NewResourceMutex() *ResourceMutex {
+	return &ResourceMutex{resources: make(map[string]*resourceLock)}
+}
+
+func (m *ResourceMutex) resource(path string) *resourceLock {
+	if m.resources == nil {
+		m.resources = make(map[string]*resourceLock)
+	}
+	l, ok := m.resources[path]
+	if !ok {
+		l = &resourceLock{changed: make(chan struct{})}
+		m.resources[path] = l
+	}
+	return l
+}
+
+func (m *ResourceMutex) acquire(ctx context.Context, path string, write bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for {
+		l := m.resource(path)
+		if write && !l.writer && l.readers == 0 {
+			l.writer = true
+			return nil
+		}
+		if !write && !l.writer && l.writersWaiting == 0 {
+			l.readers++
+			return nil
+		}
+		changed := l.changed
+		l.waiters++
+		if write {
+			l.writersWaiting++
+		}
+		m.lock.Unlock()
+		var err error
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		m.lock.Lock()
+		l.waiters--
+		if write {
+			l.writersWaiting--
+		}
+		if err != nil {
+			m.release(path, l)
+			return err
+		}
+	}
+}
+
+// release wakes up waiters of resource and forgets the resource when nobody uses it.
+func (m *ResourceMutex) release(path string, l *resourceLock) {
+	close(l.changed)
+	l.changed = make(chan struct{})
+	if l.idle() {
+		delete(m.resources, path)
+	}
+}
+
+// Lock acquires write lock of path, it waits until the lock is released by other holders or ctx is done.
+func (m *ResourceMutex) Lock(ctx context.Context, path string) (unlock func(), err error) {
+	if err := m.acquire(ctx, path, true); err != nil {
+		return nil, err
+	}
+	return func() { m.Unlock(path) }, nil
+}
+
+// Unlock releases write lock of path.
+func (m *ResourceMutex) Unlock(path string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	l, ok := m.resources[path]
+	if !ok || !l.writer {
+		panic("coap: unlock of unlocked resource " + path)
+	}
+	l.writer = false
+	m.release(path, l)
+}
+
+// RLock acquires read lock of path, it waits until the write lock is released or ctx is done.
+func (m *ResourceMutex) RLock(ctx context.Context, path string) (unlock func(), err error) {
+	if err := m.acquire(ctx, path, false); err != nil {
+		return nil, err
+	}
+	return func() { m.RUnlock(path) }, nil
+}
+
+// RUnlock releases read lock of path.
+func (m *ResourceMutex) RUnlock(path string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	l, ok := m.resources[path]
+	if !ok || l.readers == 0 {
+		panic("coap: runlock of unlocked resource " + path)
+	}
+	l.readers--
+	m.release(path, l)
+}
+
+// SerialiseWritesMiddleware serialises requests of the same resource. PUT, POST and DELETE
+// requests acquire write lock and GET requests acquire read lock of the request path.
+// When the lock cannot be acquired until r.Ctx is done, 5.03 Service Unavailable is sent.
+func SerialiseWritesMiddleware(mu *ResourceMutex) MiddlewareFunc {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			var lock func(ctx context.Context, path string) (func(), error)
+			switch r.Msg.Code() {
+			case PUT, POST, DELETE:
+				lock = mu.Lock
+			case GET:
+				lock = mu.RLock
+			default:
+				next.ServeCOAP(w, r)
+				return
+			}
+			unlock, err := lock(r.Ctx, r.Msg.PathString())
+			if err != nil {
+				w.SetCode(ServiceUnavailable)
+				w.Write(nil)
+				return
+			}
+			defer unlock()
+			next.ServeCOAP(w, r)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package coap
 
 import (
 	"context"
+	"io"
 )
 
 // A ResponseWriter interface is used by an CAOP handler to construct an COAP response.
@@ -33,6 +34,14 @@ type ResponseWriter interface {
 	//If Option ContentFormat is set and Payload is not set then call will failed.
 	//If Option ContentFormat is not set and Payload is set then call will failed.
 	WriteMsgWithContext(ctx context.Context, msg Message) error
+	//WriteError sends response without payload with code for err. Code is carried by CoAPError,
+	//otherwise it's InternalServerError unless NewErrorMappingMiddleware maps err.
+	WriteError(err error)
+	//WriteReader sends payload read from r. With blockwise transfer r is read lazily, one block of szx
+	//for every Block2 request of the client, otherwise it's read whole.
+	WriteReader(r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error
+	//WriteReaderWithContext sends payload read from r with context.
+	WriteReaderWithContext(ctx context.Context, r io.Reader, contentFormat MediaType, szx BlockWiseSzx) error
 
 	getCode() *COAPCode
 	getReq() *Request
@@ -142,6 +151,18 @@ func (r *responseWriter) SetContentFormat(contentFormat MediaType) {
 	r.contentFormat = &contentFormat
 }
 
+func (r *responseWriter) WriteError(err error) {
+	writeError(r, err)
+}
+
+func (r *responseWriter) WriteReader(rd io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return r.WriteReaderWithContext(context.Background(), rd, contentFormat, szx)
+}
+
+func (r *responseWriter) WriteReaderWithContext(ctx context.Context, rd io.Reader, contentFormat MediaType, szx BlockWiseSzx) error {
+	return writeReaderWhole(ctx, r, rd, contentFormat)
+}
+
 func (r *responseWriter) getCode() *COAPCode {
 	return r.code
 }
@@ -0,0 +1,97 @@
+package coap
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy decides whether a request of ClientConn is sent again. It's consulted when
+// attempt (counted from 1) fails by err, which is CoAPError for response resp with error code.
+// It returns whether to retry and delay before the next attempt.
+type RetryPolicy interface {
+	ShouldRetry(attempt int, resp Message, err error) (bool, time.Duration)
+}
+
+// NoRetry never retries requests.
+type NoRetry struct{}
+
+// ShouldRetry implements RetryPolicy.
+func (NoRetry) ShouldRetry(attempt int, resp Message, err error) (bool, time.Duration) {
+	return false, 0
+}
+
+// FixedIntervalRetry sends request up to MaxAttempts times, Interval apart.
+type FixedIntervalRetry struct {
+	MaxAttempts int
+	Interval    time.Duration
+}
+
+// ShouldRetry implements RetryPolicy.
+func (p FixedIntervalRetry) ShouldRetry(attempt int, resp Message, err error) (bool, time.Duration) {
+	return attempt < p.MaxAttempts, p.Interval
+}
+
+// ExponentialBackoffRetry sends request up to MaxAttempts times, delay starts at Base and it's doubled
+// after every attempt up to Max. Max 0 means unlimited.
+type ExponentialBackoffRetry struct {
+	MaxAttempts int
+	Base        time.Duration
+	Max         time.Duration
+}
+
+// ShouldRetry implements RetryPolicy.
+func (p ExponentialBackoffRetry) ShouldRetry(attempt int, resp Message, err error) (bool, time.Duration) {
+	if attempt >= p.MaxAttempts {
+		return false, 0
+	}
+	delay := p.Base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.Max > 0 && delay >= p.Max {
+			break
+		}
+	}
+	if p.Max > 0 && delay > p.Max {
+		delay = p.Max
+	}
+	return true, delay
+}
+
+// canRetry reports whether request with code is retried, POST only when Client.RetryNonIdempotent is set.
+func (cc *ClientCommander) canRetry(code COAPCode) bool {
+	if cc.retryPolicy == nil {
+		return false
+	}
+	switch code {
+	case GET, PUT, DELETE, FETCH:
+		return true
+	}
+	return cc.retryNonIdempotent
+}
+
+// exchangeWithRetry performs exchangeChecked and repeats it with new message ID as retry policy decides.
+func (cc *ClientCommander) exchangeWithRetry(ctx context.Context, req Message) (Message, error) {
+	if !cc.canRetry(req.Code()) {
+		return cc.exchangeChecked(ctx, req)
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := cc.exchangeChecked(ctx, req)
+		if err == nil || ctx.Err() != nil {
+			return resp, err
+		}
+		retry, delay := cc.retryPolicy.ShouldRetry(attempt, resp, err)
+		if !retry {
+			return resp, err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return resp, err
+		}
+		messageID, errID := cc.generateMessageID()
+		if errID != nil {
+			return resp, err
+		}
+		req.SetMessageID(messageID)
+	}
+}
@@ -0,0 +1,122 @@
+package coap
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingRetryPolicy struct {
+	RetryPolicy
+	lock     sync.Mutex
+	attempts []int
+	codes    []COAPCode
+}
+
+func (p *recordingRetryPolicy) ShouldRetry(attempt int, resp Message, err error) (bool, time.Duration) {
+	p.lock.Lock()
+	p.attempts = append(p.attempts, attempt)
+	if code, ok := ResponseCode(err); ok {
+		p.codes = append(p.codes, code)
+	}
+	p.lock.Unlock()
+	return p.RetryPolicy.ShouldRetry(attempt, resp, err)
+}
+
+func TestExponentialBackoffRetry(t *testing.T) {
+	p := ExponentialBackoffRetry{MaxAttempts: 6, Base: time.Millisecond * 10, Max: time.Millisecond * 50}
+	var delays []time.Duration
+	for attempt := 1; ; attempt++ {
+		retry, delay := p.ShouldRetry(attempt, nil, ErrTimeout)
+		if !retry {
+			break
+		}
+		delays = append(delays, delay)
+	}
+	ms := time.Millisecond
+	assert.Equal(t, []time.Duration{10 * ms, 20 * ms, 40 * ms, 50 * ms, 50 * ms}, delays)
+
+	retry, delay := FixedIntervalRetry{MaxAttempts: 2, Interval: ms}.ShouldRetry(1, nil, ErrTimeout)
+	assert.True(t, retry)
+	assert.Equal(t, ms, delay)
+	retry, _ = FixedIntervalRetry{MaxAttempts: 2, Interval: ms}.ShouldRetry(2, nil, ErrTimeout)
+	assert.False(t, retry)
+	retry, _ = NoRetry{}.ShouldRetry(1, nil, ErrTimeout)
+	assert.False(t, retry)
+}
+
+func runFlakyServer(t *testing.T, failures int32) (addr string, calls *int32, stop func()) {
+	calls = new(int32)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.SetCode(ServiceUnavailable)
+			w.Write(nil)
+			return
+		}
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("ok"))
+	})
+	require.NoError(t, err)
+	return addr, calls, func() {
+		s.Shutdown()
+		<-fin
+	}
+}
+
+func TestClientRetryPolicy(t *testing.T) {
+	addr, calls, stop := runFlakyServer(t, 2)
+	defer stop()
+
+	policy := &recordingRetryPolicy{RetryPolicy: ExponentialBackoffRetry{MaxAttempts: 5, Base: time.Millisecond * 10}}
+	co, err := (&Client{RetryPolicy: policy}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code())
+	assert.Equal(t, []byte("ok"), resp.Payload())
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+	assert.Equal(t, []int{1, 2}, policy.attempts)
+	assert.Equal(t, []COAPCode{ServiceUnavailable, ServiceUnavailable}, policy.codes)
+}
+
+func TestClientRetryPolicyExhausted(t *testing.T) {
+	addr, calls, stop := runFlakyServer(t, 10)
+	defer stop()
+
+	co, err := (&Client{RetryPolicy: FixedIntervalRetry{MaxAttempts: 3, Interval: time.Millisecond}}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	_, err = co.Delete("/a")
+	code, ok := ResponseCode(err)
+	require.True(t, ok)
+	assert.Equal(t, ServiceUnavailable, code)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestClientRetryPolicyPost(t *testing.T) {
+	addr, calls, stop := runFlakyServer(t, 1)
+	defer stop()
+
+	policy := FixedIntervalRetry{MaxAttempts: 3, Interval: time.Millisecond}
+	co, err := (&Client{RetryPolicy: policy}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+	_, err = co.Post("/a", TextPlain, bytes.NewReader([]byte("x")))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	co1, err := (&Client{RetryPolicy: policy, RetryNonIdempotent: true}).Dial(addr)
+	require.NoError(t, err)
+	defer co1.Close()
+	_, err = co1.Post("/a", TextPlain, bytes.NewReader([]byte("x")))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
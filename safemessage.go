@@ -0,0 +1,74 @@
+package coap
+
+import (
+	"io"
+	"sync"
+)
+
+// SafeMessage guards message shared by goroutines (eg. cached response sent to many observers)
+// by read-write mutex. Writers must change the message only via SafeMessage.
+type SafeMessage struct {
+	lock sync.RWMutex
+	msg  Message
+}
+
+// NewSafeMessage wraps message.
+func NewSafeMessage(msg Message) *SafeMessage {
+	return &SafeMessage{msg: msg}
+}
+
+// GetOption returns value of option, ok is false when option is absent.
+func (m *SafeMessage) GetOption(id OptionID) (interface{}, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	v := m.msg.Option(id)
+	return v, v != nil
+}
+
+// Options returns values of repeatable option.
+func (m *SafeMessage) Options(id OptionID) []interface{} {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.msg.Options(id)
+}
+
+// SetOption sets option.
+func (m *SafeMessage) SetOption(id OptionID, v interface{}) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.msg.SetOption(id, v)
+}
+
+// RemoveOption removes option.
+func (m *SafeMessage) RemoveOption(id OptionID) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.msg.RemoveOption(id)
+}
+
+// Payload returns payload.
+func (m *SafeMessage) Payload() []byte {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.msg.Payload()
+}
+
+// SetPayload sets payload.
+func (m *SafeMessage) SetPayload(p []byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.msg.SetPayload(p)
+}
+
+// MarshalBinary writes message to buf.
+func (m *SafeMessage) MarshalBinary(buf io.Writer) error {
+	// marshaling sorts options in place
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.msg.MarshalBinary(buf)
+}
+
+// Unwrap returns wrapped message. It is not guarded anymore.
+func (m *SafeMessage) Unwrap() Message {
+	return m.msg
+}
@@ -0,0 +1,58 @@
+package coap
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSafeMessageConcurrentAccess is meant to be run with -race.
+func TestSafeMessageConcurrentAccess(t *testing.T) {
+	msg := NewDgramMessage(MessageParams{
+		Type:      NonConfirmable,
+		Code:      Content,
+		MessageID: 1,
+		Token:     []byte{1},
+		Payload:   []byte("0"),
+	})
+	msg.SetOption(Observe, uint32(0))
+	m := NewSafeMessage(msg)
+
+	const readers = 100
+	const writes = 1000
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := bytes.NewBuffer(nil)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				v, ok := m.GetOption(Observe)
+				require.True(t, ok)
+				require.IsType(t, uint32(0), v)
+				require.NotEmpty(t, m.Payload())
+				buf.Reset()
+				require.NoError(t, m.MarshalBinary(buf))
+			}
+		}()
+	}
+	for i := 0; i < writes; i++ {
+		m.SetOption(Observe, uint32(i))
+		m.SetPayload([]byte{byte(i)})
+	}
+	close(done)
+	wg.Wait()
+
+	v, ok := m.GetOption(Observe)
+	require.True(t, ok)
+	require.Equal(t, uint32(writes-1), v)
+	require.Equal(t, msg, m.Unwrap())
+}
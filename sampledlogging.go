@@ -0,0 +1,130 @@
+package coap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// maxLoggedPayload is count of payload bytes logged by SampledLoggingMiddleware.
+const maxLoggedPayload = 512
+
+// Logger writes lines of SampledLoggingMiddleware, eg. adapter of application logger.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+}
+
+type traceIDKey struct{}
+
+// TraceIDFromContext returns hex encoded trace ID of request sampled by SampledLoggingMiddleware,
+// it's empty for other requests.
+func TraceIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+func newTraceID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func loggedPayload(p []byte) string {
+	if len(p) > maxLoggedPayload {
+		return fmt.Sprintf("%q... (%v bytes)", p[:maxLoggedPayload], len(p))
+	}
+	return fmt.Sprintf("%q", p)
+}
+
+func loggedOptions(msg Message) string {
+	opts := make([]string, 0, len(msg.AllOptions()))
+	for _, o := range msg.AllOptions() {
+		opts = append(opts, fmt.Sprintf("%v=%v", optionName(o.ID), o.Value))
+	}
+	return strings.Join(opts, " ")
+}
+
+type loggingResponseWriter struct {
+	ResponseWriter
+	resp Message
+}
+
+func (w *loggingResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *loggingResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *loggingResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *loggingResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	w.resp = msg
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+func (w *loggingResponseWriter) WriteError(err error) {
+	writeError(w, err)
+}
+
+func (w *loggingResponseWriter) code() COAPCode {
+	if w.resp == nil {
+		return Empty
+	}
+	return w.resp.Code()
+}
+
+// SampledLoggingMiddleware logs requests sampled by sampler, eg. FixedRateSampler, in detail by Infof
+// with up to 512 bytes of payload. Sampled request gets random trace ID, which is returned by
+// TraceIDFromContext and which is logged in both request and response lines. Other requests
+// are logged by single Debugf line with method, path and response code.
+func SampledLoggingMiddleware(sampler func() bool, logger Logger) MiddlewareFunc {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			lw := &loggingResponseWriter{ResponseWriter: w}
+			var traceID string
+			if sampler() {
+				// request without trace ID is logged as unsampled one
+				traceID, _ = newTraceID()
+			}
+			if traceID == "" {
+				next.ServeCOAP(lw, r)
+				logger.Debugf("%v /%v %v", r.Msg.Code(), r.Msg.PathString(), lw.code())
+				return
+			}
+			ctx := r.Ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			logger.Infof("trace=%v request %v %v /%v from %v mid=%v token=%x options=[%v] payload=%v",
+				traceID, r.Msg.Type(), r.Msg.Code(), r.Msg.PathString(), r.Client.RemoteAddr(),
+				r.Msg.MessageID(), r.Msg.Token(), loggedOptions(r.Msg), loggedPayload(r.Msg.Payload()))
+			next.ServeCOAP(lw, &Request{
+				Msg:      r.Msg,
+				Client:   r.Client,
+				Ctx:      context.WithValue(ctx, traceIDKey{}, traceID),
+				Sequence: r.Sequence,
+			})
+			if lw.resp == nil {
+				logger.Infof("trace=%v response none", traceID)
+				return
+			}
+			logger.Infof("trace=%v response %v %v mid=%v options=[%v] payload=%v",
+				traceID, lw.resp.Type(), lw.resp.Code(), lw.resp.MessageID(),
+				loggedOptions(lw.resp), loggedPayload(lw.resp.Payload()))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package coap
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	lock  sync.Mutex
+	debug []string
+	info  []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Infof(format string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.info = append(l.info, fmt.Sprintf(format, args...))
+}
+
+func TestSampledLoggingMiddleware(t *testing.T) {
+	logger := &recordingLogger{}
+	traceIDs := make(chan string, 1000)
+	s := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		traceIDs <- TraceIDFromContext(r.Ctx)
+		w.SetCode(Changed)
+		w.SetContentFormat(TextPlain)
+		w.Write(bytes.Repeat([]byte("r"), 600))
+	})}
+	s.Use(SampledLoggingMiddleware(FixedRateSampler(0.1), logger))
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	for i := 0; i < 1000; i++ {
+		_, err := co.Post("/a", TextPlain, bytes.NewReader([]byte("q")))
+		require.NoError(t, err)
+	}
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	sampled := len(logger.info) / 2
+	assert.InDelta(t, 100, sampled, 50)
+	assert.Equal(t, 1000, sampled+len(logger.debug))
+	assert.Equal(t, "POST /a Changed", logger.debug[0])
+
+	// request and response lines share trace ID passed to handler
+	close(traceIDs)
+	var ids []string
+	for id := range traceIDs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	require.Len(t, ids, sampled)
+	for i, id := range ids {
+		assert.Len(t, id, 32)
+		assert.True(t, strings.HasPrefix(logger.info[2*i], "trace="+id+" request Confirmable POST /a"), logger.info[2*i])
+		assert.Contains(t, logger.info[2*i], `payload="q"`)
+		assert.True(t, strings.HasPrefix(logger.info[2*i+1], "trace="+id+" response"), logger.info[2*i+1])
+		assert.Contains(t, logger.info[2*i+1], "(600 bytes)")
+	}
+}
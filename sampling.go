@@ -0,0 +1,61 @@
+package coap
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SamplingMiddleware applies inner, eg. MetricsMiddleware, only to requests for which sampler returns true,
+// other requests are served by handler directly.
+func SamplingMiddleware(sampler func() bool, inner MiddlewareFunc) MiddlewareFunc {
+	return func(next Handler) Handler {
+		sampled := inner(next)
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			if sampler() {
+				sampled.ServeCOAP(w, r)
+				return
+			}
+			next.ServeCOAP(w, r)
+		})
+	}
+}
+
+// FixedRateSampler samples every request with probability rate.
+func FixedRateSampler(rate float64) func() bool {
+	return func() bool {
+		return rand.Float64() < rate
+	}
+}
+
+// RateLimitedSampler samples the first requests of every second, at most maxPerSecond of them.
+// When maxPerSecond is below 1, single request is sampled every 1/maxPerSecond seconds.
+func RateLimitedSampler(maxPerSecond float64) func() bool {
+	return rateLimitedSampler(maxPerSecond, time.Now)
+}
+
+func rateLimitedSampler(maxPerSecond float64, now func() time.Time) func() bool {
+	if maxPerSecond <= 0 {
+		return func() bool { return false }
+	}
+	window, max := time.Second, int(maxPerSecond)
+	if max < 1 {
+		window, max = time.Duration(float64(time.Second)/maxPerSecond), 1
+	}
+	var lock sync.Mutex
+	var start time.Time
+	var count int
+	return func() bool {
+		t := now()
+		lock.Lock()
+		defer lock.Unlock()
+		if start.IsZero() || t.Sub(start) >= window {
+			start, count = t, 0
+		}
+		if count >= max {
+			return false
+		}
+		count++
+		return true
+	}
+}
@@ -0,0 +1,61 @@
+package coap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingMiddleware(t *testing.T) {
+	var sampled, served int
+	inner := func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			sampled++
+			next.ServeCOAP(w, r)
+		})
+	}
+	var i int
+	h := SamplingMiddleware(func() bool { i++; return i%2 == 0 }, inner)(HandlerFunc(func(w ResponseWriter, r *Request) {
+		served++
+	}))
+	for n := 0; n < 10; n++ {
+		h.ServeCOAP(nil, nil)
+	}
+	assert.Equal(t, 10, served)
+	assert.Equal(t, 5, sampled)
+}
+
+func TestFixedRateSampler(t *testing.T) {
+	sampler := FixedRateSampler(0.1)
+	var n int
+	for i := 0; i < 10000; i++ {
+		if sampler() {
+			n++
+		}
+	}
+	assert.InDelta(t, 1000, n, 200)
+}
+
+func TestRateLimitedSampler(t *testing.T) {
+	now := time.Now()
+	sampler := rateLimitedSampler(100, func() time.Time { return now })
+	var n int
+	// 1000 req/s for 1s
+	for i := 0; i < 1000; i++ {
+		if sampler() {
+			n++
+		}
+		now = now.Add(time.Millisecond)
+	}
+	assert.Equal(t, 100, n)
+	assert.True(t, sampler(), "next second")
+
+	now = time.Now()
+	sampler = rateLimitedSampler(0.5, func() time.Time { return now })
+	assert.True(t, sampler())
+	now = now.Add(time.Second)
+	assert.False(t, sampler())
+	now = now.Add(time.Second)
+	assert.True(t, sampler())
+}
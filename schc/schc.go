@@ -0,0 +1,620 @@
+// Package schc compresses CoAP headers by Static Context Header Compression (RFC 8724) with
+// the CoAP fields of RFC 8824, so frames of LPWAN devices can be produced and checked in tests.
+package schc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	coap "github.com/go-ocf/go-coap"
+)
+
+// FieldID identifies field of CoAP message.
+type FieldID int
+
+// Fields of CoAP message.
+const (
+	FieldVersion FieldID = iota
+	FieldType
+	FieldTKL
+	FieldCode
+	FieldMID
+	FieldToken
+	FieldOption // option given by Field.Option
+)
+
+// Direction of message the field descriptor applies to.
+type Direction int
+
+// Directions of messages, Up is from device to network.
+const (
+	Bidirectional Direction = iota
+	Up
+	Down
+)
+
+// MatchingOperator compares field of message with target value.
+type MatchingOperator int
+
+// Matching operators.
+const (
+	Equal MatchingOperator = iota
+	Ignore
+	MSB          // the first Field.MSBLength bits are equal
+	MatchMapping // value is one of Field.Mapping
+)
+
+// Action compresses and decompresses field.
+type Action int
+
+// Compression/decompression actions.
+const (
+	NotSent     Action = iota // target value is used
+	ValueSent                 // whole value is sent
+	MappingSent               // index to Field.Mapping is sent
+	LSB                       // bits after Field.MSBLength bits of target value are sent
+)
+
+var (
+	errNoRule       = errors.New("schc: no rule matches message")
+	errUnknownRule  = errors.New("schc: unknown rule")
+	errShortFrame   = errors.New("schc: frame is too short")
+	errInvalidMsg   = errors.New("schc: invalid CoAP message")
+	errTokenLength  = errors.New("schc: token precedes TKL in rule")
+	errInvalidIndex = errors.New("schc: invalid mapping index")
+)
+
+// fieldBits are sizes of fixed length fields, 0 means variable length.
+var fieldBits = map[FieldID]int{
+	FieldVersion: 2,
+	FieldType:    2,
+	FieldTKL:     4,
+	FieldCode:    8,
+	FieldMID:     16,
+}
+
+// Field is field descriptor of rule. Values are big-endian, option values are in the wire format.
+type Field struct {
+	ID        FieldID
+	Option    coap.OptionID // option number when ID is FieldOption
+	Position  int           // position of repeated option from 1, 0 means 1
+	Direction Direction
+	Target    []byte
+	Mapping   [][]byte // target values of MatchMapping
+	MO        MatchingOperator
+	MSBLength int // compared bits of MSB, multiple of 8 for variable length fields
+	CDA       Action
+}
+
+func (f Field) position() int {
+	if f.Position == 0 {
+		return 1
+	}
+	return f.Position
+}
+
+func (f Field) key() fieldKey {
+	return fieldKey{id: f.ID, option: f.Option, position: f.position()}
+}
+
+func (f Field) validate() error {
+	bits := fieldBits[f.ID]
+	switch {
+	case f.CDA == NotSent && f.MO != Equal:
+		return fmt.Errorf("schc: not-sent field %v must use equal", f.ID)
+	case f.CDA == MappingSent && f.MO != MatchMapping:
+		return fmt.Errorf("schc: mapping-sent field %v must use match-mapping", f.ID)
+	case f.CDA == LSB && f.MO != MSB:
+		return fmt.Errorf("schc: LSB field %v must use MSB", f.ID)
+	case f.MO == MSB && (f.MSBLength < 0 || (bits > 0 && f.MSBLength > bits) || (bits == 0 && f.MSBLength%8 != 0)):
+		return fmt.Errorf("schc: invalid MSB length %v of field %v", f.MSBLength, f.ID)
+	case f.MO == MSB && bits == 0 && len(f.Target) < f.MSBLength/8:
+		return fmt.Errorf("schc: target of field %v is shorter than MSB length", f.ID)
+	}
+	return nil
+}
+
+// Rule is compression rule, its ID of IDLength bits prefixes compressed frame.
+type Rule struct {
+	ID       uint32
+	IDLength int // 0 means 8 bits
+	Fields   []Field
+}
+
+func (r Rule) idLength() int {
+	if r.IDLength == 0 {
+		return 8
+	}
+	return r.IDLength
+}
+
+// fields returns field descriptors which apply to direction d.
+func (r Rule) fields(d Direction) []Field {
+	var fields []Field
+	for _, f := range r.Fields {
+		if f.Direction == Bidirectional || f.Direction == d {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Compressor compresses CoAP messages by the first matching rule.
+type Compressor struct {
+	rules []Rule
+
+	// Direction of compressed and decompressed messages.
+	Direction Direction
+}
+
+// NewCompressor creates compressor of uplink messages, it checks that actions
+// of rules are consistent with matching operators.
+func NewCompressor(rules []Rule) (*Compressor, error) {
+	for _, r := range rules {
+		if r.idLength() > 32 {
+			return nil, fmt.Errorf("schc: invalid length of rule ID %v", r.ID)
+		}
+		for _, f := range r.Fields {
+			if err := f.validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Compressor{rules: rules, Direction: Up}, nil
+}
+
+type fieldKey struct {
+	id       FieldID
+	option   coap.OptionID
+	position int
+}
+
+// parsedMessage holds fields of CoAP message in the wire format.
+type parsedMessage struct {
+	fields  map[fieldKey][]byte
+	payload []byte
+}
+
+func parseMessage(data []byte) (parsedMessage, error) {
+	if len(data) < 4 {
+		return parsedMessage{}, errInvalidMsg
+	}
+	tkl := int(data[0] & 0x0f)
+	p := parsedMessage{fields: map[fieldKey][]byte{
+		{id: FieldVersion, position: 1}: {data[0] >> 6},
+		{id: FieldType, position: 1}:    {data[0] >> 4 & 0x03},
+		{id: FieldTKL, position: 1}:     {byte(tkl)},
+		{id: FieldCode, position: 1}:    {data[1]},
+		{id: FieldMID, position: 1}:     {data[2], data[3]},
+	}}
+	data = data[4:]
+	if len(data) < tkl {
+		return parsedMessage{}, errInvalidMsg
+	}
+	if tkl > 0 {
+		p.fields[fieldKey{id: FieldToken, position: 1}] = data[:tkl]
+	}
+	data = data[tkl:]
+
+	positions := make(map[coap.OptionID]int)
+	var option int
+	for len(data) > 0 {
+		if data[0] == 0xff {
+			p.payload = data[1:]
+			break
+		}
+		delta, length := int(data[0]>>4), int(data[0]&0x0f)
+		data = data[1:]
+		var ok bool
+		if delta, data, ok = optionExtension(delta, data); !ok {
+			return parsedMessage{}, errInvalidMsg
+		}
+		if length, data, ok = optionExtension(length, data); !ok || len(data) < length {
+			return parsedMessage{}, errInvalidMsg
+		}
+		option += delta
+		id := coap.OptionID(option)
+		positions[id]++
+		p.fields[fieldKey{id: FieldOption, option: id, position: positions[id]}] = data[:length]
+		data = data[length:]
+	}
+	return p, nil
+}
+
+func optionExtension(v int, data []byte) (int, []byte, bool) {
+	switch v {
+	case 13:
+		if len(data) < 1 {
+			return 0, nil, false
+		}
+		return int(data[0]) + 13, data[1:], true
+	case 14:
+		if len(data) < 2 {
+			return 0, nil, false
+		}
+		return int(data[0])<<8 + int(data[1]) + 269, data[2:], true
+	case 15:
+		return 0, nil, false
+	}
+	return v, data, true
+}
+
+func toUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func fromUint(v uint64, bits int) []byte {
+	b := make([]byte, (bits+7)/8)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+func mappingBits(n int) int {
+	bits := 0
+	for 1<<uint(bits) < n {
+		bits++
+	}
+	return bits
+}
+
+func (f Field) matches(v []byte) bool {
+	bits := fieldBits[f.ID]
+	switch f.MO {
+	case Ignore:
+		return true
+	case Equal:
+		if bits > 0 {
+			return toUint(v) == toUint(f.Target)
+		}
+		return bytes.Equal(v, f.Target)
+	case MSB:
+		if bits > 0 {
+			shift := uint(bits - f.MSBLength)
+			return toUint(v)>>shift == toUint(f.Target)>>shift
+		}
+		n := f.MSBLength / 8
+		return len(v) >= n && bytes.Equal(v[:n], f.Target[:n])
+	case MatchMapping:
+		return f.mappingIndex(v) >= 0
+	}
+	return false
+}
+
+func (f Field) mappingIndex(v []byte) int {
+	bits := fieldBits[f.ID]
+	for i, m := range f.Mapping {
+		if (bits > 0 && toUint(v) == toUint(m)) || (bits == 0 && bytes.Equal(v, m)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// match returns fields of rule r for message p, false when r doesn't describe p.
+func (c *Compressor) match(r Rule, p parsedMessage) ([]Field, bool) {
+	fields := r.fields(c.Direction)
+	if len(fields) != len(p.fields) {
+		return nil, false
+	}
+	for _, f := range fields {
+		v, ok := p.fields[f.key()]
+		if !ok || !f.matches(v) {
+			return nil, false
+		}
+	}
+	return fields, true
+}
+
+// Compress compresses msg by the first rule which describes all its fields. The payload follows
+// residue of fields and the frame is padded by zero bits.
+func (c *Compressor) Compress(msg coap.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msg.MarshalBinary(&buf); err != nil {
+		return nil, err
+	}
+	p, err := parseMessage(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range c.rules {
+		fields, ok := c.match(r, p)
+		if !ok {
+			continue
+		}
+		var w bitWriter
+		w.write(uint64(r.ID), r.idLength())
+		for _, f := range fields {
+			f.compress(&w, p.fields[f.key()])
+		}
+		w.writeBytes(p.payload)
+		return w.b, nil
+	}
+	return nil, errNoRule
+}
+
+func (f Field) compress(w *bitWriter, v []byte) {
+	bits := fieldBits[f.ID]
+	switch f.CDA {
+	case ValueSent:
+		if bits > 0 {
+			w.write(toUint(v), bits)
+		} else {
+			f.writeVariable(w, v)
+		}
+	case MappingSent:
+		w.write(uint64(f.mappingIndex(v)), mappingBits(len(f.Mapping)))
+	case LSB:
+		if bits > 0 {
+			n := bits - f.MSBLength
+			w.write(toUint(v)&(1<<uint(n)-1), n)
+		} else {
+			f.writeVariable(w, v[f.MSBLength/8:])
+		}
+	}
+}
+
+// writeVariable writes residue of variable length field, token length is given by TKL.
+func (f Field) writeVariable(w *bitWriter, v []byte) {
+	if f.ID != FieldToken {
+		w.writeLength(len(v))
+	}
+	w.writeBytes(v)
+}
+
+// Decompress restores CoAP message from frame created by Compress.
+func (c *Compressor) Decompress(frame []byte) (coap.Message, error) {
+	r := bitReader{b: frame}
+	var rule *Rule
+	for i := range c.rules {
+		if c.rules[i].idLength() <= r.remaining() && r.peek(c.rules[i].idLength()) == uint64(c.rules[i].ID) {
+			rule = &c.rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return nil, errUnknownRule
+	}
+	r.read(rule.idLength())
+
+	values := make(map[fieldKey][]byte)
+	tkl := -1
+	for _, f := range rule.fields(c.Direction) {
+		v, err := f.decompress(&r, tkl)
+		if err != nil {
+			return nil, err
+		}
+		if f.ID == FieldTKL {
+			tkl = int(toUint(v))
+		}
+		values[f.key()] = v
+	}
+	payload := r.readBytes(r.remaining() / 8)
+	if r.err != nil {
+		return nil, r.err
+	}
+	msg, err := coap.ParseDgramMessage(buildMessage(values, payload))
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (f Field) decompress(r *bitReader, tkl int) ([]byte, error) {
+	bits := fieldBits[f.ID]
+	switch f.CDA {
+	case NotSent:
+		return f.Target, nil
+	case ValueSent:
+		if bits > 0 {
+			return fromUint(r.read(bits), bits), nil
+		}
+		return f.readVariable(r, tkl, 0)
+	case MappingSent:
+		i := int(r.read(mappingBits(len(f.Mapping))))
+		if i >= len(f.Mapping) {
+			return nil, errInvalidIndex
+		}
+		return f.Mapping[i], nil
+	case LSB:
+		if bits > 0 {
+			n := bits - f.MSBLength
+			msb := toUint(f.Target) >> uint(n) << uint(n)
+			return fromUint(msb|r.read(n), bits), nil
+		}
+		prefix := f.Target[:f.MSBLength/8]
+		v, err := f.readVariable(r, tkl, len(prefix))
+		return append(append([]byte(nil), prefix...), v...), err
+	}
+	return nil, fmt.Errorf("schc: unknown action %v", f.CDA)
+}
+
+// readVariable reads residue of variable length field, prefix bytes of token are not sent.
+func (f Field) readVariable(r *bitReader, tkl, prefix int) ([]byte, error) {
+	if f.ID != FieldToken {
+		return r.readBytes(r.readLength()), r.err
+	}
+	if tkl < 0 {
+		return nil, errTokenLength
+	}
+	return r.readBytes(tkl - prefix), r.err
+}
+
+type restoredOption struct {
+	id    coap.OptionID
+	value []byte
+}
+
+// buildMessage encodes fields of message in the wire format.
+func buildMessage(values map[fieldKey][]byte, payload []byte) []byte {
+	field := func(id FieldID) []byte {
+		return values[fieldKey{id: id, position: 1}]
+	}
+	version := byte(1)
+	if v := field(FieldVersion); v != nil {
+		version = byte(toUint(v))
+	}
+	token := field(FieldToken)
+	tkl := byte(len(token))
+	if v := field(FieldTKL); v != nil {
+		tkl = byte(toUint(v))
+	}
+	mid := fromUint(toUint(field(FieldMID)), 16)
+	msg := []byte{version<<6 | byte(toUint(field(FieldType)))<<4 | tkl&0x0f, byte(toUint(field(FieldCode))), mid[0], mid[1]}
+	msg = append(msg, token...)
+
+	var opts []restoredOption
+	var positions []int
+	for k, v := range values {
+		if k.id == FieldOption {
+			opts = append(opts, restoredOption{id: k.option, value: v})
+			positions = append(positions, k.position)
+		}
+	}
+	sort.Sort(byOptionPosition{opts, positions})
+	var last coap.OptionID
+	for _, o := range opts {
+		msg = appendOption(msg, int(o.id-last), o.value)
+		last = o.id
+	}
+	if len(payload) > 0 {
+		msg = append(msg, 0xff)
+		msg = append(msg, payload...)
+	}
+	return msg
+}
+
+type byOptionPosition struct {
+	opts      []restoredOption
+	positions []int
+}
+
+func (s byOptionPosition) Len() int { return len(s.opts) }
+func (s byOptionPosition) Less(i, j int) bool {
+	if s.opts[i].id != s.opts[j].id {
+		return s.opts[i].id < s.opts[j].id
+	}
+	return s.positions[i] < s.positions[j]
+}
+func (s byOptionPosition) Swap(i, j int) {
+	s.opts[i], s.opts[j] = s.opts[j], s.opts[i]
+	s.positions[i], s.positions[j] = s.positions[j], s.positions[i]
+}
+
+func optionNibble(v int) (byte, []byte) {
+	switch {
+	case v < 13:
+		return byte(v), nil
+	case v < 269:
+		return 13, []byte{byte(v - 13)}
+	}
+	v -= 269
+	return 14, []byte{byte(v >> 8), byte(v)}
+}
+
+func appendOption(msg []byte, delta int, value []byte) []byte {
+	d, dext := optionNibble(delta)
+	l, lext := optionNibble(len(value))
+	msg = append(msg, d<<4|l)
+	msg = append(msg, dext...)
+	msg = append(msg, lext...)
+	return append(msg, value...)
+}
+
+// bitWriter writes residue, it pads the last byte by zero bits.
+type bitWriter struct {
+	b []byte
+	n int // written bits
+}
+
+func (w *bitWriter) write(v uint64, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.b[len(w.b)-1] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) writeBytes(b []byte) {
+	for _, c := range b {
+		w.write(uint64(c), 8)
+	}
+}
+
+// writeLength writes length of variable length residue in bytes (RFC 8724 section 7.4.2).
+func (w *bitWriter) writeLength(n int) {
+	switch {
+	case n < 15:
+		w.write(uint64(n), 4)
+	case n < 255:
+		w.write(0x0f, 4)
+		w.write(uint64(n), 8)
+	default:
+		w.write(0x0fff, 12)
+		w.write(uint64(n), 16)
+	}
+}
+
+// bitReader reads residue, it remembers the first error.
+type bitReader struct {
+	b   []byte
+	pos int // read bits
+	err error
+}
+
+func (r *bitReader) remaining() int {
+	return len(r.b)*8 - r.pos
+}
+
+func (r *bitReader) peek(bits int) uint64 {
+	var v uint64
+	for i := 0; i < bits; i++ {
+		pos := r.pos + i
+		v = v<<1 | uint64(r.b[pos/8]>>uint(7-pos%8)&1)
+	}
+	return v
+}
+
+func (r *bitReader) read(bits int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.remaining() < bits {
+		r.err = errShortFrame
+		return 0
+	}
+	v := r.peek(bits)
+	r.pos += bits
+	return v
+}
+
+func (r *bitReader) readBytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.read(8))
+	}
+	return b
+}
+
+func (r *bitReader) readLength() int {
+	n := int(r.read(4))
+	if n < 15 {
+		return n
+	}
+	if n = int(r.read(8)); n < 255 {
+		return n
+	}
+	return int(r.read(16))
+}
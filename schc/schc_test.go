@@ -0,0 +1,111 @@
+package schc
+
+import (
+	"bytes"
+	"testing"
+
+	coap "github.com/go-ocf/go-coap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exampleRule compresses the mandatory header of CON request to /foo/bar and of its
+// acknowledgement in the manner of examples of RFC 8824.
+var exampleRule = Rule{ID: 1, Fields: []Field{
+	{ID: FieldVersion, Target: []byte{1}, MO: Equal, CDA: NotSent},
+	{ID: FieldType, Direction: Up, Target: []byte{byte(coap.Confirmable)}, MO: Equal, CDA: NotSent},
+	{ID: FieldType, Direction: Down, Target: []byte{byte(coap.Acknowledgement)}, MO: Equal, CDA: NotSent},
+	{ID: FieldTKL, Target: []byte{0}, MO: Equal, CDA: NotSent},
+	{ID: FieldCode, Direction: Up, Target: []byte{byte(coap.POST)}, MO: Equal, CDA: NotSent},
+	{ID: FieldCode, Direction: Down, Mapping: [][]byte{{byte(coap.Content)}, {byte(coap.NotFound)}}, MO: MatchMapping, CDA: MappingSent},
+	{ID: FieldMID, Target: []byte{0, 0}, MO: MSB, MSBLength: 12, CDA: LSB},
+	{ID: FieldOption, Option: coap.URIPath, Direction: Up, Target: []byte("foo"), MO: Equal, CDA: NotSent},
+	{ID: FieldOption, Option: coap.URIPath, Position: 2, Direction: Up, Target: []byte("bar"), MO: Equal, CDA: NotSent},
+}}
+
+// valueRule sends most of fields.
+var valueRule = Rule{ID: 2, Fields: []Field{
+	{ID: FieldVersion, Target: []byte{1}, MO: Equal, CDA: NotSent},
+	{ID: FieldType, MO: Ignore, CDA: ValueSent},
+	{ID: FieldTKL, MO: Ignore, CDA: ValueSent},
+	{ID: FieldCode, MO: Ignore, CDA: ValueSent},
+	{ID: FieldMID, MO: Ignore, CDA: ValueSent},
+	{ID: FieldToken, MO: Ignore, CDA: ValueSent},
+	{ID: FieldOption, Option: coap.URIPath, Target: []byte("sensors"), MO: Equal, CDA: NotSent},
+	{ID: FieldOption, Option: coap.URIPath, Position: 2, Target: []byte("t"), MO: MSB, MSBLength: 8, CDA: LSB},
+}}
+
+func marshal(t *testing.T, msg coap.Message) []byte {
+	var b bytes.Buffer
+	require.NoError(t, msg.MarshalBinary(&b))
+	return b.Bytes()
+}
+
+func roundTrip(t *testing.T, c *Compressor, msg coap.Message) []byte {
+	frame, err := c.Compress(msg)
+	require.NoError(t, err)
+	restored, err := c.Decompress(frame)
+	require.NoError(t, err)
+	assert.Equal(t, marshal(t, msg), marshal(t, restored))
+	return frame
+}
+
+func TestCompressMandatoryHeader(t *testing.T) {
+	up, err := NewCompressor([]Rule{valueRule, exampleRule})
+	require.NoError(t, err)
+	req := coap.NewDgramMessage(coap.MessageParams{Type: coap.Confirmable, Code: coap.POST, MessageID: 0x000a})
+	req.SetPathString("/foo/bar")
+	frame := roundTrip(t, up, req)
+	// rule ID and 4 bits of MID
+	assert.Equal(t, []byte{0x01, 0xa0}, frame)
+	assert.Len(t, marshal(t, req), 12)
+
+	down, err := NewCompressor([]Rule{exampleRule})
+	require.NoError(t, err)
+	down.Direction = Down
+	resp := coap.NewDgramMessage(coap.MessageParams{Type: coap.Acknowledgement, Code: coap.Content, MessageID: 0x000a, Payload: []byte("21")})
+	frame = roundTrip(t, down, resp)
+	// rule ID, 1 bit of code mapping, 4 bits of MID and payload make 29 bits
+	assert.Len(t, frame, 4)
+
+	// uplink rule doesn't match other path
+	req.SetPathString("/foo/baz")
+	_, err = up.Compress(req)
+	assert.Error(t, err)
+	// downlink rule doesn't match code out of mapping
+	resp.SetCode(coap.BadRequest)
+	_, err = down.Compress(resp)
+	assert.Error(t, err)
+}
+
+func TestCompressValueSent(t *testing.T) {
+	c, err := NewCompressor([]Rule{exampleRule, valueRule})
+	require.NoError(t, err)
+	req := coap.NewDgramMessage(coap.MessageParams{Type: coap.NonConfirmable, Code: coap.GET, MessageID: 0x1234, Token: []byte{1, 2}})
+	req.SetPathString("/sensors/temp")
+	frame := roundTrip(t, c, req)
+	// rule ID 8, type 2, TKL 4, code 8, MID 16, token 16, length 4 and "emp" 24 bits
+	assert.Len(t, frame, 11)
+	assert.Equal(t, byte(2), frame[0])
+
+	// option outside of rule
+	req.SetOption(coap.ContentFormat, coap.TextPlain)
+	_, err = c.Compress(req)
+	assert.Error(t, err)
+}
+
+func TestNewCompressorInvalidRule(t *testing.T) {
+	_, err := NewCompressor([]Rule{{ID: 1, Fields: []Field{{ID: FieldMID, MO: Ignore, CDA: NotSent}}}})
+	assert.Error(t, err)
+	_, err = NewCompressor([]Rule{{ID: 1, Fields: []Field{{ID: FieldToken, MO: MSB, MSBLength: 4, CDA: LSB}}}})
+	assert.Error(t, err)
+}
+
+func TestDecompressInvalidFrame(t *testing.T) {
+	c, err := NewCompressor([]Rule{valueRule})
+	require.NoError(t, err)
+	_, err = c.Decompress([]byte{9})
+	assert.Error(t, err)
+	_, err = c.Decompress([]byte{2, 0x50})
+	assert.Error(t, err)
+}
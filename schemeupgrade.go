@@ -0,0 +1,161 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MovedPermanently 3.01 is not assigned by CoAP, servers use it to move client to alternate URI,
+// whose endpoint is carried by Location-Query arguments scheme, host and port and whose path
+// by Location-Path. Missing parts are the same as of the request.
+const MovedPermanently COAPCode = 97
+
+// defaultMaxRedirects limits redirects followed by SchemeUpgradeClient when MaxRedirects is 0.
+const defaultMaxRedirects = 3
+
+// schemeNets maps URI schemes to Client.Net.
+var schemeNets = map[string]string{
+	"coap":      "udp",
+	"coaps":     "udp-dtls",
+	"coap+tcp":  "tcp",
+	"coaps+tcp": "tcp-tls",
+}
+
+// SchemeUpgradeClient requests resources by URI and follows 3.01 Moved Permanently responses,
+// eg. from "coap" to "coaps+tcp" URI of server supporting RFC 8323.
+type SchemeUpgradeClient struct {
+	Client       Client   // template of client used for dialing, Net is set by scheme of URI
+	Schemes      []string // schemes redirects may upgrade to, redirects within the same scheme are always followed
+	MaxRedirects int      // 0 means 3 redirects
+}
+
+// Get retrieves resource at uri.
+func (c *SchemeUpgradeClient) Get(uri string) (Message, error) {
+	return c.GetWithContext(context.Background(), uri)
+}
+
+// GetWithContext retrieves resource at uri, following redirects to allowed schemes.
+func (c *SchemeUpgradeClient) GetWithContext(ctx context.Context, uri string) (Message, error) {
+	maxRedirects := c.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	u, err := ParseCoAPURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	for redirects := 0; ; redirects++ {
+		resp, err := c.get(ctx, u)
+		if err != nil || resp.Code() != MovedPermanently {
+			return resp, err
+		}
+		if redirects == maxRedirects {
+			return resp, ErrTooManyRedirects
+		}
+		next, err := redirectURI(u, resp)
+		if err != nil {
+			return resp, err
+		}
+		if next.Scheme != u.Scheme && !c.allowed(next.Scheme) {
+			return resp, ErrSchemeNotAllowed
+		}
+		u = next
+	}
+}
+
+func (c *SchemeUpgradeClient) allowed(scheme string) bool {
+	for _, s := range c.Schemes {
+		if strings.ToLower(s) == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *SchemeUpgradeClient) get(ctx context.Context, u *CoAPURI) (Message, error) {
+	client := c.Client
+	client.Net = schemeNets[u.Scheme]
+	co, err := client.DialWithContext(ctx, net.JoinHostPort(u.Host, strconv.Itoa(u.Addr.Port)))
+	if err != nil {
+		return nil, err
+	}
+	defer co.Close()
+	req, err := co.NewGetRequest("/" + strings.Join(u.Path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range u.Query {
+		for _, v := range vs {
+			q := k
+			if v != "" {
+				q += "=" + v
+			}
+			req.AddOption(URIQuery, q)
+		}
+	}
+	resp, err := co.ExchangeWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, responseError(resp)
+}
+
+// redirectURI returns alternate URI of redirect resp to request of u.
+func redirectURI(u *CoAPURI, resp Message) (*CoAPURI, error) {
+	scheme, host, port := u.Scheme, u.Host, ""
+	query := url.Values{}
+	for _, q := range resp.Options(LocationQuery) {
+		kv := strings.SplitN(q.(string), "=", 2)
+		v := ""
+		if len(kv) == 2 {
+			v = kv[1]
+		}
+		switch kv[0] {
+		case "scheme":
+			scheme = strings.ToLower(v)
+		case "host":
+			host = v
+		case "port":
+			port = v
+		default:
+			query.Add(kv[0], v)
+		}
+	}
+	if _, ok := schemeNets[scheme]; !ok {
+		return nil, ErrSchemeNotAllowed
+	}
+	b := NewURIBuilder().Scheme(scheme).Host(host)
+	if port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q of redirect", port)
+		}
+		b.Port(p)
+	} else if scheme == u.Scheme {
+		b.Port(u.Addr.Port)
+	}
+	if path := resp.Options(LocationPath); len(path) > 0 {
+		for _, s := range path {
+			b.Path(s.(string))
+		}
+	} else {
+		b.Path(u.Path...)
+	}
+	if len(query) == 0 {
+		query = u.Query
+	}
+	for k, vs := range query {
+		for _, v := range vs {
+			b.QueryParam(k, v)
+		}
+	}
+	next, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return ParseCoAPURI(next)
+}
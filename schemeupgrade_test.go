@@ -0,0 +1,83 @@
+package coap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runLocalSchemeUpgradeServers(t *testing.T) (string, func()) {
+	cert, err := tls.X509KeyPair(CertPEMBlock, KeyPEMBlock)
+	require.NoError(t, err)
+	l, err := coapNet.NewTLSListener("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}}, time.Millisecond*100)
+	require.NoError(t, err)
+	tlsServer := &Server{Listener: l, Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetCode(Content)
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("secure " + r.Msg.PathString()))
+	})}
+	tlsFin := make(chan error, 1)
+	go func() {
+		tlsFin <- tlsServer.ActivateAndServe()
+		l.Close()
+	}()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+
+	s, udpAddr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		resp := w.NewResponse(MovedPermanently)
+		switch r.Msg.PathString() {
+		case "loop":
+		case "http":
+			resp.AddOption(LocationQuery, "scheme=http")
+		default:
+			resp.AddOption(LocationQuery, "scheme=coaps+tcp")
+			resp.AddOption(LocationQuery, "port="+port)
+		}
+		w.WriteMsg(resp)
+	})
+	require.NoError(t, err)
+	return udpAddr, func() {
+		s.Shutdown()
+		<-fin
+		tlsServer.Shutdown()
+		<-tlsFin
+	}
+}
+
+func TestSchemeUpgradeClient(t *testing.T) {
+	udpAddr, shutdown := runLocalSchemeUpgradeServers(t)
+	defer shutdown()
+
+	c := SchemeUpgradeClient{
+		Client:  Client{TLSConfig: &tls.Config{InsecureSkipVerify: true}},
+		Schemes: []string{"coaps+tcp"},
+	}
+	resp, err := c.Get(fmt.Sprintf("coap://%v/a/b", udpAddr))
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code())
+	assert.Equal(t, []byte("secure a/b"), resp.Payload())
+
+	// upgrade to scheme not listed
+	c.Schemes = nil
+	resp, err = c.Get(fmt.Sprintf("coap://%v/a", udpAddr))
+	assert.Equal(t, ErrSchemeNotAllowed, err)
+	assert.Equal(t, MovedPermanently, resp.Code())
+}
+
+func TestSchemeUpgradeClientRedirectLoop(t *testing.T) {
+	udpAddr, shutdown := runLocalSchemeUpgradeServers(t)
+	defer shutdown()
+
+	c := SchemeUpgradeClient{Schemes: []string{"coaps+tcp"}}
+	_, err := c.Get(fmt.Sprintf("coap://%v/loop", udpAddr))
+	assert.Equal(t, ErrTooManyRedirects, err)
+	_, err = c.Get(fmt.Sprintf("coap://%v/http", udpAddr))
+	assert.Equal(t, ErrSchemeNotAllowed, err)
+}
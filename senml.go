@@ -0,0 +1,204 @@
+package coap
+
+import (
+	"fmt"
+	"time"
+)
+
+// senmlDefaultVersion is default SenML version (RFC 8428).
+const senmlDefaultVersion = 10
+
+// senmlRelativeTimeLimit is limit of resolved time under which time is relative to now (2**28).
+const senmlRelativeTimeLimit = 268435456
+
+// SenMLRecord is record of SenML pack (RFC 8428) in JSON representation.
+type SenMLRecord struct {
+	BaseName    string  `json:"bn,omitempty"`
+	BaseTime    float64 `json:"bt,omitempty"`
+	BaseUnit    string  `json:"bu,omitempty"`
+	BaseValue   float64 `json:"bv,omitempty"`
+	BaseSum     float64 `json:"bs,omitempty"`
+	BaseVersion int     `json:"bver,omitempty"`
+
+	Name        string   `json:"n,omitempty"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue *string  `json:"vs,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty"`
+	DataValue   string   `json:"vd,omitempty"`
+	Sum         *float64 `json:"s,omitempty"`
+	Time        float64  `json:"t,omitempty"`
+	UpdateTime  float64  `json:"ut,omitempty"`
+}
+
+func (r *SenMLRecord) valueCount() int {
+	var n int
+	if r.Value != nil {
+		n++
+	}
+	if r.StringValue != nil {
+		n++
+	}
+	if r.BoolValue != nil {
+		n++
+	}
+	if r.DataValue != "" {
+		n++
+	}
+	return n
+}
+
+// senmlNow is replaceable for tests.
+var senmlNow = time.Now
+
+// ResolveSenML converts records to resolved form (RFC 8428 section 4.6): base fields are applied
+// to names, times, units, values and sums and removed, and relative times are converted to absolute.
+func ResolveSenML(records []SenMLRecord) ([]SenMLRecord, error) {
+	var base SenMLRecord
+	now := float64(senmlNow().UnixNano()) / float64(time.Second)
+	resolved := make([]SenMLRecord, 0, len(records))
+	for i, r := range records {
+		if r.BaseVersion != 0 && base.BaseVersion != 0 && r.BaseVersion != base.BaseVersion {
+			return nil, fmt.Errorf("cannot resolve senml record %v: version changed from %v to %v", i, base.BaseVersion, r.BaseVersion)
+		}
+		if r.BaseVersion > senmlDefaultVersion {
+			return nil, fmt.Errorf("cannot resolve senml record %v: unsupported version %v", i, r.BaseVersion)
+		}
+		if r.BaseName != "" {
+			base.BaseName = r.BaseName
+		}
+		if r.BaseTime != 0 {
+			base.BaseTime = r.BaseTime
+		}
+		if r.BaseUnit != "" {
+			base.BaseUnit = r.BaseUnit
+		}
+		if r.BaseValue != 0 {
+			base.BaseValue = r.BaseValue
+		}
+		if r.BaseSum != 0 {
+			base.BaseSum = r.BaseSum
+		}
+		if r.BaseVersion != 0 {
+			base.BaseVersion = r.BaseVersion
+		}
+		if r.valueCount() == 0 && r.Sum == nil {
+			// record which only sets base fields
+			continue
+		}
+		res := SenMLRecord{
+			Name:        base.BaseName + r.Name,
+			Unit:        r.Unit,
+			StringValue: r.StringValue,
+			BoolValue:   r.BoolValue,
+			DataValue:   r.DataValue,
+			Time:        base.BaseTime + r.Time,
+			UpdateTime:  r.UpdateTime,
+		}
+		if base.BaseVersion != 0 && base.BaseVersion != senmlDefaultVersion {
+			res.BaseVersion = base.BaseVersion
+		}
+		if res.Unit == "" {
+			res.Unit = base.BaseUnit
+		}
+		if r.Value != nil {
+			v := base.BaseValue + *r.Value
+			res.Value = &v
+		}
+		if r.Sum != nil {
+			s := base.BaseSum + *r.Sum
+			res.Sum = &s
+		}
+		if res.Time < senmlRelativeTimeLimit {
+			res.Time += now
+		}
+		resolved = append(resolved, res)
+	}
+	return resolved, nil
+}
+
+// SenMLUnitConversion converts value to Unit by Value*Scale + Offset.
+type SenMLUnitConversion struct {
+	Unit   string
+	Scale  float64
+	Offset float64
+}
+
+// NormaliseSenMLUnits converts values and sums of resolved records by conversion of their unit,
+// eg. "°F": {Unit: "Cel", Scale: 5.0 / 9, Offset: -160.0 / 9}. Records are not changed, converted copy is returned.
+func NormaliseSenMLUnits(records []SenMLRecord, unitMap map[string]SenMLUnitConversion) []SenMLRecord {
+	res := make([]SenMLRecord, len(records))
+	for i, r := range records {
+		conv, ok := unitMap[r.Unit]
+		if ok {
+			r.Unit = conv.Unit
+			if r.Value != nil {
+				v := *r.Value*conv.Scale + conv.Offset
+				r.Value = &v
+			}
+			if r.Sum != nil {
+				s := *r.Sum*conv.Scale + conv.Offset
+				r.Sum = &s
+			}
+		}
+		res[i] = r
+	}
+	return res
+}
+
+// SenMLValidationError describes violation of RFC 8428 by record.
+type SenMLValidationError struct {
+	Index   int
+	Message string
+}
+
+func (e SenMLValidationError) Error() string {
+	return fmt.Sprintf("senml record %v: %v", e.Index, e.Message)
+}
+
+func isValidSenMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case i > 0 && (c == '-' || c == ':' || c == '.' || c == '/' || c == '_'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateSenML checks records for violations of RFC 8428: more value fields in record,
+// record without value or sum, invalid resolved name and unsupported version.
+func ValidateSenML(records []SenMLRecord) []SenMLValidationError {
+	var errs []SenMLValidationError
+	add := func(i int, format string, a ...interface{}) {
+		errs = append(errs, SenMLValidationError{Index: i, Message: fmt.Sprintf(format, a...)})
+	}
+	var baseName string
+	for i, r := range records {
+		if r.BaseVersion > senmlDefaultVersion {
+			add(i, "unsupported version %v", r.BaseVersion)
+		}
+		if r.BaseName != "" {
+			baseName = r.BaseName
+		}
+		n := r.valueCount()
+		if n > 1 {
+			add(i, "record contains %v values", n)
+		}
+		if n == 0 && r.Sum == nil {
+			if r.Name != "" || r.Unit != "" || r.Time != 0 || r.UpdateTime != 0 {
+				add(i, "record contains neither value nor sum")
+			}
+			continue
+		}
+		if name := baseName + r.Name; !isValidSenMLName(name) {
+			add(i, "invalid name %q", name)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,99 @@
+package coap
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseSenML(t *testing.T, data string) []SenMLRecord {
+	var records []SenMLRecord
+	require.NoError(t, json.Unmarshal([]byte(data), &records))
+	return records
+}
+
+// RFC 8428 section 5.1.3
+const senmlMultipleMeasurements = `[
+	{"bn":"urn:dev:ow:10e2073a0108006:","bt":1.276020076001e+09,"bu":"A","bver":5,"n":"voltage","u":"V","v":120.1},
+	{"n":"current","t":-5,"v":1.2},
+	{"n":"current","t":-4,"v":1.3},
+	{"n":"current","t":-3,"v":1.4},
+	{"n":"current","t":-2,"v":1.5},
+	{"n":"current","t":-1,"v":1.6},
+	{"n":"current","v":1.7}
+]`
+
+// RFC 8428 section 5.1.6
+const senmlCollectionOfResources = `[
+	{"bn":"urn:dev:ow:10e2073a01080063:","n":"temp","u":"Cel","v":23.1},
+	{"n":"label","vs":"Machine Room"},
+	{"n":"open","vb":false},
+	{"n":"nfc-reader","vd":"aGkgCg"}
+]`
+
+func TestResolveSenML(t *testing.T) {
+	resolved, err := ResolveSenML(parseSenML(t, senmlMultipleMeasurements))
+	require.NoError(t, err)
+	require.Len(t, resolved, 7)
+	assert.Equal(t, "urn:dev:ow:10e2073a0108006:voltage", resolved[0].Name)
+	assert.Equal(t, "V", resolved[0].Unit)
+	assert.Equal(t, 120.1, *resolved[0].Value)
+	assert.Equal(t, 5, resolved[0].BaseVersion)
+	assert.Empty(t, resolved[0].BaseName)
+	for i, r := range resolved[1:] {
+		assert.Equal(t, "urn:dev:ow:10e2073a0108006:current", r.Name)
+		assert.Equal(t, "A", r.Unit)
+		assert.InDelta(t, 1.276020071001e+09+float64(i), r.Time, 1e-6)
+		assert.InDelta(t, 1.2+0.1*float64(i), *r.Value, 1e-9)
+	}
+	assert.Empty(t, ValidateSenML(resolved))
+
+	resolved, err = ResolveSenML(parseSenML(t, senmlCollectionOfResources))
+	require.NoError(t, err)
+	require.Len(t, resolved, 4)
+	assert.Equal(t, "urn:dev:ow:10e2073a01080063:label", resolved[1].Name)
+	assert.Equal(t, "Machine Room", *resolved[1].StringValue)
+	assert.False(t, *resolved[2].BoolValue)
+	assert.Equal(t, "aGkgCg", resolved[3].DataValue)
+}
+
+func TestResolveSenMLRelativeTime(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	senmlNow = func() time.Time { return now }
+	defer func() { senmlNow = time.Now }()
+	resolved, err := ResolveSenML(parseSenML(t, `[{"n":"a","t":-10,"v":1}]`))
+	require.NoError(t, err)
+	assert.Equal(t, float64(1600000000-10), resolved[0].Time)
+}
+
+func TestNormaliseSenMLUnits(t *testing.T) {
+	records := parseSenML(t, `[{"n":"a","u":"°F","v":212},{"n":"b","u":"Cel","v":20}]`)
+	res := NormaliseSenMLUnits(records, map[string]SenMLUnitConversion{
+		"°F": {Unit: "Cel", Scale: 5.0 / 9, Offset: -160.0 / 9},
+	})
+	assert.Equal(t, "Cel", res[0].Unit)
+	assert.InDelta(t, 100, *res[0].Value, 1e-9)
+	assert.Equal(t, 20.0, *res[1].Value)
+	// input is not changed
+	assert.Equal(t, 212.0, *records[0].Value)
+}
+
+func TestValidateSenML(t *testing.T) {
+	assert.Empty(t, ValidateSenML(parseSenML(t, senmlMultipleMeasurements)))
+	assert.Empty(t, ValidateSenML(parseSenML(t, senmlCollectionOfResources)))
+
+	errs := ValidateSenML(parseSenML(t, `[
+		{"n":"a","v":1,"vs":"one"},
+		{"n":"b","u":"V"},
+		{"n":"-c","v":1},
+		{"bver":11,"n":"d","v":1}
+	]`))
+	require.Len(t, errs, 4)
+	for i, e := range errs {
+		assert.Equal(t, i, e.Index)
+	}
+	assert.Contains(t, errs[0].Error(), "2 values")
+}
@@ -112,6 +112,16 @@ func ListenAndServeDTLS(network string, addr string, config *dtls.Config, handle
 	return server.ListenAndServe()
 }
 
+// ListenAndServeWS starts CoAP over WebSockets server (RFC 8323 section 4) on addr with endpoint
+// at coapNet.WSPath, it's secured by TLS (wss) when config is set.
+func ListenAndServeWS(addr string, config *tls.Config, handler Handler) error {
+	server := &Server{Addr: addr, Net: "ws", TLSConfig: config, Handler: handler}
+	if config != nil {
+		server.Net = "ws-tls"
+	}
+	return server.ListenAndServe()
+}
+
 // ActivateAndServe activates a server with a listener from systemd,
 // l and p should not both be non-nil.
 // If both l and p are not nil only p will be used.
@@ -125,7 +135,8 @@ func ActivateAndServe(l Listener, p net.Conn, handler Handler) error {
 type Server struct {
 	// Address to listen on, ":COAP" if empty.
 	Addr string
-	// if "tcp" or "tcp-tls" (COAP over TLS) it will invoke a TCP listener, otherwise an UDP one
+	// if "tcp" or "tcp-tls" (COAP over TLS) it will invoke a TCP listener, "ws" or "ws-tls" a WebSocket one
+	// (RFC 8323 section 4), otherwise an UDP one
 	Net string
 	// TCP Listener to use, this is to aid in systemd's socket activation.
 	Listener Listener
@@ -168,15 +179,66 @@ type Server struct {
 	DisableTCPSignalMessages bool
 	// Disable processes Capabilities and Settings Messages from client - iotivity sends max message size without blockwise.
 	DisablePeerTCPSignalMessageCSMs bool
+	// Count of goroutines which read from UDP socket concurrently and dispatch requests to workers,
+	// it helps multi-core servers under load. Defaults is 1.
+	ReadConcurrency int
+	// Pool of datagram messages and read buffers used by receive path of UDP and DTLS. Request message
+	// is returned to the pool after handler returns. Defaults is nil - pool is disabled.
+	MessagePool *MessagePool
+	// Count of priority levels of outbound queue. Messages with higher priority (see MessagePriority)
+	// are written to connection first. Defaults is 0 - queue is disabled.
+	OutboundPriorityLevels int
+	// Max count of active observations per client address. Observe registration over limit
+	// is answered by 5.03 Service Unavailable. Defaults is 0 - unlimited.
+	MaxObserversPerClient int
+	// If ObserveHeartbeat is set, the last notification of observation is resent as confirmable when handler
+	// doesn't send notification for ObserveHeartbeat, so client can detect lost observation. Defaults is 0 - disabled.
+	ObserveHeartbeat time.Duration
+	// If BlockStreamingHandler is set, it handles PUT and POST requests transferred by Block1 instead of Handler,
+	// so the payload is processed as blocks arrive and it's not buffered whole.
+	BlockStreamingHandler StreamingHandler
+	// If OnAccept is set it is called for connection accepted by TCP, TLS or DTLS listener and
+	// the returned connection is served, eg. with labels attached by WithConnectionLabel.
+	OnAccept func(conn net.Conn) net.Conn
+	// If HandlerTimeout is set, context of request is cancelled when Handler doesn't respond in time
+	// and the request gets 5.03 Service Unavailable. Handlers registered by ServeMux.HandleWithTimeout
+	// use own timeout instead. Defaults is 0 - no timeout.
+	HandlerTimeout time.Duration
+	// If UDPSocketConfig is set, it's applied to UDP socket of server, eg. to enlarge buffers of socket.
+	UDPSocketConfig *coapNet.UDPSocketConfig
+	// If StrictOptionOrder is set, requests whose options are not in ascending order of option number
+	// are answered by 4.00 Bad Request, see ValidateOptionOrder.
+	StrictOptionOrder bool
+	// If CRCValidation is set, requests whose payload doesn't match their PayloadCRC option are
+	// answered by 4.00 Bad Request, see ValidateCRC.
+	CRCValidation bool
+	// If TransmissionParams is set, confirmable requests sent over UDP and DTLS are retransmitted and
+	// exchanges outstanding with every peer are limited by them. Defaults is nil - messages are sent once.
+	TransmissionParams *TransmissionParams
+	// If Instrumentation is set, it receives events of sessions, requests, retransmissions, block-wise
+	// transfers and observations, eg. to export them as Prometheus metrics.
+	Instrumentation Instrumentation
+	// If OnHandshakeError is set it is called with error of every failed handshake of DTLS listener.
+	OnHandshakeError func(err error)
 
 	// UDP packet or TCP connection queue
 	queue chan *Request
 	// Workers count
 	workersCount int32
+	// Count of active UDP readers
+	activeReaders int32
+	// Count of datagrams discarded for version other than 1
+	receivedWrongVersion int64
 
 	sessionUDPMapLock sync.Mutex
 	sessionUDPMap     map[string]networkSession
 
+	observers ObserveRegistry
+	drain     drainState
+	plugins   pluginState
+	cancels   requestCancels
+	inflight  inflightRequests
+
 	doneLock sync.Mutex
 	doneChan chan struct{}
 }
@@ -237,6 +299,11 @@ func (srv *Server) ListenAndServe() error {
 	var err error
 	if addr == "" {
 		switch {
+		case strings.HasPrefix(srv.Net, "ws"):
+			addr = ":80"
+			if strings.HasSuffix(srv.Net, "-tls") {
+				addr = ":443"
+			}
 		case strings.Contains(srv.Net, "-tls"):
 			addr = ":" + strconv.Itoa(DefaultSecurePort)
 		default:
@@ -258,6 +325,17 @@ func (srv *Server) ListenAndServe() error {
 			return fmt.Errorf("cannot listen and serve: %v", err)
 		}
 		defer listener.Close()
+	case "ws", "ws4", "ws6", "ws-tls", "ws4-tls", "ws6-tls":
+		var config *tls.Config
+		if strings.HasSuffix(srv.Net, "-tls") {
+			config = srv.TLSConfig
+		}
+		network := "tcp" + strings.TrimSuffix(strings.TrimPrefix(srv.Net, "ws"), "-tls")
+		listener, err = coapNet.NewWSListener(network, addr, config)
+		if err != nil {
+			return fmt.Errorf("cannot listen and serve: %v", err)
+		}
+		defer listener.Close()
 	case "udp", "udp4", "udp6":
 		a, err := net.ResolveUDPAddr(srv.Net, addr)
 		if err != nil {
@@ -270,6 +348,9 @@ func (srv *Server) ListenAndServe() error {
 		if err := coapNet.SetUDPSocketOptions(l); err != nil {
 			return err
 		}
+		if err := srv.configureUDPSocket(l); err != nil {
+			return err
+		}
 		connUDP = coapNet.NewConnUDP(l, srv.heartBeat(), 2)
 		defer connUDP.Close()
 	case "udp-mcast", "udp4-mcast", "udp6-mcast":
@@ -286,6 +367,9 @@ func (srv *Server) ListenAndServe() error {
 		if err := coapNet.SetUDPSocketOptions(l); err != nil {
 			return err
 		}
+		if err := srv.configureUDPSocket(l); err != nil {
+			return err
+		}
 		connUDP = coapNet.NewConnUDP(l, srv.heartBeat(), 2)
 		defer connUDP.Close()
 		ifaces := srv.UDPMcastInterfaces
@@ -335,6 +419,13 @@ func (srv *Server) initServeDTLS(conn *coapNet.Conn) error {
 	return srv.serveDTLSConnection(newShutdownWithContext(srv.doneChan), conn)
 }
 
+func (srv *Server) configureUDPSocket(conn *net.UDPConn) error {
+	if srv.UDPSocketConfig == nil {
+		return nil
+	}
+	return coapNet.ConfigureUDPSocket(conn, *srv.UDPSocketConfig)
+}
+
 // ActivateAndServe starts a coapserver with the PacketConn or Listener
 // configured in *Server. Its main use is to start a server from systemd.
 func (srv *Server) ActivateAndServe() error {
@@ -350,6 +441,11 @@ func (srv *Server) ActivateAndServe() error {
 				srv.Net = "tcp-tls"
 			}
 			return srv.activateAndServe(nil, coapNet.NewConn(c, srv.heartBeat()), nil)
+		case *coapNet.WSConn:
+			if srv.Net == "" {
+				srv.Net = "ws"
+			}
+			return srv.activateAndServe(nil, coapNet.NewConn(c, srv.heartBeat()), nil)
 		case *coapNet.ConnDTLS:
 			if srv.Net == "" {
 				srv.Net = "udp-dtls"
@@ -359,6 +455,9 @@ func (srv *Server) ActivateAndServe() error {
 			if srv.Net == "" {
 				srv.Net = "udp"
 			}
+			if err := srv.configureUDPSocket(c); err != nil {
+				return err
+			}
 			return srv.activateAndServe(nil, nil, coapNet.NewConnUDP(c, srv.heartBeat(), 2))
 		}
 		return ErrInvalidServerConnParameter
@@ -433,6 +532,7 @@ func (srv *Server) activateAndServe(listener Listener, conn *coapNet.Conn, connU
 	if srv.NotifySessionEndFunc == nil {
 		srv.NotifySessionEndFunc = func(w *ClientConn, err error) {}
 	}
+	srv.observers.setInstrumentation(srv.Instrumentation)
 
 	switch {
 	case listener != nil:
@@ -452,17 +552,18 @@ func (srv *Server) activateAndServe(listener Listener, conn *coapNet.Conn, connU
 	return ErrInvalidServerListenerParameter
 }
 
-// Shutdown shuts down a server. After a call to Shutdown, ListenAndServe and
+// Shutdown shuts down a server and its plugins. After a call to Shutdown, ListenAndServe and
 // ActivateAndServe will return.
 func (srv *Server) Shutdown() error {
 	srv.doneLock.Lock()
-	defer srv.doneLock.Unlock()
 	if srv.doneChan == nil {
+		srv.doneLock.Unlock()
 		return fmt.Errorf("already shutdowned")
 	}
 	close(srv.doneChan)
 	srv.doneChan = nil
-	return nil
+	srv.doneLock.Unlock()
+	return srv.shutdownPlugins(context.Background())
 }
 
 // readTimeout is a helper func to use system timeout if server did not intend to change it.
@@ -494,34 +595,41 @@ func (srv *Server) serveDTLSConnection(ctx *shutdownContext, conn *coapNet.Conn)
 	if err != nil {
 		return err
 	}
-	c := ClientConn{commander: &ClientCommander{session}}
+	srv.drain.addConn(session)
+	defer srv.drain.removeConn(session)
+	c := ClientConn{commander: &ClientCommander{networkSession: session}}
+	sessionStarted(session)
 	srv.NotifySessionNewFunc(&c)
 
-	sessCtx, cancel := context.WithCancel(context.Background())
+	sessCtx, cancel := context.WithCancel(withAcceptedConn(context.Background(), conn.Connection()))
 	defer cancel()
 
 	for {
-		m := make([]byte, ^uint16(0))
-		n, err := conn.ReadWithContext(ctx, m)
+		m := srv.readBuffer()
+		n, err := conn.ReadWithContext(ctx, *m)
 		if err != nil {
+			srv.releaseDgram(nil, m)
 			err := fmt.Errorf("cannot serve UDP connection %v", err)
 			srv.closeSessions(err)
 			return err
 		}
-		msg, err := ParseDgramMessage(m[:n])
+		msg, err := srv.parseDgramMessage(m, n)
 		if err != nil {
 			continue
 		}
 
 		// We will block poller wait loop when
 		// all pool workers are busy.
-		c := ClientConn{commander: &ClientCommander{session}}
-		srv.spawnWorker(&Request{Client: &c, Msg: msg, Ctx: sessCtx, Sequence: c.Sequence()})
+		c := ClientConn{commander: &ClientCommander{networkSession: session}}
+		srv.spawnWorker(srv.newDgramRequest(&c, msg, m, sessCtx))
 	}
 }
 
 // serveListener starts a DTLS listener for the server.
 func (srv *Server) serveDTLSListener(l Listener) error {
+	if dl, ok := l.(*coapNet.DTLSListener); ok && srv.OnHandshakeError != nil {
+		dl.SetHandshakeErrorFunc(srv.OnHandshakeError)
+	}
 	if srv.NotifyStartedFunc != nil {
 		srv.NotifyStartedFunc()
 	}
@@ -536,6 +644,9 @@ func (srv *Server) serveDTLSListener(l Listener) error {
 			return fmt.Errorf("cannot serve dtls: %v", err)
 		}
 		if rw != nil {
+			if srv.OnAccept != nil {
+				rw = srv.OnAccept(rw)
+			}
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -550,10 +661,13 @@ func (srv *Server) serveTCPConnection(ctx *shutdownContext, conn *coapNet.Conn)
 	if err != nil {
 		return err
 	}
-	c := ClientConn{commander: &ClientCommander{session}}
+	srv.drain.addConn(session)
+	defer srv.drain.removeConn(session)
+	c := ClientConn{commander: &ClientCommander{networkSession: session}}
+	sessionStarted(session)
 	srv.NotifySessionNewFunc(&c)
 
-	sessCtx, cancel := context.WithCancel(context.Background())
+	sessCtx, cancel := context.WithCancel(withAcceptedConn(context.Background(), conn.Connection()))
 	defer cancel()
 
 	for {
@@ -584,7 +698,7 @@ func (srv *Server) serveTCPConnection(ctx *shutdownContext, conn *coapNet.Conn)
 
 		// We will block poller wait loop when
 		// all pool workers are busy.
-		c := ClientConn{commander: &ClientCommander{session}}
+		c := ClientConn{commander: &ClientCommander{networkSession: session}}
 		srv.spawnWorker(&Request{Client: &c, Msg: msg, Ctx: sessCtx, Sequence: c.Sequence()})
 	}
 }
@@ -605,6 +719,9 @@ func (srv *Server) serveTCPListener(l Listener) error {
 			return fmt.Errorf("cannot serve tcp: %v", err)
 		}
 		if rw != nil {
+			if srv.OnAccept != nil {
+				rw = srv.OnAccept(rw)
+			}
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -620,11 +737,18 @@ func (srv *Server) closeSessions(err error) {
 	srv.sessionUDPMap = make(map[string]networkSession)
 	srv.sessionUDPMapLock.Unlock()
 	for _, v := range tmp {
-		c := ClientConn{commander: &ClientCommander{v}}
+		srv.observers.removeClient(v.RemoteAddr())
+		c := ClientConn{commander: &ClientCommander{networkSession: v}}
+		sessionEnded(v)
 		srv.NotifySessionEndFunc(&c, err)
 	}
 }
 
+// ObserveRegistry returns registry of active observations.
+func (srv *Server) ObserveRegistry() *ObserveRegistry {
+	return &srv.observers
+}
+
 func (srv *Server) getOrCreateUDPSession(connUDP *coapNet.ConnUDP, s *coapNet.ConnUDPContext) (networkSession, error) {
 	srv.sessionUDPMapLock.Lock()
 	defer srv.sessionUDPMapLock.Unlock()
@@ -635,13 +759,19 @@ func (srv *Server) getOrCreateUDPSession(connUDP *coapNet.ConnUDP, s *coapNet.Co
 		if err != nil {
 			return nil, err
 		}
-		c := ClientConn{commander: &ClientCommander{session}}
+		c := ClientConn{commander: &ClientCommander{networkSession: session}}
+		sessionStarted(session)
 		srv.NotifySessionNewFunc(&c)
 		srv.sessionUDPMap[s.Key()] = session
 	}
 	return session, nil
 }
 
+type udpReaderResult struct {
+	err        error
+	readFailed bool
+}
+
 // serveUDP starts a UDP listener for the server.
 func (srv *Server) serveUDP(ctx *shutdownContext, connUDP *coapNet.ConnUDP) error {
 	if srv.NotifyStartedFunc != nil {
@@ -651,39 +781,108 @@ func (srv *Server) serveUDP(ctx *shutdownContext, connUDP *coapNet.ConnUDP) erro
 	sessCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	readers := srv.ReadConcurrency
+	if readers < 1 {
+		readers = 1
+	}
+	readCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	results := make(chan udpReaderResult, readers)
+	for i := 0; i < readers; i++ {
+		go func() {
+			atomic.AddInt32(&srv.activeReaders, 1)
+			res := srv.readUDP(readCtx, sessCtx, connUDP)
+			atomic.AddInt32(&srv.activeReaders, -1)
+			results <- res
+		}()
+	}
+	res := <-results
+	stop()
+	for i := 1; i < readers; i++ {
+		<-results
+	}
+	if res.readFailed {
+		srv.closeSessions(res.err)
+	}
+	return res.err
+}
+
+func (srv *Server) readUDP(ctx context.Context, sessCtx context.Context, connUDP *coapNet.ConnUDP) udpReaderResult {
 	for {
-		m := make([]byte, ^uint16(0))
-		n, s, err := connUDP.ReadWithContext(ctx, m)
+		m := srv.readBuffer()
+		n, s, err := connUDP.ReadWithContext(ctx, *m)
 		if err != nil {
-			err := fmt.Errorf("cannot serve UDP connection %v", err)
-			srv.closeSessions(err)
-			return err
+			srv.releaseDgram(nil, m)
+			return udpReaderResult{err: fmt.Errorf("cannot serve UDP connection %v", err), readFailed: true}
 		}
-		m = m[:n]
 
 		session, err := srv.getOrCreateUDPSession(connUDP, s)
 		if err != nil {
-			return err
+			return udpReaderResult{err: err}
 		}
 
-		msg, err := ParseDgramMessage(m)
+		msg, err := srv.parseDgramMessage(m, n)
 		if err != nil {
 			continue
 		}
-		c := ClientConn{commander: &ClientCommander{session}}
-		srv.spawnWorker(&Request{Msg: msg, Client: &c, Ctx: sessCtx, Sequence: c.Sequence()})
+		c := ClientConn{commander: &ClientCommander{networkSession: session}}
+		srv.spawnWorker(srv.newDgramRequest(&c, msg, m, sessCtx))
+	}
+}
+
+// ReceivedWrongVersion returns count of datagrams discarded for CoAP version other than 1.
+func (srv *Server) ReceivedWrongVersion() int64 {
+	return atomic.LoadInt64(&srv.receivedWrongVersion)
+}
+
+// ActiveReaders returns count of goroutines reading from UDP socket.
+func (srv *Server) ActiveReaders() int {
+	return int(atomic.LoadInt32(&srv.activeReaders))
+}
+
+func (srv *Server) newDgramRequest(c *ClientConn, msg *DgramMessage, buf *[]byte, ctx context.Context) *Request {
+	r := &Request{Msg: msg, Client: c, Ctx: ctx, Sequence: c.Sequence()}
+	if srv.MessagePool != nil {
+		r.pooledMsg = msg
+		r.pooledBuf = buf
 	}
+	return r
 }
 
 func (srv *Server) serve(r *Request) {
+	session := r.Client.networkSession()
+	srv.drain.begin(session)
+	defer srv.drain.end(session)
+	release := srv.withRequestCancel(r)
+	defer release()
 	w := responseWriterFromRequest(r)
+	if srv.rejectUnorderedOptions(w, r) || srv.rejectCorruptedPayload(w, r) {
+		return
+	}
+	end, ok := srv.beginRequest(r)
+	if !ok {
+		return
+	}
+	defer end()
+	handled := false
 	handlePairMsg(w, r, func(w ResponseWriter, r *Request) {
-		handleSignalMsg(w, r, func(w ResponseWriter, r *Request) {
-			handleBySessionTokenHandler(w, r, func(w ResponseWriter, r *Request) {
-				handleBlockWiseMsg(w, r, srv.serveCOAP)
+		srv.handleResetMsg(w, r, func(w ResponseWriter, r *Request) {
+			handleSignalMsg(w, r, func(w ResponseWriter, r *Request) {
+				handleBySessionTokenHandler(w, r, func(w ResponseWriter, r *Request) {
+					srv.handleBlockStreamingMsg(w, r, func(w ResponseWriter, r *Request) {
+						handleBlockWiseMsg(w, r, func(w ResponseWriter, r *Request) {
+							handled = true
+							srv.handleObserveMsg(w, r, srv.serveCOAP)
+						})
+					})
+				})
 			})
 		})
 	})
+	// message passed to pair or token handler may be still used by receiver
+	if handled && r.pooledBuf != nil {
+		srv.releaseDgram(r.pooledMsg, r.pooledBuf)
+	}
 }
 
 func (srv *Server) serveCOAP(w ResponseWriter, r *Request) {
@@ -691,5 +890,12 @@ func (srv *Server) serveCOAP(w ResponseWriter, r *Request) {
 	if handler == nil || reflect.ValueOf(handler).IsNil() {
 		handler = DefaultServeMux
 	}
+	w = &drainingResponseWriter{ResponseWriter: w, srv: srv}
+	w = srv.instrumentRequest(w, r)
+	handler = srv.applyMiddlewares(handler)
+	if srv.HandlerTimeout > 0 {
+		serveWithTimeout(handler, w, r, srv.HandlerTimeout)
+		return
+	}
 	handler.ServeCOAP(w, r) // Writes back to the client
 }
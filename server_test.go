@@ -782,10 +782,9 @@ func benchmarkServeTCPStreamWithMsg(b *testing.B, req *TcpMessage) {
 			abc.SetToken(token)
 			resp, err := co.Exchange(&abc)
 			if err != nil {
-				b.Fatalf("unable to read msg from server: %v", err)
-			}
-			if !bytes.Equal(resp.Payload(), res.Payload()) {
-				b.Fatalf("bad payload: %v", err)
+				b.Errorf("unable to read msg from server: %v", err)
+			} else if !bytes.Equal(resp.Payload(), res.Payload()) {
+				b.Errorf("bad payload: %v", err)
 			}
 			sync <- true
 		}(i)
@@ -875,3 +874,44 @@ zDCJkckCgYEAndqM5KXGk5xYo+MAA1paZcbTUXwaWwjLU+XSRSSoyBEi5xMtfvUb
 kFsxKCqxAnBVGEWAvVZAiiTOxleQFjz5RnL0BQp9Lg2cQe+dvuUmIAA=
 -----END RSA PRIVATE KEY-----`)
 )
+
+// TestServingUDPReadConcurrency is meant to be run with -race.
+func TestServingUDPReadConcurrency(t *testing.T) {
+	const readers = 4
+	srv := &Server{ReadConcurrency: readers, Handler: HandlerFunc(EchoServer)}
+	addr, shutdown := runLocalUDPServer(t, srv)
+	defer shutdown()
+
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			co, err := Dial("udp", addr)
+			if err != nil {
+				t.Errorf("cannot dial: %v", err)
+				return
+			}
+			defer co.Close()
+			for j := 0; j < 50; j++ {
+				payload := fmt.Sprintf("%v-%v", i, j)
+				resp, err := co.Post("/echo", TextPlain, strings.NewReader(payload))
+				if err != nil {
+					t.Errorf("cannot post: %v", err)
+					return
+				}
+				if string(resp.Payload()) != payload {
+					t.Errorf("unexpected payload %q, expected %q", resp.Payload(), payload)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := srv.ActiveReaders(); n != readers {
+		t.Fatalf("unexpected count of active readers %v", n)
+	}
+	shutdown()
+	if n := srv.ActiveReaders(); n != 0 {
+		t.Fatalf("readers were not stopped: %v", n)
+	}
+}
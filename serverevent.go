@@ -0,0 +1,95 @@
+package coap
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// ServerEvent pushes payload to path of conn by NON POST without client opt-in, unlike Observe.
+// The client receives it by Client.Handler, eg. EventBus.ServeCOAP.
+func ServerEvent(ctx context.Context, conn NotificationConn, path string, payload []byte, contentFormat MediaType) error {
+	token, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+	msg := conn.NewMessage(MessageParams{
+		Type:      NonConfirmable,
+		Code:      POST,
+		MessageID: GenerateMessageID(),
+		Token:     token,
+		Payload:   payload,
+	})
+	msg.SetPathString(path)
+	msg.SetOption(ContentFormat, contentFormat)
+	return conn.WriteMsgWithContext(ctx, msg)
+}
+
+// EventBus routes messages by path to subscribers, so the network layer is decoupled from
+// application logic. Publish doesn't block, message is dropped for subscriber whose channel is full.
+type EventBus struct {
+	buffer int
+
+	lock        sync.Mutex
+	subscribers map[string][]chan Message
+}
+
+// NewEventBus creates bus whose subscribers buffer up to buffer messages.
+func NewEventBus(buffer int) *EventBus {
+	return &EventBus{
+		buffer:      buffer,
+		subscribers: make(map[string][]chan Message),
+	}
+}
+
+// eventPath makes "/a/b" and "a/b" same path, as PathString of message has no leading slash.
+func eventPath(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// Subscribe returns channel receiving messages published to path.
+func (b *EventBus) Subscribe(path string) <-chan Message {
+	path = eventPath(path)
+	ch := make(chan Message, b.buffer)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.subscribers[path] = append(b.subscribers[path], ch)
+	return ch
+}
+
+// Unsubscribe removes subscription created by Subscribe and closes its channel.
+func (b *EventBus) Unsubscribe(path string, ch <-chan Message) {
+	path = eventPath(path)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	subs := b.subscribers[path]
+	for i, s := range subs {
+		if s == ch {
+			close(s)
+			b.subscribers[path] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(b.subscribers[path]) == 0 {
+		delete(b.subscribers, path)
+	}
+}
+
+// Publish sends msg to subscribers of path.
+func (b *EventBus) Publish(path string, msg Message) {
+	path = eventPath(path)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, ch := range b.subscribers[path] {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// ServeCOAP publishes received message to its path, it's used as Client.Handler to receive
+// messages of ServerEvent.
+func (b *EventBus) ServeCOAP(w ResponseWriter, r *Request) {
+	b.Publish(r.Msg.PathString(), r.Msg)
+}
@@ -0,0 +1,82 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveEvents(t *testing.T, ch <-chan Message, n int) []string {
+	var payloads []string
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-ch:
+			payloads = append(payloads, string(msg.Payload()))
+		case <-time.After(time.Second * 2):
+			require.FailNow(t, "event not received", "got %v of %v", i, n)
+		}
+	}
+	select {
+	case msg := <-ch:
+		require.FailNow(t, "unexpected event", "%v", string(msg.Payload()))
+	case <-time.After(time.Millisecond * 100):
+	}
+	return payloads
+}
+
+func TestServerEvent(t *testing.T) {
+	conns := make(chan *ClientConn, 1)
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", "127.0.0.1:0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		conns <- r.Client
+		w.SetCode(Changed)
+		w.Write(nil)
+	})
+	require.NoError(t, err)
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	bus := NewEventBus(10)
+	a := bus.Subscribe("path/a")
+	b := bus.Subscribe("/path/b")
+	co, err := (&Client{Handler: bus.ServeCOAP}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+	_, err = co.Get("/register")
+	require.NoError(t, err)
+	conn := <-conns
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ServerEvent(context.Background(), conn, "/path/a", []byte(fmt.Sprintf("a%v", i)), TextPlain))
+		// keep order of events, NON messages are not acknowledged
+		time.Sleep(time.Millisecond * 10)
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, ServerEvent(context.Background(), conn, "/path/b", []byte(fmt.Sprintf("b%v", i)), TextPlain))
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, []string{"a0", "a1", "a2"}, receiveEvents(t, a, 3))
+	assert.Equal(t, []string{"b0", "b1"}, receiveEvents(t, b, 2))
+}
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus(1)
+	ch := bus.Subscribe("a")
+	msg := NewDgramMessage(MessageParams{Type: NonConfirmable, Code: POST, Payload: []byte("1")})
+	bus.Publish("/a", msg)
+	// subscriber's channel is full, message is dropped
+	bus.Publish("a", msg)
+	bus.Publish("b", msg)
+	assert.Equal(t, []string{"1"}, receiveEvents(t, ch, 1))
+
+	bus.Unsubscribe("a", ch)
+	_, ok := <-ch
+	assert.False(t, ok)
+	bus.Publish("a", msg)
+	assert.Empty(t, bus.subscribers)
+}
@@ -3,7 +3,11 @@ package coap
 
 import (
 	"errors"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/go-ocf/go-coap/linkformat"
 )
 
 // ServeMux is an COAP request multiplexer. It matches the
@@ -13,18 +17,32 @@ import (
 // ServeMux is also safe for concurrent access from multiple goroutines.
 type ServeMux struct {
 	z              map[string]muxEntry
+	templates      []*uriTemplateEntry
+	labelled       map[connLabel]map[string]muxEntry
 	m              *sync.RWMutex
 	defaultHandler Handler
+	middlewares    []MiddlewareFunc
 }
 
 type muxEntry struct {
 	h       Handler
 	pattern string
+	link    *linkformat.Link // set when resource is listed in /.well-known/core
+}
+
+type connLabel struct {
+	key   string
+	value string
+}
+
+type uriTemplateEntry struct {
+	h        Handler
+	template *uriTemplate
 }
 
 // NewServeMux allocates and returns a new ServeMux.
 func NewServeMux() *ServeMux {
-	return &ServeMux{z: make(map[string]muxEntry), m: new(sync.RWMutex), defaultHandler: HandlerFunc(HandleFailed)}
+	return &ServeMux{z: make(map[string]muxEntry), labelled: make(map[connLabel]map[string]muxEntry), m: new(sync.RWMutex), defaultHandler: HandlerFunc(HandleFailed)}
 }
 
 // DefaultServeMux is the default ServeMux used by Serve.
@@ -53,8 +71,12 @@ func pathMatch(pattern, path string) bool {
 func (mux *ServeMux) match(path string) (h Handler, pattern string) {
 	mux.m.RLock()
 	defer mux.m.RUnlock()
+	return matchEntries(mux.z, path)
+}
+
+func matchEntries(z map[string]muxEntry, path string) (h Handler, pattern string) {
 	var n = 0
-	for k, v := range mux.z {
+	for k, v := range z {
 		if !pathMatch(k, path) {
 			continue
 		}
@@ -88,6 +110,197 @@ func (mux *ServeMux) Handle(pattern string, handler Handler) error {
 	return nil
 }
 
+// HandleResource adds a handler to the ServeMux for pattern and lists the resource with attributes
+// of link in /.well-known/core, which is served by the ServeMux unless a handler is registered for it.
+// Target of link defaults to pattern.
+func (mux *ServeMux) HandleResource(pattern string, handler Handler, link linkformat.Link) error {
+	if err := mux.Handle(pattern, handler); err != nil {
+		return err
+	}
+	key := pattern
+	switch key {
+	case "", "/":
+		key = "/"
+	default:
+		key = strings.TrimPrefix(key, "/")
+	}
+	if link.Target == "" {
+		link.Target = "/" + strings.TrimPrefix(key, "/")
+	}
+	mux.m.Lock()
+	defer mux.m.Unlock()
+	e := mux.z[key]
+	e.link = &link
+	mux.z[key] = e
+	return nil
+}
+
+// Links returns links of resources registered by HandleResource sorted by target.
+func (mux *ServeMux) Links() []linkformat.Link {
+	mux.m.RLock()
+	var links []linkformat.Link
+	for _, e := range mux.z {
+		if e.link != nil {
+			links = append(links, *e.link)
+		}
+	}
+	mux.m.RUnlock()
+	linkformat.SortByTarget(links)
+	return links
+}
+
+// wellKnownCoreHandler returns handler of /.well-known/core generated from Links, nil when path
+// is another one or no resource is registered by HandleResource.
+func (mux *ServeMux) wellKnownCoreHandler(path string) Handler {
+	if "/"+path != WellKnownCorePath {
+		return nil
+	}
+	links := mux.Links()
+	if len(links) == 0 {
+		return nil
+	}
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Msg.Code() != GET {
+			w.SetCode(MethodNotAllowed)
+			w.Write(nil)
+			return
+		}
+		// RFC 6690 section 4.1, single query parameter filters links
+		if q := r.Msg.Query(); len(q) > 0 {
+			links = linkformat.Filter(links, q[0])
+		}
+		if len(links) == 0 {
+			w.Write(nil)
+			return
+		}
+		w.SetContentFormat(AppLinkFormat)
+		w.Write([]byte(linkformat.Format(links)))
+	})
+}
+
+// HandleWithTimeout adds a handler to the ServeMux for pattern, which is served with own timeout
+// instead of Server.HandlerTimeout, see TimeoutHandler.
+func (mux *ServeMux) HandleWithTimeout(pattern string, handler Handler, timeout time.Duration) error {
+	if handler == nil {
+		return errors.New("nil handler")
+	}
+	return mux.Handle(pattern, TimeoutHandler(handler, timeout))
+}
+
+// HandleForLabel adds a handler to the ServeMux for pattern, it serves only requests received by
+// connection labelled key=value (see WithConnectionLabel). Labelled handlers take precedence over
+// handlers registered by Handle.
+func (mux *ServeMux) HandleForLabel(key, value, pattern string, handler Handler) error {
+	switch pattern {
+	case "", "/":
+		pattern = "/"
+	default:
+		if pattern[0] == '/' {
+			pattern = pattern[1:]
+		}
+	}
+
+	if handler == nil {
+		return errors.New("nil handler")
+	}
+
+	l := connLabel{key: key, value: value}
+	mux.m.Lock()
+	defer mux.m.Unlock()
+	if mux.labelled == nil {
+		mux.labelled = make(map[connLabel]map[string]muxEntry)
+	}
+	if mux.labelled[l] == nil {
+		mux.labelled[l] = make(map[string]muxEntry)
+	}
+	mux.labelled[l][pattern] = muxEntry{h: handler, pattern: pattern}
+	return nil
+}
+
+func (mux *ServeMux) matchLabelled(r *Request) Handler {
+	mux.m.RLock()
+	defer mux.m.RUnlock()
+	if len(mux.labelled) == 0 {
+		return nil
+	}
+	conn, ok := ConnFromRequest(r)
+	if !ok {
+		return nil
+	}
+	c, ok := conn.(*labelledConn)
+	if !ok {
+		return nil
+	}
+	var h Handler
+	var n int
+	for k, v := range c.labels {
+		z, ok := mux.labelled[connLabel{key: k, value: v}]
+		if !ok {
+			continue
+		}
+		if lh, pattern := matchEntries(z, r.Msg.PathString()); lh != nil && (h == nil || len(pattern) > n) {
+			h, n = lh, len(pattern)
+		}
+	}
+	return h
+}
+
+// HandleTemplate adds a handler to the ServeMux for RFC 6570 URI template (Level 1-3),
+// eg. "/sensors/{sensorId}/readings{?limit,offset}". Templates are tried in order
+// of registration when no pattern matches the request, so first registered wins.
+// Bound variables are available to the handler via URITemplateVars.
+func (mux *ServeMux) HandleTemplate(template string, handler Handler) error {
+	if handler == nil {
+		return errors.New("nil handler")
+	}
+	if template == "" || template[0] != '/' {
+		template = "/" + template
+	}
+	t, err := parseURITemplate(template)
+	if err != nil {
+		return err
+	}
+
+	mux.m.Lock()
+	mux.templates = append(mux.templates, &uriTemplateEntry{h: handler, template: t})
+	mux.m.Unlock()
+	return nil
+}
+
+// HandleTemplateFunc adds a handler function to the ServeMux for URI template.
+func (mux *ServeMux) HandleTemplateFunc(template string, handler func(w ResponseWriter, r *Request)) {
+	mux.HandleTemplate(template, HandlerFunc(handler))
+}
+
+func (mux *ServeMux) matchTemplate(uri string) (Handler, map[string]string) {
+	mux.m.RLock()
+	defer mux.m.RUnlock()
+	for _, e := range mux.templates {
+		if vars, ok := e.template.match(uri); ok {
+			return e.h, vars
+		}
+	}
+	return nil, nil
+}
+
+// Use adds middleware applied to handler matched by the ServeMux, including the default one.
+// Middleware added first is the outermost one.
+func (mux *ServeMux) Use(mw MiddlewareFunc) {
+	mux.m.Lock()
+	mux.middlewares = append(mux.middlewares, mw)
+	mux.m.Unlock()
+}
+
+func (mux *ServeMux) applyMiddlewares(h Handler) Handler {
+	mux.m.RLock()
+	mws := mux.middlewares
+	mux.m.RUnlock()
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
 // DefaultHandle set default handler to the ServeMux
 func (mux *ServeMux) DefaultHandle(handler Handler) {
 	mux.m.Lock()
@@ -113,10 +326,21 @@ func (mux *ServeMux) HandleRemove(pattern string) error {
   }
 	mux.m.Lock()
   defer mux.m.Unlock()
-  if _, ok := mux.z[pattern]; ok {
-    delete(mux.z, pattern)
+	key := pattern
+	if key != "/" && key[0] == '/' {
+		// Handle registers pattern without leading slash
+		key = key[1:]
+	}
+  if _, ok := mux.z[key]; ok {
+    delete(mux.z, key)
     return nil
   }
+	for i, e := range mux.templates {
+		if e.template.template == pattern || e.template.template == "/"+pattern {
+			mux.templates = append(mux.templates[:i], mux.templates[i+1:]...)
+			return nil
+		}
+	}
 	return errors.New("pattern is not registered in")
 }
 
@@ -126,14 +350,30 @@ func (mux *ServeMux) HandleRemove(pattern string) error {
 // is sought.
 // If no handler is found a standard NotFound message is returned
 func (mux *ServeMux) ServeCOAP(w ResponseWriter, r *Request) {
-	h, _ := mux.match(r.Msg.PathString())
+	h := mux.matchLabelled(r)
+	if h == nil {
+		h, _ = mux.match(r.Msg.PathString())
+	}
+	if h == nil {
+		h = mux.wellKnownCoreHandler(r.Msg.PathString())
+	}
+	if h == nil {
+		uri := "/" + r.Msg.PathString()
+		if query := r.Msg.QueryString(); query != "" {
+			uri += "?" + query
+		}
+		var vars map[string]string
+		if h, vars = mux.matchTemplate(uri); h != nil {
+			r = withURITemplateVars(r, vars)
+		}
+	}
 	if h == nil {
 		h = mux.defaultHandler
 		if h == nil {
 			h = failedHandler()
 		}
 	}
-	h.ServeCOAP(w, r)
+	mux.applyMiddlewares(h).ServeCOAP(w, r)
 }
 
 // Handle registers the handler with the given pattern
@@ -147,6 +387,10 @@ func HandleFunc(pattern string, handler func(w ResponseWriter, r *Request)) {
 	DefaultServeMux.HandleFunc(pattern, handler)
 }
 
+// HandleTemplate registers the handler with the given URI template
+// in the DefaultServeMux.
+func HandleTemplate(template string, handler Handler) { DefaultServeMux.HandleTemplate(template, handler) }
+
 // HandleRemove deregisters the handle with the given pattern
 // in the DefaultServeMux.
 func HandleRemove(pattern string) { DefaultServeMux.HandleRemove(pattern) }
@@ -0,0 +1,69 @@
+package coap
+
+import (
+	"testing"
+
+	"github.com/go-ocf/go-coap/linkformat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeMuxWellKnownCore(t *testing.T) {
+	mux := NewServeMux()
+	handler := HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(r.Msg.PathString()))
+	})
+	require.NoError(t, mux.HandleResource("/sensors/temp", handler, linkformat.Link{ResourceTypes: []string{"temperature-c"}, ContentFormats: []uint16{uint16(TextPlain)}, Observable: true}))
+	require.NoError(t, mux.HandleResource("/sensors/light", handler, linkformat.Link{ResourceTypes: []string{"light-lux"}, Title: "Light"}))
+	require.NoError(t, mux.Handle("/hidden", handler))
+	addr, shutdown := runLocalUDPServer(t, &Server{Handler: mux})
+	defer shutdown()
+	co, err := Dial("udp", addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	resp, err := co.Get("/sensors/temp")
+	require.NoError(t, err)
+	assert.Equal(t, "sensors/temp", string(resp.Payload()))
+
+	discover := func(query string) []linkformat.Link {
+		req, err := co.NewGetRequest(WellKnownCorePath)
+		require.NoError(t, err)
+		if query != "" {
+			req.SetQueryString(query)
+		}
+		resp, err := co.Exchange(req)
+		require.NoError(t, err)
+		require.Equal(t, Content, resp.Code())
+		if len(resp.Payload()) > 0 {
+			assert.Equal(t, AppLinkFormat, resp.Option(ContentFormat))
+		}
+		links, err := linkformat.Parse(string(resp.Payload()))
+		require.NoError(t, err)
+		return links
+	}
+	links := discover("")
+	require.Len(t, links, 2)
+	assert.Equal(t, "/sensors/light", links[0].Target)
+	assert.Equal(t, "Light", links[0].Title)
+	assert.Equal(t, "/sensors/temp", links[1].Target)
+	assert.True(t, links[1].Observable)
+
+	links = discover("rt=temperature-c")
+	require.Len(t, links, 1)
+	assert.Equal(t, "/sensors/temp", links[0].Target)
+	links = discover("href=/sensors/l*")
+	require.Len(t, links, 1)
+	assert.Equal(t, "/sensors/light", links[0].Target)
+	assert.Empty(t, discover("rt=unknown"))
+
+	// registered handler takes precedence over generated document
+	mux.HandleFunc(WellKnownCorePath, func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(AppLinkFormat)
+		w.Write([]byte("</custom>"))
+	})
+	links = discover("")
+	require.Len(t, links, 1)
+	assert.Equal(t, "/custom", links[0].Target)
+}
@@ -22,6 +22,9 @@ type sessionBase struct {
 	blockWiseTransferSzx uint32                                         //BlockWiseSzx
 	mapPairs             map[[MaxTokenSize]byte]map[uint16]*sessionResp //storage of channel Message
 	mapPairsLock         sync.Mutex                                     //to sync add remove token
+	writeQueue           *priorityWriteQueue                            //nil when priority queue is disabled
+	transmission         *transmission                                  //nil when messages are sent once
+	instrumented         int32                                          //1 when start of session was reported, 2 when its end
 }
 
 func (s *sessionBase) blockWiseSzx() BlockWiseSzx {
@@ -119,6 +122,9 @@ func (s *sessionBase) exchangeWithContext(ctx context.Context, req Message, writ
 
 	defer s.removeSessionResp(req.Token(), req.MessageID())
 
+	if s.transmission != nil {
+		return s.transmission.exchange(ctx, req, pairChan, writeMsgWithContext)
+	}
 	err = writeMsgWithContext(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("cannot exchange: %v", err)
@@ -135,6 +141,10 @@ func (s *sessionBase) exchangeWithContext(ctx context.Context, req Message, writ
 }
 
 func validateMsg(msg Message) error {
+	if msg.Option(OSCORE) != nil {
+		// payload is ciphertext, Content-Format is protected
+		return nil
+	}
 	if msg.Payload() != nil && msg.Option(ContentFormat) == nil {
 		return ErrContentFormatNotSet
 	}
@@ -155,5 +165,8 @@ func (s *sessionBase) handlePairMsg(w ResponseWriter, r *Request) bool {
 		}
 		return true
 	}
+	if s.transmission != nil && r.Msg.Type() == Acknowledgement && r.Msg.Code() == Empty {
+		return s.transmission.handleAck(r.Msg.MessageID())
+	}
 	return false
 }
@@ -37,6 +37,8 @@ func newSessionDTLS(connection *coapNet.Conn, srv *Server) (networkSession, erro
 			blockWiseTransfer:    BlockWiseTransfer,
 			blockWiseTransferSzx: uint32(BlockWiseTransferSzx),
 			mapPairs:             make(map[[MaxTokenSize]byte]map[uint16](*sessionResp)),
+			writeQueue:           newPriorityWriteQueue(srv.OutboundPriorityLevels),
+			transmission:         newTransmission(srv.TransmissionParams, func() { srv.instrumentation().Retransmitted(TransportDTLS) }),
 		},
 	}
 
@@ -86,7 +88,9 @@ func (s *sessionDTLS) PingWithContext(ctx context.Context) error {
 
 func (s *sessionDTLS) closeWithError(err error) error {
 	if s.connection != nil {
-		c := ClientConn{commander: &ClientCommander{s}}
+		s.srv.observers.removeClient(s.RemoteAddr())
+		c := ClientConn{commander: &ClientCommander{networkSession: s}}
+		sessionEnded(s)
 		s.srv.NotifySessionEndFunc(&c, err)
 		e := s.connection.Close()
 		//s.connection = nil
@@ -119,12 +123,15 @@ func (s *sessionDTLS) ExchangeWithContext(ctx context.Context, req Message) (Mes
 
 // Write implements the networkSession.Write method.
 func (s *sessionDTLS) WriteMsgWithContext(ctx context.Context, req Message) error {
+	priority := messagePriority(req)
 	buffer := bytes.NewBuffer(make([]byte, 0, 1500))
-	err := req.MarshalBinary(buffer)
+	err := withoutPriority(req).MarshalBinary(buffer)
 	if err != nil {
 		return fmt.Errorf("cannot write msg to tcp connection %v", err)
 	}
-	return s.connection.WriteWithContext(ctx, buffer.Bytes())
+	return s.writeQueue.write(ctx, priority, func() error {
+		return s.connection.WriteWithContext(ctx, buffer.Bytes())
+	})
 }
 
 func (s *sessionDTLS) sendPong(w ResponseWriter, r *Request) error {
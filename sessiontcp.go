@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
 
 	coapNet "github.com/go-ocf/go-coap/net"
@@ -17,6 +18,10 @@ type sessionTCP struct {
 	peerBlockWiseTransfer           uint32
 	peerMaxMessageSize              uint32
 	disablePeerTCPSignalMessageCSMs bool
+
+	releaseLock          sync.Mutex
+	released             bool
+	alternativeAddresses []string // advertised by Release signal of peer
 }
 
 // newSessionTCP create new session for TCP connection
@@ -39,6 +44,7 @@ func newSessionTCP(connection *coapNet.Conn, srv *Server) (networkSession, error
 			blockWiseTransfer:    BlockWiseTransfer,
 			blockWiseTransferSzx: uint32(BlockWiseTransferSzx),
 			mapPairs:             make(map[[MaxTokenSize]byte]map[uint16](*sessionResp)),
+			writeQueue:           newPriorityWriteQueue(srv.OutboundPriorityLevels),
 		},
 	}
 
@@ -106,7 +112,9 @@ func (s *sessionTCP) PingWithContext(ctx context.Context) error {
 
 func (s *sessionTCP) closeWithError(err error) error {
 	if s.connection != nil {
-		c := ClientConn{commander: &ClientCommander{s}}
+		s.srv.observers.removeClient(s.RemoteAddr())
+		c := ClientConn{commander: &ClientCommander{networkSession: s}}
+		sessionEnded(s)
 		s.srv.NotifySessionEndFunc(&c, err)
 		e := s.connection.Close()
 		//s.connection = nil
@@ -156,6 +164,8 @@ func (s *sessionTCP) validateMessageSize(msg Message) error {
 
 // Write implements the networkSession.Write method.
 func (s *sessionTCP) WriteMsgWithContext(ctx context.Context, req Message) error {
+	priority := messagePriority(req)
+	req = withoutPriority(req)
 	if err := s.validateMessageSize(req); err != nil {
 		return err
 	}
@@ -164,7 +174,9 @@ func (s *sessionTCP) WriteMsgWithContext(ctx context.Context, req Message) error
 	if err != nil {
 		return fmt.Errorf("cannot write msg to tcp connection %v", err)
 	}
-	return s.connection.WriteWithContext(ctx, buffer.Bytes())
+	return s.writeQueue.write(ctx, priority, func() error {
+		return s.connection.WriteWithContext(ctx, buffer.Bytes())
+	})
 }
 
 func (s *sessionTCP) sendCSM() error {
@@ -245,9 +257,13 @@ func (s *sessionTCP) handleSignals(w ResponseWriter, r *Request) bool {
 		s.sendPong(w, r)
 		return true
 	case Release:
-		if _, ok := r.Msg.Option(AlternativeAddress).(string); ok {
-			//TODO
+		var addrs []string
+		for _, a := range r.Msg.Options(AlternativeAddress) {
+			if addr, ok := a.(string); ok {
+				addrs = append(addrs, addr)
+			}
 		}
+		s.setReleased(addrs)
 		return true
 	case Abort:
 		if _, ok := r.Msg.Option(BadCSMOption).(uint32); ok {
@@ -1,10 +1,10 @@
 package coap
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"net"
+	"sync"
 
 	coapNet "github.com/go-ocf/go-coap/net"
 )
@@ -14,15 +14,30 @@ type connUDP interface {
 	RemoteAddr() net.Addr
 	Close() error
 	ReadWithContext(ctx context.Context, buffer []byte) (int, *coapNet.ConnUDPContext, error)
+	// WriteWithContext must not retain buffer, it's reused after the write.
 	WriteWithContext(ctx context.Context, udpCtx *coapNet.ConnUDPContext, buffer []byte) error
 }
 
 type sessionUDP struct {
 	sessionBase
-	connection     connUDP
+	connection connUDP
+
+	dataLock       sync.Mutex
 	sessionUDPData *coapNet.ConnUDPContext // oob data to get egress interface right
 }
 
+func (s *sessionUDP) udpData() *coapNet.ConnUDPContext {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+	return s.sessionUDPData
+}
+
+func (s *sessionUDP) setUDPData(d *coapNet.ConnUDPContext) {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+	s.sessionUDPData = d
+}
+
 // NewSessionUDP create new session for UDP connection
 func newSessionUDP(connection connUDP, srv *Server, sessionUDPData *coapNet.ConnUDPContext) (networkSession, error) {
 	BlockWiseTransfer := true
@@ -45,6 +60,8 @@ func newSessionUDP(connection connUDP, srv *Server, sessionUDPData *coapNet.Conn
 			blockWiseTransfer:    BlockWiseTransfer,
 			blockWiseTransferSzx: uint32(BlockWiseTransferSzx),
 			mapPairs:             make(map[[MaxTokenSize]byte]map[uint16](*sessionResp)),
+			writeQueue:           newPriorityWriteQueue(srv.OutboundPriorityLevels),
+			transmission:         newTransmission(srv.TransmissionParams, func() { srv.instrumentation().Retransmitted(TransportUDP) }),
 		},
 		connection:     connection,
 		sessionUDPData: sessionUDPData,
@@ -59,7 +76,7 @@ func (s *sessionUDP) LocalAddr() net.Addr {
 
 // RemoteAddr implements the networkSession.RemoteAddr method.
 func (s *sessionUDP) RemoteAddr() net.Addr {
-	return s.sessionUDPData.RemoteAddr()
+	return s.udpData().RemoteAddr()
 }
 
 // BlockWiseTransferEnabled
@@ -73,9 +90,11 @@ func (s *sessionUDP) blockWiseIsValid(szx BlockWiseSzx) bool {
 
 func (s *sessionUDP) closeWithError(err error) error {
 	s.srv.sessionUDPMapLock.Lock()
-	delete(s.srv.sessionUDPMap, s.sessionUDPData.Key())
+	delete(s.srv.sessionUDPMap, s.udpData().Key())
 	s.srv.sessionUDPMapLock.Unlock()
-	c := ClientConn{commander: &ClientCommander{s}}
+	s.srv.observers.removeClient(s.RemoteAddr())
+	c := ClientConn{commander: &ClientCommander{networkSession: s}}
+	sessionEnded(s)
 	s.srv.NotifySessionEndFunc(&c, err)
 
 	return err
@@ -123,12 +142,15 @@ func (s *sessionUDP) ExchangeWithContext(ctx context.Context, req Message) (Mess
 }
 
 func (s *sessionUDP) WriteMsgWithContext(ctx context.Context, req Message) error {
-	buffer := bytes.NewBuffer(make([]byte, 0, 1500))
-	err := req.MarshalBinary(buffer)
+	priority := messagePriority(req)
+	buffer, err := marshalWriteBuffer(withoutPriority(req))
 	if err != nil {
 		return fmt.Errorf("cannot write msg to udp connection %v", err)
 	}
-	return s.connection.WriteWithContext(ctx, s.sessionUDPData, buffer.Bytes())
+	defer putWriteBuffer(buffer)
+	return s.writeQueue.write(ctx, priority, func() error {
+		return s.connection.WriteWithContext(ctx, s.udpData(), *buffer)
+	})
 }
 
 func (s *sessionUDP) sendPong(w ResponseWriter, r *Request) error {
@@ -0,0 +1,281 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// TransmissionParams are transmission parameters of messages over UDP and DTLS (RFC 7252 section 4.8).
+// Start with DefaultTransmissionParams and adjust them, eg. longer AckTimeout for NB-IoT links.
+type TransmissionParams struct {
+	// AckTimeout is initial timeout of acknowledgement of confirmable message, ACK_TIMEOUT. 0 means 2 seconds.
+	AckTimeout time.Duration
+	// AckRandomFactor randomizes initial timeout in [AckTimeout, AckTimeout*AckRandomFactor], ACK_RANDOM_FACTOR.
+	AckRandomFactor float64
+	// MaxRetransmit is count of retransmissions of confirmable message, MAX_RETRANSMIT.
+	MaxRetransmit int
+	// NStart limits exchanges outstanding with the peer, NSTART. 0 means unlimited.
+	NStart int
+	// If CoCoA is set, timeout is estimated from round-trip times of exchanges with the peer
+	// (CoCoA congestion control, draft-ietf-core-cocoa) instead of starting at AckTimeout.
+	CoCoA bool
+}
+
+// DefaultTransmissionParams returns default transmission parameters of RFC 7252.
+func DefaultTransmissionParams() TransmissionParams {
+	return TransmissionParams{
+		AckTimeout:      2 * time.Second,
+		AckRandomFactor: 1.5,
+		MaxRetransmit:   4,
+		NStart:          1,
+	}
+}
+
+// transmission retransmits confirmable requests of session and limits its outstanding exchanges.
+type transmission struct {
+	params TransmissionParams
+	nstart chan struct{}   // nil when unlimited
+	rto    *cocoaEstimator // nil when CoCoA is disabled
+	// retransmitted is called for every retransmission
+	retransmitted func()
+
+	acksLock sync.Mutex
+	acks     map[uint16]chan struct{} // empty ACKs awaited by message ID
+}
+
+// newTransmission returns transmission of params, nil when params is nil - messages are sent once.
+func newTransmission(params *TransmissionParams, retransmitted func()) *transmission {
+	if params == nil {
+		return nil
+	}
+	t := &transmission{
+		params:        *params,
+		retransmitted: retransmitted,
+		acks:          make(map[uint16]chan struct{}),
+	}
+	if t.params.AckTimeout <= 0 {
+		t.params.AckTimeout = DefaultTransmissionParams().AckTimeout
+	}
+	if t.params.AckRandomFactor < 1 {
+		t.params.AckRandomFactor = 1
+	}
+	if t.params.NStart > 0 {
+		t.nstart = make(chan struct{}, t.params.NStart)
+	}
+	if t.params.CoCoA {
+		t.rto = newCocoaEstimator(t.params.AckTimeout)
+	}
+	return t
+}
+
+// acquire waits until exchange may start, the returned func ends it and may be called more times.
+func (t *transmission) acquire(ctx context.Context) (func(), error) {
+	if t.nstart == nil {
+		return func() {}, nil
+	}
+	select {
+	case t.nstart <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-t.nstart })
+	}, nil
+}
+
+// handleAck notifies exchange of message ID of empty ACK, it returns false when none awaits it.
+func (t *transmission) handleAck(messageID uint16) bool {
+	t.acksLock.Lock()
+	defer t.acksLock.Unlock()
+	ch, ok := t.acks[messageID]
+	if ok {
+		close(ch)
+		delete(t.acks, messageID)
+	}
+	return ok
+}
+
+func (t *transmission) awaitAck(messageID uint16) chan struct{} {
+	ch := make(chan struct{})
+	t.acksLock.Lock()
+	defer t.acksLock.Unlock()
+	t.acks[messageID] = ch
+	return ch
+}
+
+func (t *transmission) removeAck(messageID uint16) {
+	t.acksLock.Lock()
+	defer t.acksLock.Unlock()
+	delete(t.acks, messageID)
+}
+
+// initialTimeout returns randomized timeout of the first transmission and its base for backoff.
+func (t *transmission) initialTimeout() (time.Duration, time.Duration) {
+	base := t.params.AckTimeout
+	if t.rto != nil {
+		base = t.rto.RTO()
+	}
+	return time.Duration(float64(base) * (1 + rand.Float64()*(t.params.AckRandomFactor-1))), base
+}
+
+// backoff returns timeout of the next retransmission.
+func (t *transmission) backoff(timeout, base time.Duration) time.Duration {
+	if t.rto != nil {
+		return time.Duration(float64(timeout) * cocoaBackoffFactor(base))
+	}
+	return 2 * timeout
+}
+
+// exchange sends req, confirmable one is retransmitted until it's acknowledged. Piggybacked or
+// empty ACK ends the exchange for NStart, response is awaited until ctx is done then.
+func (t *transmission) exchange(ctx context.Context, req Message, pairChan *sessionResp, writeMsgWithContext func(context.Context, Message) error) (Message, error) {
+	release, err := t.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot exchange: %v", err)
+	}
+	defer release()
+
+	var acked chan struct{}
+	if req.Type() == Confirmable {
+		acked = t.awaitAck(req.MessageID())
+		defer t.removeAck(req.MessageID())
+	}
+	timeout, base := t.initialTimeout()
+	var timer *time.Timer
+	var timeoutC <-chan time.Time
+	start := time.Now()
+	for retransmissions := 0; ; retransmissions++ {
+		if retransmissions > 0 && t.retransmitted != nil {
+			t.retransmitted()
+		}
+		sent := time.Now()
+		if err := writeMsgWithContext(ctx, req); err != nil {
+			return nil, fmt.Errorf("cannot exchange: %v", err)
+		}
+		if req.Type() == Confirmable {
+			if timer == nil {
+				timer = time.NewTimer(timeout)
+				defer timer.Stop()
+				timeoutC = timer.C
+			} else {
+				timer.Reset(timeout)
+			}
+		}
+		select {
+		case resp := <-pairChan.ch:
+			t.measured(retransmissions, sent, start)
+			return resp.Msg, nil
+		case <-acked:
+			// separate response follows
+			t.measured(retransmissions, sent, start)
+			release()
+			select {
+			case resp := <-pairChan.ch:
+				return resp.Msg, nil
+			case <-ctx.Done():
+				return nil, fmt.Errorf("cannot exchange: %v", ctx.Err())
+			}
+		case <-timeoutC:
+			if retransmissions >= t.params.MaxRetransmit {
+				return nil, ErrTimeout
+			}
+			timeout = t.backoff(timeout, base)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("cannot exchange: %v", ctx.Err())
+		}
+	}
+}
+
+// measured updates estimator by round-trip time of acknowledged exchange.
+func (t *transmission) measured(retransmissions int, sent, start time.Time) {
+	if t.rto == nil {
+		return
+	}
+	now := time.Now()
+	t.rto.update(retransmissions, now.Sub(sent), now.Sub(start))
+}
+
+// cocoaBackoffFactor returns variable backoff factor of CoCoA for rto.
+func cocoaBackoffFactor(rto time.Duration) float64 {
+	switch {
+	case rto < time.Second:
+		return 3
+	case rto > 3*time.Second:
+		return 1.5
+	}
+	return 2
+}
+
+const cocoaMaxRTO = 60 * time.Second
+
+// rttEstimator estimates RTO by RFC 6298.
+type rttEstimator struct {
+	srtt, rttvar time.Duration
+	measured     bool
+}
+
+func (e *rttEstimator) update(rtt time.Duration, k time.Duration) time.Duration {
+	if !e.measured {
+		e.srtt, e.rttvar, e.measured = rtt, rtt/2, true
+	} else {
+		diff := e.srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		e.rttvar = (3*e.rttvar + diff) / 4
+		e.srtt = (7*e.srtt + rtt) / 8
+	}
+	return e.srtt + k*e.rttvar
+}
+
+// cocoaEstimator is RTO estimator of CoCoA. Strong estimator takes round-trip times of messages
+// acknowledged without retransmission, weak one of messages retransmitted once or twice measured
+// from the first transmission.
+type cocoaEstimator struct {
+	lock    sync.Mutex
+	strong  rttEstimator
+	weak    rttEstimator
+	rto     time.Duration
+	updated time.Time
+}
+
+func newCocoaEstimator(initial time.Duration) *cocoaEstimator {
+	return &cocoaEstimator{rto: initial, updated: time.Now()}
+}
+
+// RTO returns current RTO, RTO which wasn't updated for long ages towards the initial one.
+func (e *cocoaEstimator) RTO() time.Duration {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	since := time.Since(e.updated)
+	switch {
+	case e.rto < time.Second && since > 16*e.rto:
+		e.rto *= 2
+		e.updated = time.Now()
+	case e.rto > 3*time.Second && since > 4*e.rto:
+		e.rto = (2*time.Second + e.rto) / 2
+		e.updated = time.Now()
+	}
+	return e.rto
+}
+
+func (e *cocoaEstimator) update(retransmissions int, rttLast, rttFirst time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	switch retransmissions {
+	case 0:
+		e.rto = (e.strong.update(rttLast, 4) + e.rto) / 2
+	case 1, 2:
+		e.rto = (e.weak.update(rttFirst, 1) + 3*e.rto) / 4
+	default:
+		return
+	}
+	if e.rto > cocoaMaxRTO {
+		e.rto = cocoaMaxRTO
+	}
+	e.updated = time.Now()
+}
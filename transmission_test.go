@@ -0,0 +1,298 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testUDPPeer is raw UDP endpoint, tests read its datagrams and answer them.
+type testUDPPeer struct {
+	conn *net.UDPConn
+}
+
+func newTestUDPPeer(t *testing.T) *testUDPPeer {
+	a, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	conn, err := net.ListenUDP("udp", a)
+	require.NoError(t, err)
+	return &testUDPPeer{conn: conn}
+}
+
+// read returns next received message, nil when none is received within timeout.
+func (p *testUDPPeer) read(t *testing.T, timeout time.Duration) (*DgramMessage, *net.UDPAddr) {
+	buf := make([]byte, 1500)
+	p.conn.SetReadDeadline(time.Now().Add(timeout))
+	n, addr, err := p.conn.ReadFromUDP(buf)
+	if err != nil {
+		return nil, nil
+	}
+	msg, err := ParseDgramMessage(buf[:n])
+	require.NoError(t, err)
+	return msg, addr
+}
+
+func (p *testUDPPeer) write(t *testing.T, addr *net.UDPAddr, msg Message) {
+	var buf bytes.Buffer
+	require.NoError(t, msg.MarshalBinary(&buf))
+	_, err := p.conn.WriteToUDP(buf.Bytes(), addr)
+	require.NoError(t, err)
+}
+
+func (p *testUDPPeer) ack(t *testing.T, addr *net.UDPAddr, req Message, code COAPCode) {
+	p.write(t, addr, NewDgramMessage(MessageParams{
+		Type:      Acknowledgement,
+		Code:      code,
+		MessageID: req.MessageID(),
+		Token:     req.Token(),
+	}))
+}
+
+func dialTestUDPPeer(t *testing.T, p *testUDPPeer, params TransmissionParams) *ClientConn {
+	c := Client{Net: "udp", TransmissionParams: &params}
+	co, err := c.Dial(p.conn.LocalAddr().String())
+	require.NoError(t, err)
+	return co
+}
+
+func TestTransmissionRetransmitsConfirmable(t *testing.T) {
+	p := newTestUDPPeer(t)
+	defer p.conn.Close()
+	co := dialTestUDPPeer(t, p, TransmissionParams{AckTimeout: 50 * time.Millisecond, AckRandomFactor: 1, MaxRetransmit: 4, NStart: 1})
+	defer co.Close()
+
+	go func() {
+		var first *DgramMessage
+		for i := 0; i < 3; i++ {
+			msg, addr := p.read(t, time.Second)
+			if msg == nil {
+				return
+			}
+			if first == nil {
+				first = msg
+			}
+			assert.Equal(t, first.MessageID(), msg.MessageID())
+			if i == 2 {
+				p.ack(t, addr, msg, Content)
+			}
+		}
+	}()
+	start := time.Now()
+	resp, err := co.Get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, Content, resp.Code())
+	// timeouts of 50ms and 100ms elapsed before the second retransmission
+	assert.True(t, time.Since(start) >= 150*time.Millisecond)
+}
+
+func TestTransmissionTimeout(t *testing.T) {
+	p := newTestUDPPeer(t)
+	defer p.conn.Close()
+	co := dialTestUDPPeer(t, p, TransmissionParams{AckTimeout: 20 * time.Millisecond, AckRandomFactor: 1, MaxRetransmit: 2})
+	defer co.Close()
+
+	_, err := co.Get("/a")
+	assert.Equal(t, ErrTimeout, err)
+	for i := 0; i < 3; i++ {
+		msg, _ := p.read(t, time.Second)
+		require.NotNil(t, msg)
+	}
+	// no more retransmission, blockwise may report the error to the peer
+	msg, _ := p.read(t, 100*time.Millisecond)
+	if msg != nil {
+		assert.NotEqual(t, GET, msg.Code())
+	}
+}
+
+func TestTransmissionNStart(t *testing.T) {
+	p := newTestUDPPeer(t)
+	defer p.conn.Close()
+	co := dialTestUDPPeer(t, p, TransmissionParams{AckTimeout: time.Second, AckRandomFactor: 1, MaxRetransmit: 4, NStart: 1})
+	defer co.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	errs := make(chan error, 2)
+	for _, path := range []string{"/a", "/b"} {
+		go func(path string) {
+			_, err := co.GetWithContext(ctx, path)
+			errs <- err
+		}(path)
+	}
+
+	first, addr := p.read(t, time.Second)
+	require.NotNil(t, first)
+	// the second request waits until the first one is acknowledged
+	msg, _ := p.read(t, 200*time.Millisecond)
+	assert.Nil(t, msg)
+	// empty ACK ends the first exchange for NStart, its separate response is still awaited
+	p.write(t, addr, NewDgramMessage(MessageParams{Type: Acknowledgement, Code: Empty, MessageID: first.MessageID()}))
+	second, addr := p.read(t, time.Second)
+	require.NotNil(t, second)
+	assert.NotEqual(t, first.PathString(), second.PathString())
+	p.ack(t, addr, second, Content)
+	require.NoError(t, <-errs)
+	// the empty ACK stopped retransmission of the first request
+	msg, _ = p.read(t, 1500*time.Millisecond)
+	assert.Nil(t, msg)
+	assert.Error(t, <-errs)
+}
+
+func TestCocoaEstimator(t *testing.T) {
+	e := newCocoaEstimator(2 * time.Second)
+	assert.Equal(t, 2*time.Second, e.RTO())
+
+	// strong: 100ms + 4*50ms
+	e.update(0, 100*time.Millisecond, 100*time.Millisecond)
+	assert.Equal(t, (300*time.Millisecond+2*time.Second)/2, e.RTO())
+
+	// weak: 2s + 1*1s, measured from the first transmission
+	rto := e.RTO()
+	e.update(1, 10*time.Millisecond, 2*time.Second)
+	assert.Equal(t, (3*time.Second+3*rto)/4, e.RTO())
+
+	// more retransmissions are not measured
+	rto = e.RTO()
+	e.update(3, time.Millisecond, time.Millisecond)
+	assert.Equal(t, rto, e.RTO())
+
+	e.lock.Lock()
+	e.rto, e.updated = 500*time.Millisecond, time.Now().Add(-9*time.Second)
+	e.lock.Unlock()
+	assert.Equal(t, time.Second, e.RTO())
+	e.lock.Lock()
+	e.rto, e.updated = 10*time.Second, time.Now().Add(-41*time.Second)
+	e.lock.Unlock()
+	assert.Equal(t, 6*time.Second, e.RTO())
+
+	assert.Equal(t, 3.0, cocoaBackoffFactor(500*time.Millisecond))
+	assert.Equal(t, 2.0, cocoaBackoffFactor(2*time.Second))
+	assert.Equal(t, 1.5, cocoaBackoffFactor(4*time.Second))
+}
+
+func TestTransmissionCoCoAAdaptsTimeout(t *testing.T) {
+	p := newTestUDPPeer(t)
+	defer p.conn.Close()
+	co := dialTestUDPPeer(t, p, TransmissionParams{AckTimeout: 2 * time.Second, AckRandomFactor: 1, MaxRetransmit: 4, CoCoA: true})
+	defer co.Close()
+
+	go func() {
+		for {
+			msg, addr := p.read(t, 3*time.Second)
+			if msg == nil {
+				return
+			}
+			p.ack(t, addr, msg, Content)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err := co.Get("/a")
+		require.NoError(t, err)
+	}
+	tr := co.networkSession().(*blockWiseSession).networkSession.(*sessionUDP).transmission
+	assert.True(t, tr.rto.RTO() < 100*time.Millisecond)
+}
+
+// chaosCapturingDialer keeps the last connection dialed by chaos dialer, so faults are injected
+// only after the DTLS handshake.
+type chaosCapturingDialer struct {
+	coapNet.Dialer
+	conn *coapNet.ChaosConn
+}
+
+func (d *chaosCapturingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := d.Dialer.DialContext(ctx, network, address)
+	if err == nil {
+		d.conn = c.(*coapNet.ChaosConn)
+	}
+	return c, err
+}
+
+// runDTLSEchoServer runs DTLS server which answers GET by path of request.
+func runDTLSEchoServer(t *testing.T) (string, func()) {
+	l, err := coapNet.NewDTLSListener("udp", "127.0.0.1:0", testBridgeDTLSConfig(), time.Millisecond*100)
+	require.NoError(t, err)
+	srv := &Server{Listener: l, Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte(r.Msg.PathString()))
+	})}
+	fin := make(chan error, 1)
+	go func() {
+		fin <- srv.ActivateAndServe()
+	}()
+	return l.Addr().String(), func() {
+		srv.Shutdown()
+		l.Close()
+		<-fin
+	}
+}
+
+func TestTransmissionOverChaosConn(t *testing.T) {
+	addr, shutdown := runDTLSEchoServer(t)
+	defer shutdown()
+
+	d := &chaosCapturingDialer{Dialer: coapNet.NewChaosDialer(&net.Dialer{}, coapNet.ChaosConfig{Rand: rand.New(rand.NewSource(1))})}
+	params := TransmissionParams{AckTimeout: 20 * time.Millisecond, AckRandomFactor: 1, MaxRetransmit: 8}
+	c := Client{Net: "udp-dtls", DTLSConfig: testBridgeDTLSConfig(), Dialer: d, TransmissionParams: &params}
+	co, err := c.Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	// half of requests is lost, retransmission of client delivers them
+	d.conn.DropPacketProbability(0.5)
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("/%v", i)
+		resp, err := co.Get(path)
+		require.NoError(t, err)
+		assert.Equal(t, path[1:], string(resp.Payload()))
+	}
+	assert.True(t, d.conn.Dropped() > 0)
+}
+
+// dialerFunc is coapNet.Dialer implemented by function.
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+func TestTransmissionOverLossyDTLSConn(t *testing.T) {
+	addr, shutdown := runDTLSEchoServer(t)
+	defer shutdown()
+
+	var lossy *coapNet.LossyDTLSConn
+	d := dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		c, err := (&net.Dialer{}).DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		lc := coapNet.NewLossyDTLSConn(c, 0, 0, coapNet.WithLossSource(rand.NewSource(1)))
+		lossy = lc.(*coapNet.LossyDTLSConn)
+		return lc, nil
+	})
+	// MAX_RETRANSMIT of RFC 7252
+	params := TransmissionParams{AckTimeout: 20 * time.Millisecond, AckRandomFactor: 1, MaxRetransmit: 4}
+	c := Client{Net: "udp-dtls", DTLSConfig: testBridgeDTLSConfig(), Dialer: d, TransmissionParams: &params}
+	co, err := c.Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+
+	// server isn't lossy, client loses 30% of written records after the handshake
+	lossy.DropPacketProbability(0.3)
+	for i := 0; i < 20; i++ {
+		path := fmt.Sprintf("/%v", i)
+		resp, err := co.Get(path)
+		require.NoError(t, err)
+		assert.Equal(t, path[1:], string(resp.Payload()))
+	}
+	assert.True(t, lossy.DroppedWrites() > 0)
+	assert.Equal(t, 0, lossy.DroppedReads())
+}
@@ -0,0 +1,147 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+)
+
+// DefaultExchangeLifetime is EXCHANGE_LIFETIME from RFC 7252 with default transmission parameters.
+const DefaultExchangeLifetime = 247 * time.Second
+
+// UDPMultiplexer sends concurrent requests to multiple peers over a single UDP socket.
+// Every request gets unique token and one receive goroutine routes responses
+// to waiting senders by token and address of peer, so other host can't inject response.
+type UDPMultiplexer struct {
+	// ExchangeLifetime bounds how long Send waits for response, the pending token is dropped afterwards.
+	ExchangeLifetime time.Duration
+
+	conn    *coapNet.ConnUDP
+	pending sync.Map // pendingExchange -> chan Message
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// pendingExchange identifies request waiting for response from peer.
+type pendingExchange struct {
+	token string
+	peer  string
+}
+
+// NewUDPMultiplexer creates multiplexer over conn and starts receiving of responses.
+// heartBeat is used as read/write deadline of conn.
+func NewUDPMultiplexer(conn *net.UDPConn, heartBeat time.Duration) *UDPMultiplexer {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &UDPMultiplexer{
+		ExchangeLifetime: DefaultExchangeLifetime,
+		conn:             coapNet.NewConnUDP(conn, heartBeat, 2),
+		cancel:           cancel,
+		done:             make(chan struct{}),
+	}
+	go m.receive(ctx)
+	return m
+}
+
+// LocalAddr returns the local network address.
+func (m *UDPMultiplexer) LocalAddr() net.Addr {
+	return m.conn.LocalAddr()
+}
+
+func (m *UDPMultiplexer) write(ctx context.Context, msg Message, peer *net.UDPAddr) error {
+	buf := bytes.NewBuffer(make([]byte, 0, 256))
+	if err := msg.MarshalBinary(buf); err != nil {
+		return err
+	}
+	return m.conn.WriteWithContext(ctx, coapNet.NewConnUDPContext(peer, nil), buf.Bytes())
+}
+
+func (m *UDPMultiplexer) receive(ctx context.Context) {
+	defer close(m.done)
+	buf := make([]byte, maxDgramSize)
+	for {
+		n, udpCtx, err := m.conn.ReadWithContext(ctx, buf)
+		if err != nil {
+			// temporary errors are retried by ReadWithContext, conn is closed or broken
+			return
+		}
+		// message retains data, buf is reused by next read
+		msg, err := ParseDgramMessage(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+		if msg.Code() == Empty {
+			// ACK of our CON request, response follows separately
+			continue
+		}
+		if msg.Type() == Confirmable {
+			ack := NewDgramMessage(MessageParams{
+				Type:      Acknowledgement,
+				Code:      Empty,
+				MessageID: msg.MessageID(),
+			})
+			m.write(ctx, ack, udpCtx.RemoteAddr().(*net.UDPAddr))
+		}
+		if v, ok := m.pending.Load(pendingExchange{token: string(msg.Token()), peer: udpCtx.RemoteAddr().String()}); ok {
+			select {
+			case v.(chan Message) <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// Send sends req to peer with unique token and waits for response from peer, so peer must be
+// the address responses come from, not unspecified or multicast one.
+func (m *UDPMultiplexer) Send(ctx context.Context, req Message, peer net.Addr) (Message, error) {
+	udpAddr, ok := peer.(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("cannot send: invalid peer address %v", peer)
+	}
+	ch := make(chan Message, 1)
+	var key pendingExchange
+	for {
+		t, err := GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		key = pendingExchange{token: string(t), peer: udpAddr.String()}
+		if _, loaded := m.pending.LoadOrStore(key, ch); !loaded {
+			req.SetToken(t)
+			break
+		}
+	}
+	defer m.pending.Delete(key)
+
+	if m.ExchangeLifetime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.ExchangeLifetime)
+		defer cancel()
+	}
+	if err := m.write(ctx, req, udpAddr); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-m.done:
+		return nil, fmt.Errorf("cannot send: receiving of responses stopped")
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops receiving of responses and closes the socket.
+func (m *UDPMultiplexer) Close() error {
+	m.cancel()
+	err := m.conn.Close()
+	<-m.done
+	return err
+}
@@ -0,0 +1,119 @@
+package coap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUDPMultiplexerConcurrentSend(t *testing.T) {
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write(r.Msg.Payload())
+	})
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+	peer, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		t.Fatalf("unable to resolve address: %v", err)
+	}
+	// responses are matched by address of peer, it mustn't be unspecified one
+	peer.IP = net.IPv4(127, 0, 0, 1)
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	m := NewUDPMultiplexer(conn, time.Millisecond*100)
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := fmt.Sprintf("req-%v", i)
+			req := NewDgramMessage(MessageParams{
+				Type:      Confirmable,
+				Code:      POST,
+				MessageID: GenerateMessageID(),
+				Payload:   []byte(payload),
+			})
+			req.SetPathString("/echo")
+			req.SetOption(ContentFormat, TextPlain)
+			resp, err := m.Send(context.Background(), req, peer)
+			if err != nil {
+				t.Errorf("unable to send: %v", err)
+				return
+			}
+			if string(resp.Payload()) != payload {
+				t.Errorf("expected %q, got %q", payload, resp.Payload())
+			}
+			if string(resp.Token()) != string(req.Token()) {
+				t.Errorf("response token doesn't match request")
+			}
+			tokens[i] = string(req.Token())
+		}(i)
+	}
+	wg.Wait()
+
+	unique := make(map[string]bool)
+	for _, tok := range tokens {
+		unique[tok] = true
+	}
+	if len(unique) != 10 {
+		t.Fatalf("expected 10 distinct tokens, got %v", len(unique))
+	}
+}
+
+func TestUDPMultiplexerDropsResponseFromOtherPeer(t *testing.T) {
+	p := newTestUDPPeer(t)
+	defer p.conn.Close()
+	attacker := newTestUDPPeer(t)
+	defer attacker.conn.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	m := NewUDPMultiplexer(conn, time.Millisecond*100)
+	defer m.Close()
+
+	go func() {
+		req, addr := p.read(t, time.Second)
+		if req == nil {
+			return
+		}
+		spoofed := NewDgramMessage(MessageParams{Type: Acknowledgement, Code: Content, MessageID: req.MessageID(), Token: req.Token(), Payload: []byte("spoofed")})
+		attacker.write(t, addr, spoofed)
+		time.Sleep(time.Millisecond * 50)
+		resp := NewDgramMessage(MessageParams{Type: Acknowledgement, Code: Content, MessageID: req.MessageID(), Token: req.Token(), Payload: []byte("peer")})
+		p.write(t, addr, resp)
+	}()
+	req := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: GenerateMessageID()})
+	req.SetPathString("/a")
+	resp, err := m.Send(context.Background(), req, p.conn.LocalAddr())
+	require.NoError(t, err)
+	assert.Equal(t, "peer", string(resp.Payload()))
+}
+
+func TestUDPMultiplexerStopsOnClosedConn(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	m := NewUDPMultiplexer(conn, time.Millisecond*100)
+	defer m.Close()
+	conn.Close()
+	select {
+	case <-m.done:
+	case <-time.After(time.Second):
+		t.Fatal("receiving didn't stop on closed conn")
+	}
+}
@@ -0,0 +1,201 @@
+package coap
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// URIBuilder builds CoAP URIs (RFC 7252 section 6) from components.
+type URIBuilder struct {
+	scheme string
+	host   string
+	port   int
+	path   []string
+	query  [][2]string
+}
+
+// NewURIBuilder creates builder of "coap" URI.
+func NewURIBuilder() *URIBuilder {
+	return &URIBuilder{scheme: "coap"}
+}
+
+// Scheme sets scheme, "coap", "coaps", "coap+tcp" or "coaps+tcp".
+func (b *URIBuilder) Scheme(s string) *URIBuilder {
+	b.scheme = s
+	return b
+}
+
+// Host sets hostname or IP address.
+func (b *URIBuilder) Host(h string) *URIBuilder {
+	b.host = h
+	return b
+}
+
+// Port sets port, 0 means default port of scheme.
+func (b *URIBuilder) Port(p int) *URIBuilder {
+	b.port = p
+	return b
+}
+
+// Path appends path segments, segments are percent-encoded by Build.
+func (b *URIBuilder) Path(segments ...string) *URIBuilder {
+	b.path = append(b.path, segments...)
+	return b
+}
+
+// QueryParam appends query parameter.
+func (b *URIBuilder) QueryParam(k, v string) *URIBuilder {
+	b.query = append(b.query, [2]string{k, v})
+	return b
+}
+
+func defaultPortOfScheme(scheme string) (int, error) {
+	switch scheme {
+	case "coap", "coap+tcp":
+		return DefaultPort, nil
+	case "coaps", "coaps+tcp":
+		return DefaultSecurePort, nil
+	}
+	return 0, fmt.Errorf("invalid scheme %q", scheme)
+}
+
+func isValidHostname(h string) bool {
+	if len(h) == 0 || len(h) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(h, "."), ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validatePathSegment(s string) error {
+	if s == "." || s == ".." {
+		return fmt.Errorf("invalid path segment %q", s)
+	}
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("path segment %q is not valid UTF-8", s)
+	}
+	return nil
+}
+
+// Build validates components and returns canonical URI. Scheme and host are lowercased,
+// default port is omitted and path segments and query are percent-encoded.
+func (b *URIBuilder) Build() (string, error) {
+	scheme := strings.ToLower(b.scheme)
+	defaultPort, err := defaultPortOfScheme(scheme)
+	if err != nil {
+		return "", err
+	}
+	host := strings.ToLower(b.host)
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		host = ip.String()
+		if ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+	} else if !isValidHostname(host) {
+		return "", fmt.Errorf("invalid host %q", b.host)
+	}
+	if b.port < 0 || b.port > 65535 {
+		return "", fmt.Errorf("invalid port %v", b.port)
+	}
+
+	var uri strings.Builder
+	uri.WriteString(scheme)
+	uri.WriteString("://")
+	uri.WriteString(host)
+	if b.port != 0 && b.port != defaultPort {
+		uri.WriteString(":")
+		uri.WriteString(strconv.Itoa(b.port))
+	}
+	for _, s := range b.path {
+		if err := validatePathSegment(s); err != nil {
+			return "", err
+		}
+		uri.WriteString("/")
+		uri.WriteString(url.PathEscape(s))
+	}
+	for i, q := range b.query {
+		if i == 0 {
+			uri.WriteString("?")
+		} else {
+			uri.WriteString("&")
+		}
+		uri.WriteString(url.QueryEscape(q[0]))
+		if q[1] != "" {
+			uri.WriteString("=")
+			uri.WriteString(url.QueryEscape(q[1]))
+		}
+	}
+	return uri.String(), nil
+}
+
+// CoAPURI is parsed CoAP URI.
+type CoAPURI struct {
+	Scheme string
+	Host   string
+	Addr   *net.UDPAddr
+	// Path contains decoded segments, it's empty for URI without path or with path "/".
+	Path  []string
+	Query url.Values
+}
+
+// ParseCoAPURI parses "coap", "coaps", "coap+tcp" or "coaps+tcp" URI. Hostname is resolved to UDP address.
+func ParseCoAPURI(raw string) (*CoAPURI, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse uri: %v", err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	defaultPort, err := defaultPortOfScheme(scheme)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse uri: %v", err)
+	}
+	if u.Fragment != "" || strings.Contains(raw, "#") {
+		return nil, fmt.Errorf("cannot parse uri: fragment is not allowed")
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("cannot parse uri: host is missing")
+	}
+	port := defaultPort
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil || port > 65535 {
+			return nil, fmt.Errorf("cannot parse uri: invalid port %q", p)
+		}
+	}
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(u.Hostname(), strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse uri: %v", err)
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse uri: %v", err)
+	}
+	res := &CoAPURI{
+		Scheme: scheme,
+		Host:   strings.ToLower(u.Hostname()),
+		Addr:   addr,
+		Query:  query,
+	}
+	if p := u.EscapedPath(); p != "" && p != "/" {
+		for _, s := range strings.Split(strings.TrimPrefix(p, "/"), "/") {
+			segment, err := url.PathUnescape(s)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse uri: %v", err)
+			}
+			res.Path = append(res.Path, segment)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,76 @@
+package coap
+
+import (
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURIBuilder(t *testing.T) {
+	tbl := []struct {
+		name    string
+		builder *URIBuilder
+		uri     string
+		wantErr bool
+	}{
+		{"empty path", NewURIBuilder().Host("example.com"), "coap://example.com", false},
+		{"default port", NewURIBuilder().Scheme("COAPS").Host("Example.COM").Port(5684).Path("a"), "coaps://example.com/a", false},
+		{"port", NewURIBuilder().Host("10.0.0.1").Port(1234).Path("a", "b"), "coap://10.0.0.1:1234/a/b", false},
+		{"ipv6", NewURIBuilder().Host("FE80::1").Port(5685).Path("a"), "coap://[fe80::1]:5685/a", false},
+		{"ipv6 brackets", NewURIBuilder().Host("[::1]"), "coap://[::1]", false},
+		{"percent-encoding", NewURIBuilder().Host("h").Path("a b", "c/d", "ü").QueryParam("k&", "v=1").QueryParam("flag", ""),
+			"coap://h/a%20b/c%2Fd/%C3%BC?k%26=v%3D1&flag", false},
+		{"invalid scheme", NewURIBuilder().Scheme("http").Host("h"), "", true},
+		{"invalid host", NewURIBuilder().Host("a_b"), "", true},
+		{"missing host", NewURIBuilder(), "", true},
+		{"invalid port", NewURIBuilder().Host("h").Port(70000), "", true},
+		{"dot segment", NewURIBuilder().Host("h").Path(".."), "", true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			uri, err := tt.builder.Build()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.uri, uri)
+		})
+	}
+}
+
+func TestParseCoAPURI(t *testing.T) {
+	u, err := ParseCoAPURI("coap://[fe80::1]:5685/a%20b/c%2Fd/%C3%BC?k%26=v%3D1&flag")
+	require.NoError(t, err)
+	assert.Equal(t, "coap", u.Scheme)
+	assert.Equal(t, "fe80::1", u.Host)
+	assert.Equal(t, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 5685}, u.Addr)
+	assert.Equal(t, []string{"a b", "c/d", "ü"}, u.Path)
+	assert.Equal(t, url.Values{"k&": {"v=1"}, "flag": {""}}, u.Query)
+
+	u, err = ParseCoAPURI("coaps://127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSecurePort, u.Addr.Port)
+	assert.Empty(t, u.Path)
+	u, err = ParseCoAPURI("coap://127.0.0.1/")
+	require.NoError(t, err)
+	assert.Empty(t, u.Path)
+
+	for _, raw := range []string{"http://127.0.0.1/a", "coap:///a", "coap://127.0.0.1/a#f", "coap://127.0.0.1:99999/a"} {
+		_, err := ParseCoAPURI(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestURIBuilderRoundTrip(t *testing.T) {
+	uri, err := NewURIBuilder().Host("::1").Path("x y", "z").QueryParam("q", "1").Build()
+	require.NoError(t, err)
+	u, err := ParseCoAPURI(uri)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x y", "z"}, u.Path)
+	assert.Equal(t, "1", u.Query.Get("q"))
+	assert.Equal(t, DefaultPort, u.Addr.Port)
+}
@@ -0,0 +1,198 @@
+package coap
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// uriTemplate is compiled RFC 6570 URI template (Level 1-3) used for matching.
+type uriTemplate struct {
+	template  string
+	path      *regexp.Regexp
+	pathVars  []string // variable names in order of regexp groups
+	queryVars map[string]bool
+	params    map[string]bool // path-style parameters captured with leading '='
+}
+
+var errInvalidURITemplate = errors.New("invalid uri template")
+
+func validVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.', c == '%':
+		default:
+			// explode and prefix modifiers are Level 4
+			return false
+		}
+	}
+	return true
+}
+
+func parseURITemplate(template string) (*uriTemplate, error) {
+	t := &uriTemplate{template: template, queryVars: make(map[string]bool), params: make(map[string]bool)}
+	var re strings.Builder
+	re.WriteString("^")
+	inQuery := false
+	for s := template; len(s) > 0; {
+		i := strings.IndexByte(s, '{')
+		lit := s
+		if i >= 0 {
+			lit = s[:i]
+		}
+		if strings.ContainsAny(lit, "}?") || (inQuery && lit != "") {
+			return nil, errInvalidURITemplate
+		}
+		re.WriteString(regexp.QuoteMeta(lit))
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return nil, errInvalidURITemplate
+		}
+		expr := s[i+1 : i+j]
+		s = s[i+j+1:]
+
+		op := byte(0)
+		if expr != "" && strings.IndexByte("+#./;?&", expr[0]) >= 0 {
+			op = expr[0]
+			expr = expr[1:]
+		}
+		names := strings.Split(expr, ",")
+		for _, name := range names {
+			if !validVarName(name) {
+				return nil, errInvalidURITemplate
+			}
+		}
+		if op == '?' || op == '&' {
+			for _, name := range names {
+				t.queryVars[name] = true
+			}
+			inQuery = true
+			continue
+		}
+		if inQuery {
+			return nil, errInvalidURITemplate
+		}
+
+		switch op {
+		case 0, '+', '#':
+			charset := `[^/?#,]`
+			if op == '+' {
+				charset = `[^?#,]`
+			}
+			if op == '#' {
+				charset = `[^,]`
+				re.WriteString(`(?:#`)
+			}
+			re.WriteString(`(` + charset + `+)`)
+			for range names[1:] {
+				re.WriteString(`(?:,(` + charset + `*))?`)
+			}
+			if op == '#' {
+				re.WriteString(`)?`)
+			}
+		case '.':
+			for range names {
+				re.WriteString(`(?:\.([^/?#.]*))?`)
+			}
+		case '/':
+			for range names {
+				re.WriteString(`(?:/([^/?#]*))?`)
+			}
+		case ';':
+			for _, name := range names {
+				t.params[name] = true
+				re.WriteString(`(?:;` + regexp.QuoteMeta(name) + `((?:=[^;/?#]*)?))?`)
+			}
+		}
+		t.pathVars = append(t.pathVars, names...)
+	}
+	re.WriteString("$")
+	path, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, err
+	}
+	t.path = path
+	return t, nil
+}
+
+func unescapeTemplateValue(v string, unescape func(string) (string, error)) string {
+	if u, err := unescape(v); err == nil {
+		return u
+	}
+	return v
+}
+
+func (t *uriTemplate) match(uri string) (map[string]string, bool) {
+	path, query := uri, ""
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		path, query = uri[:i], uri[i+1:]
+	}
+	m := t.path.FindStringSubmatchIndex(path)
+	if m == nil {
+		return nil, false
+	}
+	vars := make(map[string]string)
+	for i, name := range t.pathVars {
+		if m[2*i+2] >= 0 {
+			v := path[m[2*i+2]:m[2*i+3]]
+			if t.params[name] {
+				v = strings.TrimPrefix(v, "=")
+			}
+			vars[name] = unescapeTemplateValue(v, url.PathUnescape)
+		}
+	}
+	if query != "" && len(t.queryVars) > 0 {
+		for _, q := range strings.Split(query, "&") {
+			k, v := q, ""
+			if i := strings.IndexByte(q, '='); i >= 0 {
+				k, v = q[:i], q[i+1:]
+			}
+			if t.queryVars[k] {
+				vars[k] = unescapeTemplateValue(v, url.QueryUnescape)
+			}
+		}
+	}
+	return vars, true
+}
+
+// MatchURITemplate matches uri against RFC 6570 URI template of Level 1-3
+// and returns bindings of variables which are present in uri. Query variables
+// ({?x,y} and {&x,y}) are bound by name regardless of their order in uri
+// and query parameters unknown to the template are ignored.
+func MatchURITemplate(template, uri string) (map[string]string, bool) {
+	t, err := parseURITemplate(template)
+	if err != nil {
+		return nil, false
+	}
+	return t.match(uri)
+}
+
+type uriTemplateVarsKey struct{}
+
+// URITemplateVars returns variables bound by template of handler registered via
+// ServeMux.HandleTemplate.
+func URITemplateVars(r *Request) map[string]string {
+	if r.Ctx == nil {
+		return nil
+	}
+	vars, _ := r.Ctx.Value(uriTemplateVarsKey{}).(map[string]string)
+	return vars
+}
+
+func withURITemplateVars(r *Request, vars map[string]string) *Request {
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	nr := *r
+	nr.Ctx = context.WithValue(ctx, uriTemplateVarsKey{}, vars)
+	return &nr
+}
@@ -0,0 +1,105 @@
+package coap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchURITemplate(t *testing.T) {
+	tbl := []struct {
+		name     string
+		template string
+		uri      string
+		vars     map[string]string
+		ok       bool
+	}{
+		{"exact", "/sensors", "/sensors", map[string]string{}, true},
+		{"single", "/sensors/{sensorId}", "/sensors/42", map[string]string{"sensorId": "42"}, true},
+		{"multiple", "/sensors/{sensorId}/readings/{readingId}", "/sensors/42/readings/7", map[string]string{"sensorId": "42", "readingId": "7"}, true},
+		{"list", "/map/{x,y}", "/map/1,2", map[string]string{"x": "1", "y": "2"}, true},
+		{"reserved", "/files/{+path}", "/files/a/b/c", map[string]string{"path": "a/b/c"}, true},
+		{"label", "/img{.fmt}", "/img.png", map[string]string{"fmt": "png"}, true},
+		{"segments", "/a{/b,c}", "/a/x/y", map[string]string{"b": "x", "c": "y"}, true},
+		{"params", "/a{;x,y}", "/a;x=1;y", map[string]string{"x": "1", "y": ""}, true},
+		{"query", "/sensors/{sensorId}/readings{?limit,offset}", "/sensors/42/readings?offset=5&limit=10&other=1", map[string]string{"sensorId": "42", "limit": "10", "offset": "5"}, true},
+		{"query continuation", "/r{?a}{&b}", "/r?a=1&b=2", map[string]string{"a": "1", "b": "2"}, true},
+		{"query missing", "/r{?a}", "/r", map[string]string{}, true},
+		{"escaped", "/n/{name}", "/n/a%20b", map[string]string{"name": "a b"}, true},
+		{"no match literal", "/sensors/{sensorId}", "/actuators/42", nil, false},
+		{"no match segments", "/sensors/{sensorId}", "/sensors/42/readings", nil, false},
+		{"no match empty", "/sensors/{sensorId}", "/sensors/", nil, false},
+		{"invalid", "/sensors/{sensorId", "/sensors/42", nil, false},
+		{"level 4", "/sensors/{sensorId*}", "/sensors/42", nil, false},
+	}
+	for _, tt := range tbl {
+		vars, ok := MatchURITemplate(tt.template, tt.uri)
+		if ok != tt.ok {
+			t.Fatalf("%v: expected match %v, got %v", tt.name, tt.ok, ok)
+		}
+		if ok && !reflect.DeepEqual(vars, tt.vars) {
+			t.Fatalf("%v: expected %v, got %v", tt.name, tt.vars, vars)
+		}
+	}
+}
+
+func TestServeMuxHandleTemplate(t *testing.T) {
+	var got string
+	var vars map[string]string
+	handler := func(name string) HandlerFunc {
+		return func(w ResponseWriter, r *Request) {
+			got = name
+			vars = URITemplateVars(r)
+		}
+	}
+	mux := NewServeMux()
+	mux.Handle("/sensors/all", handler("pattern"))
+	if err := mux.HandleTemplate("/sensors/{sensorId}{?limit}", handler("first")); err != nil {
+		t.Fatalf("unable to register template: %v", err)
+	}
+	mux.HandleTemplate("/sensors/{id}", handler("second"))
+	mux.HandleTemplate("users/{user}", handler("users"))
+
+	serve := func(path, query string) {
+		got, vars = "", nil
+		msg := &DgramMessage{}
+		msg.SetPathString(path)
+		if query != "" {
+			msg.SetQueryString(query)
+		}
+		mux.ServeCOAP(nil, &Request{Msg: msg})
+	}
+
+	serve("/sensors/all", "")
+	if got != "pattern" {
+		t.Fatalf("expected pattern handler, got %q", got)
+	}
+	serve("/sensors/42", "limit=10")
+	if got != "first" || !reflect.DeepEqual(vars, map[string]string{"sensorId": "42", "limit": "10"}) {
+		t.Fatalf("expected first template handler, got %q %v", got, vars)
+	}
+	serve("/users/bob", "")
+	if got != "users" || vars["user"] != "bob" {
+		t.Fatalf("expected users template handler, got %q %v", got, vars)
+	}
+
+	if err := mux.HandleRemove("/sensors/{sensorId}{?limit}"); err != nil {
+		t.Fatalf("unable to remove template: %v", err)
+	}
+	serve("/sensors/42", "")
+	if got != "second" || vars["id"] != "42" {
+		t.Fatalf("expected second template handler, got %q %v", got, vars)
+	}
+}
+
+func TestWithURITemplateVarsKeepsRequest(t *testing.T) {
+	msg := &DgramMessage{}
+	buf := make([]byte, 1)
+	r := &Request{Msg: msg, Sequence: 7, pooledMsg: msg, pooledBuf: &buf}
+	nr := withURITemplateVars(r, map[string]string{"id": "42"})
+	if nr.Msg != r.Msg || nr.Sequence != 7 || nr.pooledMsg != msg || nr.pooledBuf != &buf {
+		t.Fatalf("request fields were not kept: %+v", nr)
+	}
+	if URITemplateVars(nr)["id"] != "42" || URITemplateVars(r) != nil {
+		t.Fatalf("unexpected vars: %v %v", URITemplateVars(nr), URITemplateVars(r))
+	}
+}
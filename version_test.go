@@ -0,0 +1,54 @@
+package coap
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateVersion(t *testing.T) {
+	assert.NoError(t, ValidateVersion([]byte{0x40, 0x01, 0, 1}))
+	assert.Equal(t, ErrMessageInvalidVersion, ValidateVersion([]byte{0x80, 0x01, 0, 1}))
+	assert.Equal(t, ErrMessageTruncated, ValidateVersion(nil))
+}
+
+func TestServerDiscardsWrongVersion(t *testing.T) {
+	handled := make(chan struct{}, 2)
+	s := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+		handled <- struct{}{}
+		w.SetCode(Content)
+		w.Write(nil)
+	})}
+	addr, shutdown := runLocalUDPServer(t, s)
+	defer shutdown()
+	conn, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var buf bytes.Buffer
+	require.NoError(t, NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1}).MarshalBinary(&buf))
+	data := buf.Bytes()
+	// version 2
+	data[0] = data[0]&0x3f | 2<<6
+	_, err = conn.Write(data)
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond * 200))
+	_, err = conn.Read(make([]byte, 1500))
+	assert.Error(t, err, "message of version 2 must not be acknowledged")
+	assert.Len(t, handled, 0)
+	assert.Equal(t, int64(1), s.ReceivedWrongVersion())
+
+	// version 1
+	data[0] = data[0]&0x3f | 1<<6
+	_, err = conn.Write(data)
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1500))
+	require.NoError(t, err)
+	assert.Len(t, handled, 1)
+	assert.Equal(t, int64(1), s.ReceivedWrongVersion())
+}
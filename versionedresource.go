@@ -0,0 +1,161 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+)
+
+// VersionStore keeps current versions (ETags) of resources by path.
+type VersionStore interface {
+	// Version returns current ETag of resource, ok is false when resource doesn't exist.
+	Version(path string) (etag []byte, ok bool)
+	// NextVersion assigns new ETag to resource and returns it.
+	NextVersion(path string) []byte
+	// DeleteVersion marks resource as not existing.
+	DeleteVersion(path string)
+}
+
+type memoryVersion struct {
+	version uint64
+	exists  bool
+}
+
+// MemoryVersionStore is VersionStore which keeps versions in memory,
+// ETags are increasing numbers per resource and they are not reused after delete.
+type MemoryVersionStore struct {
+	lock     sync.Mutex
+	versions map[string]*memoryVersion
+}
+
+// NewMemoryVersionStore creates in memory version store.
+func NewMemoryVersionStore() *MemoryVersionStore {
+	return &MemoryVersionStore{versions: make(map[string]*memoryVersion)}
+}
+
+func encodeVersion(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return bytes.TrimLeft(buf, "\x00")
+}
+
+// Version returns current ETag of resource.
+func (s *MemoryVersionStore) Version(path string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v, ok := s.versions[path]
+	if !ok || !v.exists {
+		return nil, false
+	}
+	return encodeVersion(v.version), true
+}
+
+// NextVersion assigns new ETag to resource.
+func (s *MemoryVersionStore) NextVersion(path string) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v, ok := s.versions[path]
+	if !ok {
+		v = &memoryVersion{}
+		s.versions[path] = v
+	}
+	v.version++
+	v.exists = true
+	return encodeVersion(v.version)
+}
+
+// DeleteVersion marks resource as not existing.
+func (s *MemoryVersionStore) DeleteVersion(path string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if v, ok := s.versions[path]; ok {
+		v.exists = false
+	}
+}
+
+type versionedResponseWriter struct {
+	ResponseWriter
+	store VersionStore
+	path  string
+}
+
+func (w *versionedResponseWriter) Write(p []byte) (n int, err error) {
+	return w.WriteWithContext(context.Background(), p)
+}
+
+func (w *versionedResponseWriter) WriteWithContext(ctx context.Context, p []byte) (n int, err error) {
+	l, resp := prepareReponse(w, w.getReq().Msg.Code(), w.getCode(), w.getContentFormat(), p)
+	err = w.WriteMsgWithContext(ctx, resp)
+	return l, err
+}
+
+func (w *versionedResponseWriter) WriteMsg(msg Message) error {
+	return w.WriteMsgWithContext(context.Background(), msg)
+}
+
+func (w *versionedResponseWriter) WriteMsgWithContext(ctx context.Context, msg Message) error {
+	switch msg.Code() {
+	case Created, Changed:
+		msg.SetOption(ETag, w.store.NextVersion(w.path))
+	case Deleted:
+		w.store.DeleteVersion(w.path)
+	case Content, Valid:
+		if etag, ok := w.store.Version(w.path); ok && msg.Option(ETag) == nil {
+			msg.SetOption(ETag, etag)
+		}
+	}
+	return w.ResponseWriter.WriteMsgWithContext(ctx, msg)
+}
+
+func preconditionFailed(msg Message, current []byte, exists bool) bool {
+	if msg.Option(IfNoneMatch) != nil && exists {
+		return true
+	}
+	ifMatch := msg.Options(IfMatch)
+	if len(ifMatch) == 0 {
+		return false
+	}
+	if !exists {
+		return true
+	}
+	for _, v := range ifMatch {
+		etag, _ := v.([]byte)
+		// empty If-Match matches any existing representation
+		if len(etag) == 0 || bytes.Equal(etag, current) {
+			return false
+		}
+	}
+	return true
+}
+
+// VersionedResourceMiddleware provides optimistic concurrency for resources. Every successful
+// write (2.01 Created, 2.04 Changed) assigns new ETag to the resource, which is sent in the response.
+// Request with If-Match which doesn't match current ETag or with If-None-Match for existing
+// resource gets 4.12 Precondition Failed without calling the handler.
+//
+// Modifying requests are serialized, so precondition check and write are atomic.
+func VersionedResourceMiddleware(store VersionStore) MiddlewareFunc {
+	var lock sync.Mutex
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Request) {
+			path := r.Msg.PathString()
+			if r.Msg.Code() != GET && r.Msg.Code() != FETCH {
+				lock.Lock()
+				defer lock.Unlock()
+				current, exists := store.Version(path)
+				if preconditionFailed(r.Msg, current, exists) {
+					w.SetCode(PreconditionFailed)
+					w.Write(nil)
+					return
+				}
+			}
+			next.ServeCOAP(&versionedResponseWriter{ResponseWriter: w, store: store, path: path}, r)
+		})
+	}
+}
+
+// VersionedResource wraps handler of resource by VersionedResourceMiddleware.
+func VersionedResource(h Handler, store VersionStore) Handler {
+	return VersionedResourceMiddleware(store)(h)
+}
@@ -0,0 +1,104 @@
+package coap
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestVersionedResourceConcurrentPut(t *testing.T) {
+	var lock sync.Mutex
+	var value []byte
+	resource := HandlerFunc(func(w ResponseWriter, r *Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.Msg.Code() {
+		case GET:
+			w.SetContentFormat(TextPlain)
+			w.Write(value)
+		case PUT:
+			if value != nil {
+				w.SetCode(Changed)
+			}
+			value = r.Msg.Payload()
+			w.Write(nil)
+		}
+	})
+	mux := NewServeMux()
+	mux.Handle("/r", VersionedResource(resource, NewMemoryVersionStore()))
+	s, addr, fin, err := RunLocalServerUDPWithHandler("udp", ":0", false, BlockWiseSzx1024, mux.ServeCOAP)
+	if err != nil {
+		t.Fatalf("unable to run test server: %v", err)
+	}
+	defer func() {
+		s.Shutdown()
+		<-fin
+	}()
+
+	put := func(co *ClientConn, payload string, ifMatch []byte) Message {
+		req, err := co.NewPutRequest("/r", TextPlain, bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatalf("cannot create request: %v", err)
+		}
+		if ifMatch != nil {
+			req.SetOption(IfMatch, ifMatch)
+		}
+		resp, err := co.Exchange(req)
+		if err != nil {
+			t.Fatalf("cannot put: %v", err)
+		}
+		return resp
+	}
+
+	clients := make([]*ClientConn, 2)
+	for i := range clients {
+		co, err := Dial("udp", addr)
+		if err != nil {
+			t.Fatalf("unable to dialing: %v", err)
+		}
+		defer co.Close()
+		clients[i] = co
+	}
+
+	created := put(clients[0], "initial", nil)
+	if created.Code() != Created {
+		t.Fatalf("expected Created, got %v", created.Code())
+	}
+	createReq, _ := clients[0].NewPutRequest("/r", TextPlain, bytes.NewBufferString("again"))
+	createReq.SetOption(IfNoneMatch, []byte{})
+	if resp, err := clients[0].Exchange(createReq); err != nil || resp.Code() != PreconditionFailed {
+		t.Fatalf("expected PreconditionFailed for If-None-Match on existing resource, got %v %v", resp, err)
+	}
+
+	etags := make([][]byte, 2)
+	for i, co := range clients {
+		resp, err := co.Get("/r")
+		if err != nil {
+			t.Fatalf("cannot get: %v", err)
+		}
+		etags[i], _ = resp.Option(ETag).([]byte)
+	}
+	if !bytes.Equal(etags[0], created.Option(ETag).([]byte)) || !bytes.Equal(etags[0], etags[1]) {
+		t.Fatalf("clients read different ETags: %v %v", etags[0], etags[1])
+	}
+
+	first := put(clients[0], "first", etags[0])
+	if first.Code() != Changed {
+		t.Fatalf("expected Changed, got %v", first.Code())
+	}
+	if bytes.Equal(first.Option(ETag).([]byte), etags[0]) {
+		t.Fatalf("ETag was not changed")
+	}
+	second := put(clients[1], "second", etags[1])
+	if second.Code() != PreconditionFailed {
+		t.Fatalf("expected PreconditionFailed, got %v", second.Code())
+	}
+
+	resp, err := clients[1].Get("/r")
+	if err != nil {
+		t.Fatalf("cannot get: %v", err)
+	}
+	if string(resp.Payload()) != "first" {
+		t.Fatalf("expected value of first client, got %q", resp.Payload())
+	}
+}
@@ -0,0 +1,45 @@
+package coap
+
+// WireSize returns count of bytes of msg serialised by MarshalBinary, without serialising it.
+// Like MarshalBinary, it sorts options of msg by option number. It returns -1 when msg can't be
+// serialised, eg. its token is longer than MaxTokenSize.
+func WireSize(msg Message) int {
+	size, err := wireSize(msg)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// wireSize is WireSize which reports why msg can't be serialised.
+func wireSize(msg Message) (int, error) {
+	if len(msg.Token()) > MaxTokenSize {
+		return 0, ErrInvalidTokenLen
+	}
+	opts := msg.AllOptions()
+	sortOptions(opts)
+	bodyLen, err := bytesLengthOpts(opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(msg.Payload()) > 0 {
+		// payload marker 0xff
+		bodyLen += 1 + len(msg.Payload())
+	}
+	if _, ok := msg.(*TcpMessage); !ok {
+		// version, type and TKL, code and message ID
+		return 4 + len(msg.Token()) + bodyLen, nil
+	}
+	// Len and TKL, extended length and code
+	hdrLen := 2
+	switch {
+	case bodyLen < TCP_MESSAGE_LEN13_BASE:
+	case bodyLen < TCP_MESSAGE_LEN14_BASE:
+		hdrLen++
+	case bodyLen < TCP_MESSAGE_LEN15_BASE:
+		hdrLen += 2
+	default:
+		hdrLen += 4
+	}
+	return hdrLen + len(msg.Token()) + bodyLen, nil
+}
@@ -0,0 +1,85 @@
+package coap
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertWireSize(t *testing.T, msg Message) {
+	size := WireSize(msg)
+	var buf bytes.Buffer
+	require.NoError(t, msg.MarshalBinary(&buf))
+	assert.Equal(t, buf.Len(), size)
+}
+
+func randomMessage(r *rand.Rand, tcp bool) Message {
+	p := MessageParams{
+		Type:      COAPType(r.Intn(4)),
+		Code:      COAPCode(r.Intn(256)),
+		MessageID: uint16(r.Intn(1 << 16)),
+		Token:     make([]byte, r.Intn(MaxTokenSize+1)),
+		Payload:   make([]byte, r.Intn(3)*r.Intn(400)),
+	}
+	r.Read(p.Token)
+	r.Read(p.Payload)
+	var msg Message
+	if tcp {
+		msg = NewTcpMessage(p)
+	} else {
+		msg = NewDgramMessage(p)
+	}
+	for i := r.Intn(6); i > 0; i-- {
+		switch r.Intn(4) {
+		case 0:
+			msg.AddOption(URIPath, string(make([]byte, r.Intn(300))))
+		case 1:
+			msg.AddOption(ContentFormat, MediaType(r.Intn(70000)))
+		case 2:
+			msg.AddOption(Block2, uint32(r.Intn(1<<24)))
+		default:
+			// option number requiring 2 bytes of extended delta
+			msg.AddOption(OptionID(65000+r.Intn(500)), []byte{1, 2})
+		}
+	}
+	return msg
+}
+
+func TestWireSizeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		assertWireSize(t, randomMessage(r, false))
+		assertWireSize(t, randomMessage(r, true))
+	}
+}
+
+func TestWireSizeEdgeCases(t *testing.T) {
+	// zero-length payload has no payload marker
+	msg := NewDgramMessage(MessageParams{Type: Confirmable, Code: GET, MessageID: 1})
+	assert.Equal(t, 4, WireSize(msg))
+
+	// maximum-length token
+	msg.SetToken([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	assertWireSize(t, msg)
+	msg.SetToken(make([]byte, MaxTokenSize+1))
+	assert.Equal(t, -1, WireSize(msg))
+	_, err := wireSize(msg)
+	assert.Equal(t, ErrInvalidTokenLen, err)
+
+	// 2-byte extended delta and length, options out of order
+	msg = NewDgramMessage(MessageParams{Type: Confirmable, Code: POST, MessageID: 1, Payload: []byte("p")})
+	msg.AddOption(OptionID(65000), make([]byte, 300))
+	msg.AddOption(URIPath, "a")
+	size := WireSize(msg)
+	// header, Uri-Path, option 65000 by 1+2+2 bytes of header, payload marker and payload
+	assert.Equal(t, 4+2+5+300+2, size)
+	assertWireSize(t, msg)
+
+	tcp := NewTcpMessage(MessageParams{Code: Content, Token: []byte{1}, Payload: make([]byte, 70000)})
+	assertWireSize(t, tcp)
+	tcp.SetPayload(nil)
+	assertWireSize(t, tcp)
+}
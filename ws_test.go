@@ -0,0 +1,88 @@
+package coap
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	coapNet "github.com/go-ocf/go-coap/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runLocalWSServer(t *testing.T, config *tls.Config, handler Handler) (string, func()) {
+	l, err := coapNet.NewWSListener("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	started := make(chan struct{})
+	srv := &Server{Listener: l, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	fin := make(chan error, 1)
+	go func() {
+		fin <- srv.ActivateAndServe()
+		l.Close()
+	}()
+	<-started
+	return l.Addr().String(), func() {
+		srv.Shutdown()
+		<-fin
+	}
+}
+
+func TestServingWS(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/a", func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write(append([]byte("got "), r.Msg.Payload()...))
+	})
+	addr, shutdown := runLocalWSServer(t, nil, mux)
+	defer shutdown()
+
+	co, err := (&Client{Net: "ws"}).Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+	_, ok := co.commander.networkSession.RemoteAddr().(*net.TCPAddr)
+	assert.True(t, ok)
+
+	resp, err := co.Post("/a", TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	assert.Equal(t, Changed, resp.Code())
+	assert.Equal(t, []byte("got hello"), resp.Payload())
+
+	_, err = co.Get("/b")
+	assert.Error(t, err)
+
+	// message with payload larger than the first extended length of TCP framing
+	payload := bytes.Repeat([]byte{'x'}, 1000)
+	resp, err = co.Post("/a", TextPlain, bytes.NewReader(payload))
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte("got "), payload...), resp.Payload())
+}
+
+func TestServingWSObservation(t *testing.T) {
+	addr, shutdown := runLocalWSServer(t, nil, HandlerFunc(periodicTransmitter))
+	defer shutdown()
+	testServingObservation(t, "ws", addr, false, BlockWiseSzx16)
+}
+
+func TestServingWSS(t *testing.T) {
+	cert, err := tls.X509KeyPair(CertPEMBlock, KeyPEMBlock)
+	require.NoError(t, err)
+	addr, shutdown := runLocalWSServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.SetContentFormat(TextPlain)
+		w.Write([]byte("secure"))
+	}))
+	defer shutdown()
+
+	client := &Client{Net: "ws-tls", TLSConfig: &tls.Config{InsecureSkipVerify: true}, DialTimeout: time.Second * 3}
+	co, err := client.Dial(addr)
+	require.NoError(t, err)
+	defer co.Close()
+	resp, err := co.Get("/a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secure"), resp.Payload())
+
+	// plain websocket client can't talk to wss endpoint
+	_, err = (&Client{Net: "ws", DialTimeout: time.Second}).Dial(addr)
+	assert.Error(t, err)
+}